@@ -0,0 +1,54 @@
+// Package identities with bootstrapping of a new publisher identity and its key
+package identities
+
+import (
+	"crypto/ecdsa"
+
+	"github.com/iotdomain/iotdomain-go/lib"
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/types"
+)
+
+// GenerateIdentity creates a new private key and a self-signed identity of a publisher that is
+// ready to publish. Use WriteIdentityFile to store the identity and key for use by the publisher.
+// The validity is 1 year.
+// Returns the private key of the identity and the signed public identity
+func GenerateIdentity(domain string, publisherID string) (*ecdsa.PrivateKey, *types.PublisherIdentityMessage) {
+	fullIdentity, privKey := CreateIdentity(domain, publisherID)
+	return privKey, &fullIdentity.PublisherIdentityMessage
+}
+
+// ReadIdentityFile reads a publisher identity and its private key from an identity file that was
+// written with WriteIdentityFile or saved by the publisher. The identity is verified as with
+// RegisteredIdentity.LoadIdentity, including that the private key belongs to the identity.
+//  identityFile is the JSON file with the identity, eg {configFolder}/{publisherID}-identity.json
+//  domain and publisherID the identity must belong to
+// Returns the private key and identity, or an error if the file can't be read or is invalid
+func ReadIdentityFile(identityFile string, domain string, publisherID string) (
+	*ecdsa.PrivateKey, *types.PublisherIdentityMessage, error) {
+
+	regIdentity := &RegisteredIdentity{domain: domain, publisherID: publisherID, filename: identityFile}
+	fullIdentity, privKey, err := regIdentity.LoadIdentity()
+	if err != nil {
+		return nil, nil, err
+	}
+	return privKey, &fullIdentity.PublisherIdentityMessage, nil
+}
+
+// WriteIdentityFile writes a publisher identity and its private key to an identity file in the
+// same format as RegisteredIdentity.SaveIdentity, so the publisher can load it on startup.
+// The file is only readable by the owner. An existing file is replaced.
+//  identityFile is the JSON file to write, eg {configFolder}/{publisherID}-identity.json
+func WriteIdentityFile(identityFile string, identity *types.PublisherIdentityMessage, privKey *ecdsa.PrivateKey) error {
+	if identity == nil || privKey == nil {
+		return lib.MakeErrorf("WriteIdentityFile: Missing identity or private key")
+	}
+	regIdentity := &RegisteredIdentity{
+		filename: identityFile,
+		fullIdentity: &types.PublisherFullIdentity{
+			PublisherIdentityMessage: *identity,
+			PrivateKey:               messaging.PrivateKeyToPem(privKey),
+		},
+	}
+	return regIdentity.SaveIdentity()
+}
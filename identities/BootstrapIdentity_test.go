@@ -0,0 +1,62 @@
+package identities_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/identities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBootstrapIdentity(t *testing.T) {
+	folder, _ := ioutil.TempDir("", "iotdomain")
+	defer os.RemoveAll(folder)
+	identityFile := path.Join(folder, "publisher1"+identities.IdentityFileSuffix)
+
+	privKey, identity := identities.GenerateIdentity("test", "publisher1")
+	require.NotNil(t, privKey)
+	require.NotNil(t, identity)
+	err := identities.VerifyPublisherIdentity(identity.Address, identity, nil)
+	assert.NoError(t, err)
+
+	// an existing file with broad permissions is replaced
+	ioutil.WriteFile(identityFile, []byte("old"), 0644)
+	err = identities.WriteIdentityFile(identityFile, identity, privKey)
+	require.NoError(t, err)
+	fileInfo, err := os.Stat(identityFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0400), fileInfo.Mode().Perm())
+
+	privKey2, identity2, err := identities.ReadIdentityFile(identityFile, "test", "publisher1")
+	require.NoError(t, err)
+	assert.Equal(t, identity.Address, identity2.Address)
+	assert.Equal(t, identity.IdentitySignature, identity2.IdentitySignature)
+	assert.Equal(t, privKey.D, privKey2.D)
+
+	// the publisher loads the written identity
+	regIdentity := identities.NewRegisteredIdentity("test", "publisher1", identityFile)
+	fullIdentity, privKey3, err := regIdentity.LoadIdentity()
+	require.NoError(t, err)
+	assert.Equal(t, identity.PublicKey, fullIdentity.PublicKey)
+	assert.Equal(t, privKey.D, privKey3.D)
+
+	// the identity must belong to the publisher
+	_, _, err = identities.ReadIdentityFile(identityFile, "test", "publisher2")
+	assert.Error(t, err)
+
+	// the key must belong to the identity
+	otherKey, _ := identities.GenerateIdentity("test", "publisher2")
+	err = identities.WriteIdentityFile(identityFile, identity, otherKey)
+	require.NoError(t, err)
+	_, _, err = identities.ReadIdentityFile(identityFile, "test", "publisher1")
+	assert.Error(t, err)
+
+	// invalid or missing files
+	_, _, err = identities.ReadIdentityFile(path.Join(folder, "missing.json"), "test", "publisher1")
+	assert.Error(t, err)
+	err = identities.WriteIdentityFile(identityFile, identity, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,169 @@
+// Package identities with a client of the Domain Security Service for verified publisher keys
+package identities
+
+import (
+	"crypto/ecdsa"
+	"sync"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/lib"
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/sirupsen/logrus"
+)
+
+// DSSClient maintains the public keys of the publishers in a domain whose identity is verified by
+// the Domain Security Service (DSS). Use GetPublicKey as the getPublicKey function of a message signer
+// to only accept messages from publishers that are verified by the DSS.
+//
+// Identities are received on domain/+/$identity. An identity is accepted when it is issued and
+// signed by the DSS, not expired, and not older than the current identity of the publisher.
+// An identity is removed when it expires or with RevokeIdentity. Empty messages on the identity
+// address are ignored as they are not authenticated and would let anyone revoke an identity.
+type DSSClient struct {
+	clock         messaging.Clock                            // clock for the expiry of identities
+	domain        string                                     // the domain to verify publishers of
+	dssKey        *ecdsa.PublicKey                           // the public key of the DSS, trust anchor
+	identities    map[string]*types.PublisherIdentityMessage // verified identities by identity address
+	publicKeys    map[string]*ecdsa.PublicKey                // verified public keys by identity address
+	messageSigner *messaging.MessageSigner                   // subscription to identities
+	updateMutex   *sync.RWMutex                              // mutex for concurrent updates
+}
+
+// GetIdentity returns the verified identity of a publisher, or nil if not known or expired
+//  publisherAddress must start with domain/publisherId
+func (dssClient *DSSClient) GetIdentity(publisherAddress string) *types.PublisherIdentityMessage {
+	identityAddress, err := makeIdentityAddressOf(publisherAddress)
+	if err != nil {
+		return nil
+	}
+	dssClient.updateMutex.RLock()
+	defer dssClient.updateMutex.RUnlock()
+	identity := dssClient.identities[identityAddress]
+	if identity == nil || IsIdentityExpiredAt(identity, dssClient.clock.Now()) {
+		return nil
+	}
+	return identity
+}
+
+// GetPublicKey returns the verified public key of a publisher, or nil if the publisher isn't
+// verified by the DSS or its identity has expired.
+//  publisherAddress must start with domain/publisherId, eg the address or sender of a message
+func (dssClient *DSSClient) GetPublicKey(publisherAddress string) *ecdsa.PublicKey {
+	identity := dssClient.GetIdentity(publisherAddress)
+	if identity == nil {
+		return nil
+	}
+	dssClient.updateMutex.RLock()
+	defer dssClient.updateMutex.RUnlock()
+	return dssClient.publicKeys[identity.Address]
+}
+
+// ReceiveIdentity handles a published identity of the domain.
+// An empty message is ignored as it can't be verified to come from the DSS.
+func (dssClient *DSSClient) ReceiveIdentity(address string, rawMessage string) error {
+	if rawMessage == "" {
+		logrus.Infof("DSSClient.ReceiveIdentity: Ignored empty identity message on '%s'", address)
+		return nil
+	}
+	var newIdentity types.PublisherIdentityMessage
+	isSigned, err := messaging.VerifySenderJWSSignature(rawMessage, &newIdentity, nil)
+	if err != nil {
+		return lib.MakeErrorf("DSSClient.ReceiveIdentity: Invalid identity message on '%s': %s", address, err)
+	} else if !isSigned && dssClient.messageSigner.SignMessages() {
+		return lib.MakeErrorf("DSSClient.ReceiveIdentity: Identity message on '%s' isn't signed. Message discarded.", address)
+	}
+	// the DSS identity itself is the trust anchor and not verified by this client
+	if newIdentity.PublisherID == types.DSSPublisherID {
+		return nil
+	}
+	if newIdentity.IssuerID != types.DSSPublisherID {
+		return lib.MakeErrorf("DSSClient.ReceiveIdentity: Identity on '%s' isn't issued by the DSS", address)
+	}
+	dssClient.updateMutex.RLock()
+	now := dssClient.clock.Now()
+	dssClient.updateMutex.RUnlock()
+	err = verifyPublisherIdentityAt(address, &newIdentity, dssClient.dssKey, now)
+	if err != nil {
+		return err
+	}
+	publicKey := messaging.PublicKeyFromPem(newIdentity.PublicKey)
+	if publicKey == nil {
+		return lib.MakeErrorf("DSSClient.ReceiveIdentity: Identity on '%s' has an invalid public key", address)
+	}
+	newTime, err := time.Parse(types.TimeFormat, newIdentity.Timestamp)
+	if err != nil {
+		return lib.MakeErrorf("DSSClient.ReceiveIdentity: Identity on '%s' has an invalid timestamp: %s", address, err)
+	}
+
+	dssClient.updateMutex.Lock()
+	defer dssClient.updateMutex.Unlock()
+	current := dssClient.identities[address]
+	if current != nil && isOlderTimestamp(newTime, current.Timestamp) {
+		return lib.MakeErrorf("DSSClient.ReceiveIdentity: Identity on '%s' is older than the current identity", address)
+	}
+	dssClient.identities[address] = &newIdentity
+	dssClient.publicKeys[address] = publicKey
+	logrus.Infof("DSSClient.ReceiveIdentity: Verified identity of publisher %s", address)
+	return nil
+}
+
+// RevokeIdentity removes the identity of a publisher so its messages are no longer verified
+//  publisherAddress must start with domain/publisherId
+func (dssClient *DSSClient) RevokeIdentity(publisherAddress string) {
+	identityAddress, err := makeIdentityAddressOf(publisherAddress)
+	if err != nil {
+		return
+	}
+	dssClient.updateMutex.Lock()
+	defer dssClient.updateMutex.Unlock()
+	if _, found := dssClient.identities[identityAddress]; found {
+		logrus.Warningf("DSSClient.RevokeIdentity: Identity of publisher %s is revoked", identityAddress)
+	}
+	delete(dssClient.identities, identityAddress)
+	delete(dssClient.publicKeys, identityAddress)
+}
+
+// SetClock sets the clock used to determine if identities are expired. Intended for testing.
+func (dssClient *DSSClient) SetClock(clock messaging.Clock) {
+	dssClient.updateMutex.Lock()
+	defer dssClient.updateMutex.Unlock()
+	dssClient.clock = clock
+}
+
+// isOlderTimestamp returns true if the time is before the timestamp in types.TimeFormat
+// Timestamps with a different timezone offset are compared by their time instant.
+func isOlderTimestamp(newTime time.Time, timestamp string) bool {
+	currentTime, err := time.Parse(types.TimeFormat, timestamp)
+	return err == nil && newTime.Before(currentTime)
+}
+
+// Start listening for publisher identities of the domain
+func (dssClient *DSSClient) Start() {
+	addr := MakePublisherIdentityAddress(dssClient.domain, "+")
+	dssClient.messageSigner.Subscribe(addr, dssClient.ReceiveIdentity)
+}
+
+// Stop listening for publisher identities
+func (dssClient *DSSClient) Stop() {
+	addr := MakePublisherIdentityAddress(dssClient.domain, "+")
+	dssClient.messageSigner.Unsubscribe(addr, dssClient.ReceiveIdentity)
+}
+
+// NewDSSClient creates a client for verifying publisher identities of a domain using the DSS public key.
+// Run Start() to start listening for identities.
+//  domain whose publishers to verify
+//  dssKey is the public key of the domain's DSS
+//  messageSigner to subscribe with
+func NewDSSClient(domain string, dssKey *ecdsa.PublicKey, messageSigner *messaging.MessageSigner) *DSSClient {
+	dssClient := &DSSClient{
+		clock:         messaging.RealClock,
+		domain:        domain,
+		dssKey:        dssKey,
+		identities:    make(map[string]*types.PublisherIdentityMessage),
+		publicKeys:    make(map[string]*ecdsa.PublicKey),
+		messageSigner: messageSigner,
+		updateMutex:   &sync.RWMutex{},
+	}
+	return dssClient
+}
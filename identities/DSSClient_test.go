@@ -0,0 +1,102 @@
+package identities_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/identities"
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDSSClient(t *testing.T) {
+	const domain = "test"
+	const publisher1ID = "publisher1"
+	const publisher2ID = "publisher2"
+	messenger := messaging.NewInMemoryMessenger(dummyConfig)
+	dssKeys := messaging.CreateAsymKeys()
+
+	client := identities.NewDSSClient(domain, &dssKeys.PublicKey, messaging.NewMessageSigner(messenger, nil, nil))
+	client.Start()
+
+	// publisher 1 identity is issued by the DSS
+	pub1Ident, pub1Keys := identities.CreateIdentity(domain, publisher1ID)
+	pub1Ident.IssuerID = types.DSSPublisherID
+	messaging.SignIdentity(&pub1Ident.PublisherIdentityMessage, dssKeys)
+	pub1Signer := messaging.NewMessageSigner(messenger, pub1Keys, nil)
+	err := pub1Signer.PublishObject(pub1Ident.Address, true, &pub1Ident.PublisherIdentityMessage, nil)
+	require.NoError(t, err)
+	pubKey := client.GetPublicKey(domain + "/" + publisher1ID + "/node1")
+	require.NotNil(t, pubKey)
+	assert.Equal(t, pub1Keys.PublicKey, *pubKey)
+
+	// publisher 2 identity is self signed and not accepted
+	pub2Ident, pub2Keys := identities.CreateIdentity(domain, publisher2ID)
+	pub2Signer := messaging.NewMessageSigner(messenger, pub2Keys, nil)
+	pub2Signer.PublishObject(pub2Ident.Address, true, &pub2Ident.PublisherIdentityMessage, nil)
+	assert.Nil(t, client.GetPublicKey(pub2Ident.Address))
+	// issued by the DSS but signed by someone else
+	pub2Ident.IssuerID = types.DSSPublisherID
+	messaging.SignIdentity(&pub2Ident.PublisherIdentityMessage, pub2Keys)
+	pub2Signer.PublishObject(pub2Ident.Address, true, &pub2Ident.PublisherIdentityMessage, nil)
+	assert.Nil(t, client.GetPublicKey(pub2Ident.Address))
+
+	// verified keys can be used to verify messages
+	signer := messaging.NewMessageSigner(messenger, nil, client.GetPublicKey)
+	msg, _ := pub1Signer.SignObject(&types.OutputLatestMessage{Address: domain + "/" + publisher1ID + "/node1/temperature/0/$latest"})
+	var latest types.OutputLatestMessage
+	_, err = signer.VerifySignedMessage(msg, &latest)
+	assert.NoError(t, err)
+
+	// an older identity doesn't replace the current identity
+	oldIdent, _ := identities.CreateIdentity(domain, publisher1ID)
+	oldIdent.IssuerID = types.DSSPublisherID
+	oldIdent.Timestamp = time.Now().Add(-time.Hour).Format(types.TimeFormat)
+	messaging.SignIdentity(&oldIdent.PublisherIdentityMessage, dssKeys)
+	err = client.ReceiveIdentity(oldIdent.Address, mustSign(pub1Signer, &oldIdent.PublisherIdentityMessage))
+	assert.Error(t, err)
+	assert.Equal(t, pub1Keys.PublicKey, *client.GetPublicKey(pub1Ident.Address))
+
+	// an expired identity is rejected
+	expiredIdent, _ := identities.CreateIdentity(domain, publisher2ID)
+	expiredIdent.IssuerID = types.DSSPublisherID
+	expiredIdent.ValidUntil = time.Now().Add(-time.Minute).Format(types.TimeFormat)
+	messaging.SignIdentity(&expiredIdent.PublisherIdentityMessage, dssKeys)
+	err = client.ReceiveIdentity(expiredIdent.Address, mustSign(pub2Signer, &expiredIdent.PublisherIdentityMessage))
+	assert.Error(t, err)
+	assert.Nil(t, client.GetPublicKey(expiredIdent.Address))
+
+	// an older identity with a different timezone offset doesn't replace the current identity
+	oldIdent.Timestamp = time.Now().Add(-time.Hour).In(time.FixedZone("east", 12*3600)).Format(types.TimeFormat)
+	messaging.SignIdentity(&oldIdent.PublisherIdentityMessage, dssKeys)
+	err = client.ReceiveIdentity(oldIdent.Address, mustSign(pub1Signer, &oldIdent.PublisherIdentityMessage))
+	assert.Error(t, err)
+
+	// an empty message is not authenticated and doesn't revoke the identity
+	messenger.Publish(pub1Ident.Address, true, "")
+	assert.NotNil(t, client.GetPublicKey(pub1Ident.Address))
+
+	// identities expire by the client clock
+	clock := messaging.NewManualClock(time.Now())
+	client.SetClock(clock)
+	assert.NotNil(t, client.GetIdentity(pub1Ident.Address))
+	clock.Advance(time.Hour * 24 * 366)
+	assert.Nil(t, client.GetIdentity(pub1Ident.Address))
+	client.SetClock(messaging.RealClock)
+
+	// revocation by the application
+	client.RevokeIdentity(pub1Ident.Address)
+	assert.Nil(t, client.GetPublicKey(pub1Ident.Address))
+	assert.Nil(t, client.GetIdentity(pub1Ident.Address))
+	_, err = signer.VerifySignedMessage(msg, &latest)
+	assert.Error(t, err)
+
+	client.Stop()
+}
+
+func mustSign(signer *messaging.MessageSigner, object interface{}) string {
+	message, _ := signer.SignObject(object)
+	return message
+}
@@ -2,11 +2,13 @@
 package identities
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"encoding/json"
 	"io/ioutil"
 	"reflect"
-	"strings"
+	"sync"
+	"time"
 
 	"github.com/iotdomain/iotdomain-go/lib"
 	"github.com/iotdomain/iotdomain-go/messaging"
@@ -19,7 +21,10 @@ import (
 // DomainPublisherIdentities with discovered and verified identities of publishers
 type DomainPublisherIdentities struct {
 	c              lib.DomainCollection //
+	clock          messaging.Clock      // clock for the expiry of identities
 	publicKeyCache map[string]*ecdsa.PublicKey
+	dssKeys        map[string]*ecdsa.PublicKey // configured DSS keys by domain, trust anchor of DSS issued identities
+	dssMutex       *sync.RWMutex               // mutex for concurrent access to clock and dssKeys
 }
 
 // AddIdentity adds a new public identity and generate its public key in the cache
@@ -37,6 +42,35 @@ func (pubIdentities *DomainPublisherIdentities) GetAllPublishers() []*types.Publ
 	return identList
 }
 
+// GetDSSKey returns the configured public key of the DSS of a domain, or nil if not configured
+func (pubIdentities *DomainPublisherIdentities) GetDSSKey(domain string) *ecdsa.PublicKey {
+	pubIdentities.dssMutex.RLock()
+	defer pubIdentities.dssMutex.RUnlock()
+	return pubIdentities.dssKeys[domain]
+}
+
+// SetClock sets the clock used to determine if identities are expired. Intended for testing.
+func (pubIdentities *DomainPublisherIdentities) SetClock(clock messaging.Clock) {
+	pubIdentities.dssMutex.Lock()
+	defer pubIdentities.dssMutex.Unlock()
+	pubIdentities.clock = clock
+}
+
+// SetDSSKey sets the public key of the DSS of a domain. This key is the trust anchor for identities
+// issued by the DSS, like the key used by DSSClient. The DSS key that is discovered in the domain is
+// not trusted as anyone can publish it. Use nil to remove the key.
+//  domain whose DSS key to set
+//  dssKey is the public key of the domain's DSS
+func (pubIdentities *DomainPublisherIdentities) SetDSSKey(domain string, dssKey *ecdsa.PublicKey) {
+	pubIdentities.dssMutex.Lock()
+	defer pubIdentities.dssMutex.Unlock()
+	if dssKey == nil {
+		delete(pubIdentities.dssKeys, domain)
+	} else {
+		pubIdentities.dssKeys[domain] = dssKey
+	}
+}
+
 // GetDSSIdentity returns the Domain Security Service publisher identity
 // Returns nil if no DSS was received
 func (pubIdentities *DomainPublisherIdentities) GetDSSIdentity(domain string) *types.PublisherIdentityMessage {
@@ -64,12 +98,11 @@ func (pubIdentities *DomainPublisherIdentities) GetPublisherByAddress(address st
 // returns public key or nil if publisher public key is not found
 func (pubIdentities *DomainPublisherIdentities) GetPublisherKey(publisherAddress string) *ecdsa.PublicKey {
 	// cleanup the address
-	segments := strings.Split(publisherAddress, "/")
-	if len(segments) < 2 {
+	identityAddress, err := makeIdentityAddressOf(publisherAddress)
+	if err != nil {
 		// missing publisherId
 		return nil
 	}
-	identityAddress := MakePublisherIdentityAddress(segments[0], segments[1])
 	// first try using the public key cache
 	pubKey := pubIdentities.publicKeyCache[identityAddress]
 	// if pubKey == nil {
@@ -139,8 +172,15 @@ func (pubIdentities *DomainPublisherIdentities) UpdateCount() int {
 //  When the issuer is a CA, the CA public key must be known
 func VerifyPublisherIdentity(rxAddress string, ident *types.PublisherIdentityMessage,
 	dssSigningKey *ecdsa.PublicKey) error {
+	return verifyPublisherIdentityAt(rxAddress, ident, dssSigningKey, messaging.RealClock.Now())
+}
+
+// verifyPublisherIdentityAt verifies the identity like VerifyPublisherIdentity, with expiry at the given time
+func verifyPublisherIdentityAt(rxAddress string, ident *types.PublisherIdentityMessage,
+	dssSigningKey *ecdsa.PublicKey, now time.Time) error {
 
-	var signingKey *ecdsa.PublicKey
+	var signingKey crypto.PublicKey
+	var err error
 
 	// identity must contain public key, issuer and signature
 	if ident.PublicKey == "" ||
@@ -151,11 +191,11 @@ func VerifyPublisherIdentity(rxAddress string, ident *types.PublisherIdentityMes
 		return err
 	}
 	// domain/publisherID must match the address
-	segments := strings.Split(rxAddress, "/")
-	if len(segments) < 2 ||
+	segments, err := types.ParseBaseAddress(rxAddress)
+	if err != nil ||
 		ident.Address != rxAddress ||
-		ident.Domain != segments[0] ||
-		ident.PublisherID != segments[1] {
+		ident.Domain != segments.Domain ||
+		ident.PublisherID != segments.PublisherID {
 		err := lib.MakeErrorf("VerifyPublisherIdentity: invalid domain/publisher '%s/%s', or address '%s'",
 			ident.Domain, ident.PublisherID, ident.Address)
 		return err
@@ -171,7 +211,7 @@ func VerifyPublisherIdentity(rxAddress string, ident *types.PublisherIdentityMes
 	}
 
 	// identity must not be expired
-	expired := IsIdentityExpired(ident)
+	expired := IsIdentityExpiredAt(ident, now)
 	if expired {
 		err := lib.MakeErrorf("VerifyIdentity: Identity '%s' is expired", rxAddress)
 		return err
@@ -179,11 +219,15 @@ func VerifyPublisherIdentity(rxAddress string, ident *types.PublisherIdentityMes
 	if ident.IssuerID == types.DSSPublisherID {
 		signingKey = dssSigningKey
 	} else {
-		signingKey = messaging.PublicKeyFromPem(ident.PublicKey)
+		// the identity's own key type determines the algorithm
+		signingKey, err = messaging.ParsePublicKeyPem(ident.PublicKey)
+		if err != nil {
+			return lib.MakeErrorf("VerifyIdentity: Identity '%s' has an invalid public key: %s", rxAddress, err)
+		}
 	}
 
 	// Self signed or DSS signed identity
-	err := messaging.VerifyIdentitySignature(ident, signingKey)
+	err = messaging.VerifyIdentity(ident, signingKey)
 	if err != nil {
 		return lib.MakeErrorf("VerifyIdentity: Verification of %s message failed. "+
 			"The identity signature doesn't match", rxAddress)
@@ -196,7 +240,10 @@ func VerifyPublisherIdentity(rxAddress string, ident *types.PublisherIdentityMes
 func NewDomainPublisherIdentities() *DomainPublisherIdentities {
 	domainIdentities := &DomainPublisherIdentities{
 		c:              lib.NewDomainCollection(reflect.TypeOf(&types.InputDiscoveryMessage{}), nil),
+		clock:          messaging.RealClock,
 		publicKeyCache: make(map[string]*ecdsa.PublicKey),
+		dssKeys:        make(map[string]*ecdsa.PublicKey),
+		dssMutex:       &sync.RWMutex{},
 	}
 	domainIdentities.c.GetPublicKey = domainIdentities.GetPublisherKey
 	return domainIdentities
@@ -2,9 +2,14 @@ package identities_test
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/iotdomain/iotdomain-go/identities"
 	"github.com/iotdomain/iotdomain-go/messaging"
@@ -158,7 +163,7 @@ func TestDSSiscovery(t *testing.T) {
 	const Source1ID = "source1"
 	const domain = "test"
 	const domain2 = "test2"
-	const ident2Addr = domain2 + "/" + types.DSSPublisherID + "/" + types.MessageTypeIdentity
+	const ident2Addr = domain2 + "/" + types.DSSPublisherID + "/" + string(types.MessageTypeIdentity)
 
 	privKey := messaging.CreateAsymKeys()
 	collection := identities.NewDomainPublisherIdentities()
@@ -210,3 +215,28 @@ func TestDSSiscovery(t *testing.T) {
 
 	receiver.Stop()
 }
+
+func TestVerifyEd25519Identity(t *testing.T) {
+	const domain = "test"
+	const publisherID = "pub1"
+	edPub, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	x509Pub, _ := x509.MarshalPKIXPublicKey(edPub)
+	ident := types.PublisherIdentityMessage{
+		Address:     identities.MakePublisherIdentityAddress(domain, publisherID),
+		Domain:      domain,
+		IssuerID:    publisherID,
+		PublicKey:   string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: x509Pub})),
+		PublisherID: publisherID,
+		ValidUntil:  time.Now().Add(time.Hour).Format(types.TimeFormat),
+	}
+	// a self-signed identity is verified with the algorithm of its own key type
+	err := messaging.SignIdentityWithKey(&ident, edPriv)
+	require.NoError(t, err)
+	err = identities.VerifyPublisherIdentity(ident.Address, &ident, nil)
+	assert.NoError(t, err)
+
+	// the signature of another key type doesn't verify
+	messaging.SignIdentity(&ident, messaging.CreateAsymKeys())
+	err = identities.VerifyPublisherIdentity(ident.Address, &ident, nil)
+	assert.Error(t, err)
+}
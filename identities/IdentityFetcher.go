@@ -0,0 +1,256 @@
+// Package identities with on demand fetching of publisher identities
+package identities
+
+import (
+	"container/list"
+	"crypto/ecdsa"
+	"sync"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/sirupsen/logrus"
+)
+
+// Defaults for fetching identities on demand
+const (
+	DefaultFetchCacheSize   = 100             // max nr of fetched public keys to keep
+	DefaultFetchRetryDelay  = time.Minute     // delay before retrying to fetch an identity that didn't arrive
+	DefaultFetchTimeout     = 1 * time.Second // max time to wait for a retained identity
+	DefaultMaxFetching      = 16              // max nr of identities that are fetched at the same time
+	DefaultMissingCacheSize = 1000            // max nr of identities that didn't arrive to remember
+)
+
+// IdentityFetcher obtains the public key of publishers whose identity has not yet been received.
+// Use GetPublicKey as the getPublicKey function of a message signer. When the key of a sender is not
+// known, the fetcher subscribes to the sender's retained identity, verifies it, and caches the key.
+//
+// Fetching is asynchronous so message delivery is never blocked while waiting for an identity. The
+// message that triggers the fetch is rejected, unless the messenger delivers the retained identity
+// while subscribing, and the messages that follow are verified with the cached key.
+//
+// Fetched keys are kept in a cache of limited size, the oldest entry is removed when it is full.
+// Identities that do not arrive within the fetch timeout are not requested again until the retry delay
+// has passed. As senders are claimed by the message, the nr of concurrent fetches and the nr of
+// remembered missing identities are limited, the least recently used missing identity is forgotten
+// first.
+type IdentityFetcher struct {
+	domainIdentities *DomainPublisherIdentities // known identities, checked first
+	messageSigner    *messaging.MessageSigner   // subscription to identities
+	cacheSize        int                        // max nr of fetched keys
+	fetchTimeout     time.Duration              // max time to wait for an identity
+	retryDelay       time.Duration              // delay before fetching a missing identity again
+	publicKeys       map[string]*ecdsa.PublicKey
+	cacheOrder       []string                 // identity addresses in the order they were cached
+	fetchCount       uint64                   // nr of fetches started, to identify a fetch
+	fetching         map[string]uint64        // identity addresses currently being fetched, by fetch
+	maxFetching      int                      // max nr of concurrent fetches
+	maxMissing       int                      // max nr of missing identities to remember
+	missing          map[string]*list.Element // identity addresses that didn't arrive
+	missingOrder     *list.List               // missing identities, most recently used first
+	updateMutex      *sync.Mutex
+}
+
+// missingIdentity is an identity that didn't arrive within the fetch timeout
+type missingIdentity struct {
+	address  string
+	failTime time.Time
+}
+
+// GetPublicKey returns the public key of a publisher, or starts fetching its identity if it isn't known
+//  publisherAddress must start with domain/publisherId
+// Returns nil if the identity is not available or fails verification
+func (fetcher *IdentityFetcher) GetPublicKey(publisherAddress string) *ecdsa.PublicKey {
+	identityAddress, err := makeIdentityAddressOf(publisherAddress)
+	if err != nil {
+		return nil
+	}
+	pubKey := fetcher.domainIdentities.GetPublisherKey(publisherAddress)
+	if pubKey != nil {
+		return pubKey
+	}
+
+	fetcher.updateMutex.Lock()
+	pubKey = fetcher.publicKeys[identityAddress]
+	if pubKey != nil {
+		fetcher.updateMutex.Unlock()
+		return pubKey
+	}
+	_, isFetching := fetcher.fetching[identityAddress]
+	if isFetching || fetcher.isMissing(identityAddress) || len(fetcher.fetching) >= fetcher.maxFetching {
+		fetcher.updateMutex.Unlock()
+		return nil
+	}
+	fetcher.fetchCount++
+	fetchID := fetcher.fetchCount
+	fetcher.fetching[identityAddress] = fetchID
+	timeout := fetcher.fetchTimeout
+	fetcher.updateMutex.Unlock()
+
+	fetcher.fetchIdentity(identityAddress, fetchID, timeout)
+
+	// the messenger can deliver a retained identity while subscribing
+	fetcher.updateMutex.Lock()
+	defer fetcher.updateMutex.Unlock()
+	return fetcher.publicKeys[identityAddress]
+}
+
+// SetFetchLimits changes the max nr of concurrent fetches and the max nr of remembered identities
+// that didn't arrive. Values of 0 leave the setting unchanged.
+func (fetcher *IdentityFetcher) SetFetchLimits(maxFetching int, maxMissing int) {
+	fetcher.updateMutex.Lock()
+	defer fetcher.updateMutex.Unlock()
+	if maxFetching > 0 {
+		fetcher.maxFetching = maxFetching
+	}
+	if maxMissing > 0 {
+		fetcher.maxMissing = maxMissing
+		for fetcher.missingOrder.Len() > fetcher.maxMissing {
+			fetcher.removeMissing(fetcher.missingOrder.Back().Value.(*missingIdentity).address)
+		}
+	}
+}
+
+// SetLimits changes the cache size, fetch timeout and retry delay
+// Values of 0 leave the setting unchanged.
+func (fetcher *IdentityFetcher) SetLimits(cacheSize int, fetchTimeout time.Duration, retryDelay time.Duration) {
+	fetcher.updateMutex.Lock()
+	defer fetcher.updateMutex.Unlock()
+	if cacheSize > 0 {
+		fetcher.cacheSize = cacheSize
+		for len(fetcher.cacheOrder) > fetcher.cacheSize {
+			fetcher.removeOldest()
+		}
+	}
+	if fetchTimeout > 0 {
+		fetcher.fetchTimeout = fetchTimeout
+	}
+	if retryDelay > 0 {
+		fetcher.retryDelay = retryDelay
+	}
+}
+
+// addKey adds a fetched key to the cache and removes the oldest entry when the cache is full
+// Must be called with the update mutex locked
+func (fetcher *IdentityFetcher) addKey(identityAddress string, pubKey *ecdsa.PublicKey) {
+	if _, exists := fetcher.publicKeys[identityAddress]; !exists {
+		for len(fetcher.cacheOrder) >= fetcher.cacheSize {
+			fetcher.removeOldest()
+		}
+		fetcher.cacheOrder = append(fetcher.cacheOrder, identityAddress)
+	}
+	fetcher.publicKeys[identityAddress] = pubKey
+}
+
+// fetchIdentity subscribes to the retained identity of a publisher without waiting for it. The
+// identity is cached when it is received. The subscription ends after the fetch timeout, and the
+// identity is marked as missing if it wasn't received.
+func (fetcher *IdentityFetcher) fetchIdentity(identityAddress string, fetchID uint64, timeout time.Duration) {
+	handler := func(address string, rawMessage string) error {
+		ident, err := decodeDomainIdentity(address, rawMessage,
+			fetcher.domainIdentities, fetcher.messageSigner.SignMessages())
+		if err != nil {
+			return err
+		}
+		fetcher.finishFetch(identityAddress, fetchID, ident)
+		return nil
+	}
+	logrus.Infof("IdentityFetcher.fetchIdentity: fetching identity '%s'", identityAddress)
+	subscriptionID := fetcher.messageSigner.Subscribe(identityAddress, handler)
+	time.AfterFunc(timeout, func() {
+		fetcher.messageSigner.UnsubscribeByID(subscriptionID)
+		fetcher.finishFetch(identityAddress, fetchID, nil)
+	})
+}
+
+// finishFetch ends a fetch with the received identity, or nil if the identity didn't arrive
+// Fetches that already finished are ignored.
+func (fetcher *IdentityFetcher) finishFetch(identityAddress string, fetchID uint64, ident *types.PublisherIdentityMessage) {
+	fetcher.updateMutex.Lock()
+	defer fetcher.updateMutex.Unlock()
+	if fetcher.fetching[identityAddress] != fetchID {
+		return
+	}
+	delete(fetcher.fetching, identityAddress)
+	if ident == nil {
+		logrus.Warningf("IdentityFetcher.fetchIdentity: identity '%s' not received within %s",
+			identityAddress, fetcher.fetchTimeout)
+		fetcher.addMissing(identityAddress)
+		return
+	}
+	fetcher.removeMissing(identityAddress)
+	pubKey := messaging.PublicKeyFromPem(ident.PublicKey)
+	if pubKey != nil {
+		fetcher.addKey(identityAddress, pubKey)
+	}
+}
+
+// addMissing remembers an identity that didn't arrive and forgets the least recently used
+// missing identity when the limit is reached.
+// Must be called with the update mutex locked
+func (fetcher *IdentityFetcher) addMissing(identityAddress string) {
+	fetcher.removeMissing(identityAddress)
+	for fetcher.missingOrder.Len() >= fetcher.maxMissing {
+		fetcher.removeMissing(fetcher.missingOrder.Back().Value.(*missingIdentity).address)
+	}
+	entry := &missingIdentity{address: identityAddress, failTime: fetcher.messageSigner.Clock().Now()}
+	fetcher.missing[identityAddress] = fetcher.missingOrder.PushFront(entry)
+}
+
+// isMissing returns true if an identity didn't arrive within the retry delay. Expired entries are
+// removed and entries that are still valid become the most recently used.
+// Must be called with the update mutex locked
+func (fetcher *IdentityFetcher) isMissing(identityAddress string) bool {
+	element := fetcher.missing[identityAddress]
+	if element == nil {
+		return false
+	}
+	entry := element.Value.(*missingIdentity)
+	if fetcher.messageSigner.Clock().Now().Sub(entry.failTime) >= fetcher.retryDelay {
+		fetcher.removeMissing(identityAddress)
+		return false
+	}
+	fetcher.missingOrder.MoveToFront(element)
+	return true
+}
+
+// removeMissing forgets a missing identity
+// Must be called with the update mutex locked
+func (fetcher *IdentityFetcher) removeMissing(identityAddress string) {
+	if element := fetcher.missing[identityAddress]; element != nil {
+		fetcher.missingOrder.Remove(element)
+		delete(fetcher.missing, identityAddress)
+	}
+}
+
+// removeOldest removes the oldest key from the cache
+// Must be called with the update mutex locked
+func (fetcher *IdentityFetcher) removeOldest() {
+	if len(fetcher.cacheOrder) == 0 {
+		return
+	}
+	delete(fetcher.publicKeys, fetcher.cacheOrder[0])
+	fetcher.cacheOrder = fetcher.cacheOrder[1:]
+}
+
+// NewIdentityFetcher creates a fetcher of publisher identities
+//  domainIdentities with the identities that are already known
+//  messageSigner for subscribing to identities
+func NewIdentityFetcher(domainIdentities *DomainPublisherIdentities, messageSigner *messaging.MessageSigner) *IdentityFetcher {
+	fetcher := &IdentityFetcher{
+		domainIdentities: domainIdentities,
+		messageSigner:    messageSigner,
+		cacheSize:        DefaultFetchCacheSize,
+		fetchTimeout:     DefaultFetchTimeout,
+		retryDelay:       DefaultFetchRetryDelay,
+		publicKeys:       make(map[string]*ecdsa.PublicKey),
+		cacheOrder:       make([]string, 0),
+		fetching:         make(map[string]uint64),
+		maxFetching:      DefaultMaxFetching,
+		maxMissing:       DefaultMissingCacheSize,
+		missing:          make(map[string]*list.Element),
+		missingOrder:     list.New(),
+		updateMutex:      &sync.Mutex{},
+	}
+	return fetcher
+}
@@ -0,0 +1,115 @@
+package identities_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/identities"
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentityFetcher(t *testing.T) {
+	const domain = "test"
+	const publisher1ID = "publisher1"
+	const publisher2ID = "publisher2"
+	const publisher3ID = "publisher3"
+	messenger := messaging.NewInMemoryMessenger(dummyConfig)
+	collection := identities.NewDomainPublisherIdentities()
+	signer := messaging.NewMessageSigner(messenger, nil, nil)
+	fetcher := identities.NewIdentityFetcher(collection, signer)
+	fetcher.SetLimits(1, 100*time.Millisecond, time.Hour)
+	signer.GetPublicKey = fetcher.GetPublicKey
+
+	// publisher 1 has a retained identity that isn't known yet
+	pub1Ident, pub1Keys := identities.CreateIdentity(domain, publisher1ID)
+	pub1Signer := messaging.NewMessageSigner(messenger, pub1Keys, nil)
+	err := pub1Signer.PublishObject(pub1Ident.Address, true, &pub1Ident.PublisherIdentityMessage, nil)
+	require.NoError(t, err)
+	assert.Nil(t, collection.GetPublisherKey(pub1Ident.Address))
+
+	// a message from publisher 1 is verified after fetching its identity
+	msg, _ := pub1Signer.SignObject(&types.OutputLatestMessage{Address: domain + "/" + publisher1ID + "/node1/temperature/0/$latest"})
+	var latest types.OutputLatestMessage
+	isSigned, err := signer.VerifySignedMessage(msg, &latest)
+	assert.NoError(t, err)
+	assert.True(t, isSigned)
+	pubKey := fetcher.GetPublicKey(pub1Ident.Address)
+	require.NotNil(t, pubKey)
+	assert.Equal(t, pub1Keys.PublicKey, *pubKey)
+
+	// publisher 2 never publishes an identity. The fetch doesn't block and isn't repeated
+	start := time.Now()
+	assert.Nil(t, fetcher.GetPublicKey(domain+"/"+publisher2ID+"/node1"))
+	assert.True(t, time.Since(start) < 100*time.Millisecond, "Fetching should not block")
+	assert.Nil(t, fetcher.GetPublicKey(domain+"/"+publisher2ID+"/node1"))
+	time.Sleep(150 * time.Millisecond)
+	assert.Nil(t, fetcher.GetPublicKey(domain+"/"+publisher2ID+"/node1"))
+	// an identity published after the fetch timed out isn't fetched until the retry delay passed
+	pub2Ident, pub2Keys := identities.CreateIdentity(domain, publisher2ID)
+	pub2Signer := messaging.NewMessageSigner(messenger, pub2Keys, nil)
+	pub2Signer.PublishObject(pub2Ident.Address, true, &pub2Ident.PublisherIdentityMessage, nil)
+	assert.Nil(t, fetcher.GetPublicKey(pub2Ident.Address), "Missing identity should not be fetched again")
+
+	// the cache holds one key so fetching publisher 3 removes publisher 1
+	pub3Ident, pub3Keys := identities.CreateIdentity(domain, publisher3ID)
+	pub3Signer := messaging.NewMessageSigner(messenger, pub3Keys, nil)
+	pub3Signer.PublishObject(pub3Ident.Address, true, &pub3Ident.PublisherIdentityMessage, nil)
+	pubKey = fetcher.GetPublicKey(pub3Ident.Address)
+	require.NotNil(t, pubKey)
+	assert.Equal(t, pub3Keys.PublicKey, *pubKey)
+	messenger.Publish(pub1Ident.Address, true, "")
+	assert.Nil(t, fetcher.GetPublicKey(pub1Ident.Address), "Expected publisher 1 to be removed from the cache")
+
+	// an identity that fails verification isn't accepted
+	fetcher.SetLimits(10, 0, 0)
+	pub4Ident, pub4Keys := identities.CreateIdentity(domain, "publisher4")
+	pub4Ident.IssuerID = "someoneelse"
+	pub4Signer := messaging.NewMessageSigner(messenger, pub4Keys, nil)
+	pub4Signer.PublishObject(pub4Ident.Address, true, &pub4Ident.PublisherIdentityMessage, nil)
+	assert.Nil(t, fetcher.GetPublicKey(pub4Ident.Address))
+
+	// invalid address
+	assert.Nil(t, fetcher.GetPublicKey(domain))
+}
+
+func TestIdentityFetcherLimits(t *testing.T) {
+	const domain = "test"
+	messenger := messaging.NewInMemoryMessenger(dummyConfig)
+	collection := identities.NewDomainPublisherIdentities()
+	clock := messaging.NewManualClock(time.Now())
+	signer := messaging.NewMessageSigner(messenger, nil, nil)
+	signer.SetClock(clock)
+	fetcher := identities.NewIdentityFetcher(collection, signer)
+	fetcher.SetLimits(0, 20*time.Millisecond, time.Hour)
+	fetcher.SetFetchLimits(2, 2)
+
+	// senders with random names don't start more than the max nr of concurrent fetches
+	assert.Nil(t, fetcher.GetPublicKey(domain+"/random1"))
+	assert.Nil(t, fetcher.GetPublicKey(domain+"/random2"))
+	pub3Ident, pub3Keys := identities.CreateIdentity(domain, "publisher3")
+	pub3Signer := messaging.NewMessageSigner(messenger, pub3Keys, nil)
+	pub3Signer.PublishObject(pub3Ident.Address, true, &pub3Ident.PublisherIdentityMessage, nil)
+	assert.Nil(t, fetcher.GetPublicKey(pub3Ident.Address), "Expected max nr of fetches to be reached")
+
+	// missing identities are remembered up to the limit, the least recently used is forgotten
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(t, fetcher.GetPublicKey(domain+"/random1"))
+	assert.Nil(t, fetcher.GetPublicKey(domain+"/random3"))
+	time.Sleep(50 * time.Millisecond)
+	pub2Ident, pub2Keys := identities.CreateIdentity(domain, "random2")
+	pub2Signer := messaging.NewMessageSigner(messenger, pub2Keys, nil)
+	pub2Signer.PublishObject(pub2Ident.Address, true, &pub2Ident.PublisherIdentityMessage, nil)
+	assert.NotNil(t, fetcher.GetPublicKey(pub2Ident.Address), "Expected random2 to be forgotten")
+	assert.NotNil(t, fetcher.GetPublicKey(pub3Ident.Address))
+
+	// missing identities are fetched again after the retry delay
+	pub1Ident, pub1Keys := identities.CreateIdentity(domain, "random1")
+	pub1Signer := messaging.NewMessageSigner(messenger, pub1Keys, nil)
+	pub1Signer.PublishObject(pub1Ident.Address, true, &pub1Ident.PublisherIdentityMessage, nil)
+	assert.Nil(t, fetcher.GetPublicKey(pub1Ident.Address))
+	clock.Advance(time.Hour)
+	assert.NotNil(t, fetcher.GetPublicKey(pub1Ident.Address))
+}
@@ -11,5 +11,5 @@ import (
 func PublishIdentity(publicIdentity *types.PublisherIdentityMessage, signer *messaging.MessageSigner) {
 	logrus.Infof("PublishIdentity: publish identity: %s", publicIdentity.Address)
 
-	signer.PublishObject(publicIdentity.Address, true, publicIdentity, nil)
+	signer.PublishObjectWithPolicy(publicIdentity.Address, publicIdentity, nil)
 }
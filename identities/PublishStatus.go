@@ -1,8 +1,6 @@
 package identities
 
 import (
-	"fmt"
-
 	"github.com/iotdomain/iotdomain-go/messaging"
 	"github.com/iotdomain/iotdomain-go/types"
 	"github.com/sirupsen/logrus"
@@ -10,14 +8,25 @@ import (
 
 // MakePublisherStatusAddress returns the publisher status message address
 func MakePublisherStatusAddress(domain string, publisherID string) string {
-	address := fmt.Sprintf("%s/%s/%s", domain, publisherID, types.MessageTypeStatus)
+	address := types.MakeAddress(&types.AddressSegments{
+		Domain: domain, PublisherID: publisherID, MessageType: types.MessageTypeStatus})
 	return address
 }
 
+// MakeLastWillMessage returns the signed status message to use as the publisher's last will and testament.
+// The message broker publishes this message when the publisher connection is unexpectedly lost.
+func MakeLastWillMessage(domain string, publisherID string, signer *messaging.MessageSigner) (string, error) {
+	statusMsg := types.PublisherStatusMessage{
+		Address: MakePublisherStatusAddress(domain, publisherID),
+		Status:  types.PublisherRunStateLost,
+	}
+	return signer.SignObject(&statusMsg)
+}
+
 // PublishStatus publishes the publisher status value message
 func PublishStatus(statusMsg *types.PublisherStatusMessage, signer *messaging.MessageSigner) {
 
 	logrus.Infof("PublishIdentity: publish identity: %s", statusMsg.Address)
 
-	signer.PublishObject(statusMsg.Address, true, statusMsg, nil)
+	signer.PublishObjectWithPolicy(statusMsg.Address, statusMsg, nil)
 }
@@ -0,0 +1,103 @@
+// Package identities with trust information of discovered publisher keys
+package identities
+
+import (
+	"crypto/ecdsa"
+	"sort"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/types"
+)
+
+// PublisherKeyInfo with trust information of the identity behind a publisher's public key
+type PublisherKeyInfo struct {
+	Address       string // address of the publisher identity
+	IssuerID      string // issuer of the identity, the DSS or the publisher itself
+	Timestamp     string // time the identity was created
+	ValidUntil    string // time the identity expires
+	IsExpired     bool   // the identity has expired
+	IsVerified    bool   // the identity passes VerifyPublisherIdentity at the time of the request
+	IsDSSVerified bool   // the identity is issued by the DSS of its domain and verified with its configured key, see SetDSSKey
+	VerifyError   string // reason the identity isn't verified, or empty if verified
+}
+
+// PublisherInfo describes a publisher that is known in the domain
+type PublisherInfo struct {
+	PublisherKeyInfo
+	Domain      string // domain of the publisher
+	Fingerprint string // hex encoded SHA-256 of the publisher's public key, see messaging.PublicKeyFingerprint
+	PublisherID string // ID of the publisher
+}
+
+// GetPublisherKeyInfo returns the public key of a publisher, like GetPublisherKey, together with
+// information on the identity behind it. The identity is verified at the time of the request so
+// an identity that has expired or was loaded from an outdated cache is reported as unverified.
+// Intended for callers that make trust decisions.
+//  publisherAddress must start with domain/publisherId
+// Returns nil, nil if the publisher is not known
+func (pubIdentities *DomainPublisherIdentities) GetPublisherKeyInfo(publisherAddress string) (
+	*ecdsa.PublicKey, *PublisherKeyInfo) {
+
+	pubKey := pubIdentities.GetPublisherKey(publisherAddress)
+	if pubKey == nil {
+		return nil, nil
+	}
+	identityAddress, err := makeIdentityAddressOf(publisherAddress)
+	if err != nil {
+		return nil, nil
+	}
+	ident := pubIdentities.GetPublisherByAddress(identityAddress)
+	if ident == nil {
+		return nil, nil
+	}
+	return pubKey, pubIdentities.getKeyInfo(ident)
+}
+
+// GetKnownPublishers returns a snapshot of the publishers known in the domain with their key
+// fingerprint and verification status, sorted by address. Intended for management tools that
+// show who is on the domain.
+func (pubIdentities *DomainPublisherIdentities) GetKnownPublishers() []PublisherInfo {
+	identList := pubIdentities.GetAllPublishers()
+	sort.Slice(identList, func(i, j int) bool {
+		return identList[i].Address < identList[j].Address
+	})
+	publishers := make([]PublisherInfo, 0, len(identList))
+	for _, ident := range identList {
+		publicKey := messaging.PublicKeyFromPem(ident.PublicKey)
+		publishers = append(publishers, PublisherInfo{
+			PublisherKeyInfo: *pubIdentities.getKeyInfo(ident),
+			Domain:           ident.Domain,
+			Fingerprint:      messaging.PublicKeyFingerprint(publicKey),
+			PublisherID:      ident.PublisherID,
+		})
+	}
+	return publishers
+}
+
+// getKeyInfo returns the trust information of a publisher identity, verified at the time of the request
+func (pubIdentities *DomainPublisherIdentities) getKeyInfo(ident *types.PublisherIdentityMessage) *PublisherKeyInfo {
+	pubIdentities.dssMutex.RLock()
+	now := pubIdentities.clock.Now()
+	pubIdentities.dssMutex.RUnlock()
+	info := &PublisherKeyInfo{
+		Address:    ident.Address,
+		IssuerID:   ident.IssuerID,
+		Timestamp:  ident.Timestamp,
+		ValidUntil: ident.ValidUntil,
+		IsExpired:  IsIdentityExpiredAt(ident, now),
+	}
+	// DSS issued identities are only verified with the configured DSS key
+	dssKey := pubIdentities.GetDSSKey(ident.Domain)
+	if ident.IssuerID == types.DSSPublisherID && dssKey == nil {
+		info.VerifyError = "The DSS key of domain '" + ident.Domain + "' is not configured"
+		return info
+	}
+	err := verifyPublisherIdentityAt(ident.Address, ident, dssKey, now)
+	if err != nil {
+		info.VerifyError = err.Error()
+	} else {
+		info.IsVerified = true
+		info.IsDSSVerified = ident.IssuerID == types.DSSPublisherID
+	}
+	return info
+}
@@ -0,0 +1,109 @@
+package identities_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/identities"
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetPublisherKeyInfo(t *testing.T) {
+	const domain = "test"
+	collection := identities.NewDomainPublisherIdentities()
+
+	// self-signed identity
+	pub1Ident, pub1Keys := identities.CreateIdentity(domain, "publisher1")
+	collection.AddIdentity(&pub1Ident.PublisherIdentityMessage)
+	pubKey, info := collection.GetPublisherKeyInfo(domain + "/publisher1/node1/$node")
+	require.NotNil(t, info)
+	assert.Equal(t, pub1Keys.PublicKey, *pubKey)
+	assert.Equal(t, pub1Ident.Address, info.Address)
+	assert.Equal(t, pub1Ident.Timestamp, info.Timestamp)
+	assert.True(t, info.IsVerified)
+	assert.False(t, info.IsDSSVerified)
+	assert.False(t, info.IsExpired)
+	assert.Empty(t, info.VerifyError)
+
+	// DSS issued identity
+	dssIdent, dssKeys := identities.CreateIdentity(domain, types.DSSPublisherID)
+	dssIdent.IssuerID = types.DSSPublisherID
+	messaging.SignIdentity(&dssIdent.PublisherIdentityMessage, dssKeys)
+	collection.AddIdentity(&dssIdent.PublisherIdentityMessage)
+	pub2Ident, _ := identities.CreateIdentity(domain, "publisher2")
+	pub2Ident.IssuerID = types.DSSPublisherID
+	messaging.SignIdentity(&pub2Ident.PublisherIdentityMessage, dssKeys)
+	collection.AddIdentity(&pub2Ident.PublisherIdentityMessage)
+	// the discovered DSS key isn't a trust anchor
+	_, info = collection.GetPublisherKeyInfo(pub2Ident.Address)
+	require.NotNil(t, info)
+	assert.False(t, info.IsVerified)
+	assert.False(t, info.IsDSSVerified)
+	assert.NotEmpty(t, info.VerifyError)
+	// the configured DSS key is
+	collection.SetDSSKey(domain, &dssKeys.PublicKey)
+	assert.Equal(t, &dssKeys.PublicKey, collection.GetDSSKey(domain))
+	_, info = collection.GetPublisherKeyInfo(pub2Ident.Address)
+	require.NotNil(t, info)
+	assert.True(t, info.IsVerified)
+	assert.True(t, info.IsDSSVerified)
+	// an identity issued by a fake DSS isn't verified
+	fakeDSSKeys := messaging.CreateAsymKeys()
+	fakeIdent, _ := identities.CreateIdentity(domain, "publisher4")
+	fakeIdent.IssuerID = types.DSSPublisherID
+	messaging.SignIdentity(&fakeIdent.PublisherIdentityMessage, fakeDSSKeys)
+	collection.AddIdentity(&fakeIdent.PublisherIdentityMessage)
+	_, info = collection.GetPublisherKeyInfo(fakeIdent.Address)
+	require.NotNil(t, info)
+	assert.False(t, info.IsVerified)
+	assert.False(t, info.IsDSSVerified)
+	collection.SetDSSKey(domain, nil)
+	assert.Nil(t, collection.GetDSSKey(domain))
+
+	// an expired identity, eg loaded from cache, is not verified
+	pub3Ident, pub3Keys := identities.CreateIdentity(domain, "publisher3")
+	pub3Ident.ValidUntil = time.Now().Add(-time.Hour).Format(types.TimeFormat)
+	messaging.SignIdentity(&pub3Ident.PublisherIdentityMessage, pub3Keys)
+	collection.AddIdentity(&pub3Ident.PublisherIdentityMessage)
+	pubKey, info = collection.GetPublisherKeyInfo(pub3Ident.Address)
+	require.NotNil(t, info)
+	assert.NotNil(t, pubKey)
+	assert.True(t, info.IsExpired)
+	assert.False(t, info.IsVerified)
+	assert.NotEmpty(t, info.VerifyError)
+
+	// unknown publisher
+	pubKey, info = collection.GetPublisherKeyInfo(domain + "/unknown/$identity")
+	assert.Nil(t, pubKey)
+	assert.Nil(t, info)
+	pubKey, info = collection.GetPublisherKeyInfo(domain)
+	assert.Nil(t, pubKey)
+	assert.Nil(t, info)
+}
+
+func TestGetKnownPublishers(t *testing.T) {
+	const domain = "test"
+	collection := identities.NewDomainPublisherIdentities()
+	assert.Empty(t, collection.GetKnownPublishers())
+
+	pub2Ident, pub2Keys := identities.CreateIdentity(domain, "publisher2")
+	collection.AddIdentity(&pub2Ident.PublisherIdentityMessage)
+	pub1Ident, _ := identities.CreateIdentity(domain, "publisher1")
+	pub1Ident.ValidUntil = time.Now().Add(-time.Hour).Format(types.TimeFormat)
+	collection.AddIdentity(&pub1Ident.PublisherIdentityMessage)
+
+	publishers := collection.GetKnownPublishers()
+	require.Equal(t, 2, len(publishers))
+	assert.Equal(t, "publisher1", publishers[0].PublisherID)
+	assert.False(t, publishers[0].IsVerified)
+	assert.Equal(t, "publisher2", publishers[1].PublisherID)
+	assert.Equal(t, domain, publishers[1].Domain)
+	assert.Equal(t, pub2Ident.Address, publishers[1].Address)
+	assert.Equal(t, pub2Ident.Timestamp, publishers[1].Timestamp)
+	assert.True(t, publishers[1].IsVerified)
+	assert.Equal(t, messaging.PublicKeyFingerprint(&pub2Keys.PublicKey), publishers[1].Fingerprint)
+	assert.Equal(t, 64, len(publishers[1].Fingerprint))
+}
@@ -38,20 +38,35 @@ func (rxIdentity *ReceiveDomainPublisherIdentities) Stop() {
 // - verifies that the identity is signed by the DSS when in a secure domain
 // - passes the update to the domain identity collection
 func (rxIdentity *ReceiveDomainPublisherIdentities) ReceiveDomainIdentity(address string, rawMessage string) error {
-	var newIdentity types.PublisherIdentityMessage
-
 	// Handle the DSS publisher separately
 	// anyDssIdentitySuffix := types.DSSPublisherID + "/" + types.MessageTypeIdentity
 	// isDSS := (address == rxIdentity.dssAddress || strings.HasSuffix(address, anyDssIdentitySuffix))
 
 	logrus.Infof("ReceiveDomainIdentity: %s", address)
 
+	newIdentity, err := decodeDomainIdentity(address, rawMessage,
+		rxIdentity.domainIdentities, rxIdentity.messageSigner.SignMessages())
+	if err != nil {
+		return err
+	}
+	rxIdentity.domainIdentities.AddIdentity(newIdentity)
+	return nil
+}
+
+// decodeDomainIdentity decodes and verifies a published identity of a domain publisher
+// DSS issued identities are verified with the configured DSS key or, if not configured, with the
+// discovered DSS key from the domain identities.
+//  requireSigned rejects identity messages that are not JWS signed
+func decodeDomainIdentity(address string, rawMessage string,
+	domainIdentities *DomainPublisherIdentities, requireSigned bool) (*types.PublisherIdentityMessage, error) {
+	var newIdentity types.PublisherIdentityMessage
+
 	// decode the message and determine the sender.
 	isSigned, err := messaging.VerifySenderJWSSignature(rawMessage, &newIdentity, nil)
 	if err != nil {
-		return lib.MakeErrorf("ReceiveDomainIdentity: Invalid identity message on '%s': %s", address, err)
-	} else if !isSigned && rxIdentity.messageSigner.SignMessages() {
-		return lib.MakeErrorf("ReceiveDomainIdentity: Identity message on '%s' isn't signed but must be. Message discarded.", address)
+		return nil, lib.MakeErrorf("ReceiveDomainIdentity: Invalid identity message on '%s': %s", address, err)
+	} else if !isSigned && requireSigned {
+		return nil, lib.MakeErrorf("ReceiveDomainIdentity: Identity message on '%s' isn't signed but must be. Message discarded.", address)
 	}
 
 	// Determine the key to verify the identity with
@@ -61,19 +76,20 @@ func (rxIdentity *ReceiveDomainPublisherIdentities) ReceiveDomainIdentity(addres
 		err = VerifyPublisherIdentity(address, &newIdentity, issuerKey)
 	} else if newIdentity.IssuerID == types.DSSPublisherID {
 		// DSS signed identity. DSS Must be known.
-		issuerAddress := newIdentity.Domain + "/" + newIdentity.IssuerID
-		issuerKey := rxIdentity.domainIdentities.GetPublisherKey(issuerAddress)
+		issuerKey := domainIdentities.GetDSSKey(newIdentity.Domain)
+		if issuerKey == nil {
+			issuerAddress := MakePublisherIdentityAddress(newIdentity.Domain, newIdentity.IssuerID)
+			issuerKey = domainIdentities.GetPublisherKey(issuerAddress)
+		}
 		err = VerifyPublisherIdentity(address, &newIdentity, issuerKey)
 	} else {
 		// TODO: assume a CA signed identity. Not yet supported
 		err = lib.MakeErrorf("Unknown Issuer %s for domain %s", newIdentity.IssuerID, newIdentity.Domain)
 	}
 	if err != nil {
-		return lib.MakeErrorf("ReceiveDomainIdentity: Publisher identity signature verification failed for %s", address)
+		return nil, lib.MakeErrorf("ReceiveDomainIdentity: Publisher identity signature verification failed for %s", address)
 	}
-
-	rxIdentity.domainIdentities.AddIdentity(&newIdentity)
-	return nil
+	return &newIdentity, nil
 }
 
 // NewReceivePublisherIdentities listens for publisher identity updates of the domain
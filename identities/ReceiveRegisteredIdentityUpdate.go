@@ -2,8 +2,6 @@
 package identities
 
 import (
-	"fmt"
-
 	"github.com/iotdomain/iotdomain-go/lib"
 	"github.com/iotdomain/iotdomain-go/messaging"
 	"github.com/iotdomain/iotdomain-go/types"
@@ -21,13 +19,15 @@ type ReceiveRegisteredIdentityUpdate struct {
 // Start listening for updates to the registered identity
 // Intended to receive new keys from the DSS
 func (rxIdentity *ReceiveRegisteredIdentityUpdate) Start() {
-	addr := fmt.Sprintf("%s/%s/%s", rxIdentity.domain, "+", types.MessageTypeSetInput)
+	addr := types.MakeAddress(&types.AddressSegments{
+		Domain: rxIdentity.domain, PublisherID: "+", MessageType: types.MessageTypeSetInput})
 	rxIdentity.messageSigner.Subscribe(addr, rxIdentity.ReceiveIdentityUpdate)
 }
 
 // Stop listening
 func (rxIdentity *ReceiveRegisteredIdentityUpdate) Stop() {
-	addr := fmt.Sprintf("%s/%s/%s", rxIdentity.domain, rxIdentity.publisherID, types.MessageTypeSetInput)
+	addr := types.MakeAddress(&types.AddressSegments{
+		Domain: rxIdentity.domain, PublisherID: rxIdentity.publisherID, MessageType: types.MessageTypeSetInput})
 	rxIdentity.messageSigner.Unsubscribe(addr, rxIdentity.ReceiveIdentityUpdate)
 }
 
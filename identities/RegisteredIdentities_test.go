@@ -214,3 +214,108 @@ func TestVerifyIdentity(t *testing.T) {
 	assert.Error(t, err, "Signature should fail against a mismatched public/private key pem in the identity ")
 
 }
+
+func TestCreateIdentityWithClock(t *testing.T) {
+	const domain = "test"
+	const publisherID = "publisher1"
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	ident, _ := identities.CreateIdentityWithClock(domain, publisherID, messaging.NewManualClock(now))
+	assert.Equal(t, now.Format(types.TimeFormat), ident.Timestamp)
+	assert.False(t, identities.IsIdentityExpiredAt(&ident.PublisherIdentityMessage, now))
+	assert.True(t, identities.IsIdentityExpiredAt(&ident.PublisherIdentityMessage, now.Add(time.Hour*24*366)))
+	// created in the past so it has expired by now
+	assert.True(t, identities.IsIdentityExpired(&ident.PublisherIdentityMessage))
+
+	// the collection reports expiry by its clock
+	collection := identities.NewDomainPublisherIdentities()
+	collection.AddIdentity(&ident.PublisherIdentityMessage)
+	_, info := collection.GetPublisherKeyInfo(ident.Address)
+	require.NotNil(t, info)
+	assert.True(t, info.IsExpired)
+	collection.SetClock(messaging.NewManualClock(now))
+	_, info = collection.GetPublisherKeyInfo(ident.Address)
+	require.NotNil(t, info)
+	assert.False(t, info.IsExpired)
+	assert.True(t, info.IsVerified)
+}
+
+func TestRenewIdentity(t *testing.T) {
+	const domain = "test"
+	const publisherID = "publisher1"
+	regIdent := identities.NewRegisteredIdentity(domain, publisherID, "")
+	assert.False(t, regIdent.IsRenewalDue())
+	ident, _ := regIdent.GetFullIdentity()
+	oldValidUntil := ident.ValidUntil
+
+	// the renewal is due when the identity expires within the lead time
+	regIdent.SetRenewLeadTime(time.Hour * 24 * 366)
+	assert.True(t, regIdent.IsRenewalDue())
+	time.Sleep(time.Millisecond * 10)
+	err := regIdent.RenewIdentity()
+	require.NoError(t, err)
+	renewed, _ := regIdent.GetFullIdentity()
+	assert.Greater(t, renewed.ValidUntil, oldValidUntil)
+	assert.Equal(t, oldValidUntil, ident.ValidUntil, "Renewal must not modify the old identity")
+	err = identities.VerifyFullIdentity(renewed, domain, publisherID, nil)
+	assert.NoError(t, err, "Renewed identity should verify")
+
+	// the expiry time is compared as time instead of text
+	regIdent.SetRenewLeadTime(time.Hour)
+	regIdent.SetClock(messaging.NewManualClock(time.Now().UTC()))
+	zoned := *renewed
+	zoned.ValidUntil = time.Now().Add(time.Minute).In(time.FixedZone("east", 12*3600)).Format(types.TimeFormat)
+	messaging.SignIdentity(&zoned.PublisherIdentityMessage, messaging.PrivateKeyFromPem(zoned.PrivateKey))
+	regIdent.UpdateIdentity(&zoned)
+	current, _ := regIdent.GetFullIdentity()
+	require.Equal(t, zoned.ValidUntil, current.ValidUntil)
+	assert.True(t, regIdent.IsRenewalDue())
+	// an invalid expiry time is due for renewal
+	invalid := zoned
+	invalid.ValidUntil = "never"
+	messaging.SignIdentity(&invalid.PublisherIdentityMessage, messaging.PrivateKeyFromPem(invalid.PrivateKey))
+	regIdent.UpdateIdentity(&invalid)
+	current, _ = regIdent.GetFullIdentity()
+	require.Equal(t, "never", current.ValidUntil)
+	assert.True(t, regIdent.IsRenewalDue())
+	assert.True(t, regIdent.IsRenewalDue())
+	err = regIdent.RenewIdentity()
+	require.NoError(t, err)
+	assert.False(t, regIdent.IsRenewalDue())
+	renewed, _ = regIdent.GetFullIdentity()
+
+	// an identity issued by the DSS can't be renewed by the publisher
+	dssKeys := messaging.CreateAsymKeys()
+	dssIdent := *renewed
+	dssIdent.IssuerID = types.DSSPublisherID
+	messaging.SignIdentity(&dssIdent.PublisherIdentityMessage, dssKeys)
+	regIdent.SetDssKey(&dssKeys.PublicKey)
+	regIdent.UpdateIdentity(&dssIdent)
+	err = regIdent.RenewIdentity()
+	assert.Error(t, err)
+}
+
+func TestSetCapabilities(t *testing.T) {
+	const domain = "test"
+	const publisherID = "publisher1"
+	regIdent := identities.NewRegisteredIdentity(domain, publisherID, "")
+	ident, _ := regIdent.GetFullIdentity()
+	clock := messaging.NewManualClock(time.Now().UTC().Add(time.Minute))
+	regIdent.SetClock(clock)
+
+	capabilities := types.PublisherCapabilityMap{types.CapabilityAlgorithms: "ES256"}
+	err := regIdent.SetCapabilities(capabilities)
+	require.NoError(t, err)
+	updated, _ := regIdent.GetFullIdentity()
+	assert.Equal(t, capabilities, updated.Capabilities)
+	assert.Equal(t, clock.Now().Format(types.TimeFormat), updated.Timestamp)
+	assert.NotEqual(t, ident.Timestamp, updated.Timestamp)
+	assert.Nil(t, ident.Capabilities, "SetCapabilities must not modify the old identity")
+	err = identities.VerifyFullIdentity(updated, domain, publisherID, nil)
+	assert.NoError(t, err)
+
+	// capabilities are not signed so clients that don't know them can verify the identity
+	withoutCapabilities := *updated
+	withoutCapabilities.Capabilities = nil
+	err = identities.VerifyFullIdentity(&withoutCapabilities, domain, publisherID, nil)
+	assert.NoError(t, err)
+}
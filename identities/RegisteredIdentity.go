@@ -3,7 +3,6 @@ package identities
 import (
 	"crypto/ecdsa"
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
 	"os"
 	"strings"
@@ -18,18 +17,24 @@ import (
 // valid for 1 year
 const validDuration = time.Hour * 24 * 365
 
+// DefaultRenewLeadTime is the time before expiry that a self-signed identity is renewed
+const DefaultRenewLeadTime = time.Hour * 24 * 30
+
 // IdentityFileSuffix to append to name of the file containing saved identity
 const IdentityFileSuffix = "-identity.json"
 
 // RegisteredIdentity for managing the publisher's full identity
 type RegisteredIdentity struct {
-	filename     string // identity filename under which it is saved. Set in LoadIdentity
-	domain       string // domain of the publisher creating this identity
-	publisherID  string
-	fullIdentity *types.PublisherFullIdentity
-	dssPubKey    *ecdsa.PublicKey  // DSS pub key for verification (secure zones only)
-	privateKey   *ecdsa.PrivateKey // private key from the new identity
-	updated      bool              // flag, this identity has been updated and needs to be published/saved
+	clock         messaging.Clock // clock for renewal of the identity
+	filename      string          // identity filename under which it is saved. Set in LoadIdentity
+	domain        string          // domain of the publisher creating this identity
+	publisherID   string
+	fullIdentity  *types.PublisherFullIdentity
+	dssPubKey     *ecdsa.PublicKey  // DSS pub key for verification (secure zones only)
+	privateKey    *ecdsa.PrivateKey // private key from the new identity
+	renewLeadTime time.Duration     // renew the identity this long before it expires
+	warnedExpiry  string            // invalid expiry time that a warning was logged for
+	updated       bool              // flag, this identity has been updated and needs to be published/saved
 }
 
 // GetAddress returns the identity's publication address
@@ -52,6 +57,23 @@ func (regIdentity *RegisteredIdentity) GetFullIdentity() (fullIdentity *types.Pu
 	return regIdentity.fullIdentity, regIdentity.privateKey
 }
 
+// IsRenewalDue returns true if the identity expires within the renewal lead time
+// An identity with an invalid expiry time is due for renewal. A warning is logged once.
+func (regIdentity *RegisteredIdentity) IsRenewalDue() bool {
+	validUntilStr := regIdentity.fullIdentity.ValidUntil
+	validUntil, err := time.Parse(types.TimeFormat, validUntilStr)
+	if err != nil {
+		if regIdentity.warnedExpiry != validUntilStr {
+			logrus.Warningf("IsRenewalDue: Identity '%s' has an invalid expiry time '%s': %s",
+				regIdentity.fullIdentity.Address, validUntilStr, err)
+			regIdentity.warnedExpiry = validUntilStr
+		}
+		return true
+	}
+	renewTime := regIdentity.clock.Now().Add(regIdentity.renewLeadTime)
+	return renewTime.After(validUntil)
+}
+
 // LoadIdentity loads the publisher identity and private key from json file and
 // verifies its content. See also VerifyIdentity for the criteria.
 //  Returns the identity with corresponding ECDSA private key.
@@ -87,6 +109,30 @@ func (regIdentity *RegisteredIdentity) LoadIdentity() (
 	return regIdentity.fullIdentity, regIdentity.privateKey, err
 }
 
+// RenewIdentity extends the validity of a self-signed identity and re-signs it.
+// An identity issued by the DSS can only be renewed by the DSS, in which case an error is returned.
+// The renewed identity must be saved and published.
+func (regIdentity *RegisteredIdentity) RenewIdentity() error {
+	if regIdentity.fullIdentity.IssuerID != regIdentity.publisherID {
+		return lib.MakeErrorf("RenewIdentity: Identity '%s' is issued by '%s' and can't be renewed by the publisher",
+			regIdentity.fullIdentity.Address, regIdentity.fullIdentity.IssuerID)
+	}
+	// identities are shared so renew a copy
+	renewedIdentity := *regIdentity.fullIdentity
+	now := regIdentity.clock.Now()
+	renewedIdentity.Timestamp = now.Format(types.TimeFormat)
+	renewedIdentity.ValidUntil = now.Add(validDuration).Format(types.TimeFormat)
+	err := messaging.SignIdentity(&renewedIdentity.PublisherIdentityMessage, regIdentity.privateKey)
+	if err != nil {
+		return lib.MakeErrorf("RenewIdentity: Unable to sign identity '%s': %s", renewedIdentity.Address, err)
+	}
+
+	logrus.Infof("RenewIdentity: Identity '%s' renewed until %s", renewedIdentity.Address, renewedIdentity.ValidUntil)
+	regIdentity.fullIdentity = &renewedIdentity
+	regIdentity.updated = true
+	return nil
+}
+
 // SaveIdentity saves the full identity of the publisher
 // see also https://stackoverflow.com/questions/21322182/how-to-store-ecdsa-private-key-in-go
 func (regIdentity *RegisteredIdentity) SaveIdentity() error {
@@ -107,6 +153,38 @@ func (regIdentity *RegisteredIdentity) SaveIdentity() error {
 	return err
 }
 
+// SetCapabilities sets the capabilities in the identity and updates its timestamp. The capabilities
+// are not part of the identity signature. The capabilities of an identity issued by the DSS can only
+// be set by the DSS, in which case an error is returned.
+// The updated identity must be saved and published.
+func (regIdentity *RegisteredIdentity) SetCapabilities(capabilities types.PublisherCapabilityMap) error {
+	if regIdentity.fullIdentity.IssuerID != regIdentity.publisherID {
+		return lib.MakeErrorf("SetCapabilities: Identity '%s' is issued by '%s' and can't be changed by the publisher",
+			regIdentity.fullIdentity.Address, regIdentity.fullIdentity.IssuerID)
+	}
+	// identities are shared so update a copy
+	updatedIdentity := *regIdentity.fullIdentity
+	updatedIdentity.Capabilities = make(types.PublisherCapabilityMap, len(capabilities))
+	for capability, value := range capabilities {
+		updatedIdentity.Capabilities[capability] = value
+	}
+	// the timestamp is signed
+	updatedIdentity.Timestamp = regIdentity.clock.Now().Format(types.TimeFormat)
+	err := messaging.SignIdentity(&updatedIdentity.PublisherIdentityMessage, regIdentity.privateKey)
+	if err != nil {
+		return lib.MakeErrorf("SetCapabilities: Unable to sign identity '%s': %s", updatedIdentity.Address, err)
+	}
+	regIdentity.fullIdentity = &updatedIdentity
+	regIdentity.updated = true
+	return nil
+}
+
+// SetClock sets the clock used to determine when the identity is due for renewal. Intended for testing.
+// The identity created by NewRegisteredIdentity uses the system time, see CreateIdentityWithClock.
+func (regIdentity *RegisteredIdentity) SetClock(clock messaging.Clock) {
+	regIdentity.clock = clock
+}
+
 // SetDssKey sets the DSS public key. This is needed to allow the DSS to update the
 // registered identity. Without it, any updates are refused. Intended to be set by
 // the publisher when a verified DSS identity is received.
@@ -114,6 +192,12 @@ func (regIdentity *RegisteredIdentity) SetDssKey(dssSigningKey *ecdsa.PublicKey)
 	regIdentity.dssPubKey = dssSigningKey
 }
 
+// SetRenewLeadTime sets the time before expiry that the identity is due for renewal
+// The default is DefaultRenewLeadTime.
+func (regIdentity *RegisteredIdentity) SetRenewLeadTime(leadTime time.Duration) {
+	regIdentity.renewLeadTime = leadTime
+}
+
 // UpdateIdentity verifies and sets a new registered identity and saves it to the
 // identity file.
 func (regIdentity *RegisteredIdentity) UpdateIdentity(fullIdentity *types.PublisherFullIdentity) {
@@ -134,10 +218,18 @@ func (regIdentity *RegisteredIdentity) UpdateIdentity(fullIdentity *types.Publis
 // private key.
 // The validity is 1 year.
 func CreateIdentity(domain string, publisherID string) (
+	fullIdentity *types.PublisherFullIdentity, signingPrivKey *ecdsa.PrivateKey) {
+	return CreateIdentityWithClock(domain, publisherID, messaging.RealClock)
+}
+
+// CreateIdentityWithClock creates and self-signs a new identity like CreateIdentity, with the
+// timestamp and validity from the given clock. Intended for testing.
+func CreateIdentityWithClock(domain string, publisherID string, clock messaging.Clock) (
 	fullIdentity *types.PublisherFullIdentity, signingPrivKey *ecdsa.PrivateKey) {
 	// Create a new one and sign it.
-	timestampStr := time.Now().Format(types.TimeFormat)
-	validUntil := time.Now().Add(validDuration)
+	now := clock.Now()
+	timestampStr := now.Format(types.TimeFormat)
+	validUntil := now.Add(validDuration)
 	validUntilStr := validUntil.Format(types.TimeFormat)
 
 	// generate private/public key for signing and store the public key in the publisher identity in PEM format
@@ -162,7 +254,9 @@ func CreateIdentity(domain string, publisherID string) (
 		ValidUntil:  validUntilStr,
 	}
 	// self signed identity.
-	messaging.SignIdentity(&publicIdentity, identityPrivKey)
+	if err := messaging.SignIdentity(&publicIdentity, identityPrivKey); err != nil {
+		logrus.Errorf("CreateIdentity: Unable to sign identity '%s': %s", addr, err)
+	}
 
 	fullIdentity = &types.PublisherFullIdentity{
 		PublisherIdentityMessage: publicIdentity,
@@ -173,7 +267,12 @@ func CreateIdentity(domain string, publisherID string) (
 
 // IsIdentityExpired tests if the given identity is expired
 func IsIdentityExpired(identity *types.PublisherIdentityMessage) bool {
-	timestampStr := time.Now().Format(types.TimeFormat)
+	return IsIdentityExpiredAt(identity, messaging.RealClock.Now())
+}
+
+// IsIdentityExpiredAt tests if the given identity is expired at the given time
+func IsIdentityExpiredAt(identity *types.PublisherIdentityMessage, now time.Time) bool {
+	timestampStr := now.Format(types.TimeFormat)
 	nowIsGreater := strings.Compare(timestampStr, identity.ValidUntil)
 	return (nowIsGreater > 0)
 }
@@ -184,10 +283,22 @@ func IsIdentityExpired(identity *types.PublisherIdentityMessage) bool {
 // domain of the domain the node lives in.
 // publisherID of the publisher for this node, unique for the domain
 func MakePublisherIdentityAddress(domain string, publisherID string) string {
-	address := fmt.Sprintf("%s/%s/%s", domain, publisherID, types.MessageTypeIdentity)
+	address := types.MakeAddress(&types.AddressSegments{
+		Domain: domain, PublisherID: publisherID, MessageType: types.MessageTypeIdentity})
 	return address
 }
 
+// makeIdentityAddressOf returns the identity address of the publisher of an address
+//  address is a publisher, node, input or output address with optional message type
+// Returns an error if the address is invalid
+func makeIdentityAddressOf(address string) (string, error) {
+	segments, err := types.ParseBaseAddress(address)
+	if err != nil {
+		return "", err
+	}
+	return MakePublisherIdentityAddress(segments.Domain, segments.PublisherID), nil
+}
+
 // VerifyFullIdentity verifies the given full identity
 // If the publisher joined with the DSS domain then a dssSigningKey is known and
 // the identity MUST be signed by thep rovided DSS.
@@ -232,12 +343,14 @@ func NewRegisteredIdentity(domain string, publisherID string, identityFile strin
 	fullIdentity, privKey := CreateIdentity(domain, publisherID)
 
 	regIdent = &RegisteredIdentity{
-		domain:       domain,
-		filename:     identityFile,
-		fullIdentity: fullIdentity,
-		privateKey:   privKey,
-		publisherID:  publisherID,
-		updated:      true,
+		clock:         messaging.RealClock,
+		domain:        domain,
+		filename:      identityFile,
+		fullIdentity:  fullIdentity,
+		privateKey:    privKey,
+		publisherID:   publisherID,
+		renewLeadTime: DefaultRenewLeadTime,
+		updated:       true,
 	}
 	return regIdent
 }
@@ -2,7 +2,6 @@
 package inputs
 
 import (
-	"fmt"
 	"reflect"
 
 	"github.com/iotdomain/iotdomain-go/lib"
@@ -80,8 +79,8 @@ func (domainInputs *DomainInputs) handleDiscoverInput(address string, message st
 
 // MakeInputDiscoveryAddress creates the address for the input discovery
 func MakeInputDiscoveryAddress(domain string, publisherID string, nodeID string, inputType types.InputType, instance string) string {
-	address := fmt.Sprintf("%s/%s/%s"+"/%s/%s/"+types.MessageTypeInputDiscovery,
-		domain, publisherID, nodeID, inputType, instance)
+	address := types.MakeAddress(&types.AddressSegments{Domain: domain, PublisherID: publisherID, NodeID: nodeID,
+		OutputType: string(inputType), Instance: instance, MessageType: types.MessageTypeInputDiscovery})
 	return address
 }
 
@@ -6,6 +6,15 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// PublishDeletedInputs removes the retained discovery messages of deleted inputs from the message bus
+//  deletedInputs are the addresses of the deleted inputs, see RegisteredInputs.GetDeletedInputs
+func PublishDeletedInputs(deletedInputs []string, messageSigner *messaging.MessageSigner) {
+	for _, address := range deletedInputs {
+		logrus.Infof("PublishDeletedInputs: remove input discovery: %s", address)
+		messageSigner.ClearRetained(address)
+	}
+}
+
 // PublishRegisteredInputs publishes input discovery messages
 // This will clear the updated inputs list
 func PublishRegisteredInputs(
@@ -16,7 +25,7 @@ func PublishRegisteredInputs(
 	for _, input := range inputs {
 		logrus.Infof("PublishRegisteredInputs: publish input discovery: %s", input.Address)
 		// no encryption as this is for everyone to see
-		messageSigner.PublishObject(input.Address, true, input, nil)
+		messageSigner.PublishObjectWithPolicy(input.Address, input, nil)
 	}
 	// todo move save input configuration
 	// if len(updatedInputs) > 0 && publisher.cacheFolder != "" {
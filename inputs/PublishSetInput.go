@@ -4,8 +4,6 @@ import (
 	"crypto/ecdsa"
 	"errors"
 	"fmt"
-	"strings"
-	"time"
 
 	"github.com/iotdomain/iotdomain-go/messaging"
 	"github.com/iotdomain/iotdomain-go/types"
@@ -24,19 +22,19 @@ func PublishSetInput(
 	// logger.Infof("PublishSetInput: publishing encrypted input %s to %s", value, remoteNodeInputAddress)
 	// encryptionKey := setInputs.getPublisherKey(remoteNodeInputAddress)
 	// Check that address is one of our inputs
-	segments := strings.Split(destination, "/")
+	segments, err := types.ParseBaseAddress(destination)
 	// a full address is required
-	if len(segments) < 6 {
+	if err != nil || segments.Instance == "" {
 		errText := fmt.Sprintf("PublishSetInput: Can't publish SetInput message as the destination address '%s' is incomplete", destination)
 		logrus.Error(errText)
 		return errors.New(errText)
 	}
 	// zone/pub/node/inputtype/instance/$set
-	segments[5] = types.MessageTypeSetInput
-	inputAddr := strings.Join(segments, "/")
+	segments.MessageType = types.MessageTypeSetInput
+	inputAddr := types.MakeAddress(segments)
 
 	// Encecode the SetMessage
-	timeStampStr := time.Now().Format("2006-01-02T15:04:05.000-0700")
+	timeStampStr := messageSigner.Clock().Now().Format("2006-01-02T15:04:05.000-0700")
 	var setMessage = types.SetInputMessage{
 		Address:   inputAddr,
 		Sender:    sender,
@@ -44,5 +42,5 @@ func PublishSetInput(
 		Value:     value,
 	}
 	// setInputs.messageSigner.PublishObject(inputAddr, false, &setMessage, encryptionKey)
-	return messageSigner.PublishObject(inputAddr, false, &setMessage, encryptionKey)
+	return messageSigner.PublishObjectWithPolicy(inputAddr, &setMessage, encryptionKey)
 }
@@ -80,7 +80,8 @@ func (rxFromHttp *ReceiveFromHTTP) readInput(input *types.InputDiscoveryMessage)
 	url := input.Source
 
 	logrus.Debugf("InputFromHTTP.readInput: Reading from URL %s", url)
-	startTime := time.Now()
+	clock := rxFromHttp.registeredInputs.getClock()
+	startTime := clock.Now()
 	var req *http.Request
 	var resp *http.Response
 	var loginName = input.Attr[types.NodeAttrLoginName]
@@ -115,7 +116,7 @@ func (rxFromHttp *ReceiveFromHTTP) readInput(input *types.InputDiscoveryMessage)
 		logrus.Errorf("InputFromHTTP.readInput: Error reading from %s: %s", url, err)
 		return "", err
 	}
-	endTime := time.Now()
+	endTime := clock.Now()
 	duration := endTime.Sub(startTime).Round(time.Millisecond)
 	// fixme: update as input status and don't modify input directly
 	input.Attr["latency"] = duration.String()
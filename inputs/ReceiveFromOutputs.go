@@ -53,9 +53,9 @@ func (ifout *ReceiveFromOutputs) DeleteInput(inputID string) {
 // onReceiveOutput verifies the message sender (for 'latest' outputs)
 func (ifout *ReceiveFromOutputs) onReceiveOutput(address string, message string) error {
 	var value string
-	if strings.HasSuffix(address, types.MessageTypeRaw) {
+	if strings.HasSuffix(address, string(types.MessageTypeRaw)) {
 		value = message
-	} else if strings.HasSuffix(address, types.MessageTypeLatest) {
+	} else if strings.HasSuffix(address, string(types.MessageTypeLatest)) {
 		latestMessage := types.OutputLatestMessage{}
 		isSigned, err := ifout.messageSigner.VerifySignedMessage(message, &latestMessage)
 		if err != nil {
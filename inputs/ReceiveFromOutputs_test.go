@@ -18,8 +18,8 @@ func TestReceiveFromOutputs(t *testing.T) {
 	const device1ID = "node1"
 	const inputType = types.InputTypeImage
 	const instance = types.DefaultInputInstance
-	const outputAddrRaw = "test/pub1/node1/image/0/" + types.MessageTypeRaw       // pemberton, bc
-	const outputAddrLatest = "test/pub1/node1/image/0/" + types.MessageTypeLatest // pemberton, bc
+	const outputAddrRaw = "test/pub1/node1/image/0/" + string(types.MessageTypeRaw)       // pemberton, bc
+	const outputAddrLatest = "test/pub1/node1/image/0/" + string(types.MessageTypeLatest) // pemberton, bc
 	var inputReceived = ""
 	var privKey = messaging.CreateAsymKeys()
 	var signatureVerificationKey = &privKey.PublicKey
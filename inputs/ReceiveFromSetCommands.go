@@ -4,7 +4,6 @@ package inputs
 import (
 	"errors"
 	"fmt"
-	"strings"
 	"sync"
 
 	"github.com/iotdomain/iotdomain-go/lib"
@@ -18,6 +17,8 @@ import (
 // the sender public key. Last it translates from the publishing address to the input ID
 // before passing the request to the handler associated with the input.
 type ReceiveFromSetCommands struct {
+	// optional authorization of the sender of a set command for the input's node
+	authorizeSender  func(nodeHWID string, sender string) error
 	domain           string // the domain of this publisher
 	publisherID      string // the registered publisher for the inputs
 	isRunning        bool
@@ -55,20 +56,21 @@ func (ifset *ReceiveFromSetCommands) DeleteInput(inputID string) {
 }
 
 // decodeSetCommand decrypts and verifies the signature of an incoming set command.
-// If successful this passes the set command to the setInputHandler callback
+// If successful and the value meets the input's constraints, this passes the set command to the
+// setInputHandler callback
 func (ifset *ReceiveFromSetCommands) decodeSetCommand(address string, message string) error {
 	var setMessage types.SetInputMessage
 
 	// Check that address is one of our inputs
-	segments := strings.Split(address, "/")
+	segments, err := types.ParseAddress(address)
 	// a full address is required
-	if len(segments) < 6 {
+	if err != nil || segments.MessageType != types.MessageTypeSetInput {
 		errText := fmt.Sprintf("decodeSetCommand: Destination address '%s' is incomplete.", address)
 		return errors.New(errText)
 	}
 	// domain/pub/node/inputtype/instance/$input
-	segments[5] = types.MessageTypeInputDiscovery
-	inputAddr := strings.Join(segments, "/")
+	segments.MessageType = types.MessageTypeInputDiscovery
+	inputAddr := types.MakeAddress(segments)
 
 	isEncrypted, isSigned, err := ifset.messageSigner.DecodeMessage(message, &setMessage)
 
@@ -92,18 +94,39 @@ func (ifset *ReceiveFromSetCommands) decodeSetCommand(address string, message st
 	logrus.Infof("decodeSetCommand successful for input %s. isEncrypted=%t, isSigned=%t",
 		address, isEncrypted, isSigned)
 
-	// the handler is responsible for authorization
 	inputID := ifset.registeredInputs.addressMap[inputAddr]
+	input := ifset.registeredInputs.GetInputByID(inputID)
+	if input != nil && ifset.authorizeSender != nil {
+		err = ifset.authorizeSender(input.NodeHWID, setMessage.Sender)
+		if err != nil {
+			return err
+		}
+	}
+	// reject values outside the input's constraints before they reach the device
+	if input != nil {
+		err = ValidateInputValue(input, setMessage.Value)
+		if err != nil {
+			return err
+		}
+	}
 	ifset.registeredInputs.NotifyInputHandler(inputID, setMessage.Sender, setMessage.Value)
 	return nil
 }
 
+// SetSenderAuthorization sets the handler that authorizes the sender of a set command for the
+// input's node. Commands from unauthorized senders are discarded. Without authorization any
+// verified sender can set inputs.
+func (ifset *ReceiveFromSetCommands) SetSenderAuthorization(
+	authorizeSender func(nodeHWID string, sender string) error) {
+	ifset.updateMutex.Lock()
+	defer ifset.updateMutex.Unlock()
+	ifset.authorizeSender = authorizeSender
+}
+
 // subscribeToSetCommand to receive set input commands for the given node, type and instance
 func (ifset *ReceiveFromSetCommands) subscribeToSetCommand(input *types.InputDiscoveryMessage) {
 	// change message type $input to $set to make the set address from the input address
-	segments := strings.Split(input.Address, "/")
-	segments[5] = types.MessageTypeSetInput
-	setAddr := strings.Join(segments, "/")
+	setAddr := types.MakeMessageAddress(types.MakeBaseAddress(input.Address), types.MessageTypeSetInput)
 
 	// prevent double subscription
 	_, hasSubscription := ifset.subscriptions[input.Address]
@@ -117,9 +140,7 @@ func (ifset *ReceiveFromSetCommands) subscribeToSetCommand(input *types.InputDis
 func (ifset *ReceiveFromSetCommands) unsubscribeFromSetCommand(inputID string) {
 	// change message type $input to $set to make the set address from the input address
 	input := ifset.registeredInputs.GetInputByID(inputID)
-	segments := strings.Split(input.Address, "/")
-	segments[5] = types.MessageTypeSetInput
-	setAddr := strings.Join(segments, "/")
+	setAddr := types.MakeMessageAddress(types.MakeBaseAddress(input.Address), types.MessageTypeSetInput)
 
 	_, hasSubscription := ifset.subscriptions[setAddr]
 	if hasSubscription {
@@ -133,8 +154,8 @@ func (ifset *ReceiveFromSetCommands) unsubscribeFromSetCommand(inputID string) {
 func MakeSetInputAddress(domain string, publisherID string, nodeID string,
 	inputType types.InputType, instance string) string {
 
-	address := fmt.Sprintf("%s/%s/%s"+"/%s/%s/"+types.MessageTypeSetInput,
-		domain, publisherID, nodeID, inputType, instance)
+	address := types.MakeAddress(&types.AddressSegments{Domain: domain, PublisherID: publisherID, NodeID: nodeID,
+		OutputType: string(inputType), Instance: instance, MessageType: types.MessageTypeSetInput})
 	return address
 }
 
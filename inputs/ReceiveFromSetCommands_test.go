@@ -114,3 +114,42 @@ func TestPublishSetInput(t *testing.T) {
 	assert.NotEqual(t, "content old", rxMsg, "Older message should not be accepted")
 
 }
+
+func TestSetInputConstraints(t *testing.T) {
+	const input1Type = types.InputTypeDimmer
+	var setInput1Addr = inputs.MakeSetInputAddress(domain, publisher1ID, node1ID, input1Type, types.DefaultInputInstance)
+	var senderAddr = fmt.Sprintf("%s/publisher1/node2/$node", domain)
+	rxValue := ""
+
+	msgr := messaging.NewDummyMessenger(nil)
+	signer := messaging.NewMessageSigner(msgr, privKey, getPublisherKey)
+	registeredInputs := inputs.NewRegisteredInputs(domain, publisher1ID)
+	receiver := inputs.NewReceiveFromSetCommands(domain, publisher1ID, signer, registeredInputs)
+	input := receiver.CreateInput(node1ID, input1Type, types.DefaultInputInstance,
+		func(input *types.InputDiscoveryMessage, sender string, value string) {
+			rxValue = value
+		})
+	newInput := *input
+	newInput.DataType = types.DataTypeNumber
+	newInput.Min = 0
+	newInput.Max = 100
+	registeredInputs.UpdateInput(&newInput)
+
+	inputs.PublishSetInput(setInput1Addr, "50", senderAddr, signer, &privKey.PublicKey)
+	assert.Equal(t, "50", rxValue)
+
+	// out of range and invalid values don't reach the handler
+	inputs.PublishSetInput(setInput1Addr, "300", senderAddr, signer, &privKey.PublicKey)
+	assert.Equal(t, "50", rxValue)
+	inputs.PublishSetInput(setInput1Addr, "bright", senderAddr, signer, &privKey.PublicKey)
+	assert.Equal(t, "50", rxValue)
+
+	// enum values
+	newInput.DataType = types.DataTypeEnum
+	newInput.EnumValues = []string{"low", "high"}
+	registeredInputs.UpdateInput(&newInput)
+	inputs.PublishSetInput(setInput1Addr, "high", senderAddr, signer, &privKey.PublicKey)
+	assert.Equal(t, "high", rxValue)
+	inputs.PublishSetInput(setInput1Addr, "medium", senderAddr, signer, &privKey.PublicKey)
+	assert.Equal(t, "high", rxValue)
+}
@@ -2,10 +2,11 @@
 package inputs
 
 import (
+	"sort"
 	"sync"
-	"time"
 
 	"github.com/iotdomain/iotdomain-go/lib"
+	"github.com/iotdomain/iotdomain-go/messaging"
 	"github.com/iotdomain/iotdomain-go/types"
 )
 
@@ -20,9 +21,11 @@ import (
 // Generics would be nice as this overlaps with outputs, nodes, publishers
 // The inputID used in the inputMap consist of nodeHWID.inputType.instance
 type RegisteredInputs struct {
+	clock             messaging.Clock                         // clock for input timestamps
 	domain            string                                  // the domain of this publisher
 	publisherID       string                                  // the registered publisher for the inputs
 	addressMap        map[string]string                       // lookup inputID by publication address
+	deletedInputs     map[string]bool                         // addresses of deleted inputs to remove from the message bus
 	inputsByHWID      map[string]*types.InputDiscoveryMessage // lookup input by inputHWID
 	updatedInputHWIDs map[string]string                       // inputHWIDs of inputs that have been rediscovered/updated
 	updateMutex       *sync.Mutex                             // mutex for async handling of inputs
@@ -47,7 +50,7 @@ func (regInputs *RegisteredInputs) CreateInputWithSource(
 	regInputs.updateMutex.Lock()
 	defer regInputs.updateMutex.Unlock()
 
-	input := NewInput(regInputs.domain, regInputs.publisherID, nodeHWID, inputType, instance)
+	input := newInput(regInputs.domain, regInputs.publisherID, nodeHWID, inputType, instance, regInputs.clock)
 	input.Source = source
 
 	regInputs.updateInput(input, handler)
@@ -61,14 +64,15 @@ func (regInputs *RegisteredInputs) DeleteInput(inputHWID string) {
 	regInputs.updateMutex.Lock()
 	defer regInputs.updateMutex.Unlock()
 
-	// inputAddr := MakeInputDiscoveryAddress(regInputs.domain, regInputs.publisherID, nodeID, inputType, instance)
+	input := regInputs.inputsByHWID[inputHWID]
+	if input == nil {
+		return
+	}
+	delete(regInputs.addressMap, input.Address)
 	delete(regInputs.inputsByHWID, inputHWID)
 	delete(regInputs.handlers, inputHWID)
-	if regInputs.updatedInputHWIDs == nil {
-		regInputs.updatedInputHWIDs = make(map[string]string)
-	}
-	// "" updates mean that the input is deleted
-	regInputs.updatedInputHWIDs[inputHWID] = ""
+	delete(regInputs.updatedInputHWIDs, inputHWID)
+	regInputs.deletedInputs[input.Address] = true
 }
 
 // GetAllInputs returns the list of inputs
@@ -137,6 +141,23 @@ func (regInputs *RegisteredInputs) GetInputsWithSource(source string) []*types.I
 	return inputList
 }
 
+// GetDeletedInputs returns the addresses of inputs that have been deleted, sorted
+// clearDeletions clears the list of deletions. Intended for removing deleted inputs from the message bus.
+func (regInputs *RegisteredInputs) GetDeletedInputs(clearDeletions bool) []string {
+	regInputs.updateMutex.Lock()
+	defer regInputs.updateMutex.Unlock()
+
+	deleteList := make([]string, 0, len(regInputs.deletedInputs))
+	for address := range regInputs.deletedInputs {
+		deleteList = append(deleteList, address)
+	}
+	sort.Strings(deleteList)
+	if clearDeletions {
+		regInputs.deletedInputs = make(map[string]bool)
+	}
+	return deleteList
+}
+
 // GetUpdatedInputs returns the list of registered inputs that have been updated
 // clear the update on return
 func (regInputs *RegisteredInputs) GetUpdatedInputs(clearUpdates bool) []*types.InputDiscoveryMessage {
@@ -170,6 +191,20 @@ func (regInputs *RegisteredInputs) NotifyInputHandler(inputID string, sender str
 	}
 }
 
+// getClock returns the clock used for input timestamps
+func (regInputs *RegisteredInputs) getClock() messaging.Clock {
+	regInputs.updateMutex.Lock()
+	defer regInputs.updateMutex.Unlock()
+	return regInputs.clock
+}
+
+// SetClock sets the clock used for input timestamps. Intended for testing.
+func (regInputs *RegisteredInputs) SetClock(clock messaging.Clock) {
+	regInputs.updateMutex.Lock()
+	defer regInputs.updateMutex.Unlock()
+	regInputs.clock = clock
+}
+
 // SetNodeID changes the publication address of all inputs that belong to the device hardware address
 func (regInputs *RegisteredInputs) SetNodeID(nodeHWID string, newNodeID string) {
 	inputList := regInputs.GetInputsByNodeHWID(nodeHWID)
@@ -214,8 +249,10 @@ func (regInputs *RegisteredInputs) updateInput(input *types.InputDiscoveryMessag
 	if regInputs.updatedInputHWIDs == nil {
 		regInputs.updatedInputHWIDs = make(map[string]string)
 	}
-	input.Timestamp = time.Now().Format(types.TimeFormat)
+	input.Timestamp = regInputs.clock.Now().Format(types.TimeFormat)
 	regInputs.updatedInputHWIDs[input.InputID] = input.InputID
+	// an input that is recreated before its deletion is published replaces the deletion
+	delete(regInputs.deletedInputs, input.Address)
 }
 
 // MakeInputHWID creates the internal ID to identify the input of the owning node using its HWID
@@ -228,6 +265,12 @@ func MakeInputHWID(nodeHWID string, inputType types.InputType, instance string)
 // To add it to the inputlist use 'UpdateInput'
 func NewInput(
 	domain string, publisherID string, nodeHWID string, inputType types.InputType, instance string) *types.InputDiscoveryMessage {
+	return newInput(domain, publisherID, nodeHWID, inputType, instance, messaging.RealClock)
+}
+
+// newInput creates an input object with a timestamp from the given clock
+func newInput(domain string, publisherID string, nodeHWID string, inputType types.InputType, instance string,
+	clock messaging.Clock) *types.InputDiscoveryMessage {
 
 	inputHWID := MakeInputHWID(nodeHWID, inputType, instance)
 	address := MakeInputDiscoveryAddress(domain, publisherID, nodeHWID, inputType, instance)
@@ -236,7 +279,7 @@ func NewInput(
 		Address:   address,
 		Attr:      make(types.NodeAttrMap),
 		Config:    make(types.ConfigAttrMap),
-		Timestamp: time.Now().Format(types.TimeFormat),
+		Timestamp: clock.Now().Format(types.TimeFormat),
 		// internal use only
 		InputID:     inputHWID,
 		NodeHWID:    nodeHWID,
@@ -251,12 +294,14 @@ func NewInput(
 func NewRegisteredInputs(domain string, publisherID string) *RegisteredInputs {
 
 	regInputs := &RegisteredInputs{
-		domain:       domain,
-		publisherID:  publisherID,
-		addressMap:   make(map[string]string),
-		inputsByHWID: make(map[string]*types.InputDiscoveryMessage),
-		handlers:     make(map[string]func(input *types.InputDiscoveryMessage, sender string, newValue string)),
-		updateMutex:  &sync.Mutex{},
+		clock:         messaging.RealClock,
+		domain:        domain,
+		publisherID:   publisherID,
+		addressMap:    make(map[string]string),
+		deletedInputs: make(map[string]bool),
+		inputsByHWID:  make(map[string]*types.InputDiscoveryMessage),
+		handlers:      make(map[string]func(input *types.InputDiscoveryMessage, sender string, newValue string)),
+		updateMutex:   &sync.Mutex{},
 	}
 	return regInputs
 }
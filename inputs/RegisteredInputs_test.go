@@ -51,6 +51,10 @@ func TestNewRegisteredInput(t *testing.T) {
 
 	// delete input
 	collection.DeleteInput(input.InputID)
+	assert.Nil(t, collection.GetInputByID(input.InputID))
+	assert.Nil(t, collection.GetInputByAddress(node1InputAddr))
+	assert.Equal(t, []string{node1InputAddr}, collection.GetDeletedInputs(true))
+	assert.Empty(t, collection.GetDeletedInputs(false))
 
 	// input with source
 	collection.CreateInputWithSource(node1ID, types.InputTypeSwitch, types.DefaultInputInstance, Source1ID, nil)
@@ -0,0 +1,18 @@
+// Package inputs with validation of input values
+package inputs
+
+import (
+	"github.com/iotdomain/iotdomain-go/lib"
+	"github.com/iotdomain/iotdomain-go/types"
+)
+
+// ValidateInputValue checks if a value matches the input's declared data type and constraints.
+// See types.ValidateValue for the validation rules.
+// Returns an error if the value is invalid
+func ValidateInputValue(input *types.InputDiscoveryMessage, value string) error {
+	err := types.ValidateValue(input.DataType, value, input.Min, input.Max, input.EnumValues)
+	if err != nil {
+		return lib.MakeErrorf("ValidateInputValue: Input '%s': %s", input.Address, err)
+	}
+	return nil
+}
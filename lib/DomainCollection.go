@@ -4,10 +4,10 @@ package lib
 import (
 	"crypto/ecdsa"
 	"reflect"
-	"strings"
 	"sync"
 
 	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/types"
 )
 
 // DomainCollection for managing discovered nodes,inputs and outputs
@@ -15,10 +15,11 @@ import (
 type DomainCollection struct {
 	DiscoMap map[string]interface{} // discovered by addres
 	// MessageSigner *messaging.MessageSigner // subscription to discovery messages
-	GetPublicKey func(string) *ecdsa.PublicKey // get the public key for signature verification
-	UpdateMutex  *sync.Mutex                   // mutex for async updating
-	ItemPtr      reflect.Type                  // pointer type of item in map
-	updateCount  int                           // nr of updates to this collection
+	GetPublicKey func(string) *ecdsa.PublicKey   // get the public key for signature verification
+	UpdateMutex  *sync.Mutex                     // mutex for async updating
+	ItemPtr      reflect.Type                    // pointer type of item in map
+	Validate     func(string, interface{}) error // optional check of received items. Invalid items are discarded
+	updateCount  int                             // nr of updates to this collection
 }
 
 // Get returns an item by node address and optionally ioType and instance
@@ -27,7 +28,14 @@ type DomainCollection struct {
 func (dc *DomainCollection) Get(nodeAddress string, ioType string, instance string) interface{} {
 	base := MakeBaseAddress(nodeAddress)
 	if ioType != "" {
-		base = base + "/" + ioType + "/" + instance
+		segments, err := types.ParseBaseAddress(nodeAddress)
+		if err != nil {
+			return nil
+		}
+		segments.OutputType = ioType
+		segments.Instance = instance
+		segments.MessageType = ""
+		base = types.MakeAddress(segments)
 	}
 
 	dc.UpdateMutex.Lock()
@@ -47,9 +55,9 @@ func (dc *DomainCollection) GetByAddress(address string) interface{} {
 	return item
 }
 
-// GetByAddressPrefix fills the given slice (pointer) with all items that start with the given address
-// The message type is removed from addressPrefix, so a node discover address can be used to
-//  find corresponding inputs and outputs.
+// GetByAddressPrefix fills the given slice (pointer) with all items that belong to the given address
+// The message type is ignored, so a node discover address can be used to find corresponding inputs
+// and outputs. See types.IsAddressOf.
 // The result is stored in resultSlicePtr which must be a pointer to a slice
 //   that contains pointers to items, eg: []*Item
 func (dc *DomainCollection) GetByAddressPrefix(addressPrefix string, resultSlicePtr interface{}) {
@@ -58,11 +66,10 @@ func (dc *DomainCollection) GetByAddressPrefix(addressPrefix string, resultSlice
 
 	dc.UpdateMutex.Lock()
 	defer dc.UpdateMutex.Unlock()
-	base := MakeBaseAddress(addressPrefix)
 	itemListVal := reflect.ValueOf(resultSlicePtr).Elem()
 
 	for addr, item := range dc.DiscoMap {
-		if strings.HasPrefix(addr, base) {
+		if types.IsAddressOf(addr, addressPrefix) {
 			objectValue := reflect.ValueOf(item)
 			itemListVal.Set(reflect.Append(itemListVal, objectValue))
 
@@ -111,14 +118,20 @@ func (dc *DomainCollection) HandleDiscovery(
 	if err != nil {
 		return MakeErrorf("HandleDiscovery: Failed verifying signature on address %s: %s", address, err)
 	}
-	segments := strings.Split(address, "/")
-	if len(segments) > 2 {
-		setObjectField(newItem, "PublisherID", segments[1])
-		setObjectField(newItem, "NodeID", segments[2])
+	if dc.Validate != nil {
+		err = dc.Validate(address, newItem)
+		if err != nil {
+			return MakeErrorf("HandleDiscovery: Discarded invalid item on address %s: %s", address, err)
+		}
+	}
+	segments, err := types.ParseBaseAddress(address)
+	if err == nil && segments.NodeID != "" {
+		setObjectField(newItem, "PublisherID", segments.PublisherID)
+		setObjectField(newItem, "NodeID", segments.NodeID)
 	}
-	if len(segments) > 4 {
-		setObjectField(newItem, "OutputType", segments[3])
-		setObjectField(newItem, "Instance", segments[4])
+	if err == nil && segments.OutputType != "" {
+		setObjectField(newItem, "OutputType", segments.OutputType)
+		setObjectField(newItem, "Instance", segments.Instance)
 	}
 
 	dc.Update(address, newItem)
@@ -160,18 +173,9 @@ func (dc *DomainCollection) UpdateCount() int {
 }
 
 // MakeBaseAddress returns the base address without messagetype suffix
+// See also types.SetAddressFormat.
 func MakeBaseAddress(address string) string {
-	segments := strings.Split(address, "/")
-	if len(segments) < 2 {
-		return address
-	}
-	// remove the last segment if it is a message type (starts with $)
-	lastSegment := segments[len(segments)-1]
-	if strings.HasPrefix(lastSegment, "$") {
-		segments = segments[:len(segments)-1]
-	}
-	baseAddr := strings.Join(segments, "/")
-	return baseAddr
+	return types.MakeBaseAddress(address)
 }
 
 func setObjectField(object interface{}, fieldName string, value string) {
@@ -0,0 +1,55 @@
+// Package messaging with the allow-list of signature algorithms accepted on verification
+package messaging
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+// ErrAlgorithmNotAllowed is returned when a message is signed with an algorithm that isn't allowed
+var ErrAlgorithmNotAllowed = errors.New("signature algorithm not allowed")
+
+// DefaultAllowedAlgorithms are the JWS signature algorithms accepted when verifying messages.
+// Publisher keys are ECDSA P-256 keys which sign with ES256. ES384 and EdDSA are accepted for
+// publishers that sign with P-384 or Ed25519 keys, see JWSAlgorithm.
+var DefaultAllowedAlgorithms = []string{string(jose.ES256), string(jose.ES384), string(jose.EdDSA)}
+
+// AllowedAlgorithms returns the JWS signature algorithms that are accepted on verification
+func (signer *MessageSigner) AllowedAlgorithms() []string {
+	signer.algorithmMutex.RLock()
+	defer signer.algorithmMutex.RUnlock()
+	return signer.allowedAlgorithms
+}
+
+// SetAllowedAlgorithms sets the JWS signature algorithms that are accepted on verification,
+// replacing DefaultAllowedAlgorithms. Signed messages that use another algorithm are rejected.
+//  algorithms eg "ES256", "ES384", "ES512" or "EdDSA"
+func (signer *MessageSigner) SetAllowedAlgorithms(algorithms ...string) {
+	signer.algorithmMutex.Lock()
+	defer signer.algorithmMutex.Unlock()
+	signer.allowedAlgorithms = append([]string{}, algorithms...)
+}
+
+// verifyJWSAlgorithm checks that all signatures of a JWS message use an allowed algorithm
+// Returns an error wrapping ErrAlgorithmNotAllowed if an algorithm isn't allowed
+func verifyJWSAlgorithm(jwsSignature *jose.JSONWebSignature, allowedAlgorithms []string) error {
+	if len(jwsSignature.Signatures) == 0 {
+		return fmt.Errorf("verifyJWSAlgorithm: %w: message has no signature", ErrAlgorithmNotAllowed)
+	}
+	for _, signature := range jwsSignature.Signatures {
+		alg := signature.Header.Algorithm
+		allowed := false
+		for _, allowedAlg := range allowedAlgorithms {
+			if alg == allowedAlg {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("verifyJWSAlgorithm: %w: '%s'", ErrAlgorithmNotAllowed, alg)
+		}
+	}
+	return nil
+}
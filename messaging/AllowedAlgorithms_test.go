@@ -0,0 +1,74 @@
+package messaging_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllowedAlgorithms(t *testing.T) {
+	privKey := messaging.CreateAsymKeys()
+	getPublicKey := func(address string) *ecdsa.PublicKey {
+		return &privKey.PublicKey
+	}
+	signer := messaging.NewMessageSigner(nil, privKey, getPublicKey)
+	assert.Equal(t, []string{"ES256", "ES384", "EdDSA"}, signer.AllowedAlgorithms())
+	message, err := signer.SignObject(&TestObjectWithSender{Field1: "hello", Sender: "test/publisher1"})
+	require.NoError(t, err)
+
+	var received TestObjectWithSender
+	isSigned, err := signer.VerifySignedMessage(message, &received)
+	assert.NoError(t, err)
+	assert.True(t, isSigned)
+
+	// a spoofed alg header is rejected before the signature is checked
+	parts := strings.Split(message, ".")
+	require.Equal(t, 3, len(parts))
+	spoofedHeader := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256"}`))
+	spoofed := spoofedHeader + "." + parts[1] + "." + parts[2]
+	isSigned, err = signer.VerifySignedMessage(spoofed, &received)
+	assert.True(t, isSigned)
+	assert.True(t, errors.Is(err, messaging.ErrAlgorithmNotAllowed))
+	_, err = messaging.VerifySenderJWSSignature(spoofed, &received, nil)
+	assert.True(t, errors.Is(err, messaging.ErrAlgorithmNotAllowed))
+	// the rejection reports the sender and algorithm
+	result := messaging.VerifySignatureDetailed(spoofed, &received, getPublicKey, signer.AllowedAlgorithms())
+	assert.True(t, errors.Is(result.Err, messaging.ErrAlgorithmNotAllowed))
+	assert.Equal(t, "test/publisher1", result.Sender)
+	assert.Equal(t, "HS256", result.Algorithm)
+	assert.False(t, result.Verified)
+
+	// ES384 is allowed by default
+	p384Key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	p384Signer := messaging.NewMessageSigner(nil, p384Key, nil)
+	message384, err := p384Signer.SignObject(&TestObjectWithSender{Field1: "hello", Sender: "test/publisher2"})
+	require.NoError(t, err)
+	getPublicKey = func(address string) *ecdsa.PublicKey {
+		return &p384Key.PublicKey
+	}
+	signer = messaging.NewMessageSigner(nil, privKey, getPublicKey)
+	_, err = signer.VerifySignedMessage(message384, &received)
+	assert.NoError(t, err)
+
+	// a valid signature with an algorithm that isn't allowed is rejected
+	signer.SetAllowedAlgorithms("ES256")
+	_, err = signer.VerifySignedMessage(message384, &received)
+	assert.True(t, errors.Is(err, messaging.ErrAlgorithmNotAllowed))
+
+	signer.SetAllowedAlgorithms("ES256", "ES384")
+	_, err = signer.VerifySignedMessage(message384, &received)
+	assert.NoError(t, err)
+
+	// unsigned messages are not affected
+	isSigned, err = signer.VerifySignedMessage(`{"field1":"hello","sender":"test/publisher1"}`, &received)
+	assert.False(t, isSigned)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,60 @@
+// Package messaging - Clock source for timestamps and time based behavior
+package messaging
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock provides the current time. Intended to let tests control the time used for timestamps,
+// expiry, staleness and replay checks. The default is RealClock.
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+}
+
+// realClock is the clock that provides the system time
+type realClock struct{}
+
+// Now returns the system time
+func (clock realClock) Now() time.Time {
+	return time.Now()
+}
+
+// RealClock is the clock that provides the system time
+var RealClock Clock = realClock{}
+
+// ManualClock is a clock whose time only changes when it is set or advanced. Intended for testing.
+type ManualClock struct {
+	now         time.Time
+	updateMutex *sync.Mutex
+}
+
+// Advance moves the time of the clock forward by the given duration
+func (clock *ManualClock) Advance(duration time.Duration) {
+	clock.updateMutex.Lock()
+	defer clock.updateMutex.Unlock()
+	clock.now = clock.now.Add(duration)
+}
+
+// Now returns the time of the clock
+func (clock *ManualClock) Now() time.Time {
+	clock.updateMutex.Lock()
+	defer clock.updateMutex.Unlock()
+	return clock.now
+}
+
+// Set the time of the clock
+func (clock *ManualClock) Set(now time.Time) {
+	clock.updateMutex.Lock()
+	defer clock.updateMutex.Unlock()
+	clock.now = now
+}
+
+// NewManualClock creates a clock that is set to the given time
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{
+		now:         now,
+		updateMutex: &sync.Mutex{},
+	}
+}
@@ -0,0 +1,46 @@
+package messaging_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManualClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := messaging.NewManualClock(start)
+	assert.Equal(t, start, clock.Now())
+
+	clock.Advance(time.Hour)
+	assert.Equal(t, start.Add(time.Hour), clock.Now())
+
+	clock.Set(start)
+	assert.Equal(t, start, clock.Now())
+
+	// the real clock follows the system time
+	assert.WithinDuration(t, time.Now(), messaging.RealClock.Now(), time.Second)
+}
+
+func TestSignerClock(t *testing.T) {
+	messenger := messaging.NewInMemoryMessenger(&messaging.MessengerConfig{})
+	privKey := messaging.CreateAsymKeys()
+	signer := messaging.NewMessageSigner(messenger, privKey, nil)
+	assert.Equal(t, messaging.RealClock, signer.Clock())
+
+	// the deduplicator forgets messages when the clock passes the window
+	clock := messaging.NewManualClock(time.Now())
+	dedup := messaging.NewDeduplicator(time.Minute)
+	signer.SetDeduplicator(dedup)
+	signer.SetClock(clock)
+	assert.Equal(t, clock, signer.Clock())
+	message1, _ := messaging.CreateJWSSignature("message1", privKey)
+	assert.False(t, dedup.IsDuplicate("sub1", message1))
+	assert.True(t, dedup.IsDuplicate("sub1", message1))
+	clock.Advance(2 * time.Minute)
+	assert.False(t, dedup.IsDuplicate("sub1", message1))
+
+	signer.SetClock(nil)
+	assert.Equal(t, messaging.RealClock, signer.Clock())
+}
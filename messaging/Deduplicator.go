@@ -0,0 +1,82 @@
+// Package messaging - Deduplication of received messages for at-least-once delivery
+package messaging
+
+import (
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+// ErrDuplicateMessage is returned when a received message is dropped as a duplicate
+var ErrDuplicateMessage = errors.New("duplicate message")
+
+// Deduplicator drops messages that are received more than once within a time window, for example
+// when the message bus redelivers a message with QoS 1.
+// Messages are identified by a hash of their content and the subscription they are received on.
+// Only signed or encrypted messages are deduplicated. Their signature or encryption contains a
+// random component so a publisher that publishes the same value twice is not affected. Unsigned
+// messages can legitimately be identical and are never considered duplicates.
+type Deduplicator struct {
+	clock       Clock                  // clock for the time of receipt
+	lastPurge   time.Time              // time expired messages were last removed
+	seen        map[[32]byte]time.Time // hash of received messages with their time of receipt
+	window      time.Duration          // time a received message is remembered
+	updateMutex *sync.Mutex            // mutex for concurrent receiving
+}
+
+// IsDuplicate returns true if the signed or encrypted message was already received on the
+// subscription within the time window. Otherwise the message is remembered. Unsigned messages
+// are never duplicates.
+//  subscription identifies the subscription the message is received on
+//  message is the raw message as received
+func (dedup *Deduplicator) IsDuplicate(subscription string, message string) bool {
+	if _, err := jose.ParseSigned(message); err != nil {
+		if _, err = jose.ParseEncrypted(message); err != nil {
+			return false
+		}
+	}
+	hash := sha256.Sum256([]byte(subscription + "\x00" + message))
+	now := dedup.clock.Now()
+
+	dedup.updateMutex.Lock()
+	defer dedup.updateMutex.Unlock()
+	if now.Sub(dedup.lastPurge) >= dedup.window {
+		for key, received := range dedup.seen {
+			if now.Sub(received) >= dedup.window {
+				delete(dedup.seen, key)
+			}
+		}
+		dedup.lastPurge = now
+	}
+	received, found := dedup.seen[hash]
+	if found && now.Sub(received) < dedup.window {
+		return true
+	}
+	dedup.seen[hash] = now
+	return false
+}
+
+// SetClock sets the clock used for the time of receipt of messages. Intended for testing.
+func (dedup *Deduplicator) SetClock(clock Clock) {
+	dedup.updateMutex.Lock()
+	defer dedup.updateMutex.Unlock()
+	dedup.clock = clock
+	dedup.lastPurge = clock.Now()
+}
+
+// NewDeduplicator creates a deduplicator for received messages
+//  window is the time a received message is remembered. Messages are typically redelivered
+//  within seconds.
+func NewDeduplicator(window time.Duration) *Deduplicator {
+	dedup := &Deduplicator{
+		clock:       RealClock,
+		lastPurge:   RealClock.Now(),
+		seen:        make(map[[32]byte]time.Time),
+		window:      window,
+		updateMutex: &sync.Mutex{},
+	}
+	return dedup
+}
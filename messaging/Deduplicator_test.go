@@ -0,0 +1,73 @@
+package messaging_test
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeduplicator(t *testing.T) {
+	const addr1 = "test/pub1/node1/switch/0/$latest"
+	messenger := messaging.NewInMemoryMessenger(&messaging.MessengerConfig{})
+	privKey := messaging.CreateAsymKeys()
+	signer := messaging.NewMessageSigner(messenger, privKey, nil)
+	metrics := messaging.NewPrometheusMetrics()
+	signer.SetMetrics(metrics)
+	clock := messaging.NewManualClock(time.Now())
+	dedup := messaging.NewDeduplicator(100 * time.Millisecond)
+	signer.SetDeduplicator(dedup)
+	signer.SetClock(clock)
+	rxCount1 := 0
+	rxCount2 := 0
+	// handlers are closures of the same function literal
+	makeHandler := func(rxCount *int) func(address string, message string) error {
+		return func(address string, message string) error {
+			*rxCount++
+			return nil
+		}
+	}
+	signer.Subscribe(addr1, makeHandler(&rxCount1))
+	id2 := signer.Subscribe(addr1, makeHandler(&rxCount2))
+
+	// a redelivered signed message is dropped. Each subscription receives it once.
+	signedMessage, err := messaging.CreateJWSSignature("value", privKey)
+	require.NoError(t, err)
+	messenger.Publish(addr1, false, signedMessage)
+	messenger.Publish(addr1, false, signedMessage)
+	assert.Equal(t, 1, rxCount1)
+	assert.Equal(t, 1, rxCount2)
+
+	// signed messages with the same content are not duplicates
+	signer.PublishSigned(addr1, false, "value")
+	signer.PublishSigned(addr1, false, "value")
+	assert.Equal(t, 3, rxCount1)
+
+	// identical unsigned messages are not duplicates
+	messenger.Publish(addr1, false, "message1")
+	messenger.Publish(addr1, false, "message1")
+	messenger.Publish(addr1, false, `{"address":"test/pub1"}`)
+	messenger.Publish(addr1, false, `{"address":"test/pub1"}`)
+	assert.Equal(t, 7, rxCount1)
+
+	// after the window the message is accepted again
+	clock.Advance(100 * time.Millisecond)
+	messenger.Publish(addr1, false, signedMessage)
+	assert.Equal(t, 8, rxCount1)
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, nil)
+	assert.Contains(t, recorder.Body.String(), "iotdomain_messages_duplicate_dropped_total 2")
+
+	// unsubscribing by ID removes the deduplicating handler of that subscription only
+	signer.UnsubscribeByID(id2)
+	messenger.Publish(addr1, false, "message2")
+	assert.Equal(t, 9, rxCount1)
+	assert.Equal(t, 8, rxCount2)
+	signer.UnsubscribeAll()
+	messenger.Publish(addr1, false, "message2")
+	assert.Equal(t, 9, rxCount1)
+}
@@ -2,6 +2,7 @@
 package messaging
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -12,25 +13,46 @@ import (
 
 // DummyMessenger that implements IMessenger
 type DummyMessenger struct {
-	publications  map[string]string
-	config        *MessengerConfig // for domain configuration
-	subscriptions []Subscription
-	publishMutex  *sync.Mutex // mutex for concurrent publishing of messages
+	publications    map[string]string
+	config          *MessengerConfig // for domain configuration
+	lastWillAddress string           // LWT address from connect
+	lastWillValue   string           // LWT message from connect
+	onConnect       []func()         // handlers invoked on connect
+	onDisconnect    func(err error)  // handler invoked on disconnect
+	subscriptions   []Subscription
+	publishMutex    *sync.Mutex // mutex for concurrent publishing of messages
+
+	subscriptionCount SubscriptionID // nr of subscriptions made, for the ID of the next subscription
 }
 
 // Subscription to messages
 type Subscription struct {
+	id      SubscriptionID // identifies the subscription, see UnsubscribeByID
 	address string
 	handler func(address string, message string) error
 }
 
 // Connect the messenger
 func (messenger *DummyMessenger) Connect(lastWillAddress string, lastWillValue string) error {
+	messenger.publishMutex.Lock()
+	messenger.lastWillAddress = lastWillAddress
+	messenger.lastWillValue = lastWillValue
+	onConnect := messenger.onConnect
+	messenger.publishMutex.Unlock()
+	for _, handler := range onConnect {
+		handler()
+	}
 	return nil
 }
 
 // Disconnect gracefully disconnects the messenger
 func (messenger *DummyMessenger) Disconnect() {
+	messenger.publishMutex.Lock()
+	onDisconnect := messenger.onDisconnect
+	messenger.publishMutex.Unlock()
+	if onDisconnect != nil {
+		onDisconnect(nil)
+	}
 }
 
 // FindLastPublication with the given address
@@ -84,15 +106,55 @@ func (messenger *DummyMessenger) Publish(address string, retained bool, message
 	return nil
 }
 
+// SimulateConnectionLost publishes the last will and testament as the broker would do
+// when the connection is unexpectedly lost. Intended for testing.
+func (messenger *DummyMessenger) SimulateConnectionLost() {
+	messenger.publishMutex.Lock()
+	lastWillAddress := messenger.lastWillAddress
+	lastWillValue := messenger.lastWillValue
+	messenger.publishMutex.Unlock()
+	if lastWillAddress != "" {
+		messenger.Publish(lastWillAddress, true, lastWillValue)
+	}
+	messenger.publishMutex.Lock()
+	onDisconnect := messenger.onDisconnect
+	messenger.publishMutex.Unlock()
+	if onDisconnect != nil {
+		onDisconnect(errors.New("connection lost"))
+	}
+}
+
+// OnConnect adds a handler that is invoked on connect
+func (messenger *DummyMessenger) OnConnect(handler func()) {
+	messenger.publishMutex.Lock()
+	defer messenger.publishMutex.Unlock()
+	messenger.onConnect = append(messenger.onConnect, handler)
+}
+
+// OnDisconnect sets the handler that is invoked on disconnect or lost connection
+func (messenger *DummyMessenger) OnDisconnect(handler func(err error)) {
+	messenger.publishMutex.Lock()
+	defer messenger.publishMutex.Unlock()
+	messenger.onDisconnect = handler
+}
+
 // Subscribe to a message by address
 func (messenger *DummyMessenger) Subscribe(
 	address string, onMessage func(address string, message string) error) {
+	messenger.SubscribeWithID(address, onMessage)
+}
+
+// SubscribeWithID subscribes to a message by address and returns the ID of the subscription
+func (messenger *DummyMessenger) SubscribeWithID(
+	address string, onMessage func(address string, message string) error) SubscriptionID {
 
 	logrus.Infof("DummyMessenger.Subscribe: address %s", address)
-	subscription := Subscription{address: address, handler: onMessage}
 	messenger.publishMutex.Lock()
+	defer messenger.publishMutex.Unlock()
+	messenger.subscriptionCount++
+	subscription := Subscription{id: messenger.subscriptionCount, address: address, handler: onMessage}
 	messenger.subscriptions = append(messenger.subscriptions, subscription)
-	messenger.publishMutex.Unlock()
+	return subscription.id
 }
 
 // Unsubscribe an address and handler
@@ -118,6 +180,18 @@ func (messenger *DummyMessenger) Unsubscribe(
 	messenger.publishMutex.Unlock()
 }
 
+// UnsubscribeByID removes the subscription with the given ID
+func (messenger *DummyMessenger) UnsubscribeByID(id SubscriptionID) {
+	messenger.publishMutex.Lock()
+	defer messenger.publishMutex.Unlock()
+	for i, sub := range messenger.subscriptions {
+		if sub.id == id {
+			messenger.subscriptions = append(messenger.subscriptions[:i], messenger.subscriptions[i+1:]...)
+			return
+		}
+	}
+}
+
 // test if a given address matches a subscription address with wildcards
 func (messenger *DummyMessenger) matchAddress(address string, subscription string) (match bool) {
 	subscriptionSegments := strings.Split(subscription, "/")
@@ -1,18 +1,22 @@
 // Package messaging - Interface of messengers for publishers and subscribers
 package messaging
 
+import "github.com/iotdomain/iotdomain-go/types"
+
 // MessengerConfig with configuration of a messenger
 type MessengerConfig struct {
-	ClientID  string `yaml:"clientid,omitempty"`  // optional connect ID, must be unique. Default is generated.
-	Domain    string `yaml:"domain,omitempty"`    // Domain to be used by all publishers
-	Login     string `yaml:"login"`               // messenger login name
-	Port      uint16 `yaml:"port,omitempty"`      // optional port, default is 8883 for TLS
-	Password  string `yaml:"credentials"`         // messenger login credentials
-	PubQos    byte   `yaml:"pubqos,omitempty"`    // publishing QOS 0-2. Default=0
-	Server    string `yaml:"server"`              // Message bus server/broker hostname or ip address, required
-	Signing   bool   `yaml:"signing,omitempty"`   // Message signing to be used by all publishers.
-	SubQos    byte   `yaml:"subqos,omitempty"`    // Subscription QOS 0-2. Default=0
-	Messenger string `yaml:"messenger,omitempty"` // Messenger client type: "DummyMessenger" (default) or "MQTTMessenger"
+	ClientID   string                     `yaml:"clientid,omitempty"`   // optional connect ID, must be unique. Default is generated.
+	Domain     string                     `yaml:"domain,omitempty"`     // Domain to be used by all publishers
+	Login      string                     `yaml:"login"`                // messenger login name
+	MessageQos map[types.MessageType]byte `yaml:"messageqos,omitempty"` // publishing QOS per message type, overrides pubqos
+	Port       uint16                     `yaml:"port,omitempty"`       // optional port, default is 8883 for TLS
+	Password   string                     `yaml:"credentials"`          // messenger login credentials
+	PubQos     byte                       `yaml:"pubqos,omitempty"`     // publishing QOS 0-2. Default=0
+	Server     string                     `yaml:"server"`               // Message bus server/broker hostname or ip address, required
+	Signing    bool                       `yaml:"signing,omitempty"`    // Message signing to be used by all publishers.
+	SubQos     byte                       `yaml:"subqos,omitempty"`     // Subscription QOS 0-2. Default=0
+	Messenger  string                     `yaml:"messenger,omitempty"`  // Messenger client type: "DummyMessenger" (default), "InMemoryMessenger", "SimulationMessenger" or "MQTTMessenger"
+	TLS        *TLSConfig                 `yaml:"tls,omitempty"`        // optional TLS settings of the MQTT connection, eg client certificates for mTLS
 }
 
 // IMessenger interface for messenger implementations
@@ -33,6 +37,16 @@ type IMessenger interface {
 	// message.
 	Disconnect()
 
+	// OnConnect adds a handler that is invoked after the connection is established or re-established.
+	// Handlers are invoked in the order they are added. Subscriptions made with Subscribe are restored
+	// after a reconnect before the handlers are invoked.
+	// Intended to let publishers republish their retained discovery messages.
+	OnConnect(handler func())
+
+	// OnDisconnect sets the handler that is invoked when the connection is lost or closed.
+	// The error is nil on a graceful disconnect.
+	OnDisconnect(handler func(err error))
+
 	// Publish a message. The publisher must sign and optionally encrypt the message before
 	// publishing, using the Signing method specified in the config.
 	//  address to subscribe to as per IoTDomain standard
@@ -50,3 +64,19 @@ type IMessenger interface {
 	// If onMessage is nil then all subscriptions with the address will be removed
 	Unsubscribe(address string, onMessage func(address string, message string) error)
 }
+
+// SubscriptionID identifies a subscription, see ISubscriptionIDs
+type SubscriptionID uint64
+
+// ISubscriptionIDs is an optional interface of messengers that identify subscriptions by ID.
+// Unsubscribe identifies a subscription by its handler, which can't tell apart handlers that are
+// closures of the same function literal or method values of the same method. The message signer
+// uses subscription IDs when the messenger implements this interface. The messengers of this
+// package all implement it.
+type ISubscriptionIDs interface {
+	// SubscribeWithID subscribes to an address like Subscribe and returns the ID of the subscription
+	SubscribeWithID(address string, onMessage func(address string, message string) error) SubscriptionID
+
+	// UnsubscribeByID removes the subscription with the given ID
+	UnsubscribeByID(id SubscriptionID)
+}
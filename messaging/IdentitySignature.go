@@ -0,0 +1,163 @@
+// Package messaging with key type dependent signing of publisher identities
+package messaging
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/iotdomain/iotdomain-go/types"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// JWSAlgorithm returns the JWS signature algorithm to use with a private or public key.
+// ECDSA keys use ES256, ES384 or ES512 depending on their curve and Ed25519 keys use EdDSA.
+// Messages and identities are signed with the algorithm of the publisher's key.
+func JWSAlgorithm(key interface{}) (jose.SignatureAlgorithm, error) {
+	switch typedKey := key.(type) {
+	case *ecdsa.PrivateKey:
+		if typedKey == nil {
+			return "", errors.New("JWSAlgorithm: Key is nil")
+		}
+		return JWSAlgorithm(&typedKey.PublicKey)
+	case *ecdsa.PublicKey:
+		if typedKey == nil || typedKey.Curve == nil {
+			return "", errors.New("JWSAlgorithm: Key is nil")
+		}
+		switch typedKey.Curve.Params().BitSize {
+		case 256:
+			return jose.ES256, nil
+		case 384:
+			return jose.ES384, nil
+		case 521:
+			return jose.ES512, nil
+		}
+		return "", fmt.Errorf("JWSAlgorithm: Unsupported curve %s", typedKey.Curve.Params().Name)
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return jose.EdDSA, nil
+	}
+	return "", fmt.Errorf("JWSAlgorithm: Unsupported key type %T", key)
+}
+
+// ParsePublicKeyPem converts a PEM encoded public key of any supported type, ECDSA or Ed25519.
+// Use PublicKeyFromPem for ECDSA public keys.
+// Returns an error if the key isn't PEM encoded or has an unsupported type.
+func ParsePublicKeyPem(pemEncodedPub string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pemEncodedPub))
+	if block == nil {
+		return nil, errors.New("ParsePublicKeyPem: Public key isn't PEM encoded")
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("ParsePublicKeyPem: %s", err)
+	}
+	if _, err = JWSAlgorithm(publicKey); err != nil {
+		return nil, err
+	}
+	return publicKey, nil
+}
+
+// identityPayload returns the signed payload of the identity. This is the identity without its signature
+// and capabilities. Capabilities are not part of the identity signature so they can change without
+// re-issuing the identity, and so that clients that don't know them can still verify the identity.
+// The identity message itself is signed by the publisher.
+func identityPayload(ident *types.PublisherIdentityMessage) []byte {
+	identCopy := *ident
+	identCopy.IdentitySignature = ""
+	identCopy.Capabilities = nil
+	payload, _ := json.Marshal(identCopy)
+	return payload
+}
+
+// SignIdentityWithKey updates the base64URL encoded signature of the public identity using the
+// algorithm of the signing key. ECDSA signatures are ASN.1 encoded with a hash that matches the
+// curve size, Ed25519 signatures are raw.
+func SignIdentityWithKey(publicIdent *types.PublisherIdentityMessage, signingKey crypto.Signer) error {
+	payload := identityPayload(publicIdent)
+
+	var signature []byte
+	var err error
+	switch typedKey := signingKey.(type) {
+	case *ecdsa.PrivateKey:
+		hashed, err2 := identityHash(&typedKey.PublicKey, payload)
+		if err2 != nil {
+			return err2
+		}
+		signature, err = typedKey.Sign(rand.Reader, hashed, nil)
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(typedKey, payload)
+	default:
+		return fmt.Errorf("SignIdentityWithKey: Unsupported key type %T", signingKey)
+	}
+	if err != nil {
+		return err
+	}
+	publicIdent.IdentitySignature = base64.URLEncoding.EncodeToString(signature)
+	return nil
+}
+
+// VerifyIdentity verifies the base64URL encoded signature of the identity against the identity itself.
+// The algorithm is determined by the type of the verification key, which is the identity's own public
+// key for self-signed identities, or the issuer's public key.
+func VerifyIdentity(ident *types.PublisherIdentityMessage, verifyKey crypto.PublicKey) error {
+	payload := identityPayload(ident)
+	signature, err := base64.URLEncoding.DecodeString(ident.IdentitySignature)
+	if err != nil {
+		return errors.New("VerifyIdentity: Invalid signature encoding")
+	}
+
+	switch typedKey := verifyKey.(type) {
+	case *ecdsa.PublicKey:
+		var rs ECDSASignature
+		if typedKey == nil {
+			return errors.New("VerifyIdentity: Public key is nil")
+		}
+		hashed, err := identityHash(typedKey, payload)
+		if err != nil {
+			return err
+		}
+		if _, err = asn1.Unmarshal(signature, &rs); err != nil {
+			return errors.New("VerifyIdentity: Signature is not ASN")
+		}
+		if !ecdsa.Verify(typedKey, hashed, rs.R, rs.S) {
+			return errors.New("VerifyIdentity: Signature does not match identity")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(typedKey, payload, signature) {
+			return errors.New("VerifyIdentity: Signature does not match identity")
+		}
+	case nil:
+		return errors.New("VerifyIdentity: Public key is nil")
+	default:
+		return fmt.Errorf("VerifyIdentity: Unsupported key type %T", verifyKey)
+	}
+	return nil
+}
+
+// identityHash returns the hash of the identity payload that matches the key's curve
+func identityHash(publicKey *ecdsa.PublicKey, payload []byte) ([]byte, error) {
+	algorithm, err := JWSAlgorithm(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	switch algorithm {
+	case jose.ES384:
+		hashed := sha512.Sum384(payload)
+		return hashed[:], nil
+	case jose.ES512:
+		hashed := sha512.Sum512(payload)
+		return hashed[:], nil
+	}
+	hashed := sha256.Sum256(payload)
+	return hashed[:], nil
+}
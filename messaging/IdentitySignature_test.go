@@ -0,0 +1,132 @@
+package messaging_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestVerifyIdentityAlgorithms(t *testing.T) {
+	ident := types.PublisherIdentityMessage{
+		Address: "test/pub1/$identity", Domain: "test", PublisherID: "pub1", IssuerID: "pub1"}
+
+	// an ECDSA signature made with the original implementation still verifies
+	p256Key := messaging.CreateAsymKeys()
+	payload, _ := json.Marshal(ident)
+	ident.IdentitySignature = messaging.CreateEcdsaSignature(payload, p256Key)
+	assert.NoError(t, messaging.VerifyIdentity(&ident, &p256Key.PublicKey))
+
+	// P-384 keys sign with a SHA-384 hash
+	p384Key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	err := messaging.SignIdentityWithKey(&ident, p384Key)
+	require.NoError(t, err)
+	assert.NoError(t, messaging.VerifyIdentity(&ident, &p384Key.PublicKey))
+	assert.Error(t, messaging.VerifyIdentity(&ident, &p256Key.PublicKey))
+
+	// Ed25519 keys sign with EdDSA
+	edPub, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	err = messaging.SignIdentityWithKey(&ident, edPriv)
+	require.NoError(t, err)
+	assert.NoError(t, messaging.VerifyIdentity(&ident, edPub))
+	assert.Error(t, messaging.VerifyIdentity(&ident, &p256Key.PublicKey))
+	ident.Organization = "modified"
+	assert.Error(t, messaging.VerifyIdentity(&ident, edPub))
+
+	// the key type declared in the identity's PEM public key is recovered
+	x509Pub, _ := x509.MarshalPKIXPublicKey(edPub)
+	edPem := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: x509Pub}))
+	parsedKey, err := messaging.ParsePublicKeyPem(edPem)
+	require.NoError(t, err)
+	assert.Equal(t, edPub, parsedKey)
+	parsedKey, err = messaging.ParsePublicKeyPem(messaging.PublicKeyToPem(&p256Key.PublicKey))
+	require.NoError(t, err)
+	assert.Equal(t, &p256Key.PublicKey, parsedKey)
+	_, err = messaging.ParsePublicKeyPem("not a pem")
+	assert.Error(t, err)
+
+	// invalid keys
+	assert.Error(t, messaging.VerifyIdentity(&ident, nil))
+	var nilKey *ecdsa.PublicKey
+	assert.Error(t, messaging.VerifyIdentity(&ident, nilKey))
+	assert.Error(t, messaging.VerifyIdentity(&ident, "not a key"))
+}
+
+func TestJWSAlgorithm(t *testing.T) {
+	p256Key := messaging.CreateAsymKeys()
+	p384Key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	edPub, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+
+	algorithm, err := messaging.JWSAlgorithm(p256Key)
+	assert.NoError(t, err)
+	assert.Equal(t, jose.ES256, algorithm)
+	algorithm, _ = messaging.JWSAlgorithm(&p384Key.PublicKey)
+	assert.Equal(t, jose.ES384, algorithm)
+	algorithm, _ = messaging.JWSAlgorithm(edPriv)
+	assert.Equal(t, jose.EdDSA, algorithm)
+	algorithm, _ = messaging.JWSAlgorithm(edPub)
+	assert.Equal(t, jose.EdDSA, algorithm)
+	_, err = messaging.JWSAlgorithm("not a key")
+	assert.Error(t, err)
+
+	// messages and identities are signed with the same algorithm
+	message, err := messaging.CreateJWSSignature("payload", p384Key)
+	require.NoError(t, err)
+	jws, err := jose.ParseSigned(message)
+	require.NoError(t, err)
+	assert.Equal(t, string(jose.ES384), jws.Signatures[0].Header.Algorithm)
+
+	signer := messaging.NewMessageSigner(messaging.NewDummyMessenger(nil), p384Key, nil)
+	ident := types.PublisherIdentityMessage{Address: "test/pub1/$identity", IssuerID: "pub1"}
+	err = signer.SignIdentity(&ident)
+	require.NoError(t, err)
+	assert.NoError(t, messaging.VerifyIdentitySignature(&ident, &p384Key.PublicKey))
+
+	noKeySigner := messaging.NewMessageSigner(messaging.NewDummyMessenger(nil), nil, nil)
+	assert.Error(t, noKeySigner.SignIdentity(&ident))
+}
+
+func TestEd25519SigningKey(t *testing.T) {
+	edPub, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	signer := messaging.NewMessageSigner(messaging.NewDummyMessenger(nil), messaging.CreateAsymKeys(), nil)
+	err := signer.SetSigningKey(edPriv)
+	require.NoError(t, err)
+
+	// messages and identities are signed with EdDSA
+	message, err := signer.SignObject("payload")
+	require.NoError(t, err)
+	jws, err := jose.ParseSigned(message)
+	require.NoError(t, err)
+	assert.Equal(t, string(jose.EdDSA), jws.Signatures[0].Header.Algorithm)
+	payload, err := jws.Verify(edPub)
+	assert.NoError(t, err)
+	assert.Equal(t, `"payload"`, string(payload))
+
+	ident := types.PublisherIdentityMessage{Address: "test/pub1/$identity", IssuerID: "pub1"}
+	err = signer.SignIdentity(&ident)
+	require.NoError(t, err)
+	assert.NoError(t, messaging.VerifyIdentity(&ident, edPub))
+
+	// unsupported key types are rejected
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	assert.Error(t, signer.SetSigningKey(rsaKey))
+
+	// nil restores signing with the private key
+	err = signer.SetSigningKey(nil)
+	require.NoError(t, err)
+	message, err = signer.SignObject("payload")
+	require.NoError(t, err)
+	jws, _ = jose.ParseSigned(message)
+	assert.Equal(t, string(jose.ES256), jws.Signatures[0].Header.Algorithm)
+}
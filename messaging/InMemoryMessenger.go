@@ -0,0 +1,209 @@
+// Package messaging - In-memory messenger for testing publishers without a message bus
+package messaging
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// InMemoryMessenger implements IMessenger by routing publications to subscribers in the same process.
+// Publications are delivered synchronously to all subscribers with a matching address. Retained
+// publications are kept and delivered to new subscribers. Safe for concurrent use.
+type InMemoryMessenger struct {
+	config          *MessengerConfig  // for domain configuration
+	lastWillAddress string            // LWT address from connect
+	lastWillValue   string            // LWT message from connect
+	onConnect       []func()          // handlers invoked on connect
+	onDisconnect    func(err error)   // handler invoked on disconnect
+	retained        map[string]string // retained messages by address
+	subscriptions   []Subscription    // subscriptions in order of subscribing
+	updateMutex     *sync.RWMutex     // mutex for concurrent publishing and subscribing
+
+	subscriptionCount SubscriptionID // nr of subscriptions made, for the ID of the next subscription
+}
+
+// Connect the messenger
+func (messenger *InMemoryMessenger) Connect(lastWillAddress string, lastWillValue string) error {
+	messenger.updateMutex.Lock()
+	messenger.lastWillAddress = lastWillAddress
+	messenger.lastWillValue = lastWillValue
+	onConnect := messenger.onConnect
+	messenger.updateMutex.Unlock()
+	for _, handler := range onConnect {
+		handler()
+	}
+	return nil
+}
+
+// Disconnect gracefully disconnects the messenger and removes all subscriptions
+func (messenger *InMemoryMessenger) Disconnect() {
+	messenger.updateMutex.Lock()
+	messenger.subscriptions = nil
+	onDisconnect := messenger.onDisconnect
+	messenger.updateMutex.Unlock()
+	if onDisconnect != nil {
+		onDisconnect(nil)
+	}
+}
+
+// GetRetained returns the retained message on the given address
+func (messenger *InMemoryMessenger) GetRetained(address string) (message string, found bool) {
+	messenger.updateMutex.RLock()
+	defer messenger.updateMutex.RUnlock()
+	message, found = messenger.retained[address]
+	return message, found
+}
+
+// OnConnect adds a handler that is invoked on connect
+func (messenger *InMemoryMessenger) OnConnect(handler func()) {
+	messenger.updateMutex.Lock()
+	defer messenger.updateMutex.Unlock()
+	messenger.onConnect = append(messenger.onConnect, handler)
+}
+
+// OnDisconnect sets the handler that is invoked on disconnect
+func (messenger *InMemoryMessenger) OnDisconnect(handler func(err error)) {
+	messenger.updateMutex.Lock()
+	defer messenger.updateMutex.Unlock()
+	messenger.onDisconnect = handler
+}
+
+// Publish a message to all subscribers with a matching address.
+// A retained message replaces the previous retained message on the address. As with MQTT, an
+// empty retained message removes the retained message.
+func (messenger *InMemoryMessenger) Publish(address string, retained bool, message string) error {
+	messenger.updateMutex.Lock()
+	if retained {
+		if message == "" {
+			delete(messenger.retained, address)
+		} else {
+			messenger.retained[address] = message
+		}
+	}
+	messenger.updateMutex.Unlock()
+	messenger.deliver(address, message)
+	return nil
+}
+
+// Subscribe to messages on an address with support for the '+' and '#' wildcards.
+// Retained messages with a matching address are delivered immediately.
+func (messenger *InMemoryMessenger) Subscribe(
+	address string, onMessage func(address string, message string) error) {
+	messenger.SubscribeWithID(address, onMessage)
+}
+
+// SubscribeWithID subscribes to messages on an address like Subscribe and returns the ID of the
+// subscription
+func (messenger *InMemoryMessenger) SubscribeWithID(
+	address string, onMessage func(address string, message string) error) SubscriptionID {
+
+	messenger.updateMutex.Lock()
+	messenger.subscriptionCount++
+	id := messenger.subscriptionCount
+	messenger.subscriptions = append(messenger.subscriptions, Subscription{id: id, address: address, handler: onMessage})
+	retained := make(map[string]string)
+	for retainedAddress, message := range messenger.retained {
+		if MatchAddress(address, retainedAddress) {
+			retained[retainedAddress] = message
+		}
+	}
+	messenger.updateMutex.Unlock()
+
+	for retainedAddress, message := range retained {
+		onMessage(retainedAddress, message)
+	}
+	return id
+}
+
+// deliver a message to all subscribers with a matching address
+// Returns the number of handlers the message was delivered to
+func (messenger *InMemoryMessenger) deliver(address string, message string) int {
+	messenger.updateMutex.RLock()
+	handlers := make([]func(address string, message string) error, 0)
+	for _, subscription := range messenger.subscriptions {
+		if MatchAddress(subscription.address, address) {
+			handlers = append(handlers, subscription.handler)
+		}
+	}
+	messenger.updateMutex.RUnlock()
+
+	// handlers can publish or subscribe so invoke them outside the lock
+	for _, handler := range handlers {
+		err := handler(address, message)
+		if err != nil {
+			logrus.Infof("InMemoryMessenger.Publish: handler of address %s: %s", address, err)
+		}
+	}
+	return len(handlers)
+}
+
+// Unsubscribe an address and handler
+// If onMessage is nil then all subscriptions with the address are removed
+func (messenger *InMemoryMessenger) Unsubscribe(
+	address string, onMessage func(address string, message string) error) {
+
+	messenger.updateMutex.Lock()
+	defer messenger.updateMutex.Unlock()
+	remaining := make([]Subscription, 0, len(messenger.subscriptions))
+	removed := false
+	for _, sub := range messenger.subscriptions {
+		// functions can't be compared directly so compare their pointers
+		if sub.address == address && (onMessage == nil ||
+			(!removed && reflect.ValueOf(sub.handler).Pointer() == reflect.ValueOf(onMessage).Pointer())) {
+			removed = true
+		} else {
+			remaining = append(remaining, sub)
+		}
+	}
+	messenger.subscriptions = remaining
+}
+// UnsubscribeByID removes the subscription with the given ID
+func (messenger *InMemoryMessenger) UnsubscribeByID(id SubscriptionID) {
+	messenger.updateMutex.Lock()
+	defer messenger.updateMutex.Unlock()
+	for index, sub := range messenger.subscriptions {
+		if sub.id == id {
+			messenger.subscriptions = append(messenger.subscriptions[:index], messenger.subscriptions[index+1:]...)
+			return
+		}
+	}
+}
+
+// MatchAddress tests if an address matches a subscription address using MQTT wildcard rules.
+//  '+' matches exactly one address segment
+//  '#' matches any number of remaining segments, including none, and must be the last segment
+// As with MQTT, wildcards in the first segment do not match addresses that start with '$'.
+func MatchAddress(subscription string, address string) bool {
+	subscriptionSegments := strings.Split(subscription, "/")
+	addressSegments := strings.Split(address, "/")
+
+	if strings.HasPrefix(address, "$") &&
+		(subscriptionSegments[0] == "+" || subscriptionSegments[0] == "#") {
+		return false
+	}
+	for index, subscriptionSegment := range subscriptionSegments {
+		if subscriptionSegment == "#" {
+			return index == len(subscriptionSegments)-1
+		} else if index >= len(addressSegments) {
+			return false
+		} else if subscriptionSegment != "+" && subscriptionSegment != addressSegments[index] {
+			return false
+		}
+	}
+	return len(subscriptionSegments) == len(addressSegments)
+}
+
+// NewInMemoryMessenger creates a messenger that routes messages within the process
+func NewInMemoryMessenger(config *MessengerConfig) *InMemoryMessenger {
+	messenger := &InMemoryMessenger{
+		config:        config,
+		retained:      make(map[string]string),
+		subscriptions: make([]Subscription, 0),
+		updateMutex:   &sync.RWMutex{},
+	}
+	return messenger
+}
+
@@ -0,0 +1,97 @@
+package messaging_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchAddress(t *testing.T) {
+	assert.True(t, messaging.MatchAddress("a/b/c", "a/b/c"))
+	assert.False(t, messaging.MatchAddress("a/b/c", "a/b"))
+	assert.False(t, messaging.MatchAddress("a/b", "a/b/c"))
+	assert.True(t, messaging.MatchAddress("a/+/c", "a/b/c"))
+	assert.False(t, messaging.MatchAddress("a/+", "a/b/c"))
+	assert.True(t, messaging.MatchAddress("+/+/+", "a/b/c"))
+	assert.True(t, messaging.MatchAddress("a/#", "a/b/c"))
+	assert.True(t, messaging.MatchAddress("a/#", "a"))
+	assert.True(t, messaging.MatchAddress("#", "a/b/c"))
+	assert.True(t, messaging.MatchAddress("+/b/#", "a/b"))
+	assert.False(t, messaging.MatchAddress("a/#/c", "a/b/c"))
+	assert.True(t, messaging.MatchAddress("a/+", "a/"))
+	// wildcards don't match system addresses
+	assert.False(t, messaging.MatchAddress("#", "$SYS/broker"))
+	assert.False(t, messaging.MatchAddress("+/broker", "$SYS/broker"))
+	assert.True(t, messaging.MatchAddress("$SYS/#", "$SYS/broker"))
+}
+
+func TestInMemoryPublishSubscribe(t *testing.T) {
+	const addr1 = "test/pub1/node1/temperature/0/$latest"
+	const addr2 = "test/pub1/node2/temperature/0/$latest"
+	rxMessages := make(map[string]string)
+	rxCount := 0
+	handler := func(address string, message string) error {
+		rxMessages[address] = message
+		rxCount++
+		return nil
+	}
+	messenger := messaging.NewInMemoryMessenger(&messaging.MessengerConfig{})
+	err := messenger.Connect("", "")
+	assert.NoError(t, err)
+
+	// retained messages are delivered on subscribe
+	messenger.Publish(addr1, true, "retained1")
+	messenger.Publish(addr2, false, "notretained")
+	messenger.Subscribe("test/+/+/temperature/0/$latest", handler)
+	assert.Equal(t, 1, rxCount)
+	assert.Equal(t, "retained1", rxMessages[addr1])
+
+	messenger.Publish(addr2, false, "value2")
+	assert.Equal(t, 2, rxCount)
+	assert.Equal(t, "value2", rxMessages[addr2])
+	// no match
+	messenger.Publish("test/pub1/node1/$node", false, "node")
+	assert.Equal(t, 2, rxCount)
+
+	// empty retained message removes the retained message
+	messenger.Publish(addr1, true, "")
+	_, found := messenger.GetRetained(addr1)
+	assert.False(t, found)
+
+	messenger.Unsubscribe("test/+/+/temperature/0/$latest", handler)
+	messenger.Publish(addr2, false, "value3")
+	assert.Equal(t, 3, rxCount) // the empty retained message was delivered, value3 not
+	messenger.Disconnect()
+}
+
+func TestInMemoryConcurrency(t *testing.T) {
+	messenger := messaging.NewInMemoryMessenger(&messaging.MessengerConfig{})
+	mutex := sync.Mutex{}
+	rxCount := 0
+	messenger.Subscribe("test/#", func(address string, message string) error {
+		mutex.Lock()
+		rxCount++
+		mutex.Unlock()
+		return nil
+	})
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			address := fmt.Sprintf("test/pub%d", i)
+			handler := func(address string, message string) error {
+				// handlers can publish
+				return messenger.Publish(address+"/reply", true, message)
+			}
+			messenger.Subscribe(address, handler)
+			messenger.Publish(address, false, "hello")
+			messenger.Unsubscribe(address, handler)
+			wg.Done()
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 40, rxCount)
+}
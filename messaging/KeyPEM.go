@@ -0,0 +1,143 @@
+// Package messaging - Loading and saving of keys in PEM format
+package messaging
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// ErrPassphraseRequired is returned when loading an encrypted PEM key without a passphrase
+var ErrPassphraseRequired = errors.New("PEM key is encrypted and requires a passphrase")
+
+// KeyEncoding is the encoding of a private key in PEM format
+type KeyEncoding int
+
+// Encodings of private keys
+const (
+	// KeyEncodingSEC1 encodes the key as an "EC PRIVATE KEY" block as per RFC 5915
+	KeyEncodingSEC1 KeyEncoding = iota
+	// KeyEncodingPKCS8 encodes the key as a "PRIVATE KEY" block as per RFC 5208
+	KeyEncodingPKCS8
+)
+
+// LoadPrivateKeyPEM loads an ECDSA private key from PEM data in SEC1 or PKCS#8 encoding.
+// Use LoadPrivateKeyPEMWithPassphrase for encrypted keys.
+func LoadPrivateKeyPEM(data []byte) (*ecdsa.PrivateKey, error) {
+	return LoadPrivateKeyPEMWithPassphrase(data, nil)
+}
+
+// LoadPrivateKeyPEMWithPassphrase loads an ECDSA private key from PEM data in SEC1 or PKCS#8
+// encoding, or from an "ENCRYPTED PRIVATE KEY" block that is encrypted with a passphrase using
+// PBES2 with PBKDF2 and AES-CBC, as saved by SavePrivateKeyPEM and 'openssl pkcs8 -topk8'.
+// The encoding is determined from the content as keys saved with PrivateKeyToPem have a SEC1
+// encoding in a "PRIVATE KEY" block.
+//  passphrase to decrypt an encrypted key. Use nil for unencrypted keys
+// Returns the key or an error if the data doesn't hold an ECDSA private key
+func LoadPrivateKeyPEMWithPassphrase(data []byte, passphrase []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("LoadPrivateKeyPEM: Data is not in PEM format")
+	}
+	der := block.Bytes
+	if block.Type == "ENCRYPTED PRIVATE KEY" {
+		if passphrase == nil {
+			return nil, ErrPassphraseRequired
+		}
+		var err error
+		der, err = decryptPKCS8(der, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("LoadPrivateKeyPEM: Unable to decrypt key: %w", err)
+		}
+	}
+	privateKey, err := x509.ParseECPrivateKey(der)
+	if err == nil {
+		return privateKey, nil
+	}
+	genericKey, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("LoadPrivateKeyPEM: Block '%s' is not a SEC1 or PKCS#8 private key: %s", block.Type, err)
+	}
+	privateKey, isECDSA := genericKey.(*ecdsa.PrivateKey)
+	if !isECDSA {
+		return nil, errors.New("LoadPrivateKeyPEM: Private key is not an ECDSA key")
+	}
+	return privateKey, nil
+}
+
+// LoadPublicKeyPEM loads an ECDSA public key from a PKIX "PUBLIC KEY" or a "CERTIFICATE" PEM block.
+// Intended for implementing the getPublicKey function of the message signer from stored keys.
+// Returns the key or an error if the data doesn't hold an ECDSA public key
+func LoadPublicKeyPEM(data []byte) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("LoadPublicKeyPEM: Data is not in PEM format")
+	}
+	var genericKey interface{}
+	if block.Type == "CERTIFICATE" {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("LoadPublicKeyPEM: Invalid certificate: %s", err)
+		}
+		genericKey = cert.PublicKey
+	} else {
+		var err error
+		genericKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("LoadPublicKeyPEM: Block '%s' is not a public key: %s", block.Type, err)
+		}
+	}
+	publicKey, isECDSA := genericKey.(*ecdsa.PublicKey)
+	if !isECDSA {
+		return nil, errors.New("LoadPublicKeyPEM: Public key is not an ECDSA key")
+	}
+	return publicKey, nil
+}
+
+// SavePrivateKeyPEM encodes an ECDSA private key in PEM format, optionally encrypted.
+// Encrypted keys are saved as an "ENCRYPTED PRIVATE KEY" block with PKCS#8 encoding, regardless
+// of the encoding, using PBES2 with PBKDF2-HMAC-SHA256 and AES-256-CBC as per RFC 8018.
+//  encoding is KeyEncodingSEC1 or KeyEncodingPKCS8
+//  passphrase to encrypt the key with. Use nil to save the key unencrypted
+// Returns the PEM data
+func SavePrivateKeyPEM(privateKey *ecdsa.PrivateKey, encoding KeyEncoding, passphrase []byte) ([]byte, error) {
+	if privateKey == nil {
+		return nil, errors.New("SavePrivateKeyPEM: Missing private key")
+	}
+	var blockType string
+	var der []byte
+	var err error
+	if encoding == KeyEncodingPKCS8 || passphrase != nil {
+		blockType = "PRIVATE KEY"
+		der, err = x509.MarshalPKCS8PrivateKey(privateKey)
+	} else {
+		blockType = "EC PRIVATE KEY"
+		der, err = x509.MarshalECPrivateKey(privateKey)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("SavePrivateKeyPEM: Unable to marshal key: %s", err)
+	}
+	if passphrase != nil {
+		blockType = "ENCRYPTED PRIVATE KEY"
+		der, err = encryptPKCS8(der, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("SavePrivateKeyPEM: Unable to encrypt key: %s", err)
+		}
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), nil
+}
+
+// SavePublicKeyPEM encodes an ECDSA public key as a PKIX "PUBLIC KEY" PEM block
+// Returns the PEM data
+func SavePublicKeyPEM(publicKey *ecdsa.PublicKey) ([]byte, error) {
+	if publicKey == nil {
+		return nil, errors.New("SavePublicKeyPEM: Missing public key")
+	}
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("SavePublicKeyPEM: Unable to marshal key: %s", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
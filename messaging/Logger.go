@@ -0,0 +1,20 @@
+// Package messaging - Logger interface for injecting an application logger
+package messaging
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// ILogger for logging of messaging activity. Both *logrus.Logger and *logrus.Entry implement
+// this interface. Use a logrus.Entry to attach fields like the publisherID to each log entry.
+type ILogger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warningf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// DefaultLogger returns the logger used when none is provided, which is the standard logrus logger
+func DefaultLogger() ILogger {
+	return logrus.StandardLogger()
+}
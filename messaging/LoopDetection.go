@@ -0,0 +1,114 @@
+// Package messaging - Detection of publication loops between publishers that forward messages
+package messaging
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+// HopCountHeader is the JWS header that holds the nr of times a message was forwarded
+const HopCountHeader = "hops"
+
+// DefaultMaxHops is the default max nr of times a message can be forwarded
+const DefaultMaxHops = 8
+
+// ErrMessageLoop is returned when a forwarded message is dropped because it loops
+var ErrMessageLoop = errors.New("message loop detected")
+
+// ForwardObject publishes an object that is derived from a received message, like PublishObject
+// with the retained policy, and increments the hop count of the received message. The hop count
+// is included in the message signature header. Publication is refused when the hop count exceeds
+// the max hops. Intended for bridging and republishing of received messages.
+//  receivedHops is the hop count of the received message, see SubscribeVerifiedWithHops
+// Returns ErrMessageLoop if the max hop count is exceeded
+func (signer *MessageSigner) ForwardObject(address string, object interface{}, receivedHops int) error {
+	hops := receivedHops + 1
+	maxHops := signer.MaxHops()
+	if maxHops > 0 && hops > maxHops {
+		signer.logger.Warningf("MessageSigner.ForwardObject: Loop suppressed. Message to %s exceeds %d hops",
+			address, maxHops)
+		return ErrMessageLoop
+	}
+	payload, err := signer.marshal(object)
+	if err != nil || object == nil {
+		return fmt.Errorf("MessageSigner.ForwardObject: Error marshalling message for address %s: %s", address, err)
+	}
+	return signer.publishSigned(address, signer.IsRetained(address), string(payload), hops)
+}
+
+// MaxHops returns the max nr of times a message can be forwarded. 0 or less means unlimited.
+func (signer *MessageSigner) MaxHops() int {
+	signer.policyMutex.RLock()
+	defer signer.policyMutex.RUnlock()
+	return signer.maxHops
+}
+
+// SetMaxHops sets the max nr of times a message can be forwarded. Received messages with more
+// hops are dropped and forwarding them is refused. Default is DefaultMaxHops.
+//  maxHops is the max hop count. Use 0 or less for unlimited.
+func (signer *MessageSigner) SetMaxHops(maxHops int) {
+	signer.policyMutex.Lock()
+	defer signer.policyMutex.Unlock()
+	signer.maxHops = maxHops
+}
+
+// checkLoop determines the hop count of a received message and whether it loops. A message
+// loops if its hop count exceeds the max hops, or if it is forwarded and signed by this signer,
+// which means the signer received its own republished message.
+//  rawMessage is the received message, optionally encrypted
+// Returns the hop count of the message, or ErrMessageLoop
+func (signer *MessageSigner) checkLoop(address string, rawMessage string) (hops int, err error) {
+	if err = checkMessageLimits(rawMessage); err != nil {
+		return 0, err
+	}
+	message, _, _ := DecryptMessage(rawMessage, signer.privateKey)
+	jwsSignature, err := jose.ParseSigned(message)
+	if err != nil {
+		// unsigned messages have no hop count
+		return 0, nil
+	}
+	hops = getHopCount(jwsSignature)
+	if hops == 0 {
+		return 0, nil
+	}
+	// own forwarded messages loop regardless of their hop count and the max hops
+	if signingKey := signer.getSigningKey(); signingKey != nil {
+		if _, err = jwsSignature.Verify(signingKey.Public()); err == nil {
+			signer.logger.Warningf("MessageSigner.checkLoop: Loop suppressed. Received own forwarded message on %s",
+				address)
+			return hops, ErrMessageLoop
+		}
+	}
+	maxHops := signer.MaxHops()
+	if maxHops > 0 && hops > maxHops {
+		signer.logger.Warningf("MessageSigner.checkLoop: Loop suppressed. Message on %s has %d hops", address, hops)
+		return hops, ErrMessageLoop
+	}
+	return hops, nil
+}
+
+// GetHopCount returns the nr of times a signed message was forwarded.
+// Unsigned messages and messages that weren't forwarded have a hop count of 0.
+//  message is the signed message, decrypted if it was encrypted
+func GetHopCount(message string) int {
+	if checkMessageLimits(message) != nil {
+		return 0
+	}
+	jwsSignature, err := jose.ParseSigned(message)
+	if err != nil {
+		return 0
+	}
+	return getHopCount(jwsSignature)
+}
+
+// getHopCount returns the hop count from the protected header of the signature
+func getHopCount(jwsSignature *jose.JSONWebSignature) int {
+	if len(jwsSignature.Signatures) == 0 {
+		return 0
+	}
+	// JSON numbers in the header are decoded as float64
+	hops, _ := jwsSignature.Signatures[0].Protected.ExtraHeaders[HopCountHeader].(float64)
+	return int(hops)
+}
@@ -0,0 +1,79 @@
+package messaging_test
+
+import (
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwardHopCount(t *testing.T) {
+	const addr1 = "test/pub1/node1/switch/0/$latest"
+	const addr2 = "test/pub2/node1/switch/0/$latest"
+	messenger := messaging.NewInMemoryMessenger(&messaging.MessengerConfig{})
+	signer1 := messaging.NewMessageSigner(messenger, messaging.CreateAsymKeys(), nil)
+	signer2 := messaging.NewMessageSigner(messenger, messaging.CreateAsymKeys(), nil)
+	assert.Equal(t, messaging.DefaultMaxHops, signer1.MaxHops())
+	signer2.SetMaxHops(2)
+
+	var rawMessages []string
+	messenger.Subscribe(addr2, func(address string, message string) error {
+		rawMessages = append(rawMessages, message)
+		return nil
+	})
+	receivedHops := make([]int, 0)
+	signer2.SubscribeVerifiedWithHops(addr2, func() interface{} { return &types.OutputLatestMessage{} },
+		func(address string, object interface{}, hops int) error {
+			receivedHops = append(receivedHops, hops)
+			return nil
+		})
+
+	// forwarded messages have an incremented hop count
+	err := signer1.ForwardObject(addr2, &types.OutputLatestMessage{Address: addr2, Value: "1"}, 0)
+	assert.NoError(t, err)
+	err = signer1.ForwardObject(addr2, &types.OutputLatestMessage{Address: addr2, Value: "2"}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, receivedHops)
+	assert.Equal(t, 1, messaging.GetHopCount(rawMessages[0]))
+	assert.Equal(t, 2, messaging.GetHopCount(rawMessages[1]))
+
+	// messages that exceed the max hops of the receiver are dropped
+	err = signer1.ForwardObject(addr2, &types.OutputLatestMessage{Address: addr2, Value: "3"}, 2)
+	assert.NoError(t, err)
+	assert.Len(t, rawMessages, 3)
+	assert.Equal(t, []int{1, 2}, receivedHops)
+
+	// forwarding is refused once the max hops is exceeded
+	err = signer2.ForwardObject(addr1, &types.OutputLatestMessage{Address: addr1, Value: "4"}, 2)
+	assert.Equal(t, messaging.ErrMessageLoop, err)
+
+	// regular publications have no hop count
+	signer1.PublishObject(addr2, false, &types.OutputLatestMessage{Address: addr2, Value: "5"}, nil)
+	assert.Equal(t, 0, messaging.GetHopCount(rawMessages[3]))
+	assert.Equal(t, []int{1, 2, 0}, receivedHops)
+	assert.Equal(t, 0, messaging.GetHopCount("not signed"))
+}
+
+func TestDropOwnForwardedMessage(t *testing.T) {
+	const addr1 = "test/pub1/node1/switch/0/$latest"
+	messenger := messaging.NewInMemoryMessenger(&messaging.MessengerConfig{})
+	signer1 := messaging.NewMessageSigner(messenger, messaging.CreateAsymKeys(), nil)
+	received := 0
+	signer1.SubscribeVerified(addr1, func() interface{} { return &types.OutputLatestMessage{} },
+		func(address string, object interface{}) error {
+			received++
+			return nil
+		})
+
+	// the signer's own publications are received but its own forwarded messages loop
+	signer1.PublishObject(addr1, false, &types.OutputLatestMessage{Address: addr1, Value: "1"}, nil)
+	assert.Equal(t, 1, received)
+	signer1.ForwardObject(addr1, &types.OutputLatestMessage{Address: addr1, Value: "2"}, 0)
+	assert.Equal(t, 1, received)
+
+	// unlimited hops still drops the own forwarded message
+	signer1.SetMaxHops(0)
+	signer1.ForwardObject(addr1, &types.OutputLatestMessage{Address: addr1, Value: "3"}, 100)
+	assert.Equal(t, 1, received)
+}
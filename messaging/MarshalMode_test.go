@@ -0,0 +1,51 @@
+package messaging_test
+
+import (
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalMode(t *testing.T) {
+	const addr1 = "test/pub1/node1/temperature/0/$latest"
+	messenger := messaging.NewInMemoryMessenger(&messaging.MessengerConfig{})
+	signer := messaging.NewMessageSigner(messenger, messaging.CreateAsymKeys(), nil)
+	rxMessage := ""
+	messenger.Subscribe(addr1, func(address string, message string) error {
+		rxMessage = message
+		return nil
+	})
+	latest := &types.OutputLatestMessage{
+		Address:   addr1,
+		Timestamp: "2020-01-01T12:00:00.000+0000",
+		Unit:      types.UnitCelcius,
+		Value:     "21.5",
+	}
+
+	// compact is the default
+	signer.SetSignMessages(false)
+	signer.PublishObject(addr1, false, latest, nil)
+	compact := rxMessage
+	signer.SetMarshalMode(messaging.MarshalIndented)
+	signer.PublishObject(addr1, false, latest, nil)
+	indented := rxMessage
+	assert.NotContains(t, compact, "\n")
+	assert.Contains(t, indented, "\n")
+	assert.Less(t, len(compact), len(indented))
+	t.Logf("Compact message is %d bytes, indented is %d bytes: %d%% smaller",
+		len(compact), len(indented), 100-100*len(compact)/len(indented))
+
+	// both modes are accepted by receivers when signed
+	signer.SetSignMessages(true)
+	for _, mode := range []messaging.MarshalMode{messaging.MarshalCompact, messaging.MarshalIndented} {
+		signer.SetMarshalMode(mode)
+		signer.PublishObject(addr1, false, latest, nil)
+		var received types.OutputLatestMessage
+		isSigned, err := signer.VerifySignedMessage(rxMessage, &received)
+		assert.NoError(t, err)
+		assert.True(t, isSigned)
+		assert.Equal(t, *latest, received)
+	}
+}
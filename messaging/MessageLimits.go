@@ -0,0 +1,84 @@
+// Package messaging - Limits on received messages to protect message parsing against abuse
+package messaging
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// DefaultMaxMessageSize is the default max size in bytes of a received message
+const DefaultMaxMessageSize = 1024 * 1024
+
+// MaxNestingDepth is the max nesting depth of objects and arrays in JSON serialized messages
+const MaxNestingDepth = 32
+
+// ErrMessageTooLarge is returned when a received message exceeds the max message size
+var ErrMessageTooLarge = errors.New("message too large")
+
+// ErrMalformedMessage is returned when a received message is structured in a way that is not
+// accepted, like deeply nested JSON, compressed or nested encryption
+var ErrMalformedMessage = errors.New("malformed message")
+
+// the max message size in use, see SetMaxMessageSize
+var maxMessageSize = DefaultMaxMessageSize
+var maxMessageSizeMutex = &sync.RWMutex{}
+
+// MaxMessageSize returns the max size in bytes of received messages. 0 or less means unlimited.
+func MaxMessageSize() int {
+	maxMessageSizeMutex.RLock()
+	defer maxMessageSizeMutex.RUnlock()
+	return maxMessageSize
+}
+
+// SetMaxMessageSize sets the max size of received messages. Larger messages are rejected with
+// ErrMessageTooLarge before they are decrypted or their signature is parsed.
+// The default is DefaultMaxMessageSize. Use PublishRaw for large payloads.
+//  maxSize is the max size in bytes. Use 0 or less for unlimited.
+func SetMaxMessageSize(maxSize int) {
+	maxMessageSizeMutex.Lock()
+	defer maxMessageSizeMutex.Unlock()
+	maxMessageSize = maxSize
+}
+
+// checkMessageLimits checks a received message against the max message size and, if the message
+// is in JSON serialization, the max nesting depth. Intended to be invoked before parsing.
+// Returns ErrMessageTooLarge or ErrMalformedMessage if the message exceeds the limits
+func checkMessageLimits(message string) error {
+	maxSize := MaxMessageSize()
+	if maxSize > 0 && len(message) > maxSize {
+		return fmt.Errorf("%w: %d bytes exceeds the max of %d", ErrMessageTooLarge, len(message), maxSize)
+	}
+	if !strings.HasPrefix(strings.TrimSpace(message), "{") {
+		return nil
+	}
+	depth := 0
+	inString := false
+	escaped := false
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if inString {
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+			if depth > MaxNestingDepth {
+				return fmt.Errorf("%w: nesting exceeds depth %d", ErrMalformedMessage, MaxNestingDepth)
+			}
+		case '}', ']':
+			depth--
+		}
+	}
+	return nil
+}
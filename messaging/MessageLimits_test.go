@@ -0,0 +1,140 @@
+package messaging_test
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestMaxMessageSize(t *testing.T) {
+	privKey := messaging.CreateAsymKeys()
+	getPubKey := func(address string) *ecdsa.PublicKey {
+		return &privKey.PublicKey
+	}
+	payload, _ := json.Marshal(testObject)
+	signed, err := messaging.CreateJWSSignature(string(payload), privKey)
+	require.NoError(t, err)
+	assert.Equal(t, messaging.DefaultMaxMessageSize, messaging.MaxMessageSize())
+
+	// messages larger than the limit are rejected before parsing
+	messaging.SetMaxMessageSize(len(signed) - 1)
+	defer messaging.SetMaxMessageSize(messaging.DefaultMaxMessageSize)
+	var received TestObjectWithSender
+	result := messaging.VerifySignatureDetailed(signed, &received, getPubKey, messaging.DefaultAllowedAlgorithms)
+	assert.True(t, errors.Is(result.Err, messaging.ErrMessageTooLarge))
+	assert.False(t, result.IsSigned)
+	_, err = messaging.VerifyJWSMessage(signed, &privKey.PublicKey)
+	assert.True(t, errors.Is(err, messaging.ErrMessageTooLarge))
+
+	messenger := messaging.NewInMemoryMessenger(&messaging.MessengerConfig{})
+	signer := messaging.NewMessageSigner(messenger, privKey, getPubKey)
+	_, _, err = signer.DecodeMessage(signed, &received)
+	assert.True(t, errors.Is(err, messaging.ErrMessageTooLarge))
+
+	// unlimited
+	messaging.SetMaxMessageSize(0)
+	_, err = messaging.VerifyJWSMessage(signed, &privKey.PublicKey)
+	assert.NoError(t, err)
+
+	// deeply nested JSON is rejected
+	nested := strings.Repeat("[", messaging.MaxNestingDepth+1) + strings.Repeat("]", messaging.MaxNestingDepth+1)
+	result = messaging.VerifySignatureDetailed(`{"address":`+nested+`}`, &received, nil, nil)
+	assert.True(t, errors.Is(result.Err, messaging.ErrMalformedMessage))
+	// brackets in strings don't count
+	result = messaging.VerifySignatureDetailed(`{"address":"`+nested+`"}`, &received, nil, nil)
+	assert.NoError(t, result.Err)
+}
+
+func TestMalformedEncryption(t *testing.T) {
+	privKey := messaging.CreateAsymKeys()
+	payload, _ := json.Marshal(testObject)
+
+	// nested encryption
+	encrypted, err := messaging.EncryptMessage(string(payload), &privKey.PublicKey)
+	require.NoError(t, err)
+	twice, err := messaging.EncryptMessage(encrypted, &privKey.PublicKey)
+	require.NoError(t, err)
+	_, isEncrypted, err := messaging.DecryptMessage(twice, privKey)
+	assert.True(t, isEncrypted)
+	assert.True(t, errors.Is(err, messaging.ErrMalformedMessage))
+
+	// compressed
+	recipient := jose.Recipient{Algorithm: jose.ECDH_ES, Key: &privKey.PublicKey}
+	encrypter, err := jose.NewEncrypter(jose.A128CBC_HS256, recipient,
+		&jose.EncrypterOptions{Compression: jose.DEFLATE})
+	require.NoError(t, err)
+	jwe, err := encrypter.Encrypt(payload)
+	require.NoError(t, err)
+	compressed, _ := jwe.CompactSerialize()
+	_, isEncrypted, err = messaging.DecryptMessage(compressed, privKey)
+	assert.True(t, isEncrypted)
+	assert.True(t, errors.Is(err, messaging.ErrMalformedMessage))
+
+	// encrypted once is okay
+	message, isEncrypted, err := messaging.DecryptMessage(encrypted, privKey)
+	assert.NoError(t, err)
+	assert.True(t, isEncrypted)
+	assert.Equal(t, string(payload), message)
+}
+
+// Feed malformed serializations derived from valid messages to the verification path. None of
+// them may panic or be accepted as verified.
+func TestFuzzMalformedMessages(t *testing.T) {
+	privKey := messaging.CreateAsymKeys()
+	getPubKey := func(address string) *ecdsa.PublicKey {
+		return &privKey.PublicKey
+	}
+	messenger := messaging.NewInMemoryMessenger(&messaging.MessengerConfig{})
+	signer := messaging.NewMessageSigner(messenger, privKey, getPubKey)
+	payload, _ := json.Marshal(testObject)
+	signed, _ := messaging.CreateJWSSignature(string(payload), privKey)
+	encrypted, _ := messaging.EncryptMessage(signed, &privKey.PublicKey)
+	seeds := []string{signed, encrypted, string(payload), "{}", "..", "....", "{\"protected\":\"\"}"}
+	alphabet := []byte("{}[]\".,:\\-_=+/aZ09")
+	random := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 2000; i++ {
+		message := []byte(seeds[random.Intn(len(seeds))])
+		switch random.Intn(4) {
+		case 0:
+			// truncate
+			message = message[:random.Intn(len(message)+1)]
+		case 1:
+			// replace characters
+			for n := random.Intn(5); n >= 0 && len(message) > 0; n-- {
+				message[random.Intn(len(message))] = alphabet[random.Intn(len(alphabet))]
+			}
+		case 2:
+			// insert characters
+			for n := random.Intn(5); n >= 0; n-- {
+				index := random.Intn(len(message) + 1)
+				message = append(message[:index], append([]byte{alphabet[random.Intn(len(alphabet))]},
+					message[index:]...)...)
+			}
+		case 3:
+			// nest
+			depth := random.Intn(2 * messaging.MaxNestingDepth)
+			message = []byte(strings.Repeat("{\"a\":", depth) + string(message) + strings.Repeat("}", depth))
+		}
+		var received TestObjectWithSender
+		assert.NotPanics(t, func() {
+			result := messaging.VerifySignatureDetailed(string(message), &received, getPubKey,
+				messaging.DefaultAllowedAlgorithms)
+			if string(message) != signed {
+				assert.False(t, result.Verified, "Malformed message '%s' is verified", message)
+			}
+			signer.DecodeMessage(string(message), &received)
+			messaging.DecryptMessage(string(message), privKey)
+			messaging.GetHopCount(string(message))
+			messaging.VerifyJWSMulti(string(message), []*ecdsa.PublicKey{&privKey.PublicKey}, 1)
+		}, "Message '%s' panics", message)
+	}
+}
@@ -2,6 +2,7 @@
 package messaging
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/sha256"
@@ -11,29 +12,116 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sync"
+	"sync/atomic"
 
 	"github.com/iotdomain/iotdomain-go/types"
-	"github.com/sirupsen/logrus"
 	"gopkg.in/square/go-jose.v2"
 )
 
+// MarshalMode determines the JSON formatting of published objects
+type MarshalMode int
+
+// Marshal modes of published objects
+const (
+	// MarshalCompact marshals objects without whitespace. This is the default.
+	MarshalCompact MarshalMode = iota
+	// MarshalIndented marshals objects with indentation, intended for debugging
+	MarshalIndented
+)
+
 // MessageSigner for signing and verifying of signed and encrypted messages
 type MessageSigner struct {
+	// counter of the counter nonce mode, see SetNonceMode. First field for 64-bit atomic alignment.
+	nonceCounter uint64
 	// GetPublicKey when available is used in mess to verify signature
-	GetPublicKey func(address string) *ecdsa.PublicKey // must be a variable
-	messenger    IMessenger
-	signMessages bool              // flag, sign outgoing messages. Default is true. Disable for testing
-	privateKey   *ecdsa.PrivateKey // private key for signing and decryption
+	GetPublicKey   func(address string) *ecdsa.PublicKey // must be a variable
+	messenger      IMessenger
+	clock          Clock             // clock for timestamps of published messages
+	deduplicator   *Deduplicator     // optional deduplication of received messages
+	logger         ILogger           // logger for signing and verification activity
+	marshalMode    MarshalMode       // JSON formatting of published objects
+	maxHops        int               // max nr of times a message can be forwarded, see SetMaxHops
+	metrics        atomic.Value      // metricsRef with the optional metrics of messaging activity
+	nonceMode      atomic.Value      // NonceMode to include in signatures, see SetNonceMode
+	permissive     bool              // accept unsigned messages and unknown senders, see SetPermissive
+	rateLimiter    *RateLimiter      // optional rate limiter of publications
+	retryQueue     *RetryQueue       // optional queue of failed publications for retry
+	retryOnConnect bool              // the retry of publications is added to the messenger's connect handlers
+	signMessages   bool              // flag, sign outgoing messages. Default is true. Disable for testing
+	signingKey     crypto.Signer     // optional key for signing instead of the private key, see SetSigningKey
+	privateKey     *ecdsa.PrivateKey // private key for signing and decryption
+	// signature algorithms accepted on verification
+	allowedAlgorithms []string
+	algorithmMutex    *sync.RWMutex // mutex for concurrent updates of the allowed algorithms
+	// retained flag by message type for publications that use the retained policy
+	retainedPolicy map[types.MessageType]bool
+	policyMutex    *sync.RWMutex // mutex for concurrent updates of the retained policy
+	// segments of the address patterns of trusted messages that skip verification
+	unverifiedAddresses [][]string
+	unverifiedMutex     *sync.RWMutex // mutex for concurrent updates of the unverified addresses
+	// subscriptions made through the signer for use by UnsubscribeAll
+	subscriptions     []signerSubscription
+	subscriptionCount SubscriptionID // nr of subscriptions made, to identify subscriptions
+	subscriptionMutex *sync.Mutex
+}
+
+// signerSubscription is a subscription made through the signer
+type signerSubscription struct {
+	id      SubscriptionID
+	address string
+	handler func(address string, message string) error
+	// handler subscribed to the messenger. This differs from handler when deduplicating.
+	messengerHandler func(address string, message string) error
+	// ID of the subscription with the messenger, if the messenger supports ISubscriptionIDs
+	messengerID SubscriptionID
 }
 
 // DecodeMessage decrypts the message and verifies the sender signature .
 // The sender and signer of the message is contained the message 'sender' field. If the
 // Sender field is missing then the 'address' field is used as sender.
 // object must hold the expected message type to decode the json message containging the sender info
+// Messages that exceed the limits of SetMaxMessageSize are rejected before they are decrypted.
+// Verification is strict. A signed message from an unknown sender returns ErrUnknownSender.
+// Use DecodeMessageOnAddress to skip verification of messages on unverified addresses.
 func (signer *MessageSigner) DecodeMessage(rawMessage string, object interface{}) (isEncrypted bool, isSigned bool, err error) {
+	isEncrypted, result := signer.DecodeMessageDetailed(rawMessage, object)
+	return isEncrypted, result.IsSigned, result.Err
+}
+
+// DecodeMessageDetailed decrypts and verifies the message like DecodeMessage and returns the
+// verification result, including the trust level of the message.
+func (signer *MessageSigner) DecodeMessageDetailed(rawMessage string, object interface{}) (
+	isEncrypted bool, result SignatureVerification) {
+
+	if result.Err = checkMessageLimits(rawMessage); result.Err != nil {
+		return false, result
+	}
+	// DecryptMessage also returns an error for messages that aren't encrypted
 	dmessage, isEncrypted, err := DecryptMessage(rawMessage, signer.privateKey)
-	isSigned, err = VerifySenderJWSSignature(dmessage, object, signer.GetPublicKey)
-	return isEncrypted, isSigned, err
+	if isEncrypted && err != nil {
+		if metrics := signer.getMetrics(); metrics != nil {
+			metrics.IncDecryptFailed()
+		}
+		signer.countReceived(err)
+		result.Err = err
+		return isEncrypted, result
+	}
+	result = signer.VerifySignedMessageDetailed(dmessage, object)
+	return isEncrypted, result
+}
+
+// Clock returns the clock used for timestamps of published messages
+func (signer *MessageSigner) Clock() Clock {
+	return signer.clock
+}
+
+// IsPermissive returns whether subscriptions made with SubscribeWithTrust accept unsigned messages
+// and messages from unknown senders
+func (signer *MessageSigner) IsPermissive() bool {
+	signer.policyMutex.RLock()
+	defer signer.policyMutex.RUnlock()
+	return signer.permissive
 }
 
 // SignMessages returns whether messages MUST be signed on sending or receiving
@@ -45,17 +133,148 @@ func (signer *MessageSigner) SignMessages() bool {
 // as per standard, the sender and signer of the message is in the message 'Sender' field. If the
 // Sender field is missing then the 'address' field contains the publisher.
 //  or 'address' field
+// Use VerifySignedMessageOnAddress to skip verification of messages on unverified addresses.
 func (signer *MessageSigner) VerifySignedMessage(rawMessage string, object interface{}) (isSigned bool, err error) {
-	isSigned, err = VerifySenderJWSSignature(rawMessage, object, signer.GetPublicKey)
-	return isSigned, err
+	result := signer.VerifySignedMessageDetailed(rawMessage, object)
+	return result.IsSigned, result.Err
+}
+
+// Logger returns the logger used by the signer
+func (signer *MessageSigner) Logger() ILogger {
+	return signer.logger
+}
+
+// countReceived counts a received message and its verification failure
+func (signer *MessageSigner) countReceived(verifyErr error) {
+	metrics := signer.getMetrics()
+	if metrics != nil {
+		metrics.IncReceived()
+		if verifyErr != nil {
+			metrics.IncVerifyFailed()
+		}
+	}
+}
+
+// getMetrics returns the optional metrics, or nil if no metrics are set
+func (signer *MessageSigner) getMetrics() IMetrics {
+	ref, _ := signer.metrics.Load().(metricsRef)
+	return ref.metrics
+}
+
+// limitRate waits for the rate limiter to allow publication on the address
+// This returns ErrRateLimited if the publication is dropped.
+func (signer *MessageSigner) limitRate(address string) error {
+	if signer.rateLimiter == nil {
+		return nil
+	}
+	metrics, _ := signer.getMetrics().(IRateMetrics)
+	delay, err := signer.rateLimiter.Wait(address)
+	if err != nil {
+		signer.logger.Warningf("MessageSigner.limitRate: Publication to %s dropped: %s", address, err)
+		if metrics != nil {
+			metrics.IncRateDropped()
+		}
+	} else if delay > 0 && metrics != nil {
+		metrics.IncRateDelayed()
+	}
+	return err
+}
+
+// dropDuplicates returns a handler that passes messages to the given handler unless they are
+// duplicates of messages received on the same subscription.
+func (signer *MessageSigner) dropDuplicates(id SubscriptionID, handler func(address string, message string) error,
+	dedup *Deduplicator) func(address string, message string) error {
+
+	subscription := fmt.Sprint(id)
+	return func(address string, message string) error {
+		if dedup.IsDuplicate(subscription+"/"+address, message) {
+			signer.logger.Infof("MessageSigner: Duplicate message on %s dropped", address)
+			if counter, ok := signer.getMetrics().(IDuplicateMetrics); ok {
+				counter.IncDuplicateDropped()
+			}
+			return ErrDuplicateMessage
+		}
+		return handler(address, message)
+	}
+}
+
+// countPublished counts a published message and whether it was signed
+func (signer *MessageSigner) countPublished(isSigned bool, publishErr error) {
+	metrics := signer.getMetrics()
+	if metrics != nil && publishErr == nil {
+		metrics.IncPublished()
+		if isSigned {
+			metrics.IncSigned()
+		}
+	}
+}
+
+// queueFailed adds a publication that failed to the retry queue if a queue is set
+func (signer *MessageSigner) queueFailed(address string, retained bool, message string, publishErr error) {
+	queue := signer.retryQueue
+	if queue == nil || publishErr == nil {
+		return
+	}
+	metrics, _ := signer.getMetrics().(IRetryMetrics)
+	if queue.Add(address, retained, message) {
+		signer.logger.Warningf("MessageSigner.queueFailed: Retry queue is full. A publication is dropped")
+		if metrics != nil {
+			metrics.IncRetryDropped()
+		}
+	}
+	if metrics != nil {
+		metrics.SetRetryQueueDepth(queue.Depth())
+	}
+}
+
+// retryPublications publishes the queued publications
+//  force retries regardless of the backoff delay
+func (signer *MessageSigner) retryPublications(force bool) int {
+	queue := signer.retryQueue
+	if queue == nil {
+		return 0
+	}
+	count, err := queue.Retry(signer.retryPublish, signer.clock.Now(), force)
+	for i := 0; i < count; i++ {
+		signer.countPublished(signer.signMessages, nil)
+	}
+	if err != nil {
+		signer.logger.Infof("MessageSigner.retryPublications: Retry failed, %d publications remaining: %s",
+			queue.Depth(), err)
+	}
+	if metrics, ok := signer.getMetrics().(IRetryMetrics); ok {
+		metrics.SetRetryQueueDepth(queue.Depth())
+	}
+	return count
+}
+
+// retryPublish publishes a queued publication subject to the rate limiter. A publication that
+// exceeds the rate limit remains queued for the next retry.
+func (signer *MessageSigner) retryPublish(address string, retained bool, message string) error {
+	if signer.rateLimiter != nil {
+		delay, err := signer.rateLimiter.Wait(address)
+		if err != nil {
+			return err
+		} else if metrics, ok := signer.getMetrics().(IRateMetrics); delay > 0 && ok {
+			metrics.IncRateDelayed()
+		}
+	}
+	return signer.messenger.Publish(address, retained, message)
+}
+
+// marshal marshals the object to JSON using the signer's marshal mode
+func (signer *MessageSigner) marshal(object interface{}) ([]byte, error) {
+	if signer.marshalMode == MarshalIndented {
+		return json.MarshalIndent(object, " ", " ")
+	}
+	return json.Marshal(object)
 }
 
 // PublishObject encapsulates the message object in a payload, signs the message, and sends it.
 //  If an encryption key is provided then the signed message will be encrypted.
 //  The object to publish will be marshalled to JSON and signed by this publisher
 func (signer *MessageSigner) PublishObject(address string, retained bool, object interface{}, encryptionKey *ecdsa.PublicKey) error {
-	// payload, err := json.Marshal(object)
-	payload, err := json.MarshalIndent(object, " ", " ")
+	payload, err := signer.marshal(object)
 	if err != nil || object == nil {
 		errText := fmt.Sprintf("Publisher.publishMessage: Error marshalling message for address %s: %s", address, err)
 		return errors.New(errText)
@@ -68,37 +287,247 @@ func (signer *MessageSigner) PublishObject(address string, retained bool, object
 	return err
 }
 
+// RetryPublications retries the publications in the retry queue once their backoff delay has passed
+// This is invoked periodically by the publisher heartbeat. See also SetRetryQueue.
+// Returns the nr of publications that are published
+func (signer *MessageSigner) RetryPublications() int {
+	return signer.retryPublications(false)
+}
+
+// SignObject marshals the object to JSON and signs it, if signing is enabled.
+//  Intended for messages that are published on behalf of the publisher, like the last will and testament.
+func (signer *MessageSigner) SignObject(object interface{}) (message string, err error) {
+	payload, err := signer.marshal(object)
+	if err != nil || object == nil {
+		return "", fmt.Errorf("MessageSigner.SignObject: Error marshalling message: %s", err)
+	}
+	message = string(payload)
+	if signer.signMessages {
+		message, err = signer.signPayload(message, 0)
+	}
+	return message, err
+}
+
+// SignIdentity signs the public identity with the signer's key, using the same algorithm as the
+// signer uses for messages.
+func (signer *MessageSigner) SignIdentity(publicIdent *types.PublisherIdentityMessage) error {
+	signingKey := signer.getSigningKey()
+	if signingKey == nil {
+		return errors.New("MessageSigner.SignIdentity: Signer has no private key")
+	}
+	return SignIdentityWithKey(publicIdent, signingKey)
+}
+
+// getSigningKey returns the key for signing messages and identities, or nil if the signer has no key
+func (signer *MessageSigner) getSigningKey() crypto.Signer {
+	if signer.signingKey != nil {
+		return signer.signingKey
+	}
+	if signer.privateKey != nil {
+		return signer.privateKey
+	}
+	return nil
+}
+
+// SetClock sets the clock used for timestamps of published messages and for the deduplicator of
+// received messages. Use nil for the system time. Intended for testing of time dependent behavior.
+func (signer *MessageSigner) SetClock(clock Clock) {
+	if clock == nil {
+		clock = RealClock
+	}
+	signer.clock = clock
+	signer.subscriptionMutex.Lock()
+	defer signer.subscriptionMutex.Unlock()
+	if signer.deduplicator != nil {
+		signer.deduplicator.SetClock(clock)
+	}
+}
+
+// SetDeduplicator sets the optional deduplicator of received messages. Duplicate messages are dropped
+// before they reach the subscription handler. This applies to subsequent subscriptions. Use nil to disable.
+func (signer *MessageSigner) SetDeduplicator(dedup *Deduplicator) {
+	signer.subscriptionMutex.Lock()
+	defer signer.subscriptionMutex.Unlock()
+	signer.deduplicator = dedup
+}
+
+// SetLogger sets the logger for signing and verification activity. Use nil for the default logger.
+func (signer *MessageSigner) SetLogger(logger ILogger) {
+	if logger == nil {
+		logger = DefaultLogger()
+	}
+	signer.logger = logger
+}
+
+// SetMarshalMode sets the JSON formatting of published objects. The default is MarshalCompact.
+// Receivers accept both formats, but the formatting is part of the signed payload so receivers that
+// compare payloads, eg for deduplication, must use the same mode throughout the domain.
+func (signer *MessageSigner) SetMarshalMode(mode MarshalMode) {
+	signer.marshalMode = mode
+}
+
+// SetMetrics sets the optional metrics for counting messaging activity. Use nil to disable.
+// The metrics can be replaced while messages are published.
+func (signer *MessageSigner) SetMetrics(metrics IMetrics) {
+	signer.metrics.Store(metricsRef{metrics: metrics})
+}
+
+// SetPermissive enables or disables permissive verification. Intended for domains that migrate
+// to signed messages. Permissive mode only applies to subscriptions made with SubscribeWithTrust,
+// which then accept messages from senders whose public key is unknown, and unsigned messages,
+// with their trust level. All other subscriptions and DecodeMessage, including the handlers of
+// commands, remain strict. Messages with an invalid signature are always rejected. The default is
+// strict verification.
+func (signer *MessageSigner) SetPermissive(permissive bool) {
+	signer.policyMutex.Lock()
+	defer signer.policyMutex.Unlock()
+	signer.permissive = permissive
+}
+
+// SetRateLimiter sets the optional rate limiter of publications. Use nil to disable.
+func (signer *MessageSigner) SetRateLimiter(limiter *RateLimiter) {
+	signer.rateLimiter = limiter
+}
+
+// SetRetryQueue sets the optional queue that buffers publications that failed, eg while the
+// connection is lost. Queued publications are retried when the messenger reconnects and by
+// RetryPublications. This adds a connect handler to the messenger. Use nil to disable.
+func (signer *MessageSigner) SetRetryQueue(queue *RetryQueue) {
+	signer.retryQueue = queue
+	if queue != nil && !signer.retryOnConnect {
+		signer.retryOnConnect = true
+		signer.messenger.OnConnect(func() {
+			signer.retryPublications(true)
+		})
+	}
+}
+
 // SetSignMessages enables or disables message signing. Intended for testing.
 func (signer *MessageSigner) SetSignMessages(sign bool) {
 	signer.signMessages = sign
 }
 
+// SetSigningKey sets the key for signing messages and identities instead of the signer's private
+// key, eg an Ed25519 key to sign with EdDSA. The private key is still used for decryption.
+//  signingKey is an ECDSA or Ed25519 private key. Use nil to sign with the private key.
+// Returns an error if the key type isn't supported.
+func (signer *MessageSigner) SetSigningKey(signingKey crypto.Signer) error {
+	if signingKey != nil {
+		if _, err := JWSAlgorithm(signingKey); err != nil {
+			return err
+		}
+	}
+	signer.signingKey = signingKey
+	return nil
+}
+
 // Subscribe to messages on the given address
+// If a deduplicator is set then duplicate messages are dropped before they reach the handler.
+// Returns the ID of the subscription for use with UnsubscribeByID
 func (signer *MessageSigner) Subscribe(
 	address string,
-	handler func(address string, message string) error) {
-	signer.messenger.Subscribe(address, handler)
+	handler func(address string, message string) error) SubscriptionID {
+	signer.subscriptionMutex.Lock()
+	signer.subscriptionCount++
+	sub := signerSubscription{id: signer.subscriptionCount, address: address, handler: handler, messengerHandler: handler}
+	if signer.deduplicator != nil {
+		sub.messengerHandler = signer.dropDuplicates(sub.id, handler, signer.deduplicator)
+	}
+	signer.subscriptionMutex.Unlock()
+
+	// retained messages can be delivered while subscribing so don't hold the lock
+	if idMessenger, ok := signer.messenger.(ISubscriptionIDs); ok {
+		sub.messengerID = idMessenger.SubscribeWithID(address, sub.messengerHandler)
+	} else {
+		signer.messenger.Subscribe(address, sub.messengerHandler)
+	}
+	signer.subscriptionMutex.Lock()
+	signer.subscriptions = append(signer.subscriptions, sub)
+	signer.subscriptionMutex.Unlock()
+	return sub.id
 }
 
 // Unsubscribe to messages on the given address
+// Handlers are compared by their function pointer. Closures of the same function literal and method
+// values of the same method on different instances can't be told apart, in which case the first
+// matching subscription is removed. Use UnsubscribeByID to remove a specific subscription.
 func (signer *MessageSigner) Unsubscribe(
 	address string,
 	handler func(address string, message string) error) {
+	signer.subscriptionMutex.Lock()
+	for index, sub := range signer.subscriptions {
+		// functions can't be compared directly so compare their pointers
+		if sub.address == address && reflect.ValueOf(sub.handler).Pointer() == reflect.ValueOf(handler).Pointer() {
+			signer.subscriptions = append(signer.subscriptions[:index], signer.subscriptions[index+1:]...)
+			signer.subscriptionMutex.Unlock()
+			signer.unsubscribe(sub)
+			return
+		}
+	}
+	signer.subscriptionMutex.Unlock()
+	// not subscribed through the signer
 	signer.messenger.Unsubscribe(address, handler)
 }
 
+// UnsubscribeAll removes all subscriptions that were made through this signer
+// Intended for an orderly shutdown.
+func (signer *MessageSigner) UnsubscribeAll() {
+	signer.subscriptionMutex.Lock()
+	subscriptions := signer.subscriptions
+	signer.subscriptions = nil
+	signer.subscriptionMutex.Unlock()
+	for _, sub := range subscriptions {
+		signer.unsubscribe(sub)
+	}
+}
+
+// UnsubscribeByID removes the subscription with the ID returned by Subscribe
+// Unknown IDs are ignored.
+func (signer *MessageSigner) UnsubscribeByID(id SubscriptionID) {
+	signer.subscriptionMutex.Lock()
+	for index, sub := range signer.subscriptions {
+		if sub.id == id {
+			signer.subscriptions = append(signer.subscriptions[:index], signer.subscriptions[index+1:]...)
+			signer.subscriptionMutex.Unlock()
+			signer.unsubscribe(sub)
+			return
+		}
+	}
+	signer.subscriptionMutex.Unlock()
+}
+
+// unsubscribe removes a subscription from the messenger
+func (signer *MessageSigner) unsubscribe(sub signerSubscription) {
+	if idMessenger, ok := signer.messenger.(ISubscriptionIDs); ok && sub.messengerID != 0 {
+		idMessenger.UnsubscribeByID(sub.messengerID)
+	} else {
+		signer.messenger.Unsubscribe(sub.address, sub.messengerHandler)
+	}
+}
+
 // PublishEncrypted sign and encrypts the payload and publish the resulting message on the given address
 // Signing only happens if the publisher's signingMethod is set to SigningMethodJWS
 func (signer *MessageSigner) PublishEncrypted(
 	address string, retained bool, payload string, publicKey *ecdsa.PublicKey) error {
-	var err error
+	err := signer.limitRate(address)
+	if err != nil {
+		return err
+	}
 	message := payload
 	// first sign, then encrypt as per RFC
 	if signer.signMessages {
-		message, _ = CreateJWSSignature(string(payload), signer.privateKey)
+		message, _ = signer.signPayload(string(payload), 0)
 	}
 	emessage, err := EncryptMessage(message, publicKey)
+	if err != nil {
+		signer.logger.Errorf("MessageSigner.PublishEncrypted: Error encrypting message for address %s: %s", address, err)
+		if metrics := signer.getMetrics(); metrics != nil {
+			metrics.IncEncryptFailed()
+		}
+	}
 	err = signer.messenger.Publish(address, retained, emessage)
+	signer.countPublished(signer.signMessages, err)
+	signer.queueFailed(address, retained, emessage, err)
 	return err
 }
 
@@ -106,32 +535,72 @@ func (signer *MessageSigner) PublishEncrypted(
 // Signing only happens if the publisher's signingMethod is set to SigningMethodJWS
 func (signer *MessageSigner) PublishSigned(
 	address string, retained bool, payload string) error {
-	var err error
+	return signer.publishSigned(address, retained, payload, 0)
+}
+
+// publishSigned signs the payload with the hop count in the signature header and publishes it
+//  hops is the nr of times the message was forwarded. 0 for messages that aren't forwarded
+func (signer *MessageSigner) publishSigned(
+	address string, retained bool, payload string, hops int) error {
+	err := signer.limitRate(address)
+	if err != nil {
+		return err
+	}
 
 	// default is unsigned
 	message := payload
 
 	if signer.signMessages {
-		message, err = CreateJWSSignature(string(payload), signer.privateKey)
+		message, err = signer.signPayload(string(payload), hops)
 		if err != nil {
-			logrus.Errorf("Publisher.publishMessage: Error signing message for address %s: %s", address, err)
+			signer.logger.Errorf("MessageSigner.PublishSigned: Error signing message for address %s: %s", address, err)
 		}
 	}
+	isSigned := signer.signMessages && err == nil
 	err = signer.messenger.Publish(address, retained, message)
+	signer.countPublished(isSigned, err)
+	signer.queueFailed(address, retained, message, err)
 	return err
 }
 
+// signPayload signs the payload with the signer's key, including the hop count and the nonce in
+// the signature header when applicable.
+//  hops is the nr of times the message was forwarded. The header is omitted if 0.
+func (signer *MessageSigner) signPayload(payload string, hops int) (string, error) {
+	headers := make(map[jose.HeaderKey]interface{})
+	if hops > 0 {
+		headers[HopCountHeader] = hops
+	}
+	if nonce := signer.nextNonce(); nonce != "" {
+		headers[NonceHeader] = nonce
+	}
+	return createJWSSignature(payload, signer.getSigningKey(), headers)
+}
+
 // NewMessageSigner creates a new instance for signing and verifying published messages
 // If getPublicKey is not provided, verification of signature is skipped
 func NewMessageSigner(messenger IMessenger, signingKey *ecdsa.PrivateKey,
 	getPublicKey func(address string) *ecdsa.PublicKey,
 ) *MessageSigner {
 
+	retainedPolicy := make(map[types.MessageType]bool)
+	for messageType, retained := range DefaultRetainedPolicy {
+		retainedPolicy[messageType] = retained
+	}
 	signer := &MessageSigner{
-		GetPublicKey: getPublicKey,
-		messenger:    messenger,
-		signMessages: true,
-		privateKey:   signingKey, // private key for signing
+		GetPublicKey:      getPublicKey,
+		allowedAlgorithms: append([]string{}, DefaultAllowedAlgorithms...),
+		clock:             RealClock,
+		logger:            DefaultLogger(),
+		maxHops:           DefaultMaxHops,
+		messenger:         messenger,
+		signMessages:      true,
+		privateKey:        signingKey, // private key for signing
+		algorithmMutex:    &sync.RWMutex{},
+		policyMutex:       &sync.RWMutex{},
+		unverifiedMutex:   &sync.RWMutex{},
+		retainedPolicy:    retainedPolicy,
+		subscriptionMutex: &sync.Mutex{},
 	}
 	return signer
 }
@@ -155,18 +624,40 @@ func CreateEcdsaSignature(payload []byte, privateKey *ecdsa.PrivateKey) string {
 	return base64.URLEncoding.EncodeToString(sig)
 }
 
-// SignIdentity updates the base64URL encoded ECDSA256 signature of the public identity
-func SignIdentity(publicIdent *types.PublisherIdentityMessage, privKey *ecdsa.PrivateKey) {
-	identCopy := *publicIdent
-	identCopy.IdentitySignature = ""
-	payload, _ := json.Marshal(identCopy)
-	sigStr := CreateEcdsaSignature(payload, privKey)
-	publicIdent.IdentitySignature = sigStr
+// SignIdentity updates the base64URL encoded ECDSA signature of the public identity
+// See also SignIdentityWithKey for other key types.
+// Returns an error if the key is missing or signing fails. The signature is cleared if the key is missing.
+func SignIdentity(publicIdent *types.PublisherIdentityMessage, privKey *ecdsa.PrivateKey) error {
+	if privKey == nil {
+		publicIdent.IdentitySignature = ""
+		return errors.New("SignIdentity: Missing private key")
+	}
+	return SignIdentityWithKey(publicIdent, privKey)
 }
 
-// CreateJWSSignature signs the payload using JSE ES256 and return the JSE compact serialized message
+// CreateJWSSignature signs the payload using JWS and return the JWS compact serialized message
+// The signature algorithm is determined by the key, eg ES256 for P-256 keys. See JWSAlgorithm.
 func CreateJWSSignature(payload string, privateKey *ecdsa.PrivateKey) (string, error) {
-	joseSigner, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: privateKey}, nil)
+	return createJWSSignature(payload, privateKey, nil)
+}
+
+// createJWSSignature signs the payload using JWS with additional headers in the protected header
+//  privateKey is an ECDSA or Ed25519 private key
+//  headers to include, eg the hop count and nonce. Use nil for none.
+func createJWSSignature(payload string, privateKey crypto.Signer, headers map[jose.HeaderKey]interface{}) (
+	string, error) {
+	algorithm, err := JWSAlgorithm(privateKey)
+	if err != nil {
+		return "", err
+	}
+	var options *jose.SignerOptions
+	for key, value := range headers {
+		if options == nil {
+			options = &jose.SignerOptions{}
+		}
+		options.WithHeader(key, value)
+	}
+	joseSigner, err := jose.NewSigner(jose.SigningKey{Algorithm: algorithm, Key: privateKey}, options)
 	if err != nil {
 		return "", err
 	}
@@ -180,13 +671,24 @@ func CreateJWSSignature(payload string, privateKey *ecdsa.PrivateKey) (string, e
 }
 
 // DecryptMessage deserializes and decrypts the message using JWE
+// Compressed messages and messages that are encrypted more than once are rejected with
+// ErrMalformedMessage, as they are never published by this library.
 // This returns the decrypted message, or the input message if the message was not encrypted
 func DecryptMessage(serialized string, privateKey *ecdsa.PrivateKey) (message string, isEncrypted bool, err error) {
 	message = serialized
 	decrypter, err := jose.ParseEncrypted(serialized)
 	if err == nil {
+		// decompression happens before the size of the message can be checked
+		if _, isCompressed := decrypter.Header.ExtraHeaders["zip"]; isCompressed {
+			return message, true, fmt.Errorf("DecryptMessage: %w: compressed message", ErrMalformedMessage)
+		}
 		dmessage, err := decrypter.Decrypt(privateKey)
 		message = string(dmessage)
+		if err == nil {
+			if _, err2 := jose.ParseEncrypted(message); err2 == nil {
+				return message, true, fmt.Errorf("DecryptMessage: %w: nested encryption", ErrMalformedMessage)
+			}
+		}
 		return message, true, err
 	}
 	return message, false, err
@@ -210,24 +712,10 @@ func EncryptMessage(message string, publicKey *ecdsa.PublicKey) (serialized stri
 	return serialized, err
 }
 
-// VerifyIdentitySignature verifies a base64URL encoded ECDSA256 signature in the identity
-// against the identity itself using the sender's public key.
+// VerifyIdentitySignature verifies a base64URL encoded ECDSA signature in the identity
+// against the identity itself using the sender's public key. See also VerifyIdentity.
 func VerifyIdentitySignature(ident *types.PublisherIdentityMessage, pubKey *ecdsa.PublicKey) error {
-	// the signing took place with the signature field empty
-	identCopy := *ident
-	identCopy.IdentitySignature = ""
-	payload, _ := json.Marshal(identCopy)
-
-	err := VerifyEcdsaSignature(payload, ident.IdentitySignature, pubKey)
-
-	// signingKey := jose.SigningKey{Algorithm: jose.ES256, Key: privKey}
-	// joseSigner, _ := jose.NewSigner(signingKey, nil)
-
-	// jwsObject, _ := joseSigner.Verify(payload)
-	// sig := jwsObject.Signatures[0].Signature
-	// sigStr := base64.URLEncoding.EncodeToString(sig)
-	// return sigStr
-	return err
+	return VerifyIdentity(ident, pubKey)
 }
 
 // VerifyEcdsaSignature the payload using the base64url encoded signature and public key
@@ -266,6 +754,9 @@ func VerifyJWSMessage(message string, publicKey *ecdsa.PublicKey) (payload strin
 		err := errors.New("VerifyJWSMessage: public key is nil")
 		return "", err
 	}
+	if err = checkMessageLimits(message); err != nil {
+		return "", err
+	}
 	jwsSignature, err := jose.ParseSigned(message)
 	if err != nil {
 		return "", err
@@ -285,53 +776,18 @@ func VerifyJWSMessage(message string, publicKey *ecdsa.PublicKey) (payload strin
 //  If not provided then signature verification will succeed.
 //
 // The rawMessage is json unmarshalled into the given object.
+// Signed messages must use one of the DefaultAllowedAlgorithms, see VerifySenderJWSSignatureAlg.
 //
 // This returns a flag if the message was signed and if so, an error if the verification failed
 func VerifySenderJWSSignature(rawMessage string, object interface{}, getPublicKey func(address string) *ecdsa.PublicKey) (isSigned bool, err error) {
+	return VerifySenderJWSSignatureAlg(rawMessage, object, getPublicKey, DefaultAllowedAlgorithms)
+}
 
-	jwsSignature, err := jose.ParseSigned(rawMessage)
-	if err != nil {
-		// message is (probably) not signed, try to unmarshal it directly
-		err = json.Unmarshal([]byte(rawMessage), object)
-		return false, err
-	}
-	payload := jwsSignature.UnsafePayloadWithoutVerification()
-	err = json.Unmarshal([]byte(payload), object)
-	if err != nil {
-		// message doesn't have a json payload
-		errTxt := fmt.Sprintf("VerifySenderSignature: Signature okay but message unmarshal failed: %s", err)
-		return true, errors.New(errTxt)
-	}
-	// determine who the sender is
-	reflObject := reflect.ValueOf(object).Elem()
-	reflSender := reflObject.FieldByName("Sender")
-	if !reflSender.IsValid() {
-		reflSender = reflObject.FieldByName("Address")
-		if !reflSender.IsValid() {
-			err = errors.New("VerifySenderJWSSignature: object doesn't have a Sender or Address field")
-			return true, err
-		}
-	}
-	sender := reflSender.String()
-	if sender == "" {
-		err := errors.New("VerifySenderJWSSignature: Missing sender or address information in message")
-		return true, err
-	}
-	// verify the message signature using the sender's public key
-	if getPublicKey == nil {
-		return true, nil
-	}
-	publicKey := getPublicKey(sender)
-	if publicKey == nil {
-		err := errors.New("VerifySenderJWSSignature: No public key available for sender " + sender)
-		return true, err
-	}
+// VerifySenderJWSSignatureAlg verifies a message like VerifySenderJWSSignature and rejects signed
+// messages whose 'alg' header isn't in the list of allowed algorithms with ErrAlgorithmNotAllowed.
+func VerifySenderJWSSignatureAlg(rawMessage string, object interface{},
+	getPublicKey func(address string) *ecdsa.PublicKey, allowedAlgorithms []string) (isSigned bool, err error) {
 
-	_, err = jwsSignature.Verify(publicKey)
-	if err != nil {
-		msg := fmt.Sprintf("VerifySenderJWSSignature: message signature from %s fails to verify with its public key", sender)
-		err := errors.New(msg)
-		return true, err
-	}
-	return true, err
+	result := VerifySignatureDetailed(rawMessage, object, getPublicKey, allowedAlgorithms)
+	return result.IsSigned, result.Err
 }
@@ -1,15 +1,19 @@
 package messaging_test
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"encoding/base64"
 	"encoding/json"
 	"log"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/iotdomain/iotdomain-go/messaging"
 	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/square/go-jose.v2"
 )
@@ -296,6 +300,109 @@ func TestSigner(t *testing.T) {
 	signer.Unsubscribe("test/+/#", nil)
 }
 
+func TestSignerMetrics(t *testing.T) {
+	config := messaging.MessengerConfig{}
+	messenger := messaging.NewDummyMessenger(&config)
+	privKey := messaging.CreateAsymKeys()
+	otherKey := messaging.CreateAsymKeys()
+	getPubKey := func(address string) *ecdsa.PublicKey {
+		return &otherKey.PublicKey
+	}
+	signer := messaging.NewMessageSigner(messenger, privKey, getPubKey)
+	metrics := messaging.NewPrometheusMetrics()
+	signer.SetMetrics(metrics)
+	signer.Subscribe("test/#", func(address string, rawMessage string) error {
+		obj := TestObjectWithSender{}
+		_, _, err := signer.DecodeMessage(rawMessage, &obj)
+		return err
+	})
+
+	// messages signed with privKey fail to verify with the other public key
+	obj := TestObjectWithSender{Field1: "metrics", Sender: "test/bob"}
+	err := signer.PublishObject("test/bob/james", false, obj, nil)
+	assert.NoError(t, err)
+	signer.SetSignMessages(false)
+	err = signer.PublishObject("test/bob/james", false, obj, nil)
+	assert.NoError(t, err)
+
+	response := httptest.NewRecorder()
+	metrics.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	text := response.Body.String()
+	assert.Contains(t, text, "# TYPE iotdomain_messages_published_total counter")
+	assert.Contains(t, text, "iotdomain_messages_published_total 2\n")
+	assert.Contains(t, text, "iotdomain_messages_signed_total 1\n")
+	assert.Contains(t, text, "iotdomain_messages_received_total 2\n")
+	assert.Contains(t, text, "iotdomain_messages_verify_failed_total 1\n")
+	// messages that aren't encrypted don't count as decryption failures
+	assert.Contains(t, text, "iotdomain_messages_decrypt_failed_total 0\n")
+
+	// messages encrypted for another key fail to decrypt
+	err = signer.PublishObject("test/bob/james", false, obj, &otherKey.PublicKey)
+	assert.NoError(t, err)
+	response = httptest.NewRecorder()
+	metrics.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	text = response.Body.String()
+	assert.Contains(t, text, "iotdomain_messages_decrypt_failed_total 1\n")
+	assert.Contains(t, text, "iotdomain_messages_verify_failed_total 2\n")
+
+	// metrics can be replaced while publishing
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			signer.SetMetrics(nil)
+			signer.SetMetrics(metrics)
+		}
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		signer.PublishObject("test/bob/james", false, obj, nil)
+	}
+	<-done
+
+	// metrics are optional
+	signer.SetMetrics(nil)
+	err = signer.PublishObject("test/bob/james", false, obj, nil)
+	assert.NoError(t, err)
+}
+
+func TestSignerLogger(t *testing.T) {
+	config := messaging.MessengerConfig{}
+	messenger := messaging.NewDummyMessenger(&config)
+	privKey := messaging.CreateAsymKeys()
+	otherKey := messaging.CreateAsymKeys()
+	getPubKey := func(address string) *ecdsa.PublicKey {
+		return &otherKey.PublicKey
+	}
+	signer := messaging.NewMessageSigner(messenger, privKey, getPubKey)
+	assert.NotNil(t, signer.Logger(), "A default logger is expected")
+
+	// log entries of failed verification carry the fields of the injected logger
+	logOutput := bytes.Buffer{}
+	logger := logrus.New()
+	logger.SetOutput(&logOutput)
+	signer.SetLogger(logger.WithField("publisherID", "bob"))
+	signer.SubscribeVerified("test/#", func() interface{} { return &TestObjectWithSender{} },
+		func(address string, object interface{}) error {
+			return nil
+		})
+	obj := TestObjectWithSender{Field1: "logger", Sender: "test/bob"}
+	err := signer.PublishObject("test/bob/james", false, obj, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, logOutput.String(), "publisherID=bob")
+	// the failure is logged once, by the subscriber that discards the message
+	assert.Equal(t, 1, strings.Count(logOutput.String(), "fails to verify"))
+
+	// decoding doesn't log, the caller decides how to report the failure
+	logOutput.Reset()
+	message, _ := signer.SignObject(obj)
+	_, _, err = signer.DecodeMessage(message, &TestObjectWithSender{})
+	assert.Error(t, err)
+	assert.Empty(t, logOutput.String())
+
+	signer.SetLogger(nil)
+	assert.NotNil(t, signer.Logger())
+}
+
 func TestSignIdentity(t *testing.T) {
 	dssKeys := messaging.CreateAsymKeys()
 	newIdent := types.PublisherFullIdentity{}
@@ -304,10 +411,49 @@ func TestSignIdentity(t *testing.T) {
 	newIdent.IdentitySignature = ""
 
 	// signing identity should generate the signature
-	messaging.SignIdentity(&newIdent.PublisherIdentityMessage, dssKeys)
+	err := messaging.SignIdentity(&newIdent.PublisherIdentityMessage, dssKeys)
+	assert.NoError(t, err)
 	assert.NotEmpty(t, newIdent.IdentitySignature, "Signing identity fails")
 
 	// the generated signature must verify correctly
-	err := messaging.VerifyIdentitySignature(&newIdent.PublisherIdentityMessage, &dssKeys.PublicKey)
+	err = messaging.VerifyIdentitySignature(&newIdent.PublisherIdentityMessage, &dssKeys.PublicKey)
 	assert.Nil(t, err)
+
+	// signing without a key fails and clears the signature
+	err = messaging.SignIdentity(&newIdent.PublisherIdentityMessage, nil)
+	assert.Error(t, err)
+	assert.Empty(t, newIdent.IdentitySignature)
+}
+
+func TestUnsubscribeAll(t *testing.T) {
+	const addr1 = "test/pub1/node1/$event"
+	const addr2 = "test/pub1/node2/$event"
+	messenger := messaging.NewInMemoryMessenger(&messaging.MessengerConfig{})
+	signer := messaging.NewMessageSigner(messenger, messaging.CreateAsymKeys(), nil)
+	signer.SetSignMessages(false)
+	rxCount := 0
+	handler1 := func(address string, message string) error {
+		rxCount++
+		return nil
+	}
+	handler2 := func(address string, message string) error {
+		rxCount++
+		return nil
+	}
+	signer.Subscribe(addr1, handler1)
+	signer.Subscribe(addr2, handler2)
+	signer.Unsubscribe(addr2, handler2)
+	signer.Subscribe(addr2, handler2)
+
+	signer.PublishSigned(addr1, false, "1")
+	signer.PublishSigned(addr2, false, "2")
+	assert.Equal(t, 2, rxCount)
+
+	signer.UnsubscribeAll()
+	signer.PublishSigned(addr1, false, "3")
+	signer.PublishSigned(addr2, false, "4")
+	assert.Equal(t, 2, rxCount)
+
+	// nothing left to unsubscribe
+	signer.UnsubscribeAll()
 }
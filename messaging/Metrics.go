@@ -0,0 +1,50 @@
+// Package messaging - Metrics hook for counting messaging activity
+package messaging
+
+// IMetrics interface for collecting metrics of messaging activity.
+// Metrics are optional. The message signer skips counting when no metrics are set.
+type IMetrics interface {
+	// IncPublished increments the nr of published messages
+	IncPublished()
+	// IncSigned increments the nr of signed messages
+	IncSigned()
+	// IncReceived increments the nr of received messages that are decoded
+	IncReceived()
+	// IncVerifyFailed increments the nr of received messages whose signature failed to verify
+	IncVerifyFailed()
+	// IncEncryptFailed increments the nr of messages that failed to encrypt
+	IncEncryptFailed()
+	// IncDecryptFailed increments the nr of received messages that failed to decrypt
+	IncDecryptFailed()
+}
+
+// metricsRef holds the optional metrics of the message signer so they can be stored atomically
+type metricsRef struct {
+	metrics IMetrics
+}
+
+// IDuplicateMetrics is an optional interface of metrics that count dropped duplicate messages.
+// It is separate from IMetrics so existing implementations of IMetrics remain valid. The message
+// signer counts dropped duplicates when its metrics also implement this interface.
+type IDuplicateMetrics interface {
+	// IncDuplicateDropped increments the nr of received messages that are dropped as duplicates
+	IncDuplicateDropped()
+}
+
+// IRateMetrics is an optional interface of metrics that count publications limited by the rate
+// limiter. The message signer counts limited publications when its metrics also implement this interface.
+type IRateMetrics interface {
+	// IncRateDelayed increments the nr of publications that are delayed by the rate limiter
+	IncRateDelayed()
+	// IncRateDropped increments the nr of publications that are dropped by the rate limiter
+	IncRateDropped()
+}
+
+// IRetryMetrics is an optional interface of metrics that track the retry queue of failed
+// publications. The message signer tracks the queue when its metrics also implement this interface.
+type IRetryMetrics interface {
+	// IncRetryDropped increments the nr of failed publications that are dropped from the retry queue
+	IncRetryDropped()
+	// SetRetryQueueDepth sets the nr of failed publications that are queued for retry
+	SetRetryQueueDepth(depth int)
+}
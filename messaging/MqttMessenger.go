@@ -8,10 +8,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"sync"
 	"time"
 
 	pahomqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/iotdomain/iotdomain-go/types"
 	"github.com/sirupsen/logrus"
 	log "github.com/sirupsen/logrus"
 )
@@ -26,8 +28,13 @@ const TLSPort = 8883
 type MqttMessenger struct {
 	config              *MessengerConfig    // connect information
 	isRunning           bool                // listen for messages while running
+	onConnectHandlers   []func()            // optional handlers invoked after (re)connect
+	onDisconnectHandler func(err error)     // optional handler invoked after connection is lost
+	lastWillAddress     string              // address of the last will and testament, if set
+	lastWillClear       string              // last message published on the LWT address, republished after reconnect
 	pahoClient          pahomqtt.Client     // Paho MQTT Client
 	subscriptions       []TopicSubscription // list of TopicSubscription for re-subscribing after reconnect
+	subscriptionCount   SubscriptionID      // nr of subscriptions made, for the ID of the next subscription
 	tlsVerifyServerCert bool                // verify the server certificate, this requires a Root CA signed cert
 	tlsCACertFile       string              // path to CA certificate
 	updateMutex         *sync.Mutex         // mutex for async updating of subscriptions
@@ -35,15 +42,16 @@ type MqttMessenger struct {
 
 // TopicSubscription holds subscriptions to restore after disconnect
 type TopicSubscription struct {
+	id      SubscriptionID // identifies the subscription, see UnsubscribeByID
 	address string
 	handler func(address string, message string) error
-	token   pahomqtt.Token // for debugging
-	client  *MqttMessenger //
 }
 
 // Connect to the MQTT broker and set the LWT
 // If a previous connection exists then it is disconnected first.
 // This publishes the LWT on the address baseTopic/nodeHWID/$state.
+// The LWT is retained so late subscribers also see that the publisher is gone. After a reconnect
+// the last message published on the LWT address is republished to clear the LWT state.
 // @param lastWillTopic optional last will and testament address for publishing device state on accidental disconnect.
 //                       Use "" to ignore LWT feature.
 // @param lastWillValue to use as the last will
@@ -85,32 +93,26 @@ func (messenger *MqttMessenger) Connect(lastWillAddress string, lastWillValue st
 	opts.SetOnConnectHandler(func(client pahomqtt.Client) {
 		logrus.Warningf("MqttMessenger.onConnect: Connected to server at %s. Connected=%v. ClientId=%s",
 			brokerURL, client.IsConnected(), config.ClientID)
-		// Subscribe to addresss already registered by the app on connect or reconnect
-		messenger.resubscribe()
+		messenger.onConnect(client)
 	})
 	opts.SetConnectionLostHandler(func(client pahomqtt.Client, err error) {
 		log.Warningf("MqttMessenger.onConnectionLost: Disconnected from server %s. Error %s, ClientId=%s",
 			brokerURL, err, config.ClientID)
+		messenger.onConnectionLost(client, err)
 	})
+	messenger.updateMutex.Lock()
+	messenger.lastWillAddress = lastWillAddress
+	messenger.lastWillClear = ""
+	messenger.updateMutex.Unlock()
 	if lastWillAddress != "" {
-		opts.SetWill(lastWillAddress, lastWillValue, 1, false)
+		opts.SetWill(lastWillAddress, lastWillValue, 1, true)
 	}
-	// Use TLS if a CA certificate is given
-	var rootCA *x509.CertPool
-	if messenger.tlsCACertFile != "" {
-		rootCA = x509.NewCertPool()
-		caFile, err := ioutil.ReadFile(messenger.tlsCACertFile)
-		if err != nil {
-			logrus.Errorf("MqttMessenger.Connect: Unable to read CA certificate chain: %s", err)
-		}
-		rootCA.AppendCertsFromPEM([]byte(caFile))
+	tlsConfig, err := messenger.makeTLSConfig()
+	if err != nil {
+		logrus.Errorf("MqttMessenger.Connect: Invalid TLS configuration: %s", err)
+		return err
 	}
-	opts.SetTLSConfig(&tls.Config{
-		InsecureSkipVerify: !messenger.tlsVerifyServerCert,
-		RootCAs:            rootCA, // include the zcas cert in the host root ca set
-		// https://opium.io/blog/mqtt-in-go/
-		ServerName: "", // hostname on the server certificate. How to get this?
-	})
+	opts.SetTLSConfig(tlsConfig)
 
 	logrus.Infof("MqttMessenger.Connect: Connecting to MQTT server: %s with clientID %s"+
 		" AutoReconnect and CleanSession are set.",
@@ -160,9 +162,42 @@ func (messenger *MqttMessenger) Disconnect() {
 		messenger.pahoClient.Disconnect(10 * ConnectionTimeoutSec * 1000)
 		messenger.pahoClient = nil
 
+		messenger.updateMutex.Lock()
 		messenger.subscriptions = nil
+		onDisconnectHandler := messenger.onDisconnectHandler
+		messenger.updateMutex.Unlock()
 		//close(messenger.messageChannel)     // end the message handler loop
+		if onDisconnectHandler != nil {
+			onDisconnectHandler(nil)
+		}
+	}
+}
+
+// OnConnect adds a handler that is invoked after the connection is established or re-established.
+// Subscriptions are already restored when the handlers are invoked.
+func (messenger *MqttMessenger) OnConnect(handler func()) {
+	messenger.updateMutex.Lock()
+	defer messenger.updateMutex.Unlock()
+	messenger.onConnectHandlers = append(messenger.onConnectHandlers, handler)
+}
+
+// OnDisconnect sets the handler that is invoked when the connection is lost or closed.
+// The error is nil on a graceful disconnect.
+func (messenger *MqttMessenger) OnDisconnect(handler func(err error)) {
+	messenger.updateMutex.Lock()
+	defer messenger.updateMutex.Unlock()
+	messenger.onDisconnectHandler = handler
+}
+
+// GetPublishQos returns the QOS to publish a message on the given address.
+// The message type is the last segment of the address. If the config has a QOS for the message type
+// then this is used, otherwise the default publishing QOS.
+func (messenger *MqttMessenger) GetPublishQos(address string) byte {
+	messageType := types.GetMessageType(address)
+	if qos, found := messenger.config.MessageQos[messageType]; found {
+		return qos
 	}
+	return messenger.config.PubQos
 }
 
 // Publish value using the device address as base
@@ -176,9 +211,16 @@ func (messenger *MqttMessenger) Publish(address string, retained bool, message s
 		logrus.Warnf("MqttMessenger.Publish: Unable to publish. No connection with server.")
 		return errors.New("no connection with server")
 	}
+	qos := messenger.GetPublishQos(address)
 	logrus.Debugf("MqttMessenger.Publish []byte: address=%s, qos=%d, retained=%v",
-		address, messenger.config.PubQos, retained)
-	token := messenger.pahoClient.Publish(address, messenger.config.PubQos, retained, message)
+		address, qos, retained)
+	// remember the status to restore after reconnect
+	messenger.updateMutex.Lock()
+	if address == messenger.lastWillAddress && retained {
+		messenger.lastWillClear = message
+	}
+	messenger.updateMutex.Unlock()
+	token := messenger.pahoClient.Publish(address, qos, retained, message)
 
 	err = token.Error()
 	if err != nil {
@@ -197,7 +239,7 @@ func (messenger *MqttMessenger) PublishRaw(address string, retained bool, messag
 	}
 	// publication := Publication{Message: message}
 	// payload, err := json.Marshal(publication)
-	token := messenger.pahoClient.Publish(address, messenger.config.PubQos, retained, []byte(message))
+	token := messenger.pahoClient.Publish(address, messenger.GetPublishQos(address), retained, []byte(message))
 
 	err := token.Error()
 	if err != nil {
@@ -208,48 +250,80 @@ func (messenger *MqttMessenger) PublishRaw(address string, retained bool, messag
 	return err
 }
 
-// Wrapper for message handling.
-// Use a channel to handle the message in a gorouting.
-// This fixes a problem with losing context in callbacks. Not sure what is going on though.
-func (subscription *TopicSubscription) onMessage(c pahomqtt.Client, msg pahomqtt.Message) {
-	// NOTE: Scope in this callback is not always retained. Pipe notifications through a channel and handle in goroutine
-	address := msg.Topic()
-	rawPayload := string(msg.Payload())
-
-	logrus.Infof("MqttMessenger.onMessage. address=%s, subscription=%s, retained=%v",
-		address, subscription.address, msg.Retained())
-	subscription.handler(address, rawPayload)
-	//message := &IncomingMessage{msgTopic, payload, subscription}
-	//subscription.client.messageChannel <- message
+// makeTopicHandler returns the paho handler of a topic that passes received messages to all
+// handlers that are subscribed to the topic.
+// Paho keeps a single handler per topic, so the handlers of a topic are invoked by this handler.
+func (messenger *MqttMessenger) makeTopicHandler(topic string) pahomqtt.MessageHandler {
+	return func(c pahomqtt.Client, msg pahomqtt.Message) {
+		address := msg.Topic()
+		rawPayload := string(msg.Payload())
+		logrus.Infof("MqttMessenger.onMessage. address=%s, subscription=%s, retained=%v",
+			address, topic, msg.Retained())
+
+		messenger.updateMutex.Lock()
+		handlers := make([]func(address string, message string) error, 0)
+		for _, sub := range messenger.subscriptions {
+			if sub.address == topic {
+				handlers = append(handlers, sub.handler)
+			}
+		}
+		messenger.updateMutex.Unlock()
+		for _, handler := range handlers {
+			handler(address, rawPayload)
+		}
+	}
 }
 
 // subscribe to addresss after establishing connection
 // The application can already subscribe to addresss before the connection is established. If connection is lost then
 // this will re-subscribe to those addresss as PahoMqtt drops the subscriptions after disconnect.
 //
-func (messenger *MqttMessenger) resubscribe() {
+func (messenger *MqttMessenger) resubscribe(client pahomqtt.Client) {
 	// prevent simultaneous access to subscriptions
 	messenger.updateMutex.Lock()
 	defer messenger.updateMutex.Unlock()
 
 	logrus.Infof("MqttMessenger.resubscribe to %d addresess", len(messenger.subscriptions))
+	topics := make(map[string]bool)
 	for _, subscription := range messenger.subscriptions {
-		// clear existing subscription
-		messenger.pahoClient.Unsubscribe(subscription.address)
-
-		logrus.Infof("MqttMessenger.resubscribe: address %s", subscription.address)
-		// create a new variable to hold the subscription in the closure
-		newSubscr := subscription
-		token := messenger.pahoClient.Subscribe(newSubscr.address, messenger.config.PubQos, newSubscr.onMessage)
-		//token := messenger.pahoClient.Subscribe(newSubscr.address, newSubscr.qos, func (c pahomqtt.Client, msg pahomqtt.Message) {
-		//logrus.Infof("mqtt.resubscribe.onMessage: address %s, subscription %s", msg.Topic(), newSubscr.address)
-		//newSubscr.onMessage(c, msg)
-		//})
-		newSubscr.token = token
+		if !topics[subscription.address] {
+			topics[subscription.address] = true
+			logrus.Infof("MqttMessenger.resubscribe: address %s", subscription.address)
+			client.Subscribe(subscription.address, messenger.config.SubQos, messenger.makeTopicHandler(subscription.address))
+		}
 	}
 	logrus.Infof("MqttMessenger.resubscribe complete")
 }
 
+// onConnect restores subscriptions and the last status after the connection is (re)established
+func (messenger *MqttMessenger) onConnect(client pahomqtt.Client) {
+	// Subscribe to addresss already registered by the app on connect or reconnect
+	messenger.resubscribe(client)
+
+	messenger.updateMutex.Lock()
+	lastWillAddress := messenger.lastWillAddress
+	lastWillClear := messenger.lastWillClear
+	onConnectHandlers := messenger.onConnectHandlers
+	messenger.updateMutex.Unlock()
+	// After a reconnect the broker might have published the LWT. Restore the last status.
+	if lastWillClear != "" {
+		go client.Publish(lastWillAddress, messenger.GetPublishQos(lastWillAddress), true, lastWillClear)
+	}
+	for _, handler := range onConnectHandlers {
+		handler()
+	}
+}
+
+// onConnectionLost notifies the disconnect handler. Pahomqtt automatically reconnects.
+func (messenger *MqttMessenger) onConnectionLost(client pahomqtt.Client, err error) {
+	messenger.updateMutex.Lock()
+	onDisconnectHandler := messenger.onDisconnectHandler
+	messenger.updateMutex.Unlock()
+	if onDisconnectHandler != nil {
+		onDisconnectHandler(err)
+	}
+}
+
 // Subscribe to a address
 // Subscribers are automatically resubscribed after the connection is restored
 // If no connection exists, then subscriptions are stored until a connection is established.
@@ -258,48 +332,111 @@ func (messenger *MqttMessenger) resubscribe() {
 // handler: callback handler.
 func (messenger *MqttMessenger) Subscribe(
 	address string, onMessage func(address string, message string) error) {
+	messenger.SubscribeWithID(address, onMessage)
+}
+
+// SubscribeWithID subscribes to an address like Subscribe and returns the ID of the subscription
+// The broker resends retained messages of the address, which are then also received by the
+// other handlers that are subscribed to the same address.
+func (messenger *MqttMessenger) SubscribeWithID(
+	address string, onMessage func(address string, message string) error) SubscriptionID {
+
+	messenger.updateMutex.Lock()
+	defer messenger.updateMutex.Unlock()
+	messenger.subscriptionCount++
 	subscription := TopicSubscription{
+		id:      messenger.subscriptionCount,
 		address: address,
 		handler: onMessage,
-		token:   nil,
-		client:  messenger,
 	}
-	messenger.updateMutex.Lock()
-	defer messenger.updateMutex.Unlock()
 	messenger.subscriptions = append(messenger.subscriptions, subscription)
 
 	logrus.Infof("MqttMessenger.Subscribe: address %s, qos %d", address, messenger.config.SubQos)
-	//messenger.pahoClient.Subscribe(address, qos, addressSubscription.onMessage) //func(c pahomqtt.Client, msg pahomqtt.Message) {
 	if messenger.pahoClient != nil {
-		messenger.pahoClient.Subscribe(address, messenger.config.SubQos, subscription.onMessage) //func(c pahomqtt.Client, msg pahomqtt.Message) {
+		messenger.pahoClient.Subscribe(address, messenger.config.SubQos, messenger.makeTopicHandler(address))
 	}
-	// return nil
+	return subscription.id
 }
 
 // Unsubscribe an address and handler
 // if handler is nil then only the address needs to match
+// Handlers that are closures of the same function literal can't be told apart. Use
+// UnsubscribeByID to remove a specific subscription.
+// The address is unsubscribed from the server when no more handlers are subscribed to it.
 func (messenger *MqttMessenger) Unsubscribe(
 	address string, onMessage func(address string, message string) error) {
-	// messenger.publishMutex.Lock()
-	var onMessageID = onMessage
-	// onMessageStr := fmt.Sprintf("%v", &onMessage)
-	for i, sub := range messenger.subscriptions {
-		// can't compare addresses directly so convert to string
-		// handlerStr := fmt.Sprintf("%v", &sub.handler)
-		var handlerID = sub.handler
-		// if sub.address == address && handlerStr == onMessageStr {
-		if sub.address == address && (onMessage == nil || &onMessageID == &handlerID) {
-			// shift remainder left one index
-			if i < len(messenger.subscriptions) {
-				copy(messenger.subscriptions[i:], messenger.subscriptions[i+1:])
-			}
-			messenger.subscriptions = messenger.subscriptions[:len(messenger.subscriptions)-1]
-			if onMessage != nil {
-				break
-			}
+	messenger.updateMutex.Lock()
+	defer messenger.updateMutex.Unlock()
+
+	remaining := make([]TopicSubscription, 0, len(messenger.subscriptions))
+	removed := false
+	for _, sub := range messenger.subscriptions {
+		// functions can't be compared directly so compare their pointers
+		if sub.address == address && (onMessage == nil ||
+			(!removed && reflect.ValueOf(sub.handler).Pointer() == reflect.ValueOf(onMessage).Pointer())) {
+			removed = true
+		} else {
+			remaining = append(remaining, sub)
+		}
+	}
+	messenger.subscriptions = remaining
+	if removed {
+		messenger.unsubscribeUnused(address)
+	}
+}
+
+// UnsubscribeByID removes the subscription with the given ID
+// The remaining handlers of the address keep receiving messages. The address is unsubscribed from
+// the server when no more handlers are subscribed to it.
+func (messenger *MqttMessenger) UnsubscribeByID(id SubscriptionID) {
+	messenger.updateMutex.Lock()
+	defer messenger.updateMutex.Unlock()
+
+	for index, sub := range messenger.subscriptions {
+		if sub.id == id {
+			messenger.subscriptions = append(messenger.subscriptions[:index], messenger.subscriptions[index+1:]...)
+			messenger.unsubscribeUnused(sub.address)
+			return
 		}
 	}
-	// messenger.publishMutex.Unlock()
+}
+
+// unsubscribeUnused unsubscribes an address from the server if no handlers are subscribed to it
+// Must be called with the update mutex locked
+func (messenger *MqttMessenger) unsubscribeUnused(address string) {
+	for _, sub := range messenger.subscriptions {
+		if sub.address == address {
+			return
+		}
+	}
+	if messenger.pahoClient != nil {
+		messenger.pahoClient.Unsubscribe(address)
+	}
+}
+
+// makeTLSConfig creates the TLS configuration for connecting to the broker
+// This uses the TLS settings from the messenger config if provided. Otherwise the default CA
+// certificate is used if it exists.
+func (messenger *MqttMessenger) makeTLSConfig() (*tls.Config, error) {
+	if messenger.config.TLS != nil {
+		return messenger.config.TLS.Load()
+	}
+	// Use TLS if a CA certificate is given
+	var rootCA *x509.CertPool
+	if messenger.tlsCACertFile != "" {
+		rootCA = x509.NewCertPool()
+		caFile, err := ioutil.ReadFile(messenger.tlsCACertFile)
+		if err != nil {
+			logrus.Errorf("MqttMessenger.Connect: Unable to read CA certificate chain: %s", err)
+		}
+		rootCA.AppendCertsFromPEM([]byte(caFile))
+	}
+	return &tls.Config{
+		InsecureSkipVerify: !messenger.tlsVerifyServerCert,
+		RootCAs:            rootCA, // include the zcas cert in the host root ca set
+		// https://opium.io/blog/mqtt-in-go/
+		ServerName: "", // hostname on the server certificate. How to get this?
+	}, nil
 }
 
 // NewMqttMessenger creates a new MQTT messenger instance
@@ -0,0 +1,181 @@
+package messaging
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	pahomqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeToken is a completed pahomqtt token
+type fakeToken struct{}
+
+func (token *fakeToken) Wait() bool                     { return true }
+func (token *fakeToken) WaitTimeout(time.Duration) bool { return true }
+func (token *fakeToken) Error() error                   { return nil }
+
+// fakeMessage is a received pahomqtt message
+type fakeMessage struct {
+	topic   string
+	payload string
+}
+
+func (msg *fakeMessage) Duplicate() bool   { return false }
+func (msg *fakeMessage) Qos() byte         { return 0 }
+func (msg *fakeMessage) Retained() bool    { return false }
+func (msg *fakeMessage) Topic() string     { return msg.topic }
+func (msg *fakeMessage) MessageID() uint16 { return 0 }
+func (msg *fakeMessage) Payload() []byte   { return []byte(msg.payload) }
+func (msg *fakeMessage) Ack()              {}
+
+// fakeClient simulates the broker side subscriptions of a single connection
+type fakeClient struct {
+	mutex         sync.Mutex
+	subscriptions map[string]pahomqtt.MessageHandler
+}
+
+func (client *fakeClient) IsConnected() bool      { return true }
+func (client *fakeClient) IsConnectionOpen() bool { return true }
+func (client *fakeClient) Connect() pahomqtt.Token {
+	return &fakeToken{}
+}
+func (client *fakeClient) Disconnect(quiesce uint) {}
+func (client *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) pahomqtt.Token {
+	return &fakeToken{}
+}
+func (client *fakeClient) Subscribe(topic string, qos byte, callback pahomqtt.MessageHandler) pahomqtt.Token {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	client.subscriptions[topic] = callback
+	return &fakeToken{}
+}
+func (client *fakeClient) SubscribeMultiple(filters map[string]byte, callback pahomqtt.MessageHandler) pahomqtt.Token {
+	return &fakeToken{}
+}
+func (client *fakeClient) Unsubscribe(topics ...string) pahomqtt.Token {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	for _, topic := range topics {
+		delete(client.subscriptions, topic)
+	}
+	return &fakeToken{}
+}
+func (client *fakeClient) AddRoute(topic string, callback pahomqtt.MessageHandler) {}
+func (client *fakeClient) OptionsReader() pahomqtt.ClientOptionsReader {
+	return pahomqtt.ClientOptionsReader{}
+}
+
+// deliver a message to the subscriber of the topic
+func (client *fakeClient) deliver(topic string, payload string) bool {
+	client.mutex.Lock()
+	callback := client.subscriptions[topic]
+	client.mutex.Unlock()
+	if callback == nil {
+		return false
+	}
+	callback(client, &fakeMessage{topic: topic, payload: payload})
+	return true
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{subscriptions: make(map[string]pahomqtt.MessageHandler)}
+}
+
+// TestReconnectResubscribe simulates connection drops and tests that subscriptions are restored
+func TestReconnectResubscribe(t *testing.T) {
+	const addr1 = "domain1/pub1/node1/$configure"
+	const addr2 = "domain1/pub1/node1/switch/0/$setInput"
+	rxCount := 0
+	connectCount := 0
+	disconnectCount := 0
+	handler1 := func(address string, message string) error {
+		rxCount++
+		return nil
+	}
+	handler2 := func(address string, message string) error {
+		return nil
+	}
+	messenger := NewMqttMessenger(&MessengerConfig{})
+	messenger.OnConnect(func() { connectCount++ })
+	messenger.OnDisconnect(func(err error) { disconnectCount++ })
+
+	client := newFakeClient()
+	messenger.pahoClient = client
+	messenger.Subscribe(addr1, handler1)
+	messenger.Subscribe(addr2, handler1)
+	messenger.Subscribe(addr2, handler2)
+	// removing one handler keeps the address subscribed for the other
+	messenger.Unsubscribe(addr2, handler2)
+	assert.Len(t, client.subscriptions, 2)
+
+	// subscriptions must survive multiple reconnect cycles
+	for cycle := 1; cycle <= 3; cycle++ {
+		messenger.onConnectionLost(client, errors.New("connection lost"))
+		assert.Equal(t, cycle, disconnectCount)
+
+		// subscribe while disconnected, eg from another goroutine
+		wg := sync.WaitGroup{}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				addr := fmt.Sprintf("domain1/pub1/node%d-%d/$configure", cycle, i)
+				messenger.Subscribe(addr, handler1)
+				messenger.Unsubscribe(addr, handler1)
+				wg.Done()
+			}(i)
+		}
+		wg.Wait()
+
+		// a new connection starts without subscriptions
+		client = newFakeClient()
+		messenger.pahoClient = client
+		messenger.onConnect(client)
+		assert.Equal(t, cycle, connectCount)
+		require.Len(t, client.subscriptions, 2)
+		assert.True(t, client.deliver(addr1, "message"))
+		assert.True(t, client.deliver(addr2, "message"))
+	}
+	assert.Equal(t, 6, rxCount)
+
+	// unsubscribing the last handler removes the address from the server
+	messenger.Unsubscribe(addr1, nil)
+	assert.False(t, client.deliver(addr1, "message"))
+	assert.Len(t, client.subscriptions, 1)
+}
+
+// TestUnsubscribeByID tests that subscriptions to the same topic are removed individually
+func TestUnsubscribeByID(t *testing.T) {
+	const addr1 = "domain1/pub1/node1/$configure"
+	rxCount := make([]int, 2)
+	// handlers are closures of the same function literal
+	makeHandler := func(index int) func(address string, message string) error {
+		return func(address string, message string) error {
+			rxCount[index]++
+			return nil
+		}
+	}
+	messenger := NewMqttMessenger(&MessengerConfig{})
+	client := newFakeClient()
+	messenger.pahoClient = client
+	id1 := messenger.SubscribeWithID(addr1, makeHandler(0))
+	id2 := messenger.SubscribeWithID(addr1, makeHandler(1))
+	assert.NotEqual(t, id1, id2)
+
+	// paho has a single handler per topic that passes messages to both handlers
+	assert.True(t, client.deliver(addr1, "message"))
+	assert.Equal(t, []int{1, 1}, rxCount)
+
+	// the remaining handler keeps receiving messages
+	messenger.UnsubscribeByID(id1)
+	assert.True(t, client.deliver(addr1, "message"))
+	assert.Equal(t, []int{1, 2}, rxCount)
+
+	messenger.UnsubscribeByID(id2)
+	assert.False(t, client.deliver(addr1, "message"))
+	messenger.UnsubscribeByID(id2)
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/types"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
@@ -35,6 +36,22 @@ func TestNewMessenger(t *testing.T) {
 	assert.NotNil(t, m, "Failed creating dummy messenger")
 }
 
+func TestPublishQos(t *testing.T) {
+	config := messaging.MessengerConfig{
+		PubQos: 1,
+		MessageQos: map[types.MessageType]byte{
+			types.MessageTypeLatest:    0,
+			types.MessageTypeConfigure: 2,
+		},
+	}
+	messenger := messaging.NewMqttMessenger(&config)
+	assert.Equal(t, byte(0), messenger.GetPublishQos("domain1/pub1/node1/temperature/0/$latest"))
+	assert.Equal(t, byte(2), messenger.GetPublishQos("domain1/pub1/node1/$configure"))
+	// default QOS for other message types
+	assert.Equal(t, byte(1), messenger.GetPublishQos("domain1/pub1/node1/$node"))
+	assert.Equal(t, byte(1), messenger.GetPublishQos("noslash"))
+}
+
 // TestConnect to mqtt broker
 func TestConnect(t *testing.T) {
 	messenger := messaging.NewMqttMessenger(&messengerConfig)
@@ -0,0 +1,77 @@
+// Package messaging with JWS signing by multiple parties
+package messaging
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+// CreateJWSMultiSign signs the payload with each of the keys, eg of a publisher and a gateway
+// that co-sign a message. As compact serialization supports only a single signature, this returns
+// the JWS full JSON serialization. Use CreateJWSSignature for messages with a single signature.
+func CreateJWSMultiSign(payload string, keys []*ecdsa.PrivateKey) (string, error) {
+	if len(keys) == 0 {
+		return "", errors.New("CreateJWSMultiSign: No signing keys provided")
+	}
+	signingKeys := make([]jose.SigningKey, 0, len(keys))
+	for _, key := range keys {
+		if key == nil {
+			return "", errors.New("CreateJWSMultiSign: Signing key is nil")
+		}
+		algorithm, err := JWSAlgorithm(key)
+		if err != nil {
+			return "", err
+		}
+		signingKeys = append(signingKeys, jose.SigningKey{Algorithm: algorithm, Key: key})
+	}
+	joseSigner, err := jose.NewMultiSigner(signingKeys, nil)
+	if err != nil {
+		return "", err
+	}
+	signedObject, err := joseSigner.Sign([]byte(payload))
+	if err != nil {
+		return "", err
+	}
+	return signedObject.FullSerialize(), nil
+}
+
+// VerifyJWSMulti verifies a message signed by multiple parties and returns its payload.
+// Each public key must verify a different signature of the message. Keys without a matching
+// signature don't count towards the quorum.
+//  message is the JWS message in full or compact serialization
+//  publicKeys of the parties whose signatures to verify
+//  quorum is the nr of keys that must verify. Use 0 to require all keys.
+func VerifyJWSMulti(message string, publicKeys []*ecdsa.PublicKey, quorum int) (payload string, err error) {
+	if len(publicKeys) == 0 {
+		return "", errors.New("VerifyJWSMulti: No public keys provided")
+	}
+	if quorum <= 0 || quorum > len(publicKeys) {
+		quorum = len(publicKeys)
+	}
+	if err = checkMessageLimits(message); err != nil {
+		return "", err
+	}
+	jwsSignature, err := jose.ParseSigned(message)
+	if err != nil {
+		return "", err
+	}
+	verifiedSignatures := make(map[int]bool)
+	for _, publicKey := range publicKeys {
+		if publicKey == nil {
+			continue
+		}
+		index, _, payloadB, err := jwsSignature.VerifyMulti(publicKey)
+		if err == nil && !verifiedSignatures[index] {
+			verifiedSignatures[index] = true
+			payload = string(payloadB)
+		}
+	}
+	if len(verifiedSignatures) < quorum {
+		return "", fmt.Errorf("VerifyJWSMulti: Only %d of the required %d signatures are verified",
+			len(verifiedSignatures), quorum)
+	}
+	return payload, nil
+}
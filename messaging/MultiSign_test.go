@@ -0,0 +1,59 @@
+package messaging_test
+
+import (
+	"crypto/ecdsa"
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWSMultiSign(t *testing.T) {
+	const payload = "co-signed payload"
+	publisherKey := messaging.CreateAsymKeys()
+	gatewayKey := messaging.CreateAsymKeys()
+	otherKey := messaging.CreateAsymKeys()
+
+	message, err := messaging.CreateJWSMultiSign(payload,
+		[]*ecdsa.PrivateKey{publisherKey, gatewayKey})
+	require.NoError(t, err)
+
+	// all signatures are required
+	result, err := messaging.VerifyJWSMulti(message,
+		[]*ecdsa.PublicKey{&publisherKey.PublicKey, &gatewayKey.PublicKey}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, payload, result)
+
+	_, err = messaging.VerifyJWSMulti(message,
+		[]*ecdsa.PublicKey{&publisherKey.PublicKey, &otherKey.PublicKey}, 0)
+	assert.Error(t, err)
+
+	// quorum of 2 out of 3
+	result, err = messaging.VerifyJWSMulti(message,
+		[]*ecdsa.PublicKey{&publisherKey.PublicKey, &otherKey.PublicKey, &gatewayKey.PublicKey}, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, payload, result)
+
+	// the same key can't verify more than one signature
+	_, err = messaging.VerifyJWSMulti(message,
+		[]*ecdsa.PublicKey{&publisherKey.PublicKey, &publisherKey.PublicKey}, 2)
+	assert.Error(t, err)
+
+	// single signature messages still verify with the default path
+	compact, err := messaging.CreateJWSSignature(payload, publisherKey)
+	require.NoError(t, err)
+	result, err = messaging.VerifyJWSMulti(compact, []*ecdsa.PublicKey{&publisherKey.PublicKey}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, payload, result)
+
+	// invalid parameters
+	_, err = messaging.CreateJWSMultiSign(payload, nil)
+	assert.Error(t, err)
+	_, err = messaging.CreateJWSMultiSign(payload, []*ecdsa.PrivateKey{publisherKey, nil})
+	assert.Error(t, err)
+	_, err = messaging.VerifyJWSMulti(message, nil, 0)
+	assert.Error(t, err)
+	_, err = messaging.VerifyJWSMulti("not a jws", []*ecdsa.PublicKey{&publisherKey.PublicKey}, 0)
+	assert.Error(t, err)
+}
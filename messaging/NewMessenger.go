@@ -4,6 +4,8 @@ package messaging
 // Create a messenger instance using configuration setting:
 //    "DummyMessenger" (default)
 //    MQTTMessenger, requires server, login and credentials properties set
+//    InMemoryMessenger, routes messages within the process
+//    SimulationMessenger, captures publications for inspection instead of sending them
 //
 // config holds the messenger configuration. If no server is given, 'localhost' will be used.
 func NewMessenger(messengerConfig *MessengerConfig) IMessenger {
@@ -14,6 +16,10 @@ func NewMessenger(messengerConfig *MessengerConfig) IMessenger {
 	}
 	if messengerConfig.Messenger == "MQTTMessenger" {
 		m = NewMqttMessenger(messengerConfig)
+	} else if messengerConfig.Messenger == "InMemoryMessenger" {
+		m = NewInMemoryMessenger(messengerConfig)
+	} else if messengerConfig.Messenger == "SimulationMessenger" {
+		m = NewSimulationMessenger(messengerConfig)
 	} else {
 		m = NewDummyMessenger(messengerConfig)
 	}
@@ -0,0 +1,89 @@
+// Package messaging - Nonce in message signatures to make each publication unique
+package messaging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+// NonceHeader is the JWS header that holds the nonce of a signed message
+const NonceHeader = "nonce"
+
+// NonceMode determines the nonce that is included in the signature of published messages
+type NonceMode string
+
+// Available nonce modes
+const (
+	NonceNone    NonceMode = ""        // no nonce. Identical payloads have identical signed content
+	NonceCounter NonceMode = "counter" // counter that increments with each signed message, see SetNonceMode
+	NonceRandom  NonceMode = "random"  // 128 bit random value, hex encoded
+)
+
+// GetNonce returns the nonce of a signed message, or "" if the message has no nonce
+//  message is the signed message, decrypted if it was encrypted
+func GetNonce(message string) string {
+	if checkMessageLimits(message) != nil {
+		return ""
+	}
+	jwsSignature, err := jose.ParseSigned(message)
+	if err != nil || len(jwsSignature.Signatures) == 0 {
+		return ""
+	}
+	// the nonce header is a standard header
+	return jwsSignature.Signatures[0].Protected.Nonce
+}
+
+// NonceMode returns the nonce mode of signed messages
+func (signer *MessageSigner) NonceMode() NonceMode {
+	mode, _ := signer.nonceMode.Load().(NonceMode)
+	return mode
+}
+
+// SetNonceMode sets the nonce that is included in the signature header of published messages, so
+// each publication is unique even if the payload is identical. This prevents that observers learn
+// that the same value was sent and supports deduplication by hash. The nonce doesn't change the
+// payload. The default is NonceNone, which is useful when identical output is desirable.
+// The counter starts at the time in nanoseconds that the counter mode is set, so it keeps
+// increasing when the publisher restarts.
+//  mode is the nonce to include, NonceNone, NonceCounter or NonceRandom
+// Returns an error if the mode is unknown, in which case the mode is unchanged
+func (signer *MessageSigner) SetNonceMode(mode NonceMode) error {
+	switch mode {
+	case NonceNone, NonceRandom:
+	case NonceCounter:
+		// the counter never decreases, also not when the clock is set back
+		seed := uint64(signer.clock.Now().UnixNano())
+		for {
+			counter := atomic.LoadUint64(&signer.nonceCounter)
+			if counter >= seed || atomic.CompareAndSwapUint64(&signer.nonceCounter, counter, seed) {
+				break
+			}
+		}
+	default:
+		return fmt.Errorf("SetNonceMode: Unknown nonce mode '%s'", mode)
+	}
+	signer.nonceMode.Store(mode)
+	return nil
+}
+
+// nextNonce returns the nonce for the next signed message, or "" if no nonce is used
+func (signer *MessageSigner) nextNonce() string {
+	switch signer.NonceMode() {
+	case NonceCounter:
+		counter := atomic.AddUint64(&signer.nonceCounter, 1)
+		return strconv.FormatUint(counter, 10)
+	case NonceRandom:
+		nonce := make([]byte, 16)
+		if _, err := rand.Read(nonce); err != nil {
+			signer.logger.Errorf("MessageSigner.nextNonce: Unable to generate a random nonce: %s", err)
+			return ""
+		}
+		return hex.EncodeToString(nonce)
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+package messaging_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNonceMode(t *testing.T) {
+	const addr1 = "test/pub1/node1/temperature/0/$latest"
+	messenger := messaging.NewInMemoryMessenger(&messaging.MessengerConfig{})
+	privKey := messaging.CreateAsymKeys()
+	signer := messaging.NewMessageSigner(messenger, privKey, nil)
+	received := make([]string, 0)
+	messenger.Subscribe(addr1, func(address string, message string) error {
+		received = append(received, message)
+		return nil
+	})
+	// the signed content is the protected header and payload, without the signature
+	signedContent := func(message string) string {
+		return message[:strings.LastIndex(message, ".")]
+	}
+	publishTwice := func() (string, string) {
+		received = received[:0]
+		signer.PublishObject(addr1, false, &testObject, nil)
+		signer.PublishObject(addr1, false, &testObject, nil)
+		require.Equal(t, 2, len(received))
+		return received[0], received[1]
+	}
+
+	// default without nonce
+	assert.Equal(t, messaging.NonceNone, signer.NonceMode())
+	msg1, msg2 := publishTwice()
+	assert.Equal(t, signedContent(msg1), signedContent(msg2))
+	assert.Empty(t, messaging.GetNonce(msg1))
+
+	// counter starts at the time the mode is set
+	now := time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)
+	clock := messaging.NewManualClock(now)
+	signer.SetClock(clock)
+	err := signer.SetNonceMode(messaging.NonceCounter)
+	require.NoError(t, err)
+	assert.Equal(t, messaging.NonceCounter, signer.NonceMode())
+	msg1, msg2 = publishTwice()
+	assert.NotEqual(t, signedContent(msg1), signedContent(msg2))
+	seed := uint64(now.UnixNano())
+	assert.Equal(t, strconv.FormatUint(seed+1, 10), messaging.GetNonce(msg1))
+	assert.Equal(t, strconv.FormatUint(seed+2, 10), messaging.GetNonce(msg2))
+	// the counter doesn't decrease when the clock is set back
+	clock.Set(now.Add(-time.Hour))
+	signer.SetNonceMode(messaging.NonceCounter)
+	msg1, _ = publishTwice()
+	assert.Equal(t, strconv.FormatUint(seed+3, 10), messaging.GetNonce(msg1))
+
+	// unknown modes are rejected
+	err = signer.SetNonceMode("Random")
+	assert.Error(t, err)
+	assert.Equal(t, messaging.NonceCounter, signer.NonceMode())
+
+	// random
+	signer.SetNonceMode(messaging.NonceRandom)
+	msg1, msg2 = publishTwice()
+	assert.NotEqual(t, signedContent(msg1), signedContent(msg2))
+	assert.Equal(t, 32, len(messaging.GetNonce(msg1)))
+	assert.NotEqual(t, messaging.GetNonce(msg1), messaging.GetNonce(msg2))
+
+	// the nonce doesn't affect the payload
+	payload1, err := messaging.VerifyJWSMessage(msg1, &privKey.PublicKey)
+	require.NoError(t, err)
+	payload2, err := messaging.VerifyJWSMessage(msg2, &privKey.PublicKey)
+	require.NoError(t, err)
+	assert.Equal(t, payload1, payload2)
+	var object TestObjectWithSender
+	_, err = messaging.VerifySenderJWSSignature(msg1, &object, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, testObject, object)
+	assert.Empty(t, messaging.GetNonce("not signed"))
+}
@@ -0,0 +1,112 @@
+// Package messaging - Metrics in the Prometheus text exposition format
+package messaging
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// PrometheusMetrics implements IMetrics with counters that are served in the Prometheus text format.
+// Use it as a http handler for the metrics endpoint, eg: http.Handle("/metrics", metrics)
+type PrometheusMetrics struct {
+	published     uint64
+	signed        uint64
+	received      uint64
+	verifyFailed  uint64
+	encryptFailed uint64
+	decryptFailed uint64
+	rateDelayed   uint64
+	rateDropped   uint64
+	dupDropped    uint64
+	retryDropped  uint64
+	retryDepth    int64
+}
+
+// IncPublished increments the nr of published messages
+func (metrics *PrometheusMetrics) IncPublished() {
+	atomic.AddUint64(&metrics.published, 1)
+}
+
+// IncSigned increments the nr of signed messages
+func (metrics *PrometheusMetrics) IncSigned() {
+	atomic.AddUint64(&metrics.signed, 1)
+}
+
+// IncReceived increments the nr of received messages
+func (metrics *PrometheusMetrics) IncReceived() {
+	atomic.AddUint64(&metrics.received, 1)
+}
+
+// IncVerifyFailed increments the nr of messages that failed signature verification
+func (metrics *PrometheusMetrics) IncVerifyFailed() {
+	atomic.AddUint64(&metrics.verifyFailed, 1)
+}
+
+// IncEncryptFailed increments the nr of messages that failed to encrypt
+func (metrics *PrometheusMetrics) IncEncryptFailed() {
+	atomic.AddUint64(&metrics.encryptFailed, 1)
+}
+
+// IncDecryptFailed increments the nr of messages that failed to decrypt
+func (metrics *PrometheusMetrics) IncDecryptFailed() {
+	atomic.AddUint64(&metrics.decryptFailed, 1)
+}
+
+// IncRateDelayed increments the nr of publications delayed by the rate limiter
+func (metrics *PrometheusMetrics) IncRateDelayed() {
+	atomic.AddUint64(&metrics.rateDelayed, 1)
+}
+
+// IncRateDropped increments the nr of publications dropped by the rate limiter
+func (metrics *PrometheusMetrics) IncRateDropped() {
+	atomic.AddUint64(&metrics.rateDropped, 1)
+}
+
+// IncDuplicateDropped increments the nr of received messages dropped as duplicates
+func (metrics *PrometheusMetrics) IncDuplicateDropped() {
+	atomic.AddUint64(&metrics.dupDropped, 1)
+}
+
+// IncRetryDropped increments the nr of failed publications dropped from the retry queue
+func (metrics *PrometheusMetrics) IncRetryDropped() {
+	atomic.AddUint64(&metrics.retryDropped, 1)
+}
+
+// SetRetryQueueDepth sets the nr of failed publications queued for retry
+func (metrics *PrometheusMetrics) SetRetryQueueDepth(depth int) {
+	atomic.StoreInt64(&metrics.retryDepth, int64(depth))
+}
+
+// ServeHTTP writes the counters in the Prometheus text exposition format
+func (metrics *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	counters := []struct {
+		name  string
+		help  string
+		value *uint64
+	}{
+		{"iotdomain_messages_published_total", "Nr of published messages", &metrics.published},
+		{"iotdomain_messages_signed_total", "Nr of signed messages", &metrics.signed},
+		{"iotdomain_messages_received_total", "Nr of received messages", &metrics.received},
+		{"iotdomain_messages_verify_failed_total", "Nr of received messages that failed signature verification", &metrics.verifyFailed},
+		{"iotdomain_messages_encrypt_failed_total", "Nr of messages that failed to encrypt", &metrics.encryptFailed},
+		{"iotdomain_messages_decrypt_failed_total", "Nr of received messages that failed to decrypt", &metrics.decryptFailed},
+		{"iotdomain_messages_rate_delayed_total", "Nr of publications delayed by the rate limiter", &metrics.rateDelayed},
+		{"iotdomain_messages_rate_dropped_total", "Nr of publications dropped by the rate limiter", &metrics.rateDropped},
+		{"iotdomain_messages_duplicate_dropped_total", "Nr of received messages dropped as duplicates", &metrics.dupDropped},
+		{"iotdomain_messages_retry_dropped_total", "Nr of failed publications dropped from the retry queue", &metrics.retryDropped},
+	}
+	for _, counter := range counters {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n",
+			counter.name, counter.help, counter.name, counter.name, atomic.LoadUint64(counter.value))
+	}
+	const depthName = "iotdomain_messages_retry_queue_depth"
+	fmt.Fprintf(w, "# HELP %s Nr of failed publications queued for retry\n# TYPE %s gauge\n%s %d\n",
+		depthName, depthName, depthName, atomic.LoadInt64(&metrics.retryDepth))
+}
+
+// NewPrometheusMetrics creates a new instance of metrics counters for use with Prometheus
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{}
+}
@@ -0,0 +1,141 @@
+// Package messaging - Rate limiting of outgoing publications
+package messaging
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/types"
+)
+
+// ErrRateLimited is returned when a publication is dropped because the rate limit is exceeded
+var ErrRateLimited = errors.New("publication rate limit exceeded")
+
+// tokenBucket holds the available publications of a rate limit
+type tokenBucket struct {
+	rate       float64   // nr of publications per second
+	burst      float64   // max nr of tokens in the bucket
+	tokens     float64   // available tokens
+	lastRefill time.Time // time tokens were last added
+	unlimited  bool      // the rate is not a positive finite number so publications are not limited
+}
+
+// refill adds the tokens that became available since the last refill
+func (bucket *tokenBucket) refill(now time.Time) {
+	// a clock that goes back doesn't take tokens
+	if now.Before(bucket.lastRefill) {
+		now = bucket.lastRefill
+	}
+	bucket.tokens += now.Sub(bucket.lastRefill).Seconds() * bucket.rate
+	if bucket.tokens > bucket.burst {
+		bucket.tokens = bucket.burst
+	}
+	bucket.lastRefill = now
+}
+
+// take a token from the bucket and return the time to wait until the token is available
+func (bucket *tokenBucket) take() time.Duration {
+	bucket.tokens--
+	if bucket.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-bucket.tokens / bucket.rate * float64(time.Second))
+}
+
+// RateLimiter limits the rate of outgoing publications using a token bucket.
+// A separate limit can be set per message type. Message types without their own limit share the
+// default limit. When the limit is exceeded the publication is either delayed until a token is
+// available, or dropped with ErrRateLimited.
+type RateLimiter struct {
+	block       bool                               // delay instead of drop when the limit is exceeded
+	bucket      *tokenBucket                       // default limit
+	clock       Clock                              // clock for refilling the buckets
+	typeBuckets map[types.MessageType]*tokenBucket // limits by message type
+	updateMutex *sync.Mutex                        // mutex for concurrent publications
+}
+
+// SetMessageTypeLimit sets a separate limit for publications of the given message type
+//  rate is the nr of publications per second. Use 0 to not limit the message type.
+//  burst is the max nr of publications that can be published at once
+func (limiter *RateLimiter) SetMessageTypeLimit(messageType types.MessageType, rate float64, burst int) {
+	limiter.updateMutex.Lock()
+	defer limiter.updateMutex.Unlock()
+	limiter.typeBuckets[messageType] = newTokenBucket(rate, burst, limiter.clock.Now())
+}
+
+// SetClock sets the clock used to refill the limits. Intended for testing of dropping mode, as
+// delayed publications still wait in real time. Use nil for the system time.
+func (limiter *RateLimiter) SetClock(clock Clock) {
+	if clock == nil {
+		clock = RealClock
+	}
+	limiter.updateMutex.Lock()
+	defer limiter.updateMutex.Unlock()
+	limiter.clock = clock
+	// refill from the time of the new clock
+	now := clock.Now()
+	limiter.bucket.lastRefill = now
+	for _, bucket := range limiter.typeBuckets {
+		bucket.lastRefill = now
+	}
+}
+
+// Wait waits until publication on the address is allowed.
+// In dropping mode this returns ErrRateLimited instead of waiting.
+// Returns the time waited.
+func (limiter *RateLimiter) Wait(address string) (delay time.Duration, err error) {
+	messageType := types.GetMessageType(address)
+	limiter.updateMutex.Lock()
+	bucket := limiter.typeBuckets[messageType]
+	if bucket == nil {
+		bucket = limiter.bucket
+	}
+	if bucket.unlimited {
+		limiter.updateMutex.Unlock()
+		return 0, nil
+	}
+	bucket.refill(limiter.clock.Now())
+	if !limiter.block && bucket.tokens < 1 {
+		limiter.updateMutex.Unlock()
+		return 0, ErrRateLimited
+	}
+	// the token is taken now so concurrent publications queue up behind it
+	delay = bucket.take()
+	limiter.updateMutex.Unlock()
+	time.Sleep(delay)
+	return delay, nil
+}
+
+// newTokenBucket creates a full bucket
+//  rate is the nr of publications per second. A rate that isn't a positive finite number doesn't limit.
+//  now is the time of the first refill
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:       rate,
+		burst:      float64(burst),
+		tokens:     float64(burst),
+		lastRefill: now,
+		unlimited:  !(rate > 0) || math.IsInf(rate, 1),
+	}
+}
+
+// NewRateLimiter creates a rate limiter for publications
+//  rate is the default nr of publications per second. Use 0 to only limit message types that
+//  have their own limit, see SetMessageTypeLimit.
+//  burst is the max nr of publications that can be published at once
+//  block to delay publications when the limit is exceeded instead of dropping them
+func NewRateLimiter(rate float64, burst int, block bool) *RateLimiter {
+	limiter := &RateLimiter{
+		block:       block,
+		bucket:      newTokenBucket(rate, burst, RealClock.Now()),
+		clock:       RealClock,
+		typeBuckets: make(map[types.MessageType]*tokenBucket),
+		updateMutex: &sync.Mutex{},
+	}
+	return limiter
+}
@@ -0,0 +1,98 @@
+package messaging_test
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitDrop(t *testing.T) {
+	const addr1 = "test/pub1/node1/switch/0/$output"
+	const addr2 = "test/pub1/node1/$event"
+	messenger := messaging.NewInMemoryMessenger(&messaging.MessengerConfig{})
+	signer := messaging.NewMessageSigner(messenger, messaging.CreateAsymKeys(), nil)
+	metrics := messaging.NewPrometheusMetrics()
+	signer.SetMetrics(metrics)
+	limiter := messaging.NewRateLimiter(1, 2, false)
+	limiter.SetMessageTypeLimit(types.MessageTypeEvent, 1, 1)
+	signer.SetRateLimiter(limiter)
+
+	// the burst is allowed, the next publication is dropped
+	assert.NoError(t, signer.PublishSigned(addr1, false, "1"))
+	assert.NoError(t, signer.PublishSigned(addr1, false, "2"))
+	err := signer.PublishSigned(addr1, false, "3")
+	assert.Equal(t, messaging.ErrRateLimited, err)
+
+	// the event message type has its own limit
+	assert.NoError(t, signer.PublishSigned(addr2, false, "1"))
+	err = signer.PublishEncrypted(addr2, false, "2", &messaging.CreateAsymKeys().PublicKey)
+	assert.Equal(t, messaging.ErrRateLimited, err)
+
+	response := httptest.NewRecorder()
+	metrics.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, response.Body.String(), "iotdomain_messages_rate_dropped_total 2\n")
+
+	// no more limit
+	signer.SetRateLimiter(nil)
+	assert.NoError(t, signer.PublishSigned(addr1, false, "4"))
+}
+
+func TestRateLimitClock(t *testing.T) {
+	const addr1 = "test/pub1/node1/switch/0/$output"
+	clock := messaging.NewManualClock(time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC))
+	limiter := messaging.NewRateLimiter(1, 1, false)
+	limiter.SetClock(clock)
+
+	_, err := limiter.Wait(addr1)
+	assert.NoError(t, err)
+	_, err = limiter.Wait(addr1)
+	assert.Equal(t, messaging.ErrRateLimited, err)
+	// tokens are refilled by the clock
+	clock.Advance(time.Second)
+	_, err = limiter.Wait(addr1)
+	assert.NoError(t, err)
+}
+
+func TestRateLimitBlock(t *testing.T) {
+	const addr1 = "test/pub1/node1/switch/0/$output"
+	messenger := messaging.NewInMemoryMessenger(&messaging.MessengerConfig{})
+	signer := messaging.NewMessageSigner(messenger, messaging.CreateAsymKeys(), nil)
+	metrics := messaging.NewPrometheusMetrics()
+	signer.SetMetrics(metrics)
+	signer.SetRateLimiter(messaging.NewRateLimiter(50, 1, true))
+
+	// publications beyond the burst are delayed by 1/rate
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, signer.PublishSigned(addr1, false, "value"))
+	}
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(time.Millisecond*35))
+
+	response := httptest.NewRecorder()
+	metrics.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, response.Body.String(), "iotdomain_messages_rate_delayed_total 2\n")
+}
+
+func TestRateLimitNoRate(t *testing.T) {
+	const addr1 = "test/pub1/node1/switch/0/$output"
+	const addr2 = "test/pub1/node1/$event"
+	clock := messaging.NewManualClock(time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC))
+	// a rate of 0 or less doesn't limit, neither in drop nor in block mode
+	for _, block := range []bool{false, true} {
+		limiter := messaging.NewRateLimiter(0, 1, block)
+		limiter.SetClock(clock)
+		limiter.SetMessageTypeLimit(types.MessageTypeEvent, -1, 1)
+		for i := 0; i < 3; i++ {
+			delay, err := limiter.Wait(addr1)
+			assert.NoError(t, err)
+			assert.Equal(t, time.Duration(0), delay)
+			delay, err = limiter.Wait(addr2)
+			assert.NoError(t, err)
+			assert.Equal(t, time.Duration(0), delay)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Package messaging - Retained flag policy by message type
+package messaging
+
+import (
+	"crypto/ecdsa"
+
+	"github.com/iotdomain/iotdomain-go/types"
+)
+
+// DefaultRetainedPolicy determines which message types are published with the retained flag.
+// Discovery messages and output values are retained so new subscribers receive the current state.
+// Events and commands are not retained as they are only relevant at the time they are published.
+// Message types that are not listed are not retained.
+var DefaultRetainedPolicy = map[types.MessageType]bool{
+	types.MessageTypeConfigure:       false,
+	types.MessageTypeCreate:          false,
+	types.MessageTypeDelete:          false,
+	types.MessageTypeEvent:           false,
+	types.MessageTypeForecast:        true,
+	types.MessageTypeHistory:         true,
+	types.MessageTypeIdentity:        true,
+	types.MessageTypeInputDiscovery:  true,
+	types.MessageTypeLatest:          true,
+	types.MessageTypeNodeDiscovery:   true,
+	types.MessageTypeNodeStatus:      true,
+	types.MessageTypeOutputDiscovery: true,
+	types.MessageTypeRaw:             true,
+	types.MessageTypeSetIdentity:     false,
+	types.MessageTypeSetInput:        false,
+	types.MessageTypeSetNodeID:       false,
+	types.MessageTypeStatus:          true,
+	types.MessageTypeUpgrade:         false,
+}
+
+// ClearRetained removes the retained message of an address from the message bus by publishing an
+// empty retained message. Intended for removing deleted nodes, inputs and outputs.
+func (signer *MessageSigner) ClearRetained(address string) error {
+	err := signer.limitRate(address)
+	if err != nil {
+		return err
+	}
+	err = signer.messenger.Publish(address, true, "")
+	signer.countPublished(false, err)
+	signer.queueFailed(address, true, "", err)
+	return err
+}
+
+// IsRetained returns the retained flag of the policy for publications on the given address.
+// The message type is the last segment of the address.
+func (signer *MessageSigner) IsRetained(address string) bool {
+	messageType := types.GetMessageType(address)
+	signer.policyMutex.RLock()
+	defer signer.policyMutex.RUnlock()
+	return signer.retainedPolicy[messageType]
+}
+
+// PublishObjectWithPolicy publishes an object like PublishObject, using the retained flag from the
+// retained policy of the message type. Use PublishObject to explicitly set the retained flag.
+func (signer *MessageSigner) PublishObjectWithPolicy(
+	address string, object interface{}, encryptionKey *ecdsa.PublicKey) error {
+	return signer.PublishObject(address, signer.IsRetained(address), object, encryptionKey)
+}
+
+// PublishSignedWithPolicy publishes a payload like PublishSigned, using the retained flag from the
+// retained policy of the message type. Use PublishSigned to explicitly set the retained flag.
+func (signer *MessageSigner) PublishSignedWithPolicy(address string, payload string) error {
+	return signer.PublishSigned(address, signer.IsRetained(address), payload)
+}
+
+// SetRetainedPolicy sets the retained flag for publications of a message type, replacing the
+// default from DefaultRetainedPolicy.
+func (signer *MessageSigner) SetRetainedPolicy(messageType types.MessageType, retained bool) {
+	signer.policyMutex.Lock()
+	defer signer.policyMutex.Unlock()
+	signer.retainedPolicy[messageType] = retained
+}
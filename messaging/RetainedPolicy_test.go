@@ -0,0 +1,49 @@
+package messaging_test
+
+import (
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetainedPolicy(t *testing.T) {
+	const latestAddr = "test/pub1/node1/switch/0/$latest"
+	const eventAddr = "test/pub1/node1/$event"
+	const unknownAddr = "test/pub1/node1/$unknown"
+	messenger := messaging.NewInMemoryMessenger(&messaging.MessengerConfig{})
+	signer := messaging.NewMessageSigner(messenger, messaging.CreateAsymKeys(), nil)
+
+	// defaults: values are retained, events and unknown message types are not
+	assert.True(t, signer.IsRetained(latestAddr))
+	assert.False(t, signer.IsRetained(eventAddr))
+	assert.False(t, signer.IsRetained(unknownAddr))
+
+	err := signer.PublishObjectWithPolicy(latestAddr, map[string]string{"value": "1"}, nil)
+	assert.NoError(t, err)
+	_, found := messenger.GetRetained(latestAddr)
+	assert.True(t, found)
+
+	err = signer.PublishSignedWithPolicy(eventAddr, "event1")
+	assert.NoError(t, err)
+	_, found = messenger.GetRetained(eventAddr)
+	assert.False(t, found)
+
+	// override the policy for events
+	signer.SetRetainedPolicy(types.MessageTypeEvent, true)
+	assert.True(t, signer.IsRetained(eventAddr))
+	err = signer.PublishSignedWithPolicy(eventAddr, "event2")
+	assert.NoError(t, err)
+	_, found = messenger.GetRetained(eventAddr)
+	assert.True(t, found)
+
+	// the default policy is not affected
+	assert.False(t, messaging.DefaultRetainedPolicy[types.MessageTypeEvent])
+
+	// an explicit retained flag takes precedence over the policy
+	err = signer.PublishSigned(unknownAddr, true, "value")
+	assert.NoError(t, err)
+	_, found = messenger.GetRetained(unknownAddr)
+	assert.True(t, found)
+}
@@ -0,0 +1,151 @@
+// Package messaging - Retry queue of publications that failed, eg while the connection is lost
+package messaging
+
+import (
+	"sync"
+	"time"
+)
+
+// RetryDropPolicy determines which publication is dropped when the retry queue is full
+type RetryDropPolicy int
+
+// Drop policies of the retry queue
+const (
+	// RetryDropOldest drops the oldest queued publication to make room. This is the default.
+	RetryDropOldest RetryDropPolicy = iota
+	// RetryDropNewest drops the publication that is added to a full queue
+	RetryDropNewest
+)
+
+// retryPublication is a signed and optionally encrypted message that failed to publish
+type retryPublication struct {
+	address  string
+	retained bool
+	message  string
+}
+
+// RetryQueue buffers publications that failed and retries them with an exponential backoff.
+// The delay between retries starts at the minimum delay and doubles after each failed retry up to
+// the maximum delay. It is reset after the queue is flushed. The queue is bounded, when it is full
+// publications are dropped according to the drop policy.
+type RetryQueue struct {
+	delay       time.Duration      // current delay between retries
+	dropped     int                // nr of publications dropped since the queue was created
+	dropPolicy  RetryDropPolicy    // which publication to drop when the queue is full
+	maxDelay    time.Duration      // max delay between retries
+	maxSize     int                // max nr of publications in the queue
+	minDelay    time.Duration      // initial delay between retries
+	nextRetry   time.Time          // earliest time of the next retry
+	queue       []retryPublication // publications in order of publication
+	retryMutex  *sync.Mutex        // mutex to retry publications in order
+	updateMutex *sync.Mutex        // mutex for concurrent access to the queue
+}
+
+// Add a publication to the queue. If the queue is full then a publication is dropped.
+// Returns true if a publication was dropped
+func (queue *RetryQueue) Add(address string, retained bool, message string) (dropped bool) {
+	queue.updateMutex.Lock()
+	defer queue.updateMutex.Unlock()
+	if len(queue.queue) >= queue.maxSize {
+		queue.dropped++
+		if queue.dropPolicy == RetryDropNewest || queue.maxSize <= 0 {
+			return true
+		}
+		queue.queue = queue.queue[1:]
+		dropped = true
+	}
+	queue.queue = append(queue.queue, retryPublication{
+		address: address, retained: retained, message: message})
+	return dropped
+}
+
+// Depth returns the nr of publications in the queue
+func (queue *RetryQueue) Depth() int {
+	queue.updateMutex.Lock()
+	defer queue.updateMutex.Unlock()
+	return len(queue.queue)
+}
+
+// Dropped returns the nr of publications that were dropped because the queue was full
+func (queue *RetryQueue) Dropped() int {
+	queue.updateMutex.Lock()
+	defer queue.updateMutex.Unlock()
+	return queue.dropped
+}
+
+// Retry publishes the queued publications in order until one fails.
+// The retry is skipped if the backoff delay since the last failed retry hasn't passed.
+//  publish publishes a queued message
+//  now is the current time to determine the backoff
+//  force retries regardless of the backoff delay, eg after a reconnect
+// Returns the nr of publications that were published and the error of the failed publication
+func (queue *RetryQueue) Retry(publish func(address string, retained bool, message string) error,
+	now time.Time, force bool) (count int, err error) {
+
+	queue.retryMutex.Lock()
+	defer queue.retryMutex.Unlock()
+	queue.updateMutex.Lock()
+	if !force && now.Before(queue.nextRetry) {
+		queue.updateMutex.Unlock()
+		return 0, nil
+	}
+	queue.updateMutex.Unlock()
+
+	for {
+		queue.updateMutex.Lock()
+		if len(queue.queue) == 0 {
+			queue.delay = queue.minDelay
+			queue.updateMutex.Unlock()
+			return count, nil
+		}
+		publication := queue.queue[0]
+		queue.updateMutex.Unlock()
+
+		// publish outside the lock as it can block
+		err = publish(publication.address, publication.retained, publication.message)
+
+		queue.updateMutex.Lock()
+		if err != nil {
+			queue.nextRetry = now.Add(queue.delay)
+			queue.delay *= 2
+			if queue.delay > queue.maxDelay {
+				queue.delay = queue.maxDelay
+			}
+			queue.updateMutex.Unlock()
+			return count, err
+		}
+		// the publication can be dropped from a full queue while publishing
+		if len(queue.queue) > 0 && queue.queue[0] == publication {
+			queue.queue = queue.queue[1:]
+		}
+		queue.updateMutex.Unlock()
+		count++
+	}
+}
+
+// SetDropPolicy sets which publication is dropped when the queue is full. Default is RetryDropOldest.
+func (queue *RetryQueue) SetDropPolicy(policy RetryDropPolicy) {
+	queue.updateMutex.Lock()
+	defer queue.updateMutex.Unlock()
+	queue.dropPolicy = policy
+}
+
+// NewRetryQueue creates a bounded queue for retrying failed publications
+//  maxSize is the max nr of publications in the queue
+//  minDelay is the initial delay between retries
+//  maxDelay is the max delay between retries
+func NewRetryQueue(maxSize int, minDelay time.Duration, maxDelay time.Duration) *RetryQueue {
+	if maxDelay < minDelay {
+		maxDelay = minDelay
+	}
+	queue := &RetryQueue{
+		delay:       minDelay,
+		maxDelay:    maxDelay,
+		maxSize:     maxSize,
+		minDelay:    minDelay,
+		queue:       make([]retryPublication, 0),
+		retryMutex:  &sync.Mutex{},
+		updateMutex: &sync.Mutex{},
+	}
+	return queue
+}
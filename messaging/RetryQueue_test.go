@@ -0,0 +1,143 @@
+package messaging_test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingMessenger is an in-memory messenger whose publications fail while it is offline
+type failingMessenger struct {
+	*messaging.InMemoryMessenger
+	offline bool
+}
+
+func (messenger *failingMessenger) Publish(address string, retained bool, message string) error {
+	if messenger.offline {
+		return errors.New("not connected")
+	}
+	return messenger.InMemoryMessenger.Publish(address, retained, message)
+}
+
+func TestRetryQueueBackoff(t *testing.T) {
+	queue := messaging.NewRetryQueue(2, time.Second, 3*time.Second)
+	published := make([]string, 0)
+	failing := true
+	publish := func(address string, retained bool, message string) error {
+		if failing {
+			return errors.New("not connected")
+		}
+		published = append(published, message)
+		return nil
+	}
+	now := time.Now()
+
+	// the oldest publication is dropped when the queue is full
+	assert.False(t, queue.Add("addr1", false, "1"))
+	assert.False(t, queue.Add("addr1", false, "2"))
+	assert.True(t, queue.Add("addr1", false, "3"))
+	assert.Equal(t, 2, queue.Depth())
+	assert.Equal(t, 1, queue.Dropped())
+
+	// the delay doubles after each failure up to the max delay
+	_, err := queue.Retry(publish, now, false)
+	assert.Error(t, err)
+	count, err := queue.Retry(publish, now.Add(500*time.Millisecond), false)
+	assert.NoError(t, err, "retry before the backoff delay is skipped")
+	assert.Equal(t, 0, count)
+	_, err = queue.Retry(publish, now.Add(time.Second), false)
+	assert.Error(t, err)
+	_, err = queue.Retry(publish, now.Add(2*time.Second), false)
+	assert.NoError(t, err, "expected a delay of 2 seconds")
+	_, err = queue.Retry(publish, now.Add(3*time.Second), false)
+	assert.Error(t, err)
+	_, err = queue.Retry(publish, now.Add(5*time.Second), false)
+	assert.NoError(t, err, "expected the delay to be capped at 3 seconds")
+
+	// a forced retry ignores the backoff and publishes in order
+	failing = false
+	count, err = queue.Retry(publish, now.Add(5*time.Second), true)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, []string{"2", "3"}, published)
+	assert.Equal(t, 0, queue.Depth())
+
+	// drop the newest publication when full
+	queue.SetDropPolicy(messaging.RetryDropNewest)
+	queue.Add("addr1", false, "4")
+	queue.Add("addr1", false, "5")
+	assert.True(t, queue.Add("addr1", false, "6"))
+	queue.Retry(publish, now.Add(5*time.Second), true)
+	assert.Equal(t, []string{"2", "3", "4", "5"}, published)
+}
+
+func TestRetryOnReconnect(t *testing.T) {
+	const addr1 = "test/pub1/node1/switch/0/$output"
+	messenger := &failingMessenger{InMemoryMessenger: messaging.NewInMemoryMessenger(&messaging.MessengerConfig{})}
+	signer := messaging.NewMessageSigner(messenger, messaging.CreateAsymKeys(), nil)
+	metrics := messaging.NewPrometheusMetrics()
+	signer.SetMetrics(metrics)
+	signer.SetRetryQueue(messaging.NewRetryQueue(2, time.Minute, time.Hour))
+
+	received := make([]string, 0)
+	signer.Subscribe(addr1, func(address string, message string) error {
+		received = append(received, message)
+		return nil
+	})
+
+	// failed publications are queued, the oldest is dropped when the queue is full
+	messenger.offline = true
+	assert.Error(t, signer.PublishSigned(addr1, false, "\"1\""))
+	assert.Error(t, signer.PublishSigned(addr1, false, "\"2\""))
+	assert.Error(t, signer.PublishEncrypted(addr1, false, "\"3\"", &messaging.CreateAsymKeys().PublicKey))
+	assert.Equal(t, 0, signer.RetryPublications())
+
+	response := httptest.NewRecorder()
+	metrics.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, response.Body.String(), "iotdomain_messages_retry_dropped_total 1\n")
+	assert.Contains(t, response.Body.String(), "iotdomain_messages_retry_queue_depth 2\n")
+
+	// the backoff delay hasn't passed but reconnecting flushes the queue
+	messenger.offline = false
+	assert.Equal(t, 0, signer.RetryPublications())
+	messenger.Connect("", "")
+	assert.Len(t, received, 2)
+
+	response = httptest.NewRecorder()
+	metrics.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, response.Body.String(), "iotdomain_messages_retry_queue_depth 0\n")
+	assert.Contains(t, response.Body.String(), "iotdomain_messages_published_total 2\n")
+}
+
+func TestRetryWithConnectHandlerAndRateLimit(t *testing.T) {
+	const addr1 = "test/pub1/node1/switch/0/$output"
+	messenger := &failingMessenger{InMemoryMessenger: messaging.NewInMemoryMessenger(&messaging.MessengerConfig{})}
+	signer := messaging.NewMessageSigner(messenger, messaging.CreateAsymKeys(), nil)
+	connectCount := 0
+	messenger.OnConnect(func() { connectCount++ })
+	queue := messaging.NewRetryQueue(10, time.Minute, time.Hour)
+	signer.SetRetryQueue(queue)
+	signer.SetRetryQueue(queue)
+
+	received := make([]string, 0)
+	signer.Subscribe(addr1, func(address string, message string) error {
+		received = append(received, message)
+		return nil
+	})
+	messenger.offline = true
+	assert.Error(t, signer.PublishSigned(addr1, false, "\"1\""))
+	assert.Error(t, signer.PublishSigned(addr1, false, "\"2\""))
+	assert.Equal(t, 2, queue.Depth())
+
+	// the retry doesn't replace the existing connect handler and is subject to the rate limiter
+	signer.SetRateLimiter(messaging.NewRateLimiter(0.001, 1, false))
+	messenger.offline = false
+	messenger.Connect("", "")
+	assert.Equal(t, 1, connectCount)
+	assert.Len(t, received, 1)
+	assert.Equal(t, 1, queue.Depth(), "publication exceeding the rate limit must remain queued")
+}
@@ -0,0 +1,79 @@
+// Package messaging with ECDH key agreement for encryption outside of the message flow
+package messaging
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	josecipher "gopkg.in/square/go-jose.v2/cipher"
+)
+
+// SharedSecretAlgorithm is the algorithm ID used in the key derivation of shared secrets.
+// The secret is used as an AES-256-GCM key, as in JWE ECDH-ES direct key agreement.
+const SharedSecretAlgorithm = "A256GCM"
+
+// SharedSecretSize is the size in bytes of a derived shared secret
+const SharedSecretSize = 32
+
+// DeriveSharedSecret derives a symmetric secret from our private key and their public key using
+// ECDH and the Concat KDF, the same primitives that are used to encrypt messages. Both parties derive
+// the same secret, eg using the node's published NodeAttrPublicKey and the publisher's private key.
+// Returns nil if a key is missing or the keys are not on the same curve.
+func DeriveSharedSecret(ourPriv *ecdsa.PrivateKey, theirPub *ecdsa.PublicKey) []byte {
+	if ourPriv == nil || theirPub == nil || theirPub.X == nil || theirPub.Y == nil {
+		return nil
+	}
+	if ourPriv.Curve != theirPub.Curve || !ourPriv.Curve.IsOnCurve(theirPub.X, theirPub.Y) {
+		return nil
+	}
+	return josecipher.DeriveECDHES(SharedSecretAlgorithm, nil, nil, ourPriv, theirPub, SharedSecretSize)
+}
+
+// EncryptWithSharedSecret encrypts data with AES-256-GCM using a secret from DeriveSharedSecret
+// The result contains the random nonce followed by the sealed data.
+func EncryptWithSharedSecret(secret []byte, plainText []byte) ([]byte, error) {
+	gcm, err := newSharedSecretCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("EncryptWithSharedSecret: Failed creating nonce: %s", err)
+	}
+	return gcm.Seal(nonce, nonce, plainText, nil), nil
+}
+
+// DecryptWithSharedSecret decrypts data encrypted with EncryptWithSharedSecret
+// Returns an error if the secret is invalid or the data is corrupted or tampered with.
+func DecryptWithSharedSecret(secret []byte, cipherText []byte) ([]byte, error) {
+	gcm, err := newSharedSecretCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	if len(cipherText) < gcm.NonceSize() {
+		return nil, errors.New("DecryptWithSharedSecret: Encrypted data is too short")
+	}
+	nonce := cipherText[:gcm.NonceSize()]
+	plainText, err := gcm.Open(nil, nonce, cipherText[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("DecryptWithSharedSecret: Decryption failed: %s", err)
+	}
+	return plainText, nil
+}
+
+// newSharedSecretCipher returns the AES-GCM cipher for a shared secret
+func newSharedSecretCipher(secret []byte) (cipher.AEAD, error) {
+	if len(secret) != SharedSecretSize {
+		return nil, fmt.Errorf("Shared secret must be %d bytes, not %d", SharedSecretSize, len(secret))
+	}
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
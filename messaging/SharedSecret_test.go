@@ -0,0 +1,81 @@
+package messaging_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// test vector keys with private key 1 and 2 on P-256
+func makeVectorKey(d int64) *ecdsa.PrivateKey {
+	privKey := &ecdsa.PrivateKey{D: big.NewInt(d)}
+	privKey.Curve = elliptic.P256()
+	privKey.X, privKey.Y = privKey.Curve.ScalarBaseMult(privKey.D.Bytes())
+	return privKey
+}
+
+// Concat KDF with SHA-256 of the x coordinate of 2G, algorithm A256GCM and 256 bit output
+const vectorSecret = "fb0ea55d2bc18a4fb005f465f7e104a5a4d9a265d1c2bb020a165611fb7a7396"
+
+// nonce 000102..0b followed by 'hello node' sealed with the vector secret
+const vectorCipherText = "000102030405060708090a0bd45a04dc312dcad2602abe23815a2b76cef0175ad3b0b8641380"
+
+func TestDeriveSharedSecretVector(t *testing.T) {
+	key1 := makeVectorKey(1)
+	key2 := makeVectorKey(2)
+	secret1 := messaging.DeriveSharedSecret(key1, &key2.PublicKey)
+	secret2 := messaging.DeriveSharedSecret(key2, &key1.PublicKey)
+	assert.Equal(t, vectorSecret, hex.EncodeToString(secret1))
+	assert.Equal(t, vectorSecret, hex.EncodeToString(secret2))
+
+	secret, _ := hex.DecodeString(vectorSecret)
+	cipherText, _ := hex.DecodeString(vectorCipherText)
+	plainText, err := messaging.DecryptWithSharedSecret(secret, cipherText)
+	require.NoError(t, err)
+	assert.Equal(t, "hello node", string(plainText))
+}
+
+func TestEncryptWithSharedSecret(t *testing.T) {
+	const data = "bulk data for a node"
+	publisherKey := messaging.CreateAsymKeys()
+	nodeKey := messaging.CreateAsymKeys()
+
+	// the node public key is obtained from its published attribute
+	nodePub := messaging.PublicKeyFromPem(messaging.PublicKeyToPem(&nodeKey.PublicKey))
+	secret := messaging.DeriveSharedSecret(publisherKey, nodePub)
+	require.Len(t, secret, messaging.SharedSecretSize)
+	cipherText, err := messaging.EncryptWithSharedSecret(secret, []byte(data))
+	require.NoError(t, err)
+	assert.NotContains(t, string(cipherText), data)
+
+	nodeSecret := messaging.DeriveSharedSecret(nodeKey, &publisherKey.PublicKey)
+	plainText, err := messaging.DecryptWithSharedSecret(nodeSecret, cipherText)
+	require.NoError(t, err)
+	assert.Equal(t, data, string(plainText))
+
+	// another key can't decrypt
+	otherSecret := messaging.DeriveSharedSecret(messaging.CreateAsymKeys(), &publisherKey.PublicKey)
+	_, err = messaging.DecryptWithSharedSecret(otherSecret, cipherText)
+	assert.Error(t, err)
+
+	// tampered data fails
+	cipherText[len(cipherText)-1] ^= 1
+	_, err = messaging.DecryptWithSharedSecret(nodeSecret, cipherText)
+	assert.Error(t, err)
+
+	// invalid parameters
+	assert.Nil(t, messaging.DeriveSharedSecret(publisherKey, nil))
+	otherCurveKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.Nil(t, messaging.DeriveSharedSecret(publisherKey, &otherCurveKey.PublicKey))
+	_, err = messaging.EncryptWithSharedSecret([]byte("short"), []byte(data))
+	assert.Error(t, err)
+	_, err = messaging.DecryptWithSharedSecret(secret, []byte("short"))
+	assert.Error(t, err)
+}
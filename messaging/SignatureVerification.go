@@ -0,0 +1,158 @@
+// Package messaging - Detailed result of message signature verification for auditing
+package messaging
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// ErrUnknownSender is returned when the public key of the sender of a signed message isn't known
+var ErrUnknownSender = errors.New("no public key available for sender")
+
+// ErrPublicKeyLookup is returned when the lookup of the public key of the sender panics
+var ErrPublicKeyLookup = errors.New("public key lookup failed")
+
+// TrustLevel of a received message, based on its signature
+type TrustLevel string
+
+// Trust levels of received messages
+const (
+	TrustUnsigned         TrustLevel = "unsigned"         // the message isn't signed
+	TrustSignedUnverified TrustLevel = "signedUnverified" // the message is signed but the sender's key is unknown
+	TrustVerified         TrustLevel = "verified"         // the signature is verified with the sender's public key
+)
+
+// SignatureVerification holds the result of verifying a message signature with the context of
+// the verification. Intended for security auditing of received messages.
+type SignatureVerification struct {
+	IsSigned  bool   // the message has a JWS signature
+	Verified  bool   // the signature is verified with the public key of the sender
+	Sender    string // the sender the message claims to be from, even if verification failed
+	KeyID     string // fingerprint of the public key used for verification, see PublicKeyFingerprint
+	Algorithm string // JWS algorithm of the signature, eg ES256
+	Skipped   bool   // verification is skipped as the message is on an unverified address
+	Err       error  // the reason the message failed to verify, or nil
+}
+
+// TrustLevel returns the trust level of the verified message
+func (result SignatureVerification) TrustLevel() TrustLevel {
+	if result.Verified {
+		return TrustVerified
+	} else if result.IsSigned {
+		return TrustSignedUnverified
+	}
+	return TrustUnsigned
+}
+
+// VerifySignatureDetailed verifies a message like VerifySenderJWSSignatureAlg and returns the
+// result with the sender, key and algorithm involved in the verification.
+// A signed message is only Verified if the public key of the sender is available. Without
+// getPublicKey the signature isn't verified and no error is returned. Messages that exceed the
+// limits of SetMaxMessageSize are rejected before they are parsed.
+//  rawMessage is the signed or unsigned message. It is json unmarshalled into the given object.
+//  getPublicKey returns the public key of the sender address. Use nil to skip verification.
+//  allowedAlgorithms are the accepted JWS algorithms. See DefaultAllowedAlgorithms.
+func VerifySignatureDetailed(rawMessage string, object interface{},
+	getPublicKey func(address string) *ecdsa.PublicKey, allowedAlgorithms []string) SignatureVerification {
+
+	result := SignatureVerification{}
+	if result.Err = checkMessageLimits(rawMessage); result.Err != nil {
+		return result
+	}
+	jwsSignature, err := jose.ParseSigned(rawMessage)
+	if err != nil {
+		// message is (probably) not signed, try to unmarshal it directly
+		result.Err = json.Unmarshal([]byte(rawMessage), object)
+		return result
+	}
+	result.IsSigned = true
+	if len(jwsSignature.Signatures) > 0 {
+		result.Algorithm = jwsSignature.Signatures[0].Header.Algorithm
+	}
+	payload := jwsSignature.UnsafePayloadWithoutVerification()
+	err = json.Unmarshal([]byte(payload), object)
+	if err != nil {
+		// message doesn't have a json payload
+		errTxt := fmt.Sprintf("VerifySenderSignature: Signature okay but message unmarshal failed: %s", err)
+		result.Err = errors.New(errTxt)
+		return result
+	}
+	// determine who the sender is
+	reflObject := reflect.ValueOf(object).Elem()
+	reflSender := reflObject.FieldByName("Sender")
+	if !reflSender.IsValid() {
+		reflSender = reflObject.FieldByName("Address")
+		if !reflSender.IsValid() {
+			result.Err = errors.New("VerifySenderJWSSignature: object doesn't have a Sender or Address field")
+			return result
+		}
+	}
+	result.Sender = reflSender.String()
+	if result.Sender == "" {
+		result.Err = errors.New("VerifySenderJWSSignature: Missing sender or address information in message")
+		return result
+	}
+	// the sender is known so a rejected algorithm can be reported with its sender
+	err = verifyJWSAlgorithm(jwsSignature, allowedAlgorithms)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	// verify the message signature using the sender's public key
+	if getPublicKey == nil {
+		return result
+	}
+	publicKey, err := getPublicKeySafe(getPublicKey, result.Sender)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if publicKey == nil {
+		result.Err = fmt.Errorf("VerifySenderJWSSignature: %w: %s", ErrUnknownSender, result.Sender)
+		return result
+	}
+	result.KeyID = PublicKeyFingerprint(publicKey)
+
+	_, err = jwsSignature.Verify(publicKey)
+	if err != nil {
+		msg := fmt.Sprintf("VerifySenderJWSSignature: message signature from %s fails to verify with its public key", result.Sender)
+		result.Err = errors.New(msg)
+		return result
+	}
+	result.Verified = true
+	return result
+}
+
+// VerifySignedMessageDetailed parses and verifies the message signature like VerifySignedMessage
+// and returns the result with the context of the verification. Verification is always strict: a
+// message from an unknown sender fails with ErrUnknownSender, regardless of SetPermissive.
+// Failed verification is not logged here but by the subscriber that discards the message.
+func (signer *MessageSigner) VerifySignedMessageDetailed(rawMessage string, object interface{}) SignatureVerification {
+	result := VerifySignatureDetailed(rawMessage, object, signer.GetPublicKey, signer.AllowedAlgorithms())
+	signer.countReceived(result.Err)
+	return result
+}
+
+// getPublicKeySafe invokes the getPublicKey callback and recovers from a panic in the callback, so
+// a buggy callback can't take down the subscriber. The panic is logged with its stack trace.
+// Returns ErrPublicKeyLookup if the callback panics
+func getPublicKeySafe(getPublicKey func(address string) *ecdsa.PublicKey, sender string) (
+	publicKey *ecdsa.PublicKey, err error) {
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			logrus.Errorf("VerifySenderJWSSignature: Public key lookup of sender %s panicked: %v\n%s",
+				sender, recovered, debug.Stack())
+			publicKey = nil
+			err = fmt.Errorf("VerifySenderJWSSignature: %w for sender %s: %v", ErrPublicKeyLookup, sender, recovered)
+		}
+	}()
+	return getPublicKey(sender), nil
+}
@@ -0,0 +1,176 @@
+package messaging_test
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifySignatureDetailed(t *testing.T) {
+	privKey := messaging.CreateAsymKeys()
+	otherKey := messaging.CreateAsymKeys()
+	payload, _ := json.Marshal(testObject)
+	signed, err := messaging.CreateJWSSignature(string(payload), privKey)
+	assert.NoError(t, err)
+	var received TestObjectWithSender
+
+	result := messaging.VerifySignatureDetailed(signed, &received, func(address string) *ecdsa.PublicKey {
+		return &privKey.PublicKey
+	}, messaging.DefaultAllowedAlgorithms)
+	assert.NoError(t, result.Err)
+	assert.True(t, result.IsSigned)
+	assert.True(t, result.Verified)
+	assert.Equal(t, Pub1Address, result.Sender)
+	assert.Equal(t, "ES256", result.Algorithm)
+	assert.Equal(t, messaging.PublicKeyFingerprint(&privKey.PublicKey), result.KeyID)
+	assert.Equal(t, 64, len(result.KeyID))
+
+	// the claimed sender and key are reported when verification fails
+	result = messaging.VerifySignatureDetailed(signed, &received, func(address string) *ecdsa.PublicKey {
+		return &otherKey.PublicKey
+	}, messaging.DefaultAllowedAlgorithms)
+	assert.Error(t, result.Err)
+	assert.True(t, result.IsSigned)
+	assert.False(t, result.Verified)
+	assert.Equal(t, Pub1Address, result.Sender)
+	assert.Equal(t, messaging.PublicKeyFingerprint(&otherKey.PublicKey), result.KeyID)
+
+	// disallowed algorithm
+	result = messaging.VerifySignatureDetailed(signed, &received, nil, []string{"ES384"})
+	assert.Error(t, result.Err)
+	assert.Equal(t, "ES256", result.Algorithm)
+	assert.False(t, result.Verified)
+
+	// without public keys the signature isn't verified
+	result = messaging.VerifySignatureDetailed(signed, &received, nil, messaging.DefaultAllowedAlgorithms)
+	assert.NoError(t, result.Err)
+	assert.True(t, result.IsSigned)
+	assert.False(t, result.Verified)
+
+	// unsigned
+	result = messaging.VerifySignatureDetailed(string(payload), &received, nil, messaging.DefaultAllowedAlgorithms)
+	assert.NoError(t, result.Err)
+	assert.False(t, result.IsSigned)
+
+	// the simple function wraps the detailed result
+	messenger := messaging.NewInMemoryMessenger(&messaging.MessengerConfig{})
+	signer := messaging.NewMessageSigner(messenger, privKey, func(address string) *ecdsa.PublicKey {
+		return &privKey.PublicKey
+	})
+	isSigned, err := signer.VerifySignedMessage(signed, &received)
+	assert.NoError(t, err)
+	assert.True(t, isSigned)
+	assert.Equal(t, "", messaging.PublicKeyFingerprint(nil))
+}
+
+func TestPermissiveVerification(t *testing.T) {
+	const addr1 = "test/pub1/node1/temperature/0/$latest"
+	messenger := messaging.NewInMemoryMessenger(&messaging.MessengerConfig{})
+	pub1Key := messaging.CreateAsymKeys()
+	otherKey := messaging.CreateAsymKeys()
+	var pubKey *ecdsa.PublicKey
+	pub1Signer := messaging.NewMessageSigner(messenger, pub1Key, nil)
+	subscriber := messaging.NewMessageSigner(messenger, nil, func(address string) *ecdsa.PublicKey {
+		return pubKey
+	})
+	assert.False(t, subscriber.IsPermissive())
+
+	signed, _ := pub1Signer.SignObject(&types.OutputLatestMessage{Address: addr1, Value: "1"})
+	var latest types.OutputLatestMessage
+
+	// strict: unknown senders are rejected
+	result := subscriber.VerifySignedMessageDetailed(signed, &latest)
+	assert.True(t, errors.Is(result.Err, messaging.ErrUnknownSender))
+	assert.Equal(t, messaging.TrustSignedUnverified, result.TrustLevel())
+
+	// permissive mode doesn't apply to decoding, which is used by command handlers
+	subscriber.SetPermissive(true)
+	assert.True(t, subscriber.IsPermissive())
+	result = subscriber.VerifySignedMessageDetailed(signed, &latest)
+	assert.True(t, errors.Is(result.Err, messaging.ErrUnknownSender))
+	_, isSigned, err := subscriber.DecodeMessage(signed, &latest)
+	assert.True(t, errors.Is(err, messaging.ErrUnknownSender))
+	assert.True(t, isSigned)
+	_, result = subscriber.DecodeMessageDetailed(signed, &latest)
+	assert.Equal(t, messaging.TrustSignedUnverified, result.TrustLevel())
+
+	// known senders are verified and invalid signatures are still rejected
+	pubKey = &pub1Key.PublicKey
+	result = subscriber.VerifySignedMessageDetailed(signed, &latest)
+	assert.NoError(t, result.Err)
+	assert.Equal(t, messaging.TrustVerified, result.TrustLevel())
+	pubKey = &otherKey.PublicKey
+	result = subscriber.VerifySignedMessageDetailed(signed, &latest)
+	assert.Error(t, result.Err)
+
+	// only subscriptions with trust levels accept unknown senders and unsigned messages
+	pubKey = nil
+	verifiedCount := 0
+	subscriber.SubscribeVerified(addr1, func() interface{} { return &types.OutputLatestMessage{} },
+		func(address string, object interface{}) error {
+			verifiedCount++
+			return nil
+		})
+	var rxTrust []messaging.TrustLevel
+	subscriber.SubscribeWithTrust(addr1, func() interface{} { return &types.OutputLatestMessage{} },
+		func(address string, object interface{}, trust messaging.TrustLevel) error {
+			rxTrust = append(rxTrust, trust)
+			return nil
+		})
+	pub1Signer.PublishObject(addr1, false, &types.OutputLatestMessage{Address: addr1, Value: "2"}, nil)
+	pub1Signer.SetSignMessages(false)
+	pub1Signer.PublishObject(addr1, false, &types.OutputLatestMessage{Address: addr1, Value: "3"}, nil)
+	assert.Equal(t, 0, verifiedCount)
+	assert.Equal(t, []messaging.TrustLevel{messaging.TrustSignedUnverified, messaging.TrustUnsigned}, rxTrust)
+
+	// strict subscriptions with trust levels reject them
+	subscriber.SetPermissive(false)
+	pub1Signer.PublishObject(addr1, false, &types.OutputLatestMessage{Address: addr1, Value: "4"}, nil)
+	pub1Signer.SetSignMessages(true)
+	pub1Signer.PublishObject(addr1, false, &types.OutputLatestMessage{Address: addr1, Value: "5"}, nil)
+	assert.Len(t, rxTrust, 2)
+	pubKey = &pub1Key.PublicKey
+	pub1Signer.PublishObject(addr1, false, &types.OutputLatestMessage{Address: addr1, Value: "6"}, nil)
+	assert.Equal(t, 1, verifiedCount)
+	assert.Equal(t, messaging.TrustVerified, rxTrust[2])
+}
+
+func TestPublicKeyLookupPanic(t *testing.T) {
+	const addr1 = "test/pub1/node1/temperature/0/$latest"
+	messenger := messaging.NewInMemoryMessenger(&messaging.MessengerConfig{})
+	pub1Key := messaging.CreateAsymKeys()
+	var knownKeys map[string]*ecdsa.PublicKey
+	pub1Signer := messaging.NewMessageSigner(messenger, pub1Key, nil)
+	subscriber := messaging.NewMessageSigner(messenger, nil, func(address string) *ecdsa.PublicKey {
+		// writing to a nil map panics
+		knownKeys[address] = nil
+		return nil
+	})
+	signed, _ := pub1Signer.SignObject(&types.OutputLatestMessage{Address: addr1, Value: "1"})
+	var latest types.OutputLatestMessage
+
+	// the panic is returned as a verification error
+	var result messaging.SignatureVerification
+	assert.NotPanics(t, func() {
+		result = subscriber.VerifySignedMessageDetailed(signed, &latest)
+	})
+	assert.True(t, errors.Is(result.Err, messaging.ErrPublicKeyLookup))
+	assert.False(t, result.Verified)
+
+	// the subscription survives
+	rxCount := 0
+	subscriber.SubscribeVerified(addr1, func() interface{} { return &types.OutputLatestMessage{} },
+		func(address string, object interface{}) error {
+			rxCount++
+			return nil
+		})
+	assert.NotPanics(t, func() {
+		pub1Signer.PublishObject(addr1, false, &types.OutputLatestMessage{Address: addr1, Value: "2"}, nil)
+	})
+	assert.Equal(t, 0, rxCount)
+}
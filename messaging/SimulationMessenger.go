@@ -0,0 +1,64 @@
+// Package messaging - Simulation messenger that captures publications for inspection
+package messaging
+
+import (
+	"sync"
+)
+
+// PublishedMessage with the address and serialized payload of a captured publication
+type PublishedMessage struct {
+	Address  string // publication address
+	Retained bool   // publication was retained
+	Message  string // the exact payload as it would be sent, eg signed JWS
+}
+
+// SimulationMessenger implements IMessenger for a dry-run of a publisher without a message bus.
+// Publications are captured in order instead of being sent and are not delivered to subscribers.
+// Use SimulateMessage to feed synthetic messages to the subscriptions. Subscriptions are handled
+// by the embedded InMemoryMessenger. Safe for concurrent use.
+type SimulationMessenger struct {
+	*InMemoryMessenger
+	published    []PublishedMessage // captured publications in order of publishing
+	publishMutex *sync.Mutex        // mutex for concurrent publishing
+}
+
+// ClearPublishedMessages removes all captured publications
+func (messenger *SimulationMessenger) ClearPublishedMessages() {
+	messenger.publishMutex.Lock()
+	defer messenger.publishMutex.Unlock()
+	messenger.published = make([]PublishedMessage, 0)
+}
+
+// GetPublishedMessages returns a copy of the captured publications in order of publishing
+func (messenger *SimulationMessenger) GetPublishedMessages() []PublishedMessage {
+	messenger.publishMutex.Lock()
+	defer messenger.publishMutex.Unlock()
+	published := make([]PublishedMessage, len(messenger.published))
+	copy(published, messenger.published)
+	return published
+}
+
+// Publish captures the message instead of sending it
+func (messenger *SimulationMessenger) Publish(address string, retained bool, message string) error {
+	messenger.publishMutex.Lock()
+	defer messenger.publishMutex.Unlock()
+	messenger.published = append(messenger.published,
+		PublishedMessage{Address: address, Retained: retained, Message: message})
+	return nil
+}
+
+// SimulateMessage delivers a synthetic message to the subscriptions with a matching address
+// Returns the number of handlers the message was delivered to
+func (messenger *SimulationMessenger) SimulateMessage(address string, message string) int {
+	return messenger.deliver(address, message)
+}
+
+// NewSimulationMessenger creates a messenger that captures publications instead of sending them
+func NewSimulationMessenger(config *MessengerConfig) *SimulationMessenger {
+	messenger := &SimulationMessenger{
+		InMemoryMessenger: NewInMemoryMessenger(config),
+		published:         make([]PublishedMessage, 0),
+		publishMutex:      &sync.Mutex{},
+	}
+	return messenger
+}
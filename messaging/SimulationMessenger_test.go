@@ -0,0 +1,43 @@
+package messaging_test
+
+import (
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulationMessenger(t *testing.T) {
+	const addr1 = "test/pub1/node1/$node"
+	rxCount := 0
+	handler := func(address string, message string) error {
+		rxCount++
+		return nil
+	}
+	messenger := messaging.NewMessenger(&messaging.MessengerConfig{Messenger: "SimulationMessenger"})
+	sim, isSim := messenger.(*messaging.SimulationMessenger)
+	require.True(t, isSim)
+	sim.Connect("", "")
+	sim.Subscribe("test/+/+/$node", handler)
+
+	// publications are captured and not delivered
+	sim.Publish(addr1, true, "message1")
+	sim.Publish(addr1, false, "message2")
+	assert.Equal(t, 0, rxCount)
+	published := sim.GetPublishedMessages()
+	require.Equal(t, 2, len(published))
+	assert.Equal(t, messaging.PublishedMessage{Address: addr1, Retained: true, Message: "message1"}, published[0])
+	assert.Equal(t, "message2", published[1].Message)
+
+	// synthetic messages are delivered to matching subscriptions
+	assert.Equal(t, 1, sim.SimulateMessage(addr1, "message3"))
+	assert.Equal(t, 1, rxCount)
+	assert.Equal(t, 0, sim.SimulateMessage("test/pub1/$identity", "message4"))
+
+	sim.Unsubscribe("test/+/+/$node", handler)
+	assert.Equal(t, 0, sim.SimulateMessage(addr1, "message3"))
+	sim.ClearPublishedMessages()
+	assert.Equal(t, 0, len(sim.GetPublishedMessages()))
+	sim.Disconnect()
+}
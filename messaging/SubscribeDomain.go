@@ -0,0 +1,134 @@
+// Package messaging - Subscribe to messages of all publishers in a domain using wildcard addresses
+package messaging
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/iotdomain/iotdomain-go/types"
+)
+
+// MakeDomainWildcardAddress returns the wildcard address to subscribe to a message type of all
+// publishers in a domain. Use "" as domain to subscribe to all domains.
+// The supported wildcard patterns are:
+//  domain/+/$identity, domain/+/$status                   for publisher messages
+//  domain/+/+/$node, domain/+/+/$configure, ...          for node messages
+//  domain/+/+/+/+/$latest, domain/+/+/+/+/$output, ...   for input and output messages
+func MakeDomainWildcardAddress(domain string, messageType types.MessageType) string {
+	if domain == "" {
+		domain = "+"
+	}
+	segments := &types.AddressSegments{Domain: domain, PublisherID: "+", MessageType: messageType}
+	switch messageType {
+	case types.MessageTypeIdentity, types.MessageTypeSetIdentity, types.MessageTypeStatus:
+	case types.MessageTypeConfigure, types.MessageTypeCreate, types.MessageTypeDelete, types.MessageTypeEvent,
+		types.MessageTypeNodeDiscovery, types.MessageTypeSetNodeID, types.MessageTypeUpgrade:
+		segments.NodeID = "+"
+	default:
+		segments.NodeID = "+"
+		segments.OutputType = "+"
+		segments.Instance = "+"
+	}
+	return types.MakeAddress(segments)
+}
+
+// SubscribeDomain subscribes to a message type from all publishers in a domain.
+// See MakeDomainWildcardAddress for the supported wildcard patterns.
+//  newObject returns a pointer to a new instance of the message type to decode into
+//  handler is invoked with the decoded object of each message that passes verification
+// Returns the ID of the subscription for use with UnsubscribeByID
+func (signer *MessageSigner) SubscribeDomain(domain string, messageType types.MessageType,
+	newObject func() interface{}, handler func(address string, object interface{}) error) SubscriptionID {
+
+	return signer.SubscribeVerified(MakeDomainWildcardAddress(domain, messageType), newObject, handler)
+}
+
+// SubscribeVerified subscribes to an address with optional wildcards and verifies each received message
+// before passing the decoded object to the handler.
+// With wildcards, messages on the same subscription come from different senders. Therefore the
+// sender's public key is resolved for each received message and the address in the message must
+// match the address the message is received on. Messages that fail verification are discarded.
+// If signing is enabled then unsigned messages are discarded. Verification is always strict, see
+// SubscribeWithTrust for permissive verification.
+// Messages on unverified addresses are unmarshalled without verification, see SetUnverifiedAddresses.
+//  newObject returns a pointer to a new instance of the message type to decode into
+//  handler is invoked with the decoded object of each message that passes verification
+// Returns the ID of the subscription for use with UnsubscribeByID
+func (signer *MessageSigner) SubscribeVerified(address string,
+	newObject func() interface{}, handler func(address string, object interface{}) error) SubscriptionID {
+
+	return signer.SubscribeVerifiedWithHops(address, newObject,
+		func(address string, object interface{}, hops int) error {
+			return handler(address, object)
+		})
+}
+
+// SubscribeVerifiedWithHops subscribes to an address like SubscribeVerified and passes the hop count
+// of the message to the handler. Messages that loop are discarded, see ForwardObject.
+//  handler is invoked with the decoded object and the nr of times the message was forwarded
+// Returns the ID of the subscription for use with UnsubscribeByID
+func (signer *MessageSigner) SubscribeVerifiedWithHops(address string,
+	newObject func() interface{}, handler func(address string, object interface{}, hops int) error) SubscriptionID {
+
+	return signer.subscribeVerified(address, newObject, false,
+		func(address string, object interface{}, hops int, trust TrustLevel) error {
+			return handler(address, object, hops)
+		})
+}
+
+// SubscribeWithTrust subscribes to an address like SubscribeVerified and passes the trust level of
+// each message to the handler. This is the only subscription that applies permissive verification,
+// see SetPermissive. In permissive mode messages from unknown senders are passed with trust level
+// TrustSignedUnverified and unsigned messages with TrustUnsigned. Don't use it for commands.
+//  handler is invoked with the decoded object and its trust level
+// Returns the ID of the subscription for use with UnsubscribeByID
+func (signer *MessageSigner) SubscribeWithTrust(address string,
+	newObject func() interface{}, handler func(address string, object interface{}, trust TrustLevel) error) SubscriptionID {
+
+	return signer.subscribeVerified(address, newObject, true,
+		func(address string, object interface{}, hops int, trust TrustLevel) error {
+			return handler(address, object, trust)
+		})
+}
+
+// subscribeVerified subscribes to an address and verifies each received message. Permissive
+// verification is only applied if allowPermissive is set.
+func (signer *MessageSigner) subscribeVerified(address string, newObject func() interface{}, allowPermissive bool,
+	handler func(address string, object interface{}, hops int, trust TrustLevel) error) SubscriptionID {
+
+	return signer.Subscribe(address, func(rxAddress string, rawMessage string) error {
+		object := newObject()
+		_, result := signer.DecodeMessageOnAddress(rxAddress, rawMessage, object)
+		if result.Skipped && result.Err != nil {
+			return fmt.Errorf("SubscribeVerified: message on %s discarded: %w", rxAddress, result.Err)
+		} else if result.Skipped {
+			return handler(rxAddress, object, 0, TrustUnsigned)
+		}
+		permissive := allowPermissive && signer.IsPermissive()
+		if permissive && errors.Is(result.Err, ErrUnknownSender) {
+			signer.logger.Infof("SubscribeVerified: Accepted message on %s from '%s' with trust level %s",
+				rxAddress, result.Sender, result.TrustLevel())
+			result.Err = nil
+		}
+		if result.Err != nil {
+			signer.logger.Warningf("SubscribeVerified: Message on %s discarded: %s", rxAddress, result.Err)
+			return result.Err
+		} else if signer.SignMessages() && !permissive && !result.IsSigned {
+			signer.logger.Warningf("SubscribeVerified: Unsigned message on %s discarded", rxAddress)
+			return fmt.Errorf("SubscribeVerified: message on %s is not signed", rxAddress)
+		}
+		// a message signed by one publisher must not be accepted on the address of another
+		reflAddress := reflect.ValueOf(object).Elem().FieldByName("Address")
+		if reflAddress.IsValid() && reflAddress.String() != rxAddress {
+			signer.logger.Warningf("SubscribeVerified: Message address %s doesn't match %s. Message discarded",
+				reflAddress.String(), rxAddress)
+			return fmt.Errorf("SubscribeVerified: message address doesn't match %s", rxAddress)
+		}
+		hops, err := signer.checkLoop(rxAddress, rawMessage)
+		if err != nil {
+			return err
+		}
+		return handler(rxAddress, object, hops, result.TrustLevel())
+	})
+}
@@ -0,0 +1,65 @@
+package messaging_test
+
+import (
+	"crypto/ecdsa"
+	"strings"
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMakeDomainWildcardAddress(t *testing.T) {
+	assert.Equal(t, "test/+/$identity", messaging.MakeDomainWildcardAddress("test", types.MessageTypeIdentity))
+	assert.Equal(t, "test/+/+/$node", messaging.MakeDomainWildcardAddress("test", types.MessageTypeNodeDiscovery))
+	assert.Equal(t, "test/+/+/+/+/$latest", messaging.MakeDomainWildcardAddress("test", types.MessageTypeLatest))
+	assert.Equal(t, "+/+/+/+/+/$raw", messaging.MakeDomainWildcardAddress("", types.MessageTypeRaw))
+}
+
+func TestSubscribeDomain(t *testing.T) {
+	const addr1 = "test/pub1/node1/temperature/0/$latest"
+	const addr2 = "test/pub2/node1/temperature/0/$latest"
+	messenger := messaging.NewInMemoryMessenger(&messaging.MessengerConfig{})
+	pub1Key := messaging.CreateAsymKeys()
+	pub2Key := messaging.CreateAsymKeys()
+	// each message is verified with the key of its sender
+	getPublicKey := func(address string) *ecdsa.PublicKey {
+		if strings.HasPrefix(address, "test/pub1/") {
+			return &pub1Key.PublicKey
+		} else if strings.HasPrefix(address, "test/pub2/") {
+			return &pub2Key.PublicKey
+		}
+		return nil
+	}
+	pub1Signer := messaging.NewMessageSigner(messenger, pub1Key, nil)
+	pub2Signer := messaging.NewMessageSigner(messenger, pub2Key, nil)
+	subscriber := messaging.NewMessageSigner(messenger, nil, getPublicKey)
+
+	received := make(map[string]string)
+	subscriber.SubscribeDomain("test", types.MessageTypeLatest,
+		func() interface{} { return &types.OutputLatestMessage{} },
+		func(address string, object interface{}) error {
+			received[address] = object.(*types.OutputLatestMessage).Value
+			return nil
+		})
+
+	pub1Signer.PublishObject(addr1, false, &types.OutputLatestMessage{Address: addr1, Value: "1"}, nil)
+	pub2Signer.PublishObject(addr2, false, &types.OutputLatestMessage{Address: addr2, Value: "2"}, nil)
+	assert.Equal(t, "1", received[addr1])
+	assert.Equal(t, "2", received[addr2])
+
+	// pub2 can't publish on behalf of pub1
+	pub2Signer.PublishObject(addr1, false, &types.OutputLatestMessage{Address: addr1, Value: "fake"}, nil)
+	assert.Equal(t, "1", received[addr1])
+	// a correctly signed message from pub2 isn't accepted on the address of pub1
+	pub2Signer.PublishObject(addr1, false, &types.OutputLatestMessage{Address: addr2, Value: "fake"}, nil)
+	assert.Equal(t, "1", received[addr1])
+	// unsigned messages are discarded
+	pub1Signer.SetSignMessages(false)
+	pub1Signer.PublishObject(addr1, false, &types.OutputLatestMessage{Address: addr1, Value: "unsigned"}, nil)
+	assert.Equal(t, "1", received[addr1])
+	// other message types are not received
+	pub2Signer.PublishObject("test/pub2/node1/$node", false, &types.OutputLatestMessage{Address: "test/pub2/node1/$node"}, nil)
+	assert.Len(t, received, 2)
+}
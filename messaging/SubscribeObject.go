@@ -0,0 +1,66 @@
+// Package messaging - Subscribe to messages that are decoded into objects
+package messaging
+
+import (
+	"errors"
+	"reflect"
+)
+
+// SubscribeObject subscribes to an address and decodes each received message into a new object of
+// the type of the prototype. The message is decrypted if needed and its signature is verified.
+// Messages that fail to decrypt, decode or verify, or that loop, are discarded. Unsigned messages and messages
+// that can't be verified because the sender's public key is unknown are passed to the handler
+// as unverified, so the handler decides whether to accept them.
+// Messages on unverified addresses are decoded without verification, see SetUnverifiedAddresses.
+//  address to subscribe to, with optional wildcards
+//  prototype is an instance, or pointer to an instance, of the message type, eg &types.OutputLatestMessage{}
+//  handler is invoked with a pointer to the decoded object and whether its signature is verified
+func (signer *MessageSigner) SubscribeObject(address string, prototype interface{},
+	handler func(address string, object interface{}, verified bool)) {
+
+	objectType := reflect.TypeOf(prototype)
+	if objectType.Kind() == reflect.Ptr {
+		objectType = objectType.Elem()
+	}
+	signer.Subscribe(address, func(rxAddress string, rawMessage string) error {
+		object := reflect.New(objectType).Interface()
+		if err := checkMessageLimits(rawMessage); err != nil {
+			signer.countReceived(err)
+			signer.logger.Warningf("SubscribeObject: Message on %s discarded: %s", rxAddress, err)
+			return err
+		}
+		if result, isUnverified := signer.decodeUnverified(rxAddress, rawMessage, object); isUnverified {
+			if result.Err != nil {
+				signer.logger.Warningf("SubscribeObject: Message on %s discarded: %s", rxAddress, result.Err)
+				return result.Err
+			}
+			handler(rxAddress, object, false)
+			return nil
+		}
+		// DecryptMessage also returns an error for messages that aren't encrypted
+		message, isEncrypted, err := DecryptMessage(rawMessage, signer.privateKey)
+		if isEncrypted && err != nil {
+			if metrics := signer.getMetrics(); metrics != nil {
+				metrics.IncDecryptFailed()
+			}
+			signer.countReceived(err)
+			signer.logger.Warningf("SubscribeObject: Message on %s discarded: %s", rxAddress, err)
+			return err
+		}
+		result := VerifySignatureDetailed(message, object, signer.GetPublicKey, signer.AllowedAlgorithms())
+		// an unknown sender is reported as unverified instead of discarding the message
+		if errors.Is(result.Err, ErrUnknownSender) {
+			result.Err = nil
+		}
+		signer.countReceived(result.Err)
+		if result.Err != nil {
+			signer.logger.Warningf("SubscribeObject: Message on %s discarded: %s", rxAddress, result.Err)
+			return result.Err
+		}
+		if _, err = signer.checkLoop(rxAddress, rawMessage); err != nil {
+			return err
+		}
+		handler(rxAddress, object, result.Verified)
+		return nil
+	})
+}
@@ -0,0 +1,87 @@
+package messaging_test
+
+import (
+	"crypto/ecdsa"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscribeObject(t *testing.T) {
+	const addr1 = "test/pub1/node1/temperature/0/$latest"
+	messenger := messaging.NewInMemoryMessenger(&messaging.MessengerConfig{})
+	pub1Key := messaging.CreateAsymKeys()
+	otherKey := messaging.CreateAsymKeys()
+	pubKey := &pub1Key.PublicKey
+	pub1Signer := messaging.NewMessageSigner(messenger, pub1Key, nil)
+	subscriberKey := messaging.CreateAsymKeys()
+	subscriber := messaging.NewMessageSigner(messenger, subscriberKey, func(address string) *ecdsa.PublicKey {
+		return pubKey
+	})
+	metrics := messaging.NewPrometheusMetrics()
+	subscriber.SetMetrics(metrics)
+
+	var rxLatest *types.OutputLatestMessage
+	rxVerified := false
+	rxCount := 0
+	subscriber.SubscribeObject(addr1, types.OutputLatestMessage{},
+		func(address string, object interface{}, verified bool) {
+			rxCount++
+			rxLatest = object.(*types.OutputLatestMessage)
+			rxVerified = verified
+		})
+
+	pub1Signer.PublishObject(addr1, false, &types.OutputLatestMessage{Address: addr1, Value: "1"}, nil)
+	require.Equal(t, 1, rxCount)
+	assert.Equal(t, "1", rxLatest.Value)
+	assert.True(t, rxVerified)
+
+	// each message is decoded into a new object
+	previous := rxLatest
+	pub1Signer.PublishObject(addr1, false, &types.OutputLatestMessage{Address: addr1, Value: "2"}, nil)
+	assert.Equal(t, "2", rxLatest.Value)
+	assert.Equal(t, "1", previous.Value)
+
+	// unsigned messages are not verified
+	pub1Signer.SetSignMessages(false)
+	pub1Signer.PublishObject(addr1, false, &types.OutputLatestMessage{Address: addr1, Value: "3"}, nil)
+	assert.Equal(t, 3, rxCount)
+	assert.Equal(t, "3", rxLatest.Value)
+	assert.False(t, rxVerified)
+	pub1Signer.SetSignMessages(true)
+
+	// messages from unknown senders are not verified
+	pubKey = nil
+	pub1Signer.PublishObject(addr1, false, &types.OutputLatestMessage{Address: addr1, Value: "4"}, nil)
+	assert.Equal(t, 4, rxCount)
+	assert.False(t, rxVerified)
+
+	// messages that fail verification are discarded
+	pubKey = &otherKey.PublicKey
+	pub1Signer.PublishObject(addr1, false, &types.OutputLatestMessage{Address: addr1, Value: "5"}, nil)
+	assert.Equal(t, 4, rxCount)
+	messenger.Publish(addr1, false, "not json")
+	assert.Equal(t, 4, rxCount)
+
+	// plain messages aren't counted as decrypt failures
+	response := httptest.NewRecorder()
+	metrics.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, response.Body.String(), "iotdomain_messages_decrypt_failed_total 0\n")
+
+	// encrypted messages are decrypted and messages that fail to decrypt are discarded
+	pubKey = &pub1Key.PublicKey
+	pub1Signer.PublishObject(addr1, false, &types.OutputLatestMessage{Address: addr1, Value: "6"},
+		&subscriberKey.PublicKey)
+	assert.Equal(t, 5, rxCount)
+	assert.Equal(t, "6", rxLatest.Value)
+	pub1Signer.PublishObject(addr1, false, &types.OutputLatestMessage{Address: addr1, Value: "7"},
+		&otherKey.PublicKey)
+	assert.Equal(t, 5, rxCount)
+	response = httptest.NewRecorder()
+	metrics.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, response.Body.String(), "iotdomain_messages_decrypt_failed_total 1\n")
+}
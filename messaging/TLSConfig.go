@@ -0,0 +1,51 @@
+// Package messaging - TLS configuration of the connection to the message bus
+package messaging
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// TLSConfig with the TLS settings for connecting to the message bus broker, including client
+// certificates for brokers that require mutual TLS (mTLS)
+type TLSConfig struct {
+	CACertFile         string `yaml:"cacert,omitempty"`             // CA certificate(s) to verify the broker with. Default uses the system CA pool
+	ClientCertFile     string `yaml:"clientcert,omitempty"`         // client certificate for mTLS, requires ClientKeyFile
+	ClientKeyFile      string `yaml:"clientkey,omitempty"`          // private key of the client certificate
+	InsecureSkipVerify bool   `yaml:"insecureskipverify,omitempty"` // don't verify the broker certificate. Only use during development.
+	ServerName         string `yaml:"servername,omitempty"`         // hostname on the broker certificate. Default is the server address.
+}
+
+// Load the CA and client certificates and create the TLS configuration
+// This fails if a certificate can't be read, or if the client certificate and key don't match, so
+// configuration problems are detected on startup.
+// Returns the TLS configuration or an error if the configuration is invalid
+func (tlsConfig *TLSConfig) Load() (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: tlsConfig.InsecureSkipVerify,
+		ServerName:         tlsConfig.ServerName,
+	}
+	if tlsConfig.CACertFile != "" {
+		caPEM, err := ioutil.ReadFile(tlsConfig.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("TLSConfig.Load: Unable to read CA certificate: %s", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("TLSConfig.Load: No valid certificates in CA file '%s'", tlsConfig.CACertFile)
+		}
+	}
+	if tlsConfig.ClientCertFile != "" || tlsConfig.ClientKeyFile != "" {
+		if tlsConfig.ClientCertFile == "" || tlsConfig.ClientKeyFile == "" {
+			return nil, fmt.Errorf("TLSConfig.Load: Client certificate and key must both be provided")
+		}
+		clientCert, err := tls.LoadX509KeyPair(tlsConfig.ClientCertFile, tlsConfig.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("TLSConfig.Load: Unable to load client certificate: %s", err)
+		}
+		config.Certificates = []tls.Certificate{clientCert}
+	}
+	return config, nil
+}
@@ -0,0 +1,87 @@
+package messaging_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCert creates a self signed certificate and key and saves them in PEM format
+func writeTestCert(t *testing.T, folder string, name string) (certFile string, keyFile string) {
+	privKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &privKey.PublicKey, privKey)
+	require.NoError(t, err)
+	keyDER, _ := x509.MarshalECPrivateKey(privKey)
+
+	certFile = path.Join(folder, name+".crt")
+	keyFile = path.Join(folder, name+".key")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	require.NoError(t, ioutil.WriteFile(certFile, certPEM, 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, keyPEM, 0600))
+	return certFile, keyFile
+}
+
+func TestTLSConfig(t *testing.T) {
+	folder, _ := ioutil.TempDir("", "tlsconfig")
+	defer os.RemoveAll(folder)
+	caFile, _ := writeTestCert(t, folder, "ca")
+	clientCert, clientKey := writeTestCert(t, folder, "client")
+	_, otherKey := writeTestCert(t, folder, "other")
+
+	tlsConfig := messaging.TLSConfig{
+		CACertFile:     caFile,
+		ClientCertFile: clientCert,
+		ClientKeyFile:  clientKey,
+		ServerName:     "broker.local",
+	}
+	config, err := tlsConfig.Load()
+	require.NoError(t, err)
+	assert.NotNil(t, config.RootCAs)
+	assert.Len(t, config.Certificates, 1)
+	assert.Equal(t, "broker.local", config.ServerName)
+	assert.False(t, config.InsecureSkipVerify)
+
+	// key doesn't match the certificate
+	tlsConfig.ClientKeyFile = otherKey
+	_, err = tlsConfig.Load()
+	assert.Error(t, err)
+
+	// certificate without key
+	tlsConfig.ClientKeyFile = ""
+	_, err = tlsConfig.Load()
+	assert.Error(t, err)
+
+	// CA file that doesn't exist or has no certificates
+	_, err = (&messaging.TLSConfig{CACertFile: path.Join(folder, "notafile")}).Load()
+	assert.Error(t, err)
+	_, err = (&messaging.TLSConfig{CACertFile: clientKey}).Load()
+	assert.Error(t, err)
+
+	// dev configuration without certificates
+	config, err = (&messaging.TLSConfig{InsecureSkipVerify: true}).Load()
+	assert.NoError(t, err)
+	assert.True(t, config.InsecureSkipVerify)
+	assert.Nil(t, config.RootCAs)
+}
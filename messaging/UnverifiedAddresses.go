@@ -0,0 +1,92 @@
+// Package messaging with the addresses of trusted system messages that are not verified
+package messaging
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/iotdomain/iotdomain-go/types"
+)
+
+// DecodeMessageOnAddress decrypts and verifies a message received on an address like
+// DecodeMessageDetailed. Messages on unverified addresses are unmarshalled directly without
+// decryption or verification and their result has Skipped set. See SetUnverifiedAddresses.
+//  address the message is received on
+//  rawMessage is the received message
+//  object to unmarshal the message into
+func (signer *MessageSigner) DecodeMessageOnAddress(address string, rawMessage string, object interface{}) (
+	isEncrypted bool, result SignatureVerification) {
+
+	if result, isUnverified := signer.decodeUnverified(address, rawMessage, object); isUnverified {
+		return false, result
+	}
+	return signer.DecodeMessageDetailed(rawMessage, object)
+}
+
+// IsUnverifiedAddress returns true if messages on the address skip signature verification
+// See SetUnverifiedAddresses.
+func (signer *MessageSigner) IsUnverifiedAddress(address string) bool {
+	signer.unverifiedMutex.RLock()
+	defer signer.unverifiedMutex.RUnlock()
+	for _, pattern := range signer.unverifiedAddresses {
+		if types.MatchAddressPattern(pattern, address) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetUnverifiedAddresses sets the address patterns of messages that are unsigned by design, eg
+// time sync or broker heartbeat messages. Messages on these addresses are unmarshalled without
+// verifying their signature by SubscribeVerified, SubscribeObject, DecodeMessageOnAddress and
+// VerifySignedMessageOnAddress.
+// The default is no patterns, which verifies all messages.
+//  patterns are addresses with optional '+' and '#' wildcards, eg "$SYS/#". See types.ParseAddressPattern.
+// Returns an error if a pattern is invalid, in which case the patterns in use are not changed
+func (signer *MessageSigner) SetUnverifiedAddresses(patterns ...string) error {
+	parsedPatterns := make([][]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		segments, err := types.ParseAddressPattern(pattern)
+		if err != nil {
+			return fmt.Errorf("SetUnverifiedAddresses: %s", err)
+		}
+		parsedPatterns = append(parsedPatterns, segments)
+	}
+	signer.unverifiedMutex.Lock()
+	defer signer.unverifiedMutex.Unlock()
+	signer.unverifiedAddresses = parsedPatterns
+	return nil
+}
+
+// VerifySignedMessageOnAddress parses and verifies a message received on an address like
+// VerifySignedMessageDetailed. Messages on unverified addresses are unmarshalled directly without
+// verification and their result has Skipped set. See SetUnverifiedAddresses.
+//  address the message is received on
+//  rawMessage is the received message
+//  object to unmarshal the message into
+func (signer *MessageSigner) VerifySignedMessageOnAddress(address string, rawMessage string,
+	object interface{}) SignatureVerification {
+
+	if result, isUnverified := signer.decodeUnverified(address, rawMessage, object); isUnverified {
+		return result
+	}
+	return signer.VerifySignedMessageDetailed(rawMessage, object)
+}
+
+// decodeUnverified unmarshals a message on an unverified address without verification
+// Returns false if the address isn't an unverified address
+func (signer *MessageSigner) decodeUnverified(address string, rawMessage string, object interface{}) (
+	result SignatureVerification, isUnverified bool) {
+
+	if !signer.IsUnverifiedAddress(address) {
+		return result, false
+	}
+	result.Skipped = true
+	if result.Err = checkMessageLimits(rawMessage); result.Err != nil {
+		return result, true
+	}
+	if err := json.Unmarshal([]byte(rawMessage), object); err != nil {
+		result.Err = fmt.Errorf("message on %s is not valid JSON: %s", address, err)
+	}
+	return result, true
+}
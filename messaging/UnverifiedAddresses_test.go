@@ -0,0 +1,72 @@
+package messaging_test
+
+import (
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/stretchr/testify/assert"
+)
+
+type heartbeatMessage struct {
+	Uptime int `json:"uptime"`
+}
+
+func TestUnverifiedAddresses(t *testing.T) {
+	const heartbeatAddr = "$SYS/broker/heartbeat"
+	messenger := messaging.NewInMemoryMessenger(&messaging.MessengerConfig{})
+	signer := messaging.NewMessageSigner(messenger, messaging.CreateAsymKeys(), nil)
+	assert.False(t, signer.IsUnverifiedAddress(heartbeatAddr))
+
+	rxCount := 0
+	rxUptime := 0
+	signer.SubscribeVerified(heartbeatAddr, func() interface{} { return &heartbeatMessage{} },
+		func(address string, object interface{}) error {
+			rxCount++
+			rxUptime = object.(*heartbeatMessage).Uptime
+			return nil
+		})
+
+	// unsigned messages are discarded by default
+	messenger.Publish(heartbeatAddr, false, `{"uptime":10}`)
+	assert.Equal(t, 0, rxCount)
+
+	err := signer.SetUnverifiedAddresses("$SYS/#", "test/+/$time")
+	assert.NoError(t, err)
+	assert.True(t, signer.IsUnverifiedAddress(heartbeatAddr))
+	assert.True(t, signer.IsUnverifiedAddress("test/timeservice/$time"))
+	assert.False(t, signer.IsUnverifiedAddress("test/pub1/node1/$node"))
+
+	messenger.Publish(heartbeatAddr, false, `{"uptime":20}`)
+	assert.Equal(t, 1, rxCount)
+	assert.Equal(t, 20, rxUptime)
+
+	// invalid JSON is still rejected
+	messenger.Publish(heartbeatAddr, false, "not json")
+	assert.Equal(t, 1, rxCount)
+
+	// the decode and verify paths skip verification of unverified addresses
+	heartbeat := heartbeatMessage{}
+	_, result := signer.DecodeMessageOnAddress(heartbeatAddr, `{"uptime":40}`, &heartbeat)
+	assert.NoError(t, result.Err)
+	assert.True(t, result.Skipped)
+	assert.Equal(t, 40, heartbeat.Uptime)
+	result = signer.VerifySignedMessageOnAddress(heartbeatAddr, `{"uptime":50}`, &heartbeat)
+	assert.NoError(t, result.Err)
+	assert.True(t, result.Skipped)
+	assert.Equal(t, messaging.TrustUnsigned, result.TrustLevel())
+	result = signer.VerifySignedMessageOnAddress(heartbeatAddr, "not json", &heartbeat)
+	assert.Error(t, result.Err)
+	result = signer.VerifySignedMessageOnAddress("test/pub1/node1/$node", `{"uptime":60}`, &heartbeat)
+	assert.False(t, result.Skipped)
+
+	// invalid patterns are rejected and the patterns in use remain
+	assert.Error(t, signer.SetUnverifiedAddresses("$SYS/#/heartbeat"))
+	assert.Error(t, signer.SetUnverifiedAddresses("test//$time"))
+	assert.Error(t, signer.SetUnverifiedAddresses("test/pub+/$time"))
+	assert.True(t, signer.IsUnverifiedAddress(heartbeatAddr))
+
+	// no patterns verifies everything again
+	signer.SetUnverifiedAddresses()
+	messenger.Publish(heartbeatAddr, false, `{"uptime":30}`)
+	assert.Equal(t, 1, rxCount)
+}
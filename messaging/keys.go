@@ -5,7 +5,9 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/pem"
 	"math/big"
 )
@@ -60,6 +62,20 @@ func PublicKeyFromPem(pemEncodedPub string) *ecdsa.PublicKey {
 	return publicKey
 }
 
+// PublicKeyFingerprint returns the hex encoded SHA-256 hash of the DER encoded public key
+// Intended to identify a key in logs without including the key itself. Returns "" if the key is invalid.
+func PublicKeyFingerprint(publicKey *ecdsa.PublicKey) string {
+	if publicKey == nil {
+		return ""
+	}
+	x509EncodedPub, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return ""
+	}
+	hash := sha256.Sum256(x509EncodedPub)
+	return hex.EncodeToString(hash[:])
+}
+
 // PublicKeyToPem converts a public key into PEM encoded ascii format
 // See also PublicKeyFromPem for its counterpart
 func PublicKeyToPem(publicKey *ecdsa.PublicKey) string {
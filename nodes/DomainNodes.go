@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"reflect"
+	"time"
 
 	"github.com/iotdomain/iotdomain-go/lib"
 	"github.com/iotdomain/iotdomain-go/messaging"
@@ -25,6 +26,28 @@ func (domainNodes *DomainNodes) AddNode(node *types.NodeDiscoveryMessage) {
 	domainNodes.c.Update(node.Address, node)
 }
 
+// FindNodes returns a snapshot of the discovered nodes for which the matcher returns true.
+// The returned nodes are copies and can be retained without affecting the list.
+func (domainNodes *DomainNodes) FindNodes(matcher func(node *types.NodeDiscoveryMessage) bool) []*types.NodeDiscoveryMessage {
+	allNodes := domainNodes.GetAllNodes()
+	matches := make([]*types.NodeDiscoveryMessage, 0)
+	for _, node := range allNodes {
+		if matcher(node) {
+			matches = append(matches, copyNode(node))
+		}
+	}
+	return matches
+}
+
+// FindNodesByAttr returns a snapshot of the discovered nodes with the given attribute value,
+// eg all nodes with locationName Kitchen
+func (domainNodes *DomainNodes) FindNodesByAttr(attrName types.NodeAttr, value string) []*types.NodeDiscoveryMessage {
+	return domainNodes.FindNodes(func(node *types.NodeDiscoveryMessage) bool {
+		attrValue, found := node.Attr[attrName]
+		return found && attrValue == value
+	})
+}
+
 // GetAllNodes returns a list of all discovered nodes of the domain
 func (domainNodes *DomainNodes) GetAllNodes() []*types.NodeDiscoveryMessage {
 	allNodes := make([]*types.NodeDiscoveryMessage, 0)
@@ -132,17 +155,26 @@ func (domainNodes *DomainNodes) SaveNodes(filename string) error {
 	return nil
 }
 
-// Subscribe to nodes discovery of the given domain publisher.
+// Subscribe to nodes discovery of the given domain publisher, including partial node updates and
+// node status updates
 func (domainNodes *DomainNodes) Subscribe(domain string, publisherID string) {
 	// subscription address  domain/publisher/+/$node
 	address := MakeNodeDiscoveryAddress(domain, publisherID, "+")
 	domainNodes.messageSigner.Subscribe(address, domainNodes.handleDiscoverNode)
+	deltaAddress := MakeNodeAddress(domain, publisherID, "+", types.MessageTypeNodeDelta)
+	domainNodes.messageSigner.Subscribe(deltaAddress, domainNodes.handleNodeDelta)
+	statusAddress := MakeNodeAddress(domain, publisherID, "+", types.MessageTypeNodeStatus)
+	domainNodes.messageSigner.Subscribe(statusAddress, domainNodes.handleNodeStatus)
 }
 
 // Unsubscribe from publisher
 func (domainNodes *DomainNodes) Unsubscribe(domain string, publisherID string) {
 	address := MakeNodeDiscoveryAddress(domain, publisherID, "+")
 	domainNodes.messageSigner.Unsubscribe(address, domainNodes.handleDiscoverNode)
+	deltaAddress := MakeNodeAddress(domain, publisherID, "+", types.MessageTypeNodeDelta)
+	domainNodes.messageSigner.Unsubscribe(deltaAddress, domainNodes.handleNodeDelta)
+	statusAddress := MakeNodeAddress(domain, publisherID, "+", types.MessageTypeNodeStatus)
+	domainNodes.messageSigner.Unsubscribe(statusAddress, domainNodes.handleNodeStatus)
 }
 
 // handleDiscoverNode adds discovered domain nodes to the collection
@@ -153,15 +185,128 @@ func (domainNodes *DomainNodes) handleDiscoverNode(address string, message strin
 	return err
 }
 
+// handleNodeDelta merges a partial node update into the discovered node
+// Deltas of unknown nodes and deltas older than the node are ignored. The next full publication of
+// the node replaces it.
+func (domainNodes *DomainNodes) handleNodeDelta(address string, message string) error {
+	var delta types.NodeDeltaMessage
+
+	return domainNodes.mergeNodeUpdate(address, message, &delta, &delta.Address, &delta.Timestamp,
+		func(node *types.NodeDiscoveryMessage) *types.NodeDiscoveryMessage {
+			return types.MergeNodeDelta(node, &delta)
+		})
+}
+
+// handleNodeStatus merges a node status update into the discovered node
+// Status of unknown nodes and status older than the node are ignored.
+func (domainNodes *DomainNodes) handleNodeStatus(address string, message string) error {
+	var status types.NodeStatusMessage
+
+	return domainNodes.mergeNodeUpdate(address, message, &status, &status.Address, &status.Timestamp,
+		func(node *types.NodeDiscoveryMessage) *types.NodeDiscoveryMessage {
+			return types.MergeNodeStatus(node, &status)
+		})
+}
+
+// mergeNodeUpdate verifies a partial node update and merges it into the discovered node.
+// Updates of unknown nodes and updates older than the node are ignored.
+//  update is the message to unmarshal the update into, eg a NodeDeltaMessage
+//  updateAddress and updateTime refer to the node address and timestamp fields of the update
+//  merge returns the node with the unmarshalled update merged
+func (domainNodes *DomainNodes) mergeNodeUpdate(address string, message string, update interface{},
+	updateAddress *string, updateTime *string,
+	merge func(node *types.NodeDiscoveryMessage) *types.NodeDiscoveryMessage) error {
+
+	_, err := messaging.VerifySenderJWSSignature(message, update, domainNodes.messageSigner.GetPublicKey)
+	if err != nil {
+		return lib.MakeErrorf("mergeNodeUpdate: Failed verifying signature on address %s: %s", address, err)
+	}
+	if lib.MakeBaseAddress(*updateAddress) != lib.MakeBaseAddress(address) {
+		return lib.MakeErrorf("mergeNodeUpdate: Update of node '%s' was published on a different address", *updateAddress)
+	}
+	node := domainNodes.GetNodeByAddress(address)
+	if node == nil {
+		return lib.MakeErrorf("mergeNodeUpdate: Update of unknown node '%s' ignored", *updateAddress)
+	}
+	nodeTime, err := time.Parse(types.TimeFormat, node.Timestamp)
+	updateTimestamp, err2 := time.Parse(types.TimeFormat, *updateTime)
+	if err == nil && err2 == nil && updateTimestamp.Before(nodeTime) {
+		return lib.MakeErrorf("mergeNodeUpdate: Update of node '%s' is older than the node. Ignored", *updateAddress)
+	}
+	mergedNode := merge(node)
+	flagUnknownValues(mergedNode, node)
+	domainNodes.AddNode(mergedNode)
+	return nil
+}
+
+// flagUnknownValues sets the UnknownType and UnknownRunState flags of a received node. Unknown
+// values can come from a newer publisher so they are flagged but accepted. A warning is only logged
+// if the value wasn't already flagged on the existing node.
+//  existing is the node before it was received, or nil if it is new
+func flagUnknownValues(node *types.NodeDiscoveryMessage, existing *types.NodeDiscoveryMessage) {
+	nodeType := node.Attr[types.NodeAttrType]
+	node.UnknownType = !types.IsValidNodeType(nodeType)
+	if node.UnknownType && (existing == nil || !existing.UnknownType ||
+		existing.Attr[types.NodeAttrType] != nodeType) {
+		logrus.Warningf("flagUnknownValues: Node '%s' has unknown type '%s'", node.Address, nodeType)
+	}
+	runState, hasRunState := node.Status[types.NodeStatusRunState]
+	node.UnknownRunState = hasRunState && !types.IsValidRunState(runState)
+	if node.UnknownRunState && (existing == nil || !existing.UnknownRunState ||
+		existing.Status[types.NodeStatusRunState] != runState) {
+		logrus.Warningf("flagUnknownValues: Node '%s' has unknown run state '%s'", node.Address, runState)
+	}
+}
+
+// validateDiscoveredNode checks that a received node discovery message is complete and consistent
+// with the address it was published on. Unknown node types and run states are flagged but accepted.
+func (domainNodes *DomainNodes) validateDiscoveredNode(address string, item interface{}) error {
+	node := *item.(*types.NodeDiscoveryMessage)
+	if node.Address != address {
+		return fmt.Errorf("Node with address '%s' was published on a different address", node.Address)
+	}
+	// the publisher isn't included in the message
+	segments, err := types.ParseAddress(address)
+	if err != nil {
+		return err
+	}
+	node.PublisherID = segments.PublisherID
+	err = types.ValidateNodeDiscovery(&node)
+	if err != nil {
+		return err
+	}
+	flagUnknownValues(item.(*types.NodeDiscoveryMessage), domainNodes.GetNodeByAddress(address))
+	return nil
+}
+
+// copyNode returns a copy of the node with its own Attr, Config and Status maps
+func copyNode(node *types.NodeDiscoveryMessage) *types.NodeDiscoveryMessage {
+	newNode := *node
+	newNode.Attr = make(types.NodeAttrMap)
+	for key, value := range node.Attr {
+		newNode.Attr[key] = value
+	}
+	newNode.Config = make(types.ConfigAttrMap)
+	for key, value := range node.Config {
+		newNode.Config[key] = value
+	}
+	newNode.Status = make(types.NodeStatusMap)
+	for key, value := range node.Status {
+		newNode.Status[key] = value
+	}
+	return &newNode
+}
+
 // NewDomainNodes creates a new instance for domain node management.
 //  messageSigner is used to receive signed node discovery messages
 func NewDomainNodes(messageSigner *messaging.MessageSigner) *DomainNodes {
 	domainCollection := lib.NewDomainCollection(
 		reflect.TypeOf(&types.NodeDiscoveryMessage{}), messageSigner.GetPublicKey)
 
-	domainNodes := DomainNodes{
+	domainNodes := &DomainNodes{
 		c:             domainCollection,
 		messageSigner: messageSigner,
 	}
-	return &domainNodes
+	domainNodes.c.Validate = domainNodes.validateDiscoveredNode
+	return domainNodes
 }
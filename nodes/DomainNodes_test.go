@@ -1,13 +1,17 @@
 package nodes_test
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"encoding/json"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/iotdomain/iotdomain-go/messaging"
 	"github.com/iotdomain/iotdomain-go/nodes"
 	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -100,5 +104,76 @@ func TestDiscoverDomainNodes(t *testing.T) {
 
 	inList := collection.GetAllNodes()
 	assert.Equal(t, 1, len(inList), "Expected 1 discovered node. Got %d", len(inList))
+
+	// invalid announcements are skipped
+	badNode := nodes.NewNode(domain2, "publisher2", "node56", types.NodeTypeAVControl)
+	delete(badNode.Attr, types.NodeAttrType)
+	nodeAsBytes, _ = json.Marshal(badNode)
+	messenger.Publish(badNode.Address, false, string(nodeAsBytes))
+	badNode = nodes.NewNode(domain2, "publisher2", "node57", types.NodeTypeAVControl)
+	nodeAsBytes, _ = json.Marshal(badNode)
+	messenger.Publish(nodes.MakeNodeDiscoveryAddress(domain2, "publisher2", "node58"), false, string(nodeAsBytes))
+	inList = collection.GetAllNodes()
+	assert.Equal(t, 1, len(inList), "Expected invalid nodes to be skipped")
+	assert.False(t, inList[0].UnknownType)
+
+	// unknown types and run states are stored, flagged and logged once
+	logOutput := bytes.Buffer{}
+	logrus.SetOutput(&logOutput)
+	defer logrus.SetOutput(os.Stderr)
+	newerNode := nodes.NewNode(domain2, "publisher2", "node59", "teleporter")
+	newerNode.Status[types.NodeStatusRunState] = "beaming"
+	nodeAsBytes, _ = json.Marshal(newerNode)
+	messenger.Publish(newerNode.Address, false, string(nodeAsBytes))
+	messenger.Publish(newerNode.Address, false, string(nodeAsBytes))
+	node2 := collection.GetNodeByAddress(newerNode.Address)
+	require.NotNil(t, node2)
+	assert.True(t, node2.UnknownType)
+	assert.True(t, node2.UnknownRunState)
+	assert.Equal(t, 1, strings.Count(logOutput.String(), "unknown type"))
+	assert.Equal(t, 1, strings.Count(logOutput.String(), "unknown run state"))
+
+	// a known run state clears the flag
+	newerNode.Status[types.NodeStatusRunState] = types.NodeRunStateReady
+	nodeAsBytes, _ = json.Marshal(newerNode)
+	messenger.Publish(newerNode.Address, false, string(nodeAsBytes))
+	node2 = collection.GetNodeByAddress(newerNode.Address)
+	assert.True(t, node2.UnknownType)
+	assert.False(t, node2.UnknownRunState)
 	collection.Unsubscribe(domain2, "+")
 }
+
+func TestFindNodes(t *testing.T) {
+	const domain = "test"
+	const publisherID = "pub2"
+	messenger := messaging.NewDummyMessenger(dummyConfig)
+	signer := messaging.NewMessageSigner(messenger, messaging.CreateAsymKeys(), nil)
+	collection := nodes.NewDomainNodes(signer)
+
+	node1 := nodes.NewNode(domain, publisherID, "node1", types.NodeTypeAdapter)
+	node1.Attr[types.NodeAttrLocationName] = "Kitchen"
+	collection.AddNode(node1)
+	node2 := nodes.NewNode(domain, publisherID, "node2", types.NodeTypeAlarm)
+	node2.Attr[types.NodeAttrLocationName] = "Garage"
+	collection.AddNode(node2)
+	node3 := nodes.NewNode(domain, publisherID, "node3", types.NodeTypeAlarm)
+	collection.AddNode(node3)
+
+	found := collection.FindNodesByAttr(types.NodeAttrLocationName, "Kitchen")
+	require.Equal(t, 1, len(found))
+	assert.Equal(t, node1.Address, found[0].Address)
+
+	found = collection.FindNodes(func(node *types.NodeDiscoveryMessage) bool {
+		return node.Attr[types.NodeAttrType] == string(types.NodeTypeAlarm)
+	})
+	assert.Equal(t, 2, len(found))
+
+	found = collection.FindNodesByAttr(types.NodeAttrLocationName, "Attic")
+	assert.Equal(t, 0, len(found))
+
+	// results are snapshots that don't affect the list
+	found = collection.FindNodesByAttr(types.NodeAttrLocationName, "Garage")
+	require.Equal(t, 1, len(found))
+	found[0].Attr[types.NodeAttrLocationName] = "Attic"
+	assert.Equal(t, "Garage", collection.GetNodeAttr(node2.Address, types.NodeAttrLocationName))
+}
@@ -0,0 +1,108 @@
+// Package nodes with management of child nodes of gateways
+package nodes
+
+import (
+	"github.com/iotdomain/iotdomain-go/lib"
+	"github.com/iotdomain/iotdomain-go/types"
+)
+
+// CreateChildNode creates a node that is managed by a gateway node, eg a zwave or onewire device.
+// The child node's NodeAttrGatewayAddress attribute is set to the address of the gateway.
+// If the node already exists then its type and gateway are updated.
+//  gatewayHWID is the hardware ID of the registered gateway node
+//  hwID is the hardware ID of the child node
+// Returns the child node, or an error if the gateway isn't registered
+func (regNodes *RegisteredNodes) CreateChildNode(gatewayHWID string, hwID string, nodeType types.NodeType) (
+	*types.NodeDiscoveryMessage, error) {
+
+	if gatewayHWID == hwID {
+		return nil, lib.MakeErrorf("CreateChildNode: Node '%s' can't be its own gateway", hwID)
+	}
+	gateway := regNodes.GetNodeByHWID(gatewayHWID)
+	if gateway == nil {
+		return nil, lib.MakeErrorf("CreateChildNode: Gateway '%s' not found", gatewayHWID)
+	}
+	node, _ := regNodes.GetOrCreateNode(hwID, nodeType)
+
+	regNodes.updateMutex.Lock()
+	defer regNodes.updateMutex.Unlock()
+	node = regNodes.deviceMap[hwID]
+	if node.Attr[types.NodeAttrGatewayAddress] != gateway.Address {
+		node = regNodes.Clone(node)
+		node.Attr[types.NodeAttrGatewayAddress] = gateway.Address
+		regNodes.updateNode(node)
+	}
+	return node, nil
+}
+
+// DeleteGateway deletes a gateway node and either deletes or orphans its child nodes
+// Orphaned child nodes have their gateway address removed and are published as updated.
+//  gatewayHWID is the hardware ID of the gateway node
+//  deleteChildren deletes the child nodes of the gateway. Use false to keep them as orphans.
+// Returns the number of child nodes that are deleted or orphaned
+func (regNodes *RegisteredNodes) DeleteGateway(gatewayHWID string, deleteChildren bool) int {
+	regNodes.updateMutex.Lock()
+	defer regNodes.updateMutex.Unlock()
+
+	gateway := regNodes.deviceMap[gatewayHWID]
+	if gateway == nil {
+		return 0
+	}
+	children := regNodes.getChildNodes(gateway.Address)
+	for _, child := range children {
+		if deleteChildren {
+			regNodes.deleteNode(child)
+		} else {
+			orphan := regNodes.Clone(child)
+			delete(orphan.Attr, types.NodeAttrGatewayAddress)
+			regNodes.updateNode(orphan)
+		}
+	}
+	regNodes.deleteNode(gateway)
+	return len(children)
+}
+
+// GetChildNodes returns the nodes whose gateway address refers to the given gateway node
+// Returns an empty list if the gateway isn't registered or has no children
+func (regNodes *RegisteredNodes) GetChildNodes(gatewayHWID string) []*types.NodeDiscoveryMessage {
+	regNodes.updateMutex.Lock()
+	defer regNodes.updateMutex.Unlock()
+
+	gateway := regNodes.deviceMap[gatewayHWID]
+	if gateway == nil {
+		return make([]*types.NodeDiscoveryMessage, 0)
+	}
+	return regNodes.getChildNodes(gateway.Address)
+}
+
+// deleteNode removes a node and its pending updates, and adds it to the deleted nodes for removal
+// from the message bus. Use within a locked section.
+func (regNodes *RegisteredNodes) deleteNode(node *types.NodeDiscoveryMessage) {
+	regNodes.deletedNodes[node.Address] = true
+	delete(regNodes.deviceMap, node.HWID)
+	delete(regNodes.nodeMap, node.NodeID)
+	delete(regNodes.updatedNodes, node.Address)
+	delete(regNodes.statusPending, node.Address)
+	delete(regNodes.statusPublished, node.HWID)
+}
+
+// getChildNodes returns the nodes with the given gateway address. Use within a locked section.
+func (regNodes *RegisteredNodes) getChildNodes(gatewayAddress string) []*types.NodeDiscoveryMessage {
+	children := make([]*types.NodeDiscoveryMessage, 0)
+	for _, node := range regNodes.deviceMap {
+		if node.Attr[types.NodeAttrGatewayAddress] == gatewayAddress {
+			children = append(children, node)
+		}
+	}
+	return children
+}
+
+// updateGatewayAddress updates the gateway address of the children of a gateway whose address has
+// changed. Use within a locked section.
+func (regNodes *RegisteredNodes) updateGatewayAddress(oldAddress string, newAddress string) {
+	for _, child := range regNodes.getChildNodes(oldAddress) {
+		newChild := regNodes.Clone(child)
+		newChild.Attr[types.NodeAttrGatewayAddress] = newAddress
+		regNodes.updateNode(newChild)
+	}
+}
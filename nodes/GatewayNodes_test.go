@@ -0,0 +1,67 @@
+package nodes_test
+
+import (
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/nodes"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatewayChildNodes(t *testing.T) {
+	const gatewayID = "gateway1"
+	const child1ID = "zwave1"
+	const child2ID = "zwave2"
+	collection := nodes.NewRegisteredNodes(domain, publisher1ID)
+
+	// the gateway must exist
+	_, err := collection.CreateChildNode(gatewayID, child1ID, types.NodeTypeSensor)
+	assert.Error(t, err)
+
+	gateway := collection.CreateNode(gatewayID, types.NodeTypeGateway)
+	child1, err := collection.CreateChildNode(gatewayID, child1ID, types.NodeTypeSensor)
+	require.NoError(t, err)
+	assert.Equal(t, gateway.Address, child1.Attr[types.NodeAttrGatewayAddress])
+	_, err = collection.CreateChildNode(gatewayID, child2ID, types.NodeTypeUnknown)
+	assert.NoError(t, err)
+	_, err = collection.CreateChildNode(gatewayID, gatewayID, types.NodeTypeUnknown)
+	assert.Error(t, err)
+	collection.CreateNode(node1ID, types.NodeTypeSensor)
+	assert.Equal(t, 2, len(collection.GetChildNodes(gatewayID)))
+	assert.Equal(t, 0, len(collection.GetChildNodes(node1ID)))
+	assert.Equal(t, 0, len(collection.GetChildNodes("unknown")))
+
+	// children follow the gateway's address
+	collection.SetNodeID(gateway, "gateway-alias")
+	gateway = collection.GetNodeByHWID(gatewayID)
+	child1 = collection.GetNodeByHWID(child1ID)
+	assert.Equal(t, gateway.Address, child1.Attr[types.NodeAttrGatewayAddress])
+	assert.Equal(t, 2, len(collection.GetChildNodes(gatewayID)))
+
+	// deleting a node orphans its children
+	collection.DeleteNode(gatewayID)
+	assert.Nil(t, collection.GetNodeByHWID(gatewayID))
+	child1 = collection.GetNodeByHWID(child1ID)
+	require.NotNil(t, child1)
+	_, hasGateway := child1.Attr[types.NodeAttrGatewayAddress]
+	assert.False(t, hasGateway)
+	assert.Equal(t, []string{gateway.Address}, collection.GetDeletedNodes(true))
+	assert.Empty(t, collection.GetDeletedNodes(false))
+
+	// deleting a gateway can cascade to its children
+	collection.CreateNode(gatewayID, types.NodeTypeGateway)
+	collection.CreateChildNode(gatewayID, child1ID, types.NodeTypeSensor)
+	collection.CreateChildNode(gatewayID, child2ID, types.NodeTypeUnknown)
+	count := collection.DeleteGateway(gatewayID, true)
+	assert.Equal(t, 2, count)
+	assert.Nil(t, collection.GetNodeByHWID(child1ID))
+	assert.Nil(t, collection.GetNodeByHWID(child2ID))
+	assert.NotNil(t, collection.GetNodeByHWID(node1ID))
+	assert.Equal(t, 0, collection.DeleteGateway(gatewayID, true))
+	assert.Equal(t, 3, len(collection.GetDeletedNodes(false)))
+
+	// a node that is recreated is no longer deleted
+	collection.CreateNode(child1ID, types.NodeTypeSensor)
+	assert.Equal(t, 2, len(collection.GetDeletedNodes(false)))
+}
@@ -0,0 +1,69 @@
+// Package nodes with authorization of senders of node commands
+package nodes
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrUnauthorizedSender is returned when a verified sender isn't authorized to configure or command a node
+var ErrUnauthorizedSender = errors.New("sender is not authorized for the node")
+
+// AuthorizeSender checks if the sender of a configure or set input command is authorized for the node.
+// This is authorization and assumes the sender is already authenticated with the message signature.
+// The node's NodeAttrAuthorizedSenders attribute lists the authorized publisher IDs of the node's domain,
+// or domain/publisherID for publishers of other domains. Without authorized senders any sender is allowed.
+// Nodes that aren't registered have no authorized senders.
+// An unauthorized sender increases the node's error count status.
+//  nodeHWID of the node to command
+//  sender address of the publisher sending the command: domain/publisherID[/...]
+// Returns ErrUnauthorizedSender if the sender isn't authorized
+func (regNodes *RegisteredNodes) AuthorizeSender(nodeHWID string, sender string) error {
+	node := regNodes.GetNodeByHWID(nodeHWID)
+	authorizedSenders := regNodes.GetAuthorizedSenders(nodeHWID)
+	if node == nil || len(authorizedSenders) == 0 {
+		return nil
+	}
+	segments, err := types.ParseBaseAddress(sender)
+	if err == nil {
+		senderAddress := types.MakeAddress(&types.AddressSegments{Domain: segments.Domain, PublisherID: segments.PublisherID})
+		for _, authorized := range authorizedSenders {
+			if authorized == senderAddress || (authorized == segments.PublisherID && segments.Domain == regNodes.domain) {
+				return nil
+			}
+		}
+	}
+	logrus.Warningf("AuthorizeSender: Sender '%s' is not authorized for node '%s'", sender, node.Address)
+	errorCount, _ := strconv.Atoi(node.Status[types.NodeStatusErrorCount])
+	regNodes.UpdateNodeStatus(nodeHWID, map[types.NodeStatus]string{
+		types.NodeStatusErrorCount: strconv.Itoa(errorCount + 1),
+	})
+	return ErrUnauthorizedSender
+}
+
+// GetAuthorizedSenders returns the publisher IDs that are authorized to configure and command the node
+// Returns an empty list if any sender is authorized
+func (regNodes *RegisteredNodes) GetAuthorizedSenders(nodeHWID string) []string {
+	senders := make([]string, 0)
+	attrValue := regNodes.GetNodeAttr(nodeHWID, types.NodeAttrAuthorizedSenders)
+	for _, sender := range strings.Split(attrValue, ",") {
+		sender = strings.TrimSpace(sender)
+		if sender != "" {
+			senders = append(senders, sender)
+		}
+	}
+	return senders
+}
+
+// SetAuthorizedSenders sets the publisher IDs that are authorized to configure and command the node
+//  senders contains publisher IDs of the node's domain or domain/publisherID. Use nil to authorize any sender.
+// Returns true if the node has changed
+func (regNodes *RegisteredNodes) SetAuthorizedSenders(nodeHWID string, senders []string) bool {
+	return regNodes.UpdateNodeAttr(nodeHWID, types.NodeAttrMap{
+		types.NodeAttrAuthorizedSenders: strings.Join(senders, ","),
+	})
+}
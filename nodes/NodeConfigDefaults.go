@@ -0,0 +1,140 @@
+// Package nodes with loading of node configuration values from the environment or a file
+package nodes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/iotdomain/iotdomain-go/lib"
+	"github.com/iotdomain/iotdomain-go/types"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigDefaultsResult reports which configuration values were applied by LoadNodeConfigDefaults
+type ConfigDefaultsResult struct {
+	Applied  []types.NodeAttr  // configuration attributes whose value was applied
+	Rejected map[string]string // key in the source with the reason it was rejected
+}
+
+// ConfigDefaultsFromEnv returns the environment variables that start with the given prefix, with
+// the prefix removed, for use with LoadNodeConfigDefaults. For example with prefix "NODE1_" the
+// variable NODE1_POLL_INTERVAL=60 returns key "POLL_INTERVAL" with value "60".
+func ConfigDefaultsFromEnv(prefix string) map[string]string {
+	source := make(map[string]string)
+	for _, envVar := range os.Environ() {
+		parts := strings.SplitN(envVar, "=", 2)
+		if len(parts) == 2 && strings.HasPrefix(parts[0], prefix) && len(parts[0]) > len(prefix) {
+			source[strings.TrimPrefix(parts[0], prefix)] = parts[1]
+		}
+	}
+	return source
+}
+
+// ConfigDefaultsFromFile loads the configuration values from a yaml file with key: value pairs,
+// for use with LoadNodeConfigDefaults.
+// Returns an error if the file cannot be read or isn't a yaml map of values
+func ConfigDefaultsFromFile(filename string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, lib.MakeErrorf("ConfigDefaultsFromFile: Unable to read file '%s': %s", filename, err)
+	}
+	source := make(map[string]string)
+	err = yaml.Unmarshal(data, &source)
+	if err != nil {
+		return nil, lib.MakeErrorf("ConfigDefaultsFromFile: Invalid content in file '%s': %s", filename, err)
+	}
+	return source, nil
+}
+
+// LoadNodeConfigDefaults applies configuration values from a source, like the environment or a
+// configuration file, as the node's configuration values. Keys match a configuration attribute
+// by name, ignoring case, '_' and '-', so environment variable POLL_INTERVAL matches attribute
+// pollInterval. If multiple keys match the same attribute then an exact match is used, otherwise
+// the first key in sorted order, and the other keys are rejected. Values are validated and applied
+// through UpdateNodeConfigValues. Values of secret configuration are never included in the result.
+//  nodeHWID is the hardware ID of the registered node to configure
+//  source holds the key-value pairs, see ConfigDefaultsFromEnv and ConfigDefaultsFromFile
+// Returns the applied attributes, sorted, and the rejected keys, or an error if the node doesn't exist
+func (regNodes *RegisteredNodes) LoadNodeConfigDefaults(
+	nodeHWID string, source map[string]string) (*ConfigDefaultsResult, error) {
+
+	node := regNodes.GetNodeByHWID(nodeHWID)
+	if node == nil {
+		return nil, lib.MakeErrorf("LoadNodeConfigDefaults: Node '%s' not found", nodeHWID)
+	}
+	result := &ConfigDefaultsResult{
+		Applied:  make([]types.NodeAttr, 0),
+		Rejected: make(map[string]string),
+	}
+	keys := make([]string, 0, len(source))
+	for key := range source {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	// the source key of each matched attribute
+	attrKeys := make(map[types.NodeAttr]string)
+	for _, key := range keys {
+		attrName, err := matchConfigAttr(node, key)
+		if err != nil {
+			result.Rejected[key] = err.Error()
+			continue
+		}
+		otherKey, isDuplicate := attrKeys[attrName]
+		if isDuplicate && key == string(attrName) {
+			result.Rejected[otherKey] = fmt.Sprintf("duplicate of key '%s'", key)
+		} else if isDuplicate {
+			result.Rejected[key] = fmt.Sprintf("duplicate of key '%s'", otherKey)
+			continue
+		}
+		attrKeys[attrName] = key
+	}
+	params := make(types.NodeAttrMap)
+	for attrName, key := range attrKeys {
+		params[attrName] = source[key]
+	}
+	accepted, rejected, _ := regNodes.updateNodeConfigValues(nodeHWID, params)
+	for attrName, err := range rejected {
+		if IsSecretAttr(node, attrName) {
+			// don't leak secrets in the result
+			result.Rejected[attrKeys[attrName]] = "invalid secret value"
+		} else {
+			result.Rejected[attrKeys[attrName]] = err.Error()
+		}
+	}
+	result.Applied = accepted
+	sort.Slice(result.Applied, func(i, j int) bool { return result.Applied[i] < result.Applied[j] })
+	return result, nil
+}
+
+// matchConfigAttr returns the configuration attribute of a node that matches a key
+// An exact match takes precedence over a match that ignores case, '_' and '-'.
+// Returns an error if no attribute, or more than one attribute, matches the key
+func matchConfigAttr(node *types.NodeDiscoveryMessage, key string) (types.NodeAttr, error) {
+	if _, found := node.Config[types.NodeAttr(key)]; found {
+		return types.NodeAttr(key), nil
+	}
+	normalizedKey := normalizeConfigKey(key)
+	matches := make([]string, 0)
+	for attrName := range node.Config {
+		if normalizeConfigKey(string(attrName)) == normalizedKey {
+			matches = append(matches, string(attrName))
+		}
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("not a configuration attribute")
+	} else if len(matches) > 1 {
+		sort.Strings(matches)
+		return "", fmt.Errorf("matches multiple configuration attributes %v", matches)
+	}
+	return types.NodeAttr(matches[0]), nil
+}
+
+// normalizeConfigKey returns the key in lower case without '_' and '-'
+func normalizeConfigKey(key string) string {
+	key = strings.ReplaceAll(key, "_", "")
+	key = strings.ReplaceAll(key, "-", "")
+	return strings.ToLower(key)
+}
@@ -0,0 +1,93 @@
+package nodes_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/nodes"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadNodeConfigDefaults(t *testing.T) {
+	const secret = "supersecret"
+	collection := nodes.NewRegisteredNodes(domain, publisher1ID)
+	collection.CreateNode(node1ID, types.NodeTypeUnknown)
+	pollConfig := nodes.NewNodeConfigNumeric(types.DataTypeInt, "poll interval", "60", 1, 3600, 1, types.UnitSecond)
+	collection.UpdateNodeConfig(node1ID, types.NodeAttrPollInterval, pollConfig)
+	collection.CreateNodeConfig(node1ID, types.NodeAttrName, types.DataTypeString, "Friendly Name", "")
+	passwordConfig := nodes.NewNodeConfig(types.DataTypeString, "password", "")
+	passwordConfig.Pattern = "^[a-z]+$"
+	collection.UpdateNodeConfig(node1ID, types.NodeAttrPassword, passwordConfig)
+
+	_, err := collection.LoadNodeConfigDefaults("unknown", map[string]string{})
+	assert.Error(t, err)
+
+	result, err := collection.LoadNodeConfigDefaults(node1ID, map[string]string{
+		"POLL_INTERVAL": "30",
+		"name":          "kitchen",
+		"unknown":       "value",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []types.NodeAttr{types.NodeAttrName, types.NodeAttrPollInterval}, result.Applied)
+	assert.Contains(t, result.Rejected, "unknown")
+	assert.Equal(t, "30", collection.GetNodeAttr(node1ID, types.NodeAttrPollInterval))
+	assert.Equal(t, "kitchen", collection.GetNodeAttr(node1ID, types.NodeAttrName))
+
+	// invalid type and out of range values are rejected, secrets are not reported
+	result, err = collection.LoadNodeConfigDefaults(node1ID, map[string]string{
+		"pollInterval":  "fast",
+		"poll-interval": "7200",
+		"PASSWORD":      secret + "123",
+	})
+	require.NoError(t, err)
+	assert.Empty(t, result.Applied)
+	assert.Len(t, result.Rejected, 3)
+	assert.NotContains(t, result.Rejected["PASSWORD"], secret)
+	assert.Equal(t, "30", collection.GetNodeAttr(node1ID, types.NodeAttrPollInterval))
+
+	// the exact key wins from keys that match the same attribute, otherwise the first sorted key
+	for i := 0; i < 10; i++ {
+		result, err = collection.LoadNodeConfigDefaults(node1ID, map[string]string{
+			"POLL_INTERVAL": "20", "poll-interval": "40", "pollInterval": "50"})
+		require.NoError(t, err)
+		assert.Equal(t, []types.NodeAttr{types.NodeAttrPollInterval}, result.Applied)
+		assert.Equal(t, "50", collection.GetNodeAttr(node1ID, types.NodeAttrPollInterval))
+		result, err = collection.LoadNodeConfigDefaults(node1ID, map[string]string{
+			"poll-interval": "40", "POLL_INTERVAL": "20"})
+		require.NoError(t, err)
+		assert.Contains(t, result.Rejected, "poll-interval")
+		assert.Equal(t, "20", collection.GetNodeAttr(node1ID, types.NodeAttrPollInterval))
+	}
+
+	// load from the environment
+	os.Setenv("TESTNODE1_PASSWORD", secret)
+	defer os.Unsetenv("TESTNODE1_PASSWORD")
+	source := nodes.ConfigDefaultsFromEnv("TESTNODE1_")
+	assert.Equal(t, map[string]string{"PASSWORD": secret}, source)
+	result, err = collection.LoadNodeConfigDefaults(node1ID, source)
+	require.NoError(t, err)
+	assert.Equal(t, []types.NodeAttr{types.NodeAttrPassword}, result.Applied)
+	value, isSecret, _ := collection.GetNodeConfigValue(node1ID, types.NodeAttrPassword)
+	assert.True(t, isSecret)
+	assert.Equal(t, secret, value)
+
+	// load from a yaml file
+	folder, _ := ioutil.TempDir("", "iotdomain")
+	defer os.RemoveAll(folder)
+	filename := path.Join(folder, "node1.yaml")
+	err = ioutil.WriteFile(filename, []byte("pollInterval: 10\nname: garage\n"), 0600)
+	require.NoError(t, err)
+	source, err = nodes.ConfigDefaultsFromFile(filename)
+	require.NoError(t, err)
+	result, err = collection.LoadNodeConfigDefaults(node1ID, source)
+	require.NoError(t, err)
+	assert.Len(t, result.Applied, 2)
+	assert.Equal(t, "10", collection.GetNodeAttr(node1ID, types.NodeAttrPollInterval))
+
+	_, err = nodes.ConfigDefaultsFromFile(path.Join(folder, "missing.yaml"))
+	assert.Error(t, err)
+}
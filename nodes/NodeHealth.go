@@ -0,0 +1,149 @@
+// Package nodes with computation of the health score of nodes
+package nodes
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/types"
+)
+
+// NodeHealthInput holds the node status used to compute its health score
+type NodeHealthInput struct {
+	ErrorCount  int           // nr of errors reported on the node
+	LastSeenAge time.Duration // time since the node was last seen. Only valid if IsSeen is set
+	IsSeen      bool          // the node has a last seen status
+	Latency     time.Duration // latency to connect to the node
+}
+
+// HealthScoreFunc computes the health score of a node in percent 0-100
+// Results outside this range are limited to 0-100 by UpdateNodeHealth.
+type HealthScoreFunc func(input NodeHealthInput) int
+
+// DefaultHealthScore computes the health score of a node from its status:
+//  - a node that was never seen has a health of 0
+//  - each error reduces the health by 10 up to 50
+//  - not being seen for more than 10 minutes reduces the health, up to 50 after a day
+//  - latency over 100 msec reduces the health by 1 per 100 msec up to 20
+// The result is between 0 and 100
+func DefaultHealthScore(input NodeHealthInput) int {
+	if !input.IsSeen {
+		return 0
+	}
+	health := 100
+	// compare before multiplying so large counts and durations can't overflow
+	if input.ErrorCount >= 5 {
+		health -= 50
+	} else if input.ErrorCount > 0 {
+		health -= input.ErrorCount * 10
+	}
+	if input.LastSeenAge > 10*time.Minute {
+		ratio := float64(input.LastSeenAge-10*time.Minute) / float64(24*time.Hour-10*time.Minute)
+		health -= int(math.Min(50*ratio, 50))
+	}
+	if input.Latency > 100*time.Millisecond {
+		health -= int(math.Min(float64(input.Latency/(100*time.Millisecond))-1, 20))
+	}
+	return clampHealth(health)
+}
+
+// GetStaleNodes returns the hardware IDs of the nodes that haven't been seen within the max age,
+// sorted by hardware ID. Nodes that have never been seen are stale. See IsNodeStale.
+func (regNodes *RegisteredNodes) GetStaleNodes(maxAge time.Duration) []string {
+	regNodes.updateMutex.Lock()
+	now := regNodes.clock.Now()
+	regNodes.updateMutex.Unlock()
+
+	staleNodes := make([]string, 0)
+	for _, node := range regNodes.GetAllNodes() {
+		if isStale(node, now, maxAge) {
+			staleNodes = append(staleNodes, node.HWID)
+		}
+	}
+	sort.Strings(staleNodes)
+	return staleNodes
+}
+
+// IsNodeStale returns true if the node hasn't been seen within the max age, based on its
+// NodeStatusLastSeen status. Nodes that have never been seen, or that don't exist, are stale.
+//  maxAge is the max time since the node was last seen
+func (regNodes *RegisteredNodes) IsNodeStale(nodeHWID string, maxAge time.Duration) bool {
+	node := regNodes.GetNodeByHWID(nodeHWID)
+	if node == nil {
+		return true
+	}
+	regNodes.updateMutex.Lock()
+	now := regNodes.clock.Now()
+	regNodes.updateMutex.Unlock()
+	return isStale(node, now, maxAge)
+}
+
+// SetHealthScoreFunc sets the function that computes the health score of nodes
+//  healthScore computes the score. Use nil for DefaultHealthScore
+func (regNodes *RegisteredNodes) SetHealthScoreFunc(healthScore HealthScoreFunc) {
+	regNodes.updateMutex.Lock()
+	defer regNodes.updateMutex.Unlock()
+	regNodes.healthScore = healthScore
+}
+
+// UpdateNodeHealth computes the health score of a node from its error count, last seen and latency
+// status and updates its NodeStatusHealth status. See SetHealthScoreFunc for the scoring function.
+// Returns the health score and true if the health status has changed, or -1 if the node isn't found
+func (regNodes *RegisteredNodes) UpdateNodeHealth(nodeHWID string) (health int, changed bool) {
+	node := regNodes.GetNodeByHWID(nodeHWID)
+	if node == nil {
+		return -1, false
+	}
+	regNodes.updateMutex.Lock()
+	healthScore := regNodes.healthScore
+	now := regNodes.clock.Now()
+	regNodes.updateMutex.Unlock()
+	if healthScore == nil {
+		healthScore = DefaultHealthScore
+	}
+
+	input := NodeHealthInput{}
+	input.ErrorCount, _ = strconv.Atoi(node.Status[types.NodeStatusErrorCount])
+	latencyMSec, _ := strconv.Atoi(node.Status[types.NodeStatusLatencyMSec])
+	input.Latency = time.Duration(latencyMSec) * time.Millisecond
+	lastSeen, isSeen := getLastSeen(node)
+	if isSeen {
+		input.IsSeen = true
+		input.LastSeenAge = now.Sub(lastSeen)
+	}
+
+	// custom score functions can return any value
+	health = clampHealth(healthScore(input))
+	changed = regNodes.UpdateNodeStatus(nodeHWID, map[types.NodeStatus]string{
+		types.NodeStatusHealth: strconv.Itoa(health),
+	})
+	return health, changed
+}
+
+// getLastSeen returns the time the node was last seen from its NodeStatusLastSeen status
+// Returns false if the node has no valid last seen status
+func getLastSeen(node *types.NodeDiscoveryMessage) (lastSeen time.Time, isSeen bool) {
+	lastSeen, err := time.Parse(types.TimeFormat, node.Status[types.NodeStatusLastSeen])
+	if err != nil {
+		lastSeen, err = time.Parse(time.RFC3339, node.Status[types.NodeStatusLastSeen])
+	}
+	return lastSeen, err == nil
+}
+
+// isStale returns true if the node wasn't seen within the max age at the given time
+func isStale(node *types.NodeDiscoveryMessage, now time.Time, maxAge time.Duration) bool {
+	lastSeen, isSeen := getLastSeen(node)
+	return !isSeen || now.Sub(lastSeen) > maxAge
+}
+
+// clampHealth limits a health score to the range 0-100
+func clampHealth(health int) int {
+	if health < 0 {
+		return 0
+	} else if health > 100 {
+		return 100
+	}
+	return health
+}
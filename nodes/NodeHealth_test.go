@@ -0,0 +1,108 @@
+package nodes_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/nodes"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultHealthScore(t *testing.T) {
+	// never seen
+	assert.Equal(t, 0, nodes.DefaultHealthScore(nodes.NodeHealthInput{ErrorCount: 0}))
+	// healthy
+	assert.Equal(t, 100, nodes.DefaultHealthScore(nodes.NodeHealthInput{IsSeen: true}))
+	assert.Equal(t, 100, nodes.DefaultHealthScore(nodes.NodeHealthInput{
+		IsSeen: true, LastSeenAge: 10 * time.Minute, Latency: 100 * time.Millisecond}))
+	// many errors are capped
+	assert.Equal(t, 70, nodes.DefaultHealthScore(nodes.NodeHealthInput{IsSeen: true, ErrorCount: 3}))
+	assert.Equal(t, 50, nodes.DefaultHealthScore(nodes.NodeHealthInput{IsSeen: true, ErrorCount: 1000}))
+	// not seen for a day or longer
+	assert.Equal(t, 50, nodes.DefaultHealthScore(nodes.NodeHealthInput{IsSeen: true, LastSeenAge: 24 * time.Hour}))
+	assert.Equal(t, 50, nodes.DefaultHealthScore(nodes.NodeHealthInput{IsSeen: true, LastSeenAge: 100 * time.Hour}))
+	// very large values don't overflow
+	assert.Equal(t, 50, nodes.DefaultHealthScore(nodes.NodeHealthInput{IsSeen: true, LastSeenAge: math.MaxInt64}))
+	assert.Equal(t, 50, nodes.DefaultHealthScore(nodes.NodeHealthInput{IsSeen: true, ErrorCount: math.MaxInt64}))
+	assert.Equal(t, 80, nodes.DefaultHealthScore(nodes.NodeHealthInput{IsSeen: true, Latency: math.MaxInt64}))
+	// high latency
+	assert.Equal(t, 95, nodes.DefaultHealthScore(nodes.NodeHealthInput{IsSeen: true, Latency: 600 * time.Millisecond}))
+	assert.Equal(t, 80, nodes.DefaultHealthScore(nodes.NodeHealthInput{IsSeen: true, Latency: time.Minute}))
+	// everything wrong
+	assert.Equal(t, 0, nodes.DefaultHealthScore(nodes.NodeHealthInput{
+		IsSeen: true, ErrorCount: 100, LastSeenAge: 100 * time.Hour, Latency: time.Minute}))
+}
+
+func TestUpdateNodeHealth(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	collection := nodes.NewRegisteredNodes(domain, publisher1ID)
+	collection.SetClock(messaging.NewManualClock(now))
+	collection.CreateNode(node1ID, types.NodeTypeUnknown)
+
+	// never seen
+	health, changed := collection.UpdateNodeHealth(node1ID)
+	assert.Equal(t, 0, health)
+	assert.True(t, changed)
+	assert.Equal(t, "0", collection.GetNodeByHWID(node1ID).Status[types.NodeStatusHealth])
+
+	collection.UpdateNodeStatus(node1ID, map[types.NodeStatus]string{
+		types.NodeStatusLastSeen:   now.Add(-time.Minute).Format(types.TimeFormat),
+		types.NodeStatusErrorCount: "2",
+	})
+	health, changed = collection.UpdateNodeHealth(node1ID)
+	assert.Equal(t, 80, health)
+	assert.True(t, changed)
+	_, changed = collection.UpdateNodeHealth(node1ID)
+	assert.False(t, changed)
+
+	// custom scoring function
+	collection.SetHealthScoreFunc(func(input nodes.NodeHealthInput) int {
+		return 100 - input.ErrorCount
+	})
+	health, _ = collection.UpdateNodeHealth(node1ID)
+	assert.Equal(t, 98, health)
+	assert.Equal(t, "98", collection.GetNodeByHWID(node1ID).Status[types.NodeStatusHealth])
+
+	// custom scores are limited to 0-100
+	collection.SetHealthScoreFunc(func(input nodes.NodeHealthInput) int { return 150 })
+	health, _ = collection.UpdateNodeHealth(node1ID)
+	assert.Equal(t, 100, health)
+	collection.SetHealthScoreFunc(func(input nodes.NodeHealthInput) int { return -5 })
+	health, _ = collection.UpdateNodeHealth(node1ID)
+	assert.Equal(t, 0, health)
+
+	health, changed = collection.UpdateNodeHealth("notanode")
+	assert.Equal(t, -1, health)
+	assert.False(t, changed)
+}
+
+func TestStaleNodes(t *testing.T) {
+	const node2ID = "node2"
+	const node3ID = "node3"
+	clock := messaging.NewManualClock(time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC))
+	collection := nodes.NewRegisteredNodes(domain, publisher1ID)
+	collection.SetClock(clock)
+	collection.CreateNode(node1ID, types.NodeTypeUnknown)
+	collection.CreateNode(node2ID, types.NodeTypeUnknown)
+	collection.CreateNode(node3ID, types.NodeTypeUnknown)
+	collection.UpdateNodeStatus(node1ID, map[types.NodeStatus]string{
+		types.NodeStatusLastSeen: clock.Now().Add(-time.Minute).Format(types.TimeFormat)})
+	collection.UpdateNodeStatus(node2ID, map[types.NodeStatus]string{
+		types.NodeStatusLastSeen: clock.Now().Add(-time.Hour).Format(time.RFC3339)})
+
+	// node3 was never seen
+	assert.False(t, collection.IsNodeStale(node1ID, 10*time.Minute))
+	assert.True(t, collection.IsNodeStale(node2ID, 10*time.Minute))
+	assert.True(t, collection.IsNodeStale(node3ID, 10*time.Minute))
+	assert.True(t, collection.IsNodeStale("notanode", 10*time.Minute))
+	assert.Equal(t, []string{node2ID, node3ID}, collection.GetStaleNodes(10*time.Minute))
+	assert.Equal(t, []string{node3ID}, collection.GetStaleNodes(2*time.Hour))
+
+	// staleness uses the injected clock
+	clock.Advance(time.Hour)
+	assert.True(t, collection.IsNodeStale(node1ID, 10*time.Minute))
+	assert.Equal(t, []string{node1ID, node2ID, node3ID}, collection.GetStaleNodes(10*time.Minute))
+}
@@ -3,8 +3,6 @@ package nodes
 
 import (
 	"crypto/ecdsa"
-	"strings"
-	"time"
 
 	"github.com/iotdomain/iotdomain-go/messaging"
 	"github.com/iotdomain/iotdomain-go/types"
@@ -19,22 +17,22 @@ func PublishNodeConfigure(
 
 	logrus.Infof("PublishNodeConfigure: publishing encrypted configuration to %s", destinationAddress)
 	// Check that address is one of our inputs
-	segments := strings.Split(destinationAddress, "/")
-	// a full address is required
-	if len(segments) < 4 {
+	segments, err := types.ParseBaseAddress(destinationAddress)
+	// a node address is required
+	if err != nil || segments.NodeID == "" {
 		return
 	}
 	// domain/publisherID/nodeID/$configure
-	segments[3] = types.MessageTypeConfigure
-	configAddr := strings.Join(segments, "/")
+	configAddr := types.MakeAddress(&types.AddressSegments{Domain: segments.Domain,
+		PublisherID: segments.PublisherID, NodeID: segments.NodeID, MessageType: types.MessageTypeConfigure})
 
 	// Encecode the SetMessage
-	timeStampStr := time.Now().Format("2006-01-02T15:04:05.000-0700")
+	timeStampStr := messageSigner.Clock().Now().Format("2006-01-02T15:04:05.000-0700")
 	var configureMessage = types.NodeConfigureMessage{
 		Address:   configAddr,
 		Sender:    sender,
 		Timestamp: timeStampStr,
 		Attr:      attr,
 	}
-	messageSigner.PublishObject(configAddr, false, &configureMessage, encryptionKey)
+	messageSigner.PublishObjectWithPolicy(configAddr, &configureMessage, encryptionKey)
 }
@@ -0,0 +1,105 @@
+// Package nodes with publication of partial node updates
+package nodes
+
+import (
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/types"
+)
+
+// DefaultNodeRefreshInterval is the interval after which a node that is updated with deltas is
+// published in full again
+const DefaultNodeRefreshInterval = 10 * time.Minute
+
+// NodeDeltaPublisher publishes updates to registered nodes as deltas that only contain the changed
+// attributes, configuration and status. A node is published in full the first time and again when
+// the refresh interval has passed since its last full publication. The full publication is retained
+// and replaces the node at subscribers, so subscribers that missed a delta become consistent again.
+type NodeDeltaPublisher struct {
+	nodeUpdatePublisher
+	hasDeltas       map[string]bool      // nodes with deltas since their full publication, by node address
+	refreshed       map[string]time.Time // time of the last full publication, by node address
+	refreshInterval time.Duration        // interval between full publications of updated nodes
+}
+
+// DeleteNodes forgets deleted nodes so they are no longer refreshed. The nodes are published in
+// full when they are created again.
+//  deletedNodes are the addresses of the deleted nodes, see RegisteredNodes.GetDeletedNodes
+func (deltaPub *NodeDeltaPublisher) DeleteNodes(deletedNodes []string) {
+	deltaPub.updateMutex.Lock()
+	defer deltaPub.updateMutex.Unlock()
+
+	for _, address := range deletedNodes {
+		deltaPub.deleteNode(address)
+		delete(deltaPub.hasDeltas, address)
+		delete(deltaPub.refreshed, address)
+	}
+}
+
+// PublishNodes publishes the updated nodes as deltas on their $nodeDelta address. Nodes that
+// weren't published before or whose refresh interval has passed are published in full.
+// See DeleteNodes for deleted nodes.
+func (deltaPub *NodeDeltaPublisher) PublishNodes(updatedNodes []*types.NodeDiscoveryMessage) {
+	deltaPub.updateMutex.Lock()
+	defer deltaPub.updateMutex.Unlock()
+	now := deltaPub.messageSigner.Clock().Now()
+
+	for _, node := range updatedNodes {
+		if node == nil {
+			continue
+		}
+		redacted := RedactNode(node)
+		published := deltaPub.published[node.Address]
+		if published == nil || now.Sub(deltaPub.refreshed[node.Address]) >= deltaPub.refreshInterval {
+			deltaPub.publishFull(redacted, now)
+			continue
+		}
+		delta := types.DiffNode(published, redacted)
+		if delta.IsEmpty() {
+			continue
+		}
+		err := deltaPub.publishNodeUpdate(redacted, delta)
+		if err == nil {
+			deltaPub.hasDeltas[node.Address] = true
+		}
+	}
+}
+
+// RefreshNodes publishes nodes in full that were updated with deltas since their last full
+// publication, once their refresh interval has passed. Intended to be invoked periodically.
+func (deltaPub *NodeDeltaPublisher) RefreshNodes() {
+	deltaPub.updateMutex.Lock()
+	defer deltaPub.updateMutex.Unlock()
+	now := deltaPub.messageSigner.Clock().Now()
+
+	for address := range deltaPub.hasDeltas {
+		if now.Sub(deltaPub.refreshed[address]) >= deltaPub.refreshInterval {
+			deltaPub.publishFull(deltaPub.published[address], now)
+		}
+	}
+}
+
+// publishFull publishes the full redacted node. Use within a locked section.
+func (deltaPub *NodeDeltaPublisher) publishFull(redacted *types.NodeDiscoveryMessage, now time.Time) {
+	deltaPub.publishNode(redacted)
+	deltaPub.refreshed[redacted.Address] = now
+	delete(deltaPub.hasDeltas, redacted.Address)
+}
+
+// NewNodeDeltaPublisher creates a publisher of node updates as deltas
+//  messageSigner is used to publish the nodes
+//  refreshInterval is the interval after which updated nodes are published in full. Use 0 for
+//  DefaultNodeRefreshInterval
+func NewNodeDeltaPublisher(messageSigner *messaging.MessageSigner, refreshInterval time.Duration) *NodeDeltaPublisher {
+	if refreshInterval <= 0 {
+		refreshInterval = DefaultNodeRefreshInterval
+	}
+	deltaPub := &NodeDeltaPublisher{
+		nodeUpdatePublisher: newNodeUpdatePublisher(messageSigner, types.MessageTypeNodeDelta),
+		hasDeltas:           make(map[string]bool),
+		refreshed:           make(map[string]time.Time),
+		refreshInterval:     refreshInterval,
+	}
+	return deltaPub
+}
@@ -0,0 +1,94 @@
+package nodes_test
+
+import (
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/nodes"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishNodeDeltas(t *testing.T) {
+	const domain = "test"
+	const publisherID = "pub1"
+	const node1ID = "node1"
+	privKey := messaging.CreateAsymKeys()
+	getPubKey := func(address string) *ecdsa.PublicKey {
+		return &privKey.PublicKey
+	}
+	messenger := messaging.NewInMemoryMessenger(dummyConfig)
+	signer := messaging.NewMessageSigner(messenger, privKey, getPubKey)
+	clock := messaging.NewManualClock(time.Now())
+	signer.SetClock(clock)
+	deltaPub := nodes.NewNodeDeltaPublisher(signer, time.Minute)
+	deltaCount := 0
+	messenger.Subscribe("test/pub1/+/$nodeDelta", func(address string, message string) error {
+		deltaCount++
+		return nil
+	})
+
+	domainNodes := nodes.NewDomainNodes(signer)
+	domainNodes.Subscribe(domain, publisherID)
+	regNodes := nodes.NewRegisteredNodes(domain, publisherID)
+	regNodes.SetClock(clock)
+	regNodes.CreateNode(node1ID, types.NodeTypeAdapter)
+	regNodes.UpdateNodeAttr(node1ID, map[types.NodeAttr]string{types.NodeAttrPassword: "secret"})
+
+	// the first publication is in full
+	deltaPub.PublishNodes(regNodes.GetUpdatedNodes(true))
+	node1Addr := nodes.MakeNodeDiscoveryAddress(domain, publisherID, node1ID)
+	require.NotNil(t, domainNodes.GetNodeByAddress(node1Addr))
+	assert.Equal(t, 0, deltaCount)
+
+	// subsequent updates are deltas that are merged by subscribers
+	clock.Advance(time.Second)
+	regNodes.UpdateNodeAttr(node1ID, map[types.NodeAttr]string{types.NodeAttrName: "bob"})
+	regNodes.UpdateNodeStatus(node1ID, map[types.NodeStatus]string{types.NodeStatusHealth: "100"})
+	deltaPub.PublishNodes(regNodes.GetUpdatedNodes(true))
+	assert.Equal(t, 1, deltaCount)
+	node1 := domainNodes.GetNodeByAddress(node1Addr)
+	assert.Equal(t, "bob", node1.Attr[types.NodeAttrName])
+	assert.Equal(t, "100", node1.Status[types.NodeStatusHealth])
+	assert.Empty(t, node1.Attr[types.NodeAttrPassword], "secret attribute published")
+
+	// a subscriber that missed the delta is consistent after the full refresh
+	domainNodes2 := nodes.NewDomainNodes(signer)
+	domainNodes2.Subscribe(domain, publisherID)
+	assert.Empty(t, domainNodes2.GetNodeAttr(node1Addr, types.NodeAttrName))
+	deltaPub.RefreshNodes()
+	assert.Empty(t, domainNodes2.GetNodeAttr(node1Addr, types.NodeAttrName), "refresh before the interval")
+	clock.Advance(time.Minute)
+	deltaPub.RefreshNodes()
+	assert.Equal(t, "bob", domainNodes2.GetNodeAttr(node1Addr, types.NodeAttrName))
+	assert.Equal(t, 1, deltaCount)
+
+	// deltas of unknown nodes are ignored
+	domainNodes.RemoveNode(node1Addr)
+	clock.Advance(time.Second)
+	regNodes.UpdateNodeAttr(node1ID, map[types.NodeAttr]string{types.NodeAttrName: "alice"})
+	deltaPub.PublishNodes(regNodes.GetUpdatedNodes(true))
+	assert.Equal(t, 2, deltaCount)
+	assert.Nil(t, domainNodes.GetNodeByAddress(node1Addr))
+	assert.Equal(t, "alice", domainNodes2.GetNodeAttr(node1Addr, types.NodeAttrName))
+
+	// deleted nodes are no longer refreshed and are published in full when created again
+	discoveryCount := 0
+	messenger.Subscribe("test/pub1/+/$node", func(address string, message string) error {
+		discoveryCount++
+		return nil
+	})
+	discoveryCount = 0
+	regNodes.DeleteNode(node1ID)
+	deltaPub.DeleteNodes(regNodes.GetDeletedNodes(true))
+	clock.Advance(time.Minute)
+	deltaPub.RefreshNodes()
+	assert.Equal(t, 0, discoveryCount)
+	regNodes.CreateNode(node1ID, types.NodeTypeAdapter)
+	deltaPub.PublishNodes(regNodes.GetUpdatedNodes(true))
+	assert.Equal(t, 1, discoveryCount)
+	assert.Equal(t, 2, deltaCount)
+}
@@ -0,0 +1,69 @@
+// Package nodes with publication of node status separate from node discovery
+package nodes
+
+import (
+	"reflect"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/types"
+)
+
+// NodeStatusPublisher publishes updates to registered nodes whose attributes and configuration are
+// unchanged as a NodeStatusMessage on the node's $nodeStatus address. The full node discovery is
+// only published on structural changes, which reduces the republication of retained discovery
+// messages when the status updates frequently.
+type NodeStatusPublisher struct {
+	nodeUpdatePublisher
+}
+
+// DeleteNodes removes the retained status of deleted nodes from the message bus. The nodes are
+// published in full when they are created again.
+//  deletedNodes are the addresses of the deleted nodes, see RegisteredNodes.GetDeletedNodes
+func (statusPub *NodeStatusPublisher) DeleteNodes(deletedNodes []string) {
+	statusPub.updateMutex.Lock()
+	defer statusPub.updateMutex.Unlock()
+
+	for _, address := range deletedNodes {
+		statusPub.deleteNode(address)
+	}
+}
+
+// PublishNodes publishes the updated nodes. Nodes that weren't published before or whose
+// attributes or configuration have changed are published in full. Nodes whose status changed are
+// published on their $nodeStatus address. See DeleteNodes for deleted nodes.
+func (statusPub *NodeStatusPublisher) PublishNodes(updatedNodes []*types.NodeDiscoveryMessage) {
+	statusPub.updateMutex.Lock()
+	defer statusPub.updateMutex.Unlock()
+
+	for _, node := range updatedNodes {
+		if node == nil {
+			continue
+		}
+		redacted := RedactNode(node)
+		published := statusPub.published[node.Address]
+		if published == nil || !reflect.DeepEqual(published.Attr, redacted.Attr) ||
+			!reflect.DeepEqual(published.Config, redacted.Config) {
+			statusPub.publishNode(redacted)
+			continue
+		}
+		statusDiff := types.DiffStatus(published.Status, redacted.Status)
+		if statusDiff.IsEmpty() {
+			continue
+		}
+		statusMessage := &types.NodeStatusMessage{
+			Address:   redacted.Address,
+			Status:    redacted.Status,
+			Timestamp: redacted.Timestamp,
+		}
+		statusPub.publishNodeUpdate(redacted, statusMessage)
+	}
+}
+
+// NewNodeStatusPublisher creates a publisher of node updates with the status on a separate topic
+//  messageSigner is used to publish the nodes
+func NewNodeStatusPublisher(messageSigner *messaging.MessageSigner) *NodeStatusPublisher {
+	statusPub := &NodeStatusPublisher{
+		nodeUpdatePublisher: newNodeUpdatePublisher(messageSigner, types.MessageTypeNodeStatus),
+	}
+	return statusPub
+}
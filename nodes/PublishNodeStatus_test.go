@@ -0,0 +1,94 @@
+package nodes_test
+
+import (
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/nodes"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishNodeStatus(t *testing.T) {
+	const domain = "test"
+	const publisherID = "pub1"
+	const node1ID = "node1"
+	privKey := messaging.CreateAsymKeys()
+	getPubKey := func(address string) *ecdsa.PublicKey {
+		return &privKey.PublicKey
+	}
+	messenger := messaging.NewInMemoryMessenger(dummyConfig)
+	signer := messaging.NewMessageSigner(messenger, privKey, getPubKey)
+	clock := messaging.NewManualClock(time.Now())
+	signer.SetClock(clock)
+	statusPub := nodes.NewNodeStatusPublisher(signer)
+	discoveryCount := 0
+	statusCount := 0
+	messenger.Subscribe("test/pub1/+/$node", func(address string, message string) error {
+		discoveryCount++
+		return nil
+	})
+	messenger.Subscribe("test/pub1/+/$nodeStatus", func(address string, message string) error {
+		statusCount++
+		return nil
+	})
+
+	domainNodes := nodes.NewDomainNodes(signer)
+	domainNodes.Subscribe(domain, publisherID)
+	regNodes := nodes.NewRegisteredNodes(domain, publisherID)
+	regNodes.SetClock(clock)
+	regNodes.CreateNode(node1ID, types.NodeTypeAdapter)
+
+	// the first publication is the full discovery
+	statusPub.PublishNodes(regNodes.GetUpdatedNodes(true))
+	node1Addr := nodes.MakeNodeDiscoveryAddress(domain, publisherID, node1ID)
+	require.NotNil(t, domainNodes.GetNodeByAddress(node1Addr))
+	assert.Equal(t, 1, discoveryCount)
+	assert.Equal(t, 0, statusCount)
+
+	// status changes are published separately and merged by subscribers
+	clock.Advance(time.Second)
+	regNodes.UpdateNodeStatus(node1ID, map[types.NodeStatus]string{types.NodeStatusHealth: "100"})
+	statusPub.PublishNodes(regNodes.GetUpdatedNodes(true))
+	assert.Equal(t, 1, discoveryCount)
+	assert.Equal(t, 1, statusCount)
+	node1 := domainNodes.GetNodeByAddress(node1Addr)
+	require.NotNil(t, node1)
+	assert.Equal(t, "100", node1.Status[types.NodeStatusHealth])
+
+	// structural changes are published in full
+	clock.Advance(time.Second)
+	regNodes.UpdateNodeAttr(node1ID, map[types.NodeAttr]string{types.NodeAttrName: "bob"})
+	statusPub.PublishNodes(regNodes.GetUpdatedNodes(true))
+	assert.Equal(t, 2, discoveryCount)
+	assert.Equal(t, 1, statusCount)
+	assert.Equal(t, "bob", domainNodes.GetNodeAttr(node1Addr, types.NodeAttrName))
+	assert.Equal(t, "100", domainNodes.GetNodeByAddress(node1Addr).Status[types.NodeStatusHealth])
+
+	// status of unknown nodes is ignored
+	domainNodes.RemoveNode(node1Addr)
+	clock.Advance(time.Second)
+	regNodes.UpdateNodeStatus(node1ID, map[types.NodeStatus]string{types.NodeStatusHealth: "50"})
+	statusPub.PublishNodes(regNodes.GetUpdatedNodes(true))
+	assert.Equal(t, 2, statusCount)
+	assert.Nil(t, domainNodes.GetNodeByAddress(node1Addr))
+
+	// deleting a node clears its retained status
+	regNodes.DeleteNode(node1ID)
+	statusPub.DeleteNodes(regNodes.GetDeletedNodes(true))
+	assert.Equal(t, 3, statusCount)
+	retainedCount := 0
+	messenger.Subscribe("test/pub1/+/$nodeStatus", func(address string, message string) error {
+		retainedCount++
+		return nil
+	})
+	assert.Equal(t, 0, retainedCount)
+	// a node that is created again is published in full
+	regNodes.CreateNode(node1ID, types.NodeTypeAdapter)
+	statusPub.PublishNodes(regNodes.GetUpdatedNodes(true))
+	assert.Equal(t, 3, discoveryCount)
+	assert.Equal(t, 3, statusCount)
+}
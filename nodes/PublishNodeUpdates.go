@@ -0,0 +1,68 @@
+// Package nodes with shared publication of partial node updates
+package nodes
+
+import (
+	"sync"
+
+	"github.com/iotdomain/iotdomain-go/lib"
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/sirupsen/logrus"
+)
+
+// nodeUpdatePublisher tracks the last published version of nodes for publishers that publish
+// partial node updates on a separate address, like NodeDeltaPublisher and NodeStatusPublisher.
+type nodeUpdatePublisher struct {
+	messageSigner *messaging.MessageSigner               // for publishing the nodes
+	published     map[string]*types.NodeDiscoveryMessage // last published node, by node address
+	updateMutex   *sync.Mutex                            // mutex for concurrent publication
+	updateType    types.MessageType                      // message type of the partial updates, eg $nodeDelta
+}
+
+// deleteNode forgets a deleted node so it is published in full when it is created again, and
+// clears its retained partial update. Use within a locked section.
+func (nodePub *nodeUpdatePublisher) deleteNode(address string) {
+	if _, found := nodePub.published[address]; !found {
+		return
+	}
+	delete(nodePub.published, address)
+	updateAddress := types.MakeMessageAddress(lib.MakeBaseAddress(address), nodePub.updateType)
+	if nodePub.messageSigner.IsRetained(updateAddress) {
+		logrus.Infof("nodeUpdatePublisher.deleteNode: remove node update: %s", updateAddress)
+		nodePub.messageSigner.ClearRetained(updateAddress)
+	}
+}
+
+// publishNode publishes the full redacted node on its discovery address. Use within a locked section.
+func (nodePub *nodeUpdatePublisher) publishNode(redacted *types.NodeDiscoveryMessage) {
+	logrus.Infof("nodeUpdatePublisher.publishNode: publish node discovery: %s", redacted.Address)
+	nodePub.messageSigner.PublishObjectWithPolicy(redacted.Address, redacted, nil)
+	nodePub.published[redacted.Address] = redacted
+}
+
+// publishNodeUpdate publishes a partial update of the redacted node on its update address. If
+// publication fails, the next publication of the node is in full. Use within a locked section.
+//  update is the message with the partial update, eg a NodeDeltaMessage
+func (nodePub *nodeUpdatePublisher) publishNodeUpdate(redacted *types.NodeDiscoveryMessage, update interface{}) error {
+	updateAddress := types.MakeMessageAddress(lib.MakeBaseAddress(redacted.Address), nodePub.updateType)
+	logrus.Infof("nodeUpdatePublisher.publishNodeUpdate: publish node update: %s", updateAddress)
+	err := nodePub.messageSigner.PublishObjectWithPolicy(updateAddress, update, nil)
+	if err != nil {
+		delete(nodePub.published, redacted.Address)
+		return err
+	}
+	nodePub.published[redacted.Address] = redacted
+	return nil
+}
+
+// newNodeUpdatePublisher creates the shared state of publishers of partial node updates
+//  messageSigner is used to publish the nodes
+//  updateType is the message type of the partial updates
+func newNodeUpdatePublisher(messageSigner *messaging.MessageSigner, updateType types.MessageType) nodeUpdatePublisher {
+	return nodeUpdatePublisher{
+		messageSigner: messageSigner,
+		published:     make(map[string]*types.NodeDiscoveryMessage),
+		updateMutex:   &sync.Mutex{},
+		updateType:    updateType,
+	}
+}
@@ -18,10 +18,53 @@ func PublishRegisteredNodes(
 	for _, node := range updatedNodes {
 		if node != nil {
 			logrus.Infof("PublishRegisteredNodes: publish node discovery: %s", node.Address)
-			messageSigner.PublishObject(node.Address, true, node, nil)
-		} else {
-			// node was deleted
-			// TODO: remove node from the message bus
+			messageSigner.PublishObjectWithPolicy(node.Address, RedactNode(node), nil)
 		}
+		// deleted nodes are removed from the message bus with PublishDeletedNodes
 	}
 }
+
+// PublishDeletedNodes removes the retained discovery messages of deleted nodes from the message bus
+//  deletedNodes are the addresses of the deleted nodes, see RegisteredNodes.GetDeletedNodes
+func PublishDeletedNodes(deletedNodes []string, messageSigner *messaging.MessageSigner) {
+	for _, address := range deletedNodes {
+		logrus.Infof("PublishDeletedNodes: remove node discovery: %s", address)
+		messageSigner.ClearRetained(address)
+	}
+}
+
+// SecretNodeAttrs are attributes whose values are never published
+var SecretNodeAttrs = []types.NodeAttr{types.NodeAttrLoginName, types.NodeAttrPassword}
+
+// IsSecretAttr returns true if the node attribute value must not be published or logged.
+// Attributes are secret if they are one of SecretNodeAttrs or their configuration is marked as secret.
+func IsSecretAttr(node *types.NodeDiscoveryMessage, attrName types.NodeAttr) bool {
+	for _, secretAttr := range SecretNodeAttrs {
+		if attrName == secretAttr {
+			return true
+		}
+	}
+	config, found := node.Config[attrName]
+	return found && config.Secret
+}
+
+// RedactNode returns a copy of the node without the values of secret attributes, for publication.
+// Secret configuration remains listed so it can be configured, but without its default value.
+// The node itself is not modified.
+func RedactNode(node *types.NodeDiscoveryMessage) *types.NodeDiscoveryMessage {
+	redacted := *node
+	redacted.Attr = make(types.NodeAttrMap)
+	for key, value := range node.Attr {
+		if !IsSecretAttr(node, key) {
+			redacted.Attr[key] = value
+		}
+	}
+	redacted.Config = make(types.ConfigAttrMap)
+	for key, config := range node.Config {
+		if IsSecretAttr(node, key) {
+			config.Default = ""
+		}
+		redacted.Config[key] = config
+	}
+	return &redacted
+}
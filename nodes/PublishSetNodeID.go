@@ -3,8 +3,6 @@ package nodes
 
 import (
 	"crypto/ecdsa"
-	"strings"
-	"time"
 
 	"github.com/iotdomain/iotdomain-go/lib"
 	"github.com/iotdomain/iotdomain-go/messaging"
@@ -19,19 +17,19 @@ func PublishSetNodeID(
 	messageSigner *messaging.MessageSigner, encryptionKey *ecdsa.PublicKey) error {
 
 	logrus.Infof("PublishSetNodeID: publishing encrypted message to %s", nodeAddress)
-	segments := strings.Split(nodeAddress, "/")
-	if len(segments) < 3 {
+	segments, err := types.ParseBaseAddress(nodeAddress)
+	if err != nil || segments.NodeID == "" {
 		return lib.MakeErrorf("PublishNodeAlias: Node address %s is invalid", nodeAddress)
 	}
-	setNodeIDAddr := MakeSetNodeIDAddress(segments[0], segments[1], segments[2])
+	setNodeIDAddr := MakeSetNodeIDAddress(segments.Domain, segments.PublisherID, segments.NodeID)
 	// Encecode the SetMessage
-	timeStampStr := time.Now().Format("2006-01-02T15:04:05.000-0700")
+	timeStampStr := messageSigner.Clock().Now().Format("2006-01-02T15:04:05.000-0700")
 	var message = types.SetNodeIDMessage{
 		Address:   setNodeIDAddr,
 		Sender:    sender,
 		Timestamp: timeStampStr,
 		NodeID:    newNodeID,
 	}
-	err := messageSigner.PublishObject(setNodeIDAddr, false, &message, encryptionKey)
+	err = messageSigner.PublishObjectWithPolicy(setNodeIDAddr, &message, encryptionKey)
 	return err
 }
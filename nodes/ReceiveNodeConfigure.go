@@ -12,8 +12,10 @@ import (
 )
 
 // NodeConfigureHandler application handler when command to update a node's configuration is received
-// The handler is only invoked if the node is confirmed to exist.
-type NodeConfigureHandler func(nodeHWID string, params types.NodeAttrMap)
+// The handler is only invoked if the node is confirmed to exist and the sender is verified. The params
+// only contain attributes that are declared in the node's configuration.
+// The handler returns the subset of the params that is accepted. These are applied to the node configuration.
+type NodeConfigureHandler func(nodeHWID string, params types.NodeAttrMap) types.NodeAttrMap
 
 // ReceiveNodeConfigure with handling of node configure commands aimed at nodes managed by this publisher.
 // This decrypts incoming messages determines the sender and verifies the signature with
@@ -30,7 +32,7 @@ type ReceiveNodeConfigure struct {
 
 // SetConfigureNodeHandler set the handler for updating node inputs
 func (nodeConfigure *ReceiveNodeConfigure) SetConfigureNodeHandler(
-	handler func(nodeHWID string, params types.NodeAttrMap)) {
+	handler func(nodeHWID string, params types.NodeAttrMap) types.NodeAttrMap) {
 	nodeConfigure.nodeConfigureHandler = handler
 }
 
@@ -55,9 +57,11 @@ func (nodeConfigure *ReceiveNodeConfigure) Stop() {
 // - check if the message is encrypted
 // - check if the signature is valid
 // - check if the node is valid
-// - if a configuration handler is set, let it apply the configuration
+// - check if the sender is authorized for the node
+// - reject attributes that are not declared in the node's configuration
+// - if a configuration handler is set, let it determine which configuration to accept
+// - apply the accepted configuration
 // - save node configuration if persistence is set
-// TODO: support for authorization per node
 func (nodeConfigure *ReceiveNodeConfigure) receiveConfigureCommand(nodeAddress string, message string) error {
 	var configureMessage types.NodeConfigureMessage
 
@@ -71,21 +75,31 @@ func (nodeConfigure *ReceiveNodeConfigure) receiveConfigureCommand(nodeAddress s
 		return lib.MakeErrorf("receiveConfigureCommand: Message to %s. Error %s'. Message discarded.", nodeAddress, err)
 	}
 
-	// TODO: authorization check
 	node := nodeConfigure.registeredNodes.GetNodeByAddress(nodeAddress)
 	if node == nil || message == "" {
 		return lib.MakeErrorf("receiveConfigureCommand unknown node for address %s or missing message", nodeAddress)
 	}
+	err = nodeConfigure.registeredNodes.AuthorizeSender(node.HWID, configureMessage.Sender)
+	if err != nil {
+		return err
+	}
 	logrus.Infof("receiveConfigureCommand configure command on address %s. isEncrypted=%t, isSigned=%t", nodeAddress, isEncrypted, isSigned)
 
-	params := configureMessage.Attr
+	// only attributes declared in the node configuration can be configured
+	params := types.NodeAttrMap{}
+	for attrName, value := range configureMessage.Attr {
+		if _, isConfig := node.Config[attrName]; isConfig {
+			params[attrName] = value
+		} else {
+			logrus.Warningf("receiveConfigureCommand: Node '%s' attribute '%s' is not a configuration. Attribute rejected.",
+				node.HWID, attrName)
+		}
+	}
 	if nodeConfigure.nodeConfigureHandler != nil {
 		// A handler can determine which configuration updates are applied
-		nodeConfigure.nodeConfigureHandler(node.HWID, params)
-	} else {
-		// Without a handler apply the configuration update
-		nodeConfigure.registeredNodes.UpdateNodeConfigValues(node.HWID, params)
+		params = nodeConfigure.nodeConfigureHandler(node.HWID, params)
 	}
+	nodeConfigure.registeredNodes.UpdateNodeConfigValues(node.HWID, params)
 	return nil
 }
 
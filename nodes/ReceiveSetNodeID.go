@@ -3,8 +3,6 @@ package nodes
 
 import (
 	"crypto/ecdsa"
-	"fmt"
-	"strings"
 	"sync"
 
 	"github.com/iotdomain/iotdomain-go/lib"
@@ -57,14 +55,14 @@ func (setNodeID *ReceiveSetNodeID) decodeSetNodeIDCommand(setAddress string, mes
 	var setNodeIDMessage types.SetNodeIDMessage
 
 	// Check that address is one of our inputs
-	segments := strings.Split(setAddress, "/")
+	segments, err := types.ParseAddress(setAddress)
 	// a full address is required: domain/pub/node/$setNodeId
-	if len(segments) < 4 {
+	if err != nil {
 		return lib.MakeErrorf("decodeSetNodeIDCommand: address '%s' is incomplete", setAddress)
 	}
 	// determine which node this message is for
-	segments[3] = types.MessageTypeNodeDiscovery
-	nodeAddr := strings.Join(segments, "/")
+	segments.MessageType = types.MessageTypeNodeDiscovery
+	nodeAddr := types.MakeAddress(segments)
 
 	isEncrypted, isSigned, err := setNodeID.messageSigner.DecodeMessage(message, &setNodeIDMessage)
 
@@ -89,7 +87,8 @@ func (setNodeID *ReceiveSetNodeID) decodeSetNodeIDCommand(setAddress string, mes
 // MakeSetNodeIDAddress creates the address used to update a node's ID
 // domain, publisherID, nodeID of the existing node
 func MakeSetNodeIDAddress(domain string, publisherID string, nodeID string) string {
-	address := fmt.Sprintf("%s/%s/%s/"+types.MessageTypeSetNodeID, domain, publisherID, nodeID)
+	address := types.MakeAddress(&types.AddressSegments{
+		Domain: domain, PublisherID: publisherID, NodeID: nodeID, MessageType: types.MessageTypeSetNodeID})
 	return address
 }
 
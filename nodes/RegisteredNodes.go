@@ -6,12 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"regexp"
+	"sort"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/iotdomain/iotdomain-go/lib"
+	"github.com/iotdomain/iotdomain-go/messaging"
 	"github.com/iotdomain/iotdomain-go/types"
 	"github.com/sirupsen/logrus"
 )
@@ -23,13 +25,22 @@ import (
 // A registered node is identified by its hwID which is immutable and relates to the hardware the
 // node is attached to. Its nodeID is used for publication and can change.
 type RegisteredNodes struct {
-	domain      string                                 // domain these nodes belong to
-	publisherID string                                 // ID of the publisher these nodes belong to
-	deviceMap   map[string]*types.NodeDiscoveryMessage // registered nodes by device ID
+	clock        messaging.Clock                        // clock for node timestamps and status intervals
+	deletedNodes map[string]bool                        // addresses of deleted nodes to remove from the message bus
+	domain       string                                 // domain these nodes belong to
+	publisherID  string                                 // ID of the publisher these nodes belong to
+	deviceMap    map[string]*types.NodeDiscoveryMessage // registered nodes by device ID
 	// onSetNodeID  func(node *types.NodeDiscoveryMessage, newID string) // notify of a change in node ID. Use this to update input and output addresses
 	nodeMap      map[string]*types.NodeDiscoveryMessage // registered nodes by node ID
 	updatedNodes map[string]*types.NodeDiscoveryMessage // updated nodes by device ID
 	updateMutex  *sync.Mutex                            // mutex for async updating of nodes
+
+	onStatusChange func(nodeHWID string, diff types.NodeStatusDiff) // optional handler of status changes
+	healthScore    HealthScoreFunc                                  // optional health score function, default is DefaultHealthScore
+
+	statusInterval  time.Duration                          // min interval between status-only publications. 0 is immediate
+	statusPending   map[string]*types.NodeDiscoveryMessage // nodes with status-only changes waiting for publication, by node address
+	statusPublished map[string]time.Time                   // time a node was last published, by node HWID
 }
 
 // Clone returns a copy of the node with new Attr, Config and Status maps
@@ -52,20 +63,12 @@ func (regNodes *RegisteredNodes) Clone(node *types.NodeDiscoveryMessage) *types.
 	return &newNode
 }
 
-// CreateNode creates a node instance for a device or service and adds it to the list. If the node exists it will remain unchanged.
+// CreateNode creates a node instance for a device or service and adds it to the list.
+// If the node exists its attributes, configuration and status are preserved. See GetOrCreateNode.
 // This returns the existing node instance or a newly created instance
 func (regNodes *RegisteredNodes) CreateNode(hwID string, nodeType types.NodeType) *types.NodeDiscoveryMessage {
-	existingNode := regNodes.GetNodeByHWID(hwID)
-	if existingNode != nil {
-		return existingNode
-	}
-
-	regNodes.updateMutex.Lock()
-	defer regNodes.updateMutex.Unlock()
-
-	newNode := NewNode(regNodes.domain, regNodes.publisherID, hwID, nodeType)
-	regNodes.updateNode(newNode)
-	return newNode
+	node, _ := regNodes.GetOrCreateNode(hwID, nodeType)
+	return node
 }
 
 // CreateNodeConfig creates a new node configuration instance and adds it to the node with the given ID.
@@ -106,8 +109,9 @@ func (regNodes *RegisteredNodes) CreateNodeConfig(
 }
 
 // DeleteNode deletes a node from the collection of registered nodes
+// Child nodes of a deleted gateway are kept as orphans. See also DeleteGateway.
 func (regNodes *RegisteredNodes) DeleteNode(hwAddress string) {
-	// TODO
+	regNodes.DeleteGateway(hwAddress, false)
 }
 
 // GetAllNodes returns a list of nodes
@@ -122,6 +126,18 @@ func (regNodes *RegisteredNodes) GetAllNodes() []*types.NodeDiscoveryMessage {
 	return nodeList
 }
 
+// GetNodeAlias returns the nodeID under which a node is published if it differs from its hardware ID
+// Returns the alias and true if the node is published under an alias, or the hwID and false if not.
+func (regNodes *RegisteredNodes) GetNodeAlias(nodeHWID string) (alias string, hasAlias bool) {
+	regNodes.updateMutex.Lock()
+	defer regNodes.updateMutex.Unlock()
+	var node = regNodes.deviceMap[nodeHWID]
+	if node == nil || node.NodeID == "" {
+		return nodeHWID, false
+	}
+	return node.NodeID, node.NodeID != node.HWID
+}
+
 // GetNodeAttr returns a node attribute value
 func (regNodes *RegisteredNodes) GetNodeAttr(nodeHWID string, attrName types.NodeAttr) string {
 	regNodes.updateMutex.Lock()
@@ -140,11 +156,11 @@ func (regNodes *RegisteredNodes) GetNodeByAddress(address string) *types.NodeDis
 	regNodes.updateMutex.Lock()
 	defer regNodes.updateMutex.Unlock()
 
-	segments := strings.Split(address, "/")
-	if len(segments) < 3 {
+	segments, err := types.ParseBaseAddress(address)
+	if err != nil || segments.NodeID == "" {
 		return nil
 	}
-	var node = regNodes.nodeMap[segments[2]]
+	var node = regNodes.nodeMap[segments.NodeID]
 	return node
 }
 
@@ -158,6 +174,33 @@ func (regNodes *RegisteredNodes) GetNodeByHWID(nodeHWID string) *types.NodeDisco
 	return node
 }
 
+// GetOrCreateNode returns the node of a device or service, creating it if it doesn't exist.
+// An existing node keeps its attributes, configuration and status. Only its type is updated if it differs.
+// This is safe to call repeatedly, eg on each discovery of the device.
+//  hwID of the device or service
+//  nodeType of the node
+// Returns the node and true if it was created or false if it already existed
+func (regNodes *RegisteredNodes) GetOrCreateNode(hwID string, nodeType types.NodeType) (
+	node *types.NodeDiscoveryMessage, created bool) {
+
+	regNodes.updateMutex.Lock()
+	defer regNodes.updateMutex.Unlock()
+
+	existingNode := regNodes.deviceMap[hwID]
+	if existingNode != nil {
+		if existingNode.Attr[types.NodeAttrType] == string(nodeType) {
+			return existingNode, false
+		}
+		newNode := regNodes.Clone(existingNode)
+		newNode.Attr[types.NodeAttrType] = string(nodeType)
+		regNodes.updateNode(newNode)
+		return newNode, false
+	}
+	newNode := newNode(regNodes.domain, regNodes.publisherID, hwID, nodeType, regNodes.clock)
+	regNodes.updateNode(newNode)
+	return newNode, true
+}
+
 // GetNodeByNodeID returns a nodes from the publisher
 // Returns nil if address has no known node
 func (regNodes *RegisteredNodes) GetNodeByNodeID(nodeID string) *types.NodeDiscoveryMessage {
@@ -175,20 +218,15 @@ func (regNodes *RegisteredNodes) GetNodeByNodeID(nodeID string) *types.NodeDisco
 func (regNodes *RegisteredNodes) GetNodeConfigBool(
 	nodeHWID string, attrName types.NodeAttr, defaultValue bool) (value bool, err error) {
 
-	valueStr, err := regNodes.GetNodeConfigString(nodeHWID, attrName, "")
-	if err != nil {
-		return defaultValue, err
-	}
-	if valueStr == "" {
-		return defaultValue, nil
-	}
-	value, err = strconv.ParseBool(valueStr)
-	if err != nil {
-		msg := fmt.Sprintf("NodeList.GetNodeConfigBool: Node '%s' configuration '%s' is not a boolean: %s",
-			nodeHWID, attrName, err)
-		return defaultValue, errors.New(msg)
-	}
-	return value, nil
+	value = defaultValue
+	err = regNodes.parseNodeConfig(nodeHWID, attrName, "a boolean", func(valueStr string) error {
+		parsed, err := strconv.ParseBool(valueStr)
+		if err == nil {
+			value = parsed
+		}
+		return err
+	})
+	return value, err
 }
 
 // GetNodeConfigFloat returns the node configuration value as an floating point number
@@ -198,21 +236,15 @@ func (regNodes *RegisteredNodes) GetNodeConfigBool(
 func (regNodes *RegisteredNodes) GetNodeConfigFloat(
 	nodeHWID string, attrName types.NodeAttr, defaultValue float32) (value float32, err error) {
 
-	valueStr, err := regNodes.GetNodeConfigString(nodeHWID, attrName, "")
-	if err != nil {
-		return defaultValue, err
-	}
-	if valueStr == "" {
-		return defaultValue, nil
-	}
-	value64, err := strconv.ParseFloat(valueStr, 32)
-	value = float32(value64)
-	if err != nil {
-		msg := fmt.Sprintf("NodeList.GetNodeConfigFloat: Node '%s' configuration '%s' is not a float: %s",
-			nodeHWID, attrName, err)
-		return defaultValue, errors.New(msg)
-	}
-	return value, nil
+	value = defaultValue
+	err = regNodes.parseNodeConfig(nodeHWID, attrName, "a float", func(valueStr string) error {
+		parsed, err := strconv.ParseFloat(valueStr, 32)
+		if err == nil {
+			value = float32(parsed)
+		}
+		return err
+	})
+	return value, err
 }
 
 // GetNodeConfigInt returns the node configuration value as an integer
@@ -221,20 +253,15 @@ func (regNodes *RegisteredNodes) GetNodeConfigFloat(
 func (regNodes *RegisteredNodes) GetNodeConfigInt(
 	nodeHWID string, attrName types.NodeAttr, defaultValue int) (value int, err error) {
 
-	valueStr, err := regNodes.GetNodeConfigString(nodeHWID, attrName, "")
-	if err != nil {
-		return defaultValue, err
-	}
-	if valueStr == "" {
-		return defaultValue, nil
-	}
-	value, err = strconv.Atoi(valueStr)
-	if err != nil {
-		msg := fmt.Sprintf("NodeList.GetNodeConfigInt: Node '%s' configuration '%s' is not an integer: %s",
-			nodeHWID, attrName, err)
-		return defaultValue, errors.New(msg)
-	}
-	return value, nil
+	value = defaultValue
+	err = regNodes.parseNodeConfig(nodeHWID, attrName, "an integer", func(valueStr string) error {
+		parsed, err := strconv.Atoi(valueStr)
+		if err == nil {
+			value = parsed
+		}
+		return err
+	})
+	return value, err
 }
 
 // GetNodeConfigString returns the attribute value of a node in this list
@@ -242,33 +269,60 @@ func (regNodes *RegisteredNodes) GetNodeConfigInt(
 // An error is returned when the node or configuration doesn't exist.
 func (regNodes *RegisteredNodes) GetNodeConfigString(
 	nodeHWID string, attrName types.NodeAttr, defaultValue string) (value string, err error) {
+
+	value, _, err = regNodes.GetNodeConfigValue(nodeHWID, attrName)
+	if err != nil || value == "" {
+		return defaultValue, err
+	}
+	return value, nil
+}
+
+// GetNodeConfigValue returns the effective value of a node configuration: the configured value or
+// the configuration default if no value is set.
+// isSecret is true if the value must not be published or logged, see IsSecretAttr. Errors never
+// contain the value.
+// Returns an empty value if neither value nor default is set. An error is returned when the node
+// or configuration doesn't exist.
+func (regNodes *RegisteredNodes) GetNodeConfigValue(
+	nodeHWID string, attrName types.NodeAttr) (value string, isSecret bool, err error) {
 	regNodes.updateMutex.Lock()
 	defer regNodes.updateMutex.Unlock()
 
 	var node = regNodes.deviceMap[nodeHWID]
 	if node == nil {
-		msg := fmt.Sprintf("NodeList.GetNodeConfigString: Device '%s' not found", nodeHWID)
-		return defaultValue, errors.New(msg)
+		msg := fmt.Sprintf("NodeList.GetNodeConfigValue: Device '%s' not found", nodeHWID)
+		return "", false, errors.New(msg)
 	}
-
-	// in case of error, always return defaultValue
-
 	config, configExists := node.Config[attrName]
 	if !configExists {
-		msg := fmt.Sprintf("NodeList.GetNodeConfigString: Device '%s' configuration '%s' does not exist",
+		msg := fmt.Sprintf("NodeList.GetNodeConfigValue: Device '%s' configuration '%s' does not exist",
 			nodeHWID, attrName)
-		return defaultValue, errors.New(msg)
+		return "", false, errors.New(msg)
 	}
+	isSecret = IsSecretAttr(node, attrName)
 	// if no value is known, use the configuration default
-	attrValue, exists := node.Attr[attrName]
-	if !exists || attrValue == "" {
-		attrValue = config.Default
+	value, exists := node.Attr[attrName]
+	if !exists || value == "" {
+		value = config.Default
 	}
-	// if still no value is known, use the provided default
-	if attrValue == "" {
-		return defaultValue, nil
+	return value, isSecret, nil
+}
+
+// GetDeletedNodes returns the addresses of nodes that have been deleted, sorted
+// clearDeletions clears the list of deletions. Intended for removing deleted nodes from the message bus.
+func (regNodes *RegisteredNodes) GetDeletedNodes(clearDeletions bool) []string {
+	regNodes.updateMutex.Lock()
+	defer regNodes.updateMutex.Unlock()
+
+	deleteList := make([]string, 0, len(regNodes.deletedNodes))
+	for address := range regNodes.deletedNodes {
+		deleteList = append(deleteList, address)
 	}
-	return attrValue, nil
+	sort.Strings(deleteList)
+	if clearDeletions {
+		regNodes.deletedNodes = make(map[string]bool)
+	}
+	return deleteList
 }
 
 // GetUpdatedNodes returns the list of nodes that have been updated
@@ -279,9 +333,24 @@ func (regNodes *RegisteredNodes) GetUpdatedNodes(clearUpdates bool) []*types.Nod
 	regNodes.updateMutex.Lock()
 	defer regNodes.updateMutex.Unlock()
 
+	// status changes whose interval has passed are published with the other updates
+	now := regNodes.clock.Now()
+	for address, node := range regNodes.statusPending {
+		if now.Sub(regNodes.statusPublished[node.HWID]) >= regNodes.statusInterval {
+			if regNodes.updatedNodes == nil {
+				regNodes.updatedNodes = make(map[string]*types.NodeDiscoveryMessage)
+			}
+			regNodes.updatedNodes[address] = node
+			delete(regNodes.statusPending, address)
+		}
+	}
+
 	if regNodes.updatedNodes != nil {
 		for _, node := range regNodes.updatedNodes {
 			updateList = append(updateList, node)
+			if clearUpdates && node != nil {
+				regNodes.statusPublished[node.HWID] = now
+			}
 		}
 		if clearUpdates {
 			regNodes.updatedNodes = nil
@@ -316,6 +385,24 @@ func (regNodes *RegisteredNodes) LoadNodes(filename string) error {
 	return nil
 }
 
+// ResolveAliasAddress returns the address with the node hwID replaced by the node's alias
+// The address is parsed and composed with the address format in use, see types.SetAddressFormat.
+// The address is returned unchanged if it is invalid, doesn't belong to this publisher, the node is
+// not registered or the node has no alias.
+func (regNodes *RegisteredNodes) ResolveAliasAddress(address string) string {
+	segments, err := types.ParseBaseAddress(address)
+	if err != nil || segments.NodeID == "" ||
+		segments.Domain != regNodes.domain || segments.PublisherID != regNodes.publisherID {
+		return address
+	}
+	alias, hasAlias := regNodes.GetNodeAlias(segments.NodeID)
+	if !hasAlias {
+		return address
+	}
+	segments.NodeID = alias
+	return types.MakeAddress(segments)
+}
+
 // SaveNodes saves the current registered nodes to a JSON file
 func (regNodes *RegisteredNodes) SaveNodes(filename string) error {
 	collection := regNodes.GetAllNodes()
@@ -364,7 +451,10 @@ func (regNodes *RegisteredNodes) SetNodeID(node *types.NodeDiscoveryMessage, new
 	regNodes.updateMutex.Unlock()
 
 	newNode.Address = MakeNodeDiscoveryAddress(regNodes.domain, regNodes.publisherID, newNode.NodeID)
+	regNodes.updateMutex.Lock()
 	regNodes.updateNode(newNode)
+	regNodes.updateGatewayAddress(node.Address, newNode.Address)
+	regNodes.updateMutex.Unlock()
 	// if regNodes.onSetNodeID != nil {
 	// 	regNodes.onSetNodeID(node, newNodeID)
 	// }
@@ -372,6 +462,32 @@ func (regNodes *RegisteredNodes) SetNodeID(node *types.NodeDiscoveryMessage, new
 	return true
 }
 
+// SetClock sets the clock used for node timestamps and status intervals. Intended for testing.
+func (regNodes *RegisteredNodes) SetClock(clock messaging.Clock) {
+	regNodes.updateMutex.Lock()
+	defer regNodes.updateMutex.Unlock()
+	regNodes.clock = clock
+}
+
+// SetStatusInterval sets the minimum interval between publications of status-only changes of a node.
+// Status changes that occur within the interval are coalesced and published when the interval has passed.
+// Changes to attributes and configuration are always published immediately.
+// The default interval of 0 publishes status changes immediately.
+func (regNodes *RegisteredNodes) SetStatusInterval(interval time.Duration) {
+	regNodes.updateMutex.Lock()
+	defer regNodes.updateMutex.Unlock()
+	regNodes.statusInterval = interval
+}
+
+// SetStatusChangeHandler sets the handler that is notified of the status attributes that changed
+// with UpdateNodeStatus or UpdateErrorStatus. The handler is invoked after the node is updated.
+// Use nil to remove the handler.
+func (regNodes *RegisteredNodes) SetStatusChangeHandler(handler func(nodeHWID string, diff types.NodeStatusDiff)) {
+	regNodes.updateMutex.Lock()
+	defer regNodes.updateMutex.Unlock()
+	regNodes.onStatusChange = handler
+}
+
 // SetNodeIDHandler sets the handler that is notified if the nodeID is set
 // intended to update the input and output address to use the new node ID
 // func (regNodes *RegisteredNodes) SetNodeIDHandler(handler func(node *types.NodeDiscoveryMessage, newNodeID string)) {
@@ -381,14 +497,31 @@ func (regNodes *RegisteredNodes) SetNodeID(node *types.NodeDiscoveryMessage, new
 // UpdateErrorStatus sets the device RunState to the given status with a lasterror message
 // Use NodeRunStateError for errors and NodeRunStateReady to clear error
 // This only updates the node if the status or lastError message changes
+// The lastErrorCode status attribute is left as is. Use UpdateErrorStatusWithCode to change it.
 func (regNodes *RegisteredNodes) UpdateErrorStatus(nodeHWID string, runState string, errorMsg string) (changed bool) {
+	return regNodes.updateErrorStatus(nodeHWID, runState, false, "", errorMsg)
+}
+
+// UpdateErrorStatusWithCode updates a node's runState, lastError and lastErrorCode status attributes
+// The error code lets monitoring aggregate errors without parsing the error message.
+//  errorCode is one of the standard codes or a custom code. Use "" to clear the error code.
+// returns true if the node has changed, false if the node doesn't exist or the status is unchanged
+func (regNodes *RegisteredNodes) UpdateErrorStatusWithCode(
+	nodeHWID string, runState string, errorCode types.NodeErrorCode, errorMsg string) (changed bool) {
+	return regNodes.updateErrorStatus(nodeHWID, runState, true, errorCode, errorMsg)
+}
+
+// updateErrorStatus updates a node's runState and lastError status attributes and if setCode is
+// true, its lastErrorCode.
+func (regNodes *RegisteredNodes) updateErrorStatus(
+	nodeHWID string, runState string, setCode bool, errorCode types.NodeErrorCode, errorMsg string) (changed bool) {
+
 	node := regNodes.GetNodeByHWID(nodeHWID)
 	if node == nil {
 		return false
 	}
 
 	regNodes.updateMutex.Lock()
-	defer regNodes.updateMutex.Unlock()
 
 	newNode := regNodes.Clone(node)
 	changed = false
@@ -401,10 +534,26 @@ func (regNodes *RegisteredNodes) UpdateErrorStatus(nodeHWID string, runState str
 		changed = true
 		newNode.Status[types.NodeStatusRunState] = runState
 	}
+	if setCode {
+		existingCode, hasCode := node.Status[types.NodeStatusLastErrorCode]
+		if errorCode == "" && hasCode {
+			delete(newNode.Status, types.NodeStatusLastErrorCode)
+			changed = true
+		} else if errorCode != "" && existingCode != string(errorCode) {
+			newNode.Status[types.NodeStatusLastErrorCode] = string(errorCode)
+			changed = true
+		}
+	}
 	// Don't unnecesarily republish the node if the status doesnt change
 	if changed {
 		regNodes.updateNode(newNode)
 	}
+	onStatusChange := regNodes.onStatusChange
+	regNodes.updateMutex.Unlock()
+
+	if changed && onStatusChange != nil {
+		onStatusChange(nodeHWID, types.DiffStatus(node.Status, newNode.Status))
+	}
 	return changed
 }
 
@@ -442,10 +591,22 @@ func (regNodes *RegisteredNodes) UpdateNodeAttr(nodeHWID string, attrParams map[
 //  param is the map with key-value pairs of configuration values to update
 // returns true if configuration changes, false if configuration remains unchanged or doesn't exist
 func (regNodes *RegisteredNodes) UpdateNodeConfigValues(nodeHWID string, params types.NodeAttrMap) (changed bool) {
+	_, _, changed = regNodes.updateNodeConfigValues(nodeHWID, params)
+	return changed
+}
+
+// updateNodeConfigValues validates and applies configuration values to a registered node.
+// Invalid values are logged and skipped.
+// Returns the attributes whose value was accepted, the attributes that were rejected with the
+// reason, and whether the configuration has changed.
+func (regNodes *RegisteredNodes) updateNodeConfigValues(nodeHWID string, params types.NodeAttrMap) (
+	accepted []types.NodeAttr, rejected map[types.NodeAttr]error, changed bool) {
 
+	accepted = make([]types.NodeAttr, 0)
+	rejected = make(map[types.NodeAttr]error)
 	node := regNodes.GetNodeByHWID(nodeHWID)
 	if node == nil || params == nil {
-		return false
+		return accepted, rejected, false
 	}
 	regNodes.updateMutex.Lock()
 	defer regNodes.updateMutex.Unlock()
@@ -453,13 +614,17 @@ func (regNodes *RegisteredNodes) UpdateNodeConfigValues(nodeHWID string, params
 
 	changed = false
 	for key, newValue := range params {
-		_, configExists := node.Config[key]
+		config, configExists := node.Config[key]
 		if !configExists {
 			// ignore invalid configuration
 			logrus.Warningf("UpdateNodeConfigValues: Node '%s', attribute '%s' is not a configuration", nodeHWID, key)
+			rejected[key] = fmt.Errorf("not a configuration attribute")
+		} else if err := ValidateConfigValue(&config, newValue); err != nil {
+			logrus.Warningf("UpdateNodeConfigValues: Node '%s', attribute '%s': %s", nodeHWID, key, err)
+			rejected[key] = err
 		} else {
 			// update attribute with the new value
-			// TODO: datatype check
+			accepted = append(accepted, key)
 			oldValue, attrExists := node.Attr[key]
 			if !attrExists || oldValue != newValue {
 				newNode.Attr[key] = newValue
@@ -471,7 +636,7 @@ func (regNodes *RegisteredNodes) UpdateNodeConfigValues(nodeHWID string, params
 	if changed {
 		regNodes.updateNode(newNode)
 	}
-	return changed
+	return accepted, rejected, changed
 }
 
 // // UpdateNode replaces a node or adds a new node based on node.Address.
@@ -489,10 +654,17 @@ func (regNodes *RegisteredNodes) UpdateNodeConfigValues(nodeHWID string, params
 //
 // If a config already exists then its value is retained but its configuration parameters are replaced.
 // Nodes are immutable. A new node is created and published and the old node instance is discarded.
-func (regNodes *RegisteredNodes) UpdateNodeConfig(nodeHWID string, attrName types.NodeAttr, configAttr *types.ConfigAttr) {
+// Returns an error if the configuration has an invalid pattern.
+func (regNodes *RegisteredNodes) UpdateNodeConfig(nodeHWID string, attrName types.NodeAttr, configAttr *types.ConfigAttr) error {
 	node := regNodes.GetNodeByHWID(nodeHWID)
 	if node == nil || configAttr == nil || attrName == "" {
-		return
+		return nil
+	}
+	if configAttr.Pattern != "" {
+		if _, err := regexp.Compile(configAttr.Pattern); err != nil {
+			return lib.MakeErrorf("UpdateNodeConfig: Node '%s', attribute '%s' has invalid pattern '%s': %s",
+				nodeHWID, attrName, configAttr.Pattern, err)
+		}
 	}
 	regNodes.updateMutex.Lock()
 	defer regNodes.updateMutex.Unlock()
@@ -500,6 +672,7 @@ func (regNodes *RegisteredNodes) UpdateNodeConfig(nodeHWID string, attrName type
 	newNode := regNodes.Clone(node)
 	newNode.Config[attrName] = *configAttr
 	regNodes.updateNode(newNode)
+	return nil
 }
 
 // UpdateNodes updates a list of nodes.
@@ -529,6 +702,9 @@ func (regNodes *RegisteredNodes) UpdateNodes(updates []*types.NodeDiscoveryMessa
 // UpdateNodeStatus updates one or more node's status attributes.
 // Nodes are immutable. If one or more status values have changed then a new node is created and
 // published. The old node instance is discarded.
+// If a status interval is set, then publication is delayed until the interval since the last
+// publication of the node has passed.
+// The changed status attributes are passed to the handler set with SetStatusChangeHandler.
 //  statusAttr is the map with key-value pairs of updated node statusses
 func (regNodes *RegisteredNodes) UpdateNodeStatus(nodeHWID string, statusAttr map[types.NodeStatus]string) (changed bool) {
 
@@ -538,7 +714,6 @@ func (regNodes *RegisteredNodes) UpdateNodeStatus(nodeHWID string, statusAttr ma
 	}
 
 	regNodes.updateMutex.Lock()
-	defer regNodes.updateMutex.Unlock()
 
 	newNode := regNodes.Clone(node)
 	changed = false
@@ -550,11 +725,57 @@ func (regNodes *RegisteredNodes) UpdateNodeStatus(nodeHWID string, statusAttr ma
 	}
 
 	if changed {
-		regNodes.updateNode(newNode)
+		regNodes.updateNodeStatus(newNode)
+	}
+	onStatusChange := regNodes.onStatusChange
+	regNodes.updateMutex.Unlock()
+
+	if changed && onStatusChange != nil {
+		onStatusChange(nodeHWID, types.DiffStatus(node.Status, newNode.Status))
 	}
 	return changed
 }
 
+// parseNodeConfig resolves a node configuration value and passes it to the parse function.
+// The parse function is not invoked if no value or default is set.
+//  typeName describes the expected type for use in the error message
+// An error is returned when the node or configuration doesn't exist or parsing fails. Parse errors
+// of secret values don't include the parse error as it can contain the value.
+func (regNodes *RegisteredNodes) parseNodeConfig(nodeHWID string, attrName types.NodeAttr,
+	typeName string, parse func(valueStr string) error) error {
+
+	valueStr, isSecret, err := regNodes.GetNodeConfigValue(nodeHWID, attrName)
+	if err != nil || valueStr == "" {
+		return err
+	}
+	err = parse(valueStr)
+	if err != nil {
+		msg := fmt.Sprintf("NodeList.GetNodeConfig: Node '%s' configuration '%s' is not %s",
+			nodeHWID, attrName, typeName)
+		if !isSecret {
+			msg += ": " + err.Error()
+		}
+		return errors.New(msg)
+	}
+	return nil
+}
+
+// updateNodeStatus replaces a node whose status has changed.
+// If the status interval since the node's last publication hasn't passed then the node is held back
+// for publication by GetUpdatedNodes. Use within a locked section.
+func (regNodes *RegisteredNodes) updateNodeStatus(node *types.NodeDiscoveryMessage) {
+	_, isUpdated := regNodes.updatedNodes[node.Address]
+	lastPublished := regNodes.statusPublished[node.HWID]
+	if regNodes.statusInterval == 0 || isUpdated || regNodes.clock.Now().Sub(lastPublished) >= regNodes.statusInterval {
+		regNodes.updateNode(node)
+		return
+	}
+	regNodes.nodeMap[node.NodeID] = node
+	regNodes.deviceMap[node.HWID] = node
+	node.Timestamp = regNodes.clock.Now().Format(types.TimeFormat)
+	regNodes.statusPending[node.Address] = node
+}
+
 // updateNode replaces a node and adds it to the list of updated nodes.
 //  Use within a locked section.
 func (regNodes *RegisteredNodes) updateNode(node *types.NodeDiscoveryMessage) {
@@ -566,8 +787,11 @@ func (regNodes *RegisteredNodes) updateNode(node *types.NodeDiscoveryMessage) {
 	if regNodes.updatedNodes == nil {
 		regNodes.updatedNodes = make(map[string]*types.NodeDiscoveryMessage)
 	}
-	node.Timestamp = time.Now().Format(types.TimeFormat)
+	node.Timestamp = regNodes.clock.Now().Format(types.TimeFormat)
 	regNodes.updatedNodes[node.Address] = node
+	delete(regNodes.statusPending, node.Address)
+	// a node that is recreated before its deletion is published replaces the deletion
+	delete(regNodes.deletedNodes, node.Address)
 }
 
 // MakeNodeAddress generates the publication address of a node: domain/publisherID/nodeID[/messageType].
@@ -575,11 +799,9 @@ func (regNodes *RegisteredNodes) updateNode(node *types.NodeDiscoveryMessage) {
 // As per standard, the domain of the domain the node lives in; publisherID of the publisher for this node,
 // unique for the domain; nodeID of the node itself, unique for the publisher; messageType is optional,
 // use "" if it doesn't apply.
-func MakeNodeAddress(domain string, publisherID string, nodeID string, messageType string) string {
-	address := fmt.Sprintf("%s/%s/%s", domain, publisherID, nodeID)
-	if messageType != "" {
-		address = address + "/" + messageType
-	}
+func MakeNodeAddress(domain string, publisherID string, nodeID string, messageType types.MessageType) string {
+	address := types.MakeAddress(&types.AddressSegments{
+		Domain: domain, PublisherID: publisherID, NodeID: nodeID, MessageType: messageType})
 	return address
 }
 
@@ -610,8 +832,90 @@ func NewNodeConfig(dataType types.DataType, description string, defaultValue str
 	return &config
 }
 
+// NewNodeConfigNumeric creates a new numeric node configuration instance with range, step and unit.
+// Use UpdateNodeConfig to update the node with this configuration
+//
+// dataType of the value, eg types.DataTypeInt or types.DataTypeNumber
+// min and max define the range of valid values
+// step is the step size hint for user interfaces
+// unit of the value, eg types.UnitSecond
+func NewNodeConfigNumeric(dataType types.DataType, description string, defaultValue string,
+	min float64, max float64, step float64, unit types.Unit) *types.ConfigAttr {
+	config := NewNodeConfig(dataType, description, defaultValue)
+	config.Min = min
+	config.Max = max
+	config.Step = step
+	config.Unit = unit
+	return config
+}
+
+// ValidateConfigValue validates a configuration value against the configuration constraints.
+// Values must be of the configuration data type, one of its enum values if set, and within its
+// range if set. Values of string attributes must match the configuration pattern, if set.
+// An empty value is always accepted. Errors don't include secret values.
+func ValidateConfigValue(config *types.ConfigAttr, value string) error {
+	if value == "" {
+		return nil
+	}
+	if err := validateConfigType(config, value); err != nil {
+		return err
+	}
+	if config.Pattern == "" || (config.DataType != "" && config.DataType != types.DataTypeString) {
+		return nil
+	}
+	matched, err := regexp.MatchString(config.Pattern, value)
+	if err != nil {
+		return fmt.Errorf("invalid pattern '%s': %s", config.Pattern, err)
+	} else if !matched && config.Secret {
+		// don't leak secrets in logging
+		return fmt.Errorf("secret value doesn't match pattern '%s'", config.Pattern)
+	} else if !matched {
+		return fmt.Errorf("value '%s' doesn't match pattern '%s'", value, config.Pattern)
+	}
+	return nil
+}
+
+// validateConfigType validates a value against the data type, enum and range of a configuration.
+// Secret values are not validated against their type to avoid leaking them in errors.
+func validateConfigType(config *types.ConfigAttr, value string) error {
+	if config.Secret || config.DataType == types.DataTypeSecret {
+		return nil
+	}
+	parsed, err := types.ParseValue(config.DataType, value)
+	if err != nil {
+		return fmt.Errorf("value '%s' is not of type '%s'", value, config.DataType)
+	}
+	if len(config.Enum) > 0 {
+		for _, enumValue := range config.Enum {
+			if value == enumValue {
+				return nil
+			}
+		}
+		return fmt.Errorf("value '%s' is not one of %v", value, config.Enum)
+	}
+	var number float64
+	switch typedValue := parsed.(type) {
+	case int:
+		number = float64(typedValue)
+	case float64:
+		number = typedValue
+	default:
+		return nil
+	}
+	if config.Max > config.Min && (number < config.Min || number > config.Max) {
+		return fmt.Errorf("value '%s' is outside the range %v-%v", value, config.Min, config.Max)
+	}
+	return nil
+}
+
 // NewNode returns a new instance of a node.
 func NewNode(domain string, publisherID string, nodeHWID string, nodeType types.NodeType) *types.NodeDiscoveryMessage {
+	return newNode(domain, publisherID, nodeHWID, nodeType, messaging.RealClock)
+}
+
+// newNode returns a new instance of a node with a timestamp from the given clock
+func newNode(domain string, publisherID string, nodeHWID string, nodeType types.NodeType,
+	clock messaging.Clock) *types.NodeDiscoveryMessage {
 
 	if domain == "" || publisherID == "" || nodeHWID == "" || nodeType == "" {
 		logrus.Errorf("NewNode: empty argument, one of domain (%s), publisherID (%s), hwID (%s) or nodeType (%s) ",
@@ -627,7 +931,7 @@ func NewNode(domain string, publisherID string, nodeHWID string, nodeType types.
 		NodeID:      nodeHWID,
 		PublisherID: publisherID,
 		Status:      make(map[types.NodeStatus]string),
-		Timestamp:   time.Now().Format(types.TimeFormat),
+		Timestamp:   clock.Now().Format(types.TimeFormat),
 	}
 	newNode.Attr[types.NodeAttrType] = string(nodeType)
 	newNode.Config[types.NodeAttrName] = *NewNodeConfig(types.DataTypeString, "Human friendly node name", "")
@@ -642,12 +946,17 @@ func NewNode(domain string, publisherID string, nodeHWID string, nodeType types.
 // onSetNodeID is the handler for changes in nodeID configuration. Use this to update input and output addresses
 func NewRegisteredNodes(domain string, publisherID string) *RegisteredNodes {
 	nodes := RegisteredNodes{
+		clock:        messaging.RealClock,
+		deletedNodes: make(map[string]bool),
 		domain:       domain,
 		publisherID:  publisherID,
 		deviceMap:    make(map[string]*types.NodeDiscoveryMessage),
 		nodeMap:      make(map[string]*types.NodeDiscoveryMessage),
 		updatedNodes: make(map[string]*types.NodeDiscoveryMessage),
 		updateMutex:  &sync.Mutex{},
+
+		statusPending:   make(map[string]*types.NodeDiscoveryMessage),
+		statusPublished: make(map[string]time.Time),
 	}
 	return &nodes
 }
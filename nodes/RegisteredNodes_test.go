@@ -2,8 +2,10 @@ package nodes_test
 
 import (
 	"crypto/ecdsa"
+	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/iotdomain/iotdomain-go/messaging"
 	"github.com/iotdomain/iotdomain-go/nodes"
@@ -80,6 +82,31 @@ func TestNewNode(t *testing.T) {
 
 }
 
+func TestGetOrCreateNode(t *testing.T) {
+	collection := nodes.NewRegisteredNodes(domain, publisher1ID)
+	node, created := collection.GetOrCreateNode(node1ID, types.NodeTypeUnknown)
+	require.NotNil(t, node)
+	assert.True(t, created)
+	collection.UpdateNodeAttr(node1ID, map[types.NodeAttr]string{types.NodeAttrName: "name1"})
+	collection.UpdateNodeStatus(node1ID, map[types.NodeStatus]string{types.NodeStatusRunState: types.NodeRunStateReady})
+
+	// existing attributes and status are preserved
+	node, created = collection.GetOrCreateNode(node1ID, types.NodeTypeUnknown)
+	require.NotNil(t, node)
+	assert.False(t, created)
+	assert.Equal(t, "name1", node.Attr[types.NodeAttrName])
+
+	// the type is updated
+	node, created = collection.GetOrCreateNode(node1ID, types.NodeTypeSensor)
+	assert.False(t, created)
+	assert.Equal(t, string(types.NodeTypeSensor), node.Attr[types.NodeAttrType])
+	assert.Equal(t, "name1", node.Attr[types.NodeAttrName])
+	assert.Equal(t, types.NodeRunStateReady, node.Status[types.NodeStatusRunState])
+	node = collection.CreateNode(node1ID, types.NodeTypeSensor)
+	assert.Equal(t, "name1", node.Attr[types.NodeAttrName])
+	assert.Equal(t, 1, len(collection.GetAllNodes()))
+}
+
 // Test updating of node atributes and status
 func TestAttrStatus(t *testing.T) {
 	const node1ID = "node1"
@@ -109,6 +136,78 @@ func TestAttrStatus(t *testing.T) {
 
 }
 
+// TestStatusInterval tests that rapid status updates are coalesced into a single publication
+func TestStatusInterval(t *testing.T) {
+	const node1ID = "node1"
+	const statusInterval = time.Minute
+	clock := messaging.NewManualClock(time.Now())
+	collection := nodes.NewRegisteredNodes(domain, publisher1ID)
+	collection.SetClock(clock)
+	collection.SetStatusInterval(statusInterval)
+	collection.CreateNode(node1ID, types.NodeTypeUnknown)
+	updates := collection.GetUpdatedNodes(true)
+	assert.Equal(t, 1, len(updates))
+
+	// status changes within the interval are held back
+	for i := 0; i < 10; i++ {
+		changed := collection.UpdateNodeStatus(node1ID, map[types.NodeStatus]string{
+			types.NodeStatusLatencyMSec: fmt.Sprint(i)})
+		assert.True(t, changed)
+	}
+	updates = collection.GetUpdatedNodes(true)
+	assert.Equal(t, 0, len(updates))
+	status := collection.GetNodeByHWID(node1ID).Status[types.NodeStatusLatencyMSec]
+	assert.Equal(t, "9", status, "Status not updated")
+
+	// after the interval the last status is published once
+	clock.Advance(statusInterval)
+	updates = collection.GetUpdatedNodes(true)
+	require.Equal(t, 1, len(updates))
+	assert.Equal(t, "9", updates[0].Status[types.NodeStatusLatencyMSec])
+	updates = collection.GetUpdatedNodes(true)
+	assert.Equal(t, 0, len(updates))
+
+	// attribute changes are published immediately
+	collection.UpdateNodeStatus(node1ID, map[types.NodeStatus]string{types.NodeStatusLatencyMSec: "10"})
+	collection.UpdateNodeAttr(node1ID, map[types.NodeAttr]string{types.NodeAttrManufacturer: "Bob"})
+	updates = collection.GetUpdatedNodes(true)
+	require.Equal(t, 1, len(updates))
+	assert.Equal(t, "10", updates[0].Status[types.NodeStatusLatencyMSec])
+}
+
+func TestStatusChangeHandler(t *testing.T) {
+	var rxDiff *types.NodeStatusDiff
+	collection := nodes.NewRegisteredNodes(domain, publisher1ID)
+	collection.SetStatusChangeHandler(func(nodeHWID string, diff types.NodeStatusDiff) {
+		assert.Equal(t, node1ID, nodeHWID)
+		rxDiff = &diff
+	})
+	collection.CreateNode(node1ID, types.NodeTypeUnknown)
+	collection.UpdateNodeStatus(node1ID, map[types.NodeStatus]string{types.NodeStatusHealth: "90"})
+	require.NotNil(t, rxDiff)
+	assert.Equal(t, "90", rxDiff.Added[types.NodeStatusHealth])
+
+	changed := collection.UpdateNodeStatus(node1ID, map[types.NodeStatus]string{types.NodeStatusHealth: "45"})
+	assert.True(t, changed)
+	assert.Equal(t, types.NodeStatusChange{Old: "90", New: "45"}, rxDiff.Modified[types.NodeStatusHealth])
+	assert.Empty(t, rxDiff.Added)
+
+	// no change, no notification
+	rxDiff = nil
+	changed = collection.UpdateNodeStatus(node1ID, map[types.NodeStatus]string{types.NodeStatusHealth: "45"})
+	assert.False(t, changed)
+	assert.Nil(t, rxDiff)
+
+	collection.UpdateErrorStatus(node1ID, types.NodeRunStateError, "failed")
+	require.NotNil(t, rxDiff)
+	assert.Equal(t, "failed", rxDiff.Added[types.NodeStatusLastError])
+
+	collection.SetStatusChangeHandler(nil)
+	rxDiff = nil
+	collection.UpdateNodeStatus(node1ID, map[types.NodeStatus]string{types.NodeStatusHealth: "50"})
+	assert.Nil(t, rxDiff)
+}
+
 // TestConfigure tests if the node configuration is handled
 func TestConfigure(t *testing.T) {
 	collection := nodes.NewRegisteredNodes(domain, publisher1ID)
@@ -156,10 +255,10 @@ func TestConfigure(t *testing.T) {
 	floatVal, err := collection.GetNodeConfigFloat(node1ID, types.NodeAttrMin, 1.1)
 	assert.NoError(t, err)
 	assert.Equal(t, float32(1.1), floatVal, "UpdateNodeConfig should use provided default")
-	// not a number
-	collection.UpdateNodeConfigValues(node1ID, types.NodeAttrMap{types.NodeAttrMin: "abc"})
+	// not a number is rejected
+	assert.False(t, collection.UpdateNodeConfigValues(node1ID, types.NodeAttrMap{types.NodeAttrMin: "abc"}))
 	floatVal, err = collection.GetNodeConfigFloat(node1ID, types.NodeAttrMin, 0)
-	assert.Error(t, err)
+	assert.NoError(t, err)
 	assert.Equal(t, float32(0), floatVal, "use provided default")
 
 	// test int
@@ -184,9 +283,13 @@ func TestConfigure(t *testing.T) {
 	changed = collection.UpdateNodeConfigValues(node1ID, types.NodeAttrMap{"": "2"})
 	assert.False(t, changed)
 
-	// config values
+	// config values must match the data type
 	newValues := map[types.NodeAttr]string{types.NodeAttrName: "NewName"}
-	collection.UpdateNodeConfigValues(node1ID, newValues)
+	changed = collection.UpdateNodeConfigValues(node1ID, newValues)
+	assert.False(t, changed)
+	collection.CreateNodeConfig(node1ID, types.NodeAttrName, types.DataTypeString, "", "")
+	changed = collection.UpdateNodeConfigValues(node1ID, newValues)
+	assert.True(t, changed)
 
 	// node1 must match the newly added node
 	node = collection.GetNodeByAddress(node1Addr)
@@ -200,6 +303,103 @@ func TestConfigure(t *testing.T) {
 	assert.Equal(t, "NewName", value2, "Configuration wasn't applied")
 }
 
+func TestGetNodeConfigValue(t *testing.T) {
+	collection := nodes.NewRegisteredNodes(domain, publisher1ID)
+	collection.CreateNode(node1ID, types.NodeTypeUnknown)
+	collection.CreateNodeConfig(node1ID, types.NodeAttrName, types.DataTypeString, "name", "default")
+	collection.CreateNodeConfig(node1ID, types.NodeAttrPassword, types.DataTypeSecret, "password", "")
+
+	// the default is used when no value is set
+	value, isSecret, err := collection.GetNodeConfigValue(node1ID, types.NodeAttrName)
+	assert.NoError(t, err)
+	assert.Equal(t, "default", value)
+	assert.False(t, isSecret)
+	collection.UpdateNodeConfigValues(node1ID, types.NodeAttrMap{types.NodeAttrName: "bob"})
+	value, _, _ = collection.GetNodeConfigValue(node1ID, types.NodeAttrName)
+	assert.Equal(t, "bob", value)
+
+	// secrets are flagged and not included in errors
+	collection.UpdateNodeConfigValues(node1ID, types.NodeAttrMap{types.NodeAttrPassword: "secret1"})
+	value, isSecret, err = collection.GetNodeConfigValue(node1ID, types.NodeAttrPassword)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret1", value)
+	assert.True(t, isSecret)
+	_, err = collection.GetNodeConfigInt(node1ID, types.NodeAttrPassword, 0)
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret1")
+	_, err = collection.GetNodeConfigInt(node1ID, types.NodeAttrName, 0)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bob")
+
+	// errors
+	_, _, err = collection.GetNodeConfigValue(node1ID, types.NodeAttrMax)
+	assert.Error(t, err)
+	_, _, err = collection.GetNodeConfigValue("notanode", types.NodeAttrName)
+	assert.Error(t, err)
+}
+
+// TestConfigPattern tests validation of string configuration against a pattern
+func TestConfigPattern(t *testing.T) {
+	collection := nodes.NewRegisteredNodes(domain, publisher1ID)
+	collection.CreateNode(node1ID, types.NodeTypeUnknown)
+
+	config := nodes.NewNodeConfig(types.DataTypeString, "Hostname", "")
+	config.Pattern = "^[a-z0-9.-]+$"
+	err := collection.UpdateNodeConfig(node1ID, types.NodeAttrHostname, config)
+	require.NoError(t, err)
+
+	changed := collection.UpdateNodeConfigValues(node1ID, types.NodeAttrMap{types.NodeAttrHostname: "Not A Host!"})
+	assert.False(t, changed)
+	changed = collection.UpdateNodeConfigValues(node1ID, types.NodeAttrMap{types.NodeAttrHostname: "host1.local"})
+	assert.True(t, changed)
+	value, _ := collection.GetNodeConfigString(node1ID, types.NodeAttrHostname, "")
+	assert.Equal(t, "host1.local", value)
+
+	// invalid patterns are rejected early
+	badConfig := nodes.NewNodeConfig(types.DataTypeString, "URL", "")
+	badConfig.Pattern = "[a-z"
+	err = collection.UpdateNodeConfig(node1ID, types.NodeAttrURL, badConfig)
+	assert.Error(t, err)
+	node := collection.GetNodeByHWID(node1ID)
+	_, found := node.Config[types.NodeAttrURL]
+	assert.False(t, found)
+
+	// patterns only apply to strings
+	err = nodes.ValidateConfigValue(&types.ConfigAttr{DataType: types.DataTypeInt, Pattern: "^a$"}, "5")
+	assert.NoError(t, err)
+
+	// values must match the data type, enum and range, also when configured remotely
+	rangeConfig := &types.ConfigAttr{DataType: types.DataTypeInt, Min: 1, Max: 10}
+	assert.Error(t, nodes.ValidateConfigValue(rangeConfig, "five"))
+	assert.Error(t, nodes.ValidateConfigValue(rangeConfig, "11"))
+	assert.NoError(t, nodes.ValidateConfigValue(rangeConfig, "10"))
+	enumConfig := &types.ConfigAttr{DataType: types.DataTypeEnum, Enum: []string{"low", "high"}}
+	assert.Error(t, nodes.ValidateConfigValue(enumConfig, "medium"))
+	assert.NoError(t, nodes.ValidateConfigValue(enumConfig, "low"))
+	secretConfig := &types.ConfigAttr{DataType: types.DataTypeInt, Secret: true}
+	assert.NoError(t, nodes.ValidateConfigValue(secretConfig, "not a number"), "secrets are not type checked")
+}
+
+// TestConfigNumeric tests numeric configuration with unit and step
+func TestConfigNumeric(t *testing.T) {
+	collection := nodes.NewRegisteredNodes(domain, publisher1ID)
+	collection.CreateNode(node1ID, types.NodeTypeUnknown)
+
+	config := nodes.NewNodeConfigNumeric(types.DataTypeInt, "Poll interval", "600", 1, 3600, 1, types.UnitSecond)
+	err := collection.UpdateNodeConfig(node1ID, types.NodeAttrPollInterval, config)
+	require.NoError(t, err)
+	node := collection.GetNodeByHWID(node1ID)
+	pollConfig := node.Config[types.NodeAttrPollInterval]
+	assert.Equal(t, float64(1), pollConfig.Step)
+	assert.Equal(t, types.UnitSecond, pollConfig.Unit)
+	assert.Equal(t, float64(3600), pollConfig.Max)
+
+	// unit and step are omitted when not set
+	jsonConfig, _ := json.Marshal(nodes.NewNodeConfig(types.DataTypeString, "Name", ""))
+	assert.NotContains(t, string(jsonConfig), "step")
+	assert.NotContains(t, string(jsonConfig), "unit")
+}
+
 func TestReceiveConfig(t *testing.T) {
 	const node1ID = "node1"
 	const publisher1ID = "publisher1"
@@ -212,10 +412,20 @@ func TestReceiveConfig(t *testing.T) {
 	getPublisherKey := func(addr string) *ecdsa.PublicKey {
 		return &privKey.PublicKey
 	}
-	handler := func(hwID string, params types.NodeAttrMap) {
+	handler := func(hwID string, params types.NodeAttrMap) types.NodeAttrMap {
 		logrus.Infof("TestReceiveConfig: receive config for node %s", hwID)
-		collection.UpdateNodeConfigValues(hwID, params)
 		rxCount++
+		// undeclared attributes must have been rejected
+		_, hasUndeclared := params[types.NodeAttrColor]
+		assert.False(t, hasUndeclared, "Undeclared configuration passed to the handler")
+		// reject the publish event configuration
+		accepted := types.NodeAttrMap{}
+		for attrName, value := range params {
+			if attrName != types.NodeAttrPublishEvent {
+				accepted[attrName] = value
+			}
+		}
+		return accepted
 	}
 
 	msgr := messaging.NewDummyMessenger(nil)
@@ -226,7 +436,9 @@ func TestReceiveConfig(t *testing.T) {
 	receiver.Start()
 	// publish
 	nodes.PublishNodeConfigure(node1.Address, types.NodeAttrMap{
-		types.NodeAttrName: "bob",
+		types.NodeAttrName:         "bob",
+		types.NodeAttrPublishEvent: "true",
+		types.NodeAttrColor:        "red",
 	}, "senderaddress", signer, &privKey.PublicKey)
 
 	// error conditions
@@ -243,6 +455,9 @@ func TestReceiveConfig(t *testing.T) {
 	receiver.Stop()
 	name := collection.GetNodeAttr(node1ID, types.NodeAttrName)
 	assert.Equal(t, "bob", name)
+	assert.Equal(t, 1, rxCount)
+	assert.Empty(t, collection.GetNodeAttr(node1ID, types.NodeAttrPublishEvent), "Rejected configuration was applied")
+	assert.Empty(t, collection.GetNodeAttr(node1ID, types.NodeAttrColor), "Undeclared configuration was applied")
 }
 
 func TestLoadSave(t *testing.T) {
@@ -273,9 +488,22 @@ func TestChangeNodeID(t *testing.T) {
 
 	node2 := collection.GetNodeByNodeID(newNodeID)
 	assert.NotNil(t, node2, "Node not found using newNodeID")
+	alias, hasAlias := collection.GetNodeAlias(node1ID)
+	assert.True(t, hasAlias)
+	assert.Equal(t, newNodeID, alias)
+	outputSegments := &types.AddressSegments{Domain: domain, PublisherID: publisher1ID, NodeID: node1ID,
+		OutputType: string(types.OutputTypeSwitch), Instance: types.DefaultOutputInstance,
+		MessageType: types.MessageTypeOutputDiscovery}
+	outputAddr := types.MakeAddress(outputSegments)
+	aliasAddr := collection.ResolveAliasAddress(outputAddr)
+	outputSegments.NodeID = newNodeID
+	assert.Equal(t, types.MakeAddress(outputSegments), aliasAddr)
 	collection.SetNodeID(node2, "") // clear changed node ID
 	node2 = collection.GetNodeByNodeID(newNodeID)
 	// assert.Nil(t, node2, "Node found using alias")
+	_, hasAlias = collection.GetNodeAlias(node1ID)
+	assert.False(t, hasAlias)
+	assert.Equal(t, outputAddr, collection.ResolveAliasAddress(outputAddr))
 
 	// error cases
 	collection.SetNodeID(nil, newNodeID) // invalid nodeID
@@ -315,6 +543,39 @@ func TestError(t *testing.T) {
 	collection.UpdateNodeStatus("unknownNode", map[types.NodeStatus]string{types.NodeStatusLastError: "This is an error"})
 }
 
+func TestErrorCode(t *testing.T) {
+	collection := nodes.NewRegisteredNodes(domain, publisher1ID)
+	collection.CreateNode(node1ID, types.NodeTypeUnknown)
+	changed := collection.UpdateErrorStatusWithCode(node1ID, types.NodeRunStateError,
+		types.NodeErrorCodeTimeout, "Device didn't respond")
+	assert.True(t, changed)
+	node := collection.GetNodeByHWID(node1ID)
+	assert.Equal(t, string(types.NodeErrorCodeTimeout), node.Status[types.NodeStatusLastErrorCode])
+	assert.Equal(t, "Device didn't respond", node.Status[types.NodeStatusLastError])
+
+	// only the code changes
+	changed = collection.UpdateErrorStatusWithCode(node1ID, types.NodeRunStateError,
+		"myCustomCode", "Device didn't respond")
+	assert.True(t, changed)
+	changed = collection.UpdateErrorStatusWithCode(node1ID, types.NodeRunStateError,
+		"myCustomCode", "Device didn't respond")
+	assert.False(t, changed)
+
+	// the free text error leaves the code as is
+	changed = collection.UpdateErrorStatus(node1ID, types.NodeRunStateReady, "")
+	assert.True(t, changed)
+	node = collection.GetNodeByHWID(node1ID)
+	assert.Equal(t, "myCustomCode", node.Status[types.NodeStatusLastErrorCode])
+
+	// an empty code clears it
+	changed = collection.UpdateErrorStatusWithCode(node1ID, types.NodeRunStateReady, "", "")
+	assert.True(t, changed)
+	node = collection.GetNodeByHWID(node1ID)
+	_, hasCode := node.Status[types.NodeStatusLastErrorCode]
+	assert.False(t, hasCode)
+	assert.False(t, collection.UpdateErrorStatusWithCode("notanode", types.NodeRunStateError, types.NodeErrorCodeAuth, ""))
+}
+
 func TestPublishReceive(t *testing.T) {
 
 	var privKey = messaging.CreateAsymKeys()
@@ -335,3 +596,41 @@ func TestPublishReceive(t *testing.T) {
 	nodes.PublishRegisteredNodes(allNodes, signer)
 
 }
+
+func TestAuthorizeSender(t *testing.T) {
+	const domain = "test"
+	const publisherID = "pub1"
+	const node1ID = "node1"
+	regNodes := nodes.NewRegisteredNodes(domain, publisherID)
+	regNodes.CreateNode(node1ID, types.NodeTypeAdapter)
+
+	// without ACL any sender is authorized
+	err := regNodes.AuthorizeSender(node1ID, "test/controller1/$identity")
+	assert.NoError(t, err)
+	assert.Empty(t, regNodes.GetAuthorizedSenders(node1ID))
+
+	changed := regNodes.SetAuthorizedSenders(node1ID, []string{"controller1", "other/controller2"})
+	assert.True(t, changed)
+	assert.Equal(t, []string{"controller1", "other/controller2"}, regNodes.GetAuthorizedSenders(node1ID))
+	assert.NoError(t, regNodes.AuthorizeSender(node1ID, "test/controller1/$identity"))
+	assert.NoError(t, regNodes.AuthorizeSender(node1ID, "other/controller2/$identity"))
+
+	// publisher IDs without domain only authorize senders of the node's domain
+	err = regNodes.AuthorizeSender(node1ID, "other/controller1/$identity")
+	assert.Equal(t, nodes.ErrUnauthorizedSender, err)
+	err = regNodes.AuthorizeSender(node1ID, "test/controller3/$identity")
+	assert.Equal(t, nodes.ErrUnauthorizedSender, err)
+	err = regNodes.AuthorizeSender(node1ID, "")
+	assert.Equal(t, nodes.ErrUnauthorizedSender, err)
+
+	// rejections are counted
+	node := regNodes.GetNodeByHWID(node1ID)
+	assert.Equal(t, "3", node.Status[types.NodeStatusErrorCount])
+
+	err = regNodes.AuthorizeSender("unknownNode", "test/controller3/$identity")
+	assert.NoError(t, err)
+
+	// remove the ACL
+	regNodes.SetAuthorizedSenders(node1ID, nil)
+	assert.NoError(t, regNodes.AuthorizeSender(node1ID, "test/controller3/$identity"))
+}
@@ -0,0 +1,89 @@
+// Package outputs with binary output values of the bytes data type
+package outputs
+
+import (
+	"encoding/base64"
+
+	"github.com/iotdomain/iotdomain-go/lib"
+)
+
+// MaxBytesValueSize is the max size in bytes of a binary output value that is published as a
+// signed output value. Values are transported base64 encoded, which adds a third to their size.
+// Use PublishRaw for larger payloads, like full size images.
+const MaxBytesValueSize = 16 * 1024
+
+// DecodeBytesValue decodes the value of an output with the bytes data type
+// Values are encoded with standard base64 encoding including padding, see EncodeBytesValue.
+func DecodeBytesValue(value string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, lib.MakeErrorf("DecodeBytesValue: Value is not base64 encoded: %s", err)
+	}
+	return data, nil
+}
+
+// EncodeBytesValue encodes a binary value of an output with the bytes data type for transport
+// in output values, using standard base64 encoding including padding.
+// Returns an error if the value is larger than MaxBytesValueSize.
+func EncodeBytesValue(data []byte) (string, error) {
+	if len(data) > MaxBytesValueSize {
+		return "", lib.MakeErrorf("EncodeBytesValue: Value of %d bytes exceeds the max of %d. Use PublishRaw instead.",
+			len(data), MaxBytesValueSize)
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// GetLatestBytes returns the decoded binary value of an output with the bytes data type
+// Returns an error if the output has no value or the value isn't base64 encoded
+func (dov *DomainOutputValues) GetLatestBytes(latestAddress string) ([]byte, error) {
+	latest, found := dov.GetLatest(latestAddress)
+	if !found {
+		return nil, lib.MakeErrorf("GetLatestBytes: No value for output '%s'", latestAddress)
+	}
+	return DecodeBytesValue(latest.Value)
+}
+
+// GetOutputBytesByID returns the decoded latest binary value of an output with the bytes data type
+// Returns an error if the output has no value or the value isn't base64 encoded
+func (outputValues *RegisteredOutputValues) GetOutputBytesByID(outputID string) ([]byte, error) {
+	latest := outputValues.GetOutputValueByID(outputID)
+	if latest == nil {
+		return nil, lib.MakeErrorf("GetOutputBytesByID: No value for output '%s'", outputID)
+	}
+	return DecodeBytesValue(latest.Value)
+}
+
+// IsBytesOutput returns true if the output holds binary values, see SetBytesOutput
+func (outputValues *RegisteredOutputValues) IsBytesOutput(outputID string) bool {
+	outputValues.updateMutex.Lock()
+	defer outputValues.updateMutex.Unlock()
+	return outputValues.bytesOutputs[outputID]
+}
+
+// SetBytesOutput marks an output as holding binary values of the bytes data type. The values of
+// these outputs are not transformed, formatted or included in the observed range, and their history
+// only retains the latest value. UpdateOutputBytes marks the output automatically.
+//  isBytes marks or unmarks the output
+func (outputValues *RegisteredOutputValues) SetBytesOutput(outputID string, isBytes bool) {
+	outputValues.updateMutex.Lock()
+	defer outputValues.updateMutex.Unlock()
+	if isBytes {
+		outputValues.bytesOutputs[outputID] = true
+	} else {
+		delete(outputValues.bytesOutputs, outputID)
+	}
+}
+
+// UpdateOutputBytes adds a binary value, base64 encoded, as the output value. See EncodeBytesValue.
+// The output is marked as holding binary values, see SetBytesOutput.
+// Returns true if history is updated, or an error if the value is too large
+func (outputValues *RegisteredOutputValues) UpdateOutputBytes(outputID string, data []byte) (bool, error) {
+	value, err := EncodeBytesValue(data)
+	if err != nil {
+		return false, err
+	}
+	outputValues.updateMutex.Lock()
+	defer outputValues.updateMutex.Unlock()
+	outputValues.bytesOutputs[outputID] = true
+	return outputValues.updateOutputValue(outputID, value), nil
+}
@@ -0,0 +1,65 @@
+package outputs_test
+
+import (
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/outputs"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBytesValue(t *testing.T) {
+	const domain = "test"
+	const publisher1ID = "publisher1"
+	const node1ID = "node1"
+	thumbnail := []byte{0x89, 'P', 'N', 'G', 0, 1, 2, 0xff}
+	collection := outputs.NewRegisteredOutputValues(domain, publisher1ID)
+	outputID := outputs.MakeOutputID(node1ID, types.OutputTypeImage, types.DefaultOutputInstance)
+
+	_, err := collection.GetOutputBytesByID(outputID)
+	assert.Error(t, err)
+
+	// values are stored base64 encoded
+	updated, err := collection.UpdateOutputBytes(outputID, thumbnail)
+	require.NoError(t, err)
+	assert.True(t, updated)
+	assert.Equal(t, "iVBORwABAv8=", collection.GetOutputValueByID(outputID).Value)
+	data, err := collection.GetOutputBytesByID(outputID)
+	require.NoError(t, err)
+	assert.Equal(t, thumbnail, data)
+
+	// large values must be published raw
+	_, err = collection.UpdateOutputBytes(outputID, make([]byte, outputs.MaxBytesValueSize+1))
+	assert.Error(t, err)
+	data, _ = collection.GetOutputBytesByID(outputID)
+	assert.Equal(t, thumbnail, data)
+
+	// only the latest value is kept
+	_, err = collection.UpdateOutputBytes(outputID, []byte{1, 2, 3})
+	require.NoError(t, err)
+	assert.True(t, collection.IsBytesOutput(outputID))
+	assert.Len(t, collection.GetHistory(outputID), 1)
+
+	// transforms, formats and observed ranges don't apply to bytes, even if the base64 looks numeric
+	numeric, err := outputs.DecodeBytesValue("1234")
+	require.NoError(t, err)
+	collection.SetTransform(outputID, outputs.ValueTransform{{Op: outputs.TransformScale, Value: 2}})
+	collection.SetFormat(outputID, &outputs.ValueFormat{Decimals: 2})
+	_, err = collection.UpdateOutputBytes(outputID, numeric)
+	require.NoError(t, err)
+	assert.Equal(t, "1234", collection.GetOutputValueByID(outputID).Value)
+	latest := collection.GetOutputValueByID(outputID)
+	assert.Equal(t, "1234", collection.FormatValue(outputID, latest).Value)
+	_, found := collection.GetObservedRange(outputID)
+	assert.False(t, found)
+
+	// validation
+	output := &types.OutputDiscoveryMessage{Address: "test/publisher1/node1/image/0/$output",
+		DataType: types.DataTypeBytes}
+	encoded, _ := outputs.EncodeBytesValue(thumbnail)
+	assert.NoError(t, outputs.ValidateOutputValue(output, encoded))
+	assert.Error(t, outputs.ValidateOutputValue(output, "not base64!"))
+	_, err = outputs.DecodeBytesValue("not base64!")
+	assert.Error(t, err)
+}
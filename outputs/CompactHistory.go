@@ -0,0 +1,182 @@
+// Package outputs with tiered compaction of output history for long-term retention
+package outputs
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/types"
+)
+
+// CompactionTier downsamples the history values that are older than the tier age into intervals
+type CompactionTier struct {
+	Age      time.Duration // values older than this age are compacted with this tier
+	Interval time.Duration // resolution of the compacted values. Intervals are aligned to multiples of the interval
+	Method   Resample      // method of combining the values of an interval, ResampleLast or ResampleMean
+}
+
+// CompactionPolicy is a list of compaction tiers. Each value is compacted by the tier with the
+// highest age whose interval containing the value is entirely older than the tier age. Values that
+// don't fall in a whole interval of any tier are kept as is.
+type CompactionPolicy []CompactionTier
+
+// DefaultCompactionPolicy keeps 1-second resolution for an hour, 1-minute resolution for a day
+// and 1-hour resolution beyond
+var DefaultCompactionPolicy = CompactionPolicy{
+	{Age: 0, Interval: time.Second, Method: ResampleLast},
+	{Age: time.Hour, Interval: time.Minute, Method: ResampleMean},
+	{Age: 24 * time.Hour, Interval: time.Hour, Method: ResampleMean},
+}
+
+// CompactHistory compacts the history of all outputs that have a compaction policy
+// See SetCompactionPolicy for setting the policy of outputs.
+// Returns the number of history values that have been removed
+func (outputValues *RegisteredOutputValues) CompactHistory() int {
+	var removeCount = 0
+
+	outputValues.updateMutex.Lock()
+	defer outputValues.updateMutex.Unlock()
+
+	now := outputValues.clock.Now()
+	for outputID, history := range outputValues.historyMap {
+		policy, found := outputValues.compactionPolicy[outputID]
+		if !found {
+			policy = outputValues.compactionPolicy[""]
+		}
+		if len(policy) == 0 {
+			continue
+		}
+		compacted := compactHistory(history, now, policy)
+		removeCount += len(history) - len(compacted)
+		outputValues.historyMap[outputID] = compacted
+	}
+	return removeCount
+}
+
+// SetCompactionPolicy sets the policy for compacting the history of an output
+//  outputID is the output to set the policy of, or "" to set the default for outputs without their own policy
+//  policy is the list of compaction tiers. Use nil to not compact the history.
+func (outputValues *RegisteredOutputValues) SetCompactionPolicy(outputID string, policy CompactionPolicy) {
+	outputValues.updateMutex.Lock()
+	defer outputValues.updateMutex.Unlock()
+	if policy == nil {
+		delete(outputValues.compactionPolicy, outputID)
+	} else {
+		outputValues.compactionPolicy[outputID] = policy
+	}
+}
+
+// StartCompaction starts compacting the history of outputs in the background
+//  interval is the time between compaction runs
+func (outputValues *RegisteredOutputValues) StartCompaction(interval time.Duration) {
+	outputValues.StopCompaction()
+
+	outputValues.updateMutex.Lock()
+	defer outputValues.updateMutex.Unlock()
+	ticker := time.NewTicker(interval)
+	stopChannel := make(chan bool)
+	outputValues.compactionStop = stopChannel
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				outputValues.CompactHistory()
+			case <-stopChannel:
+				return
+			}
+		}
+	}()
+}
+
+// StopCompaction stops compacting the history of outputs in the background
+func (outputValues *RegisteredOutputValues) StopCompaction() {
+	outputValues.updateMutex.Lock()
+	defer outputValues.updateMutex.Unlock()
+	if outputValues.compactionStop != nil {
+		close(outputValues.compactionStop)
+		outputValues.compactionStop = nil
+	}
+}
+
+// compactHistory combines the values of a history that is sorted with the newest value first
+// into the intervals of the compaction tiers. The timestamp of a compacted value is the start
+// of its interval. Values that are not numeric are compacted using the last value.
+// Only whole intervals are compacted, eg intervals that are entirely older than the tier age, so
+// a compacted value is never averaged again with values that arrive later in its interval.
+// Compacting an already compacted history again gives the same result. A mean of compacted values
+// in the next tier weighs each compacted interval equally.
+// Returns the compacted history sorted with the newest value first
+func compactHistory(history OutputHistory, now time.Time, policy CompactionPolicy) OutputHistory {
+	type bucket struct {
+		tier      *CompactionTier
+		start     time.Time
+		count     int
+		sum       float64
+		last      string
+		lastTime  time.Time
+		isNumeric bool
+	}
+	type bucketKey struct {
+		tier  int
+		index int64
+	}
+	compacted := make(OutputHistory, 0, len(history))
+	buckets := make(map[bucketKey]*bucket)
+	order := make([]*bucket, 0)
+	for _, value := range history {
+		timestamp := GetOutputValueTime(&value)
+		// the tier with the highest age whose interval of the value has ended before the tier age
+		tierIndex := -1
+		var index int64
+		for i, tier := range policy {
+			if tier.Interval <= 0 || (tierIndex >= 0 && tier.Age <= policy[tierIndex].Age) {
+				continue
+			}
+			tierBucket := timestamp.UnixNano() / int64(tier.Interval)
+			end := time.Unix(0, (tierBucket+1)*int64(tier.Interval))
+			if !end.After(now.Add(-tier.Age)) {
+				tierIndex = i
+				index = tierBucket
+			}
+		}
+		if tierIndex < 0 || timestamp.IsZero() {
+			compacted = append(compacted, value)
+			continue
+		}
+		tier := &policy[tierIndex]
+		key := bucketKey{tier: tierIndex, index: index}
+		b := buckets[key]
+		if b == nil {
+			b = &bucket{tier: tier, start: time.Unix(0, key.index*int64(tier.Interval)), isNumeric: true}
+			buckets[key] = b
+			order = append(order, b)
+		}
+		if b.count == 0 || timestamp.After(b.lastTime) {
+			b.last = value.Value
+			b.lastTime = timestamp
+		}
+		number, err := strconv.ParseFloat(value.Value, 64)
+		if err != nil {
+			b.isNumeric = false
+		}
+		b.sum += number
+		b.count++
+	}
+	for _, b := range order {
+		entry := types.OutputValue{
+			Timestamp: b.start.Format(types.TimeFormat),
+			EpochTime: b.start.Unix(),
+			Value:     b.last,
+		}
+		if b.tier.Method == ResampleMean && b.isNumeric {
+			entry.Value = strconv.FormatFloat(b.sum/float64(b.count), 'f', -1, 64)
+		}
+		compacted = append(compacted, entry)
+	}
+	sort.SliceStable(compacted, func(i, j int) bool {
+		return GetOutputValueTime(&compacted[i]).After(GetOutputValueTime(&compacted[j]))
+	})
+	return compacted
+}
@@ -0,0 +1,132 @@
+package outputs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/outputs"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactHistory(t *testing.T) {
+	const domain = "test"
+	const publisher1ID = "publisher1"
+	const node1ID = "node1"
+	now := time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)
+	clock := messaging.NewManualClock(now)
+	collection := outputs.NewRegisteredOutputValues(domain, publisher1ID)
+	collection.SetClock(clock)
+	collection.SetHistoryLimits(0, 0)
+	outputID := outputs.MakeOutputID(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance)
+	output2ID := outputs.MakeOutputID(node1ID, types.OutputTypeHumidity, types.DefaultOutputInstance)
+
+	values := []struct {
+		age   time.Duration
+		value string
+	}{
+		// 1 second resolution, last value
+		{10*time.Second - 200*time.Millisecond, "5"},
+		{10*time.Second - 700*time.Millisecond, "6"},
+		// 1 minute resolution, mean
+		{2*time.Hour - 10*time.Second, "10"},
+		{2*time.Hour - 20*time.Second, "20"},
+		{2*time.Hour - 70*time.Second, "30"},
+		// 1 hour resolution, mean
+		{30*time.Hour - time.Minute, "1"},
+		{30*time.Hour - 30*time.Minute, "3"},
+		// not numeric uses the last value
+		{40*time.Hour - time.Minute, "off"},
+		{40*time.Hour - 2*time.Minute, "on"},
+	}
+	for _, v := range values {
+		collection.UpdateOutputValueAt(outputID, v.value, now.Add(-v.age))
+		collection.UpdateOutputValueAt(output2ID, v.value, now.Add(-v.age))
+	}
+	collection.SetCompactionPolicy("", outputs.DefaultCompactionPolicy)
+	// the second output isn't compacted
+	collection.SetCompactionPolicy(output2ID, outputs.CompactionPolicy{})
+
+	removed := collection.CompactHistory()
+	assert.Equal(t, 4, removed)
+	history := collection.GetHistory(outputID)
+	require.Equal(t, 5, len(history))
+	expected := []struct {
+		age   time.Duration
+		value string
+	}{
+		{10 * time.Second, "6"},
+		{time.Hour + 59*time.Minute, "30"},
+		{2 * time.Hour, "15"},
+		{30 * time.Hour, "2"},
+		{40 * time.Hour, "on"},
+	}
+	for i, e := range expected {
+		assert.True(t, now.Add(-e.age).Equal(outputs.GetOutputValueTime(&history[i])), "entry %d", i)
+		assert.Equal(t, e.value, history[i].Value, "entry %d", i)
+	}
+	assert.Equal(t, len(values), len(collection.GetHistory(output2ID)))
+
+	// compaction is repeatable
+	removed = collection.CompactHistory()
+	assert.Equal(t, 0, removed)
+
+	// aged values move to the next tier
+	clock.Advance(23 * time.Hour)
+	removed = collection.CompactHistory()
+	assert.Equal(t, 1, removed)
+	history = collection.GetHistory(outputID)
+	assert.Equal(t, "22.5", history[1].Value)
+}
+
+// TestCompactWholeIntervals tests that an interval is only compacted when it is entirely older
+// than the tier age, so values that age later are not averaged with an already compacted value
+func TestCompactWholeIntervals(t *testing.T) {
+	now := time.Date(2020, 1, 2, 12, 0, 30, 0, time.UTC)
+	clock := messaging.NewManualClock(now)
+	collection := outputs.NewRegisteredOutputValues("test", "publisher1")
+	collection.SetClock(clock)
+	collection.SetHistoryLimits(0, 0)
+	outputID := outputs.MakeOutputID("node1", types.OutputTypeTemperature, types.DefaultOutputInstance)
+	collection.SetCompactionPolicy("", outputs.CompactionPolicy{
+		{Age: time.Hour, Interval: time.Minute, Method: outputs.ResampleMean},
+	})
+	// the interval of 11:00 straddles the tier age of 11:00:30
+	collection.UpdateOutputValueAt(outputID, "10", now.Add(-time.Hour-20*time.Second))
+	collection.UpdateOutputValueAt(outputID, "20", now.Add(-time.Hour-10*time.Second))
+	collection.UpdateOutputValueAt(outputID, "60", now.Add(-time.Hour+20*time.Second))
+
+	removed := collection.CompactHistory()
+	assert.Equal(t, 0, removed)
+
+	// once the interval has aged it is compacted as a whole
+	clock.Advance(time.Minute)
+	removed = collection.CompactHistory()
+	assert.Equal(t, 2, removed)
+	history := collection.GetHistory(outputID)
+	require.Equal(t, 1, len(history))
+	assert.Equal(t, "30", history[0].Value)
+	assert.True(t, now.Add(-time.Hour-30*time.Second).Equal(outputs.GetOutputValueTime(&history[0])))
+
+	// compaction is repeatable
+	removed = collection.CompactHistory()
+	assert.Equal(t, 0, removed)
+	assert.Equal(t, "30", collection.GetHistory(outputID)[0].Value)
+}
+
+func TestBackgroundCompaction(t *testing.T) {
+	collection := outputs.NewRegisteredOutputValues("test", "publisher1")
+	outputID := outputs.MakeOutputID("node1", types.OutputTypeTemperature, types.DefaultOutputInstance)
+	now := time.Now().Truncate(time.Second)
+	collection.UpdateOutputValueAt(outputID, "1", now.Add(-2*time.Hour))
+	collection.UpdateOutputValueAt(outputID, "2", now.Add(-2*time.Hour+time.Millisecond))
+	collection.SetCompactionPolicy("", outputs.DefaultCompactionPolicy)
+
+	collection.StartCompaction(10 * time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	collection.StopCompaction()
+	collection.StopCompaction()
+	assert.Equal(t, 1, len(collection.GetHistory(outputID)))
+}
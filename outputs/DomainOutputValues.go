@@ -2,21 +2,159 @@
 package outputs
 
 import (
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
 	"sync"
+	"time"
 
+	"github.com/iotdomain/iotdomain-go/lib"
 	"github.com/iotdomain/iotdomain-go/messaging"
 	"github.com/iotdomain/iotdomain-go/types"
 )
 
+// HistoryStats with statistics of numeric output history values
+type HistoryStats struct {
+	Count           int       // number of numeric values
+	Min             float64   // lowest value
+	MinTime         time.Time // time of the lowest value
+	Max             float64   // highest value
+	MaxTime         time.Time // time of the highest value
+	Mean            float64   // average of the values
+	Last            float64   // most recent value
+	NonNumericCount int       // number of values that are not numeric and are skipped
+}
+
+// DomainOutputValuesSnapshot with a copy of all domain output values
+// Intended for persisting the values and restoring them after a restart
+type DomainOutputValuesSnapshot struct {
+	Event   map[string]types.OutputEventMessage   `json:"event"`
+	History map[string]types.OutputHistoryMessage `json:"history"`
+	Latest  map[string]types.OutputLatestMessage  `json:"latest"`
+	Raw     map[string]string                     `json:"raw"`
+}
+
 // DomainOutputValues for managing values of discovered outputs
 type DomainOutputValues struct {
 	// c             lib.DomainCollection //
-	raw           map[string]string
-	latest        map[string]*types.OutputLatestMessage
-	history       map[string]*types.OutputHistoryMessage
-	event         map[string]*types.OutputEventMessage
-	messageSigner *messaging.MessageSigner // subscription to output discovery messages
-	updateMutex   *sync.Mutex              // mutex for async updating of outputs
+	clock          messaging.Clock // clock for the age of history values and expiry of latest values
+	raw            map[string]string
+	latest         map[string]*types.OutputLatestMessage
+	history        map[string]*types.OutputHistoryMessage
+	event          map[string]*types.OutputEventMessage
+	maxHistoryAge  time.Duration            // max age of history values, 0 for unlimited
+	maxHistorySize int                      // max nr of history values per output, 0 for unlimited
+	valueMaxAge    *ValueMaxAge             // max age of latest values before they are stale
+	skipUnchanged  bool                     // skip updates of latest and raw values that are unchanged
+	deadband       map[string]float64       // min change of numeric latest values to notify handlers, by latest address
+	notified       map[string]string        // latest value handlers were last notified of, by latest address
+	messageSigner  *messaging.MessageSigner // subscription to output discovery messages
+	updateMutex    *sync.Mutex              // mutex for async updating of outputs
+
+	// handlers notified of value updates, by handler ID
+	eventHandlers   map[int]func(value *types.OutputEventMessage)
+	historyHandlers map[int]func(value *types.OutputHistoryMessage)
+	latestHandlers  map[int]func(value *types.OutputLatestMessage)
+	rawHandlers     map[int]func(address string, value string)
+	lastHandlerID   int // ID of the last registered handler
+
+	// received events of each node by event address, most recent first
+	eventHistory        map[string][]*types.OutputEventMessage
+	maxEventHistoryAge  time.Duration // max age of events in the history, 0 for unlimited
+	maxEventHistorySize int           // max nr of events in the history of a node, 0 for unlimited
+}
+
+// ExportValues returns a snapshot with copies of all output values
+func (dov *DomainOutputValues) ExportValues() *DomainOutputValuesSnapshot {
+	dov.updateMutex.Lock()
+	defer dov.updateMutex.Unlock()
+
+	snapshot := &DomainOutputValuesSnapshot{
+		Event:   make(map[string]types.OutputEventMessage),
+		History: make(map[string]types.OutputHistoryMessage),
+		Latest:  make(map[string]types.OutputLatestMessage),
+		Raw:     make(map[string]string),
+	}
+	for address, value := range dov.event {
+		event := *value
+		event.Event = make(map[string]string)
+		for key, eventValue := range value.Event {
+			event.Event[key] = eventValue
+		}
+		snapshot.Event[address] = event
+	}
+	for address, value := range dov.history {
+		history := *value
+		history.History = make([]types.OutputValue, len(value.History))
+		copy(history.History, value.History)
+		snapshot.History[address] = history
+	}
+	for address, value := range dov.latest {
+		snapshot.Latest[address] = *value
+	}
+	for address, value := range dov.raw {
+		snapshot.Raw[address] = value
+	}
+	return snapshot
+}
+
+// ForEachEvent invokes the handler for each node event, sorted by address
+// The collection is copied under the mutex so the handler can safely access the collection.
+// Iteration stops when the handler returns false.
+func (dov *DomainOutputValues) ForEachEvent(handler func(address string, value *types.OutputEventMessage) bool) {
+	dov.updateMutex.Lock()
+	snapshot := make(map[string]*types.OutputEventMessage, len(dov.event))
+	for address, value := range dov.event {
+		snapshot[address] = value
+	}
+	dov.updateMutex.Unlock()
+
+	for _, address := range sortedKeys(snapshot) {
+		if !handler(address, snapshot[address]) {
+			break
+		}
+	}
+}
+
+// ForEachLatest invokes the handler for each latest output value, sorted by address
+// Expired values are skipped.
+// The collection is copied under the mutex so the handler can safely access the collection.
+// Iteration stops when the handler returns false.
+func (dov *DomainOutputValues) ForEachLatest(handler func(address string, value *types.OutputLatestMessage) bool) {
+	dov.updateMutex.Lock()
+	now := dov.clock.Now()
+	snapshot := make(map[string]*types.OutputLatestMessage, len(dov.latest))
+	for address, value := range dov.latest {
+		if !value.IsExpired(now) {
+			snapshot[address] = value
+		}
+	}
+	dov.updateMutex.Unlock()
+
+	for _, address := range sortedKeys(snapshot) {
+		if !handler(address, snapshot[address]) {
+			break
+		}
+	}
+}
+
+// ForEachRaw invokes the handler for each raw output value, sorted by address
+// The collection is copied under the mutex so the handler can safely access the collection.
+// Iteration stops when the handler returns false.
+func (dov *DomainOutputValues) ForEachRaw(handler func(address string, value string) bool) {
+	dov.updateMutex.Lock()
+	snapshot := make(map[string]string, len(dov.raw))
+	for address, value := range dov.raw {
+		snapshot[address] = value
+	}
+	dov.updateMutex.Unlock()
+
+	for _, address := range sortedKeys(snapshot) {
+		if !handler(address, snapshot[address]) {
+			break
+		}
+	}
 }
 
 // GetRaw returns the latest raw value of an output
@@ -27,51 +165,520 @@ func (dov *DomainOutputValues) GetRaw(rawAddress string) (value string, found bo
 	return value, found
 }
 
+// GetHistory returns a copy of the history values of an output with a timestamp in the given range
+// The history is sorted with the most recent value first.
+//  since is the time of the oldest value to include. Use time.Time{} to include all older values
+//  until is the time of the newest value to include. Use time.Time{} to include all newer values
+func (dov *DomainOutputValues) GetHistory(historyAddress string, since time.Time, until time.Time) []types.OutputValue {
+	dov.updateMutex.Lock()
+	defer dov.updateMutex.Unlock()
+
+	historyList := make([]types.OutputValue, 0)
+	historyMessage, found := dov.history[historyAddress]
+	if !found || historyMessage == nil {
+		return historyList
+	}
+	for _, value := range historyMessage.History {
+		timestamp := GetOutputValueTime(&value)
+		if !since.IsZero() && timestamp.Before(since) {
+			continue
+		}
+		if !until.IsZero() && timestamp.After(until) {
+			continue
+		}
+		historyList = append(historyList, value)
+	}
+	return historyList
+}
+
+// GetHistoryStats returns statistics of the numeric history values of an output since the given time
+// Values that are not numeric are skipped and counted in NonNumericCount.
+//  since is the time of the oldest value to include. Use time.Time{} to include all values
+func (dov *DomainOutputValues) GetHistoryStats(historyAddress string, since time.Time) HistoryStats {
+	var stats = HistoryStats{}
+	var sum float64
+	var lastTime time.Time
+
+	history := dov.GetHistory(historyAddress, since, time.Time{})
+	for _, value := range history {
+		number, err := strconv.ParseFloat(value.Value, 64)
+		if err != nil {
+			stats.NonNumericCount++
+			continue
+		}
+		timestamp := GetOutputValueTime(&value)
+		if stats.Count == 0 || number < stats.Min {
+			stats.Min = number
+			stats.MinTime = timestamp
+		}
+		if stats.Count == 0 || number > stats.Max {
+			stats.Max = number
+			stats.MaxTime = timestamp
+		}
+		if stats.Count == 0 || timestamp.After(lastTime) {
+			stats.Last = number
+			lastTime = timestamp
+		}
+		sum += number
+		stats.Count++
+	}
+	if stats.Count > 0 {
+		stats.Mean = sum / float64(stats.Count)
+	}
+	return stats
+}
+
 // GetLatest returns the 'latest' value message of an output
+// A value that has expired is removed and not found. See types.OutputLatestMessage.Expires.
 func (dov *DomainOutputValues) GetLatest(latestAddress string) (value *types.OutputLatestMessage, found bool) {
 	dov.updateMutex.Lock()
 	defer dov.updateMutex.Unlock()
 	value, found = dov.latest[latestAddress]
+	if found && value.IsExpired(dov.clock.Now()) {
+		delete(dov.latest, latestAddress)
+		return nil, false
+	}
 	return value, found
 }
 
-// UpdateEvent replaces the node event value
-func (dov *DomainOutputValues) UpdateEvent(value *types.OutputEventMessage) {
+// GetLatestWithStale returns the 'latest' value message of an output and whether it is stale.
+// A value is stale when it is older than the max age of its output type. See SetValueMaxAge.
+func (dov *DomainOutputValues) GetLatestWithStale(latestAddress string) (
+	value *types.OutputLatestMessage, stale bool, found bool) {
+
+	value, found = dov.GetLatest(latestAddress)
+	if !found {
+		return nil, false, false
+	}
+	segments, err := types.ParseAddress(latestAddress)
+	if err != nil {
+		return value, false, true
+	}
+	dov.updateMutex.Lock()
+	valueMaxAge := dov.valueMaxAge
+	dov.updateMutex.Unlock()
+	stale = valueMaxAge.IsStale(types.OutputType(segments.OutputType), value.Timestamp)
+	return value, stale, true
+}
+
+// GetLatestByNode returns a copy of the latest values of all outputs of a node, by latest address.
+// The values are those whose address belongs to the node, see types.IsAddressOf, so node1 doesn't
+// match the outputs of node10. The copy is a consistent snapshot of the values.
+// Expired values are not included.
+//  nodeAddress is the node address with or without message type: domain/publisherID/nodeID[/$node]
+func (dov *DomainOutputValues) GetLatestByNode(nodeAddress string) map[string]*types.OutputLatestMessage {
+	nodeValues := make(map[string]*types.OutputLatestMessage)
+
+	dov.updateMutex.Lock()
+	defer dov.updateMutex.Unlock()
+	now := dov.clock.Now()
+	for address, value := range dov.latest {
+		if types.IsAddressOf(address, nodeAddress) && !value.IsExpired(now) {
+			valueCopy := *value
+			nodeValues[address] = &valueCopy
+		}
+	}
+	return nodeValues
+}
+
+// ImportValues merges the values of a snapshot into the collection
+// Existing values are only replaced if the snapshot value has a more recent timestamp. Raw values
+// have no timestamp and are only imported if no value exists. Update handlers are not notified.
+func (dov *DomainOutputValues) ImportValues(snapshot *DomainOutputValuesSnapshot) {
+	if snapshot == nil {
+		return
+	}
+	dov.updateMutex.Lock()
+	defer dov.updateMutex.Unlock()
+
+	for address, value := range snapshot.Event {
+		existing, found := dov.event[address]
+		if !found || isNewerTimestamp(value.Timestamp, existing.Timestamp) {
+			newValue := value
+			dov.event[address] = &newValue
+		}
+	}
+	for address, value := range snapshot.History {
+		existing, found := dov.history[address]
+		if !found || isNewerTimestamp(value.Timestamp, existing.Timestamp) {
+			newValue := value
+			dov.history[address] = &newValue
+		}
+	}
+	for address, value := range snapshot.Latest {
+		existing, found := dov.latest[address]
+		if !found || isNewerTimestamp(value.Timestamp, existing.Timestamp) {
+			newValue := value
+			dov.latest[address] = &newValue
+		}
+	}
+	for address, value := range snapshot.Raw {
+		if _, found := dov.raw[address]; !found {
+			dov.raw[address] = value
+		}
+	}
+}
+
+// OnEventUpdate registers a handler that is invoked when a node event is updated
+// Returns the handler ID for use with RemoveUpdateHandler
+func (dov *DomainOutputValues) OnEventUpdate(handler func(value *types.OutputEventMessage)) int {
 	dov.updateMutex.Lock()
 	defer dov.updateMutex.Unlock()
+	dov.lastHandlerID++
+	dov.eventHandlers[dov.lastHandlerID] = handler
+	return dov.lastHandlerID
+}
+
+// OnHistoryUpdate registers a handler that is invoked when an output history is updated
+// Returns the handler ID for use with RemoveUpdateHandler
+func (dov *DomainOutputValues) OnHistoryUpdate(handler func(value *types.OutputHistoryMessage)) int {
+	dov.updateMutex.Lock()
+	defer dov.updateMutex.Unlock()
+	dov.lastHandlerID++
+	dov.historyHandlers[dov.lastHandlerID] = handler
+	return dov.lastHandlerID
+}
+
+// OnLatestUpdate registers a handler that is invoked when the latest value of an output is updated
+// Returns the handler ID for use with RemoveUpdateHandler
+func (dov *DomainOutputValues) OnLatestUpdate(handler func(value *types.OutputLatestMessage)) int {
+	dov.updateMutex.Lock()
+	defer dov.updateMutex.Unlock()
+	dov.lastHandlerID++
+	dov.latestHandlers[dov.lastHandlerID] = handler
+	return dov.lastHandlerID
+}
+
+// OnRawUpdate registers a handler that is invoked when the raw value of an output is updated
+// Returns the handler ID for use with RemoveUpdateHandler
+func (dov *DomainOutputValues) OnRawUpdate(handler func(address string, value string)) int {
+	dov.updateMutex.Lock()
+	defer dov.updateMutex.Unlock()
+	dov.lastHandlerID++
+	dov.rawHandlers[dov.lastHandlerID] = handler
+	return dov.lastHandlerID
+}
+
+// RemoveUpdateHandler removes a handler registered with one of the On...Update functions
+func (dov *DomainOutputValues) RemoveUpdateHandler(handlerID int) {
+	dov.updateMutex.Lock()
+	defer dov.updateMutex.Unlock()
+	delete(dov.eventHandlers, handlerID)
+	delete(dov.historyHandlers, handlerID)
+	delete(dov.latestHandlers, handlerID)
+	delete(dov.rawHandlers, handlerID)
+}
+
+// SetLatestDeadband sets the minimum change of the numeric latest value of an output that notifies
+// the latest handlers. Intended to reduce notifications of slowly drifting analog sensors, eg use 0.5
+// to only notify of temperature changes of more than half a degree. The change is relative to the
+// value the handlers were last notified of. Non-numeric values always notify the handlers.
+// Latest values within the deadband are still stored.
+//  outputAddress is the output address with or without message type: domain/publisherID/nodeID/type/instance[/$output]
+//  deadband is the change that must be exceeded to notify the handlers. Use 0 to notify of all updates.
+func (dov *DomainOutputValues) SetLatestDeadband(outputAddress string, deadband float64) {
+	latestAddress := types.MakeMessageAddress(lib.MakeBaseAddress(outputAddress), types.MessageTypeLatest)
+	dov.updateMutex.Lock()
+	defer dov.updateMutex.Unlock()
+	if deadband <= 0 {
+		delete(dov.deadband, latestAddress)
+	} else {
+		dov.deadband[latestAddress] = deadband
+	}
+}
+
+// SetValueMaxAge sets the max age of latest values by output type, used to determine staleness
+// The max age can be shared with other collections. Use nil for values that never become stale.
+func (dov *DomainOutputValues) SetValueMaxAge(valueMaxAge *ValueMaxAge) {
+	if valueMaxAge == nil {
+		valueMaxAge = NewValueMaxAge(0)
+	}
+	dov.updateMutex.Lock()
+	defer dov.updateMutex.Unlock()
+	dov.valueMaxAge = valueMaxAge
+}
+
+// SetSkipUnchanged sets whether updates of latest and raw values that are unchanged are skipped
+// When skipped, the stored value keeps its timestamp and update handlers are not notified.
+// The default is to replace the value and notify the handlers regardless.
+func (dov *DomainOutputValues) SetSkipUnchanged(skipUnchanged bool) {
+	dov.updateMutex.Lock()
+	defer dov.updateMutex.Unlock()
+	dov.skipUnchanged = skipUnchanged
+}
+
+// UpdateEvent replaces the node event value and adds the event to the event history of the node
+// Registered event handlers are notified after the update.
+func (dov *DomainOutputValues) UpdateEvent(value *types.OutputEventMessage) {
+	dov.updateMutex.Lock()
 	dov.event[value.Address] = value
+	dov.addEventHistory(value)
+	handlers := make([]func(value *types.OutputEventMessage), 0, len(dov.eventHandlers))
+	for _, handler := range dov.eventHandlers {
+		handlers = append(handlers, handler)
+	}
+	dov.updateMutex.Unlock()
+
+	// handlers can safely access the collection
+	for _, handler := range handlers {
+		handler(value)
+	}
+}
+
+// RemoveNodeOutputValues removes the values of all outputs of a node, including the node's event
+// and event history
+//  nodeAddress is the node address with or without message type: domain/publisherID/nodeID[/$node]
+// Returns the number of removed entries
+func (dov *DomainOutputValues) RemoveNodeOutputValues(nodeAddress string) int {
+	var removeCount = 0
+
+	dov.updateMutex.Lock()
+	defer dov.updateMutex.Unlock()
+	for address := range dov.raw {
+		if types.IsAddressOf(address, nodeAddress) {
+			delete(dov.raw, address)
+			removeCount++
+		}
+	}
+	for address := range dov.latest {
+		if types.IsAddressOf(address, nodeAddress) {
+			delete(dov.latest, address)
+			delete(dov.notified, address)
+			removeCount++
+		}
+	}
+	for address := range dov.history {
+		if types.IsAddressOf(address, nodeAddress) {
+			delete(dov.history, address)
+			removeCount++
+		}
+	}
+	for address := range dov.event {
+		if types.IsAddressOf(address, nodeAddress) {
+			delete(dov.event, address)
+			removeCount++
+		}
+	}
+	for address := range dov.eventHistory {
+		if types.IsAddressOf(address, nodeAddress) {
+			delete(dov.eventHistory, address)
+		}
+	}
+	return removeCount
+}
+
+// RemoveOutputValues removes the raw, latest and history values of an output
+//  outputAddress is the output address with or without message type: domain/publisherID/nodeID/type/instance[/$output]
+// Events are published per node and are removed with RemoveNodeOutputValues.
+// Returns the number of removed entries
+func (dov *DomainOutputValues) RemoveOutputValues(outputAddress string) int {
+	var removeCount = 0
+	baseAddress := lib.MakeBaseAddress(outputAddress)
+
+	dov.updateMutex.Lock()
+	defer dov.updateMutex.Unlock()
+	rawAddress := types.MakeMessageAddress(baseAddress, types.MessageTypeRaw)
+	if _, found := dov.raw[rawAddress]; found {
+		delete(dov.raw, rawAddress)
+		removeCount++
+	}
+	latestAddress := types.MakeMessageAddress(baseAddress, types.MessageTypeLatest)
+	if _, found := dov.latest[latestAddress]; found {
+		delete(dov.latest, latestAddress)
+		delete(dov.notified, latestAddress)
+		removeCount++
+	}
+	historyAddress := types.MakeMessageAddress(baseAddress, types.MessageTypeHistory)
+	if _, found := dov.history[historyAddress]; found {
+		delete(dov.history, historyAddress)
+		removeCount++
+	}
+	return removeCount
+}
+
+// SetClock sets the clock used for the age of history values. Intended for testing.
+func (dov *DomainOutputValues) SetClock(clock messaging.Clock) {
+	dov.updateMutex.Lock()
+	defer dov.updateMutex.Unlock()
+	dov.clock = clock
+}
+
+// SetHistoryLimits sets the max number of values and max age of values retained in the history of an output
+//  maxHistorySize is the max number of values in the history of an output. Use 0 for unlimited.
+//  maxHistoryAge is the max age of values in the history. Use 0 for unlimited.
+func (dov *DomainOutputValues) SetHistoryLimits(maxHistorySize int, maxHistoryAge time.Duration) {
+	dov.updateMutex.Lock()
+	defer dov.updateMutex.Unlock()
+	dov.maxHistorySize = maxHistorySize
+	dov.maxHistoryAge = maxHistoryAge
 }
 
 // UpdateHistory replaces the output history value
+// If history limits are set then the oldest values that exceed the limits are removed.
+// Registered history handlers are notified after the update.
 func (dov *DomainOutputValues) UpdateHistory(value *types.OutputHistoryMessage) {
 	dov.updateMutex.Lock()
-	defer dov.updateMutex.Unlock()
+
+	if dov.maxHistorySize != 0 || dov.maxHistoryAge != 0 {
+		// sort a copy with the newest value first before trimming
+		trimmed := *value
+		trimmed.History = make([]types.OutputValue, len(value.History))
+		copy(trimmed.History, value.History)
+		sort.SliceStable(trimmed.History, func(i, j int) bool {
+			return GetOutputValueTime(&trimmed.History[i]).After(GetOutputValueTime(&trimmed.History[j]))
+		})
+		trimmed.History = trimHistory(trimmed.History, dov.clock.Now(), dov.maxHistorySize, dov.maxHistoryAge)
+		value = &trimmed
+	}
 	dov.history[value.Address] = value
+	handlers := make([]func(value *types.OutputHistoryMessage), 0, len(dov.historyHandlers))
+	for _, handler := range dov.historyHandlers {
+		handlers = append(handlers, handler)
+	}
+	dov.updateMutex.Unlock()
+
+	for _, handler := range handlers {
+		handler(value)
+	}
 }
 
 // UpdateLatest replaces the latest output value by output address
-func (dov *DomainOutputValues) UpdateLatest(value *types.OutputLatestMessage) {
+// Registered latest handlers are notified after the update. Values that have already expired are
+// ignored.
+// Returns true if the value differs from the stored value.
+func (dov *DomainOutputValues) UpdateLatest(value *types.OutputLatestMessage) (changed bool) {
 	dov.updateMutex.Lock()
-	defer dov.updateMutex.Unlock()
+	if value.IsExpired(dov.clock.Now()) {
+		dov.updateMutex.Unlock()
+		return false
+	}
+	existing, found := dov.latest[value.Address]
+	changed = !found || existing.Value != value.Value
+	if !changed && dov.skipUnchanged {
+		dov.updateMutex.Unlock()
+		return changed
+	}
 	dov.latest[value.Address] = value
+	if dov.isWithinDeadband(value) {
+		dov.updateMutex.Unlock()
+		return changed
+	}
+	dov.notified[value.Address] = value.Value
+	handlers := make([]func(value *types.OutputLatestMessage), 0, len(dov.latestHandlers))
+	for _, handler := range dov.latestHandlers {
+		handlers = append(handlers, handler)
+	}
+	dov.updateMutex.Unlock()
+
+	for _, handler := range handlers {
+		handler(value)
+	}
+	return changed
 }
 
 // UpdateRaw replaces the output raw value
-func (dov *DomainOutputValues) UpdateRaw(address string, value string) {
+// Registered raw handlers are notified after the update.
+// Returns true if the value differs from the stored value.
+func (dov *DomainOutputValues) UpdateRaw(address string, value string) (changed bool) {
 	dov.updateMutex.Lock()
-	defer dov.updateMutex.Unlock()
+	existing, found := dov.raw[address]
+	changed = !found || existing != value
+	if !changed && dov.skipUnchanged {
+		dov.updateMutex.Unlock()
+		return changed
+	}
 	dov.raw[address] = value
+	handlers := make([]func(address string, value string), 0, len(dov.rawHandlers))
+	for _, handler := range dov.rawHandlers {
+		handlers = append(handlers, handler)
+	}
+	dov.updateMutex.Unlock()
+
+	for _, handler := range handlers {
+		handler(address, value)
+	}
+	return changed
+}
+
+// GetOutputValueTime returns the time of an output value using its timestamp or epoch time
+// Returns a zero time if the value has no valid time
+func GetOutputValueTime(value *types.OutputValue) time.Time {
+	timestamp, err := time.Parse(types.TimeFormat, value.Timestamp)
+	if err == nil {
+		return timestamp
+	} else if value.EpochTime != 0 {
+		return time.Unix(value.EpochTime, 0)
+	}
+	return time.Time{}
+}
+
+// isWithinDeadband returns true if the numeric latest value hasn't changed more than the deadband of
+// its output since the handlers were last notified. Use within a locked section.
+func (dov *DomainOutputValues) isWithinDeadband(value *types.OutputLatestMessage) bool {
+	deadband, found := dov.deadband[value.Address]
+	if !found {
+		return false
+	}
+	notified, found := dov.notified[value.Address]
+	if !found {
+		return false
+	}
+	oldValue, err := strconv.ParseFloat(notified, 64)
+	if err != nil {
+		return false
+	}
+	newValue, err := strconv.ParseFloat(value.Value, 64)
+	if err != nil {
+		return false
+	}
+	return math.Abs(newValue-oldValue) <= deadband
+}
+
+// isNewerTimestamp returns true if the new timestamp is more recent than the existing timestamp
+// An existing timestamp that cannot be parsed is considered older.
+func isNewerTimestamp(newTimestamp string, existingTimestamp string) bool {
+	existingTime, err := time.Parse(types.TimeFormat, existingTimestamp)
+	if err != nil {
+		return true
+	}
+	newTime, err := time.Parse(types.TimeFormat, newTimestamp)
+	if err != nil {
+		return false
+	}
+	return newTime.After(existingTime)
+}
+
+// sortedKeys returns the sorted keys of a map with string keys
+func sortedKeys(collection interface{}) []string {
+	keys := make([]string, 0)
+	for _, key := range reflect.ValueOf(collection).MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 // NewDomainOutputValues creates a new instance for handling of discovered output values
 func NewDomainOutputValues(messageSigner *messaging.MessageSigner) *DomainOutputValues {
 	return &DomainOutputValues{
 		// c:             lib.NewDomainCollection(messageSigner, reflect.TypeOf(&types.OutputLatestMessage{})),
+		clock:         messaging.RealClock,
 		messageSigner: messageSigner,
 		updateMutex:   &sync.Mutex{},
 		raw:           make(map[string]string, 0),
 		latest:        make(map[string]*types.OutputLatestMessage, 0),
 		history:       make(map[string]*types.OutputHistoryMessage, 0),
 		event:         make(map[string]*types.OutputEventMessage, 0),
+		valueMaxAge:   NewValueMaxAge(0),
+		deadband:      make(map[string]float64),
+		notified:      make(map[string]string),
+
+		eventHandlers:   make(map[int]func(value *types.OutputEventMessage)),
+		historyHandlers: make(map[int]func(value *types.OutputHistoryMessage)),
+		latestHandlers:  make(map[int]func(value *types.OutputLatestMessage)),
+		rawHandlers:     make(map[int]func(address string, value string)),
+
+		eventHistory:        make(map[string][]*types.OutputEventMessage),
+		maxEventHistorySize: DefaultEventHistorySize,
 	}
 }
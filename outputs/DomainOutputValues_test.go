@@ -4,11 +4,13 @@ import (
 	"crypto/ecdsa"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/iotdomain/iotdomain-go/messaging"
 	"github.com/iotdomain/iotdomain-go/outputs"
 	"github.com/iotdomain/iotdomain-go/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCreateDomainOutputValues(t *testing.T) {
@@ -38,4 +40,370 @@ func TestCreateDomainOutputValues(t *testing.T) {
 	collection.UpdateHistory(&types.OutputHistoryMessage{})
 	collection.UpdateLatest(&types.OutputLatestMessage{})
 	collection.UpdateRaw(out1Addr, "raw")
+
+	// remove values of a single output and of a node
+	out2Addr := fmt.Sprintf("%s/%s/%s", node1Base, types.OutputTypeTemperature, types.DefaultOutputInstance)
+	collection.UpdateRaw(out1Addr+"/"+string(types.MessageTypeRaw), "raw")
+	collection.UpdateLatest(&types.OutputLatestMessage{Address: out1Addr + "/" + string(types.MessageTypeLatest)})
+	collection.UpdateRaw(out2Addr+"/"+string(types.MessageTypeRaw), "raw")
+	collection.UpdateEvent(&types.OutputEventMessage{Address: node1Base + "/" + string(types.MessageTypeEvent)})
+	count := collection.RemoveOutputValues(out1Addr + "/" + string(types.MessageTypeOutputDiscovery))
+	assert.Equal(t, 2, count)
+	_, found := collection.GetRaw(out1Addr + "/" + string(types.MessageTypeRaw))
+	assert.False(t, found)
+	count = collection.RemoveNodeOutputValues(node1Base + "/" + string(types.MessageTypeNodeDiscovery))
+	assert.Equal(t, 3, count)
+	_, found = collection.GetRaw(out2Addr + "/" + string(types.MessageTypeRaw))
+	assert.False(t, found)
+}
+
+func TestGetLatestByNode(t *testing.T) {
+	const node1Base = "test/pub1/node1"
+	const node10Base = "test/pub1/node10"
+	signer := messaging.NewMessageSigner(messaging.NewDummyMessenger(&messaging.MessengerConfig{}), nil, nil)
+	collection := outputs.NewDomainOutputValues(signer)
+
+	latest1Addr := node1Base + "/switch/0/" + string(types.MessageTypeLatest)
+	latest2Addr := node1Base + "/temperature/0/" + string(types.MessageTypeLatest)
+	collection.UpdateLatest(&types.OutputLatestMessage{Address: latest1Addr, Value: "on"})
+	collection.UpdateLatest(&types.OutputLatestMessage{Address: latest2Addr, Value: "21.5"})
+	collection.UpdateLatest(&types.OutputLatestMessage{
+		Address: node10Base + "/switch/0/" + string(types.MessageTypeLatest), Value: "off"})
+
+	// node1 doesn't include the outputs of node10
+	nodeValues := collection.GetLatestByNode(node1Base + "/" + string(types.MessageTypeNodeDiscovery))
+	require.Len(t, nodeValues, 2)
+	assert.Equal(t, "on", nodeValues[latest1Addr].Value)
+	assert.Equal(t, "21.5", nodeValues[latest2Addr].Value)
+
+	// the result is a copy
+	nodeValues[latest1Addr].Value = "modified"
+	value, _ := collection.GetLatest(latest1Addr)
+	assert.Equal(t, "on", value.Value)
+
+	nodeValues = collection.GetLatestByNode("test/pub1/node2")
+	assert.Empty(t, nodeValues)
+}
+
+func TestLatestStale(t *testing.T) {
+	const tempAddr = "test/pub1/node1/temperature/0/$latest"
+	const switchAddr = "test/pub1/node1/switch/0/$latest"
+	signer := messaging.NewMessageSigner(messaging.NewDummyMessenger(&messaging.MessengerConfig{}), nil, nil)
+	collection := outputs.NewDomainOutputValues(signer)
+	oldTimestamp := time.Now().Add(-2 * time.Hour).Format(types.TimeFormat)
+	collection.UpdateLatest(&types.OutputLatestMessage{Address: tempAddr, Value: "20", Timestamp: oldTimestamp})
+	collection.UpdateLatest(&types.OutputLatestMessage{Address: switchAddr, Value: "on", Timestamp: oldTimestamp})
+
+	// without max age values are never stale
+	value, stale, found := collection.GetLatestWithStale(tempAddr)
+	require.True(t, found)
+	assert.Equal(t, "20", value.Value)
+	assert.False(t, stale)
+
+	// max age by output type with a default for other types
+	valueMaxAge := outputs.NewValueMaxAge(3 * time.Hour)
+	valueMaxAge.SetMaxAge(types.OutputTypeTemperature, time.Hour)
+	collection.SetValueMaxAge(valueMaxAge)
+	_, stale, _ = collection.GetLatestWithStale(tempAddr)
+	assert.True(t, stale)
+	_, stale, _ = collection.GetLatestWithStale(switchAddr)
+	assert.False(t, stale)
+
+	// a recent value isn't stale
+	collection.UpdateLatest(&types.OutputLatestMessage{
+		Address: tempAddr, Value: "21", Timestamp: time.Now().Format(types.TimeFormat)})
+	value, stale, _ = collection.GetLatestWithStale(tempAddr)
+	assert.Equal(t, "21", value.Value)
+	assert.False(t, stale)
+
+	_, _, found = collection.GetLatestWithStale("test/pub1/node2/temperature/0/$latest")
+	assert.False(t, found)
+}
+
+func TestLatestExpiry(t *testing.T) {
+	const codeAddr = "test/pub1/node1/otp/0/$latest"
+	const tempAddr = "test/pub1/node1/temperature/0/$latest"
+	signer := messaging.NewMessageSigner(messaging.NewDummyMessenger(&messaging.MessengerConfig{}), nil, nil)
+	collection := outputs.NewDomainOutputValues(signer)
+	clock := messaging.NewManualClock(time.Now())
+	collection.SetClock(clock)
+	now := clock.Now().Format(types.TimeFormat)
+	expires := clock.Now().Add(time.Minute).Format(types.TimeFormat)
+	collection.UpdateLatest(&types.OutputLatestMessage{Address: codeAddr, Value: "1234", Timestamp: now, Expires: expires})
+	collection.UpdateLatest(&types.OutputLatestMessage{Address: tempAddr, Value: "20", Timestamp: now})
+
+	value, found := collection.GetLatest(codeAddr)
+	require.True(t, found)
+	assert.Equal(t, "1234", value.Value)
+	assert.Len(t, collection.GetLatestByNode("test/pub1/node1"), 2)
+
+	// expired values are absent
+	clock.Advance(time.Minute)
+	assert.True(t, value.IsExpired(clock.Now()))
+	assert.Len(t, collection.GetLatestByNode("test/pub1/node1"), 1)
+	count := 0
+	collection.ForEachLatest(func(address string, value *types.OutputLatestMessage) bool {
+		count++
+		return true
+	})
+	assert.Equal(t, 1, count)
+	_, found = collection.GetLatest(codeAddr)
+	assert.False(t, found)
+	_, found = collection.GetLatest(tempAddr)
+	assert.True(t, found, "value without expiry expired")
+
+	// values that arrive expired are ignored
+	changed := collection.UpdateLatest(&types.OutputLatestMessage{
+		Address: codeAddr, Value: "5678", Timestamp: now, Expires: expires})
+	assert.False(t, changed)
+	_, found = collection.GetLatest(codeAddr)
+	assert.False(t, found)
+	assert.True(t, (&types.OutputLatestMessage{Expires: "invalid"}).IsExpired(clock.Now()))
+}
+
+func TestDomainOutputHistory(t *testing.T) {
+	const historyAddr = "test/pub1/node1/temperature/0/$history"
+	now := time.Now()
+	history := make([]types.OutputValue, 0)
+	for i := 0; i < 10; i++ {
+		timestamp := now.Add(-time.Duration(i) * time.Minute)
+		history = append(history, types.OutputValue{
+			Timestamp: timestamp.Format(types.TimeFormat),
+			EpochTime: timestamp.Unix(),
+			Value:     fmt.Sprint(i),
+		})
+	}
+	collection := outputs.NewDomainOutputValues(nil)
+	collection.UpdateHistory(&types.OutputHistoryMessage{Address: historyAddr, History: history})
+
+	all := collection.GetHistory(historyAddr, time.Time{}, time.Time{})
+	assert.Equal(t, 10, len(all))
+
+	// the last 3 minutes excluding the most recent value
+	window := collection.GetHistory(historyAddr, now.Add(-3*time.Minute-time.Second), now.Add(-time.Second))
+	assert.Equal(t, 3, len(window))
+	assert.Equal(t, "1", window[0].Value)
+
+	// the result is a copy
+	window[0].Value = "changed"
+	all = collection.GetHistory(historyAddr, time.Time{}, time.Time{})
+	assert.Equal(t, "1", all[1].Value)
+
+	unknown := collection.GetHistory("unknown", time.Time{}, time.Time{})
+	assert.Equal(t, 0, len(unknown))
+
+	// statistics over the last 5 minutes, values 0..5
+	history[2].Value = "not a number"
+	collection.UpdateHistory(&types.OutputHistoryMessage{Address: historyAddr, History: history})
+	stats := collection.GetHistoryStats(historyAddr, now.Add(-5*time.Minute-time.Second))
+	assert.Equal(t, 5, stats.Count)
+	assert.Equal(t, 1, stats.NonNumericCount)
+	assert.Equal(t, float64(0), stats.Min)
+	assert.Equal(t, float64(5), stats.Max)
+	assert.Equal(t, float64(0), stats.Last)
+	assert.Equal(t, float64(13)/5, stats.Mean)
+	assert.True(t, stats.MaxTime.Before(stats.MinTime))
+}
+
+func TestDomainOutputValueHandlers(t *testing.T) {
+	const latestAddr = "test/pub1/node1/temperature/0/$latest"
+	var latestCount = 0
+	var rawCount = 0
+	collection := outputs.NewDomainOutputValues(nil)
+
+	// handlers can call back into the collection
+	latestID := collection.OnLatestUpdate(func(value *types.OutputLatestMessage) {
+		latest, found := collection.GetLatest(value.Address)
+		assert.True(t, found)
+		assert.Equal(t, value, latest)
+		latestCount++
+	})
+	collection.OnLatestUpdate(func(value *types.OutputLatestMessage) {
+		latestCount++
+	})
+	rawID := collection.OnRawUpdate(func(address string, value string) {
+		rawCount++
+	})
+	collection.OnEventUpdate(func(value *types.OutputEventMessage) {})
+	collection.OnHistoryUpdate(func(value *types.OutputHistoryMessage) {})
+
+	collection.UpdateLatest(&types.OutputLatestMessage{Address: latestAddr, Value: "21"})
+	collection.UpdateRaw(latestAddr, "21")
+	collection.UpdateEvent(&types.OutputEventMessage{})
+	collection.UpdateHistory(&types.OutputHistoryMessage{})
+	assert.Equal(t, 2, latestCount)
+	assert.Equal(t, 1, rawCount)
+
+	collection.RemoveUpdateHandler(latestID)
+	collection.RemoveUpdateHandler(rawID)
+	collection.UpdateLatest(&types.OutputLatestMessage{Address: latestAddr, Value: "22"})
+	collection.UpdateRaw(latestAddr, "22")
+	assert.Equal(t, 3, latestCount)
+	assert.Equal(t, 1, rawCount)
+}
+
+func TestLatestDeadband(t *testing.T) {
+	const outputAddr = "test/pub1/node1/temperature/0/$output"
+	const latestAddr = "test/pub1/node1/temperature/0/$latest"
+	var notifiedValues = make([]string, 0)
+	collection := outputs.NewDomainOutputValues(nil)
+	collection.OnLatestUpdate(func(value *types.OutputLatestMessage) {
+		notifiedValues = append(notifiedValues, value.Value)
+	})
+	collection.SetLatestDeadband(outputAddr, 0.5)
+
+	// slow drift only notifies when the change since the last notification exceeds the deadband
+	for _, value := range []string{"21.0", "21.2", "21.4", "21.6", "21.3", "20.9"} {
+		collection.UpdateLatest(&types.OutputLatestMessage{Address: latestAddr, Value: value})
+	}
+	assert.Equal(t, []string{"21.0", "21.6", "20.9"}, notifiedValues)
+	latest, _ := collection.GetLatest(latestAddr)
+	assert.Equal(t, "20.9", latest.Value)
+
+	// non-numeric values always notify
+	collection.UpdateLatest(&types.OutputLatestMessage{Address: latestAddr, Value: "error"})
+	collection.UpdateLatest(&types.OutputLatestMessage{Address: latestAddr, Value: "21.0"})
+	assert.Equal(t, 5, len(notifiedValues))
+
+	// without deadband all updates notify
+	collection.SetLatestDeadband(outputAddr, 0)
+	collection.UpdateLatest(&types.OutputLatestMessage{Address: latestAddr, Value: "21.1"})
+	assert.Equal(t, 6, len(notifiedValues))
+}
+
+func TestExportImportValues(t *testing.T) {
+	const latestAddr = "test/pub1/node1/temperature/0/$latest"
+	const latest2Addr = "test/pub1/node1/humidity/0/$latest"
+	const rawAddr = "test/pub1/node1/temperature/0/$raw"
+	now := time.Now()
+	collection := outputs.NewDomainOutputValues(nil)
+	collection.UpdateLatest(&types.OutputLatestMessage{
+		Address: latestAddr, Value: "20", Timestamp: now.Format(types.TimeFormat)})
+	collection.UpdateLatest(&types.OutputLatestMessage{
+		Address: latest2Addr, Value: "60", Timestamp: now.Format(types.TimeFormat)})
+	collection.UpdateRaw(rawAddr, "20")
+
+	snapshot := collection.ExportValues()
+	require.NotNil(t, snapshot)
+	assert.Equal(t, 2, len(snapshot.Latest))
+	assert.Equal(t, "20", snapshot.Raw[rawAddr])
+
+	// import into a collection with a newer and an older value
+	collection2 := outputs.NewDomainOutputValues(nil)
+	collection2.UpdateLatest(&types.OutputLatestMessage{
+		Address: latestAddr, Value: "21", Timestamp: now.Add(time.Minute).Format(types.TimeFormat)})
+	collection2.UpdateLatest(&types.OutputLatestMessage{
+		Address: latest2Addr, Value: "59", Timestamp: now.Add(-time.Minute).Format(types.TimeFormat)})
+	collection2.ImportValues(snapshot)
+
+	latest, _ := collection2.GetLatest(latestAddr)
+	assert.Equal(t, "21", latest.Value, "Newer value was replaced")
+	latest, _ = collection2.GetLatest(latest2Addr)
+	assert.Equal(t, "60", latest.Value, "Older value wasn't replaced")
+	raw, found := collection2.GetRaw(rawAddr)
+	assert.True(t, found)
+	assert.Equal(t, "20", raw)
+	collection2.ImportValues(nil)
+
+	// iterate with early stop
+	var count = 0
+	collection2.ForEachLatest(func(address string, value *types.OutputLatestMessage) bool {
+		count++
+		return false
+	})
+	assert.Equal(t, 1, count)
+	count = 0
+	collection2.ForEachRaw(func(address string, value string) bool {
+		_, found := collection2.GetRaw(address)
+		assert.True(t, found)
+		count++
+		return true
+	})
+	assert.Equal(t, 1, count)
+	collection2.ForEachEvent(func(address string, value *types.OutputEventMessage) bool {
+		return true
+	})
+}
+
+func TestUpdateUnchangedValues(t *testing.T) {
+	const rawAddr = "test/pub1/node1/temperature/0/$raw"
+	const latestAddr = "test/pub1/node1/temperature/0/$latest"
+	var rawCount = 0
+	collection := outputs.NewDomainOutputValues(nil)
+	collection.OnRawUpdate(func(address string, value string) {
+		rawCount++
+	})
+
+	// by default identical values are still updated
+	assert.True(t, collection.UpdateRaw(rawAddr, "20"))
+	assert.False(t, collection.UpdateRaw(rawAddr, "20"))
+	assert.Equal(t, 2, rawCount)
+
+	// skip identical values
+	collection.SetSkipUnchanged(true)
+	for i := 0; i < 5; i++ {
+		changed := collection.UpdateRaw(rawAddr, "20")
+		assert.False(t, changed)
+	}
+	assert.Equal(t, 2, rawCount)
+	assert.True(t, collection.UpdateRaw(rawAddr, "21"))
+	assert.Equal(t, 3, rawCount)
+
+	latest1 := &types.OutputLatestMessage{Address: latestAddr, Value: "20", Timestamp: "1"}
+	latest2 := &types.OutputLatestMessage{Address: latestAddr, Value: "20", Timestamp: "2"}
+	assert.True(t, collection.UpdateLatest(latest1))
+	assert.False(t, collection.UpdateLatest(latest2))
+	latest, _ := collection.GetLatest(latestAddr)
+	assert.Equal(t, "1", latest.Timestamp, "Unchanged latest value was replaced")
+}
+
+func TestEventHistory(t *testing.T) {
+	const eventAddr = "test/pub1/node1/$event"
+	signer := messaging.NewMessageSigner(messaging.NewDummyMessenger(&messaging.MessengerConfig{}), nil, nil)
+	collection := outputs.NewDomainOutputValues(signer)
+	clock := messaging.NewManualClock(time.Now())
+	collection.SetClock(clock)
+	collection.SetEventHistoryLimits(3, 0)
+	start := clock.Now().Truncate(time.Second)
+	newEvent := func(seconds int, state string) *types.OutputEventMessage {
+		return &types.OutputEventMessage{
+			Address:   eventAddr,
+			Event:     map[string]string{"door": state},
+			Timestamp: start.Add(time.Duration(seconds) * time.Second).Format(types.TimeFormat),
+		}
+	}
+
+	// events are ordered most recent first, also when received out of order
+	collection.UpdateEvent(newEvent(1, "open"))
+	collection.UpdateEvent(newEvent(3, "open"))
+	collection.UpdateEvent(newEvent(2, "closed"))
+	history := collection.GetEventHistory(eventAddr, time.Time{})
+	require.Len(t, history, 3)
+	assert.Equal(t, newEvent(3, "open").Timestamp, history[0].Timestamp)
+	assert.Equal(t, "closed", history[1].Event["door"])
+	assert.Equal(t, newEvent(1, "open").Timestamp, history[2].Timestamp)
+
+	// a repeated event is not added again
+	collection.UpdateEvent(newEvent(3, "open"))
+	assert.Len(t, collection.GetEventHistory(eventAddr, time.Time{}), 3)
+
+	// the oldest events are trimmed when the limit is exceeded
+	collection.UpdateEvent(newEvent(4, "closed"))
+	history = collection.GetEventHistory(eventAddr, time.Time{})
+	require.Len(t, history, 3)
+	assert.Equal(t, newEvent(4, "closed").Timestamp, history[0].Timestamp)
+	assert.Equal(t, newEvent(2, "closed").Timestamp, history[2].Timestamp)
+	assert.Len(t, collection.GetEventHistory(eventAddr, start.Add(3*time.Second)), 2)
+
+	// events that exceed the max age are trimmed
+	collection.SetEventHistoryLimits(0, time.Minute)
+	clock.Advance(time.Minute + 3*time.Second)
+	collection.UpdateEvent(newEvent(5, "open"))
+	history = collection.GetEventHistory(eventAddr, time.Time{})
+	require.Len(t, history, 2)
+	assert.Equal(t, newEvent(4, "closed").Timestamp, history[1].Timestamp)
+
+	// the history is removed with the node
+	collection.RemoveNodeOutputValues("test/pub1/node1")
+	assert.Len(t, collection.GetEventHistory(eventAddr, time.Time{}), 0)
 }
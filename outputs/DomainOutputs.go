@@ -2,7 +2,6 @@
 package outputs
 
 import (
-	"fmt"
 	"reflect"
 
 	"github.com/iotdomain/iotdomain-go/lib"
@@ -90,8 +89,8 @@ func (domainOutputs *DomainOutputs) handleDiscoverOutput(address string, message
 
 // MakeOutputDiscoveryAddress creates the address for the output discovery
 func MakeOutputDiscoveryAddress(domain string, publisherID string, nodeID string, outputType types.OutputType, instance string) string {
-	address := fmt.Sprintf("%s/%s/%s"+"/%s/%s/"+types.MessageTypeOutputDiscovery,
-		domain, publisherID, nodeID, outputType, instance)
+	address := types.MakeAddress(&types.AddressSegments{Domain: domain, PublisherID: publisherID, NodeID: nodeID,
+		OutputType: string(outputType), Instance: instance, MessageType: types.MessageTypeOutputDiscovery})
 	return address
 }
 
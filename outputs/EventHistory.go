@@ -0,0 +1,89 @@
+// Package outputs with a bounded history of received node events
+package outputs
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/types"
+)
+
+// DefaultEventHistorySize is the default max nr of events retained in the history of a node
+const DefaultEventHistorySize = 100
+
+// GetEventHistory returns the events of a node received since the given time, most recent first.
+// Unlike GetHistory of outputs, events are discrete so each received event is retained until it
+// exceeds the limits set with SetEventHistoryLimits.
+//  eventAddress is the node event address: domain/publisherID/nodeID/$event
+//  since is the time of the oldest event to include. Use time.Time{} to include all events
+func (dov *DomainOutputValues) GetEventHistory(eventAddress string, since time.Time) []*types.OutputEventMessage {
+	dov.updateMutex.Lock()
+	defer dov.updateMutex.Unlock()
+
+	eventList := make([]*types.OutputEventMessage, 0)
+	for _, event := range dov.eventHistory[eventAddress] {
+		if !since.IsZero() && getEventTime(event).Before(since) {
+			continue
+		}
+		eventList = append(eventList, event)
+	}
+	return eventList
+}
+
+// SetEventHistoryLimits sets the max number of events and max age of events retained in the
+// event history of a node. The default is DefaultEventHistorySize events of any age.
+//  maxEventHistorySize is the max number of events in the history of a node. Use 0 for unlimited.
+//  maxEventHistoryAge is the max age of events in the history. Use 0 for unlimited.
+func (dov *DomainOutputValues) SetEventHistoryLimits(maxEventHistorySize int, maxEventHistoryAge time.Duration) {
+	dov.updateMutex.Lock()
+	defer dov.updateMutex.Unlock()
+	dov.maxEventHistorySize = maxEventHistorySize
+	dov.maxEventHistoryAge = maxEventHistoryAge
+}
+
+// addEventHistory inserts an event into the event history of its node, ordered by timestamp with
+// the most recent event first, and removes the events that exceed the history limits.
+// Events that are already in the history, eg a retained event that is received again, are ignored.
+// Use within a locked section.
+func (dov *DomainOutputValues) addEventHistory(value *types.OutputEventMessage) {
+	history := dov.eventHistory[value.Address]
+	eventTime := getEventTime(value)
+	index := 0
+	for ; index < len(history); index++ {
+		existing := history[index]
+		if existing.Timestamp == value.Timestamp && reflect.DeepEqual(existing.Event, value.Event) {
+			return
+		}
+		if getEventTime(existing).Before(eventTime) {
+			break
+		}
+	}
+	history = append(history, nil)
+	copy(history[index+1:], history[index:])
+	history[index] = value
+
+	if dov.maxEventHistorySize > 0 && len(history) > dov.maxEventHistorySize {
+		history = history[:dov.maxEventHistorySize]
+	}
+	if dov.maxEventHistoryAge > 0 {
+		oldest := dov.clock.Now().Add(-dov.maxEventHistoryAge)
+		for len(history) > 0 && getEventTime(history[len(history)-1]).Before(oldest) {
+			history = history[:len(history)-1]
+		}
+	}
+	if len(history) == 0 {
+		delete(dov.eventHistory, value.Address)
+		return
+	}
+	dov.eventHistory[value.Address] = history
+}
+
+// getEventTime returns the time of an event from its timestamp
+// Returns a zero time if the event has no valid timestamp
+func getEventTime(value *types.OutputEventMessage) time.Time {
+	timestamp, err := time.Parse(types.TimeFormat, value.Timestamp)
+	if err != nil {
+		return time.Time{}
+	}
+	return timestamp
+}
@@ -0,0 +1,104 @@
+// Package outputs with the range of observed output values
+package outputs
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/types"
+)
+
+// ObservedRange holds the lowest and highest numeric value observed for an output, with the time
+// they were observed. Intended for auto-ranging charts and anomaly detection without scanning
+// the history.
+type ObservedRange struct {
+	Max     float64 // highest observed value
+	MaxTime string  // time the highest value was observed, in types.TimeFormat
+	Min     float64 // lowest observed value
+	MinTime string  // time the lowest value was observed, in types.TimeFormat
+	Since   string  // time the range started, in types.TimeFormat
+}
+
+// GetObservedRange returns the range of values observed for an output since the range started.
+// Non-numeric, NaN and infinite values are not included in the range.
+// Returns false if no numeric value has been observed
+func (outputValues *RegisteredOutputValues) GetObservedRange(outputID string) (ObservedRange, bool) {
+	outputValues.updateMutex.Lock()
+	defer outputValues.updateMutex.Unlock()
+	observed := outputValues.observedRanges[outputID]
+	if observed == nil {
+		return ObservedRange{}, false
+	}
+	return observed.ObservedRange, true
+}
+
+// ResetObservedRange clears the observed range of an output. The next value starts a new range.
+func (outputValues *RegisteredOutputValues) ResetObservedRange(outputID string) {
+	outputValues.updateMutex.Lock()
+	defer outputValues.updateMutex.Unlock()
+	delete(outputValues.observedRanges, outputID)
+}
+
+// SetObservedRangeWindow sets how long an observed range lasts before a new range starts. The
+// default is 0, which tracks the all-time range.
+// Windows are tumbling, not rolling: when the window of the current range has passed, the next
+// value starts a new range and the values of the previous range are forgotten. Shortly after a new
+// range starts it therefore only includes a few values.
+//  window is the duration of the range. Values observed before the start of the current range,
+//  eg backfilled values, are ignored. Use 0 to track the all-time range.
+func (outputValues *RegisteredOutputValues) SetObservedRangeWindow(window time.Duration) {
+	outputValues.updateMutex.Lock()
+	defer outputValues.updateMutex.Unlock()
+	outputValues.observedRangeWindow = window
+}
+
+// observedRange is the range of an output with its parsed start time
+type observedRange struct {
+	ObservedRange
+	since time.Time
+}
+
+// updateObservedRange includes a value in the observed range of an output. A new range is started
+// when the window of the current range has passed. Non-numeric, NaN and infinite values are ignored.
+// Use within a locked section.
+func (outputValues *RegisteredOutputValues) updateObservedRange(outputID string, value string, timestamp time.Time) {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+		return
+	}
+	window := outputValues.observedRangeWindow
+	now := outputValues.clock.Now()
+	observed := outputValues.observedRanges[outputID]
+	if observed != nil && window > 0 && now.Sub(observed.since) >= window {
+		observed = nil
+	}
+	timeString := timestamp.Format(types.TimeFormat)
+	if observed == nil {
+		if window > 0 && now.Sub(timestamp) >= window {
+			return
+		}
+		// the range starts with its first value
+		outputValues.observedRanges[outputID] = &observedRange{
+			ObservedRange: ObservedRange{
+				Max: number, MaxTime: timeString, Min: number, MinTime: timeString, Since: timeString},
+			since: timestamp,
+		}
+		return
+	}
+	if timestamp.Before(observed.since) {
+		if window > 0 {
+			return
+		}
+		observed.since = timestamp
+		observed.Since = timeString
+	}
+	if number > observed.Max {
+		observed.Max = number
+		observed.MaxTime = timeString
+	}
+	if number < observed.Min {
+		observed.Min = number
+		observed.MinTime = timeString
+	}
+}
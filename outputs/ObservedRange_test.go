@@ -0,0 +1,72 @@
+package outputs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/outputs"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObservedRange(t *testing.T) {
+	const domain = "test"
+	const publisher1ID = "publisher1"
+	const node1ID = "node1"
+	start := time.Now().Truncate(time.Second)
+	clock := messaging.NewManualClock(start)
+	collection := outputs.NewRegisteredOutputValues(domain, publisher1ID)
+	collection.SetClock(clock)
+	outputID := outputs.MakeOutputID(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance)
+
+	_, found := collection.GetObservedRange(outputID)
+	assert.False(t, found)
+
+	// non-numeric values are ignored
+	collection.UpdateOutputValue(outputID, "n/a")
+	_, found = collection.GetObservedRange(outputID)
+	assert.False(t, found)
+
+	collection.UpdateOutputValue(outputID, "20")
+	clock.Advance(time.Minute)
+	collection.UpdateOutputValue(outputID, "25.5")
+	clock.Advance(time.Minute)
+	collection.UpdateOutputValue(outputID, "18")
+	observed, found := collection.GetObservedRange(outputID)
+	require.True(t, found)
+	assert.Equal(t, 25.5, observed.Max)
+	assert.Equal(t, start.Add(time.Minute).Format(types.TimeFormat), observed.MaxTime)
+	assert.Equal(t, 18.0, observed.Min)
+	assert.Equal(t, start.Add(2*time.Minute).Format(types.TimeFormat), observed.MinTime)
+	assert.Equal(t, start.Format(types.TimeFormat), observed.Since)
+
+	// NaN and infinite values don't poison the range
+	collection.UpdateOutputValue(outputID, "NaN")
+	collection.UpdateOutputValue(outputID, "+Inf")
+	collection.UpdateOutputValue(outputID, "-Inf")
+	observed, _ = collection.GetObservedRange(outputID)
+	assert.Equal(t, 25.5, observed.Max)
+	assert.Equal(t, 18.0, observed.Min)
+
+	// all-time ranges include backfilled values
+	collection.UpdateOutputValueAt(outputID, "30", start.Add(-time.Minute))
+	observed, _ = collection.GetObservedRange(outputID)
+	assert.Equal(t, 30.0, observed.Max)
+	assert.Equal(t, start.Add(-time.Minute).Format(types.TimeFormat), observed.Since)
+
+	// windowed ranges start over when the window has passed
+	collection.ResetObservedRange(outputID)
+	collection.SetObservedRangeWindow(time.Hour)
+	collection.UpdateOutputValue(outputID, "21")
+	collection.UpdateOutputValueAt(outputID, "40", clock.Now().Add(-time.Minute))
+	observed, _ = collection.GetObservedRange(outputID)
+	assert.Equal(t, 21.0, observed.Max, "backfilled value before the window is included")
+	clock.Advance(time.Hour)
+	collection.UpdateOutputValue(outputID, "22")
+	observed, _ = collection.GetObservedRange(outputID)
+	assert.Equal(t, 22.0, observed.Max)
+	assert.Equal(t, 22.0, observed.Min)
+	assert.Equal(t, clock.Now().Format(types.TimeFormat), observed.Since)
+}
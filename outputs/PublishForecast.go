@@ -1,7 +1,6 @@
 package outputs
 
 import (
-	"time"
 
 	"github.com/iotdomain/iotdomain-go/messaging"
 	"github.com/iotdomain/iotdomain-go/types"
@@ -17,7 +16,7 @@ func PublishForecast(
 ) {
 
 	aliasAddress := ReplaceMessageType(output.Address, types.MessageTypeForecast)
-	timeStampStr := time.Now().Format("2006-01-02T15:04:05.000-0700")
+	timeStampStr := messageSigner.Clock().Now().Format("2006-01-02T15:04:05.000-0700")
 
 	forecastMessage := &types.OutputForecastMessage{
 		Address:   aliasAddress,
@@ -27,7 +26,7 @@ func PublishForecast(
 		Forecast:  forecast,
 	}
 	logrus.Debugf("Publisher.publishForecast: %d entries on %s", len(forecastMessage.Forecast), aliasAddress)
-	messageSigner.PublishObject(aliasAddress, true, forecastMessage, nil)
+	messageSigner.PublishObjectWithPolicy(aliasAddress, forecastMessage, nil)
 }
 
 // PublishUpdatedForecasts publishes the output forecasts
@@ -2,14 +2,30 @@
 package outputs
 
 import (
-	"strings"
 	"time"
 
+	"github.com/iotdomain/iotdomain-go/lib"
 	"github.com/iotdomain/iotdomain-go/messaging"
 	"github.com/iotdomain/iotdomain-go/types"
 	"github.com/sirupsen/logrus"
 )
 
+// PublishEvent publishes a $event message with multiple named values of a node. Events are not
+// retained by default, see messaging.DefaultRetainedPolicy and MessageSigner.SetRetainedPolicy.
+//  nodeAddress is the node address, using the node alias if any: domain/publisher/nodeID[/$node]
+//  event contains the named values, eg {"state": "open", "battery": "80"}
+func PublishEvent(nodeAddress string, event map[string]string, messageSigner *messaging.MessageSigner) error {
+	addr := types.MakeMessageAddress(lib.MakeBaseAddress(nodeAddress), types.MessageTypeEvent)
+	logrus.Infof("PublishEvent to: %s", addr)
+
+	eventMessage := &types.OutputEventMessage{
+		Address:   addr,
+		Event:     event,
+		Timestamp: messageSigner.Clock().Now().Format(types.TimeFormat),
+	}
+	return messageSigner.PublishObjectWithPolicy(addr, eventMessage, nil)
+}
+
 // PublishOutputHistory publishes the $history output values retained=true
 func PublishOutputHistory(
 	output *types.OutputDiscoveryMessage,
@@ -18,7 +34,7 @@ func PublishOutputHistory(
 ) {
 	// output values are published using their alias address, if any
 	addr := ReplaceMessageType(output.Address, types.MessageTypeHistory)
-	timeStampStr := time.Now().Format("2006-01-02T15:04:05.000-0700")
+	timeStampStr := messageSigner.Clock().Now().Format(types.TimeFormat)
 	logrus.Infof("PublishOutputHistory to: %s", addr)
 
 	// todo: use output configuration to determine if history is published for this output
@@ -30,7 +46,7 @@ func PublishOutputHistory(
 		History:   history,
 	}
 	logrus.Debugf("PublishOutputHistory: %d entries to: %s", len(historyMessage.History), addr)
-	messageSigner.PublishObject(addr, true, historyMessage, nil)
+	messageSigner.PublishObjectWithPolicy(addr, historyMessage, nil)
 }
 
 // PublishOutputLatest publishes the $latest output value
@@ -40,19 +56,74 @@ func PublishOutputLatest(
 	latest *types.OutputValue,
 	messageSigner *messaging.MessageSigner,
 ) {
-	// output values are published using their alias address, if any
-	addr := ReplaceMessageType(output.Address, types.MessageTypeLatest)
-	logrus.Infof("PublishOutputLatest to: %s", addr)
+	latestMessage := makeOutputLatestMessage(output, latest)
+	messageSigner.PublishObjectWithPolicy(latestMessage.Address, latestMessage, nil)
+}
 
-	// todo: use output configuration to determine if latest message is published for this output
-	// zone/publisher/node/iotype/instance/$latest
-	latestMessage := &types.OutputLatestMessage{
-		Address:   addr,
-		Timestamp: latest.Timestamp,
-		Unit:      output.Unit,
-		Value:     latest.Value,
+// PublishOutputLatestTyped publishes the $latest output value including the value as a JSON number
+// or boolean, based on the output data type. See types.TypedValue.
+// not thread-safe, using within a locked section
+func PublishOutputLatestTyped(
+	output *types.OutputDiscoveryMessage,
+	latest *types.OutputValue,
+	messageSigner *messaging.MessageSigner,
+) {
+	latestMessage := makeOutputLatestMessage(output, latest)
+	latestMessage.TypedValue = types.TypedValue(output.DataType, latest.Value)
+	messageSigner.PublishObjectWithPolicy(latestMessage.Address, latestMessage, nil)
+}
+
+// PublishOutputLatestWithTTL publishes the $latest output value with the time the value expires.
+// The expiry is part of the signed message. Subscribers treat the value as absent once it expires.
+// not thread-safe, using within a locked section
+//  ttl is the lifetime of the value since its timestamp
+//  typed includes the value as a JSON number or boolean. See PublishOutputLatestTyped.
+func PublishOutputLatestWithTTL(
+	output *types.OutputDiscoveryMessage,
+	latest *types.OutputValue,
+	ttl time.Duration,
+	typed bool,
+	messageSigner *messaging.MessageSigner,
+) {
+	latestMessage := makeOutputLatestMessage(output, latest)
+	if typed {
+		latestMessage.TypedValue = types.TypedValue(output.DataType, latest.Value)
 	}
-	messageSigner.PublishObject(addr, true, latestMessage, nil)
+	valueTime := GetOutputValueTime(latest)
+	if valueTime.IsZero() {
+		valueTime = messageSigner.Clock().Now()
+	}
+	latestMessage.Expires = valueTime.Add(ttl).Format(types.TimeFormat)
+	messageSigner.PublishObjectWithPolicy(latestMessage.Address, latestMessage, nil)
+}
+
+// ForwardOutputLatest publishes the $latest output value of an output whose value is derived from
+// received messages, with the incremented hop count of those messages. See MessageSigner.ForwardObject.
+// not thread-safe, using within a locked section
+//  receivedHops is the highest hop count of the messages the value is derived from
+//  ttl is the lifetime of the value since its timestamp. Use 0 for no expiry.
+//  typed includes the value as a JSON number or boolean. See PublishOutputLatestTyped.
+// Returns messaging.ErrMessageLoop if the max hop count is exceeded
+func ForwardOutputLatest(
+	output *types.OutputDiscoveryMessage,
+	latest *types.OutputValue,
+	receivedHops int,
+	ttl time.Duration,
+	typed bool,
+	messageSigner *messaging.MessageSigner,
+) error {
+	latestMessage := makeOutputLatestMessage(output, latest)
+	if typed {
+		latestMessage.TypedValue = types.TypedValue(output.DataType, latest.Value)
+	}
+	if ttl > 0 {
+		valueTime := GetOutputValueTime(latest)
+		if valueTime.IsZero() {
+			valueTime = messageSigner.Clock().Now()
+		}
+		latestMessage.Expires = valueTime.Add(ttl).Format(types.TimeFormat)
+	}
+	return messageSigner.ForwardObject(latestMessage.Address, latestMessage, receivedHops)
 }
 
 // PublishOutputRaw publishes the raw output $raw (retained)
@@ -71,14 +142,29 @@ func PublishOutputRaw(output *types.OutputDiscoveryMessage, value string, messag
 	}
 	logrus.Infof("PublishOutputRaw: output value '%s' to: %s", s, addr)
 
-	err := messageSigner.PublishSigned(addr, true, value)
+	err := messageSigner.PublishSignedWithPolicy(addr, value)
 	return err
 }
 
 // ReplaceMessageType replace the last segment  with a new message type
 func ReplaceMessageType(addr string, newMessageType types.MessageType) string {
-	segments := strings.Split(addr, "/")
-	segments[len(segments)-1] = string(newMessageType)
-	newAddr := strings.Join(segments, "/")
-	return newAddr
+	return types.MakeMessageAddress(types.MakeBaseAddress(addr), newMessageType)
+}
+
+// makeOutputLatestMessage creates the $latest message of an output value
+func makeOutputLatestMessage(output *types.OutputDiscoveryMessage, latest *types.OutputValue,
+) *types.OutputLatestMessage {
+	// output values are published using their alias address, if any
+	addr := ReplaceMessageType(output.Address, types.MessageTypeLatest)
+	logrus.Infof("PublishOutputLatest to: %s", addr)
+
+	// todo: use output configuration to determine if latest message is published for this output
+	// zone/publisher/node/iotype/instance/$latest
+	latestMessage := &types.OutputLatestMessage{
+		Address:   addr,
+		Timestamp: latest.Timestamp,
+		Unit:      output.Unit,
+		Value:     latest.Value,
+	}
+	return latestMessage
 }
@@ -7,6 +7,24 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// PublishDeletedOutputs removes the retained discovery and value messages of deleted outputs from
+// the message bus
+//  deletedOutputs are the discovery addresses of the deleted outputs, see RegisteredOutputs.GetDeletedOutputs
+func PublishDeletedOutputs(deletedOutputs []string, messageSigner *messaging.MessageSigner) {
+	valueTypes := []types.MessageType{types.MessageTypeLatest, types.MessageTypeHistory,
+		types.MessageTypeRaw, types.MessageTypeForecast}
+	for _, address := range deletedOutputs {
+		logrus.Infof("PublishDeletedOutputs: remove output discovery and values: %s", address)
+		messageSigner.ClearRetained(address)
+		for _, messageType := range valueTypes {
+			valueAddress := ReplaceMessageType(address, messageType)
+			if messageSigner.IsRetained(valueAddress) {
+				messageSigner.ClearRetained(valueAddress)
+			}
+		}
+	}
+}
+
 // PublishRegisteredOutputs publishes output discovery messages
 func PublishRegisteredOutputs(
 	outputs []*types.OutputDiscoveryMessage,
@@ -15,7 +33,7 @@ func PublishRegisteredOutputs(
 	// publish updated output discovery
 	for _, output := range outputs {
 		logrus.Infof("PublishRegisteredOutputs: publish output discovery for: %s", output.Address)
-		messageSigner.PublishObject(output.Address, true, output, nil)
+		messageSigner.PublishObjectWithPolicy(output.Address, output, nil)
 	}
 	// todo: move save output configuration
 	// if len(outputs) > 0 && publisher.cacheFolder != "" {
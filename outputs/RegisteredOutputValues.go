@@ -3,22 +3,61 @@ package outputs
 
 import (
 	"encoding/json"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/iotdomain/iotdomain-go/messaging"
 	"github.com/iotdomain/iotdomain-go/types"
 )
 
+// DefaultMaxHistoryAge is the default max age of values retained in the history of registered outputs
+const DefaultMaxHistoryAge = 24 * time.Hour
+
 // OutputHistory with history values
 type OutputHistory []types.OutputValue
 
+// OutputKey identifies an output of a node by its type and instance
+type OutputKey struct {
+	OutputType types.OutputType
+	Instance   string
+}
+
 // RegisteredOutputValues with values for all registered outputs, stored in the history map.
 type RegisteredOutputValues struct {
+	bytesOutputs   map[string]bool          // outputs with binary values by output ID, see SetBytesOutput
+	clock          messaging.Clock          // clock for value timestamps and history age
 	domain         string                   // the domain of this publisher
 	publisherID    string                   // the registered publisher for the inputs
 	historyMap     map[string]OutputHistory // history lists by output ID
+	reportTime     map[string]time.Time     // time values were last reported by output ID, including unchanged values
+	maxHistoryAge  time.Duration            // max age of values in the history, 0 for unlimited
+	maxHistorySize int                      // max nr of values in the history, 0 for unlimited
 	updateMutex    *sync.Mutex              // mutex for async updating of outputs
 	updatedOutputs map[string]string        // IDs of updated outputs
+
+	compactionPolicy map[string]CompactionPolicy // history compaction policy by output ID, "" for the default
+	compactionStop   chan bool                   // stops the background compaction, nil when not running
+	formats          map[string]*ValueFormat     // publication format of values by output ID, see SetFormat
+	transforms       map[string]ValueTransform   // value transform pipeline by output ID, see SetTransform
+
+	observedRanges      map[string]*observedRange // range of observed values by output ID
+	observedRangeWindow time.Duration             // duration of observed ranges, 0 for all-time
+}
+
+// DeleteOutputValues removes the values of an output with its history, format, transform, compaction
+// policy and observed range. Intended for deleted outputs.
+func (outputValues *RegisteredOutputValues) DeleteOutputValues(outputID string) {
+	outputValues.updateMutex.Lock()
+	defer outputValues.updateMutex.Unlock()
+	delete(outputValues.bytesOutputs, outputID)
+	delete(outputValues.compactionPolicy, outputID)
+	delete(outputValues.formats, outputID)
+	delete(outputValues.historyMap, outputID)
+	delete(outputValues.observedRanges, outputID)
+	delete(outputValues.reportTime, outputID)
+	delete(outputValues.transforms, outputID)
+	delete(outputValues.updatedOutputs, outputID)
 }
 
 // GetHistory returns the history list
@@ -54,6 +93,14 @@ func (outputValues *RegisteredOutputValues) GetOutputValueByType(
 	return outputValues.GetOutputValueByID(outputID)
 }
 
+// GetReportTime returns the time the value of an output was last reported, including reports of
+// unchanged values that aren't added to the history. Returns a zero time if no value was reported.
+func (outputValues *RegisteredOutputValues) GetReportTime(outputID string) time.Time {
+	outputValues.updateMutex.Lock()
+	defer outputValues.updateMutex.Unlock()
+	return outputValues.reportTime[outputID]
+}
+
 // GetUpdatedOutputValues returns a list of output IDs that have updated values
 //  clearUpdates clears the list upon return
 func (outputValues *RegisteredOutputValues) GetUpdatedOutputValues(clearUpdates bool) []string {
@@ -73,6 +120,24 @@ func (outputValues *RegisteredOutputValues) GetUpdatedOutputValues(clearUpdates
 	return idList
 }
 
+// SetClock sets the clock used for value timestamps and the age of values. Intended for testing.
+func (outputValues *RegisteredOutputValues) SetClock(clock messaging.Clock) {
+	outputValues.updateMutex.Lock()
+	defer outputValues.updateMutex.Unlock()
+	outputValues.clock = clock
+}
+
+// SetHistoryLimits sets the max number of values and max age of values retained in the history
+// Older values are removed when a new value is added.
+//  maxHistorySize is the max number of values in the history of an output. Use 0 for unlimited.
+//  maxHistoryAge is the max age of values in the history. Use 0 for unlimited. Default is 24 hours.
+func (outputValues *RegisteredOutputValues) SetHistoryLimits(maxHistorySize int, maxHistoryAge time.Duration) {
+	outputValues.updateMutex.Lock()
+	defer outputValues.updateMutex.Unlock()
+	outputValues.maxHistorySize = maxHistorySize
+	outputValues.maxHistoryAge = maxHistoryAge
+}
+
 // UpdateOutputFloatList adds a list of floats as the output value in the format: "[value1, value2, ...]"
 func (outputValues *RegisteredOutputValues) UpdateOutputFloatList(outputID string, values []float32) bool {
 	valuesAsString, _ := json.Marshal(values)
@@ -92,22 +157,110 @@ func (outputValues *RegisteredOutputValues) UpdateOutputStringList(outputID stri
 }
 
 // UpdateOutputValue adds the new node output value to the front of the history
+// The value is transformed first if the output has a transform, see SetTransform. Numeric values
+// update the observed range of the output, see GetObservedRange.
 // If the node has a repeatDelay configured, then the value is only added if
 //  it has changed, or if the previous update was older than the repeatDelay.
-// The history retains a max of 24 hours
+// The history retains the values within the history limits. The default is 24 hours.
 // returns true if history is updated, false if history has not been updated
 func (outputValues *RegisteredOutputValues) UpdateOutputValue(outputID string, newValue string) bool {
+	outputValues.updateMutex.Lock()
+	defer outputValues.updateMutex.Unlock()
+	return outputValues.updateOutputValue(outputID, newValue)
+}
+
+// UpdateOutputValueAt adds an output value that was measured at the given time to the history.
+// Intended for backfilling readings that were buffered or delayed. The value is inserted in the history
+// in timestamp order, so it only becomes the latest value if it is the most recent. A value with the
+// same timestamp as an existing value replaces it.
+//  timestamp is the time the value was measured
+// returns true if history is updated, false if the value is too old to be retained in the history
+func (outputValues *RegisteredOutputValues) UpdateOutputValueAt(
+	outputID string, newValue string, timestamp time.Time) bool {
+
+	outputValues.updateMutex.Lock()
+	defer outputValues.updateMutex.Unlock()
+
+	// history timestamps have millisecond precision
+	timestamp = timestamp.Truncate(time.Millisecond)
+	isBytes := outputValues.bytesOutputs[outputID]
+	if !isBytes {
+		newValue = outputValues.transforms[outputID].Apply(newValue)
+	}
+	now := outputValues.clock.Now()
+	if outputValues.maxHistoryAge != 0 && now.Sub(timestamp) > outputValues.maxHistoryAge {
+		return false
+	}
+	if timestamp.After(outputValues.reportTime[outputID]) {
+		outputValues.reportTime[outputID] = timestamp
+	}
+	if !isBytes {
+		outputValues.updateObservedRange(outputID, newValue, timestamp)
+	}
+	newEntry := types.OutputValue{
+		Timestamp: timestamp.Format(types.TimeFormat),
+		EpochTime: timestamp.Unix(),
+		Value:     newValue,
+	}
+	history := outputValues.historyMap[outputID]
+	// the history is sorted with the newest value first
+	index := sort.Search(len(history), func(i int) bool {
+		return !GetOutputValueTime(&history[i]).After(timestamp)
+	})
+	if index < len(history) && GetOutputValueTime(&history[index]).Equal(timestamp) {
+		history[index] = newEntry
+	} else {
+		history = append(history, newEntry)
+		copy(history[index+1:], history[index:])
+		history[index] = newEntry
+	}
+	outputValues.historyMap[outputID] = trimHistory(history, now, outputValues.historySize(outputID), outputValues.maxHistoryAge)
+
+	if outputValues.updatedOutputs == nil {
+		outputValues.updatedOutputs = make(map[string]string)
+	}
+	outputValues.updatedOutputs[outputID] = outputID
+	return true
+}
+
+// UpdateOutputValues updates multiple output values of a node in a single locked section
+// All updated values are included in the same set of updates so they are published together.
+// returns the number of outputs whose history has been updated
+func (outputValues *RegisteredOutputValues) UpdateOutputValues(nodeHWID string, values map[OutputKey]string) int {
+	var updateCount = 0
+
+	outputValues.updateMutex.Lock()
+	defer outputValues.updateMutex.Unlock()
+
+	for key, newValue := range values {
+		outputID := MakeOutputID(nodeHWID, key.OutputType, key.Instance)
+		if outputValues.updateOutputValue(outputID, newValue) {
+			updateCount++
+		}
+	}
+	return updateCount
+}
+
+// updateOutputValue adds the new output value to the front of the history
+// This function is not thread-safe and should only be used from within a locked section
+func (outputValues *RegisteredOutputValues) updateOutputValue(outputID string, newValue string) bool {
 	var previous *types.OutputValue
 	var repeatDelay = 3600 // default repeat delay is 1 hour
 	var ageSeconds = -1
 	var hasUpdated = false
 
-	outputValues.updateMutex.Lock()
-	defer outputValues.updateMutex.Unlock()
-
+	isBytes := outputValues.bytesOutputs[outputID]
+	if !isBytes {
+		newValue = outputValues.transforms[outputID].Apply(newValue)
+	}
 	// auto create the output if it hasn't been discovered yet
 	// output := outputvalue.Outputs.GetOutputByAddress(addr)
 	history := outputValues.historyMap[outputID]
+	now := outputValues.clock.Now()
+	outputValues.reportTime[outputID] = now
+	if !isBytes {
+		outputValues.updateObservedRange(outputID, newValue, now.Truncate(time.Millisecond))
+	}
 
 	// only update output if value changes or delay has passed
 	// for now use 1 hour repeat delay. Need to get the config from somewhere
@@ -117,13 +270,12 @@ func (outputValues *RegisteredOutputValues) UpdateOutputValue(outputID string, n
 	if len(history) > 0 {
 		previous = &history[0]
 		prevTime := time.Unix(previous.EpochTime, 0)
-		age := time.Now().Sub(prevTime)
+		age := now.Sub(prevTime)
 		ageSeconds = int(age.Seconds())
 	}
 	doUpdate := ageSeconds < 0 || ageSeconds > repeatDelay || newValue != previous.Value
 	if doUpdate {
-		// 24 hour history
-		newHistory := updateHistory(history, newValue, 0)
+		newHistory := updateHistory(history, newValue, now, outputValues.historySize(outputID), outputValues.maxHistoryAge)
 
 		outputValues.historyMap[outputID] = newHistory
 		hasUpdated = true
@@ -137,16 +289,28 @@ func (outputValues *RegisteredOutputValues) UpdateOutputValue(outputID string, n
 	return hasUpdated
 }
 
+// historySize returns the max nr of values in the history of an output, 0 for unlimited
+// The history of binary outputs only retains the latest value.
+// This function is not thread-safe and should only be used from within a locked section
+func (outputValues *RegisteredOutputValues) historySize(outputID string) int {
+	if outputValues.bytesOutputs[outputID] {
+		return 1
+	}
+	return outputValues.maxHistorySize
+}
+
 // updateHistory inserts a new value at the front of the history
-// The resulting list contains a max of historySize entries limited to 24 hours
+// The resulting list contains a max of historySize entries limited to maxHistoryAge
 // This function is not thread-safe and should only be used from within a locked section
 // history is optional and used to insert the value in the front. If nil then a new history is returned
-// newValue contains the value to include in the history along with the current timestamp
-// maxHistorySize is optional and limits the size in addition to the 24 hour limit
+// newValue contains the value to include in the history along with the timestamp
+// timeStamp is the current time
+// maxHistorySize is optional and limits the size in addition to the age limit
+// maxHistoryAge is optional and limits the age of the oldest entry
 // returns the history list with the new value at the front of the list
-func updateHistory(history OutputHistory, newValue string, maxHistorySize int) OutputHistory {
+func updateHistory(history OutputHistory, newValue string, timeStamp time.Time,
+	maxHistorySize int, maxHistoryAge time.Duration) OutputHistory {
 
-	timeStamp := time.Now()
 	timeStampStr := timeStamp.Format(types.TimeFormat)
 
 	latest := types.OutputValue{
@@ -162,30 +326,45 @@ func updateHistory(history OutputHistory, newValue string, maxHistorySize int) O
 		copy(history[1:], history[0:])
 	}
 	history[0] = latest
+	return trimHistory(history, timeStamp, maxHistorySize, maxHistoryAge)
+}
 
+// trimHistory removes the oldest entries of a history that is sorted with the newest value first
+// maxHistorySize limits the number of entries. Use 0 for unlimited.
+// maxHistoryAge limits the age of the entries relative to the given time. Use 0 for unlimited.
+// The first entry is always retained.
+func trimHistory(history OutputHistory, now time.Time, maxHistorySize int, maxHistoryAge time.Duration) OutputHistory {
 	// remove old entries, determine the max
 	if maxHistorySize == 0 || len(history) < maxHistorySize {
 		maxHistorySize = len(history)
 	}
-	// cap at 24 hours
-	for ; maxHistorySize > 1; maxHistorySize-- {
-		entry := history[maxHistorySize-1]
-		entrytime := time.Unix(entry.EpochTime, 0)
-		if timeStamp.Sub(entrytime) <= time.Hour*24 {
-			break
+	if maxHistoryAge != 0 {
+		for ; maxHistorySize > 1; maxHistorySize-- {
+			entry := history[maxHistorySize-1]
+			entrytime := GetOutputValueTime(&entry)
+			if now.Sub(entrytime) <= maxHistoryAge {
+				break
+			}
 		}
 	}
-	history = history[0:maxHistorySize]
-	return history
+	return history[0:maxHistorySize]
 }
 
 // NewRegisteredOutputValues creates a new instance for output value and history management
 func NewRegisteredOutputValues(domain string, publisherID string) *RegisteredOutputValues {
 	outputs := RegisteredOutputValues{
-		domain:      domain,
-		publisherID: publisherID,
-		historyMap:  make(map[string]OutputHistory),
-		updateMutex: &sync.Mutex{},
+		bytesOutputs:     make(map[string]bool),
+		clock:            messaging.RealClock,
+		domain:           domain,
+		publisherID:      publisherID,
+		historyMap:       make(map[string]OutputHistory),
+		compactionPolicy: make(map[string]CompactionPolicy),
+		formats:          make(map[string]*ValueFormat),
+		maxHistoryAge:    DefaultMaxHistoryAge,
+		observedRanges:   make(map[string]*observedRange),
+		reportTime:       make(map[string]time.Time),
+		transforms:       make(map[string]ValueTransform),
+		updateMutex:      &sync.Mutex{},
 	}
 	return &outputs
 }
@@ -2,7 +2,9 @@ package outputs_test
 
 import (
 	"crypto/ecdsa"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/iotdomain/iotdomain-go/messaging"
 	"github.com/iotdomain/iotdomain-go/outputs"
@@ -58,6 +60,144 @@ func TestCreateOutputValues(t *testing.T) {
 	assert.Equal(t, val3.Value, "[\"a\",\"b\",\"c\"]")
 }
 
+func TestUpdateOutputValues(t *testing.T) {
+	const domain = "test"
+	const publisher1ID = "publisher1"
+	const node1ID = "node1"
+	collection := outputs.NewRegisteredOutputValues(domain, publisher1ID)
+
+	values := map[outputs.OutputKey]string{
+		{OutputType: types.OutputTypeTemperature, Instance: types.DefaultOutputInstance}: "21.5",
+		{OutputType: types.OutputTypeHumidity, Instance: types.DefaultOutputInstance}:    "65",
+	}
+	count := collection.UpdateOutputValues(node1ID, values)
+	assert.Equal(t, 2, count)
+	updates := collection.GetUpdatedOutputValues(true)
+	assert.Equal(t, 2, len(updates))
+
+	val := collection.GetOutputValueByType(node1ID, types.OutputTypeHumidity, types.DefaultOutputInstance)
+	require.NotNil(t, val)
+	assert.Equal(t, "65", val.Value)
+
+	// same values should not update
+	count = collection.UpdateOutputValues(node1ID, values)
+	assert.Equal(t, 0, count)
+}
+
+func TestOutputValuesClock(t *testing.T) {
+	const domain = "test"
+	const publisher1ID = "publisher1"
+	const node1ID = "node1"
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.Local)
+	clock := messaging.NewManualClock(start)
+	collection := outputs.NewRegisteredOutputValues(domain, publisher1ID)
+	collection.SetClock(clock)
+	valueMaxAge := outputs.NewValueMaxAge(time.Hour)
+	valueMaxAge.SetClock(clock)
+	outputID := outputs.MakeOutputID(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance)
+
+	collection.UpdateOutputValue(outputID, "21.5")
+	val := collection.GetOutputValueByID(outputID)
+	require.NotNil(t, val)
+	assert.Equal(t, start.Format(types.TimeFormat), val.Timestamp)
+	assert.Equal(t, start, collection.GetReportTime(outputID))
+	assert.False(t, valueMaxAge.IsStaleTime(types.OutputTypeTemperature, start))
+
+	// an unchanged value is repeated in the history after the repeat delay of an hour
+	clock.Advance(30 * time.Minute)
+	collection.UpdateOutputValue(outputID, "21.5")
+	assert.Equal(t, 1, len(collection.GetHistory(outputID)))
+	clock.Advance(2 * time.Hour)
+	assert.True(t, valueMaxAge.IsStale(types.OutputTypeTemperature, val.Timestamp))
+	collection.UpdateOutputValue(outputID, "21.5")
+	assert.Equal(t, 2, len(collection.GetHistory(outputID)))
+}
+
+func TestHistoryLimits(t *testing.T) {
+	const domain = "test"
+	const publisher1ID = "publisher1"
+	const node1ID = "node1"
+	const maxHistorySize = 1000
+	collection := outputs.NewRegisteredOutputValues(domain, publisher1ID)
+	collection.SetHistoryLimits(maxHistorySize, time.Hour)
+	outputID := outputs.MakeOutputID(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance)
+
+	for i := 0; i < 10000; i++ {
+		collection.UpdateOutputValue(outputID, fmt.Sprint(i))
+	}
+	history := collection.GetHistory(outputID)
+	require.Equal(t, maxHistorySize, len(history))
+	// the oldest values are removed
+	assert.Equal(t, "9999", history[0].Value)
+	assert.Equal(t, "9000", history[maxHistorySize-1].Value)
+	for i := 1; i < len(history); i++ {
+		assert.False(t, outputs.GetOutputValueTime(&history[i]).After(outputs.GetOutputValueTime(&history[i-1])))
+	}
+
+	// domain output history is trimmed by age and size
+	const historyAddr = "test/pub1/node1/temperature/0/$history"
+	now := time.Now()
+	domainHistory := make([]types.OutputValue, 0)
+	for i := 0; i < 10000; i++ {
+		timestamp := now.Add(-time.Duration(i) * time.Minute)
+		domainHistory = append(domainHistory, types.OutputValue{
+			Timestamp: timestamp.Format(types.TimeFormat),
+			Value:     fmt.Sprint(i),
+		})
+	}
+	domainValues := outputs.NewDomainOutputValues(nil)
+	domainValues.SetHistoryLimits(5000, time.Hour+30*time.Second)
+	domainValues.UpdateHistory(&types.OutputHistoryMessage{Address: historyAddr, History: domainHistory})
+	trimmed := domainValues.GetHistory(historyAddr, time.Time{}, time.Time{})
+	assert.Equal(t, 61, len(trimmed))
+	assert.Equal(t, "0", trimmed[0].Value)
+	assert.Equal(t, "60", trimmed[len(trimmed)-1].Value)
+
+	domainValues.SetHistoryLimits(500, 0)
+	domainValues.UpdateHistory(&types.OutputHistoryMessage{Address: historyAddr, History: domainHistory})
+	trimmed = domainValues.GetHistory(historyAddr, time.Time{}, time.Time{})
+	assert.Equal(t, 500, len(trimmed))
+	assert.Equal(t, 10000, len(domainHistory), "Trimming must not modify the provided history")
+}
+
+func TestUpdateOutputValueAt(t *testing.T) {
+	const domain = "test"
+	const publisher1ID = "publisher1"
+	const node1ID = "node1"
+	collection := outputs.NewRegisteredOutputValues(domain, publisher1ID)
+	outputID := outputs.MakeOutputID(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance)
+	now := time.Now()
+
+	// backfill readings out of order
+	assert.True(t, collection.UpdateOutputValueAt(outputID, "2", now.Add(-2*time.Minute)))
+	assert.True(t, collection.UpdateOutputValueAt(outputID, "4", now.Add(-4*time.Minute)))
+	assert.True(t, collection.UpdateOutputValueAt(outputID, "1", now.Add(-1*time.Minute)))
+	assert.True(t, collection.UpdateOutputValueAt(outputID, "3", now.Add(-3*time.Minute)))
+	history := collection.GetHistory(outputID)
+	require.Equal(t, 4, len(history))
+	for i, value := range history {
+		assert.Equal(t, fmt.Sprint(i+1), value.Value)
+	}
+	assert.Equal(t, now.Add(-3*time.Minute).Format(types.TimeFormat), history[2].Timestamp)
+	assert.Equal(t, "1", collection.GetOutputValueByID(outputID).Value)
+	updated := collection.GetUpdatedOutputValues(true)
+	assert.Equal(t, 1, len(updated))
+
+	// same timestamp replaces the value
+	assert.True(t, collection.UpdateOutputValueAt(outputID, "3b", now.Add(-3*time.Minute)))
+	history = collection.GetHistory(outputID)
+	require.Equal(t, 4, len(history))
+	assert.Equal(t, "3b", history[2].Value)
+
+	// a current value goes to the front
+	collection.UpdateOutputValue(outputID, "0")
+	assert.Equal(t, "0", collection.GetOutputValueByID(outputID).Value)
+
+	// values older than the max history age are not retained
+	assert.False(t, collection.UpdateOutputValueAt(outputID, "old", now.Add(-outputs.DefaultMaxHistoryAge-time.Minute)))
+	assert.Equal(t, 5, len(collection.GetHistory(outputID)))
+}
+
 func TestPublishOutputValues(t *testing.T) {
 	const domain = "test"
 	const publisher1ID = "publisher1"
@@ -2,15 +2,19 @@
 package outputs
 
 import (
+	"sort"
+	"strconv"
 	"sync"
-	"time"
 
+	"github.com/iotdomain/iotdomain-go/messaging"
 	"github.com/iotdomain/iotdomain-go/types"
 )
 
 // RegisteredOutputs manages registration of publisher outputs
 type RegisteredOutputs struct {
+	clock            messaging.Clock                          // clock for output timestamps
 	addressMap       map[string]string                        // lookup outputID by output publication address
+	deletedOutputs   map[string]bool                          // addresses of deleted outputs to remove from the message bus
 	domain           string                                   // the domain of this publisher
 	publisherID      string                                   // the registered publisher for the inputs
 	outputsByID      map[string]*types.OutputDiscoveryMessage // lookup output by output ID
@@ -22,14 +26,30 @@ type RegisteredOutputs struct {
 func (regOutputs *RegisteredOutputs) CreateOutput(
 	hwID string, outputType types.OutputType, instance string) *types.OutputDiscoveryMessage {
 
-	output := NewOutput(regOutputs.domain, regOutputs.publisherID, hwID, outputType, instance)
-
 	regOutputs.updateMutex.Lock()
 	defer regOutputs.updateMutex.Unlock()
+	output := newOutput(regOutputs.domain, regOutputs.publisherID, hwID, outputType, instance, regOutputs.clock)
 	regOutputs.updateOutput(output)
 	return output
 }
 
+// DeleteOutput unregisters an output. The output is removed from the message bus on the next
+// publication of updates, see GetDeletedOutputs.
+//  outputID is the output's ID based on the node HWID, see MakeOutputID
+func (regOutputs *RegisteredOutputs) DeleteOutput(outputID string) {
+	regOutputs.updateMutex.Lock()
+	defer regOutputs.updateMutex.Unlock()
+
+	output := regOutputs.outputsByID[outputID]
+	if output == nil {
+		return
+	}
+	delete(regOutputs.addressMap, output.Address)
+	delete(regOutputs.outputsByID, outputID)
+	delete(regOutputs.updatedOutputIDs, outputID)
+	regOutputs.deletedOutputs[output.Address] = true
+}
+
 // GetAllOutputs returns the list of outputs
 func (regOutputs *RegisteredOutputs) GetAllOutputs() []*types.OutputDiscoveryMessage {
 	regOutputs.updateMutex.Lock()
@@ -53,6 +73,30 @@ func (regOutputs *RegisteredOutputs) GetOutputByAddress(outputAddr string) *type
 	return output
 }
 
+// GetOutputInstances returns the instances of the outputs of a node with the given output type, eg
+// the channels of a relay board. Numeric instances are sorted by number, others alphabetically.
+// Returns an empty list if the node has no outputs of the type
+func (regOutputs *RegisteredOutputs) GetOutputInstances(nodeHWID string, outputType types.OutputType) []string {
+	instances := make([]string, 0)
+	regOutputs.updateMutex.Lock()
+	for _, output := range regOutputs.outputsByID {
+		if output.NodeHWID == nodeHWID && output.OutputType == outputType {
+			instances = append(instances, output.Instance)
+		}
+	}
+	regOutputs.updateMutex.Unlock()
+
+	sort.Slice(instances, func(i, j int) bool {
+		number1, err1 := strconv.Atoi(instances[i])
+		number2, err2 := strconv.Atoi(instances[j])
+		if err1 == nil && err2 == nil {
+			return number1 < number2
+		}
+		return instances[i] < instances[j]
+	})
+	return instances
+}
+
 // GetOutputsByNodeHWID returns a list of all outputs of a given device
 func (regOutputs *RegisteredOutputs) GetOutputsByNodeHWID(hwID string) []*types.OutputDiscoveryMessage {
 	outputList := make([]*types.OutputDiscoveryMessage, 0)
@@ -85,6 +129,23 @@ func (regOutputs *RegisteredOutputs) GetOutputByID(outputID string) *types.Outpu
 	return output
 }
 
+// GetDeletedOutputs returns the addresses of outputs that have been deleted, sorted
+// clearDeletions clears the list of deletions. Intended for removing deleted outputs from the message bus.
+func (regOutputs *RegisteredOutputs) GetDeletedOutputs(clearDeletions bool) []string {
+	regOutputs.updateMutex.Lock()
+	defer regOutputs.updateMutex.Unlock()
+
+	deleteList := make([]string, 0, len(regOutputs.deletedOutputs))
+	for address := range regOutputs.deletedOutputs {
+		deleteList = append(deleteList, address)
+	}
+	sort.Strings(deleteList)
+	if clearDeletions {
+		regOutputs.deletedOutputs = make(map[string]bool)
+	}
+	return deleteList
+}
+
 // GetUpdatedOutputs returns the list of discovered outputs that have been updated
 // clear the update on return
 func (regOutputs *RegisteredOutputs) GetUpdatedOutputs(clearUpdates bool) []*types.OutputDiscoveryMessage {
@@ -106,6 +167,13 @@ func (regOutputs *RegisteredOutputs) GetUpdatedOutputs(clearUpdates bool) []*typ
 	return updateList
 }
 
+// SetClock sets the clock used for output timestamps. Intended for testing.
+func (regOutputs *RegisteredOutputs) SetClock(clock messaging.Clock) {
+	regOutputs.updateMutex.Lock()
+	defer regOutputs.updateMutex.Unlock()
+	regOutputs.clock = clock
+}
+
 // SetNodeID updates the address of all outputs with the given node hardware address
 func (regOutputs *RegisteredOutputs) SetNodeID(nodeHWID string, alias string) {
 	outputList := regOutputs.GetOutputsByNodeHWID(nodeHWID)
@@ -139,8 +207,10 @@ func (regOutputs *RegisteredOutputs) updateOutput(output *types.OutputDiscoveryM
 	if regOutputs.updatedOutputIDs == nil {
 		regOutputs.updatedOutputIDs = make(map[string]string)
 	}
-	output.Timestamp = time.Now().Format(types.TimeFormat)
+	output.Timestamp = regOutputs.clock.Now().Format(types.TimeFormat)
 	regOutputs.updatedOutputIDs[output.OutputID] = output.OutputID
+	// an output that is recreated before its deletion is published replaces the deletion
+	delete(regOutputs.deletedOutputs, output.Address)
 }
 
 // MakeOutputID creates the internal ID to identify the output of the owning node
@@ -152,14 +222,21 @@ func MakeOutputID(nodeHWID string, outputType types.OutputType, instance string)
 // NewOutput creates a new output for the given device .
 // It is not immediately added to allow for further updates of the ouput definition.
 // To add it to the list use 'UpdateOutput'
+// The datatype and unit default to those of the output type, if known.
 func NewOutput(domain string, publisherID string, nodeHWID string, outputType types.OutputType, instance string) *types.OutputDiscoveryMessage {
+	return newOutput(domain, publisherID, nodeHWID, outputType, instance, messaging.RealClock)
+}
+
+// newOutput creates a new output with a timestamp from the given clock
+func newOutput(domain string, publisherID string, nodeHWID string, outputType types.OutputType, instance string,
+	clock messaging.Clock) *types.OutputDiscoveryMessage {
 	address := MakeOutputDiscoveryAddress(domain, publisherID, nodeHWID, outputType, instance)
 
 	outputID := MakeOutputID(nodeHWID, outputType, instance)
 
 	output := &types.OutputDiscoveryMessage{
 		Address:   address,
-		Timestamp: time.Now().Format(types.TimeFormat),
+		Timestamp: clock.Now().Format(types.TimeFormat),
 		// internal use only
 		NodeHWID:    nodeHWID,
 		Instance:    instance,
@@ -167,17 +244,24 @@ func NewOutput(domain string, publisherID string, nodeHWID string, outputType ty
 		OutputType:  outputType,
 		PublisherID: publisherID,
 	}
+	// default the datatype and unit from the output type
+	if info, found := types.GetOutputTypeInfo(outputType); found {
+		output.DataType = info.DataType
+		output.Unit = info.DefaultUnit
+	}
 	return output
 }
 
 // NewRegisteredOutputs creates a new instance for registered output management
 func NewRegisteredOutputs(domain string, publisherID string) *RegisteredOutputs {
 	regOutputs := RegisteredOutputs{
-		domain:      domain,
-		publisherID: publisherID,
-		addressMap:  make(map[string]string),
-		outputsByID: make(map[string]*types.OutputDiscoveryMessage),
-		updateMutex: &sync.Mutex{},
+		clock:          messaging.RealClock,
+		domain:         domain,
+		publisherID:    publisherID,
+		addressMap:     make(map[string]string),
+		deletedOutputs: make(map[string]bool),
+		outputsByID:    make(map[string]*types.OutputDiscoveryMessage),
+		updateMutex:    &sync.Mutex{},
 	}
 	return &regOutputs
 }
@@ -45,6 +45,33 @@ func TestCreateOutputs(t *testing.T) {
 	nodeOuts := collection.GetOutputsByNodeHWID(node1ID)
 	assert.Equal(t, 1, len(nodeOuts), "Expected 1 output")
 
+	// delete output
+	collection.DeleteOutput(output.OutputID)
+	assert.Nil(t, collection.GetOutputByAddress(node1Output1Addr))
+	assert.Equal(t, 0, len(collection.GetOutputsByNodeHWID(node1ID)))
+	assert.Equal(t, []string{node1Output1Addr}, collection.GetDeletedOutputs(true))
+	assert.Empty(t, collection.GetDeletedOutputs(false))
+}
+
+func TestOutputTypeDefaults(t *testing.T) {
+	const domain = "test"
+	const publisher1ID = "publisher1"
+	const node1ID = "node1"
+
+	output := outputs.NewOutput(domain, publisher1ID, node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance)
+	assert.Equal(t, types.DataTypeNumber, output.DataType)
+	assert.Equal(t, types.UnitCelcius, output.Unit)
+
+	info, found := types.GetOutputTypeInfo(types.OutputTypeSwitch)
+	assert.True(t, found)
+	assert.Equal(t, types.DataTypeBool, info.DataType)
+
+	// unknown output types are left empty
+	output = outputs.NewOutput(domain, publisher1ID, node1ID, "custom", types.DefaultOutputInstance)
+	assert.Equal(t, types.DataType(""), output.DataType)
+	assert.Equal(t, types.UnitNone, output.Unit)
+	_, found = types.GetOutputTypeInfo("custom")
+	assert.False(t, found)
 }
 
 func TestUpdateOutputs(t *testing.T) {
@@ -107,3 +134,18 @@ func TestPublishOutputs(t *testing.T) {
 
 	outputs.PublishRegisteredOutputs(allOutputs, signer)
 }
+
+func TestGetOutputInstances(t *testing.T) {
+	const node1ID = "node1"
+	collection := outputs.NewRegisteredOutputs("test", "publisher1")
+	for _, instance := range []string{"10", "2", "1", "aux"} {
+		collection.CreateOutput(node1ID, types.OutputTypeSwitch, instance)
+	}
+	collection.CreateOutput(node1ID, types.OutputTypeTemperature, "3")
+	collection.CreateOutput("node2", types.OutputTypeSwitch, "4")
+
+	instances := collection.GetOutputInstances(node1ID, types.OutputTypeSwitch)
+	assert.Equal(t, []string{"1", "2", "10", "aux"}, instances)
+	instances = collection.GetOutputInstances(node1ID, types.OutputTypeHumidity)
+	assert.Empty(t, instances)
+}
@@ -0,0 +1,104 @@
+// Package outputs with resampling of output history into fixed intervals
+package outputs
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/types"
+)
+
+// Resample is the method of combining the history values within an interval
+type Resample string
+
+// Available resample methods
+const (
+	ResampleLast Resample = "last" // the most recent value in the interval
+	ResampleMax  Resample = "max"  // the highest value in the interval
+	ResampleMean Resample = "mean" // the average of the values in the interval
+)
+
+// ResampleHistory buckets the history values of an output into fixed intervals, eg for charting.
+// Intervals are aligned to multiples of the interval duration. The result contains an entry for each
+// interval from the oldest to the newest value, sorted with the most recent interval first like the history.
+// The timestamp of an entry is the start of its interval.
+// Values that are not numeric are ignored. Intervals without numeric values have an empty value,
+// representing a gap.
+//  historyAddress is the address of the output history
+//  interval is the duration of an interval. Must be larger than 0
+//  method is the method used to combine the values of an interval. Default is ResampleLast
+// Returns an empty list if there is no history or the interval is invalid
+func (dov *DomainOutputValues) ResampleHistory(
+	historyAddress string, interval time.Duration, method Resample) []types.OutputValue {
+
+	resampled := make([]types.OutputValue, 0)
+	if interval <= 0 {
+		return resampled
+	}
+	type bucket struct {
+		count    int
+		last     float64
+		lastTime time.Time
+		max      float64
+		sum      float64
+	}
+	buckets := make(map[int64]*bucket)
+	var first, last int64
+	history := dov.GetHistory(historyAddress, time.Time{}, time.Time{})
+	for _, value := range history {
+		timestamp := GetOutputValueTime(&value)
+		if timestamp.IsZero() {
+			continue
+		}
+		index := timestamp.UnixNano() / int64(interval)
+		if len(buckets) == 0 || index < first {
+			first = index
+		}
+		if len(buckets) == 0 || index > last {
+			last = index
+		}
+		b := buckets[index]
+		if b == nil {
+			b = &bucket{}
+			buckets[index] = b
+		}
+		number, err := strconv.ParseFloat(value.Value, 64)
+		if err != nil {
+			continue
+		}
+		if b.count == 0 || number > b.max {
+			b.max = number
+		}
+		if b.count == 0 || timestamp.After(b.lastTime) {
+			b.last = number
+			b.lastTime = timestamp
+		}
+		b.sum += number
+		b.count++
+	}
+	if len(buckets) == 0 {
+		return resampled
+	}
+	for index := last; index >= first; index-- {
+		startTime := time.Unix(0, index*int64(interval))
+		entry := types.OutputValue{
+			Timestamp: startTime.Format(types.TimeFormat),
+			EpochTime: startTime.Unix(),
+		}
+		b := buckets[index]
+		if b != nil && b.count > 0 {
+			var number float64
+			switch method {
+			case ResampleMax:
+				number = b.max
+			case ResampleMean:
+				number = b.sum / float64(b.count)
+			default:
+				number = b.last
+			}
+			entry.Value = strconv.FormatFloat(number, 'f', -1, 64)
+		}
+		resampled = append(resampled, entry)
+	}
+	return resampled
+}
@@ -0,0 +1,60 @@
+package outputs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/outputs"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResampleHistory(t *testing.T) {
+	const historyAddr = "test/pub1/node1/temperature/0/$history"
+	start := time.Now().Truncate(time.Hour).Add(-time.Hour)
+	makeValue := func(offset time.Duration, value string) types.OutputValue {
+		timestamp := start.Add(offset)
+		return types.OutputValue{
+			Timestamp: timestamp.Format(types.TimeFormat),
+			EpochTime: timestamp.Unix(),
+			Value:     value,
+		}
+	}
+	// most recent value first, in 10 minute intervals: [1,3], [not a number], [], [4,2]
+	history := []types.OutputValue{
+		makeValue(32*time.Minute, "2"),
+		makeValue(31*time.Minute, "4"),
+		makeValue(12*time.Minute, "not a number"),
+		makeValue(5*time.Minute, "3"),
+		makeValue(1*time.Minute, "1"),
+	}
+	collection := outputs.NewDomainOutputValues(nil)
+	collection.UpdateHistory(&types.OutputHistoryMessage{Address: historyAddr, History: history})
+
+	resampled := collection.ResampleHistory(historyAddr, 10*time.Minute, outputs.ResampleLast)
+	require.Equal(t, 4, len(resampled))
+	assert.Equal(t, start.Add(30*time.Minute).Format(types.TimeFormat), resampled[0].Timestamp)
+	assert.Equal(t, "2", resampled[0].Value)
+	assert.Equal(t, "", resampled[1].Value, "Expected a gap for an interval without values")
+	assert.Equal(t, "", resampled[2].Value, "Expected a gap for non numeric values")
+	assert.Equal(t, "3", resampled[3].Value)
+	assert.Equal(t, start.Unix(), resampled[3].EpochTime)
+
+	resampled = collection.ResampleHistory(historyAddr, 10*time.Minute, outputs.ResampleMax)
+	require.Equal(t, 4, len(resampled))
+	assert.Equal(t, "4", resampled[0].Value)
+	assert.Equal(t, "3", resampled[3].Value)
+
+	resampled = collection.ResampleHistory(historyAddr, 10*time.Minute, outputs.ResampleMean)
+	require.Equal(t, 4, len(resampled))
+	assert.Equal(t, "3", resampled[0].Value)
+	assert.Equal(t, "2", resampled[3].Value)
+
+	// the stored history is unchanged
+	assert.Equal(t, 5, len(collection.GetHistory(historyAddr, time.Time{}, time.Time{})))
+
+	// error cases
+	assert.Equal(t, 0, len(collection.ResampleHistory(historyAddr, 0, outputs.ResampleLast)))
+	assert.Equal(t, 0, len(collection.ResampleHistory("unknown", time.Minute, outputs.ResampleLast)))
+}
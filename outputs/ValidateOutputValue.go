@@ -0,0 +1,30 @@
+// Package outputs with validation of output values
+package outputs
+
+import (
+	"github.com/iotdomain/iotdomain-go/lib"
+	"github.com/iotdomain/iotdomain-go/types"
+)
+
+// ValidateOutputValue checks if a value matches the output's declared data type
+// See types.ValidateValue for the validation rules. In addition, bytes must be base64 encoded
+// and not exceed MaxBytesValueSize.
+// Returns an error if the value is invalid
+func ValidateOutputValue(output *types.OutputDiscoveryMessage, value string) error {
+	if output.DataType == types.DataTypeBytes {
+		data, err := DecodeBytesValue(value)
+		if err != nil {
+			return lib.MakeErrorf("ValidateOutputValue: Output '%s' value is not a valid %s", output.Address, output.DataType)
+		}
+		if len(data) > MaxBytesValueSize {
+			return lib.MakeErrorf("ValidateOutputValue: Output '%s' value of %d bytes exceeds the max of %d. Use PublishRaw instead.",
+				output.Address, len(data), MaxBytesValueSize)
+		}
+		return nil
+	}
+	err := types.ValidateValue(output.DataType, value, output.Min, output.Max, output.EnumValues)
+	if err != nil {
+		return lib.MakeErrorf("ValidateOutputValue: Output '%s': %s", output.Address, err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package outputs_test
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/outputs"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateOutputValue(t *testing.T) {
+	output := &types.OutputDiscoveryMessage{
+		Address:  "test/publisher1/node1/temperature/0/$output",
+		DataType: types.DataTypeNumber,
+		Min:      -10,
+		Max:      40,
+	}
+	// numbers must be finite and within the range
+	assert.NoError(t, outputs.ValidateOutputValue(output, "21.5"))
+	assert.NoError(t, outputs.ValidateOutputValue(output, "-10"))
+	assert.NoError(t, outputs.ValidateOutputValue(output, "40"))
+	assert.Error(t, outputs.ValidateOutputValue(output, "40.1"))
+	assert.Error(t, outputs.ValidateOutputValue(output, "-11"))
+	assert.Error(t, outputs.ValidateOutputValue(output, "NaN"))
+	assert.Error(t, outputs.ValidateOutputValue(output, "+Inf"))
+	assert.Error(t, outputs.ValidateOutputValue(output, "warm"))
+	assert.Error(t, outputs.ValidateOutputValue(output, ""))
+
+	// without a range any finite number is valid
+	output.Min, output.Max = 0, 0
+	assert.NoError(t, outputs.ValidateOutputValue(output, "1000"))
+	assert.Error(t, outputs.ValidateOutputValue(output, "NaN"))
+
+	output.DataType = types.DataTypeInt
+	assert.NoError(t, outputs.ValidateOutputValue(output, "42"))
+	assert.Error(t, outputs.ValidateOutputValue(output, "4.2"))
+
+	output.DataType = types.DataTypeBool
+	assert.NoError(t, outputs.ValidateOutputValue(output, "true"))
+	assert.Error(t, outputs.ValidateOutputValue(output, "maybe"))
+
+	output.DataType = types.DataTypeEnum
+	output.EnumValues = []string{"red", "green"}
+	assert.NoError(t, outputs.ValidateOutputValue(output, "green"))
+	assert.Error(t, outputs.ValidateOutputValue(output, "blue"))
+
+	output.DataType = types.DataTypeJSON
+	assert.NoError(t, outputs.ValidateOutputValue(output, `{"a":1}`))
+	assert.Error(t, outputs.ValidateOutputValue(output, `{"a":`))
+
+	// strings are not validated
+	output.DataType = types.DataTypeString
+	assert.NoError(t, outputs.ValidateOutputValue(output, "NaN"))
+
+	// bytes must be base64 encoded and not exceed the max size
+	output.DataType = types.DataTypeBytes
+	encoded, err := outputs.EncodeBytesValue(make([]byte, outputs.MaxBytesValueSize))
+	require.NoError(t, err)
+	assert.NoError(t, outputs.ValidateOutputValue(output, encoded))
+	assert.Error(t, outputs.ValidateOutputValue(output, "not base64!"))
+	encoded = base64.StdEncoding.EncodeToString(make([]byte, outputs.MaxBytesValueSize+1))
+	assert.Error(t, outputs.ValidateOutputValue(output, encoded))
+}
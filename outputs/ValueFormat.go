@@ -0,0 +1,154 @@
+// Package outputs with formatting of numeric output values for publication
+package outputs
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/iotdomain/iotdomain-go/types"
+)
+
+// Rounding method of formatted values
+type Rounding string
+
+// Available rounding methods
+const (
+	RoundHalfUp   Rounding = ""         // round half away from zero, eg 2.345 to 2.35. This is the default
+	RoundHalfEven Rounding = "halfEven" // round half to the nearest even digit, eg 2.345 to 2.34
+	RoundDown     Rounding = "down"     // truncate towards zero, eg 2.349 to 2.34
+)
+
+// ValueFormat describes how numeric values of an output are formatted on publication, so values
+// are consistent across the domain regardless of the string the adapter produced.
+// Formatted values never contain thousands separators and use '.' as decimal separator, so they
+// remain parseable as a number by consumers.
+type ValueFormat struct {
+	Decimals int      `yaml:"decimals"` // nr of decimals to publish, eg 2 for "23.46"
+	Rounding Rounding `yaml:"rounding"` // rounding of the last decimal, default is RoundHalfUp
+}
+
+// FormatOutputValue formats a numeric value with a fixed number of decimals, eg "23.456789"
+// becomes "23.46" with 2 decimals. Values that are not numeric are returned unchanged.
+func FormatOutputValue(value string, format ValueFormat) string {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsInf(number, 0) || math.IsNaN(number) {
+		return value
+	}
+	return roundDecimals(number, format.Decimals, format.Rounding)
+}
+
+// roundDecimals rounds a number to a fixed number of decimals and returns it as a string.
+// Rounding is done on the shortest decimal representation of the number, so 2.345 rounds to 2.35
+// with RoundHalfUp even though its binary value is slightly less than 2.345.
+func roundDecimals(number float64, decimals int, rounding Rounding) string {
+	if math.IsInf(number, 0) || math.IsNaN(number) {
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	if decimals < 0 {
+		decimals = 0
+	}
+	digits := strconv.FormatFloat(math.Abs(number), 'f', -1, 64)
+	intPart, fracPart := digits, ""
+	if dot := strings.IndexByte(digits, '.'); dot >= 0 {
+		intPart, fracPart = digits[:dot], digits[dot+1:]
+	}
+	if len(fracPart) < decimals {
+		fracPart += strings.Repeat("0", decimals-len(fracPart))
+	}
+	kept := []byte(intPart + fracPart[:decimals])
+	rest := fracPart[decimals:]
+	roundUp := false
+	if len(rest) > 0 {
+		switch rounding {
+		case RoundDown:
+		case RoundHalfEven:
+			beyondHalf := strings.TrimRight(rest[1:], "0") != ""
+			isOdd := (kept[len(kept)-1]-'0')%2 == 1
+			roundUp = rest[0] > '5' || (rest[0] == '5' && (beyondHalf || isOdd))
+		default:
+			roundUp = rest[0] >= '5'
+		}
+	}
+	if roundUp {
+		index := len(kept) - 1
+		for ; index >= 0 && kept[index] == '9'; index-- {
+			kept[index] = '0'
+		}
+		if index < 0 {
+			kept = append([]byte{'1'}, kept...)
+		} else {
+			kept[index]++
+		}
+	}
+	formatted := string(kept)
+	if decimals > 0 {
+		split := len(formatted) - decimals
+		formatted = formatted[:split] + "." + formatted[split:]
+	}
+	// avoid publishing a negative zero, eg "-0.00"
+	if number < 0 && strings.Trim(formatted, "0.") != "" {
+		formatted = "-" + formatted
+	}
+	return formatted
+}
+
+// FormatHistory returns a copy of the history of an output with its values formatted for
+// publication, or the history itself if the output has no format. See SetFormat.
+func (outputValues *RegisteredOutputValues) FormatHistory(outputID string, history OutputHistory) OutputHistory {
+	format := outputValues.getPublishFormat(outputID)
+	if format == nil {
+		return history
+	}
+	formatted := make(OutputHistory, len(history))
+	for index, value := range history {
+		value.Value = FormatOutputValue(value.Value, *format)
+		formatted[index] = value
+	}
+	return formatted
+}
+
+// FormatValue returns a copy of an output value formatted for publication, or the value itself
+// if the output has no format. See SetFormat.
+func (outputValues *RegisteredOutputValues) FormatValue(outputID string, value *types.OutputValue) *types.OutputValue {
+	format := outputValues.getPublishFormat(outputID)
+	if format == nil || value == nil {
+		return value
+	}
+	formatted := *value
+	formatted.Value = FormatOutputValue(value.Value, *format)
+	return &formatted
+}
+
+// GetFormat returns the publication format of an output, or nil if the output has no format
+func (outputValues *RegisteredOutputValues) GetFormat(outputID string) *ValueFormat {
+	outputValues.updateMutex.Lock()
+	defer outputValues.updateMutex.Unlock()
+	return outputValues.formats[outputID]
+}
+
+// getPublishFormat returns the format to publish the values of an output with, or nil if the
+// values are published as they are. Binary values are never formatted.
+func (outputValues *RegisteredOutputValues) getPublishFormat(outputID string) *ValueFormat {
+	outputValues.updateMutex.Lock()
+	defer outputValues.updateMutex.Unlock()
+	if outputValues.bytesOutputs[outputID] {
+		return nil
+	}
+	return outputValues.formats[outputID]
+}
+
+// SetFormat sets the format of numeric values of an output on publication. The values in the
+// history are not changed.
+//  outputID is the output whose values to format
+//  format to apply. Use nil to publish the values as they are.
+func (outputValues *RegisteredOutputValues) SetFormat(outputID string, format *ValueFormat) {
+	outputValues.updateMutex.Lock()
+	defer outputValues.updateMutex.Unlock()
+	if format == nil {
+		delete(outputValues.formats, outputID)
+		return
+	}
+	formatCopy := *format
+	outputValues.formats[outputID] = &formatCopy
+}
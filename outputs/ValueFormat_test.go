@@ -0,0 +1,83 @@
+package outputs_test
+
+import (
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/outputs"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatOutputValue(t *testing.T) {
+	twoDecimals := outputs.ValueFormat{Decimals: 2}
+	assert.Equal(t, "23.46", outputs.FormatOutputValue("23.456789", twoDecimals))
+	assert.Equal(t, "23.00", outputs.FormatOutputValue("23", twoDecimals))
+	assert.Equal(t, "1234567.00", outputs.FormatOutputValue("1234567", twoDecimals), "no thousands separator")
+	assert.Equal(t, "-1.24", outputs.FormatOutputValue("-1.235", twoDecimals))
+	assert.Equal(t, "0.00", outputs.FormatOutputValue("-0.001", twoDecimals), "no negative zero")
+	assert.Equal(t, "24", outputs.FormatOutputValue("23.5", outputs.ValueFormat{}))
+	assert.Equal(t, "on", outputs.FormatOutputValue("on", twoDecimals), "non-numeric values must pass unchanged")
+	assert.Equal(t, "NaN", outputs.FormatOutputValue("NaN", twoDecimals))
+
+	assert.Equal(t, "2", outputs.FormatOutputValue("2.5", outputs.ValueFormat{Rounding: outputs.RoundHalfEven}))
+	assert.Equal(t, "2.34", outputs.FormatOutputValue("2.349",
+		outputs.ValueFormat{Decimals: 2, Rounding: outputs.RoundDown}))
+}
+
+func TestFormatOutputValueRounding(t *testing.T) {
+	// values whose binary representation is just below or above the decimal value must round
+	// as their decimal value
+	tests := []struct {
+		value    string
+		decimals int
+		rounding outputs.Rounding
+		expected string
+	}{
+		{"2.345", 2, outputs.RoundHalfUp, "2.35"},
+		{"2.345", 2, outputs.RoundHalfEven, "2.34"},
+		{"2.355", 2, outputs.RoundHalfEven, "2.36"},
+		{"2.3451", 2, outputs.RoundHalfEven, "2.35"},
+		{"1.005", 2, outputs.RoundHalfUp, "1.01"},
+		{"1.005", 2, outputs.RoundHalfEven, "1.00"},
+		{"0.125", 2, outputs.RoundHalfUp, "0.13"},
+		{"0.125", 2, outputs.RoundHalfEven, "0.12"},
+		{"0.125", 2, outputs.RoundDown, "0.12"},
+		{"-0.125", 2, outputs.RoundHalfUp, "-0.13"},
+		{"9.995", 2, outputs.RoundHalfUp, "10.00"},
+		{"-9.5", 0, outputs.RoundHalfUp, "-10"},
+		{"1e3", 1, outputs.RoundHalfUp, "1000.0"},
+		{"-0.004", 2, outputs.RoundHalfEven, "0.00"},
+		{"12.5", -1, outputs.RoundHalfEven, "12"},
+	}
+	for _, test := range tests {
+		format := outputs.ValueFormat{Decimals: test.decimals, Rounding: test.rounding}
+		assert.Equal(t, test.expected, outputs.FormatOutputValue(test.value, format),
+			"value %s with %d decimals and rounding '%s'", test.value, test.decimals, test.rounding)
+	}
+}
+
+func TestOutputValueFormat(t *testing.T) {
+	const domain = "test"
+	const publisher1ID = "publisher1"
+	const node1ID = "node1"
+	collection := outputs.NewRegisteredOutputValues(domain, publisher1ID)
+	outputID := outputs.MakeOutputID(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance)
+	collection.UpdateOutputValue(outputID, "23.456789")
+	assert.Nil(t, collection.GetFormat(outputID))
+	latest := collection.GetOutputValueByID(outputID)
+	assert.Equal(t, latest, collection.FormatValue(outputID, latest))
+
+	// formatting applies to the published copy, not to the stored value
+	collection.SetFormat(outputID, &outputs.ValueFormat{Decimals: 1})
+	require.NotNil(t, collection.GetFormat(outputID))
+	assert.Equal(t, "23.5", collection.FormatValue(outputID, latest).Value)
+	assert.Equal(t, "23.456789", collection.GetOutputValueByID(outputID).Value)
+	history := collection.FormatHistory(outputID, collection.GetHistory(outputID))
+	require.Equal(t, 1, len(history))
+	assert.Equal(t, "23.5", history[0].Value)
+	assert.Equal(t, "23.456789", collection.GetHistory(outputID)[0].Value)
+
+	collection.SetFormat(outputID, nil)
+	assert.Nil(t, collection.GetFormat(outputID))
+}
@@ -0,0 +1,82 @@
+// Package outputs with staleness detection of output values
+package outputs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/types"
+)
+
+// ValueMaxAge holds the max age of output values by output type. Values that are older than
+// the max age of their output type are stale, eg because a sensor stopped reporting.
+type ValueMaxAge struct {
+	clock         messaging.Clock                    // clock to determine the age of values
+	defaultMaxAge time.Duration                      // max age of output types without their own max age, 0 for no max
+	maxAge        map[types.OutputType]time.Duration // max age by output type
+	updateMutex   *sync.RWMutex                      // mutex for concurrent updates
+}
+
+// GetMaxAge returns the max age of values of the output type, or 0 if values never become stale
+func (valueMaxAge *ValueMaxAge) GetMaxAge(outputType types.OutputType) time.Duration {
+	valueMaxAge.updateMutex.RLock()
+	defer valueMaxAge.updateMutex.RUnlock()
+	maxAge, found := valueMaxAge.maxAge[outputType]
+	if !found {
+		maxAge = valueMaxAge.defaultMaxAge
+	}
+	return maxAge
+}
+
+// IsStale returns true if a value of the output type with the given timestamp is older than
+// the max age of the output type. Values without a valid timestamp are stale when a max age applies.
+func (valueMaxAge *ValueMaxAge) IsStale(outputType types.OutputType, timestamp string) bool {
+	maxAge := valueMaxAge.GetMaxAge(outputType)
+	if maxAge <= 0 {
+		return false
+	}
+	valueTime, err := time.Parse(types.TimeFormat, timestamp)
+	if err != nil {
+		return true
+	}
+	return valueMaxAge.clock.Now().Sub(valueTime) > maxAge
+}
+
+// IsStaleTime returns true if a value of the output type that was last reported at the given time
+// is older than the max age of the output type.
+func (valueMaxAge *ValueMaxAge) IsStaleTime(outputType types.OutputType, reportTime time.Time) bool {
+	maxAge := valueMaxAge.GetMaxAge(outputType)
+	return maxAge > 0 && valueMaxAge.clock.Now().Sub(reportTime) > maxAge
+}
+
+// SetClock sets the clock used to determine the age of values. Intended for testing.
+func (valueMaxAge *ValueMaxAge) SetClock(clock messaging.Clock) {
+	valueMaxAge.updateMutex.Lock()
+	defer valueMaxAge.updateMutex.Unlock()
+	valueMaxAge.clock = clock
+}
+
+// SetMaxAge sets the max age of values of an output type
+//  outputType to set the max age of, or "" to set the default for types without their own max age
+//  maxAge of values before they are stale. Use 0 for values that never become stale.
+func (valueMaxAge *ValueMaxAge) SetMaxAge(outputType types.OutputType, maxAge time.Duration) {
+	valueMaxAge.updateMutex.Lock()
+	defer valueMaxAge.updateMutex.Unlock()
+	if outputType == "" {
+		valueMaxAge.defaultMaxAge = maxAge
+	} else {
+		valueMaxAge.maxAge[outputType] = maxAge
+	}
+}
+
+// NewValueMaxAge creates the collection of max age of output values by output type
+//  defaultMaxAge of output types without their own max age, 0 for values that never become stale
+func NewValueMaxAge(defaultMaxAge time.Duration) *ValueMaxAge {
+	return &ValueMaxAge{
+		clock:         messaging.RealClock,
+		defaultMaxAge: defaultMaxAge,
+		maxAge:        make(map[types.OutputType]time.Duration),
+		updateMutex:   &sync.RWMutex{},
+	}
+}
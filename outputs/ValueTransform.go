@@ -0,0 +1,122 @@
+// Package outputs with transformation of output values before they are stored and published
+package outputs
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/iotdomain/iotdomain-go/lib"
+	"github.com/iotdomain/iotdomain-go/types"
+)
+
+// TransformOp is the operation of a value transform step
+type TransformOp string
+
+// Operations of value transform steps
+const (
+	TransformClamp  TransformOp = "clamp"  // limit the value to the range Min-Max
+	TransformOffset TransformOp = "offset" // add Value to the value
+	TransformRound  TransformOp = "round"  // round the value to Value decimals
+	TransformScale  TransformOp = "scale"  // multiply the value by Value
+)
+
+// TransformStep is an operation of a value transform pipeline
+type TransformStep struct {
+	Op       TransformOp // operation to apply
+	Value    float64     // factor of scale, amount of offset or nr of decimals of round
+	Min      float64     // lower limit of clamp
+	Max      float64     // upper limit of clamp
+	Rounding Rounding    // rounding method of round, default is RoundHalfUp
+}
+
+// ValueTransform is a pipeline of steps that are applied in order to numeric output values, eg to
+// convert ADC counts to a voltage with a scale, offset and round.
+type ValueTransform []TransformStep
+
+// Apply the transform steps in order to a value
+// Values that are not numeric are returned unchanged.
+func (transform ValueTransform) Apply(value string) string {
+	if len(transform) == 0 {
+		return value
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return value
+	}
+	for _, step := range transform {
+		switch step.Op {
+		case TransformClamp:
+			number = math.Max(step.Min, math.Min(step.Max, number))
+		case TransformOffset:
+			number += step.Value
+		case TransformRound:
+			rounded := roundDecimals(number, int(math.Round(step.Value)), step.Rounding)
+			number, _ = strconv.ParseFloat(rounded, 64)
+		case TransformScale:
+			number *= step.Value
+		}
+	}
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
+
+// OutputTransform returns the transform as described in the output discovery message
+func (transform ValueTransform) OutputTransform() []types.OutputTransformStep {
+	if len(transform) == 0 {
+		return nil
+	}
+	steps := make([]types.OutputTransformStep, 0, len(transform))
+	for _, step := range transform {
+		steps = append(steps, types.OutputTransformStep{
+			Op:       string(step.Op),
+			Value:    step.Value,
+			Min:      step.Min,
+			Max:      step.Max,
+			Rounding: string(step.Rounding),
+		})
+	}
+	return steps
+}
+
+// Validate checks that the operations of the transform steps are known and that the range of
+// clamp steps is valid
+func (transform ValueTransform) Validate() error {
+	for i, step := range transform {
+		switch step.Op {
+		case TransformClamp:
+			if step.Min > step.Max {
+				return fmt.Errorf("Transform step %d: clamp min %v is larger than max %v", i, step.Min, step.Max)
+			}
+		case TransformOffset, TransformRound, TransformScale:
+		default:
+			return fmt.Errorf("Transform step %d: unknown operation '%s'", i, step.Op)
+		}
+	}
+	return nil
+}
+
+// GetTransform returns the transform pipeline of an output, or nil if the output has no transform
+func (outputValues *RegisteredOutputValues) GetTransform(outputID string) ValueTransform {
+	outputValues.updateMutex.Lock()
+	defer outputValues.updateMutex.Unlock()
+	return outputValues.transforms[outputID]
+}
+
+// SetTransform sets the pipeline that transforms the values of an output before they are stored
+// in the history and published.
+//  outputID is the output whose values to transform
+//  transform is the list of steps to apply in order. Use nil to remove the transform.
+// Returns an error if the transform is invalid, see ValueTransform.Validate
+func (outputValues *RegisteredOutputValues) SetTransform(outputID string, transform ValueTransform) error {
+	if err := transform.Validate(); err != nil {
+		return lib.MakeErrorf("SetTransform: Invalid transform for output '%s': %s", outputID, err)
+	}
+	outputValues.updateMutex.Lock()
+	defer outputValues.updateMutex.Unlock()
+	if len(transform) == 0 {
+		delete(outputValues.transforms, outputID)
+		return nil
+	}
+	outputValues.transforms[outputID] = append(ValueTransform{}, transform...)
+	return nil
+}
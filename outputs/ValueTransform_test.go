@@ -0,0 +1,72 @@
+package outputs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/outputs"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueTransform(t *testing.T) {
+	// convert 12 bit ADC counts to a voltage with a 3.3V reference and 0.1V offset
+	adcToVolt := outputs.ValueTransform{
+		{Op: outputs.TransformScale, Value: 3.3 / 4096},
+		{Op: outputs.TransformOffset, Value: 0.1},
+		{Op: outputs.TransformRound, Value: 2},
+	}
+	assert.Equal(t, "1.75", adcToVolt.Apply("2048"))
+	assert.Equal(t, "0.1", adcToVolt.Apply("0"))
+	assert.Equal(t, "on", adcToVolt.Apply("on"), "non-numeric values must pass unchanged")
+
+	clamp := outputs.ValueTransform{{Op: outputs.TransformClamp, Min: 0, Max: 100}}
+	assert.Equal(t, "0", clamp.Apply("-5"))
+	assert.Equal(t, "100", clamp.Apply("120.5"))
+	assert.Equal(t, "42.5", clamp.Apply("42.5"))
+	assert.Equal(t, "1e3", outputs.ValueTransform(nil).Apply("1e3"))
+
+	// rounding uses the decimal value and the same rounding methods as formats
+	round := outputs.ValueTransform{{Op: outputs.TransformRound, Value: 2}}
+	assert.Equal(t, "1.01", round.Apply("1.005"))
+	assert.Equal(t, "0.13", round.Apply("0.125"))
+	roundEven := outputs.ValueTransform{{Op: outputs.TransformRound, Value: 2, Rounding: outputs.RoundHalfEven}}
+	assert.Equal(t, "0.12", roundEven.Apply("0.125"))
+	assert.Equal(t, "NaN", round.Apply("NaN"))
+}
+
+func TestOutputValueTransform(t *testing.T) {
+	collection := outputs.NewRegisteredOutputValues("test", "publisher1")
+	outputID := outputs.MakeOutputID("node1", types.OutputTypeVoltage, types.DefaultOutputInstance)
+	transform := outputs.ValueTransform{
+		{Op: outputs.TransformScale, Value: 0.01},
+		{Op: outputs.TransformOffset, Value: -1},
+		{Op: outputs.TransformRound, Value: 1},
+	}
+	err := collection.SetTransform(outputID, transform)
+	require.NoError(t, err)
+	assert.Equal(t, transform, collection.GetTransform(outputID))
+	steps := transform.OutputTransform()
+	require.Equal(t, 3, len(steps))
+	assert.Equal(t, types.OutputTransformStep{Op: "scale", Value: 0.01}, steps[0])
+
+	// invalid transforms are rejected
+	err = collection.SetTransform(outputID, outputs.ValueTransform{{Op: "multiply", Value: 2}})
+	assert.Error(t, err)
+	err = collection.SetTransform(outputID, outputs.ValueTransform{{Op: outputs.TransformClamp, Min: 10, Max: 0}})
+	assert.Error(t, err)
+	assert.Equal(t, transform, collection.GetTransform(outputID))
+
+	// values are stored transformed
+	collection.UpdateOutputValue(outputID, "1234")
+	assert.Equal(t, "11.3", collection.GetOutputValueByID(outputID).Value)
+	collection.UpdateOutputValueAt(outputID, "2000", time.Now().Add(time.Second))
+	assert.Equal(t, "19", collection.GetOutputValueByID(outputID).Value)
+
+	// without transform values are stored as is
+	collection.SetTransform(outputID, nil)
+	assert.Nil(t, collection.GetTransform(outputID))
+	collection.UpdateOutputValue(outputID, "1234")
+	assert.Equal(t, "1234", collection.GetOutputValueByID(outputID).Value)
+}
@@ -0,0 +1,132 @@
+// Package publisher with persistence of discovered domain nodes, inputs and outputs
+package publisher
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/lib"
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/sirupsen/logrus"
+)
+
+// DomainStateVersion is the version of the saved domain state format
+const DomainStateVersion = 1
+
+// DomainState with the discovered domain nodes, including their configuration, inputs and outputs
+type DomainState struct {
+	Version   int                             `json:"version"`   // format version of the state
+	Timestamp string                          `json:"timestamp"` // time the state was saved
+	Nodes     []*types.NodeDiscoveryMessage   `json:"nodes"`
+	Inputs    []*types.InputDiscoveryMessage  `json:"inputs"`
+	Outputs   []*types.OutputDiscoveryMessage `json:"outputs"`
+}
+
+// LoadState loads previously saved discovered domain nodes, inputs and outputs from file.
+// Cached entities are reconciled with the entities that are already discovered: a cached entity
+// is added if it isn't discovered yet, and replaces a discovered entity only if it is newer.
+// Unknown fields are ignored so a state saved by a different version can still be loaded. A list
+// of nodes saved with DomainNodes.SaveNodes is loaded as a state with only nodes.
+// An encrypted state is decrypted with this publisher's private key. See SaveState.
+func (pub *Publisher) LoadState(filename string) error {
+	var state DomainState
+
+	stateJSON, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return lib.MakeErrorf("LoadState: Unable to open file %s: %s", filename, err)
+	}
+	decrypted, isEncrypted, err := messaging.DecryptMessage(string(stateJSON), pub.registeredIdentity.GetPrivateKey())
+	if isEncrypted {
+		if err != nil {
+			return lib.MakeErrorf("LoadState: Unable to decrypt state file %s: %v", filename, err)
+		}
+		stateJSON = []byte(decrypted)
+	}
+	err = json.Unmarshal(stateJSON, &state)
+	if err != nil {
+		// nodes cached before the domain state was introduced are a list of nodes
+		if err2 := json.Unmarshal(stateJSON, &state.Nodes); err2 != nil {
+			return lib.MakeErrorf("LoadState: Error parsing JSON state file %s: %v", filename, err)
+		}
+		logrus.Warningf("LoadState: File %s contains a list of nodes instead of a domain state. Loading nodes.",
+			filename)
+	} else if state.Version != DomainStateVersion {
+		logrus.Warningf("LoadState: State file %s has version %d instead of %d. Loading known fields.",
+			filename, state.Version, DomainStateVersion)
+	}
+	nodeCount, inputCount, outputCount := 0, 0, 0
+	for _, node := range state.Nodes {
+		current := pub.domainNodes.GetNodeByAddress(node.Address)
+		if current == nil || isNewerState(node.Timestamp, current.Timestamp) {
+			pub.domainNodes.AddNode(node)
+			nodeCount++
+		}
+	}
+	for _, input := range state.Inputs {
+		current := pub.domainInputs.GetInputByAddress(input.Address)
+		if current == nil || isNewerState(input.Timestamp, current.Timestamp) {
+			pub.domainInputs.AddInput(input)
+			inputCount++
+		}
+	}
+	for _, output := range state.Outputs {
+		current := pub.domainOutputs.GetOutputByAddress(output.Address)
+		if current == nil || isNewerState(output.Timestamp, current.Timestamp) {
+			pub.domainOutputs.AddOutput(output)
+			outputCount++
+		}
+	}
+	logrus.Infof("LoadState: Loaded %d nodes, %d inputs and %d outputs from %s. Newer discovered entities are kept.",
+		nodeCount, inputCount, outputCount, filename)
+	return nil
+}
+
+// isNewerState returns true if the timestamp of a cached entity is after the timestamp of the
+// discovered entity. A discovered entity without a valid timestamp is replaced by a cached entity
+// with a valid timestamp.
+func isNewerState(cachedTimestamp string, currentTimestamp string) bool {
+	cachedTime, err := time.Parse(types.TimeFormat, cachedTimestamp)
+	if err != nil {
+		return false
+	}
+	currentTime, err := time.Parse(types.TimeFormat, currentTimestamp)
+	return err != nil || cachedTime.After(currentTime)
+}
+
+// SaveState saves the discovered domain nodes, inputs and outputs to file.
+// The configuration of nodes can contain secrets such as login names and passwords. Use encrypt
+// to encrypt the state with this publisher's public key so only this publisher can load it.
+// An encrypted state can't be loaded after the publisher's keys have changed.
+//  encrypt the saved state, or save it as plain JSON
+func (pub *Publisher) SaveState(filename string, encrypt bool) error {
+	state := DomainState{
+		Version:   DomainStateVersion,
+		Timestamp: pub.messageSigner.Clock().Now().Format(types.TimeFormat),
+		Nodes:     pub.domainNodes.GetAllNodes(),
+		Inputs:    pub.domainInputs.GetAllInputs(),
+		Outputs:   pub.domainOutputs.GetAllOutputs(),
+	}
+	stateJSON, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return lib.MakeErrorf("SaveState: Error marshalling state '%s': %v", filename, err)
+	}
+	if encrypt {
+		privKey := pub.registeredIdentity.GetPrivateKey()
+		if privKey == nil {
+			return lib.MakeErrorf("SaveState: Unable to encrypt state '%s' without a private key", filename)
+		}
+		encrypted, err := messaging.EncryptMessage(string(stateJSON), &privKey.PublicKey)
+		if err != nil {
+			return lib.MakeErrorf("SaveState: Error encrypting state '%s': %v", filename, err)
+		}
+		stateJSON = []byte(encrypted)
+	}
+	err = ioutil.WriteFile(filename, stateJSON, 0600)
+	if err != nil {
+		return lib.MakeErrorf("SaveState: Error saving state to file %s: %v", filename, err)
+	}
+	logrus.Infof("SaveState: State saved successfully to file %s", filename)
+	return nil
+}
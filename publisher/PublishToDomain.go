@@ -0,0 +1,148 @@
+// Package publisher with republishing of outputs into another domain for bridging domains
+package publisher
+
+import (
+	"github.com/iotdomain/iotdomain-go/identities"
+	"github.com/iotdomain/iotdomain-go/lib"
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/types"
+)
+
+// BridgedNodeIDSeparator separates the ID of the original publisher from the node ID in the node ID
+// of bridged messages
+const BridgedNodeIDSeparator = "."
+
+// BridgeNodeOutputs republishes the output values and events of a node into another domain.
+// Received messages are verified with the sender's public key before they are re-signed and
+// republished using PublishToDomain. Messages that were already bridged are not bridged again,
+// to avoid loops between bridges. The hop count of bridged messages is incremented, so messages
+// that loop through other forwarding publishers are dropped once they exceed the max hops.
+//  nodeAddress is the node address: domain/publisher/nodeID[/$node]. Use '+' wildcards for all nodes.
+//  targetDomain is the domain to republish into
+func (pub *Publisher) BridgeNodeOutputs(nodeAddress string, targetDomain string) {
+	segments, err := types.ParseBaseAddress(nodeAddress)
+	if err != nil || segments.NodeID == "" {
+		pub.logger.Errorf("BridgeNodeOutputs: Invalid node address '%s'", nodeAddress)
+		return
+	}
+	republish := func(address string, object interface{}, hops int) error {
+		if getOrigin(object) != "" {
+			return nil
+		}
+		return pub.publishToDomain(targetDomain, address, object, hops)
+	}
+	latestAddress := types.MakeAddress(&types.AddressSegments{Domain: segments.Domain, PublisherID: segments.PublisherID,
+		NodeID: segments.NodeID, OutputType: "+", Instance: "+", MessageType: types.MessageTypeLatest})
+	pub.messageSigner.SubscribeVerifiedWithHops(latestAddress,
+		func() interface{} { return &types.OutputLatestMessage{} }, republish)
+	eventAddress := types.MakeAddress(&types.AddressSegments{Domain: segments.Domain, PublisherID: segments.PublisherID,
+		NodeID: segments.NodeID, MessageType: types.MessageTypeEvent})
+	pub.messageSigner.SubscribeVerifiedWithHops(eventAddress,
+		func() interface{} { return &types.OutputEventMessage{} }, republish)
+}
+
+// PublishToDomain re-signs and republishes an output message into another domain.
+// The message is published under this publisher's ID in the target domain so receivers verify it
+// with this publisher's key. The node ID in the target domain is the original publisher ID and node
+// ID joined with BridgedNodeIDSeparator, so nodes with the same ID from different publishers don't
+// collide, eg domain2/bridge/publisher1.node1/$event. The original address is kept in the Origin
+// field of the message so receivers that trust this bridge know which publisher the value came from.
+// On first use of a domain this publisher's identity is published in that domain.
+// Bridged identities are republished when the identity is renewed.
+//  targetDomain is the domain to republish into
+//  address is the original address of the message
+//  object is a $latest, $event, $history or $forecast message. Its Address and Origin are updated.
+func (pub *Publisher) PublishToDomain(targetDomain string, address string, object interface{}) error {
+	return pub.publishToDomain(targetDomain, address, object, 0)
+}
+
+// publishToDomain republishes a message into another domain with the incremented hop count
+//  hops is the hop count of the received message
+func (pub *Publisher) publishToDomain(targetDomain string, address string, object interface{}, hops int) error {
+	segments, err := types.ParseAddress(address)
+	if err != nil {
+		return lib.MakeErrorf("PublishToDomain: %s", err)
+	}
+	segments.Domain = targetDomain
+	segments.NodeID = segments.PublisherID + BridgedNodeIDSeparator + segments.NodeID
+	segments.PublisherID = pub.PublisherID()
+	targetAddress := types.MakeAddress(segments)
+	switch msg := object.(type) {
+	case *types.OutputLatestMessage:
+		msg.Origin = makeOrigin(msg.Origin, address)
+		msg.Address = targetAddress
+	case *types.OutputEventMessage:
+		msg.Origin = makeOrigin(msg.Origin, address)
+		msg.Address = targetAddress
+	case *types.OutputHistoryMessage:
+		msg.Origin = makeOrigin(msg.Origin, address)
+		msg.Address = targetAddress
+	case *types.OutputForecastMessage:
+		msg.Origin = makeOrigin(msg.Origin, address)
+		msg.Address = targetAddress
+	default:
+		return lib.MakeErrorf("PublishToDomain: Message type %T of '%s' can't be bridged", object, address)
+	}
+	if targetDomain != pub.Domain() {
+		pub.updateMutex.Lock()
+		isBridged := pub.bridgeDomains[targetDomain]
+		pub.bridgeDomains[targetDomain] = true
+		pub.updateMutex.Unlock()
+		if !isBridged {
+			pub.publishBridgeIdentity(targetDomain)
+		}
+	}
+	return pub.messageSigner.ForwardObject(targetAddress, object, hops)
+}
+
+// getOrigin returns the origin of a bridged message, or "" if the message isn't bridged
+func getOrigin(object interface{}) string {
+	switch msg := object.(type) {
+	case *types.OutputLatestMessage:
+		return msg.Origin
+	case *types.OutputEventMessage:
+		return msg.Origin
+	case *types.OutputHistoryMessage:
+		return msg.Origin
+	case *types.OutputForecastMessage:
+		return msg.Origin
+	}
+	return ""
+}
+
+// makeOrigin returns the existing origin if set, otherwise the given address
+func makeOrigin(origin string, address string) string {
+	if origin != "" {
+		return origin
+	}
+	return address
+}
+
+// publishBridgeIdentity publishes this publisher's identity in another domain, self-signed with
+// this publisher's key. Intended to let receivers in that domain verify bridged messages.
+func (pub *Publisher) publishBridgeIdentity(domain string) {
+	myIdent, privKey := pub.registeredIdentity.GetFullIdentity()
+	ident := myIdent.PublisherIdentityMessage
+	ident.Domain = domain
+	ident.Address = identities.MakePublisherIdentityAddress(domain, ident.PublisherID)
+	ident.IssuerID = ident.PublisherID
+	if err := messaging.SignIdentity(&ident, privKey); err != nil {
+		pub.logger.Errorf("publishBridgeIdentity: Unable to sign identity for domain %s: %s", domain, err)
+		return
+	}
+	pub.domainIdentities.AddIdentity(&ident)
+	identities.PublishIdentity(&ident, pub.messageSigner)
+}
+
+// republishBridgeIdentities republishes this publisher's identity in all bridged domains
+func (pub *Publisher) republishBridgeIdentities() {
+	pub.updateMutex.Lock()
+	domains := make([]string, 0, len(pub.bridgeDomains))
+	for domain := range pub.bridgeDomains {
+		domains = append(domains, domain)
+	}
+	pub.updateMutex.Unlock()
+	for _, domain := range domains {
+		pub.publishBridgeIdentity(domain)
+	}
+}
@@ -2,36 +2,74 @@
 package publisher
 
 import (
-	"time"
-
+	"github.com/iotdomain/iotdomain-go/identities"
 	"github.com/iotdomain/iotdomain-go/inputs"
 	"github.com/iotdomain/iotdomain-go/lib"
 	"github.com/iotdomain/iotdomain-go/messaging"
 	"github.com/iotdomain/iotdomain-go/nodes"
 	"github.com/iotdomain/iotdomain-go/outputs"
 	"github.com/iotdomain/iotdomain-go/types"
-	"github.com/sirupsen/logrus"
 )
 
 // PublishUpdates publishes changes to registered nodes, inputs, outputs, values and this publisher identity
 func (publisher *Publisher) PublishUpdates() {
 
 	updatedNodes := publisher.registeredNodes.GetUpdatedNodes(true)
-	nodes.PublishRegisteredNodes(updatedNodes, publisher.messageSigner)
-	if len(updatedNodes) > 0 && publisher.config.ConfigFolder != "" {
+	if publisher.nodeDeltaPublisher != nil {
+		publisher.nodeDeltaPublisher.PublishNodes(updatedNodes)
+	} else if publisher.nodeStatusPublisher != nil {
+		publisher.nodeStatusPublisher.PublishNodes(updatedNodes)
+	} else {
+		nodes.PublishRegisteredNodes(updatedNodes, publisher.messageSigner)
+	}
+	deletedNodes := publisher.registeredNodes.GetDeletedNodes(true)
+	nodes.PublishDeletedNodes(deletedNodes, publisher.messageSigner)
+	if publisher.nodeDeltaPublisher != nil {
+		publisher.nodeDeltaPublisher.DeleteNodes(deletedNodes)
+	} else if publisher.nodeStatusPublisher != nil {
+		publisher.nodeStatusPublisher.DeleteNodes(deletedNodes)
+	}
+	if (len(updatedNodes) > 0 || len(deletedNodes) > 0) && publisher.config.ConfigFolder != "" {
 		publisher.SaveRegisteredNodes()
 	}
 
 	updatedInputs := publisher.registeredInputs.GetUpdatedInputs(true)
 	inputs.PublishRegisteredInputs(updatedInputs, publisher.messageSigner)
+	inputs.PublishDeletedInputs(publisher.registeredInputs.GetDeletedInputs(true), publisher.messageSigner)
 
 	updatedOutputs := publisher.registeredOutputs.GetUpdatedOutputs(true)
 	outputs.PublishRegisteredOutputs(updatedOutputs, publisher.messageSigner)
+	outputs.PublishDeletedOutputs(publisher.registeredOutputs.GetDeletedOutputs(true), publisher.messageSigner)
 
 	updatedOutputIDs := publisher.registeredOutputValues.GetUpdatedOutputValues(true)
 	publisher.PublishUpdatedOutputValues(updatedOutputIDs, publisher.messageSigner)
 }
 
+// RenewIdentity renews, saves and publishes this publisher's identity when it is due for renewal.
+// An identity issued by the DSS must be renewed by the DSS.
+func (publisher *Publisher) RenewIdentity() error {
+	regIdentity := publisher.registeredIdentity
+	if !regIdentity.IsRenewalDue() {
+		return nil
+	}
+	err := regIdentity.RenewIdentity()
+	if err != nil {
+		return err
+	}
+	publisher.publishUpdatedIdentity()
+	return nil
+}
+
+// publishUpdatedIdentity saves and publishes this publisher's identity after it has changed
+func (publisher *Publisher) publishUpdatedIdentity() {
+	regIdentity := publisher.registeredIdentity
+	regIdentity.SaveIdentity()
+	myIdent, _ := regIdentity.GetFullIdentity()
+	publisher.domainIdentities.AddIdentity(&myIdent.PublisherIdentityMessage)
+	identities.PublishIdentity(&myIdent.PublisherIdentityMessage, publisher.messageSigner)
+	publisher.republishBridgeIdentities()
+}
+
 // PublishUpdatedOutputValues publishes updated outputs discovery and values of registered outputs
 // This uses the node config to determine which output publications to use: eg raw, latest, history
 func (publisher *Publisher) PublishUpdatedOutputValues(
@@ -41,30 +79,43 @@ func (publisher *Publisher) PublishUpdatedOutputValues(
 
 	for _, outputID := range updatedOutputIDs {
 		var node *types.NodeDiscoveryMessage
-		latestValue := regOutputValues.GetOutputValueByID(outputID)
+		latestValue := regOutputValues.FormatValue(outputID, regOutputValues.GetOutputValueByID(outputID))
 		output := publisher.registeredOutputs.GetOutputByID(outputID)
 
 		if output == nil {
-			logrus.Warningf("PublishOutputValues: output with ID %s. This is unexpected", outputID)
+			publisher.logger.Warningf("PublishOutputValues: output with ID %s. This is unexpected", outputID)
 		} else {
 			node = publisher.registeredNodes.GetNodeByHWID(output.NodeHWID)
 		}
 		if node == nil {
-			logrus.Warningf("PublishOutputValues: no node for output %s. This is unexpected", outputID)
+			publisher.logger.Warningf("PublishOutputValues: no node for output %s. This is unexpected", outputID)
 		} else if latestValue == nil {
-			logrus.Warningf("PublishOutputValues: no latest value for %s. This is unexpected", outputID)
+			publisher.logger.Warningf("PublishOutputValues: no latest value for %s. This is unexpected", outputID)
 		} else {
+			publisher.updateMutex.Lock()
+			ttl := publisher.latestTTL[outputID]
+			receivedHops, isForwarded := publisher.forwardedHops[outputID]
+			publisher.updateMutex.Unlock()
+			// values with a TTL are only published in $latest as $raw and $history don't expire
 			pubRaw, _ := publisher.registeredNodes.GetNodeConfigBool(node.Address, types.NodeAttrPublishRaw, true)
-			if pubRaw {
+			if pubRaw && ttl == 0 {
 				outputs.PublishOutputRaw(output, latestValue.Value, messageSigner)
 			}
 			pubLatest, _ := publisher.registeredNodes.GetNodeConfigBool(node.Address, types.NodeAttrPublishLatest, true)
-			if pubLatest {
+			if pubLatest && isForwarded {
+				outputs.ForwardOutputLatest(output, latestValue, receivedHops, ttl, publisher.config.TypedValues, messageSigner)
+			} else if pubLatest && ttl > 0 {
+				outputs.PublishOutputLatestWithTTL(output, latestValue, ttl, publisher.config.TypedValues, messageSigner)
+			} else if pubLatest && publisher.config.TypedValues {
+				outputs.PublishOutputLatestTyped(output, latestValue, messageSigner)
+			} else if pubLatest {
 				outputs.PublishOutputLatest(output, latestValue, messageSigner)
 			}
 			pubHistory, _ := publisher.registeredNodes.GetNodeConfigBool(node.Address, types.NodeAttrPublishHistory, true)
-			if pubHistory {
-				history := regOutputValues.GetHistory(outputID)
+			// binary values are too large for a history
+			isBytes := output.DataType == types.DataTypeBytes || regOutputValues.IsBytesOutput(outputID)
+			if pubHistory && ttl == 0 && !isBytes {
+				history := regOutputValues.FormatHistory(outputID, regOutputValues.GetHistory(outputID))
 				outputs.PublishOutputHistory(output, history, messageSigner)
 			}
 			pubEvent, _ := publisher.registeredNodes.GetNodeConfigBool(node.Address, types.NodeAttrPublishEvent, false)
@@ -84,30 +135,20 @@ func PublishOutputEvent(
 	outputValues *outputs.RegisteredOutputValues,
 	messageSigner *messaging.MessageSigner,
 ) error {
-	// output values are published using their alias address, if any
-	aliasAddress := outputs.ReplaceMessageType(node.Address, types.MessageTypeEvent)
-	logrus.Infof("Publisher.publishEvent: %s", aliasAddress)
-
 	nodeOutputs := registeredOutputs.GetOutputsByNodeHWID(node.HWID)
 	event := make(map[string]string)
-	timeStampStr := time.Now().Format("2006-01-02T15:04:05.000-0700")
 	if len(nodeOutputs) == 0 {
 		return lib.MakeErrorf("PublishOutputEvent: Node %s doesn't have any outputs", node.Address)
 	}
 	for _, output := range nodeOutputs {
 		var value = ""
-		latest := outputValues.GetOutputValueByID(output.OutputID)
+		latest := outputValues.FormatValue(output.OutputID, outputValues.GetOutputValueByID(output.OutputID))
 		attrID := string(output.OutputType) + "/" + output.Instance
 		if latest != nil {
 			value = latest.Value
 		}
 		event[attrID] = value
 	}
-	eventMessage := &types.OutputEventMessage{
-		Address:   aliasAddress,
-		Event:     event,
-		Timestamp: timeStampStr,
-	}
-	err := messageSigner.PublishObject(aliasAddress, true, eventMessage, nil)
-	return err
+	// output values are published using their alias address, if any
+	return outputs.PublishEvent(node.Address, event, messageSigner)
 }
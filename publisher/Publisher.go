@@ -32,29 +32,60 @@ const (
 	// polling based sources
 	DefaultPollInterval = 600
 
+	// RetryMinDelay is the initial delay between retries of failed publications
+	RetryMinDelay = time.Second
+	// RetryMaxDelay is the max delay between retries of failed publications
+	RetryMaxDelay = time.Minute
+
 	// RegisteredNodesFileSuffix to append to name of the file containing registered nodes
 	RegisteredNodesFileSuffix = "-nodes.json"
 	// RegisteredIdentityFileSuffix to append to the name of the file containing publisher saved identity
 	RegisteredIdentityFileSuffix = "-identity.json"
 	// DomainPublishersFileSuffix to append to the name of the file containing domain publisher identities
 	DomainPublishersFileSuffix = "-domainpublishers.json"
-	// note, domain nodes are not saved
+	// DomainStateFileSuffix to append to the name of the file containing discovered domain nodes, inputs and outputs
+	DomainStateFileSuffix = "-domainstate.json"
 )
 
 // PublisherConfig defined configuration fields read from the application configuration
 type PublisherConfig struct {
-	SaveDiscoveredPublishers bool   `yaml:"cachePublishers"`   // load/save discovered publisher identities to cache
-	SaveDiscoveredNodes      bool   `yaml:"cacheNodes"`        // load/save discovered nodes to cache
-	CacheFolder              string `yaml:"cacheFolder"`       // location of discovered domain nodes and publishers
-	ConfigFolder             string `yaml:"configFolder"`      // location of yaml configuration files and registered nodes and identity
-	Domain                   string `yaml:"domain"`            // optional override per publisher. Default is local
-	PublisherID              string `yaml:"publisherId"`       // this publisher's ID
-	Loglevel                 string `yaml:"loglevel"`          // error, warning, info, debug
-	Logfile                  string `yaml:"logfile"`           //
-	DisableConfig            bool   `yaml:"disableConfig"`     // disable configuration over the bus, default is enabled
-	DisableInput             bool   `yaml:"disableInput"`      // disable inputs over the bus, default is enabled
-	DisablePublishers        bool   `yaml:"disablePublishers"` // disable listening for available publishers (enable for signature verification)
-	SecuredDomain            bool   `yaml:"securedDomain"`     // require secured domain and signed messages
+	SaveDiscoveredPublishers bool    `yaml:"cachePublishers"`       // load/save discovered publisher identities to cache
+	SaveDiscoveredNodes      bool    `yaml:"cacheNodes"`            // load/save discovered nodes to cache
+	EncryptState             bool    `yaml:"encryptState"`          // encrypt the cached discovered nodes with the publisher key
+	CacheFolder              string  `yaml:"cacheFolder"`           // location of discovered domain nodes and publishers
+	ConfigFolder             string  `yaml:"configFolder"`          // location of yaml configuration files and registered nodes and identity
+	Domain                   string  `yaml:"domain"`                // optional override per publisher. Default is local
+	PublisherID              string  `yaml:"publisherId"`           // this publisher's ID
+	Loglevel                 string  `yaml:"loglevel"`              // error, warning, info, debug
+	Logfile                  string  `yaml:"logfile"`               //
+	DisableConfig            bool    `yaml:"disableConfig"`         // disable configuration over the bus, default is enabled
+	DisableInput             bool    `yaml:"disableInput"`          // disable inputs over the bus, default is enabled
+	DisablePublishers        bool    `yaml:"disablePublishers"`     // disable listening for available publishers (enable for signature verification)
+	SecuredDomain            bool    `yaml:"securedDomain"`         // require secured domain and signed messages
+	NodeStatusInterval       int     `yaml:"nodeStatusInterval"`    // min seconds between publication of node status changes. Default 0 is immediate
+	IdentityRenewLeadTime    int     `yaml:"identityRenewLeadTime"` // hours before expiry to renew the self-signed identity. Default is 30 days
+	PublishRate              float64 `yaml:"publishRate"`           // max nr of publications per second. Default 0 is unlimited
+	PublishBurst             int     `yaml:"publishBurst"`          // max nr of publications at once when rate limited. Default 1
+	PublishRateBlock         bool    `yaml:"publishRateBlock"`      // delay instead of drop publications that exceed the rate
+	OutputMaxAge             int     `yaml:"outputMaxAge"`          // seconds after which output values are stale. Default 0 is never
+	MarkStaleNodes           bool    `yaml:"markStaleNodes"`        // set the run state of nodes whose outputs are all stale to error
+	FetchIdentities          bool    `yaml:"fetchIdentities"`       // fetch the identity of unknown senders on demand for signature verification
+	Simulation               bool    `yaml:"simulation"`            // dry-run that captures publications instead of sending them, see GetPublishedMessages
+	DedupWindow              int     `yaml:"dedupWindow"`           // seconds to drop redelivered duplicate messages. Default 0 is disabled
+	CompactHistory           int     `yaml:"compactHistory"`        // seconds between compaction of output history. Default 0 is disabled
+	IndentMessages           bool    `yaml:"indentMessages"`        // publish indented JSON for debugging. Default is compact
+	TypedValues              bool    `yaml:"typedValues"`           // include number and boolean values as JSON types in $latest messages
+	PermissiveVerification   bool    `yaml:"permissive"`            // accept unsigned messages and unknown senders on SubscribeWithTrust while migrating to signing
+	RetryQueueSize           int     `yaml:"retryQueueSize"`        // max nr of failed publications to retry on reconnect. Default 0 is disabled
+	NodeDeltas               bool    `yaml:"nodeDeltas"`            // publish node changes as deltas with a periodic full refresh
+	MaxHops                  int     `yaml:"maxHops"`               // max nr of times a message is forwarded. Default 0 is 8, -1 is unlimited
+	NodeStatusTopic          bool    `yaml:"nodeStatusTopic"`       // publish node status changes on $nodeStatus instead of $node. Ignored with nodeDeltas
+	NonceMode                string  `yaml:"nonceMode"`             // nonce in signatures to make each publication unique: counter or random. Default is none
+
+	// format of publication addresses, eg message type prefix and segment order. The format applies
+	// to all publishers in the process, so a format that differs from a custom format already in
+	// use is rejected. Default is the standard format, see types.SetAddressFormat
+	AddressFormat *types.AddressFormat `yaml:"addressFormat"`
 }
 
 // Publisher carries the operating state of 'this' publisher
@@ -84,21 +115,32 @@ type Publisher struct {
 	registeredOutputs        *outputs.RegisteredOutputs        // registered/published outputs from this publisher
 	registeredOutputValues   *outputs.RegisteredOutputValues   // registered/published output values from this publisher
 
+	bridgeDomains map[string]bool // domains this publisher republishes into, see PublishToDomain
+
 	// fullIdentity        *types.PublisherFullIdentity                         // this publishers identity
 	// identityPrivateKey  *ecdsa.PrivateKey                                    // key for signing and encryption
 	isRunning bool // publisher was started and is running
 	// runStateAddress string
 
+	forwardedHops       map[string]int                                       // received hop count of outputs derived from received messages
+	latestTTL           map[string]time.Duration                             // lifetime of $latest values by output ID
+	logger              messaging.ILogger                                    // logger with optional publisher context
 	messenger           messaging.IMessenger                                 // Message bus messenger to use
 	messageSigner       *messaging.MessageSigner                             // publishing signed messages
+	nodeDeltaPublisher  *nodes.NodeDeltaPublisher                            // optional publication of node updates as deltas
+	nodeStatusPublisher *nodes.NodeStatusPublisher                           // optional publication of node status separate from discovery
 	onNodeConfigHandler nodes.NodeConfigureHandler                           // handle before applying configuration
 	onNodeInputHandler  func(address string, message *types.SetInputMessage) // handle to update device/service input
 	pollHandler         func(pub *Publisher)                                 // function that performs value polling
 	pollCountdown       int                                                  // countdown each heartbeat
 	pollInterval        int                                                  // value polling interval in seconds
+	renewCheckTime      time.Time                                            // time of the last identity renewal check
+	staleCheckTime      time.Time                                            // time of the last check for stale nodes
+	valueMaxAge         *outputs.ValueMaxAge                                 // max age of output values by output type
 
 	// background publications require a mutex to prevent concurrent access
 	heartbeatChannel chan bool
+	lifecycleMutex   *sync.Mutex // serializes Start and Stop
 	updateMutex      *sync.Mutex // mutex for async updating and publishing
 }
 
@@ -114,6 +156,13 @@ func (pub *Publisher) HandleSetNodeIDCommand(address string, message *types.SetN
 	pub.registeredOutputs.SetNodeID(node.HWID, message.NodeID)
 }
 
+// IsRunning returns true when the publisher has completed Start and isn't stopped
+func (pub *Publisher) IsRunning() bool {
+	pub.updateMutex.Lock()
+	defer pub.updateMutex.Unlock()
+	return pub.isRunning
+}
+
 // LoadDomainPublishers loads discovered publisher identities from the cache folder.
 // Intended to cache the public signing keys to verify messages from these publishers
 func (pub *Publisher) LoadDomainPublishers() error {
@@ -144,10 +193,22 @@ func (pub *Publisher) SaveRegisteredNodes() error {
 	return err
 }
 
+// SetLogger sets the logger of the publisher and its message signer. Use a logrus.Entry to add
+// fields like the publisherID to log entries. Use nil for the default logger.
+func (pub *Publisher) SetLogger(logger messaging.ILogger) {
+	if logger == nil {
+		logger = messaging.DefaultLogger()
+	}
+	pub.logger = logger
+	pub.messageSigner.SetLogger(logger)
+}
+
 // SetNodeConfigHandler set the handler for updating node configuration.
-// The handler is invoked if a configuration update for a node is received and the node exists.
+// The handler is invoked if a configuration update for a node is received from a verified sender and
+// the node exists. Attributes that are not declared in the node's configuration are rejected before the
+// handler is invoked. The handler returns the subset of the configuration that is accepted and applied.
 func (pub *Publisher) SetNodeConfigHandler(
-	handler func(nodeHWID string, config types.NodeAttrMap)) {
+	handler func(nodeHWID string, config types.NodeAttrMap) types.NodeAttrMap) {
 
 	pub.receiveNodeConfigure.SetConfigureNodeHandler(handler)
 }
@@ -157,7 +218,7 @@ func (pub *Publisher) SetNodeConfigHandler(
 // seconds interval to perform another poll. Default (0) is DefaultPollInterval
 // intended for publishers that need to poll for values
 func (pub *Publisher) SetPollInterval(seconds int, handler func(pub *Publisher)) {
-	logrus.Infof("Publisher.SetPoll: interval = %d seconds", seconds)
+	pub.logger.Infof("Publisher.SetPoll: interval = %d seconds", seconds)
 	if seconds > 0 {
 		pub.pollInterval = seconds
 	} else {
@@ -176,80 +237,129 @@ func (pub *Publisher) SetPublisherStatus(status types.PublisherRunState) {
 	identities.PublishStatus(&msg, pub.messageSigner)
 }
 
-// Start starts publishing registered nodes, inputs and outputs, and listens for command messages.
-// Start will fail if no messenger has been provided.
-func (pub *Publisher) Start() {
-	logrus.Warningf("Publisher.Start: Starting publisher %s/%s", pub.Domain(), pub.PublisherID())
-
-	if !pub.isRunning {
-		pub.updateMutex.Lock()
-		pub.isRunning = true
-		pub.updateMutex.Unlock()
+// Start connects to the message bus, subscribes to the messages the publisher listens to and
+// starts publishing registered nodes, inputs and outputs. The start sequence is:
+//  1. reload the publisher's own identity and the previously discovered publishers and nodes
+//  2. connect to the message bus with the publisher's last will
+//  3. subscribe to publisher identities. Retained identities are received before the next step so
+//     messages from known publishers can be verified. This depends on the messenger delivering
+//     retained messages on subscription, as the InMemoryMessenger does.
+//  4. subscribe to identity updates, node configuration and set node ID commands
+//  5. publish the publisher identity and the 'connected' status, after which IsRunning is true
+//  6. start the heartbeat that publishes updates and polls for values
+// Handlers and registered nodes, inputs and outputs should be setup before calling Start, so no
+// command is received before the adapter can handle it.
+// Start and Stop are serialized and can be invoked from different goroutines. Start has no effect
+// if the publisher is already running.
+// Returns an error if the connection to the message bus fails, in which case the publisher isn't
+// started.
+func (pub *Publisher) Start() error {
+	pub.lifecycleMutex.Lock()
+	defer pub.lifecycleMutex.Unlock()
+	if pub.IsRunning() {
+		return nil
+	}
+	pub.logger.Warningf("Publisher.Start: Starting publisher %s/%s", pub.Domain(), pub.PublisherID())
 
-		go pub.heartbeatLoop()
-		// wait for the heartbeat to start
-		<-pub.heartbeatChannel
+	// reload our own identity and nodes
+	myIdent, _ := pub.registeredIdentity.GetFullIdentity()
+	pub.domainIdentities.AddIdentity(&myIdent.PublisherIdentityMessage)
 
-		// reload our own identity and nodes
-		myIdent, _ := pub.registeredIdentity.GetFullIdentity()
-		pub.domainIdentities.AddIdentity(&myIdent.PublisherIdentityMessage)
+	// reload previously discovered publishers
+	if pub.config.SaveDiscoveredPublishers {
+		pub.domainIdentities.LoadIdentities(pub.config.CacheFolder)
+	}
+	// reload previously discovered nodes, inputs and outputs
+	if pub.config.SaveDiscoveredNodes {
+		pub.LoadState(path.Join(pub.config.CacheFolder, pub.PublisherID()+DomainStateFileSuffix))
+	}
 
-		// reload previously discovered publishers
-		if pub.config.SaveDiscoveredPublishers {
-			pub.domainIdentities.LoadIdentities(pub.config.CacheFolder)
-		}
-		// reload previously discovered nodes
-		if pub.config.SaveDiscoveredNodes {
-			pub.domainNodes.LoadNodes(pub.config.CacheFolder)
-		}
+	// the broker publishes the retained last will when the connection is lost
+	lwtStatusAddress := identities.MakePublisherStatusAddress(pub.Domain(), pub.PublisherID())
+	lwtMessage, err := identities.MakeLastWillMessage(pub.Domain(), pub.PublisherID(), pub.messageSigner)
+	if err != nil {
+		lwtMessage = string(types.PublisherRunStateLost)
+	}
+	err = pub.messenger.Connect(lwtStatusAddress, lwtMessage)
+	if err != nil {
+		return lib.MakeErrorf("Publisher.Start: Unable to connect to the message bus: %s", err)
+	}
 
-		// discover domain entities, eg identities, nodes, inputs and outputs
-		if !pub.config.DisablePublishers {
-			pub.receiveDomainIdentities.Start()
-		}
-		// receive registered input set commands
-		if !pub.config.DisableInput {
-			pub.receiveSetNodeID.Start()
-		}
-		// Receive registered node configuration commands
-		if !pub.config.DisableConfig {
-			pub.receiveNodeConfigure.Start()
-		}
-		// in secured domains the DSS can update the identity
-		if pub.config.SecuredDomain {
-			pub.receiveMyIdentityUpdate.Start()
-		}
-		//  listening
-		lwtStatusAddress := identities.MakePublisherStatusAddress(pub.Domain(), pub.PublisherID())
-		pub.messenger.Connect(lwtStatusAddress, string(types.PublisherRunStateLost))
+	// discover domain identities first so messages from other publishers can be verified
+	if !pub.config.DisablePublishers {
+		pub.receiveDomainIdentities.Start()
+	}
+	// in secured domains the DSS can update the identity
+	if pub.config.SecuredDomain {
+		pub.receiveMyIdentityUpdate.Start()
+	}
+	// receive registered input set commands
+	if !pub.config.DisableInput {
+		pub.receiveSetNodeID.Start()
+	}
+	// Receive registered node configuration commands
+	if !pub.config.DisableConfig {
+		pub.receiveNodeConfigure.Start()
+	}
 
-		pub.SetPublisherStatus(types.PublisherRunStateConnected)
-		identities.PublishIdentity(&myIdent.PublisherIdentityMessage, pub.messageSigner)
+	pub.updateMutex.Lock()
+	pub.isRunning = true
+	pub.updateMutex.Unlock()
+	pub.SetPublisherStatus(types.PublisherRunStateConnected)
+	identities.PublishIdentity(&myIdent.PublisherIdentityMessage, pub.messageSigner)
+
+	go pub.heartbeatLoop()
+	// wait for the heartbeat to start
+	<-pub.heartbeatChannel
+	if pub.config.CompactHistory > 0 {
+		pub.registeredOutputValues.StartCompaction(time.Duration(pub.config.CompactHistory) * time.Second)
 	}
+	return nil
 }
 
-// Stop publishing, and set the run status to disconnected and disconnect from the
-// message bus. Wait until the heartbeat loop has finished processing messages
+// Stop publishing with an orderly teardown. This stops listening to commands, sets the run state
+// of the registered nodes to disconnected, publishes pending updates, removes all subscriptions,
+// sets the publisher status to disconnected and disconnects from the message bus.
+// Stop waits until the heartbeat loop has finished. It can be called more than once and from a
+// signal handler. Only the first call after Start has effect.
 func (pub *Publisher) Stop() {
-	logrus.Warningf("Publisher.Stop: Stopping publisher %s", pub.PublisherID())
+	pub.lifecycleMutex.Lock()
+	defer pub.lifecycleMutex.Unlock()
 	pub.updateMutex.Lock()
-	if pub.isRunning {
-		pub.isRunning = false
-
-		pub.receiveMyIdentityUpdate.Stop()
-		pub.receiveDomainIdentities.Stop()
-		pub.receiveNodeConfigure.Stop()
-		pub.receiveSetNodeID.Stop()
-
-		pub.updateMutex.Unlock()
-		// wait for heartbeat to end
-		<-pub.heartbeatChannel
-	} else {
+	if !pub.isRunning {
 		pub.updateMutex.Unlock()
+		return
+	}
+	pub.logger.Warningf("Publisher.Stop: Stopping publisher %s", pub.PublisherID())
+	pub.isRunning = false
+
+	pub.receiveMyIdentityUpdate.Stop()
+	pub.receiveDomainIdentities.Stop()
+	pub.receiveNodeConfigure.Stop()
+	pub.receiveSetNodeID.Stop()
+	pub.inputFromFiles.Stop()
+	pub.inputFromHTTP.Stop()
+
+	pub.updateMutex.Unlock()
+	// wait for heartbeat to end
+	<-pub.heartbeatChannel
+	pub.registeredOutputValues.StopCompaction()
+
+	// prevent ghost 'ready' states of nodes that are no longer managed
+	for _, node := range pub.registeredNodes.GetAllNodes() {
+		pub.registeredNodes.UpdateErrorStatus(node.HWID,
+			types.NodeRunStateDisconnected, node.Status[types.NodeStatusLastError])
+	}
+	pub.PublishUpdates()
+	pub.messageSigner.UnsubscribeAll()
+
+	if pub.config.SaveDiscoveredNodes {
+		pub.SaveState(path.Join(pub.config.CacheFolder, pub.PublisherID()+DomainStateFileSuffix),
+			pub.config.EncryptState)
 	}
 	pub.SetPublisherStatus(types.PublisherRunStateDisconnected)
 	pub.messenger.Disconnect()
-	logrus.Info("... bye bye")
+	pub.logger.Infof("... bye bye")
 }
 
 // WaitForSignal waits until a TERM or INT signal is received
@@ -269,7 +379,7 @@ func (pub *Publisher) WaitForSignal() {
 
 // Main heartbeat loop to publish, discove and poll value updates
 func (pub *Publisher) heartbeatLoop() {
-	logrus.Infof("Publisher.heartbeatLoop: starting heartbeat loop")
+	pub.logger.Infof("Publisher.heartbeatLoop: starting heartbeat loop")
 	pub.heartbeatChannel <- false
 
 	for {
@@ -277,6 +387,25 @@ func (pub *Publisher) heartbeatLoop() {
 
 		// FIXME: The duration of publishing these updates adds to the heartbeat which delays the heartbeat
 		pub.PublishUpdates()
+		pub.messageSigner.RetryPublications()
+		if pub.nodeDeltaPublisher != nil {
+			pub.nodeDeltaPublisher.RefreshNodes()
+		}
+
+		// identities are valid for a long time so an hourly renewal check is sufficient
+		now := pub.messageSigner.Clock().Now()
+		if now.Sub(pub.renewCheckTime) > time.Hour {
+			pub.renewCheckTime = now
+			err := pub.RenewIdentity()
+			if err != nil {
+				pub.logger.Warningf("Publisher.heartbeatLoop: %s", err)
+			}
+		}
+
+		if pub.config.MarkStaleNodes && now.Sub(pub.staleCheckTime) > StaleNodeCheckInterval {
+			pub.staleCheckTime = now
+			pub.UpdateStaleNodes()
+		}
 
 		if pub.config.SaveDiscoveredPublishers && pub.domainIdentities.UpdateCount() > 0 {
 			pub.SaveDomainPublishers()
@@ -297,7 +426,7 @@ func (pub *Publisher) heartbeatLoop() {
 		}
 	}
 	pub.heartbeatChannel <- true
-	logrus.Infof("Publisher.heartbeatLoop: Ending loop of publisher %s", pub.PublisherID())
+	pub.logger.Infof("Publisher.heartbeatLoop: Ending loop of publisher %s", pub.PublisherID())
 }
 
 // SetLogging sets the logging level and output file for this publisher
@@ -361,16 +490,20 @@ func SetLogging(levelName string, filename string) error {
 //
 // signingMethod indicates if and how publications must be signed. The default is jws. For testing 'none' can be used.
 //
-// messenger for publishing onto the message bus is required
+// messenger for publishing onto the message bus is required, unless config.Simulation is set in which
+// case it is replaced by a messaging.SimulationMessenger.
 func NewPublisher(config *PublisherConfig, messenger messaging.IMessenger,
 ) *Publisher {
 
-	if messenger == nil {
-		return nil
-	}
 	if config == nil {
 		config = &PublisherConfig{}
 	}
+	if config.Simulation {
+		messenger = messaging.NewSimulationMessenger(&messaging.MessengerConfig{Domain: config.Domain})
+	}
+	if messenger == nil {
+		return nil
+	}
 	if config.Domain == "" {
 		config.Domain = types.LocalDomainID
 	}
@@ -378,29 +511,77 @@ func NewPublisher(config *PublisherConfig, messenger messaging.IMessenger,
 		config.ConfigFolder = lib.DefaultConfigFolder
 	}
 	SetLogging(config.Loglevel, config.Logfile)
+	if config.AddressFormat != nil {
+		currentFormat := types.GetAddressFormat()
+		if !currentFormat.Equal(types.DefaultAddressFormat) && !currentFormat.Equal(*config.AddressFormat) {
+			logrus.Errorf("NewPublisher: Address format differs from the format in use by other publishers. " +
+				"Using the current format")
+		} else if err := types.SetAddressFormat(*config.AddressFormat); err != nil {
+			logrus.Errorf("NewPublisher: Invalid address format, using the current format: %s", err)
+		}
+	}
 
 	identityFile := path.Join(config.ConfigFolder, config.PublisherID+RegisteredIdentityFileSuffix)
 	registeredIdentity := identities.NewRegisteredIdentity(
 		config.Domain, config.PublisherID, identityFile)
+	if config.IdentityRenewLeadTime > 0 {
+		registeredIdentity.SetRenewLeadTime(time.Duration(config.IdentityRenewLeadTime) * time.Hour)
+	}
 	_, privKey, err := registeredIdentity.LoadIdentity()
 	if err != nil {
 		// save the identity as the loaded one isnt' valid
 		registeredIdentity.SaveIdentity()
+		// sign with the key of the new identity, as LoadIdentity returns no key on failure
+		_, privKey = registeredIdentity.GetFullIdentity()
 	}
 	domainIdentities := identities.NewDomainPublisherIdentities()
 
 	// These are the basis for signing and identifying publishers
 	messageSigner := messaging.NewMessageSigner(messenger, privKey, domainIdentities.GetPublisherKey)
+	if config.PublishRate > 0 {
+		messageSigner.SetRateLimiter(
+			messaging.NewRateLimiter(config.PublishRate, config.PublishBurst, config.PublishRateBlock))
+	}
+	if config.IndentMessages {
+		messageSigner.SetMarshalMode(messaging.MarshalIndented)
+	}
+	if config.PermissiveVerification {
+		messageSigner.SetPermissive(true)
+	}
+	if config.RetryQueueSize > 0 {
+		messageSigner.SetRetryQueue(messaging.NewRetryQueue(config.RetryQueueSize, RetryMinDelay, RetryMaxDelay))
+	}
+	if config.NonceMode != "" {
+		if err := messageSigner.SetNonceMode(messaging.NonceMode(config.NonceMode)); err != nil {
+			logrus.Errorf("NewPublisher: Invalid nonce mode, publishing without nonce: %s", err)
+		}
+	}
+	if config.MaxHops != 0 {
+		messageSigner.SetMaxHops(config.MaxHops)
+	}
+	if config.DedupWindow > 0 {
+		messageSigner.SetDeduplicator(messaging.NewDeduplicator(time.Duration(config.DedupWindow) * time.Second))
+	}
+	if config.FetchIdentities {
+		identityFetcher := identities.NewIdentityFetcher(domainIdentities, messageSigner)
+		messageSigner.GetPublicKey = identityFetcher.GetPublicKey
+	}
 
 	// application services
 	domainInputs := inputs.NewDomainInputs(messageSigner)
 	domainNodes := nodes.NewDomainNodes(messageSigner)
 	domainOutputs := outputs.NewDomainOutputs(messageSigner)
 	domainOutputValues := outputs.NewDomainOutputValues(messageSigner)
+	valueMaxAge := outputs.NewValueMaxAge(time.Duration(config.OutputMaxAge) * time.Second)
+	domainOutputValues.SetValueMaxAge(valueMaxAge)
 	registeredInputs := inputs.NewRegisteredInputs(config.Domain, config.PublisherID)
 	registeredNodes := nodes.NewRegisteredNodes(config.Domain, config.PublisherID)
+	registeredNodes.SetStatusInterval(time.Duration(config.NodeStatusInterval) * time.Second)
 	registeredOutputs := outputs.NewRegisteredOutputs(config.Domain, config.PublisherID)
 	registeredOutputValues := outputs.NewRegisteredOutputValues(config.Domain, config.PublisherID)
+	if config.CompactHistory > 0 {
+		registeredOutputValues.SetCompactionPolicy("", outputs.DefaultCompactionPolicy)
+	}
 	registeredForecastValues := outputs.NewRegisteredForecastValues(config.Domain, config.PublisherID)
 
 	receiveMyIdentityUpdate := identities.NewReceiveRegisteredIdentityUpdate(
@@ -426,11 +607,15 @@ func NewPublisher(config *PublisherConfig, messenger messaging.IMessenger,
 		inputFromFiles:   inputs.NewReceiveFromFiles(registeredInputs),
 		inputFromOutputs: inputs.NewReceiveFromOutputs(messageSigner, registeredInputs),
 
+		bridgeDomains:    make(map[string]bool),
 		heartbeatChannel: make(chan bool),
 		// fullIdentity:       identity,
 		// identityPrivateKey: privateKey,
 		// runStateAddress: fmt.Sprintf("%s/%s/%s", config.Domain, config.PublisherID, types.MessageTypeRunState),
 
+		forwardedHops:           make(map[string]int),
+		latestTTL:               make(map[string]time.Duration),
+		logger:                  messaging.DefaultLogger(),
 		messenger:               messenger,
 		messageSigner:           messageSigner,
 		pollCountdown:           0,
@@ -447,9 +632,21 @@ func NewPublisher(config *PublisherConfig, messenger messaging.IMessenger,
 		registeredOutputs:        registeredOutputs,
 		registeredOutputValues:   registeredOutputValues,
 
-		updateMutex: &sync.Mutex{},
+		lifecycleMutex: &sync.Mutex{},
+		updateMutex:    &sync.Mutex{},
+		valueMaxAge:    valueMaxAge,
 	}
 	receiveSetNodeID.SetNodeIDHandler(pub.HandleSetNodeIDCommand)
+	pub.inputFromSetCommands.SetSenderAuthorization(registeredNodes.AuthorizeSender)
+	if config.NodeDeltas && config.NodeStatusTopic {
+		logrus.Warningf("NewPublisher: nodeStatusTopic is ignored as nodeDeltas is set for publisher '%s'",
+			config.PublisherID)
+	}
+	if config.NodeDeltas {
+		pub.nodeDeltaPublisher = nodes.NewNodeDeltaPublisher(messageSigner, nodes.DefaultNodeRefreshInterval)
+	} else if config.NodeStatusTopic {
+		pub.nodeStatusPublisher = nodes.NewNodeStatusPublisher(messageSigner)
+	}
 
 	// Load configuration of previously registered nodes from config
 	pub.LoadRegisteredNodes()
@@ -1,17 +1,25 @@
 package publisher_test
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/iotdomain/iotdomain-go/identities"
 	"github.com/iotdomain/iotdomain-go/inputs"
 	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/outputs"
 	"github.com/iotdomain/iotdomain-go/publisher"
 	"github.com/iotdomain/iotdomain-go/types"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
 )
 
 const node1ID = "node1"
@@ -93,6 +101,27 @@ func TestStartStop(t *testing.T) {
 
 }
 
+func TestLastWill(t *testing.T) {
+	var testMessenger = messaging.NewDummyMessenger(msgConfig)
+	pub1 := publisher.NewPublisher(test1Config, testMessenger)
+	statusAddr := identities.MakePublisherStatusAddress(pub1.Domain(), pub1.PublisherID())
+
+	pub1.Start()
+	var statusMsg types.PublisherStatusMessage
+	_, err := messaging.VerifySenderJWSSignature(testMessenger.FindLastPublication(statusAddr), &statusMsg, nil)
+	require.NoError(t, err)
+	assert.Equal(t, types.PublisherRunStateConnected, statusMsg.Status)
+
+	// the broker publishes the signed last will when the connection is lost
+	testMessenger.SimulateConnectionLost()
+	isSigned, err := messaging.VerifySenderJWSSignature(testMessenger.FindLastPublication(statusAddr), &statusMsg, nil)
+	require.NoError(t, err)
+	assert.True(t, isSigned)
+	assert.Equal(t, types.PublisherRunStateLost, statusMsg.Status)
+	assert.Equal(t, statusAddr, statusMsg.Address)
+	pub1.Stop()
+}
+
 func TestSetLogging(t *testing.T) {
 	var logFile = "/tmp/iotdomain-go.log"
 	// var testMessenger = messaging.NewDummyMessenger(msgConfig)
@@ -125,6 +154,37 @@ func TestLoadNodes(t *testing.T) {
 
 }
 
+// TestDeleteNode tests that deleting a node removes it and its inputs and outputs from the message bus
+func TestDeleteNode(t *testing.T) {
+	configFolder, _ := ioutil.TempDir("", "iotdomain")
+	defer os.RemoveAll(configFolder)
+	var testMessenger = messaging.NewDummyMessenger(msgConfig)
+	pubConfig := *test1Config
+	pubConfig.ConfigFolder = configFolder
+	pub1 := publisher.NewPublisher(&pubConfig, testMessenger)
+
+	pub1.Start()
+	node := pub1.CreateNode(node1ID, types.NodeTypeUnknown)
+	input := pub1.CreateInput(node1ID, node1InputType, types.DefaultInputInstance, nil)
+	output := pub1.CreateOutput(node1ID, node1Output1Type, types.DefaultOutputInstance)
+	pub1.PublishUpdates()
+	assert.NotEmpty(t, testMessenger.FindLastPublication(node.Address))
+	assert.NotEmpty(t, testMessenger.FindLastPublication(input.Address))
+	assert.NotEmpty(t, testMessenger.FindLastPublication(output.Address))
+
+	pub1.DeleteNode(node1ID)
+	assert.Nil(t, pub1.GetNodeByHWID(node1ID))
+	assert.Nil(t, pub1.GetInputByNodeHWID(node1ID, node1InputType, types.DefaultInputInstance))
+	assert.Nil(t, pub1.GetOutputByNodeHWID(node1ID, node1Output1Type, types.DefaultOutputInstance))
+
+	// the deletion is published as an empty retained message
+	pub1.PublishUpdates()
+	assert.Empty(t, testMessenger.FindLastPublication(node.Address))
+	assert.Empty(t, testMessenger.FindLastPublication(input.Address))
+	assert.Empty(t, testMessenger.FindLastPublication(output.Address))
+	pub1.Stop()
+}
+
 // TestDiscoveryWithNewNodeID tests changing the nodeID in the inout discovery publication
 func TestDiscoveryWithNewNodeID(t *testing.T) {
 	var testMessenger = messaging.NewDummyMessenger(msgConfig)
@@ -197,6 +257,672 @@ func TestReceiveInput(t *testing.T) {
 	pub1.Stop()
 }
 
+func TestSetInputMessageHandler(t *testing.T) {
+	var testMessenger = messaging.NewDummyMessenger(msgConfig)
+	var node1InputSetAddr = fmt.Sprintf("%s/%s/0/%s", node1Base, node1InputType, types.MessageTypeSetInput)
+	rxValue := ""
+	pub1 := publisher.NewPublisher(test1Config, testMessenger)
+	pub1.Start()
+	input := pub1.SetInputMessageHandler(node1ID, node1InputType, types.DefaultInputInstance,
+		func(value string) {
+			rxValue = value
+		})
+	require.NotNil(t, input)
+	pub1.PublishUpdates()
+
+	// a signed and encrypted set command from a known publisher is passed to the handler
+	err := pub1.PublishSetInput(node1InputSetAddr, "true")
+	assert.NoError(t, err)
+	assert.Equal(t, "true", rxValue)
+
+	// error case - an unsigned and unencrypted set command is discarded
+	setMessage := types.SetInputMessage{Address: node1InputSetAddr, Sender: pub1.Address(), Value: "false"}
+	payload, _ := json.Marshal(setMessage)
+	testMessenger.Publish(node1InputSetAddr, false, string(payload))
+	assert.Equal(t, "true", rxValue)
+
+	pub1.Stop()
+}
+
+func TestNewConstrainedInput(t *testing.T) {
+	var testMessenger = messaging.NewDummyMessenger(msgConfig)
+	var setAddr = fmt.Sprintf("%s/%s/0/%s", node1Base, types.InputTypeDimmer, types.MessageTypeSetInput)
+	rxValue := ""
+	pub1 := publisher.NewPublisher(test1Config, testMessenger)
+	pub1.Start()
+	input := pub1.NewConstrainedInput(node1ID, types.InputTypeDimmer, types.DefaultInputInstance,
+		types.DataTypeNumber, 0, 100, nil,
+		func(input *types.InputDiscoveryMessage, sender string, value string) {
+			rxValue = value
+		})
+	require.NotNil(t, input)
+	assert.Equal(t, input, pub1.GetInputByID(input.InputID))
+	pub1.PublishUpdates()
+
+	err := pub1.PublishSetInput(setAddr, "50")
+	assert.NoError(t, err)
+	assert.Equal(t, "50", rxValue)
+
+	// error case - values outside the range, non-numbers and non-finite numbers don't reach the handler
+	for _, value := range []string{"300", "-1", "bright", "NaN", "Inf"} {
+		pub1.PublishSetInput(setAddr, value)
+		assert.Equal(t, "50", rxValue, "value '%s' should be rejected", value)
+	}
+	pub1.Stop()
+}
+
+func TestNewIdentitySigning(t *testing.T) {
+	configFolder, _ := ioutil.TempDir("", "iotdomain")
+	defer os.RemoveAll(configFolder)
+	messenger := messaging.NewInMemoryMessenger(msgConfig)
+
+	// without a saved identity a new identity is created and its key signs publications
+	pubConfig := *test1Config
+	pubConfig.ConfigFolder = configFolder
+	pub1 := publisher.NewPublisher(&pubConfig, messenger)
+	pub1.Start()
+	defer pub1.Stop()
+	pubKey := pub1.GetPublisherKey(pub1.Address())
+	require.NotNil(t, pubKey)
+
+	node := pub1.CreateNode(node1ID, types.NodeTypeUnknown)
+	rawMessage := ""
+	messenger.Subscribe(node.Address, func(address string, message string) error {
+		rawMessage = message
+		return nil
+	})
+	pub1.PublishUpdates()
+	jws, err := jose.ParseSigned(rawMessage)
+	require.NoError(t, err, "Node is not signed")
+	_, err = jws.Verify(pubKey)
+	assert.NoError(t, err)
+}
+
+func TestSetInputValue(t *testing.T) {
+	configFolder, _ := ioutil.TempDir("", "iotdomain")
+	defer os.RemoveAll(configFolder)
+	messenger := messaging.NewInMemoryMessenger(msgConfig)
+	rxValue := ""
+
+	// the device publisher handles the input
+	deviceConfig := *test1Config
+	deviceConfig.ConfigFolder = configFolder
+	device := publisher.NewPublisher(&deviceConfig, messenger)
+	device.Start()
+	device.SetInputMessageHandler(node1ID, types.InputTypeSwitch, types.DefaultInputInstance,
+		func(value string) {
+			rxValue = value
+		})
+
+	// the controller publisher sets the input
+	controllerConfig := *test1Config
+	controllerConfig.ConfigFolder = configFolder
+	controllerConfig.PublisherID = "controller1"
+	controller := publisher.NewPublisher(&controllerConfig, messenger)
+	controller.Start()
+	require.NotNil(t, controller.GetPublisherKey(device.Address()), "Device identity not received")
+	require.NotNil(t, device.GetPublisherKey(controller.Address()), "Controller identity not received")
+
+	setAddr := inputs.MakeSetInputAddress(device.Domain(), device.PublisherID(), node1ID,
+		types.InputTypeSwitch, types.DefaultInputInstance)
+	rawCommand := ""
+	messenger.Subscribe(setAddr, func(address string, message string) error {
+		rawCommand = message
+		return nil
+	})
+
+	// the command is encrypted with the key of the device and signed by the controller
+	err := controller.SetInputValue(device.Domain(), device.PublisherID(), node1ID,
+		types.InputTypeSwitch, types.DefaultInputInstance, "on")
+	assert.NoError(t, err)
+	assert.Equal(t, "on", rxValue)
+	_, err = jose.ParseEncrypted(rawCommand)
+	assert.NoError(t, err, "Command is not encrypted")
+
+	// unencrypted commands are discarded by the device
+	plainSigner := messaging.NewMessageSigner(messenger, messaging.CreateAsymKeys(), nil)
+	err = inputs.PublishSetInput(setAddr, "off", controller.Address(), plainSigner, nil)
+	assert.NoError(t, err)
+	_, err = jose.ParseEncrypted(rawCommand)
+	assert.Error(t, err)
+	assert.Equal(t, "on", rxValue)
+
+	// commands to publishers with an unknown identity are published unencrypted
+	unknownAddr := inputs.MakeSetInputAddress(device.Domain(), "unknownPublisher", node1ID,
+		types.InputTypeSwitch, types.DefaultInputInstance)
+	messenger.Subscribe(unknownAddr, func(address string, message string) error {
+		rawCommand = message
+		return nil
+	})
+	err = controller.SetInputValue(device.Domain(), "unknownPublisher", node1ID,
+		types.InputTypeSwitch, types.DefaultInputInstance, "off")
+	assert.NoError(t, err)
+	_, err = jose.ParseSigned(rawCommand)
+	assert.NoError(t, err, "Command is not signed")
+	assert.Equal(t, "on", rxValue)
+
+	controller.Stop()
+	device.Stop()
+}
+
+func TestNodeAuthorizedSenders(t *testing.T) {
+	configFolder, _ := ioutil.TempDir("", "iotdomain")
+	defer os.RemoveAll(configFolder)
+	messenger := messaging.NewInMemoryMessenger(msgConfig)
+	rxValue := ""
+
+	deviceConfig := *test1Config
+	deviceConfig.ConfigFolder = configFolder
+	device := publisher.NewPublisher(&deviceConfig, messenger)
+	device.Start()
+	device.CreateNode(node1ID, types.NodeTypeUnknown)
+	device.SetInputMessageHandler(node1ID, types.InputTypeSwitch, types.DefaultInputInstance,
+		func(value string) {
+			rxValue = value
+		})
+	device.SetNodeAuthorizedSenders(node1ID, []string{"controller2"})
+
+	controllerConfig := *test1Config
+	controllerConfig.ConfigFolder = configFolder
+	controllerConfig.PublisherID = "controller1"
+	controller := publisher.NewPublisher(&controllerConfig, messenger)
+	controller.Start()
+	require.NotNil(t, device.GetPublisherKey(controller.Address()), "Controller identity not received")
+
+	// a verified sender that isn't authorized for the node is rejected
+	err := controller.SetInputValue(device.Domain(), device.PublisherID(), node1ID,
+		types.InputTypeSwitch, types.DefaultInputInstance, "on")
+	assert.NoError(t, err)
+	assert.Equal(t, "", rxValue)
+	errorCount, _ := device.GetNodeStatus(node1ID, types.NodeStatusErrorCount)
+	assert.Equal(t, "1", errorCount)
+
+	device.SetNodeAuthorizedSenders(node1ID, []string{"controller1"})
+	err = controller.SetInputValue(device.Domain(), device.PublisherID(), node1ID,
+		types.InputTypeSwitch, types.DefaultInputInstance, "on")
+	assert.NoError(t, err)
+	assert.Equal(t, "on", rxValue)
+
+	controller.Stop()
+	device.Stop()
+}
+
+func TestPublishToDomain(t *testing.T) {
+	configFolder, _ := ioutil.TempDir("", "iotdomain")
+	defer os.RemoveAll(configFolder)
+	messenger := messaging.NewInMemoryMessenger(msgConfig)
+	var rxEvent *types.OutputEventMessage
+
+	deviceConfig := *test1Config
+	deviceConfig.ConfigFolder = configFolder
+	device := publisher.NewPublisher(&deviceConfig, messenger)
+	device.Start()
+	device.CreateNode(node1ID, types.NodeTypeUnknown)
+
+	// the bridge republishes the device node events into zone2
+	bridgeConfig := *test1Config
+	bridgeConfig.ConfigFolder = configFolder
+	bridgeConfig.PublisherID = "bridge1"
+	bridge := publisher.NewPublisher(&bridgeConfig, messenger)
+	bridge.Start()
+	bridge.BridgeNodeOutputs(device.GetNodeByHWID(node1ID).Address, "zone2")
+
+	receiverConfig := *test1Config
+	receiverConfig.ConfigFolder = configFolder
+	receiverConfig.Domain = "zone2"
+	receiverConfig.PublisherID = "receiver1"
+	receiver := publisher.NewPublisher(&receiverConfig, messenger)
+	receiver.Start()
+	receiver.SubscribeEvent("zone2/bridge1/publisher1."+node1ID, func(event *types.OutputEventMessage) {
+		rxEvent = event
+	})
+	rxHops := 0
+	messenger.Subscribe("zone2/bridge1/publisher1."+node1ID+"/$event", func(address string, message string) error {
+		rxHops = messaging.GetHopCount(message)
+		return nil
+	})
+
+	err := device.PublishEvent(node1ID, map[string]string{"switch": "on"})
+	assert.NoError(t, err)
+	require.NotNil(t, rxEvent, "Bridged event not received")
+	assert.Equal(t, 1, rxHops, "Bridged event must have a hop count of 1")
+	assert.Equal(t, "zone2/bridge1/publisher1."+node1ID+"/$event", rxEvent.Address)
+	assert.Equal(t, "test/publisher1/"+node1ID+"/$event", rxEvent.Origin)
+	assert.Equal(t, "on", rxEvent.Event["switch"])
+	bridgeIdent := receiver.GetPublisherKey("zone2/bridge1/$identity")
+	assert.NotNil(t, bridgeIdent, "Bridge identity in zone2 not received")
+
+	// a message that was already bridged keeps its origin
+	latest := &types.OutputLatestMessage{Origin: "zone3/publisher3/node3/switch/0/$latest", Value: "on"}
+	err = bridge.PublishToDomain("zone2", "test/publisher1/node1/switch/0/$latest", latest)
+	assert.NoError(t, err)
+	assert.Equal(t, "zone2/bridge1/publisher1.node1/switch/0/$latest", latest.Address)
+
+	// nodes with the same ID from different publishers don't collide
+	latest2 := &types.OutputLatestMessage{Value: "off"}
+	err = bridge.PublishToDomain("zone2", "test/publisher2/node1/switch/0/$latest", latest2)
+	assert.NoError(t, err)
+	assert.Equal(t, "zone2/bridge1/publisher2.node1/switch/0/$latest", latest2.Address)
+	assert.Equal(t, "zone3/publisher3/node3/switch/0/$latest", latest.Origin)
+
+	// error cases
+	err = bridge.PublishToDomain("zone2", "test/publisher1/node1/$node", &types.NodeDiscoveryMessage{})
+	assert.Error(t, err)
+	err = bridge.PublishToDomain("zone2", "test/publisher1", latest)
+	assert.Error(t, err)
+
+	receiver.Stop()
+	bridge.Stop()
+	device.Stop()
+}
+
+func TestSetClock(t *testing.T) {
+	var testMessenger = messaging.NewDummyMessenger(msgConfig)
+	pub1 := publisher.NewPublisher(test1Config, testMessenger)
+	clock := messaging.NewManualClock(time.Date(2020, 1, 1, 12, 0, 0, 0, time.Local))
+	pub1.SetClock(clock)
+	const clockNodeID = "clocknode1"
+	node := pub1.CreateNode(clockNodeID, types.NodeTypeUnknown)
+	assert.Equal(t, clock.Now().Format(types.TimeFormat), node.Timestamp)
+
+	clock.Advance(time.Hour)
+	pub1.SetNodeBattery(clockNodeID, 50)
+	node = pub1.GetNodeByHWID(clockNodeID)
+	assert.Equal(t, clock.Now().Format(types.TimeFormat), node.Timestamp)
+	pub1.SetClock(nil)
+}
+
+func TestSetNodeBatteryAndSignal(t *testing.T) {
+	var testMessenger = messaging.NewDummyMessenger(msgConfig)
+	pub1 := publisher.NewPublisher(test1Config, testMessenger)
+	pub1.CreateNode(node1ID, types.NodeTypeUnknown)
+
+	changed, err := pub1.SetNodeBattery(node1ID, 80)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	value, exists := pub1.GetNodeStatus(node1ID, types.NodeStatusBatteryLevel)
+	assert.True(t, exists)
+	assert.Equal(t, "80", value)
+	changed, err = pub1.SetNodeBattery(node1ID, 80)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// out of range
+	changed, err = pub1.SetNodeBattery(node1ID, 101)
+	assert.Error(t, err)
+	assert.False(t, changed)
+	_, err = pub1.SetNodeBattery(node1ID, -1)
+	assert.Error(t, err)
+	value, _ = pub1.GetNodeStatus(node1ID, types.NodeStatusBatteryLevel)
+	assert.Equal(t, "80", value)
+
+	assert.True(t, pub1.SetNodeSignal(node1ID, -70))
+	value, exists = pub1.GetNodeStatus(node1ID, types.NodeStatusSignalStrength)
+	assert.True(t, exists)
+	assert.Equal(t, "-70", value)
+	assert.False(t, pub1.SetNodeSignal(node1ID, -70))
+
+	// unknown nodes are not changed
+	changed, err = pub1.SetNodeBattery("fakeid", 50)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.False(t, pub1.SetNodeSignal("fakeid", -70))
+}
+
+func TestSetNodeFirmwareUpdate(t *testing.T) {
+	var testMessenger = messaging.NewDummyMessenger(msgConfig)
+	pub1 := publisher.NewPublisher(test1Config, testMessenger)
+	pub1.CreateNode(node1ID, types.NodeTypeUnknown)
+
+	assert.True(t, pub1.SetNodeFirmwareAvailable(node1ID, "1.2.0"))
+	assert.Equal(t, "1.2.0", pub1.GetNodeAttr(node1ID, types.NodeAttrFirmwareAvailable))
+	assert.False(t, pub1.SetNodeFirmwareAvailable(node1ID, "1.2.0"))
+	assert.True(t, pub1.SetNodeUpdatePending(node1ID, true))
+	assert.Equal(t, "true", pub1.GetNodeAttr(node1ID, types.NodeAttrUpdatePending))
+	assert.True(t, pub1.SetNodeUpdatePending(node1ID, false))
+	assert.Equal(t, "false", pub1.GetNodeAttr(node1ID, types.NodeAttrUpdatePending))
+
+	changed, err := pub1.SetNodeUpdateProgress(node1ID, 0)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	changed, err = pub1.SetNodeUpdateProgress(node1ID, 100)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	value, exists := pub1.GetNodeStatus(node1ID, types.NodeStatusUpdateProgress)
+	assert.True(t, exists)
+	assert.Equal(t, "100", value)
+
+	// out of range
+	changed, err = pub1.SetNodeUpdateProgress(node1ID, 101)
+	assert.Error(t, err)
+	assert.False(t, changed)
+	_, err = pub1.SetNodeUpdateProgress(node1ID, -1)
+	assert.Error(t, err)
+	value, _ = pub1.GetNodeStatus(node1ID, types.NodeStatusUpdateProgress)
+	assert.Equal(t, "100", value)
+
+	// unknown nodes are not changed
+	assert.False(t, pub1.SetNodeFirmwareAvailable("fakeid", "1.2.0"))
+	assert.False(t, pub1.SetNodeUpdatePending("fakeid", true))
+	changed, err = pub1.SetNodeUpdateProgress("fakeid", 10)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestSetNodeLocation(t *testing.T) {
+	var testMessenger = messaging.NewDummyMessenger(msgConfig)
+	pub1 := publisher.NewPublisher(test1Config, testMessenger)
+	pub1.CreateNode(node1ID, types.NodeTypeUnknown)
+
+	changed, err := pub1.SetNodeLocation(node1ID, 49.2827, -123.1207)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	latLon := pub1.GetNodeAttr(node1ID, types.NodeAttrLatLon)
+	assert.Equal(t, "49.282700,-123.120700", latLon)
+	lat, lon, err := types.ParseLatLon(latLon)
+	assert.NoError(t, err)
+	assert.Equal(t, 49.2827, lat)
+	assert.Equal(t, -123.1207, lon)
+
+	changed, err = pub1.SetNodeLocation(node1ID, 49.2827, -123.1207)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// out of range
+	changed, err = pub1.SetNodeLocation(node1ID, 91, 0)
+	assert.Error(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, latLon, pub1.GetNodeAttr(node1ID, types.NodeAttrLatLon))
+}
+
+func TestPublisherCapabilities(t *testing.T) {
+	configFolder, _ := ioutil.TempDir("", "iotdomain")
+	defer os.RemoveAll(configFolder)
+	messenger := messaging.NewInMemoryMessenger(msgConfig)
+
+	deviceConfig := *test1Config
+	deviceConfig.ConfigFolder = configFolder
+	device := publisher.NewPublisher(&deviceConfig, messenger)
+	device.Start()
+	defer device.Stop()
+	err := device.SetCapabilities(device.DefaultCapabilities())
+	assert.NoError(t, err)
+
+	controllerConfig := *test1Config
+	controllerConfig.ConfigFolder = configFolder
+	controllerConfig.PublisherID = "controller1"
+	controller := publisher.NewPublisher(&controllerConfig, messenger)
+	controller.Start()
+	defer controller.Stop()
+
+	// the signed identity with capabilities is accepted by the controller
+	capabilities := controller.GetPublisherCapabilities(deviceConfig.PublisherID)
+	require.NotNil(t, capabilities)
+	assert.True(t, capabilities.Supports(types.CapabilityEncryptedMessageTypes, string(types.MessageTypeSetInput)))
+	assert.True(t, capabilities.Supports(types.CapabilityAlgorithms, "ES256"))
+	assert.False(t, capabilities.Supports(types.CapabilityMessageTypes, string(types.MessageTypeUpgrade)))
+	assert.Nil(t, controller.GetPublisherCapabilities(controllerConfig.PublisherID))
+	assert.Nil(t, controller.GetPublisherCapabilities("unknown"))
+}
+
+func TestRequest(t *testing.T) {
+	configFolder, _ := ioutil.TempDir("", "iotdomain")
+	defer os.RemoveAll(configFolder)
+	messenger := messaging.NewInMemoryMessenger(msgConfig)
+
+	deviceConfig := *test1Config
+	deviceConfig.ConfigFolder = configFolder
+	device := publisher.NewPublisher(&deviceConfig, messenger)
+	device.Start()
+	node := device.CreateNode(node1ID, types.NodeTypeUnknown)
+	requestAddress := strings.TrimSuffix(node.Address, string(types.MessageTypeNodeDiscovery)) +
+		string(types.MessageTypeRequest)
+	rxSender := ""
+	rxCount := 0
+	stopHandling := device.HandleRequests(requestAddress, func(sender string, payload string) (string, error) {
+		rxSender = sender
+		rxCount++
+		if payload == "fail" {
+			return "", errors.New("request failed")
+		}
+		return "config of " + payload, nil
+	})
+
+	controllerConfig := *test1Config
+	controllerConfig.ConfigFolder = configFolder
+	controllerConfig.PublisherID = "controller1"
+	controller := publisher.NewPublisher(&controllerConfig, messenger)
+	controller.Start()
+
+	rawRequest := ""
+	messenger.Subscribe(requestAddress, func(address string, message string) error {
+		rawRequest = message
+		return nil
+	})
+	response, err := controller.Request(requestAddress, "node1", time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "config of node1", response)
+	assert.Equal(t, controller.Address(), rxSender)
+	assert.Equal(t, 1, rxCount)
+
+	// a replayed request is not handled again
+	require.NotEmpty(t, rawRequest)
+	messenger.Publish(requestAddress, false, rawRequest)
+	assert.Equal(t, 1, rxCount)
+
+	// requests with a stale timestamp are not handled
+	controller.SetClock(messaging.NewManualClock(time.Now().Add(-2 * publisher.MaxRequestAge)))
+	_, err = controller.Request(requestAddress, "node1", 50*time.Millisecond)
+	assert.True(t, errors.Is(err, publisher.ErrRequestTimeout))
+	assert.Equal(t, 1, rxCount)
+	controller.SetClock(nil)
+
+	// the responder's error is returned
+	_, err = controller.Request(requestAddress, "fail", time.Second)
+	assert.Error(t, err)
+
+	// without responder the request times out
+	start := time.Now()
+	_, err = controller.Request("test/publisher1/node2/$request", "node2", 50*time.Millisecond)
+	assert.True(t, errors.Is(err, publisher.ErrRequestTimeout))
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+	_, err = controller.Request("test", "", time.Second)
+	assert.Error(t, err)
+
+	// requests are no longer handled after stopping
+	stopHandling()
+	_, err = controller.Request(requestAddress, "node1", 50*time.Millisecond)
+	assert.True(t, errors.Is(err, publisher.ErrRequestTimeout))
+
+	controller.Stop()
+	device.Stop()
+}
+
+func TestAddressFormat(t *testing.T) {
+	defer types.SetAddressFormat(types.DefaultAddressFormat)
+	configFolder, _ := ioutil.TempDir("", "iotdomain")
+	defer os.RemoveAll(configFolder)
+	messenger := messaging.NewInMemoryMessenger(msgConfig)
+	addressFormat := types.AddressFormat{
+		MessageTypePrefix: "_",
+		SegmentOrder: []types.AddressSegment{types.SegmentPublisherID, types.SegmentDomain,
+			types.SegmentNodeID, types.SegmentOutputType, types.SegmentInstance},
+	}
+
+	// requests between publishers use the configured address format
+	deviceConfig := *test1Config
+	deviceConfig.ConfigFolder = configFolder
+	deviceConfig.AddressFormat = &addressFormat
+	device := publisher.NewPublisher(&deviceConfig, messenger)
+	device.Start()
+	defer device.Stop()
+	node := device.CreateNode(node1ID, types.NodeTypeUnknown)
+	assert.Equal(t, "publisher1/test/node1/_node", node.Address)
+	requestAddress := types.MakeMessageAddress(types.MakeBaseAddress(node.Address), types.MessageTypeRequest)
+	device.HandleRequests(requestAddress, func(sender string, payload string) (string, error) {
+		return "config of " + payload, nil
+	})
+
+	controllerConfig := deviceConfig
+	controllerConfig.PublisherID = "controller1"
+	controller := publisher.NewPublisher(&controllerConfig, messenger)
+	controller.Start()
+	defer controller.Stop()
+	response, err := controller.Request(requestAddress, "node1", time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "config of node1", response)
+
+	// a publisher with a different format doesn't change the format in use
+	otherConfig := controllerConfig
+	otherConfig.PublisherID = "other1"
+	otherConfig.AddressFormat = &types.AddressFormat{MessageTypePrefix: "@"}
+	other := publisher.NewPublisher(&otherConfig, messenger)
+	require.NotNil(t, other)
+	assert.Equal(t, "_", types.GetAddressFormat().MessageTypePrefix)
+}
+
+func TestRedactSecrets(t *testing.T) {
+	const password = "secretpassword"
+	const loginName = "secretlogin"
+	const apiKey = "secretapikey"
+	var testMessenger = messaging.NewDummyMessenger(msgConfig)
+	pub1 := publisher.NewPublisher(test1Config, testMessenger)
+	pub1.SetSigningOnOff(false)
+	node1 := pub1.CreateNode(node1ID, types.NodeTypeUnknown)
+	pub1.UpdateNodeConfig(node1ID, "apiKey", &types.ConfigAttr{Secret: true, Default: apiKey})
+	pub1.UpdateNodeAttr(node1ID, types.NodeAttrMap{
+		types.NodeAttrPassword:  password,
+		types.NodeAttrLoginName: loginName,
+		"apiKey":                apiKey,
+		types.NodeAttrName:      "node 1",
+	})
+	pub1.PublishUpdates()
+
+	published := testMessenger.FindLastPublication(node1.Address)
+	require.NotEmpty(t, published)
+	assert.NotContains(t, published, password)
+	assert.NotContains(t, published, loginName)
+	assert.NotContains(t, published, apiKey)
+	assert.Contains(t, published, "node 1")
+	assert.Contains(t, published, "apiKey", "Secret configuration should remain listed")
+
+	// secrets remain available to the publisher
+	assert.Equal(t, password, pub1.GetNodeAttr(node1ID, types.NodeAttrPassword))
+}
+
+func TestSaveLoadState(t *testing.T) {
+	const stateFile = "../test/teststate.json"
+	var testMessenger = messaging.NewDummyMessenger(msgConfig)
+	pub1 := publisher.NewPublisher(test1Config, testMessenger)
+	pub1.Start()
+	pub1.Subscribe(test1Config.Domain, test1Config.PublisherID)
+	pub1.CreateNode(node1ID, types.NodeTypeUnknown)
+	pub1.CreateInput(node1ID, node1InputType, types.DefaultInputInstance, nil)
+	pub1.CreateOutput(node1ID, node1Output1Type, types.DefaultOutputInstance)
+	pub1.PublishUpdates()
+	domainNodes := pub1.GetDomainNodes()
+	require.Len(t, domainNodes, 1)
+	err := pub1.SaveState(stateFile, false)
+	assert.NoError(t, err)
+	pub1.Stop()
+	defer os.Remove(stateFile)
+
+	// discovered entities are restored without waiting for publications
+	pub2 := publisher.NewPublisher(test1Config, messaging.NewDummyMessenger(msgConfig))
+	err = pub2.LoadState(stateFile)
+	assert.NoError(t, err)
+	assert.Len(t, pub2.GetDomainNodes(), 1)
+	assert.Len(t, pub2.GetDomainInputs(), 1)
+	assert.Len(t, pub2.GetDomainOutputs(), 1)
+	assert.NotNil(t, pub2.GetDomainNode(domainNodes[0].Address))
+
+	// a state of another version with unknown fields still loads
+	otherVersion := `{"version": 99, "unknownField": "value", "nodes": [{"address": "test/publisher2/node2/$node"}]}`
+	err = ioutil.WriteFile(stateFile, []byte(otherVersion), 0600)
+	require.NoError(t, err)
+	err = pub2.LoadState(stateFile)
+	assert.NoError(t, err)
+	assert.Len(t, pub2.GetDomainNodes(), 2)
+
+	// cached entities don't replace newer discovered entities
+	const node3Address = "test/publisher2/node3/$node"
+	const node3State = `{"version": 1, "nodes": [{"address": "%s", "hwID": "%s", "timestamp": "%s"}]}`
+	now := time.Now()
+	ioutil.WriteFile(stateFile, []byte(fmt.Sprintf(node3State, node3Address, "current", now.Format(types.TimeFormat))), 0600)
+	err = pub2.LoadState(stateFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "current", pub2.GetDomainNode(node3Address).HWID)
+	olderState := fmt.Sprintf(node3State, node3Address, "older", now.Add(-time.Hour).Format(types.TimeFormat))
+	ioutil.WriteFile(stateFile, []byte(olderState), 0600)
+	err = pub2.LoadState(stateFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "current", pub2.GetDomainNode(node3Address).HWID)
+	newerState := fmt.Sprintf(node3State, node3Address, "newer", now.Add(time.Hour).Format(types.TimeFormat))
+	ioutil.WriteFile(stateFile, []byte(newerState), 0600)
+	err = pub2.LoadState(stateFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "newer", pub2.GetDomainNode(node3Address).HWID)
+
+	// nodes cached as a list of nodes are loaded
+	nodeList := `[{"address": "test/publisher2/node4/$node"}]`
+	ioutil.WriteFile(stateFile, []byte(nodeList), 0600)
+	err = pub2.LoadState(stateFile)
+	assert.NoError(t, err)
+	assert.NotNil(t, pub2.GetDomainNode("test/publisher2/node4/$node"))
+
+	// error cases
+	err = pub2.LoadState("../test/doesnotexist.json")
+	assert.Error(t, err)
+	ioutil.WriteFile(stateFile, []byte("not json"), 0600)
+	err = pub2.LoadState(stateFile)
+	assert.Error(t, err)
+	err = pub2.SaveState("/notafolder/state.json", false)
+	assert.Error(t, err)
+}
+
+func TestSaveLoadEncryptedState(t *testing.T) {
+	const stateFile = "../test/teststate.json"
+	const loginName = "user1login"
+	const password = "user1secret"
+	pub1 := publisher.NewPublisher(test1Config, messaging.NewDummyMessenger(msgConfig))
+	defer os.Remove(stateFile)
+
+	// a discovered node with credentials in its configuration
+	plainState := `{"version": 1, "nodes": [{"address": "test/publisher2/node2/$node", "attr": {` +
+		`"loginName": "` + loginName + `", "password": "` + password + `"}}]}`
+	err := ioutil.WriteFile(stateFile, []byte(plainState), 0600)
+	require.NoError(t, err)
+	err = pub1.LoadState(stateFile)
+	require.NoError(t, err)
+	require.Len(t, pub1.GetDomainNodes(), 1)
+
+	// the credentials can't be read from the encrypted file
+	err = pub1.SaveState(stateFile, true)
+	require.NoError(t, err)
+	stateData, err := ioutil.ReadFile(stateFile)
+	require.NoError(t, err)
+	assert.NotContains(t, string(stateData), loginName)
+	assert.NotContains(t, string(stateData), password)
+	assert.NotContains(t, string(stateData), "node2")
+
+	// the publisher that saved it can load it
+	pub2 := publisher.NewPublisher(test1Config, messaging.NewDummyMessenger(msgConfig))
+	err = pub2.LoadState(stateFile)
+	require.NoError(t, err)
+	nodes := pub2.GetDomainNodes()
+	require.Len(t, nodes, 1)
+	assert.Equal(t, password, nodes[0].Attr[types.NodeAttrPassword])
+
+	// another publisher can't
+	otherConfig := *test1Config
+	otherConfig.ConfigFolder = ""
+	otherConfig.PublisherID = "publisher2"
+	pub3 := publisher.NewPublisher(&otherConfig, messaging.NewDummyMessenger(msgConfig))
+	err = pub3.LoadState(stateFile)
+	assert.Error(t, err)
+	assert.Len(t, pub3.GetDomainNodes(), 0)
+}
+
 func TestPublishEvent(t *testing.T) {
 	// setup
 	var testMessenger = messaging.NewDummyMessenger(msgConfig)
@@ -209,6 +935,203 @@ func TestPublishEvent(t *testing.T) {
 	// TODO: check result
 }
 
+func TestPublishNodeEvent(t *testing.T) {
+	var testMessenger = messaging.NewDummyMessenger(msgConfig)
+	var rxEvent *types.OutputEventMessage
+	pub1 := publisher.NewPublisher(test1Config, testMessenger)
+	pub1.Start()
+	node1 := pub1.CreateNode(node1ID, types.NodeTypeUnknown)
+	pub1.SubscribeEvent(node1.Address, func(event *types.OutputEventMessage) {
+		rxEvent = event
+	})
+
+	event := map[string]string{"state": "open", "battery": "80", "tamper": "false"}
+	err := pub1.PublishEvent(node1ID, event)
+	assert.NoError(t, err)
+	require.NotNil(t, rxEvent, "Event not received")
+	assert.Equal(t, event, rxEvent.Event)
+	assert.Equal(t, outputs.ReplaceMessageType(node1.Address, types.MessageTypeEvent), rxEvent.Address)
+	_, err = time.Parse(types.TimeFormat, rxEvent.Timestamp)
+	assert.NoError(t, err)
+
+	// error case - unknown node
+	err = pub1.PublishEvent("unknownNode", event)
+	assert.Error(t, err)
+	pub1.Stop()
+}
+
+// TestSetOutputTransform tests that the output transform is applied and included in the output discovery
+func TestSetOutputTransform(t *testing.T) {
+	var testMessenger = messaging.NewDummyMessenger(msgConfig)
+	pub1 := publisher.NewPublisher(test1Config, testMessenger)
+	pub1.CreateNode(node1ID, types.NodeTypeUnknown)
+	transform := outputs.ValueTransform{{Op: outputs.TransformScale, Value: 10}}
+
+	// the output must exist
+	err := pub1.SetOutputTransform(node1ID, types.OutputTypeVoltage, types.DefaultOutputInstance, transform)
+	assert.Error(t, err)
+	pub1.CreateOutput(node1ID, types.OutputTypeVoltage, types.DefaultOutputInstance)
+	err = pub1.SetOutputTransform(node1ID, types.OutputTypeVoltage, types.DefaultOutputInstance, transform)
+	require.NoError(t, err)
+	output := pub1.GetOutputByNodeHWID(node1ID, types.OutputTypeVoltage, types.DefaultOutputInstance)
+	require.NotNil(t, output)
+	assert.Equal(t, transform.OutputTransform(), output.Transform)
+	pub1.UpdateOutputValue(node1ID, types.OutputTypeVoltage, types.DefaultOutputInstance, "1.5")
+	assert.Equal(t, "15", pub1.GetOutputValueByNodeHWID(node1ID, types.OutputTypeVoltage, types.DefaultOutputInstance).Value)
+
+	// invalid transforms are rejected
+	err = pub1.SetOutputTransform(node1ID, types.OutputTypeVoltage, types.DefaultOutputInstance,
+		outputs.ValueTransform{{Op: "unknown"}})
+	assert.Error(t, err)
+
+	// removing the transform removes it from the discovery
+	err = pub1.SetOutputTransform(node1ID, types.OutputTypeVoltage, types.DefaultOutputInstance, nil)
+	require.NoError(t, err)
+	output = pub1.GetOutputByNodeHWID(node1ID, types.OutputTypeVoltage, types.DefaultOutputInstance)
+	assert.Nil(t, output.Transform)
+}
+
+// TestUpdateOutputValues tests that bulk updated output values are published in the same cycle
+func TestUpdateOutputValues(t *testing.T) {
+	var testMessenger = messaging.NewDummyMessenger(msgConfig)
+	pub1 := publisher.NewPublisher(test1Config, testMessenger)
+	pub1.CreateNode(node1ID, types.NodeTypeMultisensor)
+	tempOutput := pub1.CreateOutput(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance)
+	humOutput := pub1.CreateOutput(node1ID, types.OutputTypeHumidity, types.DefaultOutputInstance)
+	pub1.PublishUpdates()
+
+	tempLatestAddr := outputs.ReplaceMessageType(tempOutput.Address, types.MessageTypeLatest)
+	humLatestAddr := outputs.ReplaceMessageType(humOutput.Address, types.MessageTypeLatest)
+	assert.Empty(t, testMessenger.FindLastPublication(tempLatestAddr))
+	assert.Empty(t, testMessenger.FindLastPublication(humLatestAddr))
+
+	count := pub1.UpdateOutputValues(node1ID, map[outputs.OutputKey]string{
+		{OutputType: types.OutputTypeTemperature, Instance: types.DefaultOutputInstance}: "21.5",
+		{OutputType: types.OutputTypeHumidity, Instance: types.DefaultOutputInstance}:    "65",
+	})
+	assert.Equal(t, 2, count)
+
+	// a single publication cycle must publish all values
+	pub1.PublishUpdates()
+	assert.NotEmpty(t, testMessenger.FindLastPublication(tempLatestAddr))
+	assert.NotEmpty(t, testMessenger.FindLastPublication(humLatestAddr))
+
+	val := pub1.GetOutputValueByNodeHWID(node1ID, types.OutputTypeHumidity, types.DefaultOutputInstance)
+	require.NotNil(t, val)
+	assert.Equal(t, "65", val.Value)
+}
+
+// TestTypedValues tests publication of typed values in $latest messages
+func TestTypedValues(t *testing.T) {
+	var testMessenger = messaging.NewDummyMessenger(msgConfig)
+	config := *test1Config
+	config.TypedValues = true
+	pub1 := publisher.NewPublisher(&config, testMessenger)
+	pub1.CreateNode(node1ID, types.NodeTypeMultisensor)
+	tempOutput := pub1.CreateOutput(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance)
+	switchOutput := pub1.CreateOutput(node1ID, types.OutputTypeSwitch, types.DefaultOutputInstance)
+	pub1.UpdateOutputValue(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance, "21.5")
+	pub1.UpdateOutputValue(node1ID, types.OutputTypeSwitch, types.DefaultOutputInstance, "off")
+	pub1.PublishUpdates()
+
+	var latest types.OutputLatestMessage
+	tempLatestAddr := outputs.ReplaceMessageType(tempOutput.Address, types.MessageTypeLatest)
+	_, err := messaging.VerifySenderJWSSignature(testMessenger.FindLastPublication(tempLatestAddr), &latest, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "21.5", latest.Value)
+	assert.Equal(t, 21.5, latest.TypedValue)
+
+	switchLatestAddr := outputs.ReplaceMessageType(switchOutput.Address, types.MessageTypeLatest)
+	latest = types.OutputLatestMessage{}
+	_, err = messaging.VerifySenderJWSSignature(testMessenger.FindLastPublication(switchLatestAddr), &latest, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "off", latest.Value)
+	assert.Equal(t, false, latest.TypedValue)
+
+	// a non-finite number is published without typed value
+	pub1.UpdateOutputValue(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance, "NaN")
+	pub1.PublishUpdates()
+	latest = types.OutputLatestMessage{}
+	_, err = messaging.VerifySenderJWSSignature(testMessenger.FindLastPublication(tempLatestAddr), &latest, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "NaN", latest.Value)
+	assert.Nil(t, latest.TypedValue)
+
+	// typed values are off by default
+	testMessenger = messaging.NewDummyMessenger(msgConfig)
+	pub2 := publisher.NewPublisher(test1Config, testMessenger)
+	pub2.CreateNode(node1ID, types.NodeTypeMultisensor)
+	pub2.CreateOutput(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance)
+	pub2.UpdateOutputValue(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance, "21.5")
+	pub2.PublishUpdates()
+	assert.NotContains(t, testMessenger.FindLastPublication(tempLatestAddr), "typedValue")
+}
+
+// TestPublishLatestWithTTL tests publication of $latest values with an expiry
+func TestPublishLatestWithTTL(t *testing.T) {
+	var testMessenger = messaging.NewDummyMessenger(msgConfig)
+	pub1 := publisher.NewPublisher(test1Config, testMessenger)
+	pub1.CreateNode(node1ID, types.NodeTypeMultisensor)
+	output := pub1.CreateOutput(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance)
+	latestAddr := outputs.ReplaceMessageType(output.Address, types.MessageTypeLatest)
+	pub1.PublishLatestWithTTL(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance, "21", time.Minute)
+	pub1.PublishUpdates()
+
+	// the expiry is part of the signed message
+	var latest types.OutputLatestMessage
+	_, err := messaging.VerifySenderJWSSignature(testMessenger.FindLastPublication(latestAddr), &latest, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "21", latest.Value)
+	timestamp, _ := time.Parse(types.TimeFormat, latest.Timestamp)
+	expires, err := time.Parse(types.TimeFormat, latest.Expires)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, expires.Sub(timestamp))
+	assert.True(t, latest.IsExpired(timestamp.Add(time.Minute)))
+	// $raw and $history don't expire and are not published
+	rawAddr := outputs.ReplaceMessageType(output.Address, types.MessageTypeRaw)
+	historyAddr := outputs.ReplaceMessageType(output.Address, types.MessageTypeHistory)
+	assert.Empty(t, testMessenger.FindLastPublication(rawAddr))
+	assert.Empty(t, testMessenger.FindLastPublication(historyAddr))
+
+	// the TTL applies until it is removed
+	pub1.UpdateOutputValue(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance, "22")
+	pub1.PublishUpdates()
+	latest = types.OutputLatestMessage{}
+	messaging.VerifySenderJWSSignature(testMessenger.FindLastPublication(latestAddr), &latest, nil)
+	assert.Equal(t, "22", latest.Value)
+	assert.NotEmpty(t, latest.Expires)
+	pub1.PublishLatestWithTTL(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance, "23", 0)
+	pub1.PublishUpdates()
+	latest = types.OutputLatestMessage{}
+	messaging.VerifySenderJWSSignature(testMessenger.FindLastPublication(latestAddr), &latest, nil)
+	assert.Equal(t, "23", latest.Value)
+	assert.Empty(t, latest.Expires)
+	assert.NotEmpty(t, testMessenger.FindLastPublication(rawAddr))
+	assert.NotEmpty(t, testMessenger.FindLastPublication(historyAddr))
+}
+
+// TestUpdateOutputValueValidated tests rejection of output values that don't match the data type
+func TestUpdateOutputValueValidated(t *testing.T) {
+	var testMessenger = messaging.NewDummyMessenger(msgConfig)
+	pub1 := publisher.NewPublisher(test1Config, testMessenger)
+	pub1.CreateNode(node1ID, types.NodeTypeMultisensor)
+	output := pub1.CreateOutput(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance)
+	output.DataType = types.DataTypeNumber
+
+	updated, err := pub1.UpdateOutputValueValidated(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance, "21.5")
+	assert.NoError(t, err)
+	assert.True(t, updated)
+	updated, err = pub1.UpdateOutputValueValidated(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance, "N/A")
+	assert.Error(t, err)
+	assert.False(t, updated)
+	val := pub1.GetOutputValueByNodeHWID(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance)
+	require.NotNil(t, val)
+	assert.Equal(t, "21.5", val.Value)
+
+	_, err = pub1.UpdateOutputValueValidated(node1ID, types.OutputTypeHumidity, types.DefaultOutputInstance, "1")
+	assert.Error(t, err)
+}
+
 // run a bunch of facade commands with invalid arguments
 func TestErrors(t *testing.T) {
 	var testMessenger = messaging.NewDummyMessenger(msgConfig)
@@ -232,6 +1155,7 @@ func TestErrors(t *testing.T) {
 	pub1.GetIdentityKeys()
 	pub1.GetInputByNodeHWID("fakenode", "", "")
 	pub1.GetInputs()
+	pub1.GetNodeAlias("fakenode")
 	pub1.GetNodeAttr("fakenode", "fakeattr")
 	pub1.GetNodeByAddress("fakeaddr")
 	pub1.GetNodeByHWID("fakenode")
@@ -251,7 +1175,14 @@ func TestErrors(t *testing.T) {
 	pub1.MakeNodeDiscoveryAddress("fakeid")
 	pub1.PublishNodeConfigure("fakeaddr", types.NodeAttrMap{})
 	pub1.PublishRaw(out1, true, "value")
+	pub1.ResolveAliasAddress("fakeaddr")
 	pub1.SetNodeConfigHandler(nil)
+	pub1.SetNodeBattery("fakeid", 50)
+	pub1.SetNodeSignal("fakeid", -70)
+	pub1.SetNodeLocation("fakeid", 49.28, -123.12)
+	pub1.SetNodeFirmwareAvailable("fakeid", "1.2.0")
+	pub1.SetNodeUpdatePending("fakeid", true)
+	pub1.SetNodeUpdateProgress("fakeid", 10)
 	pub1.SetSigningOnOff(true)
 	pub1.Subscribe("", "")
 	pub1.Unsubscribe("", "")
@@ -263,3 +1194,179 @@ func TestErrors(t *testing.T) {
 	pub1.UpdateOutput(nil)
 	pub1.UpdateOutputForecast("fakeid", []types.OutputValue{})
 }
+
+func TestUpdateStaleNodes(t *testing.T) {
+	var testMessenger = messaging.NewDummyMessenger(msgConfig)
+	pub1 := publisher.NewPublisher(test1Config, testMessenger)
+	pub1.SetSigningOnOff(false)
+	pub1.CreateNode(node1ID, types.NodeTypeUnknown)
+	pub1.CreateOutput(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance)
+	pub1.UpdateNodeErrorStatus(node1ID, types.NodeRunStateReady, "")
+
+	// outputs without a value aren't stale
+	pub1.SetOutputMaxAge(types.OutputTypeTemperature, 10*time.Millisecond)
+	pub1.UpdateStaleNodes()
+	runState, _ := pub1.GetNodeStatus(node1ID, types.NodeStatusRunState)
+	assert.Equal(t, types.NodeRunStateReady, runState)
+
+	pub1.UpdateOutputValue(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance, "20")
+	time.Sleep(20 * time.Millisecond)
+	pub1.UpdateStaleNodes()
+	runState, _ = pub1.GetNodeStatus(node1ID, types.NodeStatusRunState)
+	assert.Equal(t, types.NodeRunStateError, runState)
+	lastError, _ := pub1.GetNodeStatus(node1ID, types.NodeStatusLastError)
+	assert.Equal(t, publisher.StaleOutputsError, lastError)
+
+	// reporting an unchanged value recovers the node
+	pub1.UpdateOutputValue(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance, "20")
+	pub1.UpdateStaleNodes()
+	runState, _ = pub1.GetNodeStatus(node1ID, types.NodeStatusRunState)
+	assert.Equal(t, types.NodeRunStateReady, runState)
+}
+
+func TestGracefulStop(t *testing.T) {
+	var testMessenger = messaging.NewDummyMessenger(msgConfig)
+	pub1 := publisher.NewPublisher(test1Config, testMessenger)
+	pub1.SetSigningOnOff(false)
+	// stop before start has no effect
+	pub1.Stop()
+	assert.Equal(t, 0, testMessenger.NrPublications())
+
+	pub1.Start()
+	node1 := pub1.CreateNode(node1ID, types.NodeTypeUnknown)
+	pub1.UpdateNodeErrorStatus(node1ID, types.NodeRunStateReady, "")
+	pub1.PublishUpdates()
+	pub1.Stop()
+
+	// the node and publisher are disconnected
+	var nodeMsg types.NodeDiscoveryMessage
+	_, err := messaging.VerifySenderJWSSignature(testMessenger.FindLastPublication(node1.Address), &nodeMsg, nil)
+	require.NoError(t, err)
+	assert.Equal(t, types.NodeRunStateDisconnected, nodeMsg.Status[types.NodeStatusRunState])
+	var statusMsg types.PublisherStatusMessage
+	statusAddr := identities.MakePublisherStatusAddress(pub1.Domain(), pub1.PublisherID())
+	_, err = messaging.VerifySenderJWSSignature(testMessenger.FindLastPublication(statusAddr), &statusMsg, nil)
+	require.NoError(t, err)
+	assert.Equal(t, types.PublisherRunStateDisconnected, statusMsg.Status)
+
+	// a second stop has no effect
+	nrPublications := testMessenger.NrPublications()
+	pub1.Stop()
+	assert.Equal(t, nrPublications, testMessenger.NrPublications())
+}
+
+func TestSimulation(t *testing.T) {
+	configFolder, _ := ioutil.TempDir("", "iotdomain")
+	defer os.RemoveAll(configFolder)
+	simConfig := *test1Config
+	simConfig.ConfigFolder = configFolder
+	simConfig.Simulation = true
+	pub1 := publisher.NewPublisher(&simConfig, nil)
+	require.NotNil(t, pub1)
+	pub1.Start()
+	node1 := pub1.CreateNode(node1ID, types.NodeTypeUnknown)
+	pub1.PublishUpdates()
+
+	// publications are captured with their signed payload
+	published := pub1.GetPublishedMessages()
+	var nodeMsg *messaging.PublishedMessage
+	for index := range published {
+		if published[index].Address == node1.Address {
+			nodeMsg = &published[index]
+		}
+	}
+	require.NotNil(t, nodeMsg, "Node publication not captured")
+	assert.True(t, nodeMsg.Retained)
+	var node types.NodeDiscoveryMessage
+	isSigned, err := messaging.VerifySenderJWSSignature(nodeMsg.Message, &node, pub1.GetPublisherKey)
+	assert.NoError(t, err)
+	assert.True(t, isSigned)
+	assert.Equal(t, node1ID, node.NodeID)
+
+	// synthetic messages are delivered to subscriptions
+	pub2Ident, pub2Keys := identities.CreateIdentity(simConfig.Domain, "publisher2")
+	pub2Signer := messaging.NewMessageSigner(nil, pub2Keys, nil)
+	identMsg, _ := pub2Signer.SignObject(&pub2Ident.PublisherIdentityMessage)
+	count := pub1.SimulateMessage(pub2Ident.Address, identMsg)
+	assert.True(t, count > 0)
+	assert.NotNil(t, pub1.GetPublisherKey(pub2Ident.Address))
+	pub1.Stop()
+
+	// not in simulation mode
+	pub3 := publisher.NewPublisher(test1Config, messaging.NewDummyMessenger(msgConfig))
+	assert.Nil(t, pub3.GetPublishedMessages())
+	assert.Equal(t, 0, pub3.SimulateMessage(pub2Ident.Address, identMsg))
+}
+
+// unreachableMessenger fails to connect
+type unreachableMessenger struct {
+	*messaging.InMemoryMessenger
+}
+
+func (messenger *unreachableMessenger) Connect(lastWillAddress string, lastWillValue string) error {
+	return errors.New("broker unreachable")
+}
+
+func TestStartSequence(t *testing.T) {
+	configFolder, _ := ioutil.TempDir("", "iotdomain")
+	defer os.RemoveAll(configFolder)
+	messenger := messaging.NewInMemoryMessenger(msgConfig)
+
+	deviceConfig := *test1Config
+	deviceConfig.ConfigFolder = configFolder
+
+	// a publisher that can't reach the bus isn't started
+	unreachable := publisher.NewPublisher(&deviceConfig, &unreachableMessenger{messenger})
+	err := unreachable.Start()
+	assert.Error(t, err)
+	assert.False(t, unreachable.IsRunning())
+	unreachable.Stop()
+
+	device := publisher.NewPublisher(&deviceConfig, messenger)
+	err = device.Start()
+	require.NoError(t, err)
+	defer device.Stop()
+	assert.True(t, device.IsRunning())
+
+	// the retained identity of the device is known when Start returns
+	controllerConfig := *test1Config
+	controllerConfig.ConfigFolder = configFolder
+	controllerConfig.PublisherID = "controller1"
+	controller := publisher.NewPublisher(&controllerConfig, messenger)
+	assert.False(t, controller.IsRunning())
+	assert.Nil(t, controller.GetPublisherKey(device.Address()))
+
+	// concurrent starts only start once
+	done := make(chan error)
+	for i := 0; i < 2; i++ {
+		go func() { done <- controller.Start() }()
+	}
+	assert.NoError(t, <-done)
+	assert.NoError(t, <-done)
+	assert.True(t, controller.IsRunning())
+	assert.NotNil(t, controller.GetPublisherKey(device.Address()))
+
+	controller.Stop()
+	assert.False(t, controller.IsRunning())
+	controller.Stop()
+}
+
+// TestOutputFormat tests formatting of output values on publication
+func TestOutputFormat(t *testing.T) {
+	var testMessenger = messaging.NewDummyMessenger(msgConfig)
+	pub1 := publisher.NewPublisher(test1Config, testMessenger)
+	pub1.CreateNode(node1ID, types.NodeTypeMultisensor)
+	tempOutput := pub1.CreateOutput(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance)
+	pub1.SetOutputFormat(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance,
+		&outputs.ValueFormat{Decimals: 2})
+	pub1.UpdateOutputValue(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance, "23.456789")
+	pub1.PublishUpdates()
+
+	var latest types.OutputLatestMessage
+	tempLatestAddr := outputs.ReplaceMessageType(tempOutput.Address, types.MessageTypeLatest)
+	_, err := messaging.VerifySenderJWSSignature(testMessenger.FindLastPublication(tempLatestAddr), &latest, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "23.46", latest.Value)
+	val := pub1.GetOutputValueByNodeHWID(node1ID, types.OutputTypeTemperature, types.DefaultOutputInstance)
+	assert.Equal(t, "23.456789", val.Value)
+}
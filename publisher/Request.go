@@ -0,0 +1,169 @@
+// Package publisher with request/response over the message bus
+package publisher
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/lib"
+	"github.com/iotdomain/iotdomain-go/types"
+)
+
+// ErrRequestTimeout is returned when no response to a request is received in time
+var ErrRequestTimeout = errors.New("request timed out")
+
+// MaxRequestAge is the max difference between the timestamp of a request and the time it is handled.
+// Requests with a timestamp that differs more are rejected so recorded requests can't be replayed.
+const MaxRequestAge = time.Minute
+
+// HandleRequests subscribes to requests on the given address and publishes the result of the handler
+// as the response. Requests must be signed by the sender. The response is signed by this publisher
+// and encrypted if the sender's identity is known. Requests with a timestamp that differs more than
+// MaxRequestAge from the current time, and requests that were already handled, are rejected.
+//  address is the request address, eg domain/publisherID/nodeID/$request of a registered node
+//  handler is invoked with the identity address of the sender and the request payload. It returns
+//  the response payload, or an error that is passed to the requester.
+// Returns a function that stops handling requests on the address
+func (pub *Publisher) HandleRequests(address string,
+	handler func(sender string, payload string) (string, error)) (stop func()) {
+	// timestamps of handled requests by correlation ID, to reject replays within the max age
+	handled := make(map[string]time.Time)
+	handledMutex := &sync.Mutex{}
+
+	subscriptionID := pub.messageSigner.Subscribe(address, func(rxAddress string, rawMessage string) error {
+		var request types.RequestMessage
+		_, isSigned, err := pub.messageSigner.DecodeMessage(rawMessage, &request)
+		if err != nil {
+			return lib.MakeErrorf("HandleRequests: Request on %s discarded: %s", rxAddress, err)
+		} else if !isSigned {
+			return lib.MakeErrorf("HandleRequests: Request on %s is not signed. Request discarded", rxAddress)
+		}
+		// only reply to the sender, so requests can't be used to publish to other publishers
+		sender, err := types.ParseBaseAddress(request.Sender)
+		replyTo, err2 := types.ParseBaseAddress(request.ReplyTo)
+		if err != nil || err2 != nil || sender.Domain != replyTo.Domain || sender.PublisherID != replyTo.PublisherID {
+			return lib.MakeErrorf("HandleRequests: Reply address '%s' of request on %s isn't of sender '%s'",
+				request.ReplyTo, rxAddress, request.Sender)
+		}
+		// the timestamp is signed so a replayed request can't be made recent
+		now := pub.messageSigner.Clock().Now()
+		timestamp, err := time.Parse(types.TimeFormat, request.Timestamp)
+		if err != nil || now.Sub(timestamp) > MaxRequestAge || timestamp.Sub(now) > MaxRequestAge {
+			return lib.MakeErrorf("HandleRequests: Request on %s from '%s' has a stale timestamp '%s'. Request discarded",
+				rxAddress, request.Sender, request.Timestamp)
+		}
+		handledMutex.Lock()
+		for correlationID, handledTime := range handled {
+			if now.Sub(handledTime) > MaxRequestAge {
+				delete(handled, correlationID)
+			}
+		}
+		_, isReplay := handled[request.CorrelationID]
+		handled[request.CorrelationID] = timestamp
+		handledMutex.Unlock()
+		if isReplay {
+			return lib.MakeErrorf("HandleRequests: Request %s on %s was already handled. Request discarded",
+				request.CorrelationID, rxAddress)
+		}
+		payload, err := handler(request.Sender, request.Payload)
+		response := types.ResponseMessage{
+			Address:       request.ReplyTo,
+			CorrelationID: request.CorrelationID,
+			Payload:       payload,
+			Sender:        pub.Address(),
+			Timestamp:     pub.messageSigner.Clock().Now().Format(types.TimeFormat),
+		}
+		if err != nil {
+			response.Error = err.Error()
+		}
+		return pub.messageSigner.PublishObject(request.ReplyTo, false, &response, pub.GetPublisherKey(request.Sender))
+	})
+	return func() {
+		pub.messageSigner.UnsubscribeByID(subscriptionID)
+	}
+}
+
+// Request publishes a signed request and waits for the response. The response is received on a
+// temporary subscription that is removed when the response is received or the request times out.
+// The request is encrypted if the identity of the publisher of the request address is known.
+// Only responses that are signed by the publisher of the request address are accepted.
+//  address is the address of the request, eg domain/publisherID/nodeID/$request. See HandleRequests.
+//  payload is the request content
+//  timeout is the max time to wait for a response
+// Returns the response payload, the error reported by the responder, or ErrRequestTimeout
+func (pub *Publisher) Request(address string, payload string, timeout time.Duration) (response string, err error) {
+	target, err := types.ParseBaseAddress(address)
+	if err != nil {
+		return "", lib.MakeErrorf("Request: Address '%s' has no publisher", address)
+	}
+	correlationID, err := makeCorrelationID()
+	if err != nil {
+		return "", lib.MakeErrorf("Request: Unable to create a correlation ID: %s", err)
+	}
+	replyTo := MakeResponseAddress(pub.Domain(), pub.PublisherID(), correlationID)
+	responseChannel := make(chan *types.ResponseMessage, 1)
+
+	handler := func(rxAddress string, rawMessage string) error {
+		var rxResponse types.ResponseMessage
+		_, isSigned, err := pub.messageSigner.DecodeMessage(rawMessage, &rxResponse)
+		if err != nil {
+			return lib.MakeErrorf("Request: Response on %s discarded: %s", rxAddress, err)
+		} else if !isSigned {
+			return lib.MakeErrorf("Request: Response on %s is not signed. Response discarded", rxAddress)
+		}
+		sender, err := types.ParseBaseAddress(rxResponse.Sender)
+		if rxResponse.CorrelationID != correlationID || err != nil ||
+			sender.Domain != target.Domain || sender.PublisherID != target.PublisherID {
+			return lib.MakeErrorf("Request: Response on %s from '%s' doesn't match the request. Response discarded",
+				rxAddress, rxResponse.Sender)
+		}
+		select {
+		case responseChannel <- &rxResponse:
+		default:
+			// already responded
+		}
+		return nil
+	}
+	subscriptionID := pub.messageSigner.Subscribe(replyTo, handler)
+	defer pub.messageSigner.UnsubscribeByID(subscriptionID)
+
+	request := types.RequestMessage{
+		Address:       address,
+		CorrelationID: correlationID,
+		Payload:       payload,
+		ReplyTo:       replyTo,
+		Sender:        pub.Address(),
+		Timestamp:     pub.messageSigner.Clock().Now().Format(types.TimeFormat),
+	}
+	err = pub.messageSigner.PublishObject(address, false, &request, pub.GetPublisherKey(address))
+	if err != nil {
+		return "", err
+	}
+	select {
+	case rxResponse := <-responseChannel:
+		if rxResponse.Error != "" {
+			return rxResponse.Payload, lib.MakeErrorf("Request: Request to %s failed: %s", address, rxResponse.Error)
+		}
+		return rxResponse.Payload, nil
+	case <-time.After(timeout):
+		return "", fmt.Errorf("Request: No response from %s: %w", address, ErrRequestTimeout)
+	}
+}
+
+// MakeResponseAddress returns the address that the response to a request is published on
+//  domain/publisherID/correlationID/$response
+func MakeResponseAddress(domain string, publisherID string, correlationID string) string {
+	return types.MakeAddress(&types.AddressSegments{
+		Domain: domain, PublisherID: publisherID, NodeID: correlationID, MessageType: types.MessageTypeResponse})
+}
+
+// makeCorrelationID returns a random ID to match a response with its request
+func makeCorrelationID() (string, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	return hex.EncodeToString(id), err
+}
@@ -0,0 +1,41 @@
+// Package publisher - detection of nodes whose output values are stale
+package publisher
+
+import (
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/types"
+)
+
+// StaleNodeCheckInterval is the interval in which registered nodes are checked for stale outputs
+const StaleNodeCheckInterval = 10 * time.Second
+
+// StaleOutputsError is the lastError status of nodes whose outputs are all stale
+const StaleOutputsError = "Output values are stale"
+
+// UpdateStaleNodes sets the run state of registered nodes whose output values are all stale to error.
+// Outputs are stale when their value isn't reported within the max age of their output type, see
+// SetOutputMaxAge. Outputs that never reported a value are not considered stale.
+// Nodes that were marked stale return to ready when one of their outputs reports a value again.
+func (pub *Publisher) UpdateStaleNodes() {
+	allStale := make(map[string]bool)
+	for _, output := range pub.registeredOutputs.GetAllOutputs() {
+		reportTime := pub.registeredOutputValues.GetReportTime(output.OutputID)
+		isStale := !reportTime.IsZero() && pub.valueMaxAge.IsStaleTime(output.OutputType, reportTime)
+		nodeStale, found := allStale[output.NodeHWID]
+		allStale[output.NodeHWID] = isStale && (nodeStale || !found)
+	}
+	for nodeHWID, isStale := range allStale {
+		node := pub.registeredNodes.GetNodeByHWID(nodeHWID)
+		if node == nil {
+			continue
+		}
+		if isStale {
+			if pub.registeredNodes.UpdateErrorStatus(nodeHWID, types.NodeRunStateError, StaleOutputsError) {
+				pub.logger.Warningf("Publisher.UpdateStaleNodes: Outputs of node %s are stale", node.Address)
+			}
+		} else if node.Status[types.NodeStatusLastError] == StaleOutputsError {
+			pub.registeredNodes.UpdateErrorStatus(nodeHWID, types.NodeRunStateReady, "")
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// Package publisher with virtual outputs that aggregate the outputs of multiple nodes
+package publisher
+
+import (
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/iotdomain/iotdomain-go/lib"
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/types"
+)
+
+// Aggregate is the function that combines the source values of a virtual output
+type Aggregate string
+
+// Available aggregate functions
+const (
+	AggregateMax  Aggregate = "max"  // the highest of the source values
+	AggregateMean Aggregate = "mean" // the average of the source values
+	AggregateSum  Aggregate = "sum"  // the total of the source values, eg the total power of several meters
+)
+
+// NoSourceValuesError is the lastError status of nodes with a virtual output whose sources have no value
+const NoSourceValuesError = "Virtual output has no source values"
+
+// VirtualOutput is an output of a registered node whose value is the aggregate of the latest
+// values of outputs from other nodes. The value is recomputed and updated when a source value
+// changes. Sources that haven't reported a numeric value yet are left out of the aggregate.
+// When none of the sources has a value anymore the value is cleared and the node is marked with
+// the NoSourceValuesError status until a source value is received.
+// The value is published as a forwarded message with the highest hop count of the source values
+// plus one, so virtual outputs that use each other as source stop once the max hops is exceeded.
+// Virtual outputs of the same publisher therefore can't be used as source of each other.
+type VirtualOutput struct {
+	aggregate       Aggregate                  // function that combines the source values
+	hops            map[string]int             // hop count of the latest value of each source by its $latest address
+	nodeHWID        string                     // hardware ID of the node that holds the output
+	outputID        string                     // ID of the registered output that holds the aggregate value
+	pub             *Publisher                 // publisher of the virtual output
+	sources         []string                   // $latest addresses of the source outputs
+	subscriptionIDs []messaging.SubscriptionID // subscriptions to the sources
+	value           string                     // the most recent aggregate value
+	values          map[string]float64         // latest numeric value of each source by its $latest address
+	updateMutex     *sync.Mutex                // mutex for async updating of source values
+}
+
+// CreateVirtualOutput creates an output whose value is the aggregate of the given source outputs
+// The node of the output is created if it doesn't exist.
+//  nodeHWID is the hardware ID of the (virtual) node that holds the output
+//  aggregate is the function to combine the source values with, eg AggregateSum
+//  sources are the addresses of the domain outputs to aggregate, eg the $latest addresses
+// Returns the virtual output
+func (pub *Publisher) CreateVirtualOutput(nodeHWID string, outputType types.OutputType, instance string,
+	aggregate Aggregate, sources []string) *VirtualOutput {
+
+	pub.registeredNodes.GetOrCreateNode(nodeHWID, types.NodeTypeAdapter)
+	output := pub.registeredOutputs.CreateOutput(nodeHWID, outputType, instance)
+	vout := &VirtualOutput{
+		aggregate:   aggregate,
+		nodeHWID:    nodeHWID,
+		outputID:    output.OutputID,
+		hops:        make(map[string]int),
+		pub:         pub,
+		values:      make(map[string]float64),
+		updateMutex: &sync.Mutex{},
+	}
+	vout.SetSources(sources)
+	return vout
+}
+
+// GetMissingSources returns the $latest addresses of the sources without a numeric value
+func (vout *VirtualOutput) GetMissingSources() []string {
+	vout.updateMutex.Lock()
+	defer vout.updateMutex.Unlock()
+	missing := make([]string, 0)
+	for _, source := range vout.sources {
+		if _, found := vout.values[source]; !found {
+			missing = append(missing, source)
+		}
+	}
+	return missing
+}
+
+// GetValue returns the most recent aggregate value, or "" if none of the sources have a value
+func (vout *VirtualOutput) GetValue() string {
+	vout.updateMutex.Lock()
+	defer vout.updateMutex.Unlock()
+	return vout.value
+}
+
+// OutputID returns the ID of the registered output that holds the aggregate value
+func (vout *VirtualOutput) OutputID() string {
+	return vout.outputID
+}
+
+// SetAggregate changes the function that combines the source values and updates the output value
+func (vout *VirtualOutput) SetAggregate(aggregate Aggregate) {
+	vout.updateMutex.Lock()
+	defer vout.updateMutex.Unlock()
+	vout.aggregate = aggregate
+	vout.updateValue()
+}
+
+// SetSources replaces the outputs that are aggregated
+// Values of sources that are no longer used are removed and the output value is updated.
+//  sources are the addresses of the domain outputs to aggregate, eg the $latest addresses
+func (vout *VirtualOutput) SetSources(sources []string) {
+	vout.Stop()
+
+	vout.updateMutex.Lock()
+	latestAddresses := make([]string, 0, len(sources))
+	values := make(map[string]float64)
+	hops := make(map[string]int)
+	for _, source := range sources {
+		latestAddress := types.MakeMessageAddress(lib.MakeBaseAddress(source), types.MessageTypeLatest)
+		if value, found := vout.values[latestAddress]; found {
+			values[latestAddress] = value
+			hops[latestAddress] = vout.hops[latestAddress]
+		}
+		latestAddresses = append(latestAddresses, latestAddress)
+	}
+	vout.sources = latestAddresses
+	vout.values = values
+	vout.hops = hops
+	vout.updateValue()
+	vout.updateMutex.Unlock()
+
+	// retained source values can be received while subscribing
+	subscriptionIDs := make([]messaging.SubscriptionID, 0, len(latestAddresses))
+	for _, latestAddress := range latestAddresses {
+		subscriptionIDs = append(subscriptionIDs, vout.pub.messageSigner.SubscribeVerifiedWithHops(latestAddress,
+			func() interface{} { return &types.OutputLatestMessage{} }, vout.onReceiveLatest))
+	}
+	vout.updateMutex.Lock()
+	vout.subscriptionIDs = subscriptionIDs
+	vout.updateMutex.Unlock()
+}
+
+// Stop the updates of the virtual output by unsubscribing from its sources
+func (vout *VirtualOutput) Stop() {
+	vout.updateMutex.Lock()
+	subscriptionIDs := vout.subscriptionIDs
+	vout.subscriptionIDs = nil
+	vout.updateMutex.Unlock()
+	// method values of different virtual outputs can't be told apart so unsubscribe by ID
+	for _, subscriptionID := range subscriptionIDs {
+		vout.pub.messageSigner.UnsubscribeByID(subscriptionID)
+	}
+}
+
+// onReceiveLatest updates the aggregate value with the verified latest value of a source output
+// Values that aren't numeric remove the source from the aggregate until a numeric value is received.
+//  hops is the hop count of the message, see SubscribeVerifiedWithHops
+func (vout *VirtualOutput) onReceiveLatest(address string, object interface{}, hops int) error {
+	latest := object.(*types.OutputLatestMessage)
+
+	vout.updateMutex.Lock()
+	defer vout.updateMutex.Unlock()
+	value, err := strconv.ParseFloat(latest.Value, 64)
+	if err != nil {
+		delete(vout.values, address)
+		delete(vout.hops, address)
+	} else {
+		vout.values[address] = value
+		vout.hops[address] = hops
+	}
+	vout.updateValue()
+	if err != nil {
+		return lib.MakeErrorf("VirtualOutput.onReceiveLatest: Value '%s' on %s is not a number", latest.Value, address)
+	}
+	return nil
+}
+
+// updateValue recomputes the aggregate and updates the output value if it has changed
+// Use within a locked section.
+func (vout *VirtualOutput) updateValue() {
+	if len(vout.values) == 0 {
+		if vout.value != "" {
+			vout.value = ""
+			vout.pub.logger.Warningf("VirtualOutput.updateValue: Sources of output %s have no value", vout.outputID)
+			vout.pub.registeredNodes.UpdateErrorStatus(vout.nodeHWID, types.NodeRunStateError, NoSourceValuesError)
+		}
+		return
+	}
+	var result float64
+	switch vout.aggregate {
+	case AggregateMax:
+		result = math.Inf(-1)
+		for _, value := range vout.values {
+			result = math.Max(result, value)
+		}
+	case AggregateMean, AggregateSum:
+		for _, value := range vout.values {
+			result += value
+		}
+		if vout.aggregate == AggregateMean {
+			result = result / float64(len(vout.values))
+		}
+	default:
+		vout.pub.logger.Warningf("VirtualOutput.updateValue: Unknown aggregate '%s' of output %s",
+			vout.aggregate, vout.outputID)
+		return
+	}
+	newValue := strconv.FormatFloat(result, 'f', -1, 64)
+	if vout.value == "" {
+		node := vout.pub.registeredNodes.GetNodeByHWID(vout.nodeHWID)
+		if node != nil && node.Status[types.NodeStatusLastError] == NoSourceValuesError {
+			vout.pub.registeredNodes.UpdateErrorStatus(vout.nodeHWID, types.NodeRunStateReady, "")
+		}
+	}
+	if newValue != vout.value {
+		receivedHops := 0
+		for address := range vout.values {
+			if vout.hops[address] > receivedHops {
+				receivedHops = vout.hops[address]
+			}
+		}
+		vout.value = newValue
+		vout.pub.updateMutex.Lock()
+		vout.pub.forwardedHops[vout.outputID] = receivedHops
+		vout.pub.updateMutex.Unlock()
+		vout.pub.registeredOutputValues.UpdateOutputValue(vout.outputID, newValue)
+	}
+}
@@ -0,0 +1,141 @@
+package publisher_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/messaging"
+	"github.com/iotdomain/iotdomain-go/publisher"
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVirtualOutput(t *testing.T) {
+	configFolder, _ := ioutil.TempDir("", "iotdomain")
+	defer os.RemoveAll(configFolder)
+	messenger := messaging.NewInMemoryMessenger(msgConfig)
+
+	meterConfig := *test1Config
+	meterConfig.ConfigFolder = configFolder
+	meters := publisher.NewPublisher(&meterConfig, messenger)
+	meters.Start()
+	defer meters.Stop()
+	meters.CreateNode("meter1", types.NodeTypeUnknown)
+	meters.CreateNode("meter2", types.NodeTypeUnknown)
+	power1 := meters.CreateOutput("meter1", types.OutputTypeElectricPower, types.DefaultOutputInstance)
+	power2 := meters.CreateOutput("meter2", types.OutputTypeElectricPower, types.DefaultOutputInstance)
+	meters.UpdateOutputValue("meter1", types.OutputTypeElectricPower, types.DefaultOutputInstance, "100")
+	meters.PublishUpdates()
+
+	controllerConfig := *test1Config
+	controllerConfig.ConfigFolder = configFolder
+	controllerConfig.PublisherID = "controller1"
+	controller := publisher.NewPublisher(&controllerConfig, messenger)
+	controller.Start()
+	defer controller.Stop()
+
+	// the retained value of meter1 is used while meter2 is missing
+	total := controller.CreateVirtualOutput("total", types.OutputTypeElectricPower, types.DefaultOutputInstance,
+		publisher.AggregateSum, []string{power1.Address, power2.Address})
+	assert.Equal(t, "100", total.GetValue())
+	assert.Len(t, total.GetMissingSources(), 1)
+
+	meters.UpdateOutputValue("meter2", types.OutputTypeElectricPower, types.DefaultOutputInstance, "50.5")
+	meters.PublishUpdates()
+	assert.Equal(t, "150.5", total.GetValue())
+	assert.Empty(t, total.GetMissingSources())
+	value := controller.GetOutputValueByID(total.OutputID())
+	require.NotNil(t, value)
+	assert.Equal(t, "150.5", value.Value)
+
+	total.SetAggregate(publisher.AggregateMax)
+	assert.Equal(t, "100", total.GetValue())
+	total.SetAggregate(publisher.AggregateMean)
+	assert.Equal(t, "75.25", total.GetValue())
+
+	// removing a source removes its value from the aggregate
+	total.SetSources([]string{power2.Address})
+	assert.Equal(t, "50.5", total.GetValue())
+
+	// stopping another virtual output with the same source doesn't stop this one
+	maxPower := controller.CreateVirtualOutput("max", types.OutputTypeElectricPower, types.DefaultOutputInstance,
+		publisher.AggregateMax, []string{power2.Address})
+	maxPower.Stop()
+	meters.UpdateOutputValue("meter2", types.OutputTypeElectricPower, types.DefaultOutputInstance, "20")
+	meters.PublishUpdates()
+	assert.Equal(t, "20", total.GetValue())
+	assert.Equal(t, "50.5", maxPower.GetValue())
+
+	// without sources the value is cleared and the node reports the error
+	total.SetSources([]string{})
+	assert.Equal(t, "", total.GetValue())
+	lastError, _ := controller.GetNodeStatus("total", types.NodeStatusLastError)
+	assert.Equal(t, publisher.NoSourceValuesError, lastError)
+	total.SetSources([]string{power2.Address})
+	assert.Equal(t, "20", total.GetValue())
+	lastError, _ = controller.GetNodeStatus("total", types.NodeStatusLastError)
+	assert.Equal(t, "", lastError)
+
+	// no more updates after stop
+	total.Stop()
+	meters.UpdateOutputValue("meter2", types.OutputTypeElectricPower, types.DefaultOutputInstance, "10")
+	meters.PublishUpdates()
+	assert.Equal(t, "20", total.GetValue())
+}
+
+func TestVirtualOutputLoop(t *testing.T) {
+	configFolder, _ := ioutil.TempDir("", "iotdomain")
+	defer os.RemoveAll(configFolder)
+	messenger := messaging.NewInMemoryMessenger(msgConfig)
+
+	meterConfig := *test1Config
+	meterConfig.ConfigFolder = configFolder
+	meters := publisher.NewPublisher(&meterConfig, messenger)
+	meters.Start()
+	defer meters.Stop()
+	meters.CreateNode("meter1", types.NodeTypeUnknown)
+	power1 := meters.CreateOutput("meter1", types.OutputTypeElectricPower, types.DefaultOutputInstance)
+	meters.UpdateOutputValue("meter1", types.OutputTypeElectricPower, types.DefaultOutputInstance, "100")
+	meters.PublishUpdates()
+
+	controller1Config := *test1Config
+	controller1Config.ConfigFolder = configFolder
+	controller1Config.PublisherID = "controller1"
+	controller1 := publisher.NewPublisher(&controller1Config, messenger)
+	controller1.Start()
+	defer controller1.Stop()
+	controller2Config := controller1Config
+	controller2Config.PublisherID = "controller2"
+	controller2 := publisher.NewPublisher(&controller2Config, messenger)
+	controller2.Start()
+	defer controller2.Stop()
+
+	// a virtual output that is its own source ignores its own value
+	total := controller1.CreateVirtualOutput("total", types.OutputTypeElectricPower, types.DefaultOutputInstance,
+		publisher.AggregateSum, []string{power1.Address})
+	totalOutput := controller1.GetOutputByID(total.OutputID())
+	require.NotNil(t, totalOutput)
+	total.SetSources([]string{power1.Address, totalOutput.Address})
+	for i := 0; i < 3; i++ {
+		controller1.PublishUpdates()
+	}
+	assert.Equal(t, "100", total.GetValue())
+
+	// virtual outputs of different publishers that use each other as source stop after the max hops
+	copy1 := controller2.CreateVirtualOutput("copy", types.OutputTypeElectricPower, types.DefaultOutputInstance,
+		publisher.AggregateSum, []string{totalOutput.Address})
+	copyOutput := controller2.GetOutputByID(copy1.OutputID())
+	require.NotNil(t, copyOutput)
+	total.SetSources([]string{power1.Address, copyOutput.Address})
+	for i := 0; i < 2*messaging.DefaultMaxHops; i++ {
+		controller1.PublishUpdates()
+		controller2.PublishUpdates()
+	}
+	value := total.GetValue()
+	controller1.PublishUpdates()
+	controller2.PublishUpdates()
+	assert.Equal(t, value, total.GetValue())
+	assert.NotEqual(t, "100", value)
+}
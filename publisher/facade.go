@@ -5,9 +5,14 @@ package publisher
 
 import (
 	"crypto/ecdsa"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/iotdomain/iotdomain-go/identities"
 	"github.com/iotdomain/iotdomain-go/inputs"
 	"github.com/iotdomain/iotdomain-go/lib"
+	"github.com/iotdomain/iotdomain-go/messaging"
 	"github.com/iotdomain/iotdomain-go/nodes"
 	"github.com/iotdomain/iotdomain-go/outputs"
 	"github.com/iotdomain/iotdomain-go/types"
@@ -29,6 +34,48 @@ func (pub *Publisher) CreateInput(nodeHWID string, inputType types.InputType, in
 	return input
 }
 
+// NewConstrainedInput creates a new node input that handle set commands, like CreateInput, with
+// constraints on the value. Set commands with a value that doesn't match the data type or is outside
+// the constraints are rejected before they reach the handler.
+//  dataType is the input data type, eg types.DataTypeNumber. Bool, int, number, enum and json are validated
+//  min, max is the valid range of numbers. Use 0, 0 for no range
+//  enumValues are the valid values of enum inputs
+func (pub *Publisher) NewConstrainedInput(nodeHWID string, inputType types.InputType, instance string,
+	dataType types.DataType, min float32, max float32, enumValues []string,
+	setCommandHandler func(input *types.InputDiscoveryMessage, sender string, value string)) *types.InputDiscoveryMessage {
+
+	input := pub.inputFromSetCommands.CreateInput(nodeHWID, inputType, instance, setCommandHandler)
+	// inputs are replaced instead of modified for concurrent use
+	newInput := *input
+	newInput.DataType = dataType
+	newInput.Min = min
+	newInput.Max = max
+	newInput.EnumValues = enumValues
+	pub.registeredInputs.UpdateInput(&newInput)
+	return &newInput
+}
+
+// SetInputMessageHandler creates an input that handles set input messages addressed to the input and
+// invokes the handler with the value. Set input messages must be encrypted and signed by the sender, and the
+// signature is verified with the sender's public key. Only senders that are publishers in the same
+// domain as this publisher are authorized. Messages from other senders are discarded.
+// This returns the new input.
+func (pub *Publisher) SetInputMessageHandler(nodeHWID string, inputType types.InputType, instance string,
+	handler func(value string)) *types.InputDiscoveryMessage {
+
+	input := pub.inputFromSetCommands.CreateInput(nodeHWID, inputType, instance,
+		func(input *types.InputDiscoveryMessage, sender string, value string) {
+			segments, err := types.ParseBaseAddress(sender)
+			if err != nil || segments.Domain != pub.Domain() || pub.GetPublisherKey(sender) == nil {
+				logrus.Warningf("SetInputMessageHandler: Sender '%s' is not authorized to set input %s. Message discarded.",
+					sender, input.Address)
+				return
+			}
+			handler(value)
+		})
+	return input
+}
+
 // CreateInputFromFile sends a file or folder to an input when it is modified - TODO
 // The input handler is triggered with a message containing the path as value
 func (pub *Publisher) CreateInputFromFile(
@@ -59,6 +106,14 @@ func (pub *Publisher) CreateInputFromOutput(
 	_ = input
 }
 
+// CreateChildNode creates a node that is managed by a registered gateway node, eg a zwave device.
+// The node's gateway address attribute refers to the gateway. Returns an error if the gateway
+// isn't registered.
+func (pub *Publisher) CreateChildNode(gatewayHWID string, nodeHWID string, nodeType types.NodeType) (
+	*types.NodeDiscoveryMessage, error) {
+	return pub.registeredNodes.CreateChildNode(gatewayHWID, nodeHWID, nodeType)
+}
+
 // CreateNode creates a new node and add it to this publisher's registered nodes
 // returns the new node instance
 func (pub *Publisher) CreateNode(nodeHWID string, nodeType types.NodeType) *types.NodeDiscoveryMessage {
@@ -74,9 +129,61 @@ func (pub *Publisher) CreateOutput(nodeHWID string, outputType types.OutputType,
 	return output
 }
 
-// DeleteNode deletes a node from the collection of registered nodes
+// DefaultCapabilities returns the capabilities of this publisher for use with SetCapabilities.
+// This includes the accepted signature algorithms and the commands the publisher handles.
+func (pub *Publisher) DefaultCapabilities() types.PublisherCapabilityMap {
+	messageTypes := strings.Join([]string{
+		string(types.MessageTypeConfigure), string(types.MessageTypeRequest),
+		string(types.MessageTypeSetInput), string(types.MessageTypeSetNodeID)}, ",")
+	return types.PublisherCapabilityMap{
+		types.CapabilityAlgorithms:            strings.Join(pub.messageSigner.AllowedAlgorithms(), ","),
+		types.CapabilityEncryptedMessageTypes: messageTypes,
+		types.CapabilityMessageTypes:          messageTypes,
+	}
+}
+
+// DeleteGateway deletes a registered gateway node and either deletes or orphans its child nodes
+// The inputs and outputs of deleted nodes are deleted as well. Deleted nodes, inputs and outputs
+// are removed from the message bus on the next PublishUpdates.
+// Returns the number of child nodes that are deleted or orphaned
+func (pub *Publisher) DeleteGateway(gatewayHWID string, deleteChildren bool) int {
+	if deleteChildren {
+		for _, child := range pub.registeredNodes.GetChildNodes(gatewayHWID) {
+			pub.deleteNodeInputsOutputs(child.HWID)
+		}
+	}
+	if pub.registeredNodes.GetNodeByHWID(gatewayHWID) != nil {
+		pub.deleteNodeInputsOutputs(gatewayHWID)
+	}
+	return pub.registeredNodes.DeleteGateway(gatewayHWID, deleteChildren)
+}
+
+// DeleteNode deletes a node from the collection of registered nodes, including its inputs and outputs.
+// The node, inputs and outputs are removed from the message bus on the next PublishUpdates.
+// Child nodes of a deleted gateway are kept as orphans.
 func (pub *Publisher) DeleteNode(hwAddress string) {
-	pub.registeredNodes.DeleteNode(hwAddress)
+	pub.DeleteGateway(hwAddress, false)
+}
+
+// deleteNodeInputsOutputs deletes the inputs and outputs of a node. Inputs are deleted through the
+// receiver that handles them, so their subscription, file watch or polling stops.
+func (pub *Publisher) deleteNodeInputsOutputs(nodeHWID string) {
+	for _, input := range pub.registeredInputs.GetInputsByNodeHWID(nodeHWID) {
+		source := input.Source
+		if source == "" {
+			pub.inputFromSetCommands.DeleteInput(input.InputID)
+		} else if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+			pub.inputFromHTTP.DeleteInput(input.InputID)
+		} else if _, err := types.ParseAddress(source); err == nil {
+			pub.inputFromOutputs.DeleteInput(input.InputID)
+		} else {
+			pub.inputFromFiles.DeleteInput(input.NodeHWID, input.InputType, input.Instance)
+		}
+	}
+	for _, output := range pub.registeredOutputs.GetOutputsByNodeHWID(nodeHWID) {
+		pub.registeredOutputs.DeleteOutput(output.OutputID)
+		pub.registeredOutputValues.DeleteOutputValues(output.OutputID)
+	}
 }
 
 // Domain returns the publication domain
@@ -91,6 +198,35 @@ func (pub *Publisher) Domain() string {
 // 	return *ident
 // }
 
+// FindNodes returns a snapshot of the discovered domain nodes for which the matcher returns true
+func (pub *Publisher) FindNodes(matcher func(node *types.NodeDiscoveryMessage) bool) []*types.NodeDiscoveryMessage {
+	return pub.domainNodes.FindNodes(matcher)
+}
+
+// FindNodesByAttr returns a snapshot of the discovered domain nodes with the given attribute value
+func (pub *Publisher) FindNodesByAttr(attrName types.NodeAttr, value string) []*types.NodeDiscoveryMessage {
+	return pub.domainNodes.FindNodesByAttr(attrName, value)
+}
+
+// GetChildNodes returns the registered nodes that are managed by the given gateway node
+func (pub *Publisher) GetChildNodes(gatewayHWID string) []*types.NodeDiscoveryMessage {
+	return pub.registeredNodes.GetChildNodes(gatewayHWID)
+}
+
+// GetConfigValue returns the effective value of a registered node's configuration, which is the
+// configured value or the configuration default. isSecret is true if the value must not be logged or
+// published, eg a password. Returns an empty value if the node or configuration doesn't exist.
+func (pub *Publisher) GetConfigValue(nodeHWID string, attrName types.NodeAttr) (value string, isSecret bool) {
+	value, isSecret, _ = pub.registeredNodes.GetNodeConfigValue(nodeHWID, attrName)
+	return value, isSecret
+}
+
+// GetDomainEventHistory returns the events of a discovered node received since the given time,
+// most recent first. See DomainOutputValues.GetEventHistory for details.
+func (pub *Publisher) GetDomainEventHistory(eventAddress string, since time.Time) []*types.OutputEventMessage {
+	return pub.domainOutputValues.GetEventHistory(eventAddress, since)
+}
+
 // GetDomainInput returns a discovered domain input
 func (pub *Publisher) GetDomainInput(address string) *types.InputDiscoveryMessage {
 	return pub.domainInputs.GetInputByAddress(address)
@@ -111,6 +247,26 @@ func (pub *Publisher) GetDomainNodes() []*types.NodeDiscoveryMessage {
 	return pub.domainNodes.GetAllNodes()
 }
 
+// GetDomainOutputBytes returns the decoded latest value of a discovered output with the bytes data type
+// Returns an error if the output has no value or the value isn't base64 encoded
+func (pub *Publisher) GetDomainOutputBytes(latestAddress string) ([]byte, error) {
+	return pub.domainOutputValues.GetLatestBytes(latestAddress)
+}
+
+// GetDomainOutputLatest returns the latest value of a discovered output and whether it is stale
+// A value is stale when it is older than the max age of its output type, see SetOutputMaxAge.
+func (pub *Publisher) GetDomainOutputLatest(latestAddress string) (
+	value *types.OutputLatestMessage, stale bool, found bool) {
+	return pub.domainOutputValues.GetLatestWithStale(latestAddress)
+}
+
+// ResampleDomainOutputHistory returns the history of a discovered output resampled in fixed intervals
+// See DomainOutputValues.ResampleHistory for details.
+func (pub *Publisher) ResampleDomainOutputHistory(historyAddress string,
+	interval time.Duration, method outputs.Resample) []types.OutputValue {
+	return pub.domainOutputValues.ResampleHistory(historyAddress, interval, method)
+}
+
 // GetDomainOutput returns a discovered domain output by its address
 func (pub *Publisher) GetDomainOutput(address string) *types.OutputDiscoveryMessage {
 	return pub.domainOutputs.GetOutputByAddress(address)
@@ -158,6 +314,17 @@ func (pub *Publisher) GetIdentityKeys() *ecdsa.PrivateKey {
 	return privKey
 }
 
+// GetKnownPublishers returns the publishers known in the domain with their key fingerprint and
+// verification status. See also GetDomainPublishers.
+func (pub *Publisher) GetKnownPublishers() []identities.PublisherInfo {
+	return pub.domainIdentities.GetKnownPublishers()
+}
+
+// GetNodeAlias returns the nodeID under which a registered node is published, if it differs from its hwID
+func (pub *Publisher) GetNodeAlias(nodeHWID string) (alias string, hasAlias bool) {
+	return pub.registeredNodes.GetNodeAlias(nodeHWID)
+}
+
 // GetNodeAttr returns a node attribute value
 func (pub *Publisher) GetNodeAttr(nodeHWID string, attrName types.NodeAttr) string {
 	return pub.registeredNodes.GetNodeAttr(nodeHWID, attrName)
@@ -223,6 +390,24 @@ func (pub *Publisher) GetNodeStatus(nodeHWID string, attrName types.NodeStatus)
 	return value, exists
 }
 
+// GetObservedRange returns the lowest and highest numeric value observed for a registered output
+// since its range started, see SetObservedRangeWindow.
+// Returns false if the output doesn't exist or no numeric value has been observed
+func (pub *Publisher) GetObservedRange(outputAddress string) (outputs.ObservedRange, bool) {
+	output := pub.registeredOutputs.GetOutputByAddress(outputAddress)
+	if output == nil {
+		return outputs.ObservedRange{}, false
+	}
+	return pub.registeredOutputValues.GetObservedRange(output.OutputID)
+}
+
+// GetOrCreateNode returns the node of a device or service, creating it if it doesn't exist.
+// An existing node keeps its attributes, configuration and status. Only its type is updated.
+// Returns the node and true if it was created
+func (pub *Publisher) GetOrCreateNode(nodeHWID string, nodeType types.NodeType) (*types.NodeDiscoveryMessage, bool) {
+	return pub.registeredNodes.GetOrCreateNode(nodeHWID, nodeType)
+}
+
 // GetOutputByNodeHWID get a registered output by node HWID
 func (pub *Publisher) GetOutputByNodeHWID(nodeHWID string, outputType types.OutputType, instance string) *types.OutputDiscoveryMessage {
 	return pub.registeredOutputs.GetOutputByNodeHWID(nodeHWID, outputType, instance)
@@ -233,11 +418,24 @@ func (pub *Publisher) GetOutputByID(outputID string) *types.OutputDiscoveryMessa
 	return pub.registeredOutputs.GetOutputByID(outputID)
 }
 
+// GetOutputInstances returns the instances of a registered node's outputs of the given type, eg the
+// channels of a relay board. Numeric instances are sorted by number.
+func (pub *Publisher) GetOutputInstances(nodeHWID string, outputType types.OutputType) []string {
+	return pub.registeredOutputs.GetOutputInstances(nodeHWID, outputType)
+}
+
 // GetOutputs returns a list of all registered outputs
 func (pub *Publisher) GetOutputs() []*types.OutputDiscoveryMessage {
 	return pub.registeredOutputs.GetAllOutputs()
 }
 
+// GetOutputBytes returns the decoded latest value of a registered output with the bytes data type
+// Returns an error if the output has no value or the value isn't base64 encoded
+func (pub *Publisher) GetOutputBytes(nodeHWID string, outputType types.OutputType, instance string) ([]byte, error) {
+	outputID := outputs.MakeOutputID(nodeHWID, outputType, instance)
+	return pub.registeredOutputValues.GetOutputBytesByID(outputID)
+}
+
 // GetOutputValueByNodeHWID returns the registered output's value object including timestamp
 func (pub *Publisher) GetOutputValueByNodeHWID(nodeHWID string, outputType types.OutputType, instance string) *types.OutputValue {
 	return pub.registeredOutputValues.GetOutputValueByType(nodeHWID, outputType, instance)
@@ -248,12 +446,64 @@ func (pub *Publisher) GetOutputValueByID(outputID string) *types.OutputValue {
 	return pub.registeredOutputValues.GetOutputValueByID(outputID)
 }
 
+// GetPublishedMessages returns the publications captured in simulation mode, in order of publishing.
+// Returns nil if the publisher isn't in simulation mode. See PublisherConfig.Simulation.
+func (pub *Publisher) GetPublishedMessages() []messaging.PublishedMessage {
+	simulation, isSimulation := pub.messenger.(*messaging.SimulationMessenger)
+	if !isSimulation {
+		return nil
+	}
+	return simulation.GetPublishedMessages()
+}
+
+// GetPublisherCapabilities returns the capabilities in the identity of a publisher in this domain
+// Intended to check if a publisher supports a feature before using it, eg encrypted $setInput messages.
+// Returns nil if the publisher is unknown or its identity has no capabilities.
+func (pub *Publisher) GetPublisherCapabilities(publisherID string) types.PublisherCapabilityMap {
+	address := identities.MakePublisherIdentityAddress(pub.Domain(), publisherID)
+	ident := pub.domainIdentities.GetPublisherByAddress(address)
+	if ident == nil || ident.Capabilities == nil {
+		return nil
+	}
+	capabilities := make(types.PublisherCapabilityMap, len(ident.Capabilities))
+	for capability, value := range ident.Capabilities {
+		capabilities[capability] = value
+	}
+	return capabilities
+}
+
 // GetPublisherKey returns the public key of the publisher contained in the given address
 // The address must at least contain a domain and publisherId
 func (pub *Publisher) GetPublisherKey(address string) *ecdsa.PublicKey {
 	return pub.domainIdentities.GetPublisherKey(address)
 }
 
+// GetPublisherKeyInfo returns the public key of a publisher with information on the trust of its
+// identity, eg whether it is verified and issued by the DSS. See also GetPublisherKey.
+// Returns nil, nil if the publisher is not known
+func (pub *Publisher) GetPublisherKeyInfo(address string) (*ecdsa.PublicKey, *identities.PublisherKeyInfo) {
+	return pub.domainIdentities.GetPublisherKeyInfo(address)
+}
+
+// GetStaleNodes returns the hardware IDs of the registered nodes that haven't been seen within the
+// max age, using their lastSeen status. Nodes that have never been seen are stale.
+func (pub *Publisher) GetStaleNodes(maxAge time.Duration) []string {
+	return pub.registeredNodes.GetStaleNodes(maxAge)
+}
+
+// IsNodeStale returns true if a registered node hasn't been seen within the max age, using its
+// lastSeen status and the publisher clock. Nodes that have never been seen are stale.
+func (pub *Publisher) IsNodeStale(nodeHWID string, maxAge time.Duration) bool {
+	return pub.registeredNodes.IsNodeStale(nodeHWID, maxAge)
+}
+
+// LoadNodeConfigDefaults applies configuration values from the environment or a configuration file
+// to a registered node. See RegisteredNodes.LoadNodeConfigDefaults for details.
+func (pub *Publisher) LoadNodeConfigDefaults(nodeHWID string, source map[string]string) (
+	*nodes.ConfigDefaultsResult, error) {
+	return pub.registeredNodes.LoadNodeConfigDefaults(nodeHWID, source)
+}
+
 // MakeNodeDiscoveryAddress makes the node discovery address using the publisher domain and publisherID
 func (pub *Publisher) MakeNodeDiscoveryAddress(nodeID string) string {
 	addr := nodes.MakeNodeDiscoveryAddress(pub.Domain(), pub.PublisherID(), nodeID)
@@ -293,6 +543,39 @@ func (pub *Publisher) PublishRaw(output *types.OutputDiscoveryMessage, sign bool
 	outputs.PublishOutputRaw(output, value, pub.messageSigner)
 }
 
+// PublishEvent publishes an event with multiple named values of a node in a single message, eg the
+// state, battery and tamper values of a door sensor. The event is published on the node's $event address.
+// Events are not retained unless the retained policy of the $event message type is changed, see SetRetainedPolicy.
+// Returns an error if the node doesn't exist.
+func (pub *Publisher) PublishEvent(nodeHWID string, event map[string]string) error {
+	node := pub.registeredNodes.GetNodeByHWID(nodeHWID)
+	if node == nil {
+		return lib.MakeErrorf("PublishEvent: Node '%s' not found", nodeHWID)
+	}
+	return outputs.PublishEvent(node.Address, event, pub.messageSigner)
+}
+
+// PublishLatestWithTTL updates the value of a registered output and declares how long its $latest
+// value is valid, eg for a one-time code. The expiry is included in the signed $latest message that
+// is published with the next update. Subscribers treat the value as absent once it has expired.
+// The TTL remains in effect for subsequent values of the output. Values with a TTL are not published
+// in $raw and $history, as these don't expire.
+//  ttl is the lifetime of the value. Use 0 to publish values without expiry.
+// Returns true if the value is updated
+func (pub *Publisher) PublishLatestWithTTL(nodeHWID string, outputType types.OutputType, instance string,
+	value string, ttl time.Duration) bool {
+
+	outputID := outputs.MakeOutputID(nodeHWID, outputType, instance)
+	pub.updateMutex.Lock()
+	if ttl > 0 {
+		pub.latestTTL[outputID] = ttl
+	} else {
+		delete(pub.latestTTL, outputID)
+	}
+	pub.updateMutex.Unlock()
+	return pub.registeredOutputValues.UpdateOutputValue(outputID, value)
+}
+
 // PublishOutputEvent publishes all outputs of the node in a single event
 func (pub *Publisher) PublishOutputEvent(node *types.NodeDiscoveryMessage) error {
 	return PublishOutputEvent(node, pub.registeredOutputs, pub.registeredOutputValues, pub.messageSigner)
@@ -311,6 +594,24 @@ func (pub *Publisher) PublishSetInput(inputAddr string, value string) error {
 	return err
 }
 
+// SetInputValue publishes a $set command to set the value of an input of another publisher's node.
+// The command is signed with this publisher's key. If the identity of the destination publisher is
+// known then the command is also encrypted with its public key. Note that publishers using this
+// library only accept encrypted commands.
+//  domain and publisherID of the publisher of the node
+//  nodeID, inputType and instance of the input to set
+func (pub *Publisher) SetInputValue(domain string, publisherID string, nodeID string,
+	inputType types.InputType, instance string, value string) error {
+
+	setAddr := inputs.MakeSetInputAddress(domain, publisherID, nodeID, inputType, instance)
+	destPubKey := pub.GetPublisherKey(setAddr)
+	if destPubKey == nil {
+		pub.logger.Warningf("SetInputValue: Identity of publisher %s/%s is unknown. Command to %s is not encrypted.",
+			domain, publisherID, setAddr)
+	}
+	return inputs.PublishSetInput(setAddr, value, pub.Address(), pub.messageSigner, destPubKey)
+}
+
 // PublishSetNodeID publishes a set node ID command to the given node address
 //  This requires that the publisher identity of the receiving input is known so the
 // command can be encrypted.
@@ -325,12 +626,253 @@ func (pub *Publisher) PublishSetNodeID(nodeAddr string, newNodeID string) error
 	return err
 }
 
+// ResolveAliasAddress replaces the node hwID in an address of a registered node with its alias, if any
+func (pub *Publisher) ResolveAliasAddress(address string) string {
+	return pub.registeredNodes.ResolveAliasAddress(address)
+}
+
+// SetNodeAuthorizedSenders sets the publishers that are authorized to configure the node and set its inputs
+//  senders contains publisher IDs of this domain or domain/publisherID. Use nil to authorize any sender.
+func (pub *Publisher) SetNodeAuthorizedSenders(nodeHWID string, senders []string) {
+	pub.registeredNodes.SetAuthorizedSenders(nodeHWID, senders)
+}
+
+// SetNodeBattery updates the battery level status of a registered node in percent
+// Returns true if the battery level has changed, or an error if the percent is not in the range 0-100
+func (pub *Publisher) SetNodeBattery(nodeHWID string, percent int) (bool, error) {
+	if percent < 0 || percent > 100 {
+		return false, lib.MakeErrorf("SetNodeBattery: Node '%s' battery level %d is not in the range 0-100",
+			nodeHWID, percent)
+	}
+	return pub.registeredNodes.UpdateNodeStatus(nodeHWID, map[types.NodeStatus]string{
+		types.NodeStatusBatteryLevel: strconv.Itoa(percent),
+	}), nil
+}
+
+// SetNodeFirmwareAvailable updates the available firmware version of a registered node
+//  Use "" if no firmware update is available
+// Returns true if the version has changed
+func (pub *Publisher) SetNodeFirmwareAvailable(nodeHWID string, version string) bool {
+	return pub.registeredNodes.UpdateNodeAttr(nodeHWID, types.NodeAttrMap{
+		types.NodeAttrFirmwareAvailable: version,
+	})
+}
+
+// SetNodeUpdatePending updates whether a firmware update is scheduled for a registered node
+// Returns true if the pending flag has changed
+func (pub *Publisher) SetNodeUpdatePending(nodeHWID string, pending bool) bool {
+	return pub.registeredNodes.UpdateNodeAttr(nodeHWID, types.NodeAttrMap{
+		types.NodeAttrUpdatePending: strconv.FormatBool(pending),
+	})
+}
+
+// SetNodeUpdateProgress updates the firmware update progress status of a registered node in percent
+// Returns true if the progress has changed, or an error if the percent is not in the range 0-100
+func (pub *Publisher) SetNodeUpdateProgress(nodeHWID string, percent int) (bool, error) {
+	if percent < 0 || percent > 100 {
+		return false, lib.MakeErrorf("SetNodeUpdateProgress: Node '%s' update progress %d is not in the range 0-100",
+			nodeHWID, percent)
+	}
+	return pub.registeredNodes.UpdateNodeStatus(nodeHWID, map[types.NodeStatus]string{
+		types.NodeStatusUpdateProgress: strconv.Itoa(percent),
+	}), nil
+}
+
+// SetNodeLocation updates the latitude and longitude attribute of a registered node in decimal degrees.
+// The attribute is formatted with types.FormatLatLon.
+// Returns true if the location has changed, or an error if the coordinates are out of range
+func (pub *Publisher) SetNodeLocation(nodeHWID string, lat float64, lon float64) (bool, error) {
+	latLon := types.FormatLatLon(lat, lon)
+	if _, _, err := types.ParseLatLon(latLon); err != nil {
+		return false, lib.MakeErrorf("SetNodeLocation: Node '%s': %s", nodeHWID, err)
+	}
+	return pub.registeredNodes.UpdateNodeAttr(nodeHWID, types.NodeAttrMap{
+		types.NodeAttrLatLon: latLon,
+	}), nil
+}
+
+// SetNodeSignal updates the RF signal strength status of a registered node in dBm
+// Returns true if the signal strength has changed
+func (pub *Publisher) SetNodeSignal(nodeHWID string, dbm int) bool {
+	return pub.registeredNodes.UpdateNodeStatus(nodeHWID, map[types.NodeStatus]string{
+		types.NodeStatusSignalStrength: strconv.Itoa(dbm),
+	})
+}
+
+// SetAllowedAlgorithms sets the JWS signature algorithms that are accepted when verifying received
+// messages. The default is messaging.DefaultAllowedAlgorithms.
+func (pub *Publisher) SetAllowedAlgorithms(algorithms ...string) {
+	pub.messageSigner.SetAllowedAlgorithms(algorithms...)
+}
+
+// SetCapabilities sets the capabilities in this publisher's identity and publishes the identity.
+// The capabilities of an identity issued by the DSS can only be set by the DSS.
+// See also DefaultCapabilities.
+func (pub *Publisher) SetCapabilities(capabilities types.PublisherCapabilityMap) error {
+	err := pub.registeredIdentity.SetCapabilities(capabilities)
+	if err != nil {
+		return err
+	}
+	pub.publishUpdatedIdentity()
+	return nil
+}
+
+// SetClock sets the clock used for timestamps, identity renewal, history and staleness of values,
+// replacing the system time. Intended for testing of time dependent behavior. Use nil for the system time.
+func (pub *Publisher) SetClock(clock messaging.Clock) {
+	if clock == nil {
+		clock = messaging.RealClock
+	}
+	pub.messageSigner.SetClock(clock)
+	pub.registeredIdentity.SetClock(clock)
+	pub.registeredInputs.SetClock(clock)
+	pub.registeredNodes.SetClock(clock)
+	pub.registeredOutputs.SetClock(clock)
+	pub.registeredOutputValues.SetClock(clock)
+	pub.domainOutputValues.SetClock(clock)
+	pub.domainIdentities.SetClock(clock)
+	pub.valueMaxAge.SetClock(clock)
+}
+
+// SetCompactionPolicy sets the policy for compacting the history of an output, replacing the default
+// from the compactHistory configuration. Compaction runs in the background when compactHistory is set.
+//  policy is the list of compaction tiers, eg outputs.DefaultCompactionPolicy. Use nil for the default.
+func (pub *Publisher) SetCompactionPolicy(nodeHWID string, outputType types.OutputType, instance string,
+	policy outputs.CompactionPolicy) {
+	outputID := outputs.MakeOutputID(nodeHWID, outputType, instance)
+	pub.registeredOutputValues.SetCompactionPolicy(outputID, policy)
+}
+
+// SetDSSKey sets the public key of the DSS of this publisher's domain. This key is the trust anchor
+// for identities issued by the DSS, eg as reported by GetPublisherKeyInfo and GetKnownPublishers.
+func (pub *Publisher) SetDSSKey(dssKey *ecdsa.PublicKey) {
+	pub.domainIdentities.SetDSSKey(pub.Domain(), dssKey)
+}
+
+// SetHealthScoreFunc sets the function that computes the health score of this publisher's nodes
+// Use nil for nodes.DefaultHealthScore. See UpdateNodeHealth.
+func (pub *Publisher) SetHealthScoreFunc(healthScore nodes.HealthScoreFunc) {
+	pub.registeredNodes.SetHealthScoreFunc(healthScore)
+}
+
+// SetMetrics sets the optional metrics for counting published, signed and received messages
+//  and failed signature verifications. Use nil to disable metrics.
+func (pub *Publisher) SetMetrics(metrics messaging.IMetrics) {
+	pub.messageSigner.SetMetrics(metrics)
+}
+
+// SetObservedRangeWindow sets how long the observed range of registered outputs lasts before a new
+// range starts. Use 0 to track the all-time range, which is the default.
+// The window is tumbling: a new range starts from scratch when the window has passed.
+func (pub *Publisher) SetObservedRangeWindow(window time.Duration) {
+	pub.registeredOutputValues.SetObservedRangeWindow(window)
+}
+
+// SetOutputFormat sets the format of numeric values of an output on publication, eg 2 decimals to
+// publish "23.456789" as "23.46". See outputs.FormatOutputValue.
+//  format to apply. Use nil to publish values as they are.
+func (pub *Publisher) SetOutputFormat(nodeHWID string, outputType types.OutputType, instance string,
+	format *outputs.ValueFormat) {
+	outputID := outputs.MakeOutputID(nodeHWID, outputType, instance)
+	pub.registeredOutputValues.SetFormat(outputID, format)
+}
+
+// SetOutputMaxAge sets the max age of output values before they are stale
+//  outputType to set the max age of, or "" to set the default of all output types
+//  maxAge of values before they are stale. Use 0 for values that never become stale.
+func (pub *Publisher) SetOutputMaxAge(outputType types.OutputType, maxAge time.Duration) {
+	pub.valueMaxAge.SetMaxAge(outputType, maxAge)
+}
+
+// SetOutputTransform sets the pipeline that transforms the values of an output before they are
+// stored and published, eg to convert ADC counts to a voltage. Non-numeric values are unchanged.
+// The transform is included in the output discovery.
+//  transform is the list of steps to apply in order. Use nil to remove the transform.
+// Returns an error if the output doesn't exist or the transform is invalid
+func (pub *Publisher) SetOutputTransform(nodeHWID string, outputType types.OutputType, instance string,
+	transform outputs.ValueTransform) error {
+	outputID := outputs.MakeOutputID(nodeHWID, outputType, instance)
+	output := pub.registeredOutputs.GetOutputByID(outputID)
+	if output == nil {
+		return lib.MakeErrorf("SetOutputTransform: Output %s/%s/%s not found", nodeHWID, outputType, instance)
+	}
+	err := pub.registeredOutputValues.SetTransform(outputID, transform)
+	if err != nil {
+		return err
+	}
+	// outputs are shared so update a copy
+	updatedOutput := *output
+	updatedOutput.Transform = transform.OutputTransform()
+	pub.registeredOutputs.UpdateOutput(&updatedOutput)
+	return nil
+}
+
+// SetPermissiveVerification enables or disables accepting unsigned messages and messages from
+// unknown senders on subscriptions that report the trust level of messages. Commands are always
+// verified strictly. Intended for migrating a domain to signed messages. Default is strict.
+// See MessageSigner.SetPermissive.
+func (pub *Publisher) SetPermissiveVerification(permissive bool) {
+	pub.messageSigner.SetPermissive(permissive)
+}
+
+// SetRateLimiter sets the rate limiter of publications, replacing the limiter from the configuration.
+// Use the limiter's SetMessageTypeLimit for separate limits per message type. Use nil to disable.
+func (pub *Publisher) SetRateLimiter(limiter *messaging.RateLimiter) {
+	pub.messageSigner.SetRateLimiter(limiter)
+}
+
+// SetRetryQueue sets the queue that buffers failed publications for retry, replacing the queue from
+// the configuration. Use nil to disable.
+func (pub *Publisher) SetRetryQueue(queue *messaging.RetryQueue) {
+	pub.messageSigner.SetRetryQueue(queue)
+}
+
+// SetRetainedPolicy sets whether publications of a message type are retained, replacing the
+// default from messaging.DefaultRetainedPolicy. Eg, use this to retain events.
+func (pub *Publisher) SetRetainedPolicy(messageType types.MessageType, retained bool) {
+	pub.messageSigner.SetRetainedPolicy(messageType, retained)
+}
+
+// SetStatusChangeHandler sets the handler that is notified of the status attributes of a registered
+// node that changed with UpdateNodeStatus or UpdateNodeErrorStatus. Use nil to remove the handler.
+func (pub *Publisher) SetStatusChangeHandler(handler func(nodeHWID string, diff types.NodeStatusDiff)) {
+	pub.registeredNodes.SetStatusChangeHandler(handler)
+}
+
 // SetSigningOnOff turns signing of publications on or off.
 //  The default is on (true)
 func (pub *Publisher) SetSigningOnOff(onOff bool) {
 	pub.messageSigner.SetSignMessages(onOff)
 }
 
+// SimulateMessage feeds a synthetic message to the subscriptions of a publisher in simulation mode
+// The message must be signed when signing is required. Returns the number of handlers the message
+// was delivered to, or 0 if the publisher isn't in simulation mode.
+func (pub *Publisher) SimulateMessage(address string, message string) int {
+	simulation, isSimulation := pub.messenger.(*messaging.SimulationMessenger)
+	if !isSimulation {
+		return 0
+	}
+	return simulation.SimulateMessage(address, message)
+}
+
+// SubscribeEvent subscribes to the events of a node and invokes the handler with each verified event.
+// Received events are also stored with the domain output values.
+//  nodeAddress is the node address: domain/publisher/nodeID[/$node]. Use '+' wildcards for all nodes.
+func (pub *Publisher) SubscribeEvent(nodeAddress string, handler func(event *types.OutputEventMessage)) {
+	eventAddress := types.MakeMessageAddress(lib.MakeBaseAddress(nodeAddress), types.MessageTypeEvent)
+	pub.messageSigner.SubscribeVerified(eventAddress,
+		func() interface{} { return &types.OutputEventMessage{} },
+		func(address string, object interface{}) error {
+			event := object.(*types.OutputEventMessage)
+			pub.domainOutputValues.UpdateEvent(event)
+			if handler != nil {
+				handler(event)
+			}
+			return nil
+		})
+}
+
 // Subscribe to receive nodes, inputs and outputs from the selected domain and/or publisher
 // To subscribe to all domains or all publishers use "" as the domain or publisherID
 func (pub *Publisher) Subscribe(domain string, publisherID string) {
@@ -363,11 +905,19 @@ func (pub *Publisher) Unsubscribe(domain string, publisherID string) {
 
 // UpdateNodeErrorStatus sets a registered node RunState to the given status with a lasterror message
 // Use NodeRunStateError for errors and NodeRunStateReady to clear error
-// This only updates the node if the status or lastError message changes
+// This only updates the node if the status or lastError message changes. The lastErrorCode is left as is.
 func (pub *Publisher) UpdateNodeErrorStatus(nodeHWID string, status string, lastError string) {
 	pub.registeredNodes.UpdateErrorStatus(nodeHWID, status, lastError)
 }
 
+// UpdateNodeErrorStatusWithCode sets a registered node RunState with a lastError message and a
+// machine readable lastErrorCode, eg types.NodeErrorCodeTimeout. Use an empty code to clear it.
+// This only updates the node if the status, error code or lastError message changes
+func (pub *Publisher) UpdateNodeErrorStatusWithCode(nodeHWID string, status string,
+	errorCode types.NodeErrorCode, lastError string) {
+	pub.registeredNodes.UpdateErrorStatusWithCode(nodeHWID, status, errorCode, lastError)
+}
+
 // UpdateNodeAttr updates one or more attributes of a registered node
 // This only updates the node if the status or lastError message changes
 func (pub *Publisher) UpdateNodeAttr(nodeHWID string, attrParams types.NodeAttrMap) (changed bool) {
@@ -377,8 +927,9 @@ func (pub *Publisher) UpdateNodeAttr(nodeHWID string, attrParams types.NodeAttrM
 // UpdateNodeConfig updates a registered node's configuration and publishes the updated node.
 //  If a config already exists then its value is retained but its configuration parameters are replaced.
 //  Nodes are immutable. A new node is created and published and the old node instance is discarded.
-func (pub *Publisher) UpdateNodeConfig(nodeHWID string, attrName types.NodeAttr, configAttr *types.ConfigAttr) {
-	pub.registeredNodes.UpdateNodeConfig(nodeHWID, attrName, configAttr)
+//  Returns an error if the configuration has an invalid pattern.
+func (pub *Publisher) UpdateNodeConfig(nodeHWID string, attrName types.NodeAttr, configAttr *types.ConfigAttr) error {
+	return pub.registeredNodes.UpdateNodeConfig(nodeHWID, attrName, configAttr)
 }
 
 // UpdateNodeConfigValues updates the configuration values for the given registered node. This takes a map of
@@ -388,6 +939,13 @@ func (pub *Publisher) UpdateNodeConfigValues(nodeHWID string, params types.NodeA
 	return pub.registeredNodes.UpdateNodeConfigValues(nodeHWID, params)
 }
 
+// UpdateNodeHealth computes the health score of a registered node from its error count, last seen
+// and latency status and updates its health status. See SetHealthScoreFunc.
+// Returns the health score and true if the health status has changed, or -1 if the node isn't found
+func (pub *Publisher) UpdateNodeHealth(nodeHWID string) (health int, changed bool) {
+	return pub.registeredNodes.UpdateNodeHealth(nodeHWID)
+}
+
 // UpdateNodeStatus updates one or more status attributes of a registered node
 // This only updates the node if the status changes
 func (pub *Publisher) UpdateNodeStatus(nodeHWID string, status map[types.NodeStatus]string) (changed bool) {
@@ -410,6 +968,9 @@ func (pub *Publisher) UpdateNodeStatus(nodeHWID string, status map[types.NodeSta
 // output attribute. If the output does not exist, this is ignored.
 func (pub *Publisher) UpdateOutput(output *types.OutputDiscoveryMessage) {
 	pub.registeredOutputs.UpdateOutput(output)
+	if output != nil && output.DataType == types.DataTypeBytes {
+		pub.registeredOutputValues.SetBytesOutput(output.OutputID, true)
+	}
 }
 
 // UpdateOutputForecast replaces a forecast
@@ -417,8 +978,52 @@ func (pub *Publisher) UpdateOutputForecast(outputID string, forecast outputs.Out
 	pub.registeredForecastValues.UpdateForecast(outputID, forecast)
 }
 
+// UpdateOutputBytes adds a binary value of an output with the bytes data type to the front of the
+// value history. The value is published base64 encoded like other output values. Intended for small
+// payloads like thumbnails, up to outputs.MaxBytesValueSize. Use PublishRaw for larger payloads.
+// Only the latest binary value is retained and it is not published in $history.
+// Returns true if the history is updated, or an error if the value is too large
+func (pub *Publisher) UpdateOutputBytes(nodeHWID string, outputType types.OutputType, instance string,
+	data []byte) (bool, error) {
+	outputID := outputs.MakeOutputID(nodeHWID, outputType, instance)
+	return pub.registeredOutputValues.UpdateOutputBytes(outputID, data)
+}
+
 // UpdateOutputValue adds the registered node's output value to the front of the value history
 func (pub *Publisher) UpdateOutputValue(nodeHWID string, outputType types.OutputType, instance string, newValue string) bool {
 	outputID := outputs.MakeOutputID(nodeHWID, outputType, instance)
 	return pub.registeredOutputValues.UpdateOutputValue(outputID, newValue)
 }
+
+// UpdateOutputValueAt adds a value that was measured at the given time to the output's history.
+// Use this to backfill readings from devices that buffer them while offline. Values are kept in timestamp order.
+// Returns true if the history is updated
+func (pub *Publisher) UpdateOutputValueAt(nodeHWID string, outputType types.OutputType, instance string,
+	newValue string, timestamp time.Time) bool {
+	outputID := outputs.MakeOutputID(nodeHWID, outputType, instance)
+	return pub.registeredOutputValues.UpdateOutputValueAt(outputID, newValue, timestamp)
+}
+
+// UpdateOutputValueValidated validates the value against the output's data type before adding it to the
+// front of the value history. Use this instead of UpdateOutputValue to reject invalid values.
+// Returns an error if the output doesn't exist or the value is invalid. Use UpdateNodeErrorStatus to
+// report the rejection in the node status.
+func (pub *Publisher) UpdateOutputValueValidated(
+	nodeHWID string, outputType types.OutputType, instance string, newValue string) (updated bool, err error) {
+	output := pub.registeredOutputs.GetOutputByNodeHWID(nodeHWID, outputType, instance)
+	if output == nil {
+		return false, lib.MakeErrorf("UpdateOutputValueValidated: Output %s/%s/%s not found", nodeHWID, outputType, instance)
+	}
+	err = outputs.ValidateOutputValue(output, newValue)
+	if err != nil {
+		return false, err
+	}
+	return pub.registeredOutputValues.UpdateOutputValue(output.OutputID, newValue), nil
+}
+
+// UpdateOutputValues updates multiple output values of a registered node at once. The values are
+// published together with the next update so subscribers see a consistent snapshot of the node's readings.
+// Returns the number of outputs that have been updated.
+func (pub *Publisher) UpdateOutputValues(nodeHWID string, values map[outputs.OutputKey]string) int {
+	return pub.registeredOutputValues.UpdateOutputValues(nodeHWID, values)
+}
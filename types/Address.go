@@ -0,0 +1,122 @@
+// Package types with parsing of publication addresses
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AddressSegments with the components of a publication address:
+//  domain/publisherID/$messageType                               for publisher messages
+//  domain/publisherID/nodeID/$messageType                        for node messages
+//  domain/publisherID/nodeID/outputType/instance/$messageType    for input and output messages
+type AddressSegments struct {
+	Domain      string      // domain of the publisher
+	PublisherID string      // publisher of the message
+	NodeID      string      // node ID or alias. Empty for publisher messages
+	OutputType  string      // output or input type. Empty for publisher and node messages
+	Instance    string      // output or input instance. Empty for publisher and node messages
+	MessageType MessageType // message type, including the '$' prefix
+}
+
+// publisherMessageTypes are published on the publisher address
+var publisherMessageTypes = []MessageType{MessageTypeIdentity, MessageTypeSetIdentity, MessageTypeStatus}
+
+// nodeMessageTypes are published on the node address
+var nodeMessageTypes = []MessageType{MessageTypeConfigure, MessageTypeCreate, MessageTypeDelete,
+	MessageTypeEvent, MessageTypeNodeDelta, MessageTypeNodeDiscovery, MessageTypeNodeStatus, MessageTypeRequest,
+	MessageTypeResponse, MessageTypeSetNodeID, MessageTypeUpgrade}
+
+// ParseAddress splits a publication address into its components and validates it.
+// The number of segments must match the level of the message type. For example a $latest message
+// must have an output address and a $node message must have a node address. Segments cannot be empty
+// or contain wildcards.
+// The address is parsed using the address format in use, see SetAddressFormat.
+// Returns an error if the address is malformed.
+func ParseAddress(address string) (segments *AddressSegments, err error) {
+	return GetAddressFormat().ParseAddress(address)
+}
+
+// containsMessageType returns true if the message type is in the list
+func containsMessageType(list []MessageType, messageType MessageType) bool {
+	for _, mt := range list {
+		if mt == messageType {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAddressOf returns true if an address belongs to the publisher, node, input or output of a base
+// address. For example the $latest address of an output belongs to the node address of the output.
+// The addresses are compared by their parsed segments, so node1 doesn't match node10.
+//  address is a publisher, node, input or output address with optional message type
+//  baseAddress is a publisher, node, input or output address with optional message type
+func IsAddressOf(address string, baseAddress string) bool {
+	segments, err := ParseBaseAddress(address)
+	if err != nil {
+		return false
+	}
+	base, err := ParseBaseAddress(baseAddress)
+	if err != nil {
+		return false
+	}
+	if segments.Domain != base.Domain || segments.PublisherID != base.PublisherID {
+		return false
+	}
+	if base.NodeID != "" && segments.NodeID != base.NodeID {
+		return false
+	}
+	if base.OutputType != "" && (segments.OutputType != base.OutputType || segments.Instance != base.Instance) {
+		return false
+	}
+	return true
+}
+
+// ParseAddressPattern splits an address pattern into its segments and validates it. Patterns are
+// addresses with optional MQTT wildcards, eg "$SYS/#" or "test/+/$time", and are split using the
+// address format in use, see SetAddressFormat.
+//  '+' matches exactly one address segment
+//  '#' matches any number of remaining segments, including none, and must be the last segment
+// Returns an error if the pattern is empty, has an empty segment or a '#' that isn't last
+func ParseAddressPattern(pattern string) (segments []string, err error) {
+	separator := GetAddressFormat().Separator
+	segments = strings.Split(pattern, separator)
+	for index, segment := range segments {
+		if segment == "" {
+			return nil, fmt.Errorf("ParseAddressPattern: Pattern '%s' has an empty segment at position %d",
+				pattern, index+1)
+		} else if segment == "#" && index != len(segments)-1 {
+			return nil, fmt.Errorf("ParseAddressPattern: Pattern '%s' has a '#' wildcard that isn't the last segment",
+				pattern)
+		} else if segment != "+" && segment != "#" && strings.ContainsAny(segment, "+#") {
+			return nil, fmt.Errorf("ParseAddressPattern: Pattern '%s' has a partial wildcard segment at position %d",
+				pattern, index+1)
+		}
+	}
+	return segments, nil
+}
+
+// MatchAddressPattern returns true if an address matches the segments of a pattern. As with MQTT,
+// wildcards in the first segment don't match addresses that start with '$'.
+//  patternSegments are the segments of the pattern, see ParseAddressPattern
+//  address to match
+func MatchAddressPattern(patternSegments []string, address string) bool {
+	if len(patternSegments) == 0 {
+		return false
+	}
+	addressSegments := strings.Split(address, GetAddressFormat().Separator)
+	if strings.HasPrefix(address, "$") && (patternSegments[0] == "+" || patternSegments[0] == "#") {
+		return false
+	}
+	for index, patternSegment := range patternSegments {
+		if patternSegment == "#" {
+			return true
+		} else if index >= len(addressSegments) {
+			return false
+		} else if patternSegment != "+" && patternSegment != addressSegments[index] {
+			return false
+		}
+	}
+	return len(patternSegments) == len(addressSegments)
+}
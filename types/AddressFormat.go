@@ -0,0 +1,290 @@
+// Package types with the format of publication addresses
+package types
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// AddressSegment identifies a segment of a publication address
+type AddressSegment string
+
+// Segments of a publication address, excluding the message type which is always last
+const (
+	SegmentDomain      AddressSegment = "domain"
+	SegmentPublisherID AddressSegment = "publisherId"
+	SegmentNodeID      AddressSegment = "nodeId"
+	SegmentOutputType  AddressSegment = "outputType" // output or input type
+	SegmentInstance    AddressSegment = "instance"   // output or input instance
+)
+
+// AddressFormat describes how publication addresses are composed from their segments. Intended for
+// interoperability with existing deployments whose topic layout differs from the standard.
+// The format is used by ParseAddress, MakeAddress and MakeBaseAddress, and the Make...Address
+// functions of the other packages. The format applies to the whole process.
+type AddressFormat struct {
+	Separator         string           `yaml:"separator"`         // separator of segments. Only "/" is supported as MQTT wildcards require it
+	MessageTypePrefix string           `yaml:"messageTypePrefix"` // prefix of the message type instead of '$'
+	SegmentOrder      []AddressSegment `yaml:"segmentOrder"`      // order of the segments before the message type
+}
+
+// DefaultAddressFormat is the standard address format:
+//  domain/publisherID/nodeID/outputType/instance/$messageType
+var DefaultAddressFormat = AddressFormat{
+	Separator:         "/",
+	MessageTypePrefix: "$",
+	SegmentOrder: []AddressSegment{
+		SegmentDomain, SegmentPublisherID, SegmentNodeID, SegmentOutputType, SegmentInstance},
+}
+
+// the address format in use, see SetAddressFormat
+var addressFormat = DefaultAddressFormat
+var addressFormatMutex = &sync.RWMutex{}
+
+// GetAddressFormat returns the address format in use
+func GetAddressFormat() AddressFormat {
+	addressFormatMutex.RLock()
+	defer addressFormatMutex.RUnlock()
+	return addressFormat
+}
+
+// SetAddressFormat sets the address format used for composing and parsing all publication
+// addresses in the process. Empty fields use the value of DefaultAddressFormat.
+// Returns an error if the format is invalid, in which case the format in use is not changed.
+func SetAddressFormat(format AddressFormat) error {
+	format = format.withDefaults()
+	if format.Separator != DefaultAddressFormat.Separator {
+		// MQTT wildcard subscriptions only match '/' separated topic levels
+		return fmt.Errorf("SetAddressFormat: Separator '%s' is not supported. Use '%s'",
+			format.Separator, DefaultAddressFormat.Separator)
+	}
+	if strings.Contains(format.MessageTypePrefix, format.Separator) || strings.ContainsAny(format.MessageTypePrefix, "+#") {
+		return fmt.Errorf("SetAddressFormat: Message type prefix '%s' contains the separator or a wildcard",
+			format.MessageTypePrefix)
+	}
+	if len(format.SegmentOrder) != len(DefaultAddressFormat.SegmentOrder) {
+		return fmt.Errorf("SetAddressFormat: Segment order must contain %d segments", len(DefaultAddressFormat.SegmentOrder))
+	}
+	for _, segment := range DefaultAddressFormat.SegmentOrder {
+		if format.segmentIndex(segment) < 0 {
+			return fmt.Errorf("SetAddressFormat: Segment order is missing segment '%s'", segment)
+		}
+	}
+	format.SegmentOrder = append([]AddressSegment{}, format.SegmentOrder...)
+
+	addressFormatMutex.Lock()
+	defer addressFormatMutex.Unlock()
+	addressFormat = format
+	return nil
+}
+
+// Equal returns true if both formats compose the same addresses. Empty fields are the default.
+func (format AddressFormat) Equal(other AddressFormat) bool {
+	format = format.withDefaults()
+	other = other.withDefaults()
+	if format.Separator != other.Separator || format.MessageTypePrefix != other.MessageTypePrefix ||
+		len(format.SegmentOrder) != len(other.SegmentOrder) {
+		return false
+	}
+	for index, segment := range format.SegmentOrder {
+		if other.SegmentOrder[index] != segment {
+			return false
+		}
+	}
+	return true
+}
+
+// GetMessageType returns the message type of an address in this format, or "" if the address
+// doesn't end with a message type
+func (format AddressFormat) GetMessageType(address string) MessageType {
+	messageType, _ := format.parseMessageType(address[strings.LastIndex(address, format.Separator)+1:])
+	return messageType
+}
+
+// MakeAddress composes a publication address from its segments using the address format.
+// Empty node, output type and instance segments are omitted and the message type is optional.
+// Use '+' as segment value to create a wildcard address.
+func (format AddressFormat) MakeAddress(segments *AddressSegments) string {
+	values := map[AddressSegment]string{
+		SegmentDomain:      segments.Domain,
+		SegmentPublisherID: segments.PublisherID,
+		SegmentNodeID:      segments.NodeID,
+		SegmentOutputType:  segments.OutputType,
+		SegmentInstance:    segments.Instance,
+	}
+	parts := make([]string, 0, len(format.SegmentOrder)+1)
+	for _, segment := range format.SegmentOrder {
+		if values[segment] != "" || segment == SegmentDomain || segment == SegmentPublisherID {
+			parts = append(parts, values[segment])
+		}
+	}
+	if segments.MessageType != "" {
+		parts = append(parts, format.formatMessageType(segments.MessageType))
+	}
+	return strings.Join(parts, format.Separator)
+}
+
+// MakeMessageAddress appends the message type to a base address, eg a node or output address
+func (format AddressFormat) MakeMessageAddress(baseAddress string, messageType MessageType) string {
+	return baseAddress + format.Separator + format.formatMessageType(messageType)
+}
+
+// MakeBaseAddress returns the address without the message type segment
+func (format AddressFormat) MakeBaseAddress(address string) string {
+	parts := strings.Split(address, format.Separator)
+	if len(parts) < 2 {
+		return address
+	}
+	if _, isMessageType := format.parseMessageType(parts[len(parts)-1]); isMessageType {
+		parts = parts[:len(parts)-1]
+	}
+	return strings.Join(parts, format.Separator)
+}
+
+// ParseBaseAddress splits a publisher, node, input or output address in this format into its
+// components. The message type is optional. Unlike ParseAddress, the level of the address is
+// determined by the number of segments instead of the message type, eg domain/publisherID is a
+// publisher address. Segments can be '+' wildcards but cannot be empty.
+// Returns an error if the address is malformed.
+func (format AddressFormat) ParseBaseAddress(address string) (segments *AddressSegments, err error) {
+	parts := strings.Split(address, format.Separator)
+	segments = &AddressSegments{}
+	if messageType, isMessageType := format.parseMessageType(parts[len(parts)-1]); isMessageType {
+		segments.MessageType = messageType
+		parts = parts[:len(parts)-1]
+	}
+	for index, part := range parts {
+		if part == "" || part == "#" {
+			return nil, fmt.Errorf("ParseBaseAddress: Address '%s' has an empty or wildcard segment at position %d",
+				address, index+1)
+		}
+	}
+	if len(parts) != 2 && len(parts) != 3 && len(parts) != 5 {
+		return nil, fmt.Errorf("ParseBaseAddress: Address '%s' is not a publisher, node, input or output address",
+			address)
+	}
+	format.assignSegments(parts, segments)
+	return segments, nil
+}
+
+// ParseAddress splits a publication address in this format into its components and validates it.
+// See also ParseAddress.
+func (format AddressFormat) ParseAddress(address string) (segments *AddressSegments, err error) {
+	parts := strings.Split(address, format.Separator)
+	for index, part := range parts {
+		if part == "" || part == "+" || part == "#" {
+			return nil, fmt.Errorf("ParseAddress: Address '%s' has an empty or wildcard segment at position %d",
+				address, index+1)
+		}
+	}
+	messageType, isMessageType := format.parseMessageType(parts[len(parts)-1])
+	if !isMessageType || !IsValidMessageType(string(messageType)) {
+		return nil, fmt.Errorf("ParseAddress: Address '%s' doesn't end with a valid message type", address)
+	}
+	expectedLength := 6
+	if containsMessageType(publisherMessageTypes, messageType) {
+		expectedLength = 3
+	} else if containsMessageType(nodeMessageTypes, messageType) {
+		expectedLength = 4
+	}
+	if len(parts) != expectedLength {
+		return nil, fmt.Errorf("ParseAddress: Address '%s' has %d segments while message type %s requires %d",
+			address, len(parts), messageType, expectedLength)
+	}
+	segments = &AddressSegments{MessageType: messageType}
+	format.assignSegments(parts[:len(parts)-1], segments)
+	return segments, nil
+}
+
+// assignSegments assigns the parts of an address without message type to the segments in the
+// order of the format. Publisher addresses have 2 parts, node addresses 3 and others 5.
+func (format AddressFormat) assignSegments(parts []string, segments *AddressSegments) {
+	index := 0
+	for _, segment := range format.SegmentOrder {
+		if (segment == SegmentNodeID && len(parts) < 3) ||
+			((segment == SegmentOutputType || segment == SegmentInstance) && len(parts) < 5) {
+			continue
+		}
+		switch segment {
+		case SegmentDomain:
+			segments.Domain = parts[index]
+		case SegmentPublisherID:
+			segments.PublisherID = parts[index]
+		case SegmentNodeID:
+			segments.NodeID = parts[index]
+		case SegmentOutputType:
+			segments.OutputType = parts[index]
+		case SegmentInstance:
+			segments.Instance = parts[index]
+		}
+		index++
+	}
+}
+
+// formatMessageType returns the message type with the prefix of the format
+func (format AddressFormat) formatMessageType(messageType MessageType) string {
+	return format.MessageTypePrefix + strings.TrimPrefix(string(messageType), "$")
+}
+
+// parseMessageType returns the message type of an address segment with the prefix of the format
+// Returns false if the segment doesn't have the prefix
+func (format AddressFormat) parseMessageType(segment string) (messageType MessageType, isMessageType bool) {
+	if !strings.HasPrefix(segment, format.MessageTypePrefix) {
+		return "", false
+	}
+	return MessageType("$" + strings.TrimPrefix(segment, format.MessageTypePrefix)), true
+}
+
+// withDefaults returns the format with the default value for empty fields
+func (format AddressFormat) withDefaults() AddressFormat {
+	if format.Separator == "" {
+		format.Separator = DefaultAddressFormat.Separator
+	}
+	if format.MessageTypePrefix == "" {
+		format.MessageTypePrefix = DefaultAddressFormat.MessageTypePrefix
+	}
+	if len(format.SegmentOrder) == 0 {
+		format.SegmentOrder = DefaultAddressFormat.SegmentOrder
+	}
+	return format
+}
+
+// segmentIndex returns the position of a segment in the segment order, or -1 if not included
+func (format AddressFormat) segmentIndex(segment AddressSegment) int {
+	for index, s := range format.SegmentOrder {
+		if s == segment {
+			return index
+		}
+	}
+	return -1
+}
+
+// GetMessageType returns the message type of an address using the address format in use, or ""
+// if the address doesn't end with a message type
+func GetMessageType(address string) MessageType {
+	return GetAddressFormat().GetMessageType(address)
+}
+
+// MakeAddress composes a publication address from its segments using the address format in use.
+// See AddressFormat.MakeAddress.
+func MakeAddress(segments *AddressSegments) string {
+	return GetAddressFormat().MakeAddress(segments)
+}
+
+// MakeBaseAddress returns the address without the message type using the address format in use
+func MakeBaseAddress(address string) string {
+	return GetAddressFormat().MakeBaseAddress(address)
+}
+
+// MakeMessageAddress appends the message type to a base address using the address format in use
+//  baseAddress is an address without message type, see MakeBaseAddress
+func MakeMessageAddress(baseAddress string, messageType MessageType) string {
+	return GetAddressFormat().MakeMessageAddress(baseAddress, messageType)
+}
+
+// ParseBaseAddress splits a publisher, node, input or output address with optional message type
+// into its components using the address format in use. See AddressFormat.ParseBaseAddress.
+func ParseBaseAddress(address string) (segments *AddressSegments, err error) {
+	return GetAddressFormat().ParseBaseAddress(address)
+}
@@ -0,0 +1,169 @@
+package types_test
+
+import (
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAddress(t *testing.T) {
+	segments, err := types.ParseAddress("test/publisher1/node1/temperature/0/$latest")
+	require.NoError(t, err)
+	assert.Equal(t, "test", segments.Domain)
+	assert.Equal(t, "publisher1", segments.PublisherID)
+	assert.Equal(t, "node1", segments.NodeID)
+	assert.Equal(t, string(types.OutputTypeTemperature), segments.OutputType)
+	assert.Equal(t, "0", segments.Instance)
+	assert.Equal(t, types.MessageTypeLatest, segments.MessageType)
+
+	segments, err = types.ParseAddress("test/publisher1/node1/$node")
+	require.NoError(t, err)
+	assert.Equal(t, "node1", segments.NodeID)
+	assert.Empty(t, segments.OutputType)
+	assert.Equal(t, types.MessageTypeNodeDiscovery, segments.MessageType)
+
+	segments, err = types.ParseAddress("test/publisher1/$identity")
+	require.NoError(t, err)
+	assert.Equal(t, "publisher1", segments.PublisherID)
+	assert.Empty(t, segments.NodeID)
+
+	// error cases
+	malformed := []string{
+		"",
+		"test",
+		"test/publisher1/node1/temperature/0", // missing message type
+		"test/publisher1/node1/temperature/0/latest", // not a message type
+		"test/publisher1/node1/$latest",              // output message on node address
+		"test/publisher1/node1/switch/0/$node",       // node message on output address
+		"test/publisher1/node1/$identity",            // publisher message on node address
+		"test//node1/$node",                          // empty segment
+		"test/+/node1/$node",                         // wildcard
+	}
+	for _, address := range malformed {
+		_, err = types.ParseAddress(address)
+		assert.Error(t, err, "Expected error for address '%s'", address)
+	}
+}
+
+func TestAddressFormat(t *testing.T) {
+	defer types.SetAddressFormat(types.DefaultAddressFormat)
+	segments := &types.AddressSegments{Domain: "test", PublisherID: "publisher1", NodeID: "node1",
+		OutputType: "temperature", Instance: "0", MessageType: types.MessageTypeLatest}
+
+	// the default format
+	assert.Equal(t, "test/publisher1/node1/temperature/0/$latest", types.MakeAddress(segments))
+	assert.Equal(t, "test/publisher1/$identity", types.MakeAddress(&types.AddressSegments{
+		Domain: "test", PublisherID: "publisher1", MessageType: types.MessageTypeIdentity}))
+	assert.Equal(t, "test/publisher1/node1", types.MakeAddress(&types.AddressSegments{
+		Domain: "test", PublisherID: "publisher1", NodeID: "node1"}))
+
+	// a custom prefix and segment order is used for making and parsing addresses
+	customFormat := types.AddressFormat{
+		MessageTypePrefix: "_",
+		SegmentOrder: []types.AddressSegment{types.SegmentPublisherID, types.SegmentDomain,
+			types.SegmentNodeID, types.SegmentInstance, types.SegmentOutputType},
+	}
+	assert.False(t, customFormat.Equal(types.DefaultAddressFormat))
+	assert.True(t, types.AddressFormat{}.Equal(types.DefaultAddressFormat))
+	err := types.SetAddressFormat(customFormat)
+	require.NoError(t, err)
+	assert.True(t, customFormat.Equal(types.GetAddressFormat()))
+	address := types.MakeAddress(segments)
+	assert.Equal(t, "publisher1/test/node1/0/temperature/_latest", address)
+	assert.Equal(t, types.MessageTypeLatest, types.GetMessageType(address))
+	parsed, err := types.ParseAddress(address)
+	require.NoError(t, err)
+	assert.Equal(t, segments, parsed)
+	parsed, err = types.ParseAddress("publisher1/test/node1/_node")
+	require.NoError(t, err)
+	assert.Equal(t, "node1", parsed.NodeID)
+	assert.Equal(t, types.MessageTypeNodeDiscovery, parsed.MessageType)
+	assert.Equal(t, "publisher1/test/node1", types.MakeBaseAddress("publisher1/test/node1/_node"))
+	assert.Equal(t, "publisher1/test/node1/_event", types.MakeMessageAddress("publisher1/test/node1", types.MessageTypeEvent))
+	_, err = types.ParseAddress("test/publisher1/node1/$node")
+	assert.Error(t, err)
+
+	// base addresses are parsed by their nr of segments with an optional message type
+	parsed, err = types.ParseBaseAddress("publisher1/test")
+	require.NoError(t, err)
+	assert.Equal(t, &types.AddressSegments{Domain: "test", PublisherID: "publisher1"}, parsed)
+	parsed, err = types.ParseBaseAddress("publisher1/test/+/_node")
+	require.NoError(t, err)
+	assert.Equal(t, &types.AddressSegments{Domain: "test", PublisherID: "publisher1", NodeID: "+",
+		MessageType: types.MessageTypeNodeDiscovery}, parsed)
+	parsed, err = types.ParseBaseAddress("publisher1/test/node1/0/temperature")
+	require.NoError(t, err)
+	assert.Equal(t, "temperature", parsed.OutputType)
+	_, err = types.ParseBaseAddress("publisher1")
+	assert.Error(t, err)
+	_, err = types.ParseBaseAddress("publisher1/test/node1/0")
+	assert.Error(t, err)
+	_, err = types.ParseBaseAddress("publisher1//node1")
+	assert.Error(t, err)
+
+	// empty fields use the default
+	err = types.SetAddressFormat(types.AddressFormat{MessageTypePrefix: "_"})
+	require.NoError(t, err)
+	assert.Equal(t, "/", types.GetAddressFormat().Separator)
+	assert.Equal(t, "test/publisher1/node1/temperature/0/_latest", types.MakeAddress(segments))
+
+	// invalid formats are rejected and leave the format unchanged
+	err = types.SetAddressFormat(types.AddressFormat{Separator: "+"})
+	assert.Error(t, err)
+	err = types.SetAddressFormat(types.AddressFormat{Separator: "."})
+	assert.Error(t, err)
+	err = types.SetAddressFormat(types.AddressFormat{MessageTypePrefix: "#"})
+	assert.Error(t, err)
+	err = types.SetAddressFormat(types.AddressFormat{MessageTypePrefix: "$/"})
+	assert.Error(t, err)
+	err = types.SetAddressFormat(types.AddressFormat{SegmentOrder: []types.AddressSegment{types.SegmentDomain}})
+	assert.Error(t, err)
+	err = types.SetAddressFormat(types.AddressFormat{SegmentOrder: []types.AddressSegment{types.SegmentDomain,
+		types.SegmentDomain, types.SegmentNodeID, types.SegmentOutputType, types.SegmentInstance}})
+	assert.Error(t, err)
+	assert.Equal(t, "_", types.GetAddressFormat().MessageTypePrefix)
+}
+
+func TestIsAddressOf(t *testing.T) {
+	const nodeAddress = "test/publisher1/node1/$node"
+	assert.True(t, types.IsAddressOf("test/publisher1/node1/temperature/0/$latest", nodeAddress))
+	assert.True(t, types.IsAddressOf("test/publisher1/node1/$event", nodeAddress))
+	assert.True(t, types.IsAddressOf("test/publisher1/node1", "test/publisher1/$identity"))
+	assert.True(t, types.IsAddressOf("test/publisher1/node1/temperature/0", "test/publisher1/node1/temperature/0/$output"))
+	assert.False(t, types.IsAddressOf("test/publisher1/node10/temperature/0/$latest", nodeAddress))
+	assert.False(t, types.IsAddressOf("test/publisher2/node1/$node", nodeAddress))
+	assert.False(t, types.IsAddressOf("test/publisher1/node1/temperature/1", "test/publisher1/node1/temperature/0"))
+	assert.False(t, types.IsAddressOf("test/publisher1/$identity", nodeAddress))
+	assert.False(t, types.IsAddressOf("invalid", nodeAddress))
+	assert.False(t, types.IsAddressOf(nodeAddress, "invalid"))
+}
+
+func TestAddressPattern(t *testing.T) {
+	sysPattern, err := types.ParseAddressPattern("$SYS/#")
+	require.NoError(t, err)
+	assert.True(t, types.MatchAddressPattern(sysPattern, "$SYS/broker/heartbeat"))
+	assert.True(t, types.MatchAddressPattern(sysPattern, "$SYS"))
+	assert.False(t, types.MatchAddressPattern(sysPattern, "test/$SYS"))
+
+	timePattern, err := types.ParseAddressPattern("test/+/$time")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test", "+", "$time"}, timePattern)
+	assert.True(t, types.MatchAddressPattern(timePattern, "test/timeservice/$time"))
+	assert.False(t, types.MatchAddressPattern(timePattern, "test/timeservice/node1/$time"))
+	assert.False(t, types.MatchAddressPattern(timePattern, "test/timeservice"))
+
+	// wildcards in the first segment don't match system addresses
+	allPattern, _ := types.ParseAddressPattern("#")
+	assert.True(t, types.MatchAddressPattern(allPattern, "test/publisher1/$identity"))
+	assert.False(t, types.MatchAddressPattern(allPattern, "$SYS/broker/heartbeat"))
+	assert.False(t, types.MatchAddressPattern(nil, "test"))
+
+	_, err = types.ParseAddressPattern("")
+	assert.Error(t, err)
+	_, err = types.ParseAddressPattern("test/#/$time")
+	assert.Error(t, err)
+	_, err = types.ParseAddressPattern("test/pub#/$time")
+	assert.Error(t, err)
+}
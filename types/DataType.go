@@ -1,6 +1,16 @@
 // Package types with IoTDomain data types used in input and output messages
 package types
 
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
 // DataType of configuration, input and ouput values.
 type DataType string
 
@@ -26,3 +36,177 @@ const (
 	// value is a json object
 	DataTypeJSON DataType = "json"
 )
+
+// ParseValue converts a value from its string form into the Go type of the data type
+//  boolean returns a bool. Accepted are true/false, 1/0 and on/off
+//  bytes returns a []byte from a base64 encoded string
+//  date returns a time.Time from an ISO8601 string
+//  int returns an int
+//  number returns a float64
+//  vector returns a []float64 from "x, y, z", with optional brackets
+//  json returns the unmarshalled json value
+//  enum, secret, string and other types return the string unchanged
+// Returns an error if the value cannot be parsed as the data type
+func ParseValue(dataType DataType, raw string) (interface{}, error) {
+	var err error
+	var value interface{}
+
+	switch dataType {
+	case DataTypeBool:
+		switch strings.ToLower(raw) {
+		case "on":
+			value = true
+		case "off":
+			value = false
+		default:
+			value, err = strconv.ParseBool(raw)
+		}
+	case DataTypeBytes:
+		value, err = base64.StdEncoding.DecodeString(raw)
+	case DataTypeDate:
+		value, err = time.Parse(TimeFormat, raw)
+		if err != nil {
+			value, err = time.Parse(time.RFC3339Nano, raw)
+		}
+	case DataTypeInt:
+		value, err = strconv.Atoi(raw)
+	case DataTypeNumber:
+		value, err = strconv.ParseFloat(raw, 64)
+	case DataTypeVector:
+		vector := make([]float64, 0)
+		trimmed := strings.Trim(raw, "[]() ")
+		if trimmed != "" {
+			for _, field := range strings.Split(trimmed, ",") {
+				var number float64
+				number, err = strconv.ParseFloat(strings.TrimSpace(field), 64)
+				if err != nil {
+					break
+				}
+				vector = append(vector, number)
+			}
+		}
+		value = vector
+	case DataTypeJSON:
+		err = json.Unmarshal([]byte(raw), &value)
+	default:
+		value = raw
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ParseValue: Value '%s' is not a valid %s: %s", raw, dataType, err)
+	}
+	return value, nil
+}
+
+// FormatValue converts a value into the string form of the data type
+// This is the reverse of ParseValue. Byte arrays are base64 encoded and dates use TimeFormat.
+// Returns an error if the value type doesn't match the data type
+func FormatValue(dataType DataType, value interface{}) (string, error) {
+	var ok bool
+	var raw string
+
+	switch dataType {
+	case DataTypeBool:
+		var boolValue bool
+		boolValue, ok = value.(bool)
+		raw = strconv.FormatBool(boolValue)
+	case DataTypeBytes:
+		var bytesValue []byte
+		bytesValue, ok = value.([]byte)
+		raw = base64.StdEncoding.EncodeToString(bytesValue)
+	case DataTypeDate:
+		var dateValue time.Time
+		dateValue, ok = value.(time.Time)
+		raw = dateValue.Format(TimeFormat)
+	case DataTypeInt:
+		switch intValue := value.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			raw, ok = fmt.Sprint(intValue), true
+		}
+	case DataTypeNumber:
+		switch numberValue := value.(type) {
+		case float64:
+			raw, ok = strconv.FormatFloat(numberValue, 'f', -1, 64), true
+		case float32:
+			raw, ok = strconv.FormatFloat(float64(numberValue), 'f', -1, 32), true
+		case int, int64, int32:
+			raw, ok = fmt.Sprint(numberValue), true
+		}
+	case DataTypeVector:
+		var vector []float64
+		vector, ok = value.([]float64)
+		fields := make([]string, 0, len(vector))
+		for _, number := range vector {
+			fields = append(fields, strconv.FormatFloat(number, 'f', -1, 64))
+		}
+		raw = strings.Join(fields, ", ")
+	case DataTypeJSON:
+		jsonValue, err := json.Marshal(value)
+		raw, ok = string(jsonValue), err == nil
+	default:
+		raw, ok = value.(string)
+	}
+	if !ok {
+		return "", fmt.Errorf("FormatValue: Value '%v' is not a valid %s", value, dataType)
+	}
+	return raw, nil
+}
+
+// TypedValue converts a value from its string form into a value that marshals as a JSON number or
+// boolean, for use in messages that are interpreted without knowing the data type.
+//  boolean returns a bool
+//  int and number return a float64
+// Returns nil for other data types, if the value doesn't match the data type, or if the number is
+// NaN or infinite as these can't be marshalled as JSON.
+func TypedValue(dataType DataType, raw string) interface{} {
+	switch dataType {
+	case DataTypeBool, DataTypeInt, DataTypeNumber:
+		value, err := ParseValue(dataType, raw)
+		if err != nil {
+			return nil
+		}
+		if intValue, isInt := value.(int); isInt {
+			return float64(intValue)
+		}
+		if number, isNumber := value.(float64); isNumber && (math.IsNaN(number) || math.IsInf(number, 0)) {
+			return nil
+		}
+		return value
+	}
+	return nil
+}
+
+// ValidateValue checks if a value in its string form matches a data type and constraints
+// Numbers must parse as a finite float and be within the min/max range if a range is set.
+// Booleans must parse as a bool, enums must be one of the enum values and json must be valid.
+// Other data types are not validated.
+//  min, max is the valid range of numbers. Use 0, 0 for no range
+//  enumValues are the valid values of enum types
+// Returns an error if the value is invalid
+func ValidateValue(dataType DataType, value string, min float32, max float32, enumValues []string) error {
+	switch dataType {
+	case DataTypeBool, DataTypeJSON:
+		if _, err := ParseValue(dataType, value); err != nil {
+			return fmt.Errorf("Value '%s' is not a valid %s", value, dataType)
+		}
+	case DataTypeInt, DataTypeNumber:
+		if _, err := ParseValue(dataType, value); err != nil {
+			return fmt.Errorf("Value '%s' is not a valid %s", value, dataType)
+		}
+		// parse ints as numbers for the range check
+		number, _ := strconv.ParseFloat(value, 64)
+		if math.IsNaN(number) || math.IsInf(number, 0) {
+			return fmt.Errorf("Value '%s' is not a finite %s", value, dataType)
+		}
+		if max > min && (number < float64(min) || number > float64(max)) {
+			return fmt.Errorf("Value '%s' is outside the range %v-%v", value, min, max)
+		}
+	case DataTypeEnum:
+		for _, enumValue := range enumValues {
+			if enumValue == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("Value '%s' is not one of the enum values", value)
+	}
+	return nil
+}
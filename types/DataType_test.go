@@ -0,0 +1,104 @@
+package types_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFormatValue(t *testing.T) {
+	// bytes are base64 encoded
+	bytesValue := []byte{0, 1, 2, 254, 255}
+	raw, err := types.FormatValue(types.DataTypeBytes, bytesValue)
+	require.NoError(t, err)
+	assert.Equal(t, "AAEC/v8=", raw)
+	value, err := types.ParseValue(types.DataTypeBytes, raw)
+	require.NoError(t, err)
+	assert.Equal(t, bytesValue, value)
+	_, err = types.ParseValue(types.DataTypeBytes, "not base64!")
+	assert.Error(t, err)
+
+	value, err = types.ParseValue(types.DataTypeBool, "on")
+	assert.NoError(t, err)
+	assert.Equal(t, true, value)
+	value, err = types.ParseValue(types.DataTypeInt, "42")
+	assert.NoError(t, err)
+	assert.Equal(t, 42, value)
+	_, err = types.ParseValue(types.DataTypeNumber, "N/A")
+	assert.Error(t, err)
+	value, err = types.ParseValue(types.DataTypeVector, "[1.5, 2, 3]")
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{1.5, 2, 3}, value)
+	value, err = types.ParseValue(types.DataTypeEnum, "red")
+	assert.NoError(t, err)
+	assert.Equal(t, "red", value)
+
+	now := time.Now().Truncate(time.Millisecond)
+	raw, err = types.FormatValue(types.DataTypeDate, now)
+	assert.NoError(t, err)
+	value, err = types.ParseValue(types.DataTypeDate, raw)
+	assert.NoError(t, err)
+	assert.True(t, now.Equal(value.(time.Time)))
+
+	raw, err = types.FormatValue(types.DataTypeNumber, 1.25)
+	assert.NoError(t, err)
+	assert.Equal(t, "1.25", raw)
+	raw, err = types.FormatValue(types.DataTypeJSON, map[string]int{"a": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, raw)
+	_, err = types.FormatValue(types.DataTypeInt, "not an int")
+	assert.Error(t, err)
+}
+
+func TestTypedValue(t *testing.T) {
+	assert.Equal(t, 21.5, types.TypedValue(types.DataTypeNumber, "21.5"))
+	assert.Equal(t, float64(42), types.TypedValue(types.DataTypeInt, "42"))
+	assert.Equal(t, true, types.TypedValue(types.DataTypeBool, "on"))
+	assert.Equal(t, false, types.TypedValue(types.DataTypeBool, "false"))
+	assert.Nil(t, types.TypedValue(types.DataTypeNumber, "warm"))
+	assert.Nil(t, types.TypedValue(types.DataTypeString, "42"))
+	assert.Nil(t, types.TypedValue(types.DataTypeVector, "1, 2, 3"))
+	// non-finite numbers can't be marshalled as json
+	assert.Nil(t, types.TypedValue(types.DataTypeNumber, "NaN"))
+	assert.Nil(t, types.TypedValue(types.DataTypeNumber, "+Inf"))
+	assert.Nil(t, types.TypedValue(types.DataTypeNumber, "-Inf"))
+}
+
+func TestValidateValue(t *testing.T) {
+	enumValues := []string{"low", "high"}
+	testCases := []struct {
+		dataType types.DataType
+		value    string
+		min, max float32
+		valid    bool
+	}{
+		{types.DataTypeNumber, "50", 0, 100, true},
+		{types.DataTypeNumber, "-0.5", 0, 0, true},
+		{types.DataTypeNumber, "300", 0, 100, false},
+		{types.DataTypeNumber, "warm", 0, 0, false},
+		{types.DataTypeNumber, "NaN", 0, 0, false},
+		{types.DataTypeNumber, "+Inf", 0, 0, false},
+		{types.DataTypeNumber, "-Inf", 0, 100, false},
+		{types.DataTypeInt, "42", 0, 100, true},
+		{types.DataTypeInt, "4.2", 0, 0, false},
+		{types.DataTypeInt, "101", 0, 100, false},
+		{types.DataTypeBool, "on", 0, 0, true},
+		{types.DataTypeBool, "maybe", 0, 0, false},
+		{types.DataTypeJSON, `{"a":1}`, 0, 0, true},
+		{types.DataTypeJSON, `{"a":`, 0, 0, false},
+		{types.DataTypeEnum, "high", 0, 0, true},
+		{types.DataTypeEnum, "medium", 0, 0, false},
+		{types.DataTypeString, "anything", 0, 0, true},
+	}
+	for _, tc := range testCases {
+		err := types.ValidateValue(tc.dataType, tc.value, tc.min, tc.max, enumValues)
+		if tc.valid {
+			assert.NoError(t, err, "%s '%s'", tc.dataType, tc.value)
+		} else {
+			assert.Error(t, err, "%s '%s'", tc.dataType, tc.value)
+		}
+	}
+}
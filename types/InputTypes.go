@@ -45,6 +45,42 @@ const (
 	InputTypeWaterLevel       InputType = "waterlevel"       // set input control for water level
 )
 
+// InputTypeInfo with the canonical data type and default unit of an input type
+type InputTypeInfo struct {
+	DataType    DataType
+	DefaultUnit Unit
+}
+
+// inputTypeInfoMap defines the data type and default unit of the known input types
+var inputTypeInfoMap = map[InputType]InputTypeInfo{
+	InputTypeChannel:          {DataType: DataTypeString},
+	InputTypeColor:            {DataType: DataTypeString},
+	InputTypeColorTemperature: {DataType: DataTypeNumber, DefaultUnit: UnitKelvin},
+	InputTypeCommand:          {DataType: DataTypeString},
+	InputTypeDimmer:           {DataType: DataTypeNumber, DefaultUnit: UnitPercent},
+	InputTypeHumidity:         {DataType: DataTypeNumber, DefaultUnit: UnitPercent},
+	InputTypeImage:            {DataType: DataTypeBytes},
+	InputTypeLevel:            {DataType: DataTypeNumber},
+	InputTypeLock:             {DataType: DataTypeString},
+	InputTypeMute:             {DataType: DataTypeString},
+	InputTypeSwitch:           {DataType: DataTypeString},
+	InputTypePlay:             {DataType: DataTypeString},
+	InputTypePushButton:       {DataType: DataTypeInt},
+	InputTypeRPM:              {DataType: DataTypeNumber},
+	InputTypeSpeed:            {DataType: DataTypeNumber, DefaultUnit: UnitMetersPerSecond},
+	InputTypeTemperature:      {DataType: DataTypeNumber, DefaultUnit: UnitCelcius},
+	InputTypeValue:            {DataType: DataTypeNumber},
+	InputTypeVoltage:          {DataType: DataTypeNumber, DefaultUnit: UnitVolt},
+	InputTypeWaterLevel:       {DataType: DataTypeNumber, DefaultUnit: UnitMeter},
+}
+
+// GetInputTypeInfo returns the canonical data type and default unit of an input type
+// Returns false if the input type is not known, eg a custom type or one from a newer publisher.
+func GetInputTypeInfo(inputType InputType) (info InputTypeInfo, found bool) {
+	info, found = inputTypeInfoMap[inputType]
+	return info, found
+}
+
 // InputDiscoveryMessage with node input description
 type InputDiscoveryMessage struct {
 	Address    string        `json:"address"`              // Discovery address of the input
@@ -0,0 +1,24 @@
+package types_test
+
+import (
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetInputTypeInfo(t *testing.T) {
+	info, found := types.GetInputTypeInfo(types.InputTypeTemperature)
+	assert.True(t, found)
+	assert.Equal(t, types.DataTypeNumber, info.DataType)
+	assert.Equal(t, types.UnitCelcius, info.DefaultUnit)
+	info, found = types.GetInputTypeInfo(types.InputTypeSwitch)
+	assert.True(t, found)
+	assert.Equal(t, types.UnitNone, info.DefaultUnit)
+
+	// unknown input types are detected
+	_, found = types.GetInputTypeInfo("teleporter")
+	assert.False(t, found)
+	_, found = types.GetInputTypeInfo(types.InputTypeUnknown)
+	assert.False(t, found)
+}
@@ -0,0 +1,49 @@
+// Package types with parsing and geo helpers for the NodeAttrLatLon attribute
+package types
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// EarthRadius is the mean radius of the earth in meters, used by DistanceBetween
+const EarthRadius = 6371000.0
+
+// DistanceBetween returns the great-circle distance in meters between two locations in decimal degrees.
+// This uses the haversine formula with a spherical earth. The error is less than 0.5%.
+func DistanceBetween(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLon := (lon2 - lon1) * toRad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// FormatLatLon returns the NodeAttrLatLon value of a location: "lat,lon" in decimal degrees
+// with 6 decimals, which is accurate to about 0.1 meter.
+func FormatLatLon(lat float64, lon float64) string {
+	return fmt.Sprintf("%.6f,%.6f", lat, lon)
+}
+
+// ParseLatLon parses a NodeAttrLatLon value "lat,lon" in decimal degrees. Spaces around the
+// numbers are allowed.
+// Returns an error if the value is malformed or the latitude isn't in the range -90..90 or the
+// longitude isn't in the range -180..180.
+func ParseLatLon(value string) (lat float64, lon float64, err error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("ParseLatLon: Location '%s' is not in the 'lat,lon' format", value)
+	}
+	lat, err = strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil || math.IsNaN(lat) || lat < -90 || lat > 90 {
+		return 0, 0, fmt.Errorf("ParseLatLon: Latitude of '%s' is not a number in the range -90..90", value)
+	}
+	lon, err = strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil || math.IsNaN(lon) || lon < -180 || lon > 180 {
+		return 0, 0, fmt.Errorf("ParseLatLon: Longitude of '%s' is not a number in the range -180..180", value)
+	}
+	return lat, lon, nil
+}
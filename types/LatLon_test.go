@@ -0,0 +1,38 @@
+package types_test
+
+import (
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLatLon(t *testing.T) {
+	lat, lon, err := types.ParseLatLon("49.2827, -123.1207")
+	assert.NoError(t, err)
+	assert.Equal(t, 49.2827, lat)
+	assert.Equal(t, -123.1207, lon)
+
+	value := types.FormatLatLon(lat, lon)
+	assert.Equal(t, "49.282700,-123.120700", value)
+	lat2, lon2, err := types.ParseLatLon(value)
+	assert.NoError(t, err)
+	assert.Equal(t, lat, lat2)
+	assert.Equal(t, lon, lon2)
+
+	// error cases
+	for _, invalid := range []string{"", "49.2", "49.2,-123.1,5", "north,west", "91,0", "-90.1,0",
+		"0,180.5", "0,-181", "NaN,0", "0,"} {
+		_, _, err = types.ParseLatLon(invalid)
+		assert.Error(t, err, "Expected error for '%s'", invalid)
+	}
+}
+
+func TestDistanceBetween(t *testing.T) {
+	// Vancouver to Seattle is about 195 km
+	distance := types.DistanceBetween(49.2827, -123.1207, 47.6062, -122.3321)
+	assert.InDelta(t, 195000, distance, 1000)
+	assert.Equal(t, 0.0, types.DistanceBetween(10, 20, 10, 20))
+	// half way around the equator
+	assert.InDelta(t, 20015086, types.DistanceBetween(0, 0, 0, 180), 1)
+}
@@ -6,24 +6,66 @@ type MessageType string
 
 // Available message types from the standard
 const (
-	MessageTypeConfigure       = "$configure"   // node configuration, payload is NodeConfigureMessage
-	MessageTypeCreate          = "$create"      // create node command
-	MessageTypeDelete          = "$delete"      // delete node command
-	MessageTypeEvent           = "$event"       // node outputs event, payload is EventMessage
-	MessageTypeForecast        = "$forecast"    // output forecast, payload is HistoryMessage
-	MessageTypeHistory         = "$history"     // output history, payload is HistoryMessage
-	MessageTypeIdentity        = "$identity"    // publisher identity
-	MessageTypeInputDiscovery  = "$input"       // input discovery, payload is InOutput object
-	MessageTypeLatest          = "$latest"      // latest output, payload is latest message
-	MessageTypeNodeDiscovery   = "$node"        // node discovery, payload is Node object
-	MessageTypeOutputDiscovery = "$output"      // output discovery, payload output definition
-	MessageTypeStatus          = "$status"      // publisher runtime status, connected, disconnected, lost
-	MessageTypeSetIdentity     = "$setIdentity" // renew publisher identity keys
-	MessageTypeSetInput        = "$setInput"    // command to set input value, payload is input value
-	MessageTypeSetNodeID       = "$setNodeId"   // set node ID, payload is SetNodeIDMessage
-	MessageTypeUpgrade         = "$upgrade"     // perform firmware upgrade, payload is UpgradeMessage
-	MessageTypeRaw             = "$raw"         // raw output value
-	// LocaldomainID for local-only domains (eg, no sharing outside this domain)
+	MessageTypeConfigure       MessageType = "$configure"   // node configuration, payload is NodeConfigureMessage
+	MessageTypeCreate          MessageType = "$create"      // create node command
+	MessageTypeDelete          MessageType = "$delete"      // delete node command
+	MessageTypeEvent           MessageType = "$event"       // node outputs event, payload is EventMessage
+	MessageTypeForecast        MessageType = "$forecast"    // output forecast, payload is HistoryMessage
+	MessageTypeHistory         MessageType = "$history"     // output history, payload is HistoryMessage
+	MessageTypeIdentity        MessageType = "$identity"    // publisher identity
+	MessageTypeInputDiscovery  MessageType = "$input"       // input discovery, payload is InOutput object
+	MessageTypeLatest          MessageType = "$latest"      // latest output, payload is latest message
+	MessageTypeNodeDiscovery   MessageType = "$node"        // node discovery, payload is Node object
+	MessageTypeNodeDelta       MessageType = "$nodeDelta"   // partial node discovery update, payload is NodeDeltaMessage
+	MessageTypeNodeStatus      MessageType = "$nodeStatus"  // node status update, payload is NodeStatusMessage
+	MessageTypeOutputDiscovery MessageType = "$output"      // output discovery, payload output definition
+	MessageTypeStatus          MessageType = "$status"      // publisher runtime status, connected, disconnected, lost
+	MessageTypeSetIdentity     MessageType = "$setIdentity" // renew publisher identity keys
+	MessageTypeSetInput        MessageType = "$setInput"    // command to set input value, payload is input value
+	MessageTypeSetNodeID       MessageType = "$setNodeId"   // set node ID, payload is SetNodeIDMessage
+	MessageTypeUpgrade         MessageType = "$upgrade"     // perform firmware upgrade, payload is UpgradeMessage
+	MessageTypeRaw             MessageType = "$raw"         // raw output value
+	MessageTypeRequest         MessageType = "$request"     // request to a node, payload is RequestMessage
+	MessageTypeResponse        MessageType = "$response"    // response to a request, payload is ResponseMessage
+)
+
+// LocaldomainID for local-only domains (eg, no sharing outside this domain)
+const (
 	LocalDomainID = "local" // local area domain
 	TestDomainID  = "test"  // Domain to use in testing
 )
+
+// MessageTypes lists all message types from the standard
+var MessageTypes = []MessageType{
+	MessageTypeConfigure,
+	MessageTypeCreate,
+	MessageTypeDelete,
+	MessageTypeEvent,
+	MessageTypeForecast,
+	MessageTypeHistory,
+	MessageTypeIdentity,
+	MessageTypeInputDiscovery,
+	MessageTypeLatest,
+	MessageTypeNodeDiscovery,
+	MessageTypeNodeDelta,
+	MessageTypeNodeStatus,
+	MessageTypeOutputDiscovery,
+	MessageTypeStatus,
+	MessageTypeSetIdentity,
+	MessageTypeSetInput,
+	MessageTypeSetNodeID,
+	MessageTypeUpgrade,
+	MessageTypeRaw,
+	MessageTypeRequest,
+	MessageTypeResponse,
+}
+
+// IsValidMessageType returns true if the given message type is one of the standard message types
+func IsValidMessageType(messageType string) bool {
+	for _, mt := range MessageTypes {
+		if string(mt) == messageType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package types_test
+
+import (
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsValidMessageType(t *testing.T) {
+	// message types used in address construction across the codebase
+	usedTypes := []types.MessageType{
+		types.MessageTypeConfigure,
+		types.MessageTypeEvent,
+		types.MessageTypeForecast,
+		types.MessageTypeHistory,
+		types.MessageTypeIdentity,
+		types.MessageTypeInputDiscovery,
+		types.MessageTypeLatest,
+		types.MessageTypeNodeDiscovery,
+		types.MessageTypeOutputDiscovery,
+		types.MessageTypeRaw,
+		types.MessageTypeSetInput,
+		types.MessageTypeSetNodeID,
+		types.MessageTypeStatus,
+	}
+	for _, messageType := range usedTypes {
+		assert.Contains(t, types.MessageTypes, messageType)
+		assert.True(t, types.IsValidMessageType(string(messageType)), "Message type '%s' not valid", messageType)
+	}
+	for _, messageType := range types.MessageTypes {
+		assert.True(t, types.IsValidMessageType(string(messageType)))
+	}
+
+	assert.False(t, types.IsValidMessageType(""))
+	assert.False(t, types.IsValidMessageType("raw"))
+	assert.False(t, types.IsValidMessageType("$set"))
+	assert.False(t, types.IsValidMessageType("$Latest"))
+}
@@ -0,0 +1,110 @@
+// Package types with partial updates of node discovery messages
+package types
+
+import (
+	"reflect"
+)
+
+// NodeDeltaMessage holds the changes to a node since its previous publication. It is published
+// on the node's $nodeDelta address instead of the full node discovery message to reduce bandwidth.
+// Subscribers merge it into the last known node with MergeNodeDelta.
+type NodeDeltaMessage struct {
+	Address       string        `json:"address"`                 // Node discovery address of the node
+	Attr          NodeAttrMap   `json:"attr,omitempty"`          // Added or changed attributes
+	Config        ConfigAttrMap `json:"config,omitempty"`        // Added or changed configuration
+	Status        NodeStatusMap `json:"status,omitempty"`        // Added or changed status
+	RemovedAttr   []NodeAttr    `json:"removedAttr,omitempty"`   // Attributes that are removed
+	RemovedConfig []NodeAttr    `json:"removedConfig,omitempty"` // Configuration that is removed
+	RemovedStatus []NodeStatus  `json:"removedStatus,omitempty"` // Status attributes that are removed
+	Timestamp     string        `json:"timestamp"`               // Time the node was updated
+}
+
+// IsEmpty returns true if the delta contains no changes
+func (delta *NodeDeltaMessage) IsEmpty() bool {
+	return len(delta.Attr) == 0 && len(delta.Config) == 0 && len(delta.Status) == 0 &&
+		len(delta.RemovedAttr) == 0 && len(delta.RemovedConfig) == 0 && len(delta.RemovedStatus) == 0
+}
+
+// DiffNode returns the changes in attributes, configuration and status between two versions of
+// a node. The address and timestamp are those of the new node.
+//  oldNode is the previously published node
+//  newNode is the updated node
+func DiffNode(oldNode *NodeDiscoveryMessage, newNode *NodeDiscoveryMessage) *NodeDeltaMessage {
+	delta := &NodeDeltaMessage{
+		Address:   newNode.Address,
+		Attr:      make(NodeAttrMap),
+		Config:    make(ConfigAttrMap),
+		Status:    make(NodeStatusMap),
+		Timestamp: newNode.Timestamp,
+	}
+	for key, value := range newNode.Attr {
+		if oldValue, found := oldNode.Attr[key]; !found || oldValue != value {
+			delta.Attr[key] = value
+		}
+	}
+	for key := range oldNode.Attr {
+		if _, found := newNode.Attr[key]; !found {
+			delta.RemovedAttr = append(delta.RemovedAttr, key)
+		}
+	}
+	for key, config := range newNode.Config {
+		// configuration can hold enum lists so compare deep
+		if oldConfig, found := oldNode.Config[key]; !found || !reflect.DeepEqual(oldConfig, config) {
+			delta.Config[key] = config
+		}
+	}
+	for key := range oldNode.Config {
+		if _, found := newNode.Config[key]; !found {
+			delta.RemovedConfig = append(delta.RemovedConfig, key)
+		}
+	}
+	statusDiff := DiffStatus(oldNode.Status, newNode.Status)
+	for key, value := range statusDiff.Added {
+		delta.Status[key] = value
+	}
+	for key, change := range statusDiff.Modified {
+		delta.Status[key] = change.New
+	}
+	for key := range statusDiff.Removed {
+		delta.RemovedStatus = append(delta.RemovedStatus, key)
+	}
+	return delta
+}
+
+// MergeNodeDelta applies the changes of a delta to a node and returns the updated node.
+// The given node is not modified.
+func MergeNodeDelta(node *NodeDiscoveryMessage, delta *NodeDeltaMessage) *NodeDiscoveryMessage {
+	merged := *node
+	merged.Attr = make(NodeAttrMap)
+	for key, value := range node.Attr {
+		merged.Attr[key] = value
+	}
+	for key, value := range delta.Attr {
+		merged.Attr[key] = value
+	}
+	for _, key := range delta.RemovedAttr {
+		delete(merged.Attr, key)
+	}
+	merged.Config = make(ConfigAttrMap)
+	for key, config := range node.Config {
+		merged.Config[key] = config
+	}
+	for key, config := range delta.Config {
+		merged.Config[key] = config
+	}
+	for _, key := range delta.RemovedConfig {
+		delete(merged.Config, key)
+	}
+	merged.Status = make(NodeStatusMap)
+	for key, value := range node.Status {
+		merged.Status[key] = value
+	}
+	for key, value := range delta.Status {
+		merged.Status[key] = value
+	}
+	for _, key := range delta.RemovedStatus {
+		delete(merged.Status, key)
+	}
+	merged.Timestamp = delta.Timestamp
+	return &merged
+}
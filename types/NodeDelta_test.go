@@ -0,0 +1,45 @@
+package types_test
+
+import (
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeDelta(t *testing.T) {
+	oldNode := &types.NodeDiscoveryMessage{
+		Address: "test/pub1/node1/$node",
+		Attr:    types.NodeAttrMap{types.NodeAttrName: "bob", types.NodeAttrDescription: "old"},
+		Config: types.ConfigAttrMap{
+			types.NodeAttrName:         {DataType: types.DataTypeString},
+			types.NodeAttrPollInterval: {DataType: types.DataTypeInt},
+		},
+		Status:    types.NodeStatusMap{types.NodeStatusHealth: "90"},
+		Timestamp: "2020-01-01T10:00:00.000-0000",
+	}
+	newNode := types.MergeNodeDelta(oldNode, &types.NodeDeltaMessage{Timestamp: "2020-01-01T10:00:01.000-0000"})
+	assert.Equal(t, oldNode.Attr, newNode.Attr)
+	newNode.Attr[types.NodeAttrName] = "alice"
+	delete(newNode.Attr, types.NodeAttrDescription)
+	newNode.Config[types.NodeAttrPollInterval] = types.ConfigAttr{DataType: types.DataTypeInt, Default: "600"}
+	newNode.Status[types.NodeStatusBatteryLevel] = "80"
+	delete(newNode.Status, types.NodeStatusHealth)
+	assert.Equal(t, "bob", oldNode.Attr[types.NodeAttrName], "merge modified the original node")
+
+	// only the changes are included
+	delta := types.DiffNode(oldNode, newNode)
+	assert.False(t, delta.IsEmpty())
+	assert.Equal(t, types.NodeAttrMap{types.NodeAttrName: "alice"}, delta.Attr)
+	assert.Equal(t, []types.NodeAttr{types.NodeAttrDescription}, delta.RemovedAttr)
+	assert.Len(t, delta.Config, 1)
+	assert.Empty(t, delta.RemovedConfig)
+	assert.Equal(t, types.NodeStatusMap{types.NodeStatusBatteryLevel: "80"}, delta.Status)
+	assert.Equal(t, []types.NodeStatus{types.NodeStatusHealth}, delta.RemovedStatus)
+	assert.Equal(t, newNode.Timestamp, delta.Timestamp)
+
+	// merging the delta restores the new node
+	merged := types.MergeNodeDelta(oldNode, delta)
+	assert.Equal(t, newNode, merged)
+	assert.True(t, types.DiffNode(newNode, merged).IsEmpty())
+}
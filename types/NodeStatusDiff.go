@@ -0,0 +1,46 @@
+// Package types with the difference between two sets of node status attributes
+package types
+
+// NodeStatusChange holds the old and new value of a modified status attribute
+type NodeStatusChange struct {
+	Old string // value before the change
+	New string // value after the change
+}
+
+// NodeStatusDiff describes which status attributes have changed
+type NodeStatusDiff struct {
+	Added    NodeStatusMap                   // attributes that didn't exist, with their new value
+	Removed  NodeStatusMap                   // attributes that no longer exist, with their old value
+	Modified map[NodeStatus]NodeStatusChange // attributes whose value has changed
+}
+
+// IsEmpty returns true if the diff contains no changes
+func (diff *NodeStatusDiff) IsEmpty() bool {
+	return len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Modified) == 0
+}
+
+// DiffStatus compares two sets of node status attributes and returns which attributes are added,
+// removed or modified. Intended for logging and selective publication of status changes.
+//  oldStatus is the status before the change. nil is an empty status
+//  newStatus is the status after the change. nil is an empty status
+func DiffStatus(oldStatus NodeStatusMap, newStatus NodeStatusMap) NodeStatusDiff {
+	diff := NodeStatusDiff{
+		Added:    make(NodeStatusMap),
+		Removed:  make(NodeStatusMap),
+		Modified: make(map[NodeStatus]NodeStatusChange),
+	}
+	for key, newValue := range newStatus {
+		oldValue, exists := oldStatus[key]
+		if !exists {
+			diff.Added[key] = newValue
+		} else if oldValue != newValue {
+			diff.Modified[key] = NodeStatusChange{Old: oldValue, New: newValue}
+		}
+	}
+	for key, oldValue := range oldStatus {
+		if _, exists := newStatus[key]; !exists {
+			diff.Removed[key] = oldValue
+		}
+	}
+	return diff
+}
@@ -0,0 +1,34 @@
+package types_test
+
+import (
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffStatus(t *testing.T) {
+	oldStatus := types.NodeStatusMap{
+		types.NodeStatusHealth:     "90",
+		types.NodeStatusLastError:  "",
+		types.NodeStatusErrorCount: "1",
+	}
+	newStatus := types.NodeStatusMap{
+		types.NodeStatusHealth:       "45",
+		types.NodeStatusErrorCount:   "1",
+		types.NodeStatusBatteryLevel: "80",
+	}
+	diff := types.DiffStatus(oldStatus, newStatus)
+	assert.False(t, diff.IsEmpty())
+	assert.Equal(t, types.NodeStatusMap{types.NodeStatusBatteryLevel: "80"}, diff.Added)
+	assert.Equal(t, types.NodeStatusMap{types.NodeStatusLastError: ""}, diff.Removed)
+	assert.Equal(t, map[types.NodeStatus]types.NodeStatusChange{
+		types.NodeStatusHealth: {Old: "90", New: "45"}}, diff.Modified)
+
+	diff = types.DiffStatus(newStatus, newStatus)
+	assert.True(t, diff.IsEmpty())
+	diff = types.DiffStatus(nil, newStatus)
+	assert.Equal(t, 3, len(diff.Added))
+	diff = types.DiffStatus(oldStatus, nil)
+	assert.Equal(t, 3, len(diff.Removed))
+}
@@ -0,0 +1,23 @@
+// Package types with node status updates that are published separately from node discovery
+package types
+
+// NodeStatusMessage holds the status of a node. It is published on the node's $nodeStatus address
+// when only the status has changed, so frequent status updates don't republish the full node
+// discovery message. Subscribers merge it into the last known node with MergeNodeStatus.
+type NodeStatusMessage struct {
+	Address   string        `json:"address"`          // Node discovery address of the node
+	Status    NodeStatusMap `json:"status,omitempty"` // Node performance status information
+	Timestamp string        `json:"timestamp"`        // Time the status was updated
+}
+
+// MergeNodeStatus replaces the status of a node and returns the updated node.
+// The given node is not modified.
+func MergeNodeStatus(node *NodeDiscoveryMessage, status *NodeStatusMessage) *NodeDiscoveryMessage {
+	merged := *node
+	merged.Status = make(NodeStatusMap)
+	for key, value := range status.Status {
+		merged.Status[key] = value
+	}
+	merged.Timestamp = status.Timestamp
+	return &merged
+}
@@ -14,42 +14,45 @@ type NodeAttrMap map[NodeAttr]string
 // Predefined node attribute names that describe the node.
 // When they are configurable they also appear in Node Config section.
 const (
-	NodeAttrAddress         NodeAttr = "address"         // device domain or ip address
-	NodeAttrBatch           NodeAttr = "batch"           // Batch publishing size
-	NodeAttrColor           NodeAttr = "color"           // Color in hex notation
-	NodeAttrDescription     NodeAttr = "description"     // Device description
-	NodeAttrDisabled        NodeAttr = "disabled"        // device or sensor is disabled
-	NodeAttrEvent           NodeAttr = "event"           // Enable/disable event publishing
-	NodeAttrFilename        NodeAttr = "filename"        // filename to write images or other values to
-	NodeAttrGatewayAddress  NodeAttr = "gatewayAddress"  // the node gateway address
-	NodeAttrHostname        NodeAttr = "hostname"        // network device hostname
-	NodeAttrIotcVersion     NodeAttr = "iotcVersion"     // IoTDomain version
-	NodeAttrLatLon          NodeAttr = "latlon"          // latitude, longitude of the device for display on a map r/w
-	NodeAttrLocalIP         NodeAttr = "localIP"         // for IP nodes
-	NodeAttrLocationName    NodeAttr = "locationName"    // name of a location
-	NodeAttrLoginName       NodeAttr = "loginName"       // login name to connect to the device. Value is not published
-	NodeAttrMAC             NodeAttr = "mac"             // MAC address for IP nodes
-	NodeAttrManufacturer    NodeAttr = "manufacturer"    // device manufacturer
-	NodeAttrMax             NodeAttr = "max"             // maximum value of sensor or config
-	NodeAttrMin             NodeAttr = "min"             // minimum value of sensor or config
-	NodeAttrModel           NodeAttr = "model"           // device model
-	NodeAttrName            NodeAttr = "name"            // Name of device or service
-	NodeAttrNetmask         NodeAttr = "netmask"         // IP network mask
-	NodeAttrPassword        NodeAttr = "password"        // password to connect. Value is not published.
-	NodeAttrPublishBatch    NodeAttr = "publishBatch"    // int with nr of events per batch, 0 to disable
-	NodeAttrPublishEvent    NodeAttr = "publishEvent"    // enable publishing as event
-	NodeAttrPublishForecast NodeAttr = "publishForecast" // bool, publish output with $forecast message
-	NodeAttrPublishHistory  NodeAttr = "publishHistory"  // bool, publish output with $history message
-	NodeAttrPublishLatest   NodeAttr = "publishLatest"   // bool, publish output with $latest message
-	NodeAttrPublishRaw      NodeAttr = "publishRaw"      // bool, publish output with $raw message
-	NodeAttrPollInterval    NodeAttr = "pollInterval"    // polling interval in seconds
-	NodeAttrPowerSource     NodeAttr = "powerSource"     // battery, usb, mains
-	NodeAttrProduct         NodeAttr = "product"         // device product or model name
-	NodeAttrPublicKey       NodeAttr = "publicKey"       // public key for encrypting sensitive configuration settings
-	NodeAttrSoftwareVersion NodeAttr = "softwareVersion" // version of the software running the node
-	NodeAttrSubnet          NodeAttr = "subnet"          // IP subnets configuration
-	NodeAttrType            NodeAttr = "type"            // Node type
-	NodeAttrURL             NodeAttr = "url"             // node URL
+	NodeAttrAddress           NodeAttr = "address"           // device domain or ip address
+	NodeAttrAuthorizedSenders NodeAttr = "authorizedSenders" // comma separated publisher IDs that can configure and command the node
+	NodeAttrBatch             NodeAttr = "batch"             // Batch publishing size
+	NodeAttrColor             NodeAttr = "color"             // Color in hex notation
+	NodeAttrDescription       NodeAttr = "description"       // Device description
+	NodeAttrDisabled          NodeAttr = "disabled"          // device or sensor is disabled
+	NodeAttrEvent             NodeAttr = "event"             // Enable/disable event publishing
+	NodeAttrFilename          NodeAttr = "filename"          // filename to write images or other values to
+	NodeAttrFirmwareAvailable NodeAttr = "firmwareAvailable" // version of firmware available for update, "" if none
+	NodeAttrGatewayAddress    NodeAttr = "gatewayAddress"    // the node gateway address
+	NodeAttrHostname          NodeAttr = "hostname"          // network device hostname
+	NodeAttrIotcVersion       NodeAttr = "iotcVersion"       // IoTDomain version
+	NodeAttrLatLon            NodeAttr = "latlon"            // latitude, longitude of the device for display on a map r/w
+	NodeAttrLocalIP           NodeAttr = "localIP"           // for IP nodes
+	NodeAttrLocationName      NodeAttr = "locationName"      // name of a location
+	NodeAttrLoginName         NodeAttr = "loginName"         // login name to connect to the device. Value is not published
+	NodeAttrMAC               NodeAttr = "mac"               // MAC address for IP nodes
+	NodeAttrManufacturer      NodeAttr = "manufacturer"      // device manufacturer
+	NodeAttrMax               NodeAttr = "max"               // maximum value of sensor or config
+	NodeAttrMin               NodeAttr = "min"               // minimum value of sensor or config
+	NodeAttrModel             NodeAttr = "model"             // device model
+	NodeAttrName              NodeAttr = "name"              // Name of device or service
+	NodeAttrNetmask           NodeAttr = "netmask"           // IP network mask
+	NodeAttrPassword          NodeAttr = "password"          // password to connect. Value is not published.
+	NodeAttrPublishBatch      NodeAttr = "publishBatch"      // int with nr of events per batch, 0 to disable
+	NodeAttrPublishEvent      NodeAttr = "publishEvent"      // enable publishing as event
+	NodeAttrPublishForecast   NodeAttr = "publishForecast"   // bool, publish output with $forecast message
+	NodeAttrPublishHistory    NodeAttr = "publishHistory"    // bool, publish output with $history message
+	NodeAttrPublishLatest     NodeAttr = "publishLatest"     // bool, publish output with $latest message
+	NodeAttrPublishRaw        NodeAttr = "publishRaw"        // bool, publish output with $raw message
+	NodeAttrPollInterval      NodeAttr = "pollInterval"      // polling interval in seconds
+	NodeAttrPowerSource       NodeAttr = "powerSource"       // battery, usb, mains
+	NodeAttrProduct           NodeAttr = "product"           // device product or model name
+	NodeAttrPublicKey         NodeAttr = "publicKey"         // public key for encrypting sensitive configuration settings
+	NodeAttrSoftwareVersion   NodeAttr = "softwareVersion"   // version of the software running the node
+	NodeAttrSubnet            NodeAttr = "subnet"            // IP subnets configuration
+	NodeAttrType              NodeAttr = "type"              // Node type
+	NodeAttrUpdatePending     NodeAttr = "updatePending"     // bool, a firmware update is scheduled
+	NodeAttrURL               NodeAttr = "url"               // node URL
 )
 
 // NodeStatus various node status attributes
@@ -61,25 +64,62 @@ type NodeStatusMap map[NodeStatus]string
 // Various NodeStatus attributes that describe the recent status of the node
 // These indicate how the node is performing and are updated with each publication, typically once a day
 const (
-	NodeStatusErrorCount    NodeStatus = "errorCount"    // nr of errors reported on this device
-	NodeStatusHealth        NodeStatus = "health"        // health status of the device 0-100%
-	NodeStatusLastError     NodeStatus = "lastError"     // most recent error message, or "" if no error
-	NodeStatusLastSeen      NodeStatus = "lastSeen"      // ISO time the device was last seen
-	NodeStatusLatencyMSec   NodeStatus = "latencymsec"   // duration connect to sensor in milliseconds
-	NodeStatusNeighborCount NodeStatus = "neighborCount" // mesh network nr of neighbors
-	NodeStatusNeighborIDs   NodeStatus = "neighborIDs"   // mesh network device neighbors ID list [id,id,...]
-	NodeStatusRxCount       NodeStatus = "rxCount"       // Nr of messages received from device
-	NodeStatusTxCount       NodeStatus = "txCount"       // Nr of messages send to device
-	NodeStatusRunState      NodeStatus = "runState"      // Node run-state as per below
+	NodeStatusBatteryLevel   NodeStatus = "batteryLevel"   // battery charge level in percent 0-100
+	NodeStatusErrorCount     NodeStatus = "errorCount"     // nr of errors reported on this device
+	NodeStatusHealth         NodeStatus = "health"         // health status of the device 0-100%
+	NodeStatusLastError      NodeStatus = "lastError"      // most recent error message, or "" if no error
+	NodeStatusLastErrorCode  NodeStatus = "lastErrorCode"  // machine readable code of the most recent error, see NodeErrorCode
+	NodeStatusLastSeen       NodeStatus = "lastSeen"       // ISO time the device was last seen
+	NodeStatusLatencyMSec    NodeStatus = "latencymsec"    // duration connect to sensor in milliseconds
+	NodeStatusNeighborCount  NodeStatus = "neighborCount"  // mesh network nr of neighbors
+	NodeStatusNeighborIDs    NodeStatus = "neighborIDs"    // mesh network device neighbors ID list [id,id,...]
+	NodeStatusRxCount        NodeStatus = "rxCount"        // Nr of messages received from device
+	NodeStatusTxCount        NodeStatus = "txCount"        // Nr of messages send to device
+	NodeStatusRunState       NodeStatus = "runState"       // Node run-state as per below
+	NodeStatusSignalStrength NodeStatus = "signalStrength" // RF signal strength in dBm
+	NodeStatusUpdateProgress NodeStatus = "updateProgress" // firmware update progress in percent 0-100
 )
 
 // Values for Node State
 // These reflect whether a node is ready, sleeping or in error
 const (
-	NodeRunStateError    string = "error"    // Node reports an error
-	NodeRunStateReady    string = "ready"    // Node is ready for use
-	NodeRunStateSleeping string = "sleeping" // Node has gone into sleep mode, often a battery powered devie
-	NodeRunStateLost     string = "lost"     // Node is is no longer reachable
+	NodeRunStateDisconnected string = "disconnected" // Node's publisher has cleanly disconnected
+	NodeRunStateError        string = "error"        // Node reports an error
+	NodeRunStateReady        string = "ready"        // Node is ready for use
+	NodeRunStateSleeping     string = "sleeping"     // Node has gone into sleep mode, often a battery powered devie
+	NodeRunStateLost         string = "lost"         // Node is is no longer reachable
+)
+
+// NodeRunStates lists all node run states from the standard
+var NodeRunStates = []string{
+	NodeRunStateDisconnected,
+	NodeRunStateError,
+	NodeRunStateReady,
+	NodeRunStateSleeping,
+	NodeRunStateLost,
+}
+
+// IsValidRunState returns true if the given run state is one of the standard run states
+// Unknown run states, eg from a newer publisher, can still be stored.
+func IsValidRunState(runState string) bool {
+	for _, rs := range NodeRunStates {
+		if rs == runState {
+			return true
+		}
+	}
+	return false
+}
+
+// NodeErrorCode is a machine readable code of a node error, intended for aggregating errors by cause.
+// Custom codes can be used in addition to the standard codes.
+type NodeErrorCode string
+
+// Standard node error codes
+const (
+	NodeErrorCodeAuth        NodeErrorCode = "auth"        // authentication with the device or service failed
+	NodeErrorCodeBadConfig   NodeErrorCode = "badConfig"   // the node configuration is invalid
+	NodeErrorCodeTimeout     NodeErrorCode = "timeout"     // the device or service didn't respond in time
+	NodeErrorCodeUnreachable NodeErrorCode = "unreachable" // the device or service can't be reached
 )
 
 // NodeType identifying  the purpose of the node
@@ -91,6 +131,7 @@ const (
 	NodeTypeAlarm          NodeType = "alarm"          // an alarm emitter
 	NodeTypeAVControl      NodeType = "avControl"      // Audio/Video controller
 	NodeTypeAVReceiver     NodeType = "avReceiver"     // Node is a (not so) smart radio/receiver/amp (eg, denon)
+	NodeTypeBattery        NodeType = "battery"        // Node is a battery energy storage system
 	NodeTypeBeacon         NodeType = "beacon"         // device is a location beacon
 	NodeTypeButton         NodeType = "button"         // device is a physical button device with one or more buttons
 	NodeTypeAdapter        NodeType = "adapter"        // software adapter or service, eg virtual device
@@ -98,6 +139,7 @@ const (
 	NodeTypeCamera         NodeType = "camera"         // Node with camera
 	NodeTypeComputer       NodeType = "computer"       // General purpose computer
 	NodeTypeDimmer         NodeType = "dimmer"         // light dimmer
+	NodeTypeEVCharger      NodeType = "evCharger"      // Node is an electric vehicle charging station
 	NodeTypeGateway        NodeType = "gateway"        // Node is a gateway for other nodes (onewire, zwave, etc)
 	NodeTypeKeypad         NodeType = "keypad"         // Entry key pad
 	NodeTypeLock           NodeType = "lock"           // Electronic door lock
@@ -110,6 +152,7 @@ const (
 	NodeTypePowerMeter     NodeType = "powerMeter"     // Node is a power meter
 	NodeTypeSensor         NodeType = "sensor"         // Node is a single sensor (volt,...)
 	NodeTypeSmartlight     NodeType = "smartlight"     // Node is a smart light, eg philips hue
+	NodeTypeSolarPanel     NodeType = "solarPanel"     // Node is a solar panel or solar inverter
 	NodeTypeThermometer    NodeType = "thermometer"    // Node is a temperature meter
 	NodeTypeThermostat     NodeType = "thermostat"     // Node is a thermostat control unit
 	NodeTypeTV             NodeType = "tv"             // Node is a (not so) smart TV
@@ -121,6 +164,55 @@ const (
 	NodeTypeWeighScale     NodeType = "weighScale"     // Node is an electronic weight scale
 )
 
+// NodeTypes lists all node types from the standard
+var NodeTypes = []NodeType{
+	NodeTypeAlarm,
+	NodeTypeAVControl,
+	NodeTypeAVReceiver,
+	NodeTypeBattery,
+	NodeTypeBeacon,
+	NodeTypeButton,
+	NodeTypeAdapter,
+	NodeTypePhone,
+	NodeTypeCamera,
+	NodeTypeComputer,
+	NodeTypeDimmer,
+	NodeTypeEVCharger,
+	NodeTypeGateway,
+	NodeTypeKeypad,
+	NodeTypeLock,
+	NodeTypeMultisensor,
+	NodeTypeNetRepeater,
+	NodeTypeNetRouter,
+	NodeTypeNetSwitch,
+	NodeTypeNetWifiAP,
+	NodeTypeOnOffSwitch,
+	NodeTypePowerMeter,
+	NodeTypeSensor,
+	NodeTypeSmartlight,
+	NodeTypeSolarPanel,
+	NodeTypeThermometer,
+	NodeTypeThermostat,
+	NodeTypeTV,
+	NodeTypeUnknown,
+	NodeTypeWallpaper,
+	NodeTypeWaterValve,
+	NodeTypeWeatherService,
+	NodeTypeWeatherStation,
+	NodeTypeWeighScale,
+}
+
+// IsValidNodeType returns true if the given node type is one of the standard node types
+// Unknown node types, eg from a newer publisher, can still be stored.
+func IsValidNodeType(nodeType string) bool {
+	for _, nt := range NodeTypes {
+		if string(nt) == nodeType {
+			return true
+		}
+	}
+	return false
+}
+
 // ConfigAttrMap for storing node configuration
 type ConfigAttrMap map[NodeAttr]ConfigAttr
 
@@ -132,7 +224,10 @@ type ConfigAttr struct {
 	Enum        []string `json:"enum,omitempty"`        // Possible valid enum values
 	Max         float64  `json:"max,omitempty"`         // Max value for numbers
 	Min         float64  `json:"min,omitempty"`         // Min value for numbers
+	Pattern     string   `json:"pattern,omitempty"`     // Regular expression that string values must match
 	Secret      bool     `json:"secret,omitempty"`      // The configuration attribute is secret. Don't show with attributes.
+	Step        float64  `json:"step,omitempty"`        // Step size hint for numbers
+	Unit        Unit     `json:"unit,omitempty"`        // Unit of numbers, eg seconds
 }
 
 // NodeConfigureMessage with values to update a node configuration
@@ -154,6 +249,9 @@ type NodeDiscoveryMessage struct {
 	Timestamp string        `json:"timestamp"`        // time the record is last updated
 	// For convenience, filled when registering or receiving
 	PublisherID string `json:"-"`
+	// Set when receiving a node whose run state or type isn't a standard value, eg from a newer publisher
+	UnknownRunState bool `json:"-"`
+	UnknownType     bool `json:"-"`
 }
 
 // SetNodeIDMessage to change a node's ID
@@ -163,3 +261,23 @@ type SetNodeIDMessage struct {
 	Sender    string `json:"sender"`  // sending node: zone/publisher/node
 	Timestamp string `json:"timestamp"`
 }
+
+// RequestMessage with a request to a node that expects a ResponseMessage on the reply-to address
+type RequestMessage struct {
+	Address       string `json:"address"`       // zone/publisher/node/$request
+	CorrelationID string `json:"correlationId"` // unique ID of the request, included in the response
+	Payload       string `json:"payload"`       // request content
+	ReplyTo       string `json:"replyTo"`       // address to publish the response on
+	Sender        string `json:"sender"`        // identity address of the requesting publisher
+	Timestamp     string `json:"timestamp"`
+}
+
+// ResponseMessage with the response to a RequestMessage
+type ResponseMessage struct {
+	Address       string `json:"address"`         // reply-to address of the request
+	CorrelationID string `json:"correlationId"`   // ID of the request this responds to
+	Error         string `json:"error,omitempty"` // error if the request failed
+	Payload       string `json:"payload"`         // response content
+	Sender        string `json:"sender"`          // identity address of the responding publisher
+	Timestamp     string `json:"timestamp"`
+}
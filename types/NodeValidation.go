@@ -0,0 +1,37 @@
+// Package types with validation of received node discovery messages
+package types
+
+import (
+	"fmt"
+)
+
+// ValidateNodeDiscovery checks that a node discovery message has its required fields and that they
+// are consistent with its address. Intended to reject malformed announcements from other publishers.
+// Required are a valid $node address, the NodeID and PublisherID of that address, and the node type attribute.
+// Returns an error describing the first problem found, or nil if the message is valid.
+func ValidateNodeDiscovery(msg *NodeDiscoveryMessage) error {
+	if msg == nil {
+		return fmt.Errorf("ValidateNodeDiscovery: Missing node discovery message")
+	}
+	segments, err := ParseAddress(msg.Address)
+	if err != nil {
+		return fmt.Errorf("ValidateNodeDiscovery: Invalid node address: %s", err)
+	}
+	if segments.MessageType != MessageTypeNodeDiscovery {
+		return fmt.Errorf("ValidateNodeDiscovery: Address '%s' is not a node discovery address", msg.Address)
+	}
+	if msg.NodeID == "" {
+		return fmt.Errorf("ValidateNodeDiscovery: Node '%s' has no nodeId", msg.Address)
+	} else if msg.NodeID != segments.NodeID {
+		return fmt.Errorf("ValidateNodeDiscovery: NodeID '%s' doesn't match address '%s'", msg.NodeID, msg.Address)
+	}
+	if msg.PublisherID == "" {
+		return fmt.Errorf("ValidateNodeDiscovery: Node '%s' has no publisher", msg.Address)
+	} else if msg.PublisherID != segments.PublisherID {
+		return fmt.Errorf("ValidateNodeDiscovery: Publisher '%s' doesn't match address '%s'", msg.PublisherID, msg.Address)
+	}
+	if msg.Attr[NodeAttrType] == "" {
+		return fmt.Errorf("ValidateNodeDiscovery: Node '%s' has no type attribute", msg.Address)
+	}
+	return nil
+}
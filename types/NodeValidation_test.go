@@ -0,0 +1,58 @@
+package types_test
+
+import (
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateNodeDiscovery(t *testing.T) {
+	newMsg := func() *types.NodeDiscoveryMessage {
+		return &types.NodeDiscoveryMessage{
+			Address:     "test/publisher1/node1/$node",
+			Attr:        types.NodeAttrMap{types.NodeAttrType: string(types.NodeTypeSensor)},
+			HWID:        "node1",
+			NodeID:      "node1",
+			PublisherID: "publisher1",
+		}
+	}
+	assert.NoError(t, types.ValidateNodeDiscovery(newMsg()))
+
+	assert.Error(t, types.ValidateNodeDiscovery(nil))
+	msg := newMsg()
+	msg.Address = "test/publisher1/node1"
+	assert.Error(t, types.ValidateNodeDiscovery(msg), "Invalid address")
+	msg = newMsg()
+	msg.Address = "test/publisher1/node1/$configure"
+	assert.Error(t, types.ValidateNodeDiscovery(msg), "Not a discovery address")
+	msg = newMsg()
+	msg.NodeID = ""
+	assert.Error(t, types.ValidateNodeDiscovery(msg), "Missing nodeID")
+	msg = newMsg()
+	msg.NodeID = "node2"
+	assert.Error(t, types.ValidateNodeDiscovery(msg), "NodeID doesn't match address")
+	msg = newMsg()
+	msg.PublisherID = ""
+	assert.Error(t, types.ValidateNodeDiscovery(msg), "Missing publisher")
+	msg = newMsg()
+	msg.PublisherID = "publisher2"
+	assert.Error(t, types.ValidateNodeDiscovery(msg), "Publisher doesn't match address")
+	msg = newMsg()
+	msg.Attr = nil
+	assert.Error(t, types.ValidateNodeDiscovery(msg), "Missing type")
+}
+
+func TestIsValidNodeTypeAndRunState(t *testing.T) {
+	assert.True(t, types.IsValidNodeType(string(types.NodeTypeAdapter)))
+	assert.True(t, types.IsValidNodeType(string(types.NodeTypeWeighScale)))
+	assert.Contains(t, types.NodeTypes, types.NodeTypeUnknown)
+	assert.False(t, types.IsValidNodeType("teleporter"))
+	assert.False(t, types.IsValidNodeType(""))
+
+	for _, runState := range types.NodeRunStates {
+		assert.True(t, types.IsValidRunState(runState))
+	}
+	assert.True(t, types.IsValidRunState(types.NodeRunStateReady))
+	assert.False(t, types.IsValidRunState("hibernating"))
+}
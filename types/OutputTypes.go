@@ -1,6 +1,8 @@
 // Package types with output message type definitions and constants
 package types
 
+import "time"
+
 // DefaultOutputInstance is the output instance identifier when only a single instance exists
 const DefaultOutputInstance = "0"
 
@@ -81,67 +83,75 @@ const (
 	OutputTypeWindSpeed              OutputType = "windspeed"
 )
 
-// OutputTypeMap defines data type and unit for an IOType
-// Todo: option to download from file
-// var OutputTypeMap = map[OutputType]struct {
-// 	DataType    DataType
-// 	DefaultUnit Unit
-// 	UnitValues  string
-// }{
-// 	OutputTypeUnknown:                {},
-// 	OutputTypeAcceleration:           {DataType: DataTypeNumber, DefaultUnit: "m/s2"},
-// 	OutputTypeAirQuality:             {DataType: DataTypeNumber, DefaultUnit: ""},
-// 	OutputTypeAlarm:                  {DataType: DataTypeString},
-// 	OutputTypeAtmosphericPressure:    {DataType: DataTypeNumber, DefaultUnit: UnitMillibar, UnitValues: UnitValuesAtmosphericPressure},
-// 	OutputTypeBattery:                {DataType: DataTypeNumber, DefaultUnit: UnitPercent},
-// 	OutputTypeCarbonDioxideLevel:     {DataType: DataTypeNumber, DefaultUnit: UnitPartsPerMillion},
-// 	OutputTypeCarbonMonoxideDetector: {DataType: DataTypeBool},
-// 	OutputTypeCarbonMonoxideLevel:    {DataType: DataTypeNumber, DefaultUnit: UnitPartsPerMillion},
-// 	OutputTypeChannel:                {DataType: DataTypeNumber},
-// 	OutputTypeColor:                  {DataType: DataTypeString},
-// 	OutputTypeColorTemperature:       {DataType: DataTypeNumber, DefaultUnit: UnitKelvin},
-// 	OutputTypeConnections:            {DataType: DataTypeNumber},
-// 	OutputTypeContact:                {DataType: DataTypeBool},
-// 	OutputTypeCPULevel:               {DataType: DataTypeNumber, DefaultUnit: UnitPercent},
-// 	OutputTypeDewpoint:               {DataType: DataTypeNumber, DefaultUnit: UnitCelcius, UnitValues: UnitValuesTemperature},
-// 	OutputTypeDimmer:                 {DataType: DataTypeNumber, DefaultUnit: UnitPercent},
-// 	OutputTypeDoorWindowSensor:       {DataType: DataTypeBool},
-// 	OutputTypeElectricCurrent:        {DataType: DataTypeBool, DefaultUnit: UnitAmp},
-// 	OutputTypeElectricEnergy:         {DataType: DataTypeNumber, DefaultUnit: UnitKWH},
-// 	OutputTypeElectricPower:          {DataType: DataTypeNumber, DefaultUnit: UnitWatt},
-// 	OutputTypeErrors:                 {DataType: DataTypeNumber},
-// 	OutputTypeHeatIndex:              {DataType: DataTypeNumber, DefaultUnit: UnitCelcius, UnitValues: "C, F"},
-// 	OutputTypeHue:                    {DataType: DataTypeString},
-// 	OutputTypeHumidex:                {DataType: DataTypeNumber, DefaultUnit: UnitCelcius, UnitValues: "C, F"},
-// 	OutputTypeHumidity:               {DataType: DataTypeNumber, DefaultUnit: UnitPercent},
-// 	OutputTypeImage:                  {DataType: DataTypeBytes, DefaultUnit: "", UnitValues: UnitValuesImage},
-// 	OutputTypeLatency:                {DataType: DataTypeNumber, DefaultUnit: UnitSecond},
-// 	OutputTypeLevel:                  {DataType: DataTypeNumber, DefaultUnit: UnitPercent},
-// 	OutputTypeLocation:               {DataType: DataTypeString},
-// 	OutputTypeLock:                   {DataType: DataTypeString},
-// 	OutputTypeLuminance:              {DataType: DataTypeNumber, DefaultUnit: UnitLux},
-// 	OutputTypeMotion:                 {DataType: DataTypeBool},
-// 	OutputTypeMute:                   {DataType: DataTypeBool},
-// 	OutputTypeOnOffSwitch:            {DataType: DataTypeBool},
-// 	OutputTypePlay:                   {DataType: DataTypeBool},
-// 	OutputTypePushButton:             {DataType: DataTypeNumber},
-// 	OutputTypeRain:                   {DataType: DataTypeNumber, DefaultUnit: UnitMeter, UnitValues: "m"},
-// 	OutputTypeSaturation:             {DataType: DataTypeString},
-// 	OutputTypeScale:                  {DataType: DataTypeNumber, DefaultUnit: UnitKG, UnitValues: UnitValuesWeight},
-// 	OutputTypeSnow:                   {DataType: DataTypeNumber, DefaultUnit: UnitMeter, UnitValues: "m"},
-// 	OutputTypeSignalStrength:         {DataType: DataTypeNumber, DefaultUnit: "dBm"},
-// 	OutputTypeSmokeDetector:          {DataType: DataTypeBool},
-// 	OutputTypeSoundDetector:          {DataType: DataTypeBool},
-// 	OutputTypeTemperature:            {DataType: DataTypeNumber},
-// 	OutputTypeUltraviolet:            {DataType: DataTypeNumber},
-// 	OutputTypeVibrationDetector:      {DataType: DataTypeNumber},
-// 	OutputTypeValue:                  {DataType: DataTypeNumber},
-// 	OutputTypeVoltage:                {DataType: DataTypeNumber, DefaultUnit: UnitVolt},
-// 	OutputTypeVolume:                 {DataType: DataTypeNumber, DefaultUnit: UnitPercent},
-// 	OutputTypeWaterLevel:             {DataType: DataTypeNumber, DefaultUnit: UnitMeter, UnitValues: UnitValuesLength},
-// 	OutputTypeWindHeading:            {DataType: DataTypeNumber, DefaultUnit: UnitDegree},
-// 	OutputTypeWindSpeed:              {DataType: DataTypeNumber, DefaultUnit: UnitSpeed, UnitValues: UnitValuesSpeed},
-// }
+// OutputTypeInfo with the canonical data type and default unit of an output type
+type OutputTypeInfo struct {
+	DataType    DataType
+	DefaultUnit Unit
+}
+
+// outputTypeInfoMap defines the data type and default unit of the known output types
+var outputTypeInfoMap = map[OutputType]OutputTypeInfo{
+	OutputTypeAcceleration:           {DataType: DataTypeNumber, DefaultUnit: "m/s2"},
+	OutputTypeAirQuality:             {DataType: DataTypeNumber},
+	OutputTypeAlarm:                  {DataType: DataTypeString},
+	OutputTypeAtmosphericPressure:    {DataType: DataTypeNumber, DefaultUnit: UnitMillibar},
+	OutputTypeBattery:                {DataType: DataTypeNumber, DefaultUnit: UnitPercent},
+	OutputTypeCarbonDioxideLevel:     {DataType: DataTypeNumber, DefaultUnit: UnitPartsPerMillion},
+	OutputTypeCarbonMonoxideDetector: {DataType: DataTypeBool},
+	OutputTypeCarbonMonoxideLevel:    {DataType: DataTypeNumber, DefaultUnit: UnitPartsPerMillion},
+	OutputTypeChannel:                {DataType: DataTypeNumber},
+	OutputTypeColor:                  {DataType: DataTypeString},
+	OutputTypeColorTemperature:       {DataType: DataTypeNumber, DefaultUnit: UnitKelvin},
+	OutputTypeConnections:            {DataType: DataTypeNumber},
+	OutputTypeCPULevel:               {DataType: DataTypeNumber, DefaultUnit: UnitPercent},
+	OutputTypeDewpoint:               {DataType: DataTypeNumber, DefaultUnit: UnitCelcius},
+	OutputTypeDimmer:                 {DataType: DataTypeNumber, DefaultUnit: UnitPercent},
+	OutputTypeDoorWindowSensor:       {DataType: DataTypeBool},
+	OutputTypeElectricCurrent:        {DataType: DataTypeNumber, DefaultUnit: UnitAmp},
+	OutputTypeElectricEnergy:         {DataType: DataTypeNumber, DefaultUnit: UnitKWH},
+	OutputTypeElectricPower:          {DataType: DataTypeNumber, DefaultUnit: UnitWatt},
+	OutputTypeErrors:                 {DataType: DataTypeNumber},
+	OutputTypeHeatIndex:              {DataType: DataTypeNumber, DefaultUnit: UnitCelcius},
+	OutputTypeHue:                    {DataType: DataTypeString},
+	OutputTypeHumidex:                {DataType: DataTypeNumber, DefaultUnit: UnitCelcius},
+	OutputTypeHumidity:               {DataType: DataTypeNumber, DefaultUnit: UnitPercent},
+	OutputTypeImage:                  {DataType: DataTypeBytes},
+	OutputTypeLatency:                {DataType: DataTypeNumber, DefaultUnit: UnitSecond},
+	OutputTypeLevel:                  {DataType: DataTypeNumber, DefaultUnit: UnitPercent},
+	OutputTypeLocation:               {DataType: DataTypeString},
+	OutputTypeLock:                   {DataType: DataTypeString},
+	OutputTypeLuminance:              {DataType: DataTypeNumber, DefaultUnit: UnitLux},
+	OutputTypeMotion:                 {DataType: DataTypeBool},
+	OutputTypeMute:                   {DataType: DataTypeBool},
+	OutputTypePlay:                   {DataType: DataTypeBool},
+	OutputTypePushButton:             {DataType: DataTypeNumber},
+	OutputTypeRain:                   {DataType: DataTypeNumber, DefaultUnit: UnitMeter},
+	OutputTypeRelay:                  {DataType: DataTypeBool},
+	OutputTypeSaturation:             {DataType: DataTypeString},
+	OutputTypeScale:                  {DataType: DataTypeNumber, DefaultUnit: UnitKG},
+	OutputTypeSignalStrength:         {DataType: DataTypeNumber, DefaultUnit: "dBm"},
+	OutputTypeSmokeDetector:          {DataType: DataTypeBool},
+	OutputTypeSnow:                   {DataType: DataTypeNumber, DefaultUnit: UnitMeter},
+	OutputTypeSoundDetector:          {DataType: DataTypeBool},
+	OutputTypeSwitch:                 {DataType: DataTypeBool},
+	OutputTypeTemperature:            {DataType: DataTypeNumber, DefaultUnit: UnitCelcius},
+	OutputTypeUltraviolet:            {DataType: DataTypeNumber},
+	OutputTypeVibrationDetector:      {DataType: DataTypeNumber},
+	OutputTypeValue:                  {DataType: DataTypeNumber},
+	OutputTypeVoltage:                {DataType: DataTypeNumber, DefaultUnit: UnitVolt},
+	OutputTypeVolume:                 {DataType: DataTypeNumber, DefaultUnit: UnitPercent},
+	OutputTypeWaterLevel:             {DataType: DataTypeNumber, DefaultUnit: UnitMeter},
+	OutputTypeWeather:                {DataType: DataTypeString},
+	OutputTypeWindHeading:            {DataType: DataTypeNumber, DefaultUnit: UnitDegree},
+	OutputTypeWindSpeed:              {DataType: DataTypeNumber, DefaultUnit: UnitMetersPerSecond},
+}
+
+// GetOutputTypeInfo returns the canonical data type and default unit of an output type
+// Returns false if the output type is not known.
+func GetOutputTypeInfo(outputType OutputType) (info OutputTypeInfo, found bool) {
+	info, found = outputTypeInfoMap[outputType]
+	return info, found
+}
 
 // OutputBatchMessage message with multiple output events
 type OutputBatchMessage struct {
@@ -164,6 +174,8 @@ type OutputDiscoveryMessage struct {
 	Min        float32       `json:"min,omitempty"`        // optional min value of output for numeric data types
 	Timestamp  string        `json:"timestamp"`            // time the record is last updated
 	Unit       Unit          `json:"unit,omitempty"`       // unit of output value
+	// optional transform that is applied in order to the output values before they are published
+	Transform []OutputTransformStep `json:"transform,omitempty"`
 	// For convenience, filled when registering or receiving
 	OutputID    string     `json:"-"`
 	NodeHWID    string     `json:"-"`
@@ -172,10 +184,20 @@ type OutputDiscoveryMessage struct {
 	Instance    string     `json:"-"`
 }
 
+// OutputTransformStep describes a step of the transform that is applied to the values of an output
+type OutputTransformStep struct {
+	Op       string  `json:"op"`                 // operation, eg "scale"
+	Value    float64 `json:"value,omitempty"`    // factor of scale, amount of offset or nr of decimals of round
+	Min      float64 `json:"min,omitempty"`      // lower limit of clamp
+	Max      float64 `json:"max,omitempty"`      // upper limit of clamp
+	Rounding string  `json:"rounding,omitempty"` // rounding method of round
+}
+
 // OutputEventMessage message with multiple output values
 type OutputEventMessage struct {
 	Address   string            `json:"address"` // Address of the publication: zone/publisher/node/$output/type/instance
 	Event     map[string]string `json:"event"`
+	Origin    string            `json:"origin,omitempty"` // original address when republished by a bridge
 	Timestamp string            `json:"timestamp"`
 }
 
@@ -186,8 +208,9 @@ type OutputEventMessage struct {
 type OutputForecastMessage struct {
 	Address   string        `json:"address"` // Address of the publication: zone/publisher/node/$output/type/instance
 	Duration  int           `json:"duration,omitempty"`
-	Forecast  []OutputValue `json:"forecast"`  // list of timestamp and value pairs
-	Timestamp string        `json:"timestamp"` // timestamp the forecast was created
+	Forecast  []OutputValue `json:"forecast"`         // list of timestamp and value pairs
+	Origin    string        `json:"origin,omitempty"` // original address when republished by a bridge
+	Timestamp string        `json:"timestamp"`        // timestamp the forecast was created
 	Unit      Unit          `json:"unit,omitempty"`
 }
 
@@ -196,16 +219,34 @@ type OutputHistoryMessage struct {
 	Address   string        `json:"address"` // Address of the publication: zone/publisher/node/$output/type/instance
 	Duration  int           `json:"duration,omitempty"`
 	History   []OutputValue `json:"history"`
+	Origin    string        `json:"origin,omitempty"` // original address when republished by a bridge
 	Timestamp string        `json:"timestamp"`
 	Unit      Unit          `json:"unit,omitempty"`
 }
 
 // OutputLatestMessage struct to send/receive the '$latest' command
 type OutputLatestMessage struct {
-	Address   string `json:"address"`   // Address of the publication: zone/publisher/node/$output/type/instance
-	Timestamp string `json:"timestamp"` // timestamp of value
+	Address   string `json:"address"`          // Address of the publication: zone/publisher/node/$output/type/instance
+	Origin    string `json:"origin,omitempty"` // original address when republished by a bridge
+	Timestamp string `json:"timestamp"`        // timestamp of value
 	Unit      Unit   `json:"unit,omitempty"`
 	Value     string `json:"value"` // this can also be a string containing a list, eg "[ a, b, c ]""
+
+	// optional value as a JSON number or boolean, based on the output data type. See TypedValue.
+	TypedValue interface{} `json:"typedValue,omitempty"`
+
+	// optional time after which the value is no longer valid, as declared by the publisher
+	Expires string `json:"expires,omitempty"`
+}
+
+// IsExpired returns true if the value has an expiry time that has passed
+// Values with an invalid expiry time are considered expired.
+func (latest *OutputLatestMessage) IsExpired(now time.Time) bool {
+	if latest.Expires == "" {
+		return false
+	}
+	expires, err := time.Parse(TimeFormat, latest.Expires)
+	return err != nil || !now.Before(expires)
 }
 
 // OutputValue struct for history and forecast
@@ -1,6 +1,8 @@
 // Package types with publisher message type definitions
 package types
 
+import "strings"
+
 // DSSPublisherID defines the publisherID of a domain's security service
 // the DSS is responsible for renewal of keys in a secured domain.
 const DSSPublisherID = "$dss"
@@ -17,6 +19,33 @@ const (
 	PublisherRunStateLost         PublisherRunState = "lost"         // Publisher unexpectedly disconnected
 )
 
+// PublisherCapability is the name of a feature in the capabilities of a publisher identity
+type PublisherCapability string
+
+// PublisherCapabilityMap for storing the capabilities of a publisher. Values are comma separated lists.
+// Capabilities that aren't known to the receiver are ignored so new capabilities can be added.
+type PublisherCapabilityMap map[PublisherCapability]string
+
+// Predefined publisher capabilities
+const (
+	// CapabilityAlgorithms lists the JWS signature algorithms the publisher accepts, eg "ES256,ES384"
+	CapabilityAlgorithms PublisherCapability = "algorithms"
+	// CapabilityEncryptedMessageTypes lists the message types the publisher accepts encrypted, eg "$setInput"
+	CapabilityEncryptedMessageTypes PublisherCapability = "encryptedMessageTypes"
+	// CapabilityMessageTypes lists the message types the publisher handles, eg "$configure,$setInput"
+	CapabilityMessageTypes PublisherCapability = "messageTypes"
+)
+
+// Supports returns true if the value is included in the comma separated list of a capability
+func (capabilities PublisherCapabilityMap) Supports(capability PublisherCapability, value string) bool {
+	for _, item := range strings.Split(capabilities[capability], ",") {
+		if strings.TrimSpace(item) == value && value != "" {
+			return true
+		}
+	}
+	return false
+}
+
 // PublisherIdentityMessage contains the public identity of a publisher
 type PublisherIdentityMessage struct {
 	Address           string `json:"address"`               // publication address of this identity, eg domain/publisherId/\$identity
@@ -30,6 +59,10 @@ type PublisherIdentityMessage struct {
 	ValidUntil        string `json:"validUntil"`            // timestamp this identity expires
 	IdentitySignature string `json:"signature"`             // base64 encoded signature of this identity
 	Timestamp         string `json:"timestamp"`             // timestamp this message was created
+
+	// optional features supported by the publisher, for negotiation between publishers.
+	// Capabilities are not included in the identity signature.
+	Capabilities PublisherCapabilityMap `json:"capabilities,omitempty"`
 }
 
 // PublisherFullIdentity containing the public identity, DSS signature and private key
@@ -0,0 +1,74 @@
+// Package types with conversion of values between units
+package types
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// unitConversion converts a unit to and from the base unit of its quantity
+type unitConversion struct {
+	quantity string                      // the quantity the unit measures, eg temperature
+	toBase   func(value float64) float64 // convert a value in this unit to the base unit
+	fromBase func(value float64) float64 // convert a value in the base unit to this unit
+}
+
+// scale returns a conversion for a unit that is a multiple of the base unit
+func scale(quantity string, factor float64) unitConversion {
+	return unitConversion{
+		quantity: quantity,
+		toBase:   func(value float64) float64 { return value * factor },
+		fromBase: func(value float64) float64 { return value / factor },
+	}
+}
+
+// unitConversions with the supported units. Base units are Celcius, meter, pascal, m/s, kg and liter.
+var unitConversions = map[Unit]unitConversion{
+	UnitCelcius: scale("temperature", 1),
+	UnitFahrenheit: {
+		quantity: "temperature",
+		toBase:   func(value float64) float64 { return (value - 32) * 5 / 9 },
+		fromBase: func(value float64) float64 { return value*9/5 + 32 },
+	},
+	UnitKelvin: {
+		quantity: "temperature",
+		toBase:   func(value float64) float64 { return value - 273.15 },
+		fromBase: func(value float64) float64 { return value + 273.15 },
+	},
+	UnitMeter:           scale("length", 1),
+	UnitFeet:            scale("length", 0.3048),
+	UnitPascal:          scale("pressure", 1),
+	UnitMillibar:        scale("pressure", 100),
+	UnitMercury:         scale("pressure", 3386.389),
+	UnitPSI:             scale("pressure", 6894.757),
+	UnitMetersPerSecond: scale("speed", 1),
+	UnitKmPerHour:       scale("speed", 1/3.6),
+	UnitMilesPerHour:    scale("speed", 0.44704),
+	UnitKG:              scale("weight", 1),
+	UnitPounds:          scale("weight", 0.45359237),
+	UnitLiter:           scale("volume", 1),
+	UnitGallon:          scale("volume", 3.785411784),
+}
+
+// ConvertValue converts a numeric value from one unit to another
+// Supported are temperature, length, pressure, speed, weight and volume units.
+// The result is rounded to 6 decimals.
+// Returns an error if the value is not a number or the units are not compatible
+func ConvertValue(value string, fromUnit Unit, toUnit Unit) (string, error) {
+	if fromUnit == toUnit {
+		return value, nil
+	}
+	from, fromFound := unitConversions[fromUnit]
+	to, toFound := unitConversions[toUnit]
+	if !fromFound || !toFound || from.quantity != to.quantity {
+		return value, fmt.Errorf("ConvertValue: Unable to convert from unit '%s' to unit '%s'", fromUnit, toUnit)
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return value, fmt.Errorf("ConvertValue: Value '%s' is not a number", value)
+	}
+	converted := to.fromBase(from.toBase(number))
+	converted = math.Round(converted*1e6) / 1e6
+	return strconv.FormatFloat(converted, 'f', -1, 64), nil
+}
@@ -0,0 +1,66 @@
+package types_test
+
+import (
+	"testing"
+
+	"github.com/iotdomain/iotdomain-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertValue(t *testing.T) {
+	conversions := []struct {
+		value    string
+		fromUnit types.Unit
+		toUnit   types.Unit
+		expected string
+	}{
+		// temperature
+		{"100", types.UnitCelcius, types.UnitFahrenheit, "212"},
+		{"32", types.UnitFahrenheit, types.UnitCelcius, "0"},
+		{"0", types.UnitCelcius, types.UnitKelvin, "273.15"},
+		{"0", types.UnitKelvin, types.UnitFahrenheit, "-459.67"},
+		// length
+		{"1", types.UnitMeter, types.UnitFeet, "3.28084"},
+		{"10", types.UnitFeet, types.UnitMeter, "3.048"},
+		// pressure
+		{"1013.25", types.UnitMillibar, types.UnitPascal, "101325"},
+		{"1", types.UnitPSI, types.UnitMillibar, "68.94757"},
+		{"1", types.UnitMercury, types.UnitPascal, "3386.389"},
+		// speed
+		{"36", types.UnitKmPerHour, types.UnitMetersPerSecond, "10"},
+		{"1", types.UnitMilesPerHour, types.UnitKmPerHour, "1.609344"},
+		{"1", types.UnitMetersPerSecond, types.UnitMilesPerHour, "2.236936"},
+		// weight
+		{"1", types.UnitPounds, types.UnitKG, "0.453592"},
+		{"1", types.UnitKG, types.UnitPounds, "2.204623"},
+		// volume
+		{"1", types.UnitGallon, types.UnitLiter, "3.785412"},
+		{"3.785411784", types.UnitLiter, types.UnitGallon, "1"},
+		// the same unit doesn't convert
+		{"21.5", types.UnitCelcius, types.UnitCelcius, "21.5"},
+	}
+	for _, conversion := range conversions {
+		result, err := types.ConvertValue(conversion.value, conversion.fromUnit, conversion.toUnit)
+		assert.NoError(t, err, "%s %s to %s", conversion.value, conversion.fromUnit, conversion.toUnit)
+		assert.Equal(t, conversion.expected, result, "%s %s to %s", conversion.value, conversion.fromUnit, conversion.toUnit)
+	}
+
+	invalid := []struct {
+		value    string
+		fromUnit types.Unit
+		toUnit   types.Unit
+	}{
+		{"N/A", types.UnitCelcius, types.UnitFahrenheit}, // not a number
+		{"", types.UnitMeter, types.UnitFeet},            // empty value
+		{"10", types.UnitCelcius, types.UnitMeter},       // different quantities
+		{"10", types.UnitVolt, types.UnitWatt},           // unsupported units
+		{"10", types.UnitNone, types.UnitCelcius},        // missing unit
+		{"10", types.UnitPSI, types.UnitMetersPerSecond}, // different quantities
+	}
+	for _, conversion := range invalid {
+		result, err := types.ConvertValue(conversion.value, conversion.fromUnit, conversion.toUnit)
+		assert.Error(t, err, "%s %s to %s", conversion.value, conversion.fromUnit, conversion.toUnit)
+		// the value is returned unchanged
+		assert.Equal(t, conversion.value, result)
+	}
+}